@@ -0,0 +1,428 @@
+package stunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// defaultTopTalkers is the number of sessions in the top-talkers report if not specified.
+const defaultTopTalkers = 10
+
+// statusResponse is the generic response of the admin endpoints.
+type statusResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// readinessResponse is the response to a readiness probe.
+type readinessResponse struct {
+	Status    int               `json:"status"`
+	Message   string            `json:"message"`
+	Listeners map[string]string `json:"listeners,omitempty"`
+}
+
+// writeJSON writes a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	js, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		js, _ = json.Marshal(statusResponse{Status: code, Message: err.Error()})
+	}
+	w.WriteHeader(code)
+	w.Write(append(js, '\n')) //nolint:errcheck
+}
+
+// writeStatus writes a status response with the given status code and message.
+func writeStatus(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, statusResponse{Status: code, Message: msg})
+}
+
+// allowMethods responds with an error and returns false if the method of the request is not
+// among the allowed methods.
+func allowMethods(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if req.Method == m {
+			return true
+		}
+	}
+	writeStatus(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+// registerAdminEndpoints mounts the built-in endpoints of the health-check and the admin API
+// servers. The health-check server serves only the read-only probes, everything else is served
+// only on the authenticated admin API server.
+func (s *Stunner) registerAdminEndpoints() {
+	probes := map[string]http.HandlerFunc{
+		// liveness probe always succeeds once we got here
+		"/live": func(w http.ResponseWriter, _ *http.Request) { writeJSON(w, http.StatusOK, struct{}{}) },
+		// the response of the readiness probe includes the readiness of each listener
+		"/ready":  newReadinessHandlerFunc(s.NewReadinessHandler(), s.NewListenerReadinessHandler()),
+		"/status": newStatusHandlerFunc(s.NewStatusHandler()),
+	}
+	for path, h := range probes {
+		if err := s.extensions.mount(path, h, true); err != nil {
+			s.log.Errorf("Internal error: %s", err.Error())
+		}
+	}
+
+	endpoints := map[string]http.HandlerFunc{
+		// switch between active and standby mode
+		"/promote": newStandbyHandlerFunc(s.NewStandbyHandler(), false),
+		"/demote":  newStandbyHandlerFunc(s.NewStandbyHandler(), true),
+		// enable (POST) or disable (DELETE) packet tapping for sessions
+		"/tap": newTapHandlerFunc(s.NewTapHandler()),
+		// add (POST) or remove (DELETE) runtime credentials
+		"/credentials": newCredentialHandlerFunc(s.NewCredentialHandler()),
+		// set up (POST) or disable (DELETE) fault injection, only available in debug builds
+		"/faults": newFaultHandlerFunc(s.NewFaultHandler()),
+		// administratively disable (optionally draining the allocations) or enable a listener
+		"/disable": newListenerToggleHandlerFunc(s.NewListenerToggleHandler(), true),
+		"/enable":  newListenerToggleHandlerFunc(s.NewListenerToggleHandler(), false),
+		"/stats":   newListenerStatsHandlerFunc(s.NewListenerStatsHandler()),
+		"/top":     newTopTalkersHandlerFunc(s.NewTopTalkersHandler()),
+		"/rtt":     newClientRTTHandlerFunc(s.NewClientRTTHandler()),
+		// load signals for horizontal autoscalers
+		"/scale": newScalingMetricsHandlerFunc(s.NewScalingMetricsHandler()),
+		// enter (POST) draining mode, waiting for the allocations to drain, or leave (DELETE)
+		// draining mode
+		"/drain": newDrainHandlerFunc(s.NewDrainHandler()),
+		// active allocations and the projected drain time
+		"/grace": newDrainEstimateHandlerFunc(s.NewDrainEstimateHandler()),
+	}
+	for path, h := range endpoints {
+		if err := s.extensions.mount(path, h, false); err != nil {
+			s.log.Errorf("Internal error: %s", err.Error())
+		}
+	}
+}
+
+func newReadinessHandlerFunc(rc object.ReadinessHandler, lrc object.ListenerReadinessHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		res := readinessResponse{Status: http.StatusOK, Message: "READY"}
+		if err := rc(); err != nil {
+			res.Status, res.Message = http.StatusServiceUnavailable, err.Error()
+		}
+		res.Listeners = map[string]string{}
+		for name, err := range lrc() {
+			res.Listeners[name] = "READY"
+			if err != nil {
+				res.Listeners[name] = err.Error()
+			}
+		}
+		writeJSON(w, res.Status, res)
+	}
+}
+
+// newStatusHandlerFunc returns the status, with the listeners and the clusters filtered by the
+// label selector, if given.
+func newStatusHandlerFunc(h object.StatusHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		selector, ok := parseLabelSelector(w, req)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, selectStatus(h(), selector))
+	}
+}
+
+func newStandbyHandlerFunc(h object.StandbyHandler, standby bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodPost) {
+			return
+		}
+		if err := h(standby); err != nil {
+			writeStatus(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		msg := "ACTIVE"
+		if standby {
+			msg = "STANDBY"
+		}
+		writeStatus(w, http.StatusOK, msg)
+	}
+}
+
+// newDrainHandlerFunc serves the drain requests, e.g., from Kubernetes preStop hooks. A POST
+// request blocks until all allocations are drained, or until the timeout given as a Go duration
+// (e.g., timeout=30s) expires or the client goes away. The request succeeds either way, the
+// response reports the number of the remaining allocations.
+func newDrainHandlerFunc(h object.DrainHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodPost, http.MethodDelete) {
+			return
+		}
+		if req.Method == http.MethodDelete {
+			h(req.Context(), false)
+			writeStatus(w, http.StatusOK, "ACTIVE")
+			return
+		}
+
+		ctx := req.Context()
+		if t := req.FormValue("timeout"); t != "" {
+			timeout, err := time.ParseDuration(t)
+			if err != nil || timeout < 0 {
+				writeStatus(w, http.StatusBadRequest, "invalid timeout: "+t)
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		msg := "DRAINED"
+		if n := h(ctx, true); n > 0 {
+			msg = fmt.Sprintf("DRAINING: %d allocation(s) left", n)
+		}
+		writeStatus(w, http.StatusOK, msg)
+	}
+}
+
+func newDrainEstimateHandlerFunc(h object.DrainEstimateHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodGet) {
+			return
+		}
+		estimate, err := h(req.FormValue("listener"))
+		if err != nil {
+			writeStatus(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, estimate)
+	}
+}
+
+func newListenerToggleHandlerFunc(h object.ListenerToggleHandler, disable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodPost) {
+			return
+		}
+
+		drain := false
+		if d := req.FormValue("drain"); d != "" {
+			var err error
+			if drain, err = strconv.ParseBool(d); err != nil {
+				writeStatus(w, http.StatusBadRequest, "invalid drain: "+d)
+				return
+			}
+		}
+
+		if err := h(req.FormValue("listener"), disable, drain); err != nil {
+			writeStatus(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		msg := "ENABLED"
+		if disable {
+			msg = "DISABLED"
+		}
+		writeStatus(w, http.StatusOK, msg)
+	}
+}
+
+// parseLabelSelector parses the label selector given in the "selector" parameter of a request,
+// responding with an error if the selector is invalid.
+func parseLabelSelector(w http.ResponseWriter, req *http.Request) (*stnrv1.LabelSelector, bool) {
+	selector, err := stnrv1.ParseLabelSelector(req.FormValue("selector"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return selector, true
+}
+
+// selectStatus removes the listeners and the clusters not selected by the label selector from
+// the status.
+func selectStatus(status stnrv1.Status, selector *stnrv1.LabelSelector) stnrv1.Status {
+	s, ok := status.(*stnrv1.StunnerStatus)
+	if !ok || selector.Empty() {
+		return status
+	}
+	ls := []*stnrv1.ListenerStatus{}
+	for _, l := range s.Listeners {
+		if l != nil && l.ListenerConfig != nil && selector.Matches(l.Labels) {
+			ls = append(ls, l)
+		}
+	}
+	cs := []*stnrv1.ClusterStatus{}
+	for _, c := range s.Clusters {
+		if c != nil && c.ClusterConfig != nil && selector.Matches(c.Labels) {
+			cs = append(cs, c)
+		}
+	}
+	s.Listeners, s.Clusters = ls, cs
+	return s
+}
+
+func newListenerStatsHandlerFunc(h object.ListenerStatsHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodGet) {
+			return
+		}
+		selector, ok := parseLabelSelector(w, req)
+		if !ok {
+			return
+		}
+		stats, err := h(req.FormValue("listener"), selector)
+		if err != nil {
+			writeStatus(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
+
+// newScalingMetricsHandlerFunc serves the load signals for horizontal autoscalers, either as a
+// flat JSON object (the default, e.g., for the metrics-api scaler of KEDA) or in the Prometheus
+// text format (format=prometheus).
+func newScalingMetricsHandlerFunc(h object.ScalingMetricsHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodGet) {
+			return
+		}
+
+		format := req.FormValue("format")
+		if format != "" && format != "json" && format != "prometheus" {
+			writeStatus(w, http.StatusBadRequest, "invalid format: "+format)
+			return
+		}
+
+		metrics, err := h(req.FormValue("listener"))
+		if err != nil {
+			writeStatus(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		if format == "prometheus" {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "# HELP stunner_scaling_allocations Number of active allocations.\n"+ //nolint:errcheck
+				"# TYPE stunner_scaling_allocations gauge\n"+
+				"stunner_scaling_allocations %d\n"+
+				"# HELP stunner_scaling_bandwidth_bps Relayed bandwidth in bits per second.\n"+
+				"# TYPE stunner_scaling_bandwidth_bps gauge\n"+
+				"stunner_scaling_bandwidth_bps %g\n", metrics.Allocations, metrics.Bandwidth)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, metrics)
+	}
+}
+
+func newTopTalkersHandlerFunc(h object.TopTalkersHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodGet) {
+			return
+		}
+		n := defaultTopTalkers
+		if s := req.FormValue("n"); s != "" {
+			var err error
+			if n, err = strconv.Atoi(s); err != nil || n <= 0 {
+				writeStatus(w, http.StatusBadRequest, "invalid n: "+s)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, h(n))
+	}
+}
+
+// newClientRTTHandlerFunc returns the round-trip time statistics of the client networks.
+func newClientRTTHandlerFunc(h object.ClientRTTHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, h())
+	}
+}
+
+func newTapHandlerFunc(h object.TapHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodPost, http.MethodDelete) {
+			return
+		}
+
+		q := req.URL.Query()
+		selector, value := "", ""
+		for _, s := range []string{"username", "client"} {
+			if q.Has(s) {
+				selector, value = s, q.Get(s)
+				break
+			}
+		}
+
+		if err := h(selector, value, req.Method == http.MethodPost); err != nil {
+			writeStatus(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeStatus(w, http.StatusOK, "OK")
+	}
+}
+
+func newCredentialHandlerFunc(h object.CredentialHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodPost, http.MethodDelete) {
+			return
+		}
+
+		// accept both query parameters and form-encoded bodies, so that passwords need not
+		// appear in the URL
+		var ttl time.Duration
+		if t := req.FormValue("ttl"); t != "" {
+			secs, err := strconv.Atoi(t)
+			if err != nil || secs < 0 {
+				writeStatus(w, http.StatusBadRequest, "invalid ttl: "+t)
+				return
+			}
+			ttl = time.Duration(secs) * time.Second
+		}
+
+		err := h(req.FormValue("username"), req.FormValue("password"), ttl,
+			req.Method == http.MethodPost)
+		if err != nil {
+			writeStatus(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeStatus(w, http.StatusOK, "OK")
+	}
+}
+
+func newFaultHandlerFunc(h object.FaultHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowMethods(w, req, http.MethodPost, http.MethodDelete) {
+			return
+		}
+
+		// DELETE disables fault injection
+		var drop, delay, failEvery int
+		if req.Method == http.MethodPost {
+			for param, v := range map[string]*int{"drop": &drop, "delay": &delay,
+				"fail_allocate": &failEvery} {
+				s := req.FormValue(param)
+				if s == "" {
+					continue
+				}
+				i, err := strconv.Atoi(s)
+				if err != nil {
+					writeStatus(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", param, s))
+					return
+				}
+				*v = i
+			}
+		}
+
+		if err := h(drop, time.Duration(delay)*time.Millisecond, failEvery); err != nil {
+			writeStatus(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeStatus(w, http.StatusOK, "OK")
+	}
+}
@@ -0,0 +1,39 @@
+package stunner
+
+import (
+	"net"
+	"runtime"
+	"sync"
+
+	"github.com/pion/logging"
+)
+
+// AffinityPacketConn is a listener net.PacketConn that pins the readloop reading from the
+// PacketConn to a CPU: on the first read the calling goroutine is locked to its OS thread and the
+// thread is pinned to the CPU. The thread exits along with the readloop.
+type AffinityPacketConn struct {
+	net.PacketConn
+	cpu  int
+	once sync.Once
+	log  logging.LeveledLogger
+}
+
+// NewAffinityPacketConn decorates a listener PacketConn with pinning the readloop to a CPU.
+func NewAffinityPacketConn(c net.PacketConn, cpu int, log logging.LeveledLogger) net.PacketConn {
+	return &AffinityPacketConn{PacketConn: c, cpu: cpu, log: log}
+}
+
+// ReadFrom reads from the PacketConn, pinning the caller to the CPU on the first call.
+func (c *AffinityPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.once.Do(func() {
+		runtime.LockOSThread()
+		if err := setThreadAffinity(c.cpu); err != nil {
+			runtime.UnlockOSThread()
+			c.log.Warnf("could not pin readloop to CPU %d: %s", c.cpu, err.Error())
+			return
+		}
+		c.log.Debugf("readloop pinned to CPU %d", c.cpu)
+	})
+
+	return c.PacketConn.ReadFrom(p)
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package stunner
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setThreadAffinity pins the calling OS thread to a CPU.
+func setThreadAffinity(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package stunner
+
+import (
+	"errors"
+)
+
+func setThreadAffinity(_ int) error {
+	return errors.New("CPU affinity is supported only on Linux")
+}
@@ -0,0 +1,269 @@
+package stunner
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/stun/v3"
+
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+// stunAllocateRequest and stunAllocateSuccess are the STUN message types of the Allocate requests
+// and success responses.
+const (
+	stunAllocateRequest = 0x0003
+	stunAllocateSuccess = 0x0103
+)
+
+// allocClaims tracks the Allocate request being handled on a UDP listener, for the features that
+// need to know which client the relay address generator of the TURN server is creating a relay
+// socket for (session affinity tokens, port reservations and relay port pins) and that add
+// attributes to the Allocate responses.
+//
+// The relay address generator does not learn the client, so the Allocate requests are handled one
+// at a time across the readloops of the listener: a readloop reading an Allocate request holds
+// the claim until it reads the next packet, by which time the TURN server has handled the
+// request. The TURN server handles the request, calls the auth handler and the relay address
+// generator and sends the response on the goroutine of the readloop.
+type allocClaims struct {
+	serial       sync.Mutex
+	claim        allocClaim
+	sessions     *sessionTokens
+	reservations *portReservations
+	lock         sync.Mutex
+}
+
+// allocClaim is the Allocate request being handled.
+type allocClaim struct {
+	client   string
+	username string
+	key      []byte // the message integrity key of the client, for signing the response
+	// the SESSION-TOKEN presented by the client, and the entry of the relay socket reclaimed
+	sessionToken string
+	reclaimed    *sessionTokenEntry
+	// the EVEN-PORT attribute and its R bit, and the even relay socket allocated for it
+	evenPort, reservePair bool
+	held                  net.PacketConn
+	// the RESERVATION-TOKEN presented by the client
+	reservationToken string
+}
+
+func newAllocClaims() *allocClaims {
+	return &allocClaims{}
+}
+
+// begin takes the claim for an Allocate request.
+func (a *allocClaims) begin(client string, m *stun.Message) {
+	a.serial.Lock()
+
+	c := allocClaim{client: client}
+	var username stun.Username
+	if err := username.GetFrom(m); err == nil {
+		c.username = username.String()
+	}
+	if a.sessions != nil {
+		if v, err := m.Get(AttrSessionToken); err == nil {
+			c.sessionToken = string(v)
+		}
+	}
+	if v, err := m.Get(stun.AttrEvenPort); err == nil {
+		c.evenPort = true
+		c.reservePair = len(v) > 0 && v[0]&0x80 != 0
+	}
+	if a.reservations != nil {
+		if v, err := m.Get(stun.AttrReservationToken); err == nil {
+			c.reservationToken = string(v)
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.claim = c
+}
+
+// end releases the claim.
+func (a *allocClaims) end() {
+	a.lock.Lock()
+	if a.claim.held != nil {
+		// the TURN server gave up on the request after the even port was allocated
+		a.claim.held.Close() //nolint:errcheck
+	}
+	a.claim = allocClaim{}
+	a.lock.Unlock()
+	a.serial.Unlock()
+}
+
+// get returns a copy of the claim.
+func (a *allocClaims) get() allocClaim {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.claim
+}
+
+// update modifies the claim.
+func (a *allocClaims) update(f func(c *allocClaim)) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f(&a.claim)
+}
+
+// close releases the relay sockets kept for the clients, called when the listener is closed.
+func (a *allocClaims) close() {
+	if a.sessions != nil {
+		a.sessions.close()
+	}
+	if a.reservations != nil {
+		a.reservations.close()
+	}
+}
+
+// newAuthHandler wraps an auth handler so that the message integrity key of the client of the
+// Allocate request being handled is recorded for signing the response.
+func (a *allocClaims) newAuthHandler(h a12n.AuthHandler) a12n.AuthHandler {
+	if h == nil {
+		return nil
+	}
+	return func(username, realm string, src net.Addr) ([]byte, bool) {
+		key, ok := h(username, realm, src)
+		if ok && src != nil {
+			a.update(func(c *allocClaim) {
+				if c.client == src.String() {
+					c.key = key
+				}
+			})
+		}
+		return key, ok
+	}
+}
+
+// decorate adds the session token and the reservation token of the client of the Allocate
+// request being handled to the Allocate success response, recomputing the MESSAGE-INTEGRITY and
+// the FINGERPRINT.
+func (a *allocClaims) decorate(p []byte, addr net.Addr) []byte {
+	if addr == nil || !stun.IsMessage(p) || binary.BigEndian.Uint16(p[0:2]) != stunAllocateSuccess {
+		return p
+	}
+
+	claim := a.get()
+	if claim.client != addr.String() || claim.key == nil {
+		return p
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil || !m.Contains(stun.AttrMessageIntegrity) {
+		return p
+	}
+
+	var add []stun.RawAttribute
+	if a.sessions != nil {
+		if token := a.sessions.tokenOf(claim.client); token != "" {
+			add = append(add, stun.RawAttribute{Type: AttrSessionToken, Value: []byte(token)})
+		}
+	}
+	// the reservation token set by the TURN server is replaced with the token of the relay
+	// port reserved for the client, if any
+	replace := a.reservations != nil && (claim.evenPort || m.Contains(stun.AttrReservationToken))
+	if replace {
+		if token := a.reservations.tokenOf(claim.client); token != "" {
+			add = append(add, stun.RawAttribute{Type: stun.AttrReservationToken,
+				Value: []byte(token)})
+		}
+	}
+	if len(add) == 0 && !replace {
+		return p
+	}
+
+	raw, err := resignMessage(m, claim.key, func(t stun.AttrType) bool {
+		return replace && t == stun.AttrReservationToken
+	}, add)
+	if err != nil {
+		return p
+	}
+	return raw
+}
+
+// resignMessage rebuilds an authenticated STUN message with some attributes removed and others
+// added, recomputing the MESSAGE-INTEGRITY and the FINGERPRINT, if any.
+func resignMessage(m *stun.Message, key []byte, drop func(stun.AttrType) bool, add []stun.RawAttribute) ([]byte, error) {
+	res := &stun.Message{Type: m.Type, TransactionID: m.TransactionID}
+	res.WriteHeader()
+	for _, attr := range m.Attributes {
+		switch attr.Type {
+		case stun.AttrMessageIntegrity, stun.AttrMessageIntegritySHA256, stun.AttrFingerprint:
+		default:
+			if drop == nil || !drop(attr.Type) {
+				res.Add(attr.Type, attr.Value)
+			}
+		}
+	}
+	for _, attr := range add {
+		res.Add(attr.Type, attr.Value)
+	}
+	if err := stun.MessageIntegrity(key).AddTo(res); err != nil {
+		return nil, err
+	}
+	if m.Contains(stun.AttrFingerprint) {
+		if err := stun.Fingerprint.AddTo(res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res.Raw, nil
+}
+
+// allocClaimPacketConn is a listener net.PacketConn that handles the Allocate requests one at a
+// time and adds the session tokens and the reservation tokens to the Allocate responses.
+type allocClaimPacketConn struct {
+	net.PacketConn
+	claims  *allocClaims
+	holding atomic.Bool
+}
+
+func (a *allocClaims) newPacketConn(c net.PacketConn) net.PacketConn {
+	return &allocClaimPacketConn{PacketConn: c, claims: a}
+}
+
+// ReadFrom reads from the PacketConn. Reading an Allocate request takes the claim, which is
+// released on the next read.
+func (c *allocClaimPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	if c.holding.Swap(false) {
+		c.claims.end()
+	}
+
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err != nil || addr == nil || !stun.IsMessage(p[:n]) ||
+		binary.BigEndian.Uint16(p[0:2]) != stunAllocateRequest {
+		return n, addr, err
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p[:n]...)}
+	if derr := m.Decode(); derr != nil {
+		return n, addr, err
+	}
+
+	c.claims.begin(addr.String(), m)
+	c.holding.Store(true)
+
+	return n, addr, err
+}
+
+// WriteTo writes to the PacketConn.
+func (c *allocClaimPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	// only the readloop holding the claim sends Allocate responses
+	if c.holding.Load() {
+		if _, err := c.PacketConn.WriteTo(c.claims.decorate(p, addr), addr); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// Close closes the PacketConn and releases the relay sockets kept for the clients.
+func (c *allocClaimPacketConn) Close() error {
+	c.claims.close()
+	return c.PacketConn.Close()
+}
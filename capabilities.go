@@ -0,0 +1,68 @@
+package stunner
+
+import (
+	"runtime"
+
+	"github.com/l7mp/stunner/internal/util"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// kernel parameters reported in the capability report
+var capabilitySysctls = []string{"net.core.rmem_max", "net.core.wmem_max", "net.core.somaxconn"}
+
+// detectCapabilities collects the features available in the build and the limits of the host.
+func (s *Stunner) detectCapabilities() *stnrv1.Capabilities {
+	c := &stnrv1.Capabilities{
+		Platform:          runtime.GOOS + "/" + runtime.GOARCH,
+		GoVersion:         runtime.Version(),
+		Features:          []string{},
+		ListenerProtocols: []string{},
+		AuthTypes:         []string{},
+		ClusterTypes:      []string{},
+		OffloadEngines:    []string{stnrv1.OffloadEngineNone.String()},
+		Limits: map[string]int64{
+			"cpus":       int64(runtime.NumCPU()),
+			"gomaxprocs": int64(runtime.GOMAXPROCS(0)),
+		},
+	}
+
+	if upgradeSupported {
+		c.Features = append(c.Features, "hitless-upgrade")
+	}
+	if faultInjectionEnabled {
+		c.Features = append(c.Features, "faultinject")
+	}
+	// the offload engine is linked in by replacing the stub offload handler
+	if _, ok := s.offloadHandler.(*offloadHandlerStub); !ok {
+		c.Features = append(c.Features, "offload")
+		c.OffloadEngines = append(c.OffloadEngines, stnrv1.OffloadEngineXDP.String(),
+			stnrv1.OffloadEngineTC.String(), stnrv1.OffloadEngineAuto.String())
+	}
+
+	for p := stnrv1.ListenerProtocolUDP; p <= stnrv1.ListenerProtocolTURNDTLS; p++ {
+		c.ListenerProtocols = append(c.ListenerProtocols, p.String())
+	}
+	for a := stnrv1.AuthTypeNone; a <= stnrv1.AuthTypeLDAP; a++ {
+		c.AuthTypes = append(c.AuthTypes, a.String())
+	}
+	for t := stnrv1.ClusterTypeStatic; t < stnrv1.ClusterTypeUnknown; t++ {
+		c.ClusterTypes = append(c.ClusterTypes, t.String())
+	}
+
+	if _, limit, err := util.FDUsage(); err == nil && limit > 0 {
+		c.Limits["RLIMIT_NOFILE"] = int64(limit)
+	}
+	for _, name := range capabilitySysctls {
+		if v, err := util.Sysctl(name); err == nil {
+			c.Limits[name] = v
+		}
+	}
+
+	return c
+}
+
+// Capabilities returns the capability report of the STUNner instance: the features available in
+// the build and the limits detected on the host at startup. The report must not be modified.
+func (s *Stunner) Capabilities() *stnrv1.Capabilities {
+	return s.capabilities
+}
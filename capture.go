@@ -0,0 +1,193 @@
+package stunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+// CaptureRecord is an inbound STUN message captured at a listener.
+type CaptureRecord struct {
+	// Time is the time the message was received, relative to the start of the capture.
+	Time time.Duration `json:"time"`
+	// Listener is the name of the listener that received the message.
+	Listener string `json:"listener"`
+	// Client is the pseudonymized transport address of the client.
+	Client string `json:"client"`
+	// Message is the sanitized STUN message.
+	Message []byte `json:"message"`
+}
+
+// Capture records the STUN messages received at the UDP listeners into a trace, one JSON-encoded
+// CaptureRecord per line. Messages are sanitized: client addresses and usernames are replaced with
+// stable pseudonyms and MESSAGE-INTEGRITY attributes are zeroed out, so that traces can be shared
+// and turned into regression tests (see Replay) without leaking credentials or client identities.
+// Note that the peer addresses in the messages are kept intact.
+type Capture struct {
+	w       io.Writer
+	enc     *json.Encoder
+	start   time.Time
+	clients map[string]string // pseudonyms for the client IPs
+	users   map[string]string // pseudonyms for the usernames
+	lock    sync.Mutex
+}
+
+// NewCapture creates a new capture that writes the trace to the given writer. If the writer is an
+// io.Closer then it is closed when the capture is closed.
+func NewCapture(w io.Writer) *Capture {
+	return &Capture{
+		w:       w,
+		enc:     json.NewEncoder(w),
+		start:   time.Now(),
+		clients: map[string]string{},
+		users:   map[string]string{},
+	}
+}
+
+// Record sanitizes and records a STUN message received at a listener. Messages that are not valid
+// STUN messages are ignored.
+func (c *Capture) Record(listener string, client net.Addr, p []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	msg, err := c.sanitize(p)
+	if err != nil {
+		return err
+	}
+
+	return c.enc.Encode(CaptureRecord{
+		Time:     time.Since(c.start),
+		Listener: listener,
+		Client:   c.pseudonymizeAddr(client),
+		Message:  msg,
+	})
+}
+
+// Close closes the capture.
+func (c *Capture) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if closer, ok := c.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// sanitize rebuilds a STUN message with the USERNAME replaced with a pseudonym and the
+// MESSAGE-INTEGRITY attributes zeroed out. The FINGERPRINT is recomputed, if present.
+func (c *Capture) sanitize(p []byte) ([]byte, error) {
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil {
+		return nil, err
+	}
+
+	s := &stun.Message{Type: m.Type, TransactionID: m.TransactionID}
+	s.WriteHeader()
+	fingerprint := false
+	for _, a := range m.Attributes {
+		switch a.Type {
+		case stun.AttrUsername:
+			s.Add(a.Type, []byte(c.pseudonymizeUser(string(a.Value))))
+		case stun.AttrMessageIntegrity, stun.AttrMessageIntegritySHA256:
+			s.Add(a.Type, make([]byte, len(a.Value)))
+		case stun.AttrFingerprint:
+			fingerprint = true
+		default:
+			s.Add(a.Type, a.Value)
+		}
+	}
+	if fingerprint {
+		if err := stun.Fingerprint.AddTo(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.Raw, nil
+}
+
+// pseudonymizeAddr maps client IPs to addresses from 10.0.0.0/8 in the order of appearance,
+// keeping the port.
+func (c *Capture) pseudonymizeAddr(addr net.Addr) string {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return ""
+	}
+
+	ip := ap.Addr().Unmap().String()
+	pseudo, ok := c.clients[ip]
+	if !ok {
+		n := len(c.clients) + 1
+		pseudo = fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff)
+		c.clients[ip] = pseudo
+	}
+
+	return fmt.Sprintf("%s:%d", pseudo, ap.Port())
+}
+
+func (c *Capture) pseudonymizeUser(user string) string {
+	pseudo, ok := c.users[user]
+	if !ok {
+		pseudo = fmt.Sprintf("user-%d", len(c.users)+1)
+		c.users[user] = pseudo
+	}
+	return pseudo
+}
+
+// ReadCapture reads the records of a trace.
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	records := []CaptureRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("invalid capture record %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// SetCapture sets the capture for recording the STUN messages received at the UDP listeners,
+// closing the previous capture, if any. Only listeners started after the capture has been set
+// are captured. A nil capture disables capturing.
+func (s *Stunner) SetCapture(c *Capture) {
+	old := s.capture.Swap(c)
+	if old != nil {
+		if err := old.Close(); err != nil {
+			s.log.Warnf("Could not close capture: %s", err.Error())
+		}
+	}
+}
+
+// capturePacketConn is a listener net.PacketConn that records the inbound STUN messages.
+type capturePacketConn struct {
+	net.PacketConn
+	listener string
+	capture  *atomic.Pointer[Capture]
+}
+
+func newCapturePacketConn(c net.PacketConn, listener string, capture *atomic.Pointer[Capture]) net.PacketConn {
+	return &capturePacketConn{PacketConn: c, listener: listener, capture: capture}
+}
+
+func (c *capturePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil && stun.IsMessage(p[:n]) {
+		if capture := c.capture.Load(); capture != nil {
+			capture.Record(c.listener, addr, p[:n]) //nolint:errcheck
+		}
+	}
+	return n, addr, err
+}
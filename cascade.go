@@ -0,0 +1,284 @@
+package stunner
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/v3"
+	"github.com/pion/turn/v4"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// cascadeRetryInterval is the time to wait before retrying a failed upstream allocation.
+const cascadeRetryInterval = 5 * time.Second
+
+// cascading returns true if a listener routes to a TURN cluster.
+func (s *Stunner) cascading(l *object.Listener) bool {
+	for _, r := range l.Routes {
+		if c := s.GetCluster(r); c != nil && c.Type == stnrv1.ClusterTypeTURN {
+			return true
+		}
+	}
+	return false
+}
+
+type cascadePacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// cascadeUpstream is an allocation at the upstream TURN server of a cluster.
+type cascadeUpstream struct {
+	conn   net.PacketConn // the socket toward the upstream TURN server
+	client *turn.Client
+	relay  net.PacketConn // nil while the allocation is in progress
+	retry  time.Time      // set if the allocation failed
+}
+
+func (u *cascadeUpstream) close() {
+	if u.relay != nil {
+		u.relay.Close() //nolint:errcheck
+	}
+	if u.client != nil {
+		u.client.Close()
+	}
+	if u.conn != nil {
+		u.conn.Close() //nolint:errcheck
+	}
+}
+
+// CascadePacketConn is a relay net.PacketConn that relays the packets sent to the peers of TURN
+// clusters through an allocation at the upstream TURN server of the cluster, and the packets to
+// all other peers via the local relay socket. Upstream allocations are created on demand, on the
+// first packet sent to a peer of the cluster, and live as long as the relay connection. Packets
+// sent while the upstream allocation is in progress are dropped. The packets received from the
+// local relay socket and the upstream allocations are merged.
+type CascadePacketConn struct {
+	net.PacketConn
+	checker      PortRangeChecker
+	net          transport.Net
+	upstreams    map[string]*cascadeUpstream // keyed by cluster name
+	in           chan cascadePacket
+	done         chan struct{}
+	closeOnce    sync.Once
+	readErr      error
+	readDeadline time.Time
+	lock         sync.Mutex
+	telemetry    *telemetry.Telemetry
+	logger       logging.LoggerFactory
+	log          logging.LeveledLogger
+}
+
+// NewCascadePacketConn decorates a relay PacketConn with cascading into the upstream TURN servers
+// of TURN clusters.
+func NewCascadePacketConn(c net.PacketConn, checker PortRangeChecker, vnet transport.Net, t *telemetry.Telemetry, logger logging.LoggerFactory, log logging.LeveledLogger) net.PacketConn {
+	conn := &CascadePacketConn{
+		PacketConn: c,
+		checker:    checker,
+		net:        vnet,
+		upstreams:  map[string]*cascadeUpstream{},
+		in:         make(chan cascadePacket, 64),
+		done:       make(chan struct{}),
+		telemetry:  t,
+		logger:     logger,
+		log:        log,
+	}
+
+	go conn.readLoop(c, true)
+
+	return conn
+}
+
+// readLoop reads packets from a socket into the input queue. An error on the local relay socket
+// is returned to the reader, errors on upstream allocations just stop the loop.
+func (c *CascadePacketConn) readLoop(conn net.PacketConn, local bool) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if local {
+				c.lock.Lock()
+				c.readErr = err
+				c.lock.Unlock()
+				c.close()
+			}
+			return
+		}
+
+		pkt := cascadePacket{data: make([]byte, n), addr: addr}
+		copy(pkt.data, buf[:n])
+		select {
+		case c.in <- pkt:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ReadFrom reads a packet from either the local relay socket or an upstream allocation.
+func (c *CascadePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.lock.Lock()
+	deadline := c.readDeadline
+	c.lock.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case pkt := <-c.in:
+		return copy(p, pkt.data), pkt.addr, nil
+	case <-c.done:
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if c.readErr != nil {
+			return 0, nil, c.readErr
+		}
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// WriteTo sends a packet to a peer, via the upstream TURN server if the peer belongs to a TURN
+// cluster.
+func (c *CascadePacketConn) WriteTo(p []byte, peerAddr net.Addr) (int, error) {
+	cluster, ok := c.checker(peerAddr)
+	if !ok || cluster.Type != stnrv1.ClusterTypeTURN {
+		return c.PacketConn.WriteTo(p, peerAddr)
+	}
+
+	relay, err := c.upstream(cluster)
+	if err != nil {
+		return 0, err
+	}
+	if relay == nil {
+		// the upstream allocation is in progress: drop the packet as if it was lost
+		return len(p), nil
+	}
+
+	return relay.WriteTo(p, peerAddr)
+}
+
+// upstream returns the upstream allocation for a cluster, starting a new allocation if there is
+// none. Returns nil if the allocation is in progress or it has recently failed.
+func (c *CascadePacketConn) upstream(cluster *object.Cluster) (net.PacketConn, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	if u, ok := c.upstreams[cluster.Name]; ok {
+		if u.relay != nil || u.retry.IsZero() || time.Now().Before(u.retry) {
+			return u.relay, nil
+		}
+	}
+
+	conf := cluster.Upstream()
+	if conf == nil {
+		return nil, fmt.Errorf("no upstream TURN server for cluster %q", cluster.Name)
+	}
+
+	c.upstreams[cluster.Name] = &cascadeUpstream{}
+	go c.allocate(cluster.Name, *conf)
+
+	return nil, nil
+}
+
+// allocate creates an allocation at the upstream TURN server of a cluster.
+func (c *CascadePacketConn) allocate(name string, conf stnrv1.ClusterUpstream) {
+	u := &cascadeUpstream{}
+	err := func() error {
+		var err error
+		network, address := "udp4", "0.0.0.0:0"
+		if host, _, _ := net.SplitHostPort(conf.Address); net.ParseIP(host).To4() == nil &&
+			net.ParseIP(host) != nil {
+			network, address = "udp6", "[::]:0"
+		}
+		if u.conn, err = c.net.ListenPacket(network, address); err != nil {
+			return err
+		}
+		if u.client, err = turn.NewClient(&turn.ClientConfig{
+			STUNServerAddr: conf.Address,
+			TURNServerAddr: conf.Address,
+			Conn:           u.conn,
+			Username:       conf.Username,
+			Password:       conf.Password,
+			Net:            c.net,
+			LoggerFactory:  c.logger,
+		}); err != nil {
+			return err
+		}
+		if err = u.client.Listen(); err != nil {
+			return err
+		}
+		u.relay, err = u.client.Allocate()
+		return err
+	}()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	closed := false
+	select {
+	case <-c.done:
+		closed = true
+	default:
+	}
+
+	if err != nil || closed {
+		u.close()
+		if closed {
+			return
+		}
+		c.log.Warnf("could not create allocation at upstream TURN server %s of cluster %q: %s",
+			conf.Address, name, err.Error())
+		c.telemetry.IncrementUpstreamAllocations(name, "failure")
+		c.upstreams[name] = &cascadeUpstream{retry: time.Now().Add(cascadeRetryInterval)}
+		return
+	}
+
+	c.log.Debugf("created allocation %s at upstream TURN server %s of cluster %q",
+		u.relay.LocalAddr().String(), conf.Address, name)
+	c.telemetry.IncrementUpstreamAllocations(name, "success")
+	c.upstreams[name] = u
+	go c.readLoop(u.relay, false)
+}
+
+func (c *CascadePacketConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *CascadePacketConn) close() {
+	c.closeOnce.Do(func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		close(c.done)
+		for _, u := range c.upstreams {
+			u.close()
+		}
+	})
+}
+
+// Close closes the upstream allocations and the local relay socket.
+func (c *CascadePacketConn) Close() error {
+	c.close()
+	return c.PacketConn.Close()
+}
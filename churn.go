@@ -0,0 +1,156 @@
+package stunner
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/util"
+)
+
+// ChurnWindow is the time window over which the allocations of a client are counted for churn
+// detection.
+var ChurnWindow = time.Minute
+
+// ChurnTrackerSize is the maximum number of clients tracked for allocation churn. Clients above
+// this limit are not checked for churn.
+var ChurnTrackerSize = 1 << 16
+
+// Churn actions reported in the metrics.
+const (
+	churnDetected = "detected"
+	churnLimited  = "limited"
+)
+
+// ChurnHandler is called when a client is detected for allocation churn at a listener, i.e., when
+// a client that has already created as many allocations within the churn window as the churn
+// threshold of the listener attempts to create a new one. The handler is called once per churn
+// episode, synchronously from the TURN server, so it must not block.
+type ChurnHandler = func(listener string, client net.IP)
+
+type churnClient struct {
+	created []time.Time // creation times of the recent allocations, at most threshold
+	flagged bool
+}
+
+// churnTracker keeps track of the allocations created by the clients of the listeners over the
+// churn window, keyed by listener name and client IP address.
+type churnTracker struct {
+	clients   map[string]*churnClient
+	lastPurge time.Time
+	lock      sync.Mutex
+	now       func() time.Time
+}
+
+func newChurnTracker() *churnTracker {
+	return &churnTracker{clients: map[string]*churnClient{}, lastPurge: time.Now(), now: time.Now}
+}
+
+func churnKey(listener string, addr net.Addr) string {
+	return listener + "/" + util.GetIP(addr).String()
+}
+
+// expire drops the allocations that fell out of the churn window.
+func (c *churnClient) expire(now time.Time) {
+	i := 0
+	for i < len(c.created) && now.Sub(c.created[i]) > ChurnWindow {
+		i++
+	}
+	c.created = c.created[i:]
+}
+
+// record records an allocation created by a client.
+func (t *churnTracker) record(key string, threshold int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	if now.Sub(t.lastPurge) > ChurnWindow {
+		for k, c := range t.clients {
+			if c.expire(now); len(c.created) == 0 {
+				delete(t.clients, k)
+			}
+		}
+		t.lastPurge = now
+	}
+
+	c, ok := t.clients[key]
+	if !ok {
+		if len(t.clients) >= ChurnTrackerSize {
+			return
+		}
+		c = &churnClient{}
+		t.clients[key] = c
+	}
+
+	c.expire(now)
+	c.created = append(c.created, now)
+	if len(c.created) > threshold {
+		c.created = c.created[len(c.created)-threshold:]
+	}
+}
+
+// check returns whether a client has reached the threshold within the window and whether this
+// starts a new churn episode.
+func (t *churnTracker) check(key string, threshold int) (bool, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	c, ok := t.clients[key]
+	if !ok {
+		return false, false
+	}
+
+	c.expire(t.now())
+	if len(c.created) < threshold {
+		c.flagged = false
+		return false, false
+	}
+
+	alarm := !c.flagged
+	c.flagged = true
+	return true, alarm
+}
+
+// SetChurnHandler sets the handler called when a client is detected for allocation churn. A nil
+// handler removes the handler.
+func (s *Stunner) SetChurnHandler(h ChurnHandler) {
+	if h == nil {
+		s.churnHook.Store(nil)
+		return
+	}
+	s.churnHook.Store(&h)
+}
+
+// checkChurn reports a client attempting to create an allocation above the churn threshold of a
+// listener, and returns false if the allocation is to be refused.
+func (s *Stunner) checkChurn(l *object.Listener, src net.Addr) bool {
+	if l.ChurnThreshold <= 0 {
+		return true
+	}
+
+	exceeded, alarm := s.churn.check(churnKey(l.Name, src), l.ChurnThreshold)
+	if alarm {
+		s.log.Warnf("Allocation churn detected on listener %q: client %s attempts to create "+
+			"more than %d allocations in %s", l.Name, src.String(), l.ChurnThreshold,
+			ChurnWindow)
+		s.telemetry.IncrementChurn(l.Name, churnDetected)
+		if h := s.churnHook.Load(); h != nil {
+			(*h)(l.Name, util.GetIP(src))
+		}
+	}
+
+	if !exceeded || !l.ChurnRateLimit {
+		return true
+	}
+	s.telemetry.IncrementChurn(l.Name, churnLimited)
+	return false
+}
+
+// recordChurn counts an allocation created by a client at a listener.
+func (s *Stunner) recordChurn(l *object.Listener, src net.Addr) {
+	if l.ChurnThreshold > 0 {
+		s.churn.record(churnKey(l.Name, src), l.ChurnThreshold)
+	}
+}
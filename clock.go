@@ -0,0 +1,17 @@
+package stunner
+
+import (
+	"time"
+
+	"github.com/l7mp/stunner/internal/util"
+)
+
+// Clock is the source of time and timers used for tracking allocation lifetimes, nonce expiry
+// and DNS refresh, see Options.Clock.
+type Clock = util.Clock
+
+// FakeClock is a Clock for testing: time stands still until it is moved forward with Advance.
+type FakeClock = util.FakeClock
+
+// NewFakeClock creates a FakeClock set to the given time.
+func NewFakeClock(t time.Time) *FakeClock { return util.NewFakeClock(t) }
@@ -9,7 +9,7 @@ import (
 
 	"github.com/spf13/cobra"
 
-	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 )
 
 func runAuth(_ *cobra.Command, args []string) error {
@@ -17,7 +17,7 @@ func runAuth(_ *cobra.Command, args []string) error {
 	defer cancel()
 
 	log.Debug("Searching for authentication server")
-	pod, err := cdsclient.DiscoverK8sAuthServer(ctx, k8sConfigFlags, authConfigFlags,
+	pod, err := k8sclient.DiscoverK8sAuthServer(ctx, k8sConfigFlags, authConfigFlags,
 		loggerFactory.NewLogger("auth-fwd"))
 	if err != nil {
 		return fmt.Errorf("error searching for auth service: %w", err)
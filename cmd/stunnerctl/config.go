@@ -13,6 +13,8 @@ import (
 
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	"github.com/l7mp/stunner/pkg/config/client/jsonpath"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 )
 
 func runConfig(_ *cobra.Command, args []string) error {
@@ -21,7 +23,7 @@ func runConfig(_ *cobra.Command, args []string) error {
 		gwNs = *k8sConfigFlags.Namespace
 	}
 
-	jsonQuery := cdsclient.NewJSONPath()
+	jsonQuery := jsonpath.NewJSONPath()
 	if ok, err := jsonQuery.Parse(output); err != nil {
 		return err
 	} else if ok {
@@ -32,7 +34,7 @@ func runConfig(_ *cobra.Command, args []string) error {
 	defer cancel()
 
 	log.Debug("Searching for CDS server")
-	pod, err := cdsclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
+	pod, err := k8sclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
 		loggerFactory.NewLogger("cds-fwd"))
 	if err != nil {
 		return fmt.Errorf("error searching for CDS server: %w", err)
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	"github.com/l7mp/stunner/pkg/config/client/jsonpath"
+	"github.com/l7mp/stunner/pkg/config/convert"
+)
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	// default to YAML: the output is meant to be used as a STUNner config file
+	if !cmd.Flags().Changed("output") {
+		output = "yaml"
+	}
+
+	jsonQuery := jsonpath.NewJSONPath()
+	if ok, err := jsonQuery.Parse(output); err != nil {
+		return err
+	} else if ok {
+		output = "jsonpath"
+	}
+
+	var in io.Reader = os.Stdin
+	file := ""
+	if len(args) > 0 && args[0] != "-" {
+		file = args[0]
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("could not open input file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var c *stnrv1.StunnerConfig
+	var warnings []string
+	var err error
+	switch convertFrom {
+	case "coturn":
+		c, warnings, err = convert.FromCoturn(in)
+	case "stunner":
+		var buf []byte
+		if buf, err = io.ReadAll(in); err == nil {
+			c, err = cdsclient.ParseConfigFormat(buf, cdsclient.DetectConfigFormat(file, buf))
+		}
+	default:
+		return fmt.Errorf("unknown input format %q (supported formats: coturn, stunner)",
+			convertFrom)
+	}
+	if err != nil {
+		return fmt.Errorf("conversion failed: %w", err)
+	}
+
+	var manifests []convert.Manifest
+	switch convertTo {
+	case "stunner":
+	case "gateway-api":
+		namespace := "stunner"
+		if k8sConfigFlags.Namespace != nil && *k8sConfigFlags.Namespace != "" {
+			namespace = *k8sConfigFlags.Namespace
+		}
+		var ws []string
+		manifests, ws, err = convert.ToGatewayAPI(c, namespace)
+		if err != nil {
+			return fmt.Errorf("conversion failed: %w", err)
+		}
+		warnings = append(warnings, ws...)
+	default:
+		return fmt.Errorf("unknown output format %q (supported formats: stunner, gateway-api)",
+			convertTo)
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	// Kubernetes manifests are always rendered in YAML
+	if manifests != nil {
+		out, err := convert.MarshalManifests(manifests)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	switch output {
+	case "yaml":
+		if out, err := yaml.Marshal(c); err != nil {
+			return err
+		} else {
+			fmt.Print(string(out))
+		}
+	case "json":
+		if out, err := json.Marshal(c); err != nil {
+			return err
+		} else {
+			fmt.Println(string(out))
+		}
+	case "jsonpath":
+		res, err := jsonQuery.Evaluate(c)
+		if err != nil {
+			return err
+		}
+		fmt.Println(res)
+	case "summary":
+		fmt.Print(c.Summary())
+	default:
+		fmt.Println(c.String())
+	}
+
+	return nil
+}
@@ -9,10 +9,12 @@ import (
 	"sigs.k8s.io/yaml"
 
 	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	"github.com/l7mp/stunner/pkg/config/client/jsonpath"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 )
 
 func runLicense(_ *cobra.Command, args []string) error {
-	jsonQuery := cdsclient.NewJSONPath()
+	jsonQuery := jsonpath.NewJSONPath()
 	if ok, err := jsonQuery.Parse(output); err != nil {
 		return err
 	} else if ok {
@@ -23,7 +25,7 @@ func runLicense(_ *cobra.Command, args []string) error {
 	defer cancel()
 
 	log.Debug("Searching for CDS server")
-	pod, err := cdsclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
+	pod, err := k8sclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
 		loggerFactory.NewLogger("cds-fwd"))
 	if err != nil {
 		return fmt.Errorf("error searching for CDS server: %w", err)
@@ -11,7 +11,7 @@ import (
 
 	"github.com/l7mp/stunner/internal/icetester"
 	v1 "github.com/l7mp/stunner/pkg/apis/v1"
-	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 	"github.com/l7mp/stunner/pkg/logger"
 )
 
@@ -23,11 +23,12 @@ import (
 var (
 	output, username, loglevel                                     string
 	iceTesterImage, iceTesterOffloadEngine, configRelayAddressNode string
+	convertFrom, convertTo                                         string
 	watch, all, verbose, forceCleanup, allowNodePort               bool
 	k8sConfigFlags                                                 *cliopt.ConfigFlags
-	cdsConfigFlags                                                 *cdsclient.CDSConfigFlags
-	authConfigFlags                                                *cdsclient.AuthConfigFlags
-	podConfigFlags                                                 *cdsclient.PodConfigFlags
+	cdsConfigFlags                                                 *k8sclient.CDSConfigFlags
+	authConfigFlags                                                *k8sclient.AuthConfigFlags
+	podConfigFlags                                                 *k8sclient.PodConfigFlags
 	iceTesterTimeout                                               time.Duration
 	iceTesterPacketRate                                            int
 
@@ -114,6 +115,18 @@ var (
 			}
 		},
 	}
+	convertCmd = &cobra.Command{
+		Use:               "convert [file]",
+		Short:             "Convert between STUNner configs and other config formats",
+		Args:              cobra.RangeArgs(0, 1),
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runConvert(cmd, args); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
 )
 
 func init() {
@@ -127,7 +140,7 @@ func init() {
 	k8sConfigFlags.AddFlags(rootCmd.PersistentFlags())
 
 	// CDS server discovery flags: for the "config" and "license" commands
-	cdsConfigFlags = cdsclient.NewCDSConfigFlags()
+	cdsConfigFlags = k8sclient.NewCDSConfigFlags()
 	cdsConfigFlags.AddFlags(configCmd.Flags())
 	cdsConfigFlags.AddFlags(licenseCmd.Flags())
 
@@ -137,11 +150,11 @@ func init() {
 		"Perform relay address discovery (if available) with respect to the given node.")
 
 	// Pod discovery flags: only for "status" command
-	podConfigFlags = cdsclient.NewPodConfigFlags()
+	podConfigFlags = k8sclient.NewPodConfigFlags()
 	podConfigFlags.AddFlags(statusCmd.Flags())
 
 	// Auth discovery flags: only for "auth" command
-	authConfigFlags = cdsclient.NewAuthConfigFlags()
+	authConfigFlags = k8sclient.NewAuthConfigFlags()
 	authConfigFlags.AddFlags(authCmd.Flags())
 	authCmd.Flags().StringVarP(&username, "username", "u", "",
 		"User id for generating an ephemeral credential (Default is empty username)")
@@ -164,12 +177,19 @@ func init() {
 	iceTestCmd.Flags().BoolVar(&allowNodePort, "allow-nodeport", false,
 		"Allow connecting to STUNner via a NodePort (may require prior firewall configuration)")
 
+	// Convert: input format
+	convertCmd.Flags().StringVar(&convertFrom, "from", "coturn",
+		"Input config format (supported formats: coturn, stunner)")
+	convertCmd.Flags().StringVar(&convertTo, "to", "stunner",
+		"Output config format (supported formats: stunner, gateway-api)")
+
 	// Add commands
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(iceTestCmd)
 	rootCmd.AddCommand(licenseCmd)
+	rootCmd.AddCommand(convertCmd)
 }
 
 func main() {
@@ -11,11 +11,12 @@ import (
 	"sigs.k8s.io/yaml"
 
 	v1 "github.com/l7mp/stunner/pkg/apis/v1"
-	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	"github.com/l7mp/stunner/pkg/config/client/jsonpath"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 )
 
 func runStatus(_ *cobra.Command, args []string) error {
-	jsonQuery := cdsclient.NewJSONPath()
+	jsonQuery := jsonpath.NewJSONPath()
 	if ok, err := jsonQuery.Parse(output); err != nil {
 		return err
 	} else if ok {
@@ -46,7 +47,7 @@ func runStatus(_ *cobra.Command, args []string) error {
 	}
 
 	log.Debug("Searching for dataplane pods " + extraLog)
-	pods, err := cdsclient.DiscoverK8sStunnerdPods(ctx, k8sConfigFlags, podConfigFlags,
+	pods, err := k8sclient.DiscoverK8sStunnerdPods(ctx, k8sConfigFlags, podConfigFlags,
 		gwNs, gw, loggerFactory.NewLogger("stunnerd-fwd"))
 	if err != nil {
 		return fmt.Errorf("error searching for stunnerd pods: %w", err)
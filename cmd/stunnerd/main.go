@@ -2,11 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	// the container image has no zoneinfo database, needed for the timezones of clusters
+	_ "time/tzdata"
 
 	flag "github.com/spf13/pflag"
 	cliopt "k8s.io/cli-runtime/pkg/genericclioptions"
@@ -15,6 +26,10 @@ import (
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	"github.com/l7mp/stunner/pkg/buildinfo"
 	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
+	"github.com/l7mp/stunner/pkg/config/validate"
+	"github.com/l7mp/stunner/pkg/logger"
+	"sigs.k8s.io/yaml"
 )
 
 var (
@@ -26,25 +41,71 @@ var (
 func main() {
 	os.Args[0] = "stunnerd"
 	var config = flag.StringP("config", "c", "", "Config origin, either a valid address in the format IP:port, or HTTP URL to the CDS server, or literal \"k8s\" to discover the CDS server from Kubernetes, or a proper file name URI in the format file://<path-to-config-file> (overrides: STUNNER_CONFIG_ORIGIN)")
-	var level = flag.StringP("log", "l", "", "Log level (format: <scope>:<level>, overrides: PION_LOG_*, default: all:INFO)")
+	var level = flag.StringP("log", "l", "", "Log level (format: <scope>:<level>, alias: --log-level, overrides: PION_LOG_*, default: all:INFO)")
 	var id = flag.StringP("id", "i", "", "Id for identifying with the CDS server (format: <namespace>/<name>, overrides: STUNNER_NAMESPACE/STUNNER_NAME, default: <default/stunnerd-hostname>)")
 	var watch = flag.BoolP("watch", "w", false, "Watch config file for updates (default: false)")
 	var udpThreadNum = flag.IntP("udp-thread-num", "u", 0,
 		"Number of readloop threads (CPU cores) per UDP listener. Zero disables UDP multithreading (default: 0)")
+	var udpRcvBufMax = flag.Int("udp-rcvbuf-max", 0,
+		"Maximum size in bytes up to which the receive buffer of UDP listener sockets is grown when packet drops are detected. Zero disables receive buffer autotuning (default: 0)")
+	var fdWarn = flag.Int("fd-warn-threshold", 80,
+		"Percentage of the open file descriptor limit above which a warning is logged. Zero disables the warning (default: 80)")
+	var fdRefuse = flag.Int("fd-refuse-threshold", 0,
+		"Percentage of the open file descriptor limit above which new TCP/TLS connections and allocations are refused. Zero disables refusals (default: 0)")
+	var standby = flag.Bool("standby", false, "Start in standby mode: load the config but do not bind listeners until promoted via a POST request to the \"/promote\" path of the admin API endpoint (default: false)")
+	var tapMirror = flag.String("tap-mirror", "", "UDP address (host:port) to mirror the relayed packets of tapped sessions to, sessions can be selected via the \"/tap\" path of the admin API endpoint (default: disabled)")
+	var consulAddr = flag.String("consul-address", "", "Address of the Consul agent HTTP API for CONSUL clusters (default: $CONSUL_HTTP_ADDR or http://127.0.0.1:8500)")
+	var xdsAddr = flag.String("xds-address", "", "URL of the xDS management server for EDS clusters with an explicit scheme, e.g., https://xds-server:18000 for gRPC over TLS or http://xds-server:18000 for plaintext gRPC (default: disabled)")
+	var xdsCA = flag.String("xds-ca", "", "PEM file with the CA certificates to verify the xDS management server with (default: the system CA certificates)")
+	var xdsCert = flag.String("xds-cert", "", "PEM file with the client certificate to present to the xDS management server for mutual TLS, requires --xds-key (default: none)")
+	var xdsKey = flag.String("xds-key", "", "PEM file with the private key of the xDS client certificate (default: none)")
+	var hitlessUpgrade = flag.Bool("hitless-upgrade", true, "Track the sockets and the UDP allocations so that a SIGUSR2 signal can hand them over to a new stunnerd executable (default: true)")
+	var captureFile = flag.String("capture", "", "File to record the STUN messages received at the UDP listeners into, sanitized, for replaying as regression tests (default: disabled)")
+	var drain = flag.Bool("drain", false, "Drain the stunnerd instance at the drain endpoint and exit, intended for Kubernetes preStop hooks: the instance refuses new allocations and fails the readiness check, and the command returns when all allocations are gone or the drain timeout expires (default: false)")
+	var drainEndpoint = flag.String("drain-endpoint", fmt.Sprintf("http://127.0.0.1:%d", stnrv1.DefaultAdminAPIPort), "Admin API endpoint of the stunnerd instance to drain with --drain, the admin token is taken from the "+stnrv1.DefaultEnvVarAdminToken+" environment variable")
+	var drainTimeout = flag.Duration("drain-timeout", 0, "Maximum time to wait for the allocations to drain with --drain, should be shorter than the termination grace period of the pod. Zero waits until all allocations are gone (default: 0)")
 	var dryRun = flag.BoolP("dry-run", "d", false, "Suppress side-effects, intended for testing (default: false)")
 	var forceReadyDuringTermination = flag.Bool("force-ready-status", false, "Prevent the server from failing the liveness probe during graceful shutdown as a workaround for buggy kube-proxy implementations (default: false)")
 	var verbose = flag.BoolP("verbose", "v", false, "Verbose logging, identical to <-l all:DEBUG>")
 
+	// Config override flags
+	var setOverrides = flag.StringArray("set", []string{}, "Override a setting of the loaded config, can be repeated (format: <section>.<field>=<value> or <section>.<name>.<field>=<value> for listeners and clusters, e.g., clusters.media-plane.endpoints=[10.0.0.0/8])")
+	var listenerOverrides = flag.StringArray("listener", []string{}, "Override a setting of a listener in the loaded config, can be repeated (format: <listener-name>.<field>=<value>, e.g., default-listener.port=3479)")
+	authOverrides := map[string]*string{}
+	for _, f := range []string{"type", "realm", "username", "password", "secret"} {
+		authOverrides[f] = flag.String("auth."+f, "", fmt.Sprintf("Override the authentication %s in the loaded config", f))
+	}
+	var printConfig = flag.Bool("print-config", false, "Print the loaded config with the overrides applied and exit (default: false)")
+	var strictAPI = flag.Bool("strict-api", false, "Reject configs that use deprecated API fields or field values instead of logging a warning (default: false)")
+	var validateConfig = flag.Bool("validate", false, "Validate the loaded config with the overrides applied, print the warnings and the errors, and exit (default: false)")
+	flag.CommandLine.SetNormalizeFunc(func(_ *flag.FlagSet, name string) flag.NormalizedName {
+		if name == "log-level" {
+			name = "log"
+		}
+		return flag.NormalizedName(name)
+	})
+
 	// Kubernetes config flags
 	k8sConfigFlags := cliopt.NewConfigFlags(true)
 	k8sConfigFlags.AddFlags(flag.CommandLine)
 
 	// CDS server discovery flags
-	cdsConfigFlags := cdsclient.NewCDSConfigFlags()
+	cdsConfigFlags := k8sclient.NewCDSConfigFlags()
 	cdsConfigFlags.AddFlags(flag.CommandLine)
 
 	flag.Parse()
 
+	// drain mode talks to the running stunnerd instance and exits
+	if *drain {
+		msg, err := drainStunnerd(*drainEndpoint, os.Getenv(stnrv1.DefaultEnvVarAdminToken), *drainTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not drain stunnerd: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(msg)
+		os.Exit(0)
+	}
+
 	logLevel := stnrv1.DefaultLogLevel
 	if *verbose {
 		logLevel = "all:DEBUG"
@@ -54,6 +115,24 @@ func main() {
 		logLevel = *level
 	}
 
+	overrides := []string{}
+	overrides = append(overrides, *setOverrides...)
+	for _, o := range *listenerOverrides {
+		overrides = append(overrides, "listeners."+o)
+	}
+	for _, f := range []string{"type", "realm", "username", "password", "secret"} {
+		if flag.CommandLine.Changed("auth." + f) {
+			overrides = append(overrides, fmt.Sprintf("auth.%s=%s", f, *authOverrides[f]))
+		}
+	}
+
+	// the config is loaded only once for printing
+	if *printConfig || *validateConfig {
+		*watch = false
+	}
+
+	cdsclient.StrictDeprecation = *strictAPI
+
 	configOrigin := stnrv1.DefaultConfigDiscoveryAddress
 	if origin, ok := os.LookupEnv(stnrv1.DefaultEnvVarConfigOrigin); ok {
 		configOrigin = origin
@@ -75,24 +154,77 @@ func main() {
 		}
 	}
 
+	xdsTLS, err := xdsTLSConfig(*xdsCA, *xdsCert, *xdsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid xDS TLS config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	st := stunner.NewStunner(stunner.Options{
 		Name:                        *id,
 		LogLevel:                    logLevel,
 		DryRun:                      *dryRun,
 		NodeName:                    nodeName,
 		UDPListenerThreadNum:        *udpThreadNum,
+		UDPReceiveBufferMax:         *udpRcvBufMax,
+		FDWarnThreshold:             *fdWarn,
+		FDRefuseThreshold:           *fdRefuse,
+		Standby:                     *standby,
+		TapMirrorAddress:            *tapMirror,
+		CaptureFile:                 *captureFile,
+		HitlessUpgrade:              *hitlessUpgrade,
+		ConsulAddress:               *consulAddr,
+		XDSAddress:                  *xdsAddr,
+		XDSTLSConfig:                xdsTLS,
 		ForceReadyDuringTermination: *forceReadyDuringTermination,
 	})
 	defer st.Close()
 
+	// keep the printed config separate from the logs
+	if l, ok := st.GetLogger().(logger.LoggerFactory); ok && (*printConfig || *validateConfig) {
+		l.SetWriter(os.Stderr)
+	}
+
 	log := st.GetLogger().NewLogger("stunnerd")
 
 	buildInfo := buildinfo.BuildInfo{Version: version, CommitHash: commitHash, BuildDate: buildDate}
 	log.Infof("Starting stunnerd id %q, STUNner %s ", st.GetId(), buildInfo.String())
+	if caps, err := json.Marshal(st.Capabilities()); err == nil {
+		log.Infof("Capabilities: %s", string(caps))
+	}
+
+	// inherit the sockets and the allocations of the old process in a hitless upgrade
+	inheriting := false
+	if fd, ok := os.LookupEnv(stunner.UpgradeFDEnvVar); ok {
+		os.Unsetenv(stunner.UpgradeFDEnvVar) //nolint:errcheck
+		if err := inherit(st, fd); err != nil {
+			log.Errorf("Could not inherit state from the old process: %s", err.Error())
+		} else {
+			inheriting = true
+		}
+	}
 
 	conf := make(chan *stnrv1.StunnerConfig, 1)
 	defer close(conf)
 
+	// command line flags override the config
+	override := func(c *stnrv1.StunnerConfig) error {
+		if *verbose || *level != "" {
+			c.Admin.LogLevel = logLevel
+		}
+		// the bootstrap config has no listeners and clusters to override
+		if cdsclient.IsZeroConfig(c) {
+			return nil
+		}
+		errs := []error{}
+		for _, o := range overrides {
+			if err := cdsclient.ApplyOverride(c, o); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
 	var cancelConfigLoader context.CancelFunc
 	if flag.NArg() == 1 {
 		log.Infof("Starting %s with default configuration at TURN URI: %s",
@@ -111,7 +243,7 @@ func main() {
 
 		if configOrigin == "k8s" {
 			log.Info("Discovering configuration from Kubernetes")
-			cdsAddr, err := cdsclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
+			cdsAddr, err := k8sclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
 				st.GetLogger().NewLogger("cds-fwd"))
 			if err != nil {
 				log.Errorf("Error searching for CDS server: %s", err.Error())
@@ -141,7 +273,7 @@ func main() {
 
 		if configOrigin == "k8s" {
 			log.Info("Discovering configuration from Kubernetes")
-			cdsAddr, err := cdsclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
+			cdsAddr, err := k8sclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
 				st.GetLogger().NewLogger("cds-fwd"))
 			if err != nil {
 				log.Errorf("Error searching for CDS server: %s", err.Error())
@@ -160,13 +292,105 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *printConfig {
+		c := <-conf
+		if err := override(c); err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		c, err := stunner.EffectiveConfig(c)
+		if err != nil {
+			log.Errorf("Invalid config: %s", err.Error())
+			os.Exit(1)
+		}
+		out, err := yaml.Marshal(c)
+		if err != nil {
+			log.Errorf("Could not render config: %s", err.Error())
+			os.Exit(1)
+		}
+		fmt.Print(string(out))
+		os.Exit(0)
+	}
+
+	if *validateConfig {
+		c := <-conf
+		if err := override(c); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		for _, w := range validate.Warnings(c) {
+			fmt.Printf("warning: %s\n", w.String())
+		}
+		if _, err := stunner.EffectiveConfig(c); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("config valid")
+		os.Exit(0)
+	}
+
 	sigterm := make(chan os.Signal, 1)
 	defer close(sigterm)
 	signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
 
+	upgrade := make(chan os.Signal, 1)
+	defer close(upgrade)
+	if upgradeSignal != nil {
+		signal.Notify(upgrade, upgradeSignal)
+	}
+
 	exit := make(chan bool, 1)
 	defer close(exit)
 
+	shutdown := func() {
+		// wait until all allocations are drained
+		go func() {
+			if err := st.Shutdown(context.Background()); err == nil {
+				exit <- true
+			}
+		}()
+
+		if cancelConfigLoader != nil {
+			log.Info("Canceling config loader")
+			cancelConfigLoader()
+			cancelConfigLoader = nil
+		}
+	}
+
+	// config updates arriving within the reconcile debounce interval of the last reconciliation
+	// are coalesced and only the latest one is applied when the interval elapses
+	var pending *stnrv1.StunnerConfig
+	var debounce <-chan time.Time
+	var lastReconcile time.Time
+	coalesced := 0
+
+	reconcile := func(c *stnrv1.StunnerConfig) {
+		if err := override(c); err != nil {
+			log.Errorf("Could not apply config override: %s", err.Error())
+		}
+
+		log.Debug("Initiating reconciliation")
+		lastReconcile = time.Now()
+
+		if err := st.Reconcile(context.Background(), c); err != nil {
+			if e, ok := err.(stnrv1.ErrRestarted); ok {
+				log.Debugf("Reconciliation ready: %s", e.Error())
+			} else {
+				log.Errorf("Could not reconcile new configuration "+
+					"(running configuration unchanged): %s", err.Error())
+			}
+		}
+
+		if inheriting {
+			inheriting = false
+			if err := st.FinishInherit(); err != nil {
+				log.Errorf("Could not complete hitless upgrade: %s", err.Error())
+			}
+		}
+
+		log.Trace("Reconciliation ready")
+	}
+
 	for {
 		select {
 		case <-exit:
@@ -176,45 +400,139 @@ func main() {
 		case <-sigterm:
 			log.Infof("Commencing graceful shutdown with %d active connection(s)",
 				st.AllocationCount())
-			st.Shutdown()
+			shutdown()
 
-			if cancelConfigLoader != nil {
-				log.Info("Canceling config loader")
-				cancelConfigLoader()
-				cancelConfigLoader = nil
+		case <-upgrade:
+			exe, err := os.Executable()
+			if err != nil {
+				log.Errorf("Could not find stunnerd executable: %s", err.Error())
+				continue
 			}
 
-			go func() {
-				for {
-					// check if we can exit
-					if st.AllocationCount() == 0 {
-						exit <- true
-						return
-					}
-					time.Sleep(time.Second)
-				}
-			}()
+			log.Infof("Commencing hitless upgrade from executable %s", exe)
+			p, err := st.Upgrade(exe, os.Args[1:])
+			if err != nil {
+				log.Errorf("Hitless upgrade failed (keeping on serving): %s", err.Error())
+				continue
+			}
+
+			log.Infof("New process (pid %d) has taken over, draining %d active connection(s)",
+				p.Pid, st.AllocationCount())
+			shutdown()
 
 		case c := <-conf:
 			log.Infof("New configuration available: %q", c.String())
 
-			// command line loglevel overrides config
-			if *verbose || *level != "" {
-				c.Admin.LogLevel = logLevel
+			d := st.GetReconcileDebounce()
+			if wait := d - time.Since(lastReconcile); d > 0 && wait > 0 {
+				if pending != nil {
+					coalesced++
+				}
+				pending = c
+				if debounce == nil {
+					log.Debugf("Deferring reconciliation by %s", wait)
+					debounce = time.After(wait)
+				}
+				continue
 			}
 
-			log.Debug("Initiating reconciliation")
+			reconcile(c)
 
-			if err := st.Reconcile(c); err != nil {
-				if e, ok := err.(stnrv1.ErrRestarted); ok {
-					log.Debugf("Reconciliation ready: %s", e.Error())
-				} else {
-					log.Errorf("Could not reconcile new configuration "+
-						"(running configuration unchanged): %s", err.Error())
-				}
+		case <-debounce:
+			debounce = nil
+			if coalesced > 0 {
+				log.Infof("Coalesced %d configuration update(s)", coalesced)
+				coalesced = 0
 			}
+			reconcile(pending)
+			pending = nil
+		}
+	}
+}
+
+// drainStunnerd puts the stunnerd instance at the given admin API endpoint into draining mode and
+// waits until all allocations are drained or the timeout expires (zero means no timeout). Returns
+// the status message of the instance.
+func drainStunnerd(endpoint, token string, timeout time.Duration) (string, error) {
+	u := strings.TrimSuffix(endpoint, "/") + "/drain"
+	if timeout > 0 {
+		u += "?timeout=" + url.QueryEscape(timeout.String())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u, nil) //nolint:noctx
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	res := struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, res.Message)
+	}
+
+	return res.Message, nil
+}
+
+// xdsTLSConfig creates the TLS config for the connection to the xDS management server from the
+// CA certificate file and the client certificate and key files, if any. Returns nil if no file is
+// given.
+func xdsTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
 
-			log.Trace("Reconciliation ready")
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates found in %q", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
 		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// inherit receives the state of the old process over the unix socket at the given file
+// descriptor.
+func inherit(st *stunner.Stunner, fd string) error {
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("invalid file descriptor %q", fd)
+	}
+	f := os.NewFile(uintptr(n), "upgrade")
+	conn, err := net.FileConn(f)
+	f.Close() //nolint:errcheck
+	if err != nil {
+		return err
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		conn.Close() //nolint:errcheck
+		return fmt.Errorf("file descriptor %d is not a unix socket", n)
 	}
+	return st.Inherit(uc)
 }
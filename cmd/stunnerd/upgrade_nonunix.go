@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// upgradeSignal is nil: hitless upgrades are not supported on non-unix platforms.
+var upgradeSignal os.Signal
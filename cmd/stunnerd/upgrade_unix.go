@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignal triggers a hitless binary upgrade.
+var upgradeSignal os.Signal = syscall.SIGUSR2
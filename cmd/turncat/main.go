@@ -19,6 +19,7 @@ import (
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	"github.com/l7mp/stunner/pkg/buildinfo"
 	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 	"github.com/l7mp/stunner/pkg/logger"
 )
 
@@ -31,7 +32,7 @@ const usage = `turncat [options] <client-addr> <turn-server-addr> <peer-addr>
 
 var (
 	k8sConfigFlags  *cliopt.ConfigFlags
-	cdsConfigFlags  *cdsclient.CDSConfigFlags
+	cdsConfigFlags  *k8sclient.CDSConfigFlags
 	log             logging.LeveledLogger
 	defaultDuration time.Duration
 	loggerFactory   logger.LoggerFactory
@@ -55,7 +56,7 @@ func main() {
 	k8sConfigFlags.AddFlags(flag.CommandLine)
 
 	// CDS server discovery flags
-	cdsConfigFlags = cdsclient.NewCDSConfigFlags()
+	cdsConfigFlags = k8sclient.NewCDSConfigFlags()
 	cdsConfigFlags.AddFlags(flag.CommandLine)
 
 	var serverName string
@@ -172,7 +173,7 @@ func getStunnerConfFromK8s(def string) (*stnrv1.StunnerConfig, error) {
 	defer cancel()
 
 	log.Debug("Searching for CDS server")
-	cdsAddr, err := cdsclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
+	cdsAddr, err := k8sclient.DiscoverK8sCDSServer(ctx, k8sConfigFlags, cdsConfigFlags,
 		loggerFactory.NewLogger("cds-fwd"))
 	if err != nil {
 		return nil, fmt.Errorf("error searching for CDS server: %w", err)
@@ -240,10 +241,6 @@ func getStunnerConfFromCLI(def string) (*stnrv1.StunnerConfig, error) {
 		return nil, fmt.Errorf("invalid STUNner URI %q: %s", uri, err)
 	}
 
-	if u.Username == "" || u.Password == "" {
-		return nil, fmt.Errorf("username/password must be set: '%s'", uri)
-	}
-
 	conf.Listeners[0].PublicAddr = u.Address
 	conf.Listeners[0].PublicPort = u.Port
 
@@ -258,6 +255,10 @@ func getAuth(config *stnrv1.StunnerConfig) (stunner.AuthGen, error) {
 	}
 
 	switch atype {
+	case stnrv1.AuthTypeNone:
+		// anonymous: any username with an empty password
+		return func() (string, string, error) { return "anonymous", "", nil }, nil
+
 	case stnrv1.AuthTypeEphemeral:
 		s, found := auth.Credentials["secret"]
 		if !found {
@@ -0,0 +1,129 @@
+package stunner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// conditionTypes is the order in which the status conditions are reported.
+var conditionTypes = []stnrv1.ConditionType{
+	stnrv1.ConditionTypeReady,
+	stnrv1.ConditionTypeConfigAccepted,
+	stnrv1.ConditionTypeListenersProgrammed,
+}
+
+// conditionTracker maintains the status conditions, updating the transition time only when the
+// status of a condition changes.
+type conditionTracker struct {
+	conditions map[stnrv1.ConditionType]stnrv1.Condition
+	lock       sync.Mutex
+}
+
+func newConditionTracker() *conditionTracker {
+	now := time.Now().Truncate(time.Second)
+	conds := make(map[stnrv1.ConditionType]stnrv1.Condition, len(conditionTypes))
+	for _, t := range conditionTypes {
+		conds[t] = stnrv1.Condition{
+			Type:               t,
+			Status:             stnrv1.ConditionUnknown,
+			Reason:             stnrv1.ConditionReasonPending,
+			LastTransitionTime: now,
+		}
+	}
+	return &conditionTracker{conditions: conds}
+}
+
+func (t *conditionTracker) set(ctype stnrv1.ConditionType, status stnrv1.ConditionStatus, reason, message string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	c := t.conditions[ctype]
+	if c.Status != status {
+		c.LastTransitionTime = time.Now().Truncate(time.Second)
+	}
+	c.Type, c.Status, c.Reason, c.Message = ctype, status, reason, message
+	t.conditions[ctype] = c
+}
+
+func (t *conditionTracker) list() []stnrv1.Condition {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	conds := make([]stnrv1.Condition, len(conditionTypes))
+	for i, ctype := range conditionTypes {
+		conds[i] = t.conditions[ctype]
+	}
+	return conds
+}
+
+// setConfigAccepted updates the ConfigAccepted condition after a reconciliation.
+func (s *Stunner) setConfigAccepted(err error) {
+	switch {
+	case s.rollbackErr != nil && !s.suppressRollback:
+		s.conditions.set(stnrv1.ConditionTypeConfigAccepted, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonRolledBack, fmt.Sprintf("Rolled back to the previous "+
+				"configuration: %s", s.rollbackErr.Error()))
+	case s.rollbackErr != nil:
+		s.conditions.set(stnrv1.ConditionTypeConfigAccepted, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonReconcileFailed, s.rollbackErr.Error())
+	case err != nil && !isRestarted(err):
+		s.conditions.set(stnrv1.ConditionTypeConfigAccepted, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonInvalid, err.Error())
+	default:
+		s.conditions.set(stnrv1.ConditionTypeConfigAccepted, stnrv1.ConditionTrue,
+			stnrv1.ConditionReasonAccepted, "Configuration accepted")
+	}
+}
+
+// updateConditions recomputes the conditions that track the state of the dataplane.
+func (s *Stunner) updateConditions() {
+	switch {
+	case s.shutdown:
+		s.conditions.set(stnrv1.ConditionTypeReady, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonTerminating, "Shutting down")
+	case s.IsDraining():
+		s.conditions.set(stnrv1.ConditionTypeReady, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonDraining, "Draining allocations, new allocations are refused")
+	case s.IsStandby():
+		s.conditions.set(stnrv1.ConditionTypeReady, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonStandby, "Running in standby mode")
+	case !s.ready:
+		s.conditions.set(stnrv1.ConditionTypeReady, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonNotReconciled, "Waiting for a valid configuration")
+	default:
+		s.conditions.set(stnrv1.ConditionTypeReady, stnrv1.ConditionTrue,
+			stnrv1.ConditionReasonReady, "Ready to serve allocation requests")
+	}
+
+	ls := s.listenerManager.Keys()
+	pending := []string{}
+	for _, name := range ls {
+		if l := s.GetListener(name); l != nil && !l.IsRunning() {
+			pending = append(pending, name)
+		}
+	}
+	switch {
+	case s.dryRun:
+		s.conditions.set(stnrv1.ConditionTypeListenersProgrammed, stnrv1.ConditionUnknown,
+			stnrv1.ConditionReasonDryRun, "Listeners are not started in dry-run mode")
+	case len(ls) == 0:
+		s.conditions.set(stnrv1.ConditionTypeListenersProgrammed, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonNoConfiguration, "No listeners configured")
+	case len(pending) > 0:
+		s.conditions.set(stnrv1.ConditionTypeListenersProgrammed, stnrv1.ConditionFalse,
+			stnrv1.ConditionReasonNotProgrammed, fmt.Sprintf("Listener(s) not running: %s",
+				strings.Join(pending, ", ")))
+	default:
+		s.conditions.set(stnrv1.ConditionTypeListenersProgrammed, stnrv1.ConditionTrue,
+			stnrv1.ConditionReasonProgrammed, fmt.Sprintf("%d listener(s) running", len(ls)))
+	}
+}
+
+func isRestarted(err error) bool {
+	_, ok := err.(stnrv1.ErrRestarted)
+	return ok
+}
@@ -0,0 +1,162 @@
+package stunner
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+)
+
+// Reasons for rejecting a TCP connection at a listener.
+const (
+	connRejectedLimit       = "limit"
+	connRejectedAcceptQueue = "accept-queue"
+)
+
+// ConnLimiter counts the TCP and TLS connections of a listener. The limiter is shared by all the
+// sockets of a listener.
+type ConnLimiter struct {
+	count atomic.Int64
+}
+
+// NewConnLimiter creates a new TCP connection limiter.
+func NewConnLimiter() *ConnLimiter {
+	return &ConnLimiter{}
+}
+
+// acquire returns true if a new connection may be opened under the given limit (zero means no
+// limit).
+func (c *ConnLimiter) acquire(limit int) bool {
+	if c.count.Add(1) > int64(limit) && limit > 0 {
+		c.count.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (c *ConnLimiter) release() {
+	c.count.Add(-1)
+}
+
+// connLimitListener is a TCP net.Listener that caps the number of concurrent connections of a
+// listener and, optionally, accepts connections eagerly into a bounded accept queue, so that
+// connection floods (e.g., slowloris-style attacks) cannot exhaust the file descriptors of the
+// process. Connections exceeding the limit or overflowing the accept queue are closed right away.
+type connLimitListener struct {
+	net.Listener
+	name      string
+	max       int
+	limiter   *ConnLimiter
+	queue     chan net.Conn // nil if there is no accept queue
+	err       error         // the accept error, set before the queue is closed
+	wg        sync.WaitGroup
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewConnLimitListener decorates a TCP listener with a connection limit (zero means no limit)
+// and an accept queue of the given length (zero disables the accept queue). Rejected connections
+// are reported per listener name.
+func NewConnLimitListener(l net.Listener, name string, max, queueLength int, limiter *ConnLimiter, t *telemetry.Telemetry, log logging.LeveledLogger) net.Listener {
+	c := &connLimitListener{
+		Listener:  l,
+		name:      name,
+		max:       max,
+		limiter:   limiter,
+		telemetry: t,
+		log:       log,
+	}
+
+	if queueLength > 0 {
+		c.queue = make(chan net.Conn, queueLength)
+		c.wg.Add(1)
+		go c.run()
+	}
+
+	return c
+}
+
+// run accepts connections into the accept queue until the listener is closed.
+func (l *connLimitListener) run() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.accept()
+		if err != nil {
+			l.err = err
+			close(l.queue)
+			return
+		}
+
+		select {
+		case l.queue <- conn:
+		default:
+			l.telemetry.IncrementTCPRejected(l.name, connRejectedAcceptQueue)
+			l.log.Debugf("Closing connection from %s: accept queue full", conn.RemoteAddr())
+			conn.Close() //nolint:errcheck
+		}
+	}
+}
+
+// accept accepts the next connection under the connection limit.
+func (l *connLimitListener) accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if !l.limiter.acquire(l.max) {
+			l.telemetry.IncrementTCPRejected(l.name, connRejectedLimit)
+			l.log.Debugf("Closing connection from %s: connection limit %d reached",
+				conn.RemoteAddr(), l.max)
+			conn.Close() //nolint:errcheck
+			continue
+		}
+
+		return &connLimitConn{Conn: conn, limiter: l.limiter}, nil
+	}
+}
+
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	if l.queue == nil {
+		return l.accept()
+	}
+
+	conn, ok := <-l.queue
+	if !ok {
+		return nil, l.err
+	}
+	return conn, nil
+}
+
+// Close closes the listener and the connections waiting in the accept queue.
+func (l *connLimitListener) Close() error {
+	err := l.Listener.Close()
+	if l.queue != nil {
+		l.wg.Wait()
+		for conn := range l.queue {
+			conn.Close() //nolint:errcheck
+		}
+	}
+	return err
+}
+
+// connLimitConn is a TCP connection that releases its slot in the connection limit when closed.
+type connLimitConn struct {
+	net.Conn
+	limiter *ConnLimiter
+	once    sync.Once
+}
+
+// NetConn returns the underlying connection.
+func (c *connLimitConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *connLimitConn) Close() error {
+	c.once.Do(c.limiter.release)
+	return c.Conn.Close()
+}
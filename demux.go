@@ -0,0 +1,206 @@
+package stunner
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+)
+
+// DemuxSessionTimeout is the idle timeout after which a forwarding session for non-STUN traffic
+// is removed from a demultiplexing listener.
+var DemuxSessionTimeout = 2 * time.Minute
+
+// MaxDemuxSessions is the maximum number of forwarding sessions per demultiplexing listener
+// socket. Non-STUN packets from new clients are dropped while the limit is reached.
+var MaxDemuxSessions = 1024
+
+var errDemuxSessionLimit = errors.New("forwarding session limit reached")
+
+// isTURNPacket returns true if the packet is a STUN/TURN message or a TURN ChannelData message (see
+// RFC 7983).
+func isTURNPacket(p []byte) bool {
+	if stun.IsMessage(p) {
+		return true
+	}
+
+	// ChannelData: channel numbers are in the range 0x4000-0x4FFF and the length field must
+	// match the packet size, modulo the optional padding
+	if len(p) < 4 || p[0] < 0x40 || p[0] > 0x4f {
+		return false
+	}
+	l := int(binary.BigEndian.Uint16(p[2:4])) + 4
+	return len(p) >= l && len(p) <= l+3
+}
+
+// DemuxPacketConn is a net.PacketConn that demultiplexes STUN/TURN traffic from other UDP traffic
+// (e.g., QUIC or RTP) received on the same listener port. STUN/TURN packets are returned to the
+// caller (the TURN server), while all other packets are forwarded to a fixed UDP address. Each
+// client is assigned a separate upstream socket, and the responses received on the upstream socket
+// are sent back to the client from the listener port.
+type DemuxPacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	target    string
+	sessions  map[string]*demuxSession
+	lock      sync.Mutex
+	closed    bool
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+type demuxSession struct {
+	conn     net.Conn
+	client   net.Addr
+	lastSeen atomic.Int64
+}
+
+// NewDemuxPacketConn decorates a listener PacketConn with demultiplexing. Non-STUN traffic is
+// forwarded to the forward address of the listener.
+func NewDemuxPacketConn(c net.PacketConn, l *object.Listener, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &DemuxPacketConn{
+		PacketConn: c,
+		listener:   l,
+		target:     l.ForwardAddress,
+		sessions:   map[string]*demuxSession{},
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn. Non-STUN packets are forwarded and never returned to the
+// caller.
+func (c *DemuxPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		if isTURNPacket(p[:n]) {
+			return n, addr, nil
+		}
+
+		c.forward(p[:n], addr)
+	}
+}
+
+func (c *DemuxPacketConn) forward(p []byte, addr net.Addr) {
+	sess, err := c.getSession(addr)
+	if err != nil {
+		if errors.Is(err, errDemuxSessionLimit) {
+			c.telemetry.IncrementDemuxDrops(c.listener.Name)
+		}
+		c.log.Debugf("demux: dropping non-STUN packet from client %s: %s", addr.String(),
+			err.Error())
+		return
+	}
+
+	sess.lastSeen.Store(time.Now().UnixNano())
+	if _, err := sess.conn.Write(p); err != nil {
+		c.log.Debugf("demux: could not forward packet from client %s to %s: %s",
+			addr.String(), c.target, err.Error())
+		return
+	}
+	c.telemetry.IncrementForwarded(c.listener.Name, telemetry.Incoming)
+}
+
+func (c *DemuxPacketConn) getSession(addr net.Addr) (*demuxSession, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+
+	if sess, ok := c.sessions[addr.String()]; ok {
+		return sess, nil
+	}
+
+	if len(c.sessions) >= MaxDemuxSessions {
+		return nil, errDemuxSessionLimit
+	}
+
+	conn, err := c.listener.Net.Dial("udp", c.target)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &demuxSession{conn: conn, client: addr}
+	sess.lastSeen.Store(time.Now().UnixNano())
+	c.sessions[addr.String()] = sess
+
+	c.log.Debugf("demux: new forwarding session: client %s <-> %s via %s", addr.String(),
+		c.target, conn.LocalAddr().String())
+
+	go c.upstreamLoop(sess)
+
+	return sess, nil
+}
+
+func (c *DemuxPacketConn) upstreamLoop(sess *demuxSession) {
+	defer c.deleteSession(sess)
+	// a panic closes the session, the next packet from the client opens a new one
+	defer func() {
+		if r := recover(); r != nil {
+			util.ReportPanic(c.log, c.telemetry, c.listener.Name, panicComponentDemux, r)
+		}
+	}()
+
+	buf := make([]byte, 65535)
+	for {
+		if err := sess.conn.SetReadDeadline(time.Now().Add(DemuxSessionTimeout)); err != nil {
+			return
+		}
+
+		n, err := sess.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) &&
+				time.Since(time.Unix(0, sess.lastSeen.Load())) < DemuxSessionTimeout {
+				continue
+			}
+			return
+		}
+
+		if _, err := c.PacketConn.WriteTo(buf[:n], sess.client); err != nil {
+			c.log.Debugf("demux: could not send packet to client %s: %s",
+				sess.client.String(), err.Error())
+			continue
+		}
+		c.telemetry.IncrementForwarded(c.listener.Name, telemetry.Outgoing)
+	}
+}
+
+func (c *DemuxPacketConn) deleteSession(sess *demuxSession) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if s, ok := c.sessions[sess.client.String()]; ok && s == sess {
+		delete(c.sessions, sess.client.String())
+	}
+	sess.conn.Close() //nolint:errcheck
+
+	c.log.Debugf("demux: forwarding session closed for client %s", sess.client.String())
+}
+
+// Close closes the PacketConn and all forwarding sessions.
+func (c *DemuxPacketConn) Close() error {
+	c.lock.Lock()
+	c.closed = true
+	for _, sess := range c.sessions {
+		sess.conn.Close() //nolint:errcheck
+	}
+	c.lock.Unlock()
+
+	return c.PacketConn.Close()
+}
@@ -0,0 +1,74 @@
+package stunner
+
+import (
+	"context"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// Drain puts STUNner into draining mode, intended for Kubernetes preStop hooks: new allocations
+// are refused and the readiness check fails so that the pod is removed from the load-balancer,
+// while the existing allocations keep on being served. Drain blocks until all allocations are
+// gone or until the context is canceled or its deadline expires, in which case the context error
+// is returned. STUNner stays in draining mode (the Draining state) until CancelDrain is called.
+// Returns ErrInvalidState if STUNner is already closed.
+func (s *Stunner) Drain(ctx context.Context) error {
+	if err := s.checkState("drain"); err != nil {
+		return err
+	}
+	s.setState(StateDraining)
+	if !s.draining.Swap(true) {
+		s.log.Infof("Draining %d active allocation(s)", s.AllocationCount())
+	}
+	return s.waitForAllocations(ctx)
+}
+
+// CancelDrain makes STUNner leave draining mode and accept new allocations again.
+func (s *Stunner) CancelDrain() {
+	if s.draining.Swap(false) {
+		s.log.Info("Drain canceled")
+	}
+	if s.shutdown {
+		return
+	}
+	st := StateNew
+	if s.ready {
+		st = StateRunning
+	}
+	s.state.CompareAndSwap(int32(StateDraining), int32(st))
+}
+
+// IsDraining returns true if STUNner is in draining mode.
+func (s *Stunner) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// waitForAllocations blocks until all allocations are gone or the context is done.
+func (s *Stunner) waitForAllocations(ctx context.Context) error {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for s.AllocationCount() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// NewDrainHandler creates a helper function for entering (drain=true) or leaving (drain=false)
+// draining mode.
+func (s *Stunner) NewDrainHandler() object.DrainHandler {
+	return func(ctx context.Context, drain bool) int {
+		if !drain {
+			s.CancelDrain()
+			return s.AllocationCount()
+		}
+		s.Drain(ctx) //nolint:errcheck
+		return s.AllocationCount()
+	}
+}
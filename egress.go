@@ -0,0 +1,120 @@
+package stunner
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// egressPacket is a packet waiting in the egress queue of a relay connection.
+type egressPacket struct {
+	buf  []byte
+	addr net.Addr
+}
+
+// EgressQueuePacketConn is a relay net.PacketConn that decouples the TURN server from the
+// peer-facing socket: packets written to the connection are placed in a bounded per-allocation
+// egress queue and sent to the peers from a separate goroutine, so that a full socket send buffer
+// never blocks the TURN server. When the queue is full, either the packet being written (tail
+// drop) or the oldest packet in the queue (head drop) is dropped and counted.
+type EgressQueuePacketConn struct {
+	net.PacketConn
+	name      string
+	headDrop  bool
+	queue     chan egressPacket
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewEgressQueuePacketConn decorates a relay PacketConn with an egress queue of the given length
+// and drop policy (either "tail" or "head"). Drops are reported per listener name.
+func NewEgressQueuePacketConn(c net.PacketConn, name string, length int, policy string, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	e := &EgressQueuePacketConn{
+		PacketConn: c,
+		name:       name,
+		headDrop:   policy == stnrv1.EgressDropPolicyHead,
+		queue:      make(chan egressPacket, length),
+		done:       make(chan struct{}),
+		telemetry:  t,
+		log:        log,
+	}
+
+	e.wg.Add(1)
+	go e.run()
+
+	return e
+}
+
+// WriteTo places a packet into the egress queue. The packet is copied, so the caller can reuse the
+// buffer. WriteTo never blocks: if the queue is full then a packet is dropped according to the
+// drop policy, which is not reported as an error (as if the packet was lost on the wire).
+func (c *EgressQueuePacketConn) WriteTo(p []byte, peerAddr net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	pkt := egressPacket{buf: make([]byte, len(p)), addr: peerAddr}
+	copy(pkt.buf, p)
+
+	for {
+		select {
+		case c.queue <- pkt:
+			return len(p), nil
+		default:
+		}
+
+		if !c.headDrop {
+			c.drop(stnrv1.EgressDropPolicyTail)
+			return len(p), nil
+		}
+
+		// head drop: make room for the new packet and retry
+		select {
+		case <-c.queue:
+			c.drop(stnrv1.EgressDropPolicyHead)
+		default:
+		}
+	}
+}
+
+func (c *EgressQueuePacketConn) drop(policy string) {
+	c.log.Tracef("Egress queue of relay connection %s full: dropping packet (policy: %s)",
+		c.PacketConn.LocalAddr(), policy)
+	c.telemetry.IncrementEgressDrops(c.name, policy)
+}
+
+// run sends the queued packets to the peers until the connection is closed.
+func (c *EgressQueuePacketConn) run() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.done:
+			return
+		case pkt := <-c.queue:
+			if _, err := c.PacketConn.WriteTo(pkt.buf, pkt.addr); err != nil {
+				c.log.Debugf("Could not send packet to peer %s: %s", pkt.addr, err.Error())
+			}
+		}
+	}
+}
+
+// Close closes the relay connection and drops the packets in the egress queue.
+func (c *EgressQueuePacketConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		// unblock the sender goroutine, if blocked in WriteTo
+		err = c.PacketConn.Close()
+		c.wg.Wait()
+	})
+	return err
+}
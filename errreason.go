@@ -0,0 +1,194 @@
+package stunner
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/pion/stun/v3"
+)
+
+// maxReasonPhraseSize is the maximum size of the reason phrase of an ERROR-CODE attribute (RFC
+// 8489, Section 14.8).
+const maxReasonPhraseSize = 763
+
+// ErrorReason is the data available in the custom reason phrase templates of the error responses.
+type ErrorReason struct {
+	// Code is the error code, e.g., 401.
+	Code int
+	// Reason is the original reason phrase set by the TURN server, or the standard reason
+	// phrase of the error code if the TURN server did not set any.
+	Reason string
+	// Method is the STUN method of the request, e.g., "Allocate".
+	Method string
+	// Listener is the name of the listener the error response is sent from.
+	Listener string
+}
+
+// errorReasonTemplates are the parsed custom reason phrase templates, keyed by error code.
+type errorReasonTemplates map[int]*template.Template
+
+// setErrorReasons parses and installs the custom reason phrase templates. The templates have
+// already been checked by the config validator.
+func (s *Stunner) setErrorReasons(reasons map[string]string) {
+	if len(reasons) == 0 {
+		s.errorReasons.Store(nil)
+		return
+	}
+
+	ts := errorReasonTemplates{}
+	for code, reason := range reasons {
+		c, err := strconv.Atoi(code)
+		if err != nil {
+			continue
+		}
+		t, err := template.New(code).Option("missingkey=error").Parse(reason)
+		if err != nil {
+			s.log.Warnf("Ignoring invalid custom error reason for error code %s: %s", code,
+				err.Error())
+			continue
+		}
+		ts[c] = t
+	}
+	s.errorReasons.Store(&ts)
+}
+
+// rewriteErrorReason replaces the reason phrase of the error responses for which a custom reason
+// phrase is configured.
+func (s *Stunner) rewriteErrorReason(p []byte, listener string) []byte {
+	if !stun.IsMessage(p) || stunClass(p) != 0x0110 {
+		return p
+	}
+
+	ts := s.errorReasons.Load()
+	if ts == nil {
+		return p
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil {
+		return p
+	}
+	var code stun.ErrorCodeAttribute
+	if err := code.GetFrom(m); err != nil {
+		return p
+	}
+	t, ok := (*ts)[int(code.Code)]
+	if !ok || m.Contains(stun.AttrMessageIntegrity) {
+		return p
+	}
+
+	original := string(code.Reason)
+	if original == "" {
+		original = standardReason(code.Code)
+	}
+
+	var reason strings.Builder
+	if err := t.Execute(&reason, ErrorReason{
+		Code:     int(code.Code),
+		Reason:   original,
+		Method:   m.Type.Method.String(),
+		Listener: listener,
+	}); err != nil {
+		s.log.Debugf("Could not render custom error reason for error code %d: %s", code.Code,
+			err.Error())
+		return p
+	}
+	phrase := reason.String()
+	if len(phrase) > maxReasonPhraseSize {
+		// do not cut a multi-byte character in half
+		phrase = phrase[:maxReasonPhraseSize]
+		for !utf8.ValidString(phrase) {
+			phrase = phrase[:len(phrase)-1]
+		}
+	}
+
+	// rebuild the response with the new ERROR-CODE, recomputing the FINGERPRINT if any
+	res := &stun.Message{Type: m.Type, TransactionID: m.TransactionID}
+	res.WriteHeader()
+	for _, a := range m.Attributes {
+		switch a.Type {
+		case stun.AttrErrorCode:
+			ec := stun.ErrorCodeAttribute{Code: code.Code, Reason: []byte(phrase)}
+			if err := ec.AddTo(res); err != nil {
+				return p
+			}
+		case stun.AttrFingerprint:
+		default:
+			res.Add(a.Type, a.Value)
+		}
+	}
+	if m.Contains(stun.AttrFingerprint) {
+		if err := stun.Fingerprint.AddTo(res); err != nil {
+			return p
+		}
+	}
+
+	return res.Raw
+}
+
+// standardReason returns the standard reason phrase of an error code, if known.
+func standardReason(code stun.ErrorCode) string {
+	m := new(stun.Message)
+	var ec stun.ErrorCodeAttribute
+	if code.AddTo(m) != nil || ec.GetFrom(m) != nil {
+		return ""
+	}
+	return string(ec.Reason)
+}
+
+// errorReasonPacketConn is a listener net.PacketConn that customizes the reason phrases of the
+// error responses.
+type errorReasonPacketConn struct {
+	net.PacketConn
+	listener string
+	stunner  *Stunner
+}
+
+func (s *Stunner) newErrorReasonPacketConn(c net.PacketConn, listener string) net.PacketConn {
+	return &errorReasonPacketConn{PacketConn: c, listener: listener, stunner: s}
+}
+
+// WriteTo writes to the PacketConn.
+func (c *errorReasonPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if _, err := c.PacketConn.WriteTo(c.stunner.rewriteErrorReason(p, c.listener), addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// errorReasonListener is a net.Listener that customizes the reason phrases of the error
+// responses sent over the connections of a TCP, TLS or DTLS listener. The TURN server writes each
+// response in a single call, so responses need not be reassembled from the byte stream.
+type errorReasonListener struct {
+	net.Listener
+	listener string
+	stunner  *Stunner
+}
+
+func (s *Stunner) newErrorReasonListener(l net.Listener, listener string) net.Listener {
+	return &errorReasonListener{Listener: l, listener: listener, stunner: s}
+}
+
+func (l *errorReasonListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	return &errorReasonConn{Conn: conn, listener: l.listener, stunner: l.stunner}, nil
+}
+
+type errorReasonConn struct {
+	net.Conn
+	listener string
+	stunner  *Stunner
+}
+
+func (c *errorReasonConn) Write(p []byte) (int, error) {
+	if _, err := c.Conn.Write(c.stunner.rewriteErrorReason(p, c.listener)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,204 @@
+package stunner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/manager"
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// ReconcileEventBufferSize is the number of reconcile events buffered per subscriber. Events
+// published while the buffer of a subscriber is full are dropped for that subscriber.
+var ReconcileEventBufferSize = 256
+
+// ReconcileOperation is the kind of change made to an object by a reconciliation.
+type ReconcileOperation string
+
+const (
+	ReconcileCreate ReconcileOperation = "create"
+	ReconcileUpdate ReconcileOperation = "update"
+	ReconcileDelete ReconcileOperation = "delete"
+)
+
+// ReconcileOutcome is the outcome of a change made by a reconciliation.
+type ReconcileOutcome string
+
+const (
+	// ReconcileApplied means the change was applied successfully.
+	ReconcileApplied ReconcileOutcome = "applied"
+	// ReconcileFailed means the reconciliation failed after the change was committed. Unless
+	// rollback is suppressed, the failed changes are followed by the changes made by the
+	// rollback to the last working configuration.
+	ReconcileFailed ReconcileOutcome = "failed"
+	// ReconcileRolledBack means the change was applied while rolling back to the last working
+	// configuration.
+	ReconcileRolledBack ReconcileOutcome = "rolled-back"
+)
+
+// ReconcileEvent describes a change made to an object by a reconciliation.
+type ReconcileEvent struct {
+	// Generation is the config generation of the reconciliation that made the change.
+	Generation int64
+	// Kind is the type of the object: "admin", "auth", "listener" or "cluster".
+	Kind string
+	// Name is the name of the object.
+	Name string
+	// Operation is the kind of the change.
+	Operation ReconcileOperation
+	// Outcome is the outcome of the change.
+	Outcome ReconcileOutcome
+	// RestartNeeded is true if the change required the object to be restarted.
+	RestartNeeded bool
+	// Error is the reason for the failure for failed changes, empty otherwise.
+	Error string
+}
+
+// String returns a string representation of the event.
+func (e ReconcileEvent) String() string {
+	s := fmt.Sprintf("%s %s %q (generation %d): %s", e.Operation, e.Kind, e.Name,
+		e.Generation, e.Outcome)
+	if e.RestartNeeded {
+		s += ", restarted"
+	}
+	if e.Error != "" {
+		s += fmt.Sprintf(": %s", e.Error)
+	}
+	return s
+}
+
+// reconcileEventBroker fans out the reconcile events to the subscribers.
+type reconcileEventBroker struct {
+	subs map[chan ReconcileEvent]struct{}
+	done chan struct{} // closed when STUNner is closed
+	lock sync.Mutex
+	log  logging.LeveledLogger
+}
+
+func newReconcileEventBroker(log logging.LeveledLogger) *reconcileEventBroker {
+	return &reconcileEventBroker{
+		subs: map[chan ReconcileEvent]struct{}{},
+		done: make(chan struct{}),
+		log:  log,
+	}
+}
+
+func (b *reconcileEventBroker) subscribe(ctx context.Context) <-chan ReconcileEvent {
+	ch := make(chan ReconcileEvent, ReconcileEventBufferSize)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	select {
+	case <-b.done:
+		close(ch)
+		return ch
+	default:
+	}
+	b.subs[ch] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-b.done:
+		}
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}()
+
+	return ch
+}
+
+// publish sends the events to all subscribers without blocking.
+func (b *reconcileEventBroker) publish(events []ReconcileEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subs {
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+				b.log.Warnf("Reconcile event subscriber too slow: dropping event %s", e.String())
+			}
+		}
+	}
+}
+
+// close closes the channels of all subscribers.
+func (b *reconcileEventBroker) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = map[chan ReconcileEvent]struct{}{}
+	close(b.done)
+}
+
+// SubscribeReconcileEvents returns a channel that receives an event for every change made by
+// Reconcile to the admin, auth, listener and cluster objects, in the order the changes were
+// made. Reconciliations that do not change any object, or that fail before the new
+// configuration is committed, emit no events. The channel is closed when the context is
+// canceled or STUNner is closed. Subscribers should drain the channel promptly: events are
+// dropped for subscribers whose buffer is full (see ReconcileEventBufferSize).
+func (s *Stunner) SubscribeReconcileEvents(ctx context.Context) <-chan ReconcileEvent {
+	return s.events.subscribe(ctx)
+}
+
+// reconcileEvents collects the events for the changes in a reconciliation state.
+func reconcileEvents(kind string, state *manager.ReconciliationState, restarted []object.Object) []ReconcileEvent {
+	needsRestart := func(o object.Object) bool {
+		for _, r := range restarted {
+			if r == o {
+				return true
+			}
+		}
+		return false
+	}
+
+	events := []ReconcileEvent{}
+	for _, j := range state.NewJobQueue {
+		events = append(events, ReconcileEvent{Generation: state.Generation, Kind: kind,
+			Name: j.NewConfig.ConfigName(), Operation: ReconcileCreate})
+	}
+	for _, j := range state.ChangedJobQueue {
+		events = append(events, ReconcileEvent{Generation: state.Generation, Kind: kind,
+			Name: j.Object.ObjectName(), Operation: ReconcileUpdate,
+			RestartNeeded: needsRestart(j.Object)})
+	}
+	// the deletion queue is in random order
+	deleted := []ReconcileEvent{}
+	for _, j := range state.DeletedJobQueue {
+		deleted = append(deleted, ReconcileEvent{Generation: state.Generation, Kind: kind,
+			Name: j.Object.ObjectName(), Operation: ReconcileDelete})
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].Name < deleted[j].Name })
+
+	return append(events, deleted...)
+}
+
+// publishReconcileEvents sets the outcome of the events and publishes them to the subscribers.
+func (s *Stunner) publishReconcileEvents(events []ReconcileEvent, inRollback bool, err error) {
+	if len(events) == 0 {
+		return
+	}
+	for i := range events {
+		switch {
+		case err != nil:
+			events[i].Outcome = ReconcileFailed
+			events[i].Error = err.Error()
+		case inRollback:
+			events[i].Outcome = ReconcileRolledBack
+		default:
+			events[i].Outcome = ReconcileApplied
+		}
+	}
+	s.events.publish(events)
+}
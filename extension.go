@@ -0,0 +1,179 @@
+package stunner
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// AdminExtensionPrefix is the path prefix on the admin API endpoint under which the HTTP handlers
+// registered with RegisterAdminHandler are mounted.
+const AdminExtensionPrefix = "/ext/"
+
+// HealthContributor is a custom readiness check registered by an embedder: STUNner is not ready
+// while the check returns an error. Checks are called on each readiness probe, so they should
+// return quickly.
+type HealthContributor = func() error
+
+// adminHandler is an HTTP handler in the admin registry. Probe handlers are served on both the
+// health-check endpoint and the admin API endpoint, the rest only on the admin API endpoint.
+type adminHandler struct {
+	http.Handler
+	probe bool
+}
+
+// adminExtensions is the registry of the HTTP handlers served on the health-check and the admin
+// API endpoints, keyed by mount path, plus the custom readiness checks. The built-in endpoints
+// and the handlers registered by the embedder are mounted the same way.
+type adminExtensions struct {
+	handlers map[string]adminHandler
+	health   map[string]HealthContributor
+	lock     sync.RWMutex
+}
+
+func newAdminExtensions() *adminExtensions {
+	return &adminExtensions{
+		handlers: map[string]adminHandler{},
+		health:   map[string]HealthContributor{},
+	}
+}
+
+// mount registers a handler that serves the subtree under the given path.
+func (e *adminExtensions) mount(path string, h http.Handler, probe bool) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, ok := e.handlers[path]; ok {
+		return fmt.Errorf("admin handler already registered at %s", path)
+	}
+	e.handlers[path] = adminHandler{Handler: h, probe: probe}
+	return nil
+}
+
+func (e *adminExtensions) unmount(path string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.handlers, path)
+}
+
+// lookup finds the handler with the longest mount path matching the path.
+func (e *adminExtensions) lookup(p string, probe bool) http.Handler {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for ; p != "/" && p != "."; p = path.Dir(p) {
+		if h, ok := e.handlers[p]; ok && (h.probe || !probe) {
+			return h
+		}
+	}
+	return nil
+}
+
+// probeMux returns the handler of the health-check endpoint, which serves the probe handlers.
+func (e *adminExtensions) probeMux() http.Handler { return &adminMux{e: e, probe: true} }
+
+// apiMux returns the handler of the admin API endpoint, which serves all the handlers.
+func (e *adminExtensions) apiMux() http.Handler { return &adminMux{e: e} }
+
+// adminMux dispatches the requests to the handlers in the registry.
+type adminMux struct {
+	e     *adminExtensions
+	probe bool
+}
+
+// ServeHTTP dispatches a request to the handler mounted at the path of the request.
+func (m *adminMux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h := m.e.lookup(path.Clean(req.URL.Path), m.probe); h != nil {
+		h.ServeHTTP(w, req)
+		return
+	}
+	if name, ok := strings.CutPrefix(req.URL.Path, AdminExtensionPrefix); ok && !m.probe {
+		name, _, _ = strings.Cut(name, "/")
+		writeStatus(w, http.StatusNotFound, fmt.Sprintf("no such extension: %q", name))
+		return
+	}
+	writeStatus(w, http.StatusNotFound, "not found")
+}
+
+func validateExtensionName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/?#") {
+		return fmt.Errorf("invalid extension name %q", name)
+	}
+	return nil
+}
+
+// RegisterAdminHandler mounts a custom HTTP handler on the admin API endpoint at the path
+// "/ext/<name>", e.g., to expose the runtime services of the embedder next to the STUNner admin
+// API. The handler serves the whole subtree and it sees the paths relative to its mount point,
+// i.e., a request to "/ext/<name>/foo" is passed to the handler with the path "/foo". Like the
+// rest of the admin API, the handler is served only to clients that present the admin token, and
+// it survives the restarts of the admin API server. Returns an error if the name is
+// invalid or a handler is already registered under the name.
+func (s *Stunner) RegisterAdminHandler(name string, h http.Handler) error {
+	if err := validateExtensionName(name); err != nil {
+		return err
+	}
+	if h == nil {
+		return fmt.Errorf("nil admin handler %q", name)
+	}
+
+	// the handler sees the paths relative to its mount point
+	prefix := AdminExtensionPrefix + name
+	if err := s.extensions.mount(prefix, http.StripPrefix(prefix, h), false); err != nil {
+		return fmt.Errorf("admin handler %q already registered", name)
+	}
+	s.log.Debugf("Admin handler %q registered at %s%s", name, AdminExtensionPrefix, name)
+
+	return nil
+}
+
+// UnregisterAdminHandler removes the custom HTTP handler registered under the given name, if any.
+func (s *Stunner) UnregisterAdminHandler(name string) {
+	s.extensions.unmount(AdminExtensionPrefix + name)
+}
+
+// RegisterHealthContributor adds a custom readiness check: the readiness probe fails, reporting
+// the name of the check and the error, while the check returns an error. Returns an error if the
+// name is invalid or a check is already registered under the name.
+func (s *Stunner) RegisterHealthContributor(name string, check HealthContributor) error {
+	if err := validateExtensionName(name); err != nil {
+		return err
+	}
+	if check == nil {
+		return fmt.Errorf("nil health contributor %q", name)
+	}
+
+	s.extensions.lock.Lock()
+	defer s.extensions.lock.Unlock()
+	if _, ok := s.extensions.health[name]; ok {
+		return fmt.Errorf("health contributor %q already registered", name)
+	}
+	s.extensions.health[name] = check
+
+	return nil
+}
+
+// UnregisterHealthContributor removes the custom readiness check registered under the given name,
+// if any.
+func (s *Stunner) UnregisterHealthContributor(name string) {
+	s.extensions.lock.Lock()
+	defer s.extensions.lock.Unlock()
+	delete(s.extensions.health, name)
+}
+
+// checkHealthContributors runs the custom readiness checks in alphabetical order and returns the
+// first error.
+func (s *Stunner) checkHealthContributors() error {
+	s.extensions.lock.RLock()
+	checks := maps.Clone(s.extensions.health)
+	s.extensions.lock.RUnlock()
+
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		if err := checks[name](); err != nil {
+			return fmt.Errorf("%s not ready: %w", name, err)
+		}
+	}
+	return nil
+}
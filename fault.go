@@ -0,0 +1,107 @@
+//go:build faultinject
+
+package stunner
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// fault injection is available in debug builds only
+const faultInjectionEnabled = true
+
+// faultInjector degrades the TURN service on purpose, in order to test the resilience of
+// applications against packet loss, delay and allocation failures. Faults are set up at runtime
+// via the "/faults" path of the admin API endpoint. Only available in debug builds, see the
+// "faultinject" build tag.
+type faultInjector struct {
+	drop      atomic.Int64 // percentage of the relayed packets to drop
+	delay     atomic.Int64 // delay of the relayed packets in nanoseconds
+	failEvery atomic.Int64 // fail every Nth allocation
+	allocs    atomic.Int64
+	log       logging.LeveledLogger
+}
+
+func newFaultInjector(log logging.LeveledLogger) *faultInjector {
+	log.Warn("Fault injection build: do not use in production")
+	return &faultInjector{log: log}
+}
+
+// set sets up the faults to inject. All zeros disable fault injection.
+func (f *faultInjector) set(drop int, delay time.Duration, failEvery int) error {
+	if drop < 0 || drop > 100 {
+		return fmt.Errorf("invalid drop percentage %d: must be between 0 and 100", drop)
+	}
+	if delay < 0 {
+		return fmt.Errorf("invalid delay %s", delay)
+	}
+	if failEvery < 0 {
+		return fmt.Errorf("invalid allocation failure period %d", failEvery)
+	}
+
+	f.drop.Store(int64(drop))
+	f.delay.Store(int64(delay))
+	f.failEvery.Store(int64(failEvery))
+	f.allocs.Store(0)
+
+	if drop == 0 && delay == 0 && failEvery == 0 {
+		f.log.Info("Fault injection disabled")
+	} else {
+		f.log.Warnf("Fault injection enabled: drop=%d%%, delay=%s, fail-allocate=%d",
+			drop, delay, failEvery)
+	}
+
+	return nil
+}
+
+// decorate adds fault injection to a relay connection.
+func (f *faultInjector) decorate(conn net.PacketConn) net.PacketConn {
+	return &faultPacketConn{PacketConn: conn, faults: f}
+}
+
+// failAllocation returns true if the next allocation should fail.
+func (f *faultInjector) failAllocation() bool {
+	n := f.failEvery.Load()
+	return n > 0 && f.allocs.Add(1)%n == 0
+}
+
+// inject returns false if the packet should be dropped, otherwise it delays the packet.
+func (f *faultInjector) inject() bool {
+	if drop := f.drop.Load(); drop > 0 && rand.Int64N(100) < drop {
+		return false
+	}
+	if delay := f.delay.Load(); delay > 0 {
+		time.Sleep(time.Duration(delay))
+	}
+	return true
+}
+
+// faultPacketConn is a relay net.PacketConn that drops and delays packets in both directions.
+type faultPacketConn struct {
+	net.PacketConn
+	faults *faultInjector
+}
+
+// WriteTo writes a packet to a peer, unless dropped. Dropped packets are not reported as an
+// error, as if the packet was lost on the wire.
+func (c *faultPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if !c.faults.inject() {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// ReadFrom reads a packet from a peer, skipping the dropped packets.
+func (c *faultPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || c.faults.inject() {
+			return n, addr, err
+		}
+	}
+}
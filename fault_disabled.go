@@ -0,0 +1,30 @@
+//go:build !faultinject
+
+package stunner
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// fault injection is available in debug builds only
+const faultInjectionEnabled = false
+
+var errFaultInjectionDisabled = errors.New("fault injection is not available: rebuild with " +
+	"the \"faultinject\" build tag")
+
+// faultInjector is a no-op in production builds, see the "faultinject" build tag.
+type faultInjector struct{}
+
+func newFaultInjector(_ logging.LeveledLogger) *faultInjector { return nil }
+
+func (f *faultInjector) set(_ int, _ time.Duration, _ int) error {
+	return errFaultInjectionDisabled
+}
+
+func (f *faultInjector) decorate(conn net.PacketConn) net.PacketConn { return conn }
+
+func (f *faultInjector) failAllocation() bool { return false }
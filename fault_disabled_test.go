@@ -0,0 +1,17 @@
+//go:build !faultinject
+
+package stunner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjectionDisabled(t *testing.T) {
+	f := newFaultInjector(nil)
+	assert.ErrorIs(t, f.set(10, 0, 0), errFaultInjectionDisabled, "not available")
+	conn := &echoPacketConn{}
+	assert.Equal(t, conn, f.decorate(conn), "no decorator")
+	assert.False(t, f.failAllocation(), "no allocation failures")
+}
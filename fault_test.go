@@ -0,0 +1,53 @@
+//go:build faultinject
+
+package stunner
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+func TestFaultInjection(t *testing.T) {
+	f := newFaultInjector(logger.NewLoggerFactory(connTestLoglevel).NewLogger("test"))
+
+	assert.Error(t, f.set(101, 0, 0), "invalid drop")
+	assert.Error(t, f.set(0, -time.Second, 0), "invalid delay")
+	assert.Error(t, f.set(0, 0, -1), "invalid fail period")
+
+	// every 3rd allocation fails
+	assert.NoError(t, f.set(0, 0, 3), "set")
+	fails := []bool{}
+	for i := 0; i < 6; i++ {
+		fails = append(fails, f.failAllocation())
+	}
+	assert.Equal(t, []bool{false, false, true, false, false, true}, fails, "allocation failures")
+
+	// all packets dropped
+	peer := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}
+	echo := &echoPacketConn{}
+	conn := f.decorate(echo)
+	assert.NoError(t, f.set(100, 0, 0), "set")
+	n, err := conn.WriteTo([]byte("ping"), peer)
+	assert.NoError(t, err, "dropped packets are not reported")
+	assert.Equal(t, 4, n, "write")
+	assert.Nil(t, echo.addr, "packet dropped")
+
+	// packets delayed
+	assert.NoError(t, f.set(0, 50*time.Millisecond, 0), "set")
+	start := time.Now()
+	_, err = conn.WriteTo([]byte("ping"), peer)
+	assert.NoError(t, err, "write")
+	assert.Equal(t, peer.String(), echo.addr.String(), "packet sent")
+	_, _, err = conn.ReadFrom(make([]byte, 10))
+	assert.NoError(t, err, "read")
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "delay in both directions")
+
+	// disable
+	assert.NoError(t, f.set(0, 0, 0), "disable")
+	assert.False(t, f.failAllocation(), "no allocation failures")
+}
@@ -0,0 +1,127 @@
+package stunner
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+)
+
+// FDCheckInterval is the period at which the file descriptor usage of the process is checked.
+var FDCheckInterval = 5 * time.Second
+
+// connRejectedFDExhausted is the reason for rejecting a TCP connection near file descriptor
+// exhaustion.
+const connRejectedFDExhausted = "fd-exhausted"
+
+// fdMonitor periodically checks the number of open file descriptors against the process limit
+// (RLIMIT_NOFILE), warns when the usage exceeds the warning threshold, and marks the process as
+// exhausted above the refuse threshold, so that new TCP connections and allocations can be
+// refused instead of failing unpredictably. Thresholds are given in percent of the limit, zero
+// disables the respective check.
+type fdMonitor struct {
+	warn, refuse int
+	usage        func() (int, int, error)
+	warned       bool
+	exhausted    atomic.Bool
+	log          logging.LeveledLogger
+}
+
+func newFDMonitor(warn, refuse int, log logging.LeveledLogger) *fdMonitor {
+	return &fdMonitor{warn: warn, refuse: refuse, usage: util.FDUsage, log: log}
+}
+
+// run checks the file descriptor usage until the context is canceled.
+func (m *fdMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(FDCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.check(); err != nil {
+			m.log.Warnf("Disabling file descriptor usage monitoring: %s", err.Error())
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *fdMonitor) check() error {
+	used, limit, err := m.usage()
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		return nil
+	}
+	percent := used * 100 / limit
+
+	if m.warn > 0 {
+		if percent >= m.warn && !m.warned {
+			m.log.Warnf("File descriptor usage above %d%%: %d open file descriptors "+
+				"(limit: %d)", m.warn, used, limit)
+		} else if percent < m.warn && m.warned {
+			m.log.Infof("File descriptor usage back below %d%%: %d open file descriptors "+
+				"(limit: %d)", m.warn, used, limit)
+		}
+		m.warned = percent >= m.warn
+	}
+
+	if m.refuse > 0 {
+		exhausted := percent >= m.refuse
+		if m.exhausted.Swap(exhausted) != exhausted {
+			if exhausted {
+				m.log.Errorf("File descriptor usage above %d%%: refusing new TCP "+
+					"connections and allocations (%d open file descriptors, limit: %d)",
+					m.refuse, used, limit)
+			} else {
+				m.log.Infof("File descriptor usage back below %d%%: accepting new TCP "+
+					"connections and allocations", m.refuse)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isExhausted returns true if new TCP connections and allocations should be refused.
+func (m *fdMonitor) isExhausted() bool {
+	return m != nil && m.exhausted.Load()
+}
+
+// fdGuardListener is a TCP net.Listener that closes new connections right after being accepted
+// while the file descriptors of the process are near exhaustion.
+type fdGuardListener struct {
+	net.Listener
+	name      string
+	monitor   *fdMonitor
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+func newFDGuardListener(l net.Listener, name string, m *fdMonitor, t *telemetry.Telemetry, log logging.LeveledLogger) net.Listener {
+	return &fdGuardListener{Listener: l, name: name, monitor: m, telemetry: t, log: log}
+}
+
+func (l *fdGuardListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil || !l.monitor.isExhausted() {
+			return conn, err
+		}
+
+		l.telemetry.IncrementTCPRejected(l.name, connRejectedFDExhausted)
+		l.log.Debugf("Closing connection from %s: file descriptors near exhaustion",
+			conn.RemoteAddr())
+		conn.Close() //nolint:errcheck
+	}
+}
@@ -0,0 +1,93 @@
+package stunner
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pion/logging"
+)
+
+// gcSettings are the garbage collector settings of the process, see the GCPercent,
+// GCMemoryLimit and GCBallast fields of the admin config.
+type gcSettings struct {
+	percent, memoryLimit, ballast int
+}
+
+// gcTuner applies the garbage collector settings to the process. The settings are global to the
+// process: when several STUNner instances run in the same process the last applied settings win.
+type gcTuner struct {
+	// the runtime defaults, restored when a setting is removed
+	defaultPercent     int
+	defaultMemoryLimit int64
+	current            gcSettings
+	applied            bool
+	ballast            []byte
+	lock               sync.Mutex
+	log                logging.LeveledLogger
+}
+
+func newGCTuner(log logging.LeveledLogger) *gcTuner {
+	return &gcTuner{log: log}
+}
+
+// apply applies the garbage collector settings, if changed.
+func (t *gcTuner) apply(settings gcSettings) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.applied {
+		if settings == (gcSettings{}) {
+			return
+		}
+		// SetGCPercent returns the previous setting, a negative input leaves the memory
+		// limit unchanged
+		t.defaultPercent = debug.SetGCPercent(100)
+		debug.SetGCPercent(t.defaultPercent)
+		t.defaultMemoryLimit = debug.SetMemoryLimit(-1)
+		t.applied = true
+	} else if settings == t.current {
+		return
+	}
+
+	percent, memoryLimit := t.defaultPercent, t.defaultMemoryLimit
+	if settings.percent != 0 {
+		percent = settings.percent
+	}
+	if settings.memoryLimit > 0 {
+		memoryLimit = int64(settings.memoryLimit) << 20
+	}
+	// set the memory limit first so that the GC is never disabled without a limit
+	debug.SetMemoryLimit(memoryLimit)
+	debug.SetGCPercent(percent)
+
+	if settings.ballast != t.current.ballast {
+		t.ballast = nil
+		if settings.ballast > 0 {
+			t.ballast = make([]byte, settings.ballast<<20)
+		}
+	}
+
+	t.current = settings
+	t.log.Infof("Garbage collector settings: gc-percent=%d, memory-limit=%s, ballast=%dMiB",
+		percent, memoryLimitString(memoryLimit), settings.ballast)
+}
+
+// reset restores the runtime defaults and releases the ballast.
+func (t *gcTuner) reset() {
+	t.lock.Lock()
+	applied := t.applied
+	t.lock.Unlock()
+
+	if applied {
+		t.apply(gcSettings{})
+	}
+}
+
+func memoryLimitString(limit int64) string {
+	if limit == math.MaxInt64 {
+		return "none"
+	}
+	return fmt.Sprintf("%dMiB", limit>>20)
+}
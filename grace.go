@@ -0,0 +1,159 @@
+package stunner
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+const (
+	// sessionHistorySize is the number of the most recently completed sessions whose duration
+	// is kept for estimating the drain time.
+	sessionHistorySize = 1024
+	// sessionDurationQuantile is the quantile of the session durations a session is projected
+	// to last.
+	sessionDurationQuantile = 0.95
+)
+
+type sessionDuration struct {
+	listener string
+	duration time.Duration
+}
+
+// lifetimeRegistry keeps track of the start time of the active allocations and of the duration
+// of the recently completed ones, for projecting the time it takes to drain the allocations.
+type lifetimeRegistry struct {
+	active  map[string]map[string]time.Time // keyed by listener name and client address
+	history []sessionDuration               // ring buffer
+	next    int
+	lock    sync.Mutex
+}
+
+func newLifetimeRegistry() *lifetimeRegistry {
+	return &lifetimeRegistry{active: map[string]map[string]time.Time{}}
+}
+
+func (r *lifetimeRegistry) start(listener string, src net.Addr, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.active[listener]; !ok {
+		r.active[listener] = map[string]time.Time{}
+	}
+	r.active[listener][src.String()] = now
+}
+
+func (r *lifetimeRegistry) end(listener string, src net.Addr, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	started, ok := r.active[listener][src.String()]
+	if !ok {
+		return
+	}
+	delete(r.active[listener], src.String())
+
+	d := sessionDuration{listener: listener, duration: now.Sub(started)}
+	if len(r.history) < sessionHistorySize {
+		r.history = append(r.history, d)
+		return
+	}
+	r.history[r.next] = d
+	r.next = (r.next + 1) % sessionHistorySize
+}
+
+// resetListener removes the active allocations of a listener when the listener is (re)started or
+// removed, the completed sessions are kept in the history.
+func (r *lifetimeRegistry) resetListener(listener string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.active, listener)
+}
+
+// estimate projects the drain time of the given listeners, mapped to their maximum session
+// duration (zero if unlimited). Each active session is projected to last for the 95th percentile
+// of the durations of the completed sessions that lasted longer than the current age of the
+// session, or twice its age if there is no such session, capped at the maximum session duration.
+func (r *lifetimeRegistry) estimate(listeners map[string]time.Duration, now time.Time) *stnrv1.DrainEstimate {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	durations := []time.Duration{}
+	for _, d := range r.history {
+		if _, ok := listeners[d.listener]; ok {
+			durations = append(durations, d.duration)
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	ret := &stnrv1.DrainEstimate{Samples: len(durations)}
+	if len(durations) > 0 {
+		ret.SessionDuration = quantile(durations, sessionDurationQuantile).Seconds()
+	}
+
+	var drain time.Duration
+	for listener, maxDuration := range listeners {
+		for _, started := range r.active[listener] {
+			age := now.Sub(started)
+			ret.Allocations++
+			ret.OldestSession = math.Max(ret.OldestSession, age.Seconds())
+
+			// the completed sessions that outlived the current age of the session
+			i := sort.Search(len(durations), func(i int) bool { return durations[i] > age })
+			projected := 2 * age
+			if i < len(durations) {
+				projected = quantile(durations[i:], sessionDurationQuantile)
+			}
+			if maxDuration > 0 && projected > maxDuration {
+				projected = maxDuration
+			}
+			if remaining := projected - age; remaining > drain {
+				drain = remaining
+			}
+		}
+	}
+
+	ret.DrainTime = drain.Seconds()
+	ret.DrainCompletion = now.Add(drain).UTC().Format(time.RFC3339)
+	return ret
+}
+
+// quantile returns the q-quantile of a sorted non-empty slice of durations.
+func quantile(durations []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(durations)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return durations[i]
+}
+
+// GetDrainEstimate returns the number of active allocations and the projected time it takes to
+// drain them at a listener, or at all listeners if the name is empty. The projection is based on
+// the durations of the recently completed sessions and the maximum session duration of the
+// listeners, which allows an orchestrator to set a sensible termination grace period.
+func (s *Stunner) GetDrainEstimate(name string) (*stnrv1.DrainEstimate, error) {
+	names := s.listenerManager.Keys()
+	if name != "" {
+		names = []string{name}
+	}
+
+	listeners := map[string]time.Duration{}
+	for _, n := range names {
+		l := s.GetListener(n)
+		if l == nil {
+			return nil, fmt.Errorf("listener %q not found", n)
+		}
+		listeners[n] = l.MaxSessionDuration
+	}
+
+	return s.lifetimes.estimate(listeners, s.clock.Now()), nil
+}
+
+// NewDrainEstimateHandler creates a helper function for querying the drain time estimate.
+func (s *Stunner) NewDrainEstimateHandler() object.DrainEstimateHandler {
+	return s.GetDrainEstimate
+}
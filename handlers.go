@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/l7mp/stunner/internal/object"
 	"github.com/l7mp/stunner/internal/util"
@@ -19,7 +20,7 @@ func (s *Stunner) NewAuthHandler() a12n.AuthHandler {
 	s.log.Trace("NewAuthHandler")
 
 	// Run witthout auth
-	if a, found := s.authManager.Get(stnrv1.DefaultAuthName); !found || a.(*object.Auth).Type == stnrv1.AuthTypeNone {
+	if _, found := s.authManager.Get(stnrv1.DefaultAuthName); !found {
 		return nil
 	}
 
@@ -27,7 +28,31 @@ func (s *Stunner) NewAuthHandler() a12n.AuthHandler {
 		// dynamic: auth mode might have changed behind ur back
 		auth := s.GetAuth()
 
+		if key, ok := s.selfCheck.authKey(username, auth.Realm, srcAddr); ok {
+			auth.Log.Debug("self-check auth request: success")
+			return key, true
+		}
+
+		if realm != auth.Realm {
+			auth.Log.Infof("%s auth request: failed: realm mismatch: %q", auth.Type.String(),
+				realm)
+			return s.rejectAuth(auth, username, realm, srcAddr, a12n.ReasonRealmMismatch)
+		}
+
 		switch auth.Type {
+		case stnrv1.AuthTypeNone:
+			auth.Log.Tracef("anonymous auth request: username=%q realm=%q srcAddr=%v",
+				username, realm, srcAddr)
+
+			if !auth.AllowsSource(util.GetIP(srcAddr)) {
+				auth.Log.Infof("anonymous auth request: failed: source %s not allowed",
+					srcAddr.String())
+				return s.rejectAuth(auth, username, realm, srcAddr, a12n.ReasonSourceNotAllowed)
+			}
+
+			auth.Log.Debug("anonymous auth request: success")
+			return a12n.GenerateAuthKey(username, auth.Realm, ""), true
+
 		case stnrv1.AuthTypeStatic:
 			auth.Log.Tracef("static auth request: username=%q realm=%q srcAddr=%v\n",
 				username, realm, srcAddr)
@@ -38,8 +63,13 @@ func (s *Stunner) NewAuthHandler() a12n.AuthHandler {
 				return key, true
 			}
 
+			if password, ok := auth.GetCredential(username); ok {
+				auth.Log.Debug("static auth request: valid runtime credential")
+				return a12n.GenerateAuthKey(username, auth.Realm, password), true
+			}
+
 			auth.Log.Infof("static auth request: failed: invalid username")
-			return nil, false
+			return s.rejectAuth(auth, username, realm, srcAddr, a12n.ReasonUnknownUser)
 
 		case stnrv1.AuthTypeEphemeral:
 			auth.Log.Tracef("ephemeral auth request: username=%q realm=%q srcAddr=%v",
@@ -47,19 +77,60 @@ func (s *Stunner) NewAuthHandler() a12n.AuthHandler {
 
 			if err := a12n.CheckTimeWindowedUsername(username); err != nil {
 				auth.Log.Infof("ephemeral auth request: failed: %s", err)
-				return nil, false
+				reason := a12n.ReasonInvalidUsername
+				if errors.Is(err, a12n.ErrExpiredTimeWindowedUsername) {
+					reason = a12n.ReasonExpiredTimestamp
+				}
+				return s.rejectAuth(auth, username, realm, srcAddr, reason)
 			}
 
 			password, err := a12n.GetLongTermCredential(username, auth.Secret)
 			if err != nil {
 				auth.Log.Debugf("ephemeral auth request: error generating password: %s",
 					err)
-				return nil, false
+				return s.rejectAuth(auth, username, realm, srcAddr, a12n.ReasonBackendError)
 			}
 
 			auth.Log.Debug("ephemeral auth request: success")
 			return a12n.GenerateAuthKey(username, auth.Realm, password), true
 
+		case stnrv1.AuthTypeOAuth:
+			auth.Log.Tracef("oauth auth request: username=%q realm=%q srcAddr=%v",
+				username, realm, srcAddr)
+
+			key, ok := s.oauthKey(username, srcAddr)
+			if !ok {
+				auth.Log.Infof("oauth auth request: failed: no valid access token for "+
+					"client %s", srcAddr.String())
+				return s.rejectAuth(auth, username, realm, srcAddr, a12n.ReasonUnknownUser)
+			}
+
+			auth.Log.Debug("oauth auth request: success")
+			return key, true
+
+		case stnrv1.AuthTypeLDAP:
+			auth.Log.Tracef("ldap auth request: username=%q realm=%q srcAddr=%v",
+				username, realm, srcAddr)
+
+			client := auth.GetLDAPClient()
+			if client == nil {
+				auth.Log.Errorf("ldap auth request: failed: LDAP client not available")
+				return s.rejectAuth(auth, username, realm, srcAddr, a12n.ReasonBackendError)
+			}
+
+			key, err := client.GetAuthKey(username, auth.Realm)
+			if err != nil {
+				auth.Log.Infof("ldap auth request: failed: %s", err)
+				reason := a12n.ReasonBackendError
+				if errors.Is(err, a12n.ErrLDAPUserNotFound) {
+					reason = a12n.ReasonUnknownUser
+				}
+				return s.rejectAuth(auth, username, realm, srcAddr, reason)
+			}
+
+			auth.Log.Debug("ldap auth request: success")
+			return key, true
+
 		default:
 			auth.Log.Errorf("internal error: unknown authentication mode %q",
 				auth.Type.String())
@@ -68,6 +139,15 @@ func (s *Stunner) NewAuthHandler() a12n.AuthHandler {
 	}
 }
 
+// rejectAuth records a failed authentication request in the metrics and the access log. Failures
+// to verify the MESSAGE-INTEGRITY of a request are reported by the OnAuth event handler.
+func (s *Stunner) rejectAuth(auth *object.Auth, username, realm string, srcAddr net.Addr, reason string) ([]byte, bool) {
+	s.telemetry.IncrementAuthFailure(auth.Type.String(), reason)
+	s.log.Debugf("Authentication request: client=%s, username=%s, realm=%s, verdict=REJECTED, "+
+		"reason=%s", srcAddr.String(), username, realm, reason)
+	return nil, false
+}
+
 // NewPermissionHandler returns a callback to handle client permission requests to access peers.
 func (s *Stunner) NewPermissionHandler(l *object.Listener) a12n.PermissionHandler {
 	s.log.Trace("NewPermissionHandler")
@@ -82,33 +162,142 @@ func (s *Stunner) NewPermissionHandler(l *object.Listener) a12n.PermissionHandle
 			src.String(), peerIP)
 
 		clusters := s.clusterManager.Keys()
-		for _, r := range l.Routes {
-			auth.Log.Tracef("considering route to cluster %q", r)
-			if util.Member(clusters, r) {
-				auth.Log.Tracef("considering cluster %q", r)
-				c := s.GetCluster(r)
-				if c.Route(peer) {
-					auth.Log.Debugf("permission granted on listener %q for client "+
-						"%q to peer %s via cluster %q", l.Name, src.String(),
-						peerIP, c.Name)
-					return true
-				}
+
+		// the routes may be confined by the origin of the allocation
+		routes := l.Routes
+		if l.HasOriginPolicy() {
+			routes = l.OriginRoutesFor(s.origins.get(src))
+		}
+
+		// BLOCK clusters take precedence
+		for _, r := range routes {
+			if !util.Member(clusters, r) {
+				continue
 			}
+			if c := s.GetCluster(r); c.BlocksPeer(peer) {
+				auth.Log.Infof("permission denied on listener %q for client %q to peer %s: "+
+					"blocked by cluster %s", l.Name, src.String(), peerIP, clusterRef(c))
+				return false
+			}
+		}
+
+		// clusters outside their active windows do not admit new permissions
+		now := time.Now()
+		active := func(c *object.Cluster) bool { return c.Active(now) }
+		if c := s.routeCluster(routes, peer, active); c != nil {
+			auth.Log.Debugf("permission granted on listener %q for client %q to peer %s "+
+				"via cluster %s", l.Name, src.String(), peerIP, clusterRef(c))
+			return true
+		}
+		if c := s.routeCluster(routes, peer, nil); c != nil {
+			auth.Log.Infof("permission denied on listener %q for client %q to peer %s: "+
+				"cluster %s outside of its active windows", l.Name, src.String(), peerIP,
+				clusterRef(c))
+			return false
 		}
+
 		auth.Log.Infof("permission denied on listener %q for client %q to peer %s: "+
 			"no route to endpoint", l.Name, src.String(), peerIP)
 		return false
 	}
 }
 
+// clusterRef identifies a cluster in the access logs by its name and, if known, by the Kubernetes
+// Service it was generated from.
+func clusterRef(c *object.Cluster) string {
+	if m := c.Metadata(); m != nil {
+		return fmt.Sprintf("%q (service %s)", c.Name, m.String())
+	}
+	return fmt.Sprintf("%q", c.Name)
+}
+
 // NewReadinessHandler creates a helper function for checking the readiness of STUNner.
 func (s *Stunner) NewReadinessHandler() object.ReadinessHandler {
 	return func() error {
-		if s.forceReady || s.IsReady() {
+		if s.forceReady {
 			return nil
-		} else {
+		}
+		if s.IsDraining() {
+			return errors.New("stunnerd draining")
+		}
+		if s.IsStandby() {
+			return errors.New("stunnerd in standby mode")
+		}
+		if !s.IsReady() {
 			return errors.New("stunnerd not ready")
 		}
+		for _, name := range s.listenerManager.Keys() {
+			if l := s.GetListener(name); l != nil {
+				if err := s.checkListenerReady(l); err != nil {
+					return fmt.Errorf("listener %s not ready: %w", name, err)
+				}
+			}
+		}
+		if err := s.checkSelfCheck(); err != nil {
+			return err
+		}
+		return s.checkHealthContributors()
+	}
+}
+
+// NewListenerReadinessHandler creates a helper function for checking the readiness of each
+// listener.
+func (s *Stunner) NewListenerReadinessHandler() object.ListenerReadinessHandler {
+	return func() map[string]error {
+		ret := map[string]error{}
+		for _, name := range s.listenerManager.Keys() {
+			if l := s.GetListener(name); l != nil {
+				ret[name] = s.checkListenerReady(l)
+			}
+		}
+		return ret
+	}
+}
+
+// checkListenerReady reports whether a listener is ready to serve clients: the listener socket
+// must be bound and the initial resolution must have completed for the STRICT_DNS, CONSUL and EDS
+// clusters the listener routes to.
+func (s *Stunner) checkListenerReady(l *object.Listener) error {
+	if !s.dryRun && !s.IsStandby() && !l.IsRunning() {
+		return errors.New("listener socket not bound")
+	}
+	for _, r := range l.Routes {
+		if c := s.GetCluster(r); c != nil && !c.IsResolved() {
+			switch c.Type {
+			case stnrv1.ClusterTypeConsul:
+				return fmt.Errorf("waiting for initial Consul resolution of cluster %s", r)
+			case stnrv1.ClusterTypeEDS:
+				return fmt.Errorf("waiting for initial EDS update of cluster %s", r)
+			}
+			return fmt.Errorf("waiting for initial DNS resolution of cluster %s", r)
+		}
+	}
+	return nil
+}
+
+// NewTapHandler creates a helper function for the admin API to enable or disable packet tapping
+// for sessions.
+func (s *Stunner) NewTapHandler() object.TapHandler {
+	return func(selector, value string, enable bool) error {
+		return s.SetSessionTap(selector, value, enable)
+	}
+}
+
+// NewCredentialHandler creates a helper function for the admin API to add or remove runtime
+// credentials.
+func (s *Stunner) NewCredentialHandler() object.CredentialHandler {
+	return func(username, password string, ttl time.Duration, add bool) error {
+		if add {
+			return s.AddCredential(username, password, ttl)
+		}
+		return s.RemoveCredential(username)
+	}
+}
+
+// NewFaultHandler creates a helper function for the admin API to set up fault injection.
+func (s *Stunner) NewFaultHandler() object.FaultHandler {
+	return func(drop int, delay time.Duration, failEvery int) error {
+		return s.faults.set(drop, delay, failEvery)
 	}
 }
 
@@ -148,6 +337,78 @@ func (s *Stunner) NewQuotaHandler() QuotaHandler {
 
 var quotaHandlerConstructor = newQuotaHandlerStub
 
+// NewListenerQuotaHandler returns a TURN quota handler for a listener that enforces the country
+// filters, the per-client IP allocation quota and the churn rate limit of the listener before
+// calling the global quota handler.
+func (s *Stunner) NewListenerQuotaHandler(l *object.Listener) turn.QuotaHandler {
+	quotaHandler := s.quotaHandler.QuotaHandler()
+	return func(username, realm string, srcAddr net.Addr) bool {
+		if s.faults.failAllocation() {
+			s.log.Infof("allocation denied on listener %q for client %q: fault injected",
+				l.Name, srcAddr.String())
+			return false
+		}
+
+		if s.IsDraining() {
+			s.log.Infof("allocation denied on listener %q for client %q: stunnerd draining",
+				l.Name, srcAddr.String())
+			return false
+		}
+
+		if s.toggles.isDisabled(l.Name) {
+			s.log.Infof("allocation denied on listener %q for client %q: listener "+
+				"administratively disabled", l.Name, srcAddr.String())
+			return false
+		}
+
+		if s.fds.isExhausted() {
+			s.log.Infof("allocation denied on listener %q for client %q: file descriptors "+
+				"near exhaustion", l.Name, srcAddr.String())
+			return false
+		}
+
+		// the dataplane self-check is not subject to the client quotas and filters
+		if s.selfCheck.isCheck(username, srcAddr) {
+			return true
+		}
+
+		if l.HasCountryFilter() {
+			// the filter is ignored if the GeoIP database is not available
+			if country, ok := s.LookupCountry(srcAddr); ok && !l.CheckCountry(country) {
+				s.log.Infof("allocation denied on listener %q for client %q: country %q "+
+					"not permitted", l.Name, srcAddr.String(), country)
+				return false
+			}
+		}
+
+		if l.HasOriginPolicy() {
+			if origin := s.origins.get(srcAddr); !l.CheckOrigin(origin) {
+				s.log.Infof("allocation denied on listener %q for client %q: origin %q "+
+					"not permitted", l.Name, srcAddr.String(), origin)
+				return false
+			}
+		}
+
+		if !l.CheckClientIPQuota(srcAddr) {
+			s.log.Infof("quota exceeded on listener %q: client %q reached the per-IP "+
+				"allocation quota (%d)", l.Name, srcAddr.String(), l.GetClientIPQuota())
+			return false
+		}
+
+		if !s.checkChurn(l, srcAddr) {
+			s.log.Infof("allocation denied on listener %q for client %q: allocation churn "+
+				"threshold (%d/%s) exceeded", l.Name, srcAddr.String(), l.ChurnThreshold,
+				ChurnWindow)
+			return false
+		}
+
+		if quotaHandler == nil {
+			return true
+		}
+		return quotaHandler(username, realm, srcAddr)
+	}
+}
+
 // quotaHandlerStub is a stub quota handler that does nothing.
 type quotaHandlerStub struct {
 	quotaHandler turn.QuotaHandler
@@ -207,26 +468,69 @@ func newOffloadHandlerStub(s *Stunner) OffloadHandler {
 	return &offloadHandlerStub{s: s}
 }
 
+// LookupCountry returns the ISO 3166-1 alpha-2 country code for a client address (empty if
+// unknown) and a flag that is false if geolocation is disabled.
+func (s *Stunner) LookupCountry(addr net.Addr) (string, bool) {
+	a, found := s.adminManager.Get(stnrv1.DefaultAdminName)
+	if !found {
+		return "", false
+	}
+	return a.(*object.Admin).LookupCountry(util.GetIP(addr))
+}
+
 // NewEventHandler creates a set of callbcks for tracking the lifecycle of TURN allocations.
 func (s *Stunner) NewEventHandler(l *object.Listener) turn.EventHandlers {
 	return turn.EventHandlers{
 		OnAuth: func(src, dst net.Addr, proto, username, realm string, method string, verdict bool) {
-			status := "REJECTED"
-			if verdict {
-				status = "ACCEPTED"
+			authType := s.GetAuth().Type.String()
+			if !verdict {
+				s.telemetry.IncrementAuthFailure(authType, a12n.ReasonBadIntegrity)
+				s.log.Debugf("Authentication request: client=%s, method=%s, verdict=REJECTED, "+
+					"reason=%s", dumpClient(src, dst, proto, username, realm), method,
+					a12n.ReasonBadIntegrity)
+				return
 			}
-			s.log.Debugf("Authentication request: client=%s, method=%s, verdict=%s",
-				dumpClient(src, dst, proto, username, realm), method, status)
+			s.telemetry.IncrementAuthSuccess(authType)
+			s.idle.touch(src, dst)
+			s.log.Debugf("Authentication request: client=%s, method=%s, verdict=ACCEPTED",
+				dumpClient(src, dst, proto, username, realm), method)
 		},
 		OnAllocationCreated: func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, reqPort int) {
-			s.log.Debugf("Allocation created: client=%s, relay-address=%s, requested-port=%d",
-				dumpClient(src, dst, proto, username, realm), relayAddr.String(), reqPort)
-
+			country, geo := s.LookupCountry(src)
+			info := ""
+			if geo {
+				info += fmt.Sprintf(", country=%s", country)
+			}
+			if l.HasOriginPolicy() {
+				s.origins.bind(src)
+				if origin := s.origins.get(src); origin != "" {
+					info += fmt.Sprintf(", origin=%s", origin)
+				}
+			}
+			s.log.Debugf("Allocation created: client=%s%s, relay-address=%s, requested-port=%d",
+				dumpClient(src, dst, proto, username, realm), info, relayAddr.String(), reqPort)
+			s.telemetry.IncrementAllocations(l.Name, country)
+
+			l.AddClientAllocation(src)
+			s.recordChurn(l, src)
+			s.tap.addSession(relayAddr, username, src)
+			s.talkers.setClient(relayAddr, username, src)
+			s.upgrade.addAllocation(l.Name, src, proto, username, relayAddr)
+			s.idle.addClient(src, dst, relayAddr)
+			s.lifetimes.start(l.Name, src, s.clock.Now())
 			s.quotaHandler.AllocationHandler(src, dst, proto, username, realm, AllocationCreated)
 		},
 		OnAllocationDeleted: func(src, dst net.Addr, proto, username, realm string) {
 			s.log.Debugf("Allocation deleted: client=%s", dumpClient(src, dst, proto, username, realm))
 
+			l.DeleteClientAllocation(src)
+			s.oauth.delete(src)
+			s.origins.delete(src)
+			s.tap.deleteClient(src)
+			s.upgrade.deleteAllocation(l.Name, src)
+			s.idle.deleteClient(src, dst)
+			s.mobility.deleteAllocation(l.Name, src)
+			s.lifetimes.end(l.Name, src, s.clock.Now())
 			s.quotaHandler.AllocationHandler(src, dst, proto, username, realm, AllocationDeleted)
 		},
 		OnAllocationError: func(src, dst net.Addr, proto, message string) {
@@ -235,10 +539,12 @@ func (s *Stunner) NewEventHandler(l *object.Listener) turn.EventHandlers {
 		OnPermissionCreated: func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, peer net.IP) {
 			s.log.Debugf("Permission created: client=%s, relay-addr=%s, peer=%s",
 				dumpClient(src, dst, proto, username, realm), relayAddr.String(), peer.String())
+			s.upgrade.addPeer(l.Name, src, peer)
 		},
 		OnPermissionDeleted: func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, peer net.IP) {
 			s.log.Debugf("Permission deleted: client=%s, relay-addr=%s, peer=%s",
 				dumpClient(src, dst, proto, username, realm), relayAddr.String(), peer.String())
+			s.upgrade.deletePeer(l.Name, src, peer)
 		},
 		OnChannelCreated: func(src, dst net.Addr, proto, username, realm string, relayAddr, peer net.Addr, chanNum uint16) {
 			// listener and cluster needed for monitoring
@@ -246,15 +552,8 @@ func (s *Stunner) NewEventHandler(l *object.Listener) turn.EventHandlers {
 			cluster := ""
 			peerAddr, ok := peer.(*net.UDPAddr)
 			if ok {
-				clusters := s.clusterManager.Keys()
-				for _, r := range l.Routes {
-					if util.Member(clusters, r) {
-						c := s.GetCluster(r)
-						if c.Route(peerAddr.IP) {
-							cluster = c.Name
-							break
-						}
-					}
+				if c := s.routingCluster(l, peerAddr.IP, nil); c != nil {
+					cluster = c.Name
 				}
 			}
 
@@ -265,6 +564,7 @@ func (s *Stunner) NewEventHandler(l *object.Listener) turn.EventHandlers {
 
 			s.offloadHandler.HandleChannelCreate(src, dst, proto, username, realm, relayAddr,
 				peer, chanNum, listener, cluster)
+			s.upgrade.addChannel(l.Name, src, peer, chanNum)
 		},
 		OnChannelDeleted: func(src, dst net.Addr, proto, username, realm string, relayAddr, peer net.Addr, chanNum uint16) {
 			s.log.Debugf("Channel deleted: client=%s, relay-addr=%s, peer=%s, channel-num=%d",
@@ -272,6 +572,7 @@ func (s *Stunner) NewEventHandler(l *object.Listener) turn.EventHandlers {
 				peer.String(), chanNum)
 
 			s.offloadHandler.HandleChannelDelete(src, dst, proto, username, realm, relayAddr, peer, chanNum)
+			s.upgrade.deleteChannel(l.Name, src, chanNum)
 		},
 	}
 }
@@ -0,0 +1,105 @@
+package stunner
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// ICELitePacketConn is a net.PacketConn that implements an ICE-lite responder (RFC 8445, Section
+// 2.5) on a UDP listener: ICE connectivity checks addressed to the local ICE username fragment of
+// the listener are answered directly, without reaching the TURN server. All other packets are
+// returned to the caller.
+type ICELitePacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	ufrag     string
+	integrity stun.MessageIntegrity
+	log       logging.LeveledLogger
+}
+
+// NewICELitePacketConn decorates a listener PacketConn with an ICE-lite responder using the ICE
+// credentials of the listener.
+func NewICELitePacketConn(c net.PacketConn, l *object.Listener, log logging.LeveledLogger) net.PacketConn {
+	return &ICELitePacketConn{
+		PacketConn: c,
+		listener:   l,
+		ufrag:      l.ICEUfrag,
+		integrity:  stun.NewShortTermIntegrity(l.ICEPassword),
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn. ICE connectivity checks are consumed and never returned to
+// the caller.
+func (c *ICELitePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		if !c.handleCheck(p[:n], addr) {
+			return n, addr, nil
+		}
+	}
+}
+
+// handleCheck answers the packet if it is an ICE connectivity check for the listener and returns
+// true, otherwise it returns false.
+func (c *ICELitePacketConn) handleCheck(p []byte, addr net.Addr) bool {
+	if !stun.IsMessage(p) {
+		return false
+	}
+
+	req := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := req.Decode(); err != nil || req.Type != stun.BindingRequest {
+		return false
+	}
+
+	// ICE connectivity checks carry a USERNAME of the form "<local-ufrag>:<remote-ufrag>"
+	var username stun.Username
+	if err := username.GetFrom(req); err != nil {
+		return false
+	}
+	local, _, ok := strings.Cut(username.String(), ":")
+	if !ok || local != c.ufrag {
+		return false
+	}
+
+	var res *stun.Message
+	var err error
+	if ierr := c.integrity.Check(req); ierr != nil {
+		c.log.Debugf("ice-lite: invalid message integrity in connectivity check from %s: %s",
+			addr.String(), ierr.Error())
+		res, err = stun.Build(stun.NewTransactionIDSetter(req.TransactionID),
+			stun.NewType(stun.MethodBinding, stun.ClassErrorResponse),
+			stun.CodeUnauthorized, stun.Fingerprint)
+	} else {
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			return true
+		}
+
+		c.log.Tracef("ice-lite: answering connectivity check from %s", addr.String())
+		res, err = stun.Build(stun.NewTransactionIDSetter(req.TransactionID),
+			stun.BindingSuccess,
+			&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+			c.integrity, stun.Fingerprint)
+	}
+	if err != nil {
+		c.log.Debugf("ice-lite: could not build response: %s", err.Error())
+		return true
+	}
+
+	if _, err := c.PacketConn.WriteTo(res.Raw, addr); err != nil {
+		c.log.Debugf("ice-lite: could not send response to %s: %s", addr.String(),
+			err.Error())
+	}
+
+	return true
+}
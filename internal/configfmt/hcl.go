@@ -0,0 +1,101 @@
+package configfmt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// HCLToJSON converts an HCL document in the native HCL syntax into JSON. Attribute values are
+// evaluated without variables and functions, so they must be literals: strings (including
+// heredocs), numbers, booleans, null, tuples and objects. An unlabeled block is converted into an
+// object, or into a list of objects if the block is repeated. A block with a single label is
+// converted into a list element with the label set as the "name" of the element, so that, e.g.,
+// the block `listeners "udp-listener" { port = 3478 }` adds the listener named "udp-listener" to
+// the "listeners" list.
+func HCLToJSON(b []byte) ([]byte, error) {
+	f, diags := hclsyntax.ParseConfig(b, "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("internal error: unexpected HCL body type %T", f.Body)
+	}
+	root, err := hclBodyToMap(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(root)
+}
+
+// hclBodyToMap converts the attributes and the blocks of a body into a map.
+func hclBodyToMap(body *hclsyntax.Body) (map[string]any, error) {
+	m := map[string]any{}
+	for name, attr := range body.Attributes {
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		js, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid value for attribute %q: %w",
+				attr.SrcRange.String(), name, err)
+		}
+		m[name] = json.RawMessage(js)
+	}
+
+	labeled := map[string]bool{}
+	for _, block := range body.Blocks {
+		r := block.DefRange().String()
+		if _, ok := body.Attributes[block.Type]; ok {
+			return nil, fmt.Errorf("%s: block %q redefines an attribute", r, block.Type)
+		}
+		if len(block.Labels) > 1 {
+			return nil, fmt.Errorf("%s: block %q has more than one label", r, block.Type)
+		}
+
+		obj, err := hclBodyToMap(block.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		hasLabel := len(block.Labels) == 1
+		if prev, ok := labeled[block.Type]; ok && prev != hasLabel {
+			return nil, fmt.Errorf("%s: labeled and unlabeled %q blocks cannot be mixed", r,
+				block.Type)
+		}
+		labeled[block.Type] = hasLabel
+
+		if hasLabel {
+			label := block.Labels[0]
+			if attr, ok := block.Body.Attributes["name"]; ok {
+				v, _ := attr.Expr.Value(nil)
+				if v.IsNull() || !v.Type().Equals(cty.String) || v.AsString() != label {
+					return nil, fmt.Errorf("%s: name of block %q does not match the label %q",
+						r, block.Type, label)
+				}
+			}
+			obj["name"] = label
+		}
+
+		switch prev := m[block.Type].(type) {
+		case nil:
+			if hasLabel {
+				m[block.Type] = []any{obj}
+			} else {
+				m[block.Type] = obj
+			}
+		case map[string]any:
+			m[block.Type] = []any{prev, obj}
+		case []any:
+			m[block.Type] = append(prev, obj)
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,93 @@
+package configfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHCLToJSON(t *testing.T) {
+	for _, c := range []struct {
+		name, hcl, json string
+	}{
+		{"empty", "# comment\n// comment\n/* block\ncomment */\n", `{}`},
+		{"attributes", `
+version = "v1" // trailing comment
+port = 3478
+rate = -1.5
+enabled = true
+disabled = false
+unset = null
+escaped = "a\"b\\c\n\u00e9"
+literal = "$${HOME}"
+`, `{"version":"v1","port":3478,"rate":-1.5,"enabled":true,"disabled":false,"unset":null,
+"escaped":"a\"b\\c\né","literal":"${HOME}"}`},
+		{"blocks", `
+admin {
+  loglevel = "all:INFO"
+}
+auth {
+  type = "static"
+  credentials = {
+    username = "user1"
+    "password": "pass1",
+  }
+}
+`, `{"admin":{"loglevel":"all:INFO"},"auth":{"type":"static",
+"credentials":{"username":"user1","password":"pass1"}}}`},
+		{"repeated blocks", `
+mirror { addr = "a" }
+mirror { addr = "b" }
+`, `{"mirror":[{"addr":"a"},{"addr":"b"}]}`},
+		{"labeled blocks", `
+listeners "udp-listener" {
+  port = 3478
+  routes = [
+    "media-plane", # comment
+  ]
+}
+listeners udp-listener-2 {
+  name = "udp-listener-2"
+}
+`, `{"listeners":[{"name":"udp-listener","port":3478,"routes":["media-plane"]},
+{"name":"udp-listener-2"}]}`},
+		{"heredocs", `
+cert = <<EOT
+line1
+line2
+EOT
+key = <<-EOT
+    indented
+      more
+    EOT
+`, `{"cert":"line1\nline2\n","key":"indented\n  more\n"}`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			js, err := HCLToJSON([]byte(c.hcl))
+			assert.NoError(t, err, "convert")
+			assert.JSONEq(t, c.json, string(js), "json")
+		})
+	}
+
+	for _, c := range []string{
+		`key`,
+		`key = `,
+		`key = "unterminated`,
+		`key = 1 2`,
+		"key = 1\nkey = 2",
+		`key = [1, 2`,
+		`block {`,
+		`}`,
+		`key = var.foo`,
+		`key = upper("x")`,
+		`key = "${var}"`,
+		"block = 1\nblock {}",
+		`block "a" "b" {}`,
+		"block {}\nblock \"a\" {}",
+		`block "a" { name = "b" }`,
+		"key = <<EOT\nunterminated",
+	} {
+		_, err := HCLToJSON([]byte(c))
+		assert.Error(t, err, "invalid HCL: %q", c)
+	}
+}
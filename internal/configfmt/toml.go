@@ -0,0 +1,19 @@
+// Package configfmt converts the config serialization formats that are not natively supported by
+// the YAML/JSON config parser into JSON, so that there is a single canonical representation of
+// the config.
+package configfmt
+
+import (
+	"encoding/json"
+
+	"github.com/BurntSushi/toml"
+)
+
+// TOMLToJSON converts a TOML document into JSON.
+func TOMLToJSON(b []byte) ([]byte, error) {
+	root := map[string]any{}
+	if err := toml.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	return json.Marshal(root)
+}
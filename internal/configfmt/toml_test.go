@@ -0,0 +1,81 @@
+package configfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOMLToJSON(t *testing.T) {
+	for _, c := range []struct {
+		name, toml, json string
+	}{
+		{"empty", "# comment only\n", `{}`},
+		{"key/value", `
+version = "v1"  # trailing comment
+port = 3478
+rate = 1.5
+big = 1_000
+hex = 0xff
+enabled = true
+disabled = false
+'quoted key' = 'C:\path'
+"escaped" = "a\"b\\c\n\u00e9"
+`, `{"version":"v1","port":3478,"rate":1.5,"big":1000,"hex":255,"enabled":true,
+"disabled":false,"quoted key":"C:\\path","escaped":"a\"b\\c\né"}`},
+		{"dotted keys", `
+auth.type = "static"
+auth.credentials.username = "user1"
+`, `{"auth":{"type":"static","credentials":{"username":"user1"}}}`},
+		{"tables", `
+version = "v1"
+[admin]
+loglevel = "all:INFO"
+[auth.credentials]
+username = "user1"
+`, `{"version":"v1","admin":{"loglevel":"all:INFO"},"auth":{"credentials":{"username":"user1"}}}`},
+		{"arrays of tables", `
+[[listeners]]
+name = "udp"
+routes = [ "a",
+  "b", # comment
+]
+[[listeners]]
+name = "tcp"
+[listeners.meta]
+x = 1
+`, `{"listeners":[{"name":"udp","routes":["a","b"]},{"name":"tcp","meta":{"x":1}}]}`},
+		{"inline tables", `credentials = { username = "user1", password = "pass1" }
+endpoints = [{ addr = "1.2.3.4" }, {}]`,
+			`{"credentials":{"username":"user1","password":"pass1"},"endpoints":[{"addr":"1.2.3.4"},{}]}`},
+		{"multi-line strings", `cert = """
+line1
+line2 \
+   continued"""
+key = '''
+raw\n'''`, `{"cert":"line1\nline2 continued","key":"raw\\n"}`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			js, err := TOMLToJSON([]byte(c.toml))
+			assert.NoError(t, err, "convert")
+			assert.JSONEq(t, c.json, string(js), "json")
+		})
+	}
+
+	for _, c := range []string{
+		`key`,
+		`key = `,
+		`key = "unterminated`,
+		`key = 1 2`,
+		"key = 1\nkey = 2",
+		`key = [1, 2`,
+		`key = { a = 1`,
+		`[table`,
+		"a = 1\n[a]",
+		"[a]\n[[a]]",
+		`key = "\q"`,
+	} {
+		_, err := TOMLToJSON([]byte(c))
+		assert.Error(t, err, "invalid TOML: %q", c)
+	}
+}
@@ -1,4 +1,4 @@
-package util
+package endpoint
 
 import (
 	"fmt"
@@ -16,8 +16,8 @@ type Endpoint struct {
 	hasPrefixLen, hasPort bool
 }
 
-// ParseEndpoint parses an endpoint from the canonical format: "<IP>[optional slash and prefix length]:<minPort-maxPort)."
-func ParseEndpoint(ep string) (*Endpoint, error) {
+// Parse parses an endpoint from the canonical format: "<IP>[optional slash and prefix length]:<minPort-maxPort)."
+func Parse(ep string) (*Endpoint, error) {
 	// separate the ports
 	var port, endPort int
 	var err error
@@ -104,3 +104,29 @@ func (ep *Endpoint) String() string {
 
 	return ip + portRange
 }
+
+// PortRange returns the port range of the endpoint and whether the port range was specified
+// explicitly.
+func (ep *Endpoint) PortRange() (int, int, bool) {
+	return ep.port, ep.endPort, ep.hasPort
+}
+
+// Prefix returns the IP prefix of the endpoint in CIDR notation.
+func (ep *Endpoint) Prefix() string {
+	return ep.prefix.String()
+}
+
+// PrefixLen returns the length of the IP prefix of the endpoint.
+func (ep *Endpoint) PrefixLen() int {
+	ones, _ := ep.prefix.Mask.Size()
+	return ones
+}
+
+// Covers reports whether the endpoint includes all IPs and ports of another endpoint.
+func (ep *Endpoint) Covers(other *Endpoint) bool {
+	if len(ep.prefix.IP) != len(other.prefix.IP) {
+		return false
+	}
+	return ep.PrefixLen() <= other.PrefixLen() && ep.prefix.Contains(other.prefix.IP) &&
+		ep.port <= other.port && ep.endPort >= other.endPort
+}
@@ -1,4 +1,4 @@
-package util
+package endpoint
 
 import (
 	"net"
@@ -101,7 +101,7 @@ var endpointTester = []endpointTest{
 func TestEndpointParse(t *testing.T) {
 	for _, c := range endpointTester {
 		t.Run(c.name, func(t *testing.T) {
-			ep, err := ParseEndpoint(c.input)
+			ep, err := Parse(c.input)
 			if c.success {
 				assert.NoError(t, err, "parse")
 				assert.Equal(t, c.ipnet, ep.prefix.String(), "ip equal")
@@ -148,7 +148,7 @@ var matchTester = []matchTest{{
 func TestRouteMatch(t *testing.T) {
 	for _, c := range matchTester {
 		t.Run(c.name, func(t *testing.T) {
-			ep, err := ParseEndpoint(c.input)
+			ep, err := Parse(c.input)
 			assert.NoError(t, err, "endpoint parse")
 			ip := net.ParseIP(c.ip)
 			assert.NotNil(t, ip, "ip parse")
@@ -157,3 +157,27 @@ func TestRouteMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpointCovers(t *testing.T) {
+	for _, c := range []struct {
+		ep, other string
+		prefixLen int
+		covers    bool
+	}{
+		{"0.0.0.0/0", "1.2.3.4", 0, true},
+		{"1.2.0.0/16", "1.2.3.0/24:<1-2>", 16, true},
+		{"1.2.0.0/16:<1-1024>", "1.2.3.0/24:<1-2>", 16, true},
+		{"1.2.0.0/16:<1-1024>", "1.2.3.0/24", 16, false},
+		{"1.2.3.0/24", "1.2.0.0/16", 24, false},
+		{"1.2.3.4", "1.2.3.5", 32, false},
+		{"::/0", "1.2.3.4", 0, false},
+		{"2001:db8::/32", "2001:db8::1", 32, true},
+	} {
+		ep, err := Parse(c.ep)
+		assert.NoError(t, err, "parse")
+		other, err := Parse(c.other)
+		assert.NoError(t, err, "parse")
+		assert.Equal(t, c.prefixLen, ep.PrefixLen(), "prefix len of %s", c.ep)
+		assert.Equal(t, c.covers, ep.Covers(other), "%s covers %s", c.ep, c.other)
+	}
+}
@@ -0,0 +1,60 @@
+// Package geoip implements client geolocation using a MaxMind GeoIP2/GeoLite2 database.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// UnknownCountry is the country code reported for IP addresses that cannot be located.
+const UnknownCountry = ""
+
+// Reader looks up the country of IP addresses in a MaxMind database.
+type Reader struct {
+	file string
+	db   *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Open opens a MaxMind country or city database in the MMDB format.
+func Open(file string) (*Reader, error) {
+	db, err := maxminddb.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open GeoIP database %q: %w", file, err)
+	}
+
+	return &Reader{file: file, db: db}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 country code of an IP address, or UnknownCountry if the
+// address cannot be located.
+func (r *Reader) Country(ip net.IP) string {
+	if r == nil || ip == nil {
+		return UnknownCountry
+	}
+
+	var record countryRecord
+	if err := r.db.Lookup(ip, &record); err != nil {
+		return UnknownCountry
+	}
+
+	return strings.ToUpper(record.Country.ISOCode)
+}
+
+// File returns the name of the database file.
+func (r *Reader) File() string {
+	return r.file
+}
+
+// Close closes the database.
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
@@ -23,6 +23,7 @@ import (
 
 	v1 "github.com/l7mp/stunner/pkg/apis/v1"
 	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	k8sclient "github.com/l7mp/stunner/pkg/config/client/k8s"
 	"github.com/l7mp/stunner/pkg/logger"
 	"github.com/l7mp/stunner/pkg/whipconn"
 )
@@ -73,8 +74,8 @@ type Config struct {
 	EventChannel chan Event
 
 	K8sConfigFlags  *cliopt.ConfigFlags
-	CDSConfigFlags  *cdsclient.CDSConfigFlags
-	AuthConfigFlags *cdsclient.AuthConfigFlags
+	CDSConfigFlags  *k8sclient.CDSConfigFlags
+	AuthConfigFlags *k8sclient.AuthConfigFlags
 
 	Namespace      string
 	TURNTransports []v1.ListenerProtocol
@@ -94,8 +95,8 @@ type iceTester struct {
 	eventCh chan Event
 
 	k8sConfigFlags  *cliopt.ConfigFlags
-	cdsConfigFlags  *cdsclient.CDSConfigFlags
-	authConfigFlags *cdsclient.AuthConfigFlags
+	cdsConfigFlags  *k8sclient.CDSConfigFlags
+	authConfigFlags *k8sclient.AuthConfigFlags
 
 	namespace             string
 	transports            []v1.ListenerProtocol
@@ -304,7 +305,7 @@ func (t *iceTester) Start(ctx context.Context) error {
 		)
 	}
 
-	whipEndpoint, err := cdsclient.DiscoverK8sPod(ctx, t.k8sConfigFlags, t.namespace, "app=icetester", v1.DefaultICETesterPort,
+	whipEndpoint, err := k8sclient.DiscoverK8sPod(ctx, t.k8sConfigFlags, t.namespace, "app=icetester", v1.DefaultICETesterPort,
 		t.logger.NewLogger("auth-fwd"))
 	if err != nil {
 		return t.sendEventComplete(EventInstallationComplete,
@@ -315,7 +316,7 @@ func (t *iceTester) Start(ctx context.Context) error {
 	}
 
 	log.Info("Searching for CDS server")
-	cdsPod, err := cdsclient.DiscoverK8sCDSServer(ctx, t.k8sConfigFlags, t.cdsConfigFlags,
+	cdsPod, err := k8sclient.DiscoverK8sCDSServer(ctx, t.k8sConfigFlags, t.cdsConfigFlags,
 		t.logger.NewLogger("cds-fwd"))
 	if err != nil {
 		return t.sendEventComplete(EventInstallationComplete,
@@ -326,7 +327,7 @@ func (t *iceTester) Start(ctx context.Context) error {
 	}
 
 	log.Info("Searching for authentication service")
-	authPod, err := cdsclient.DiscoverK8sAuthServer(ctx, t.k8sConfigFlags, t.authConfigFlags,
+	authPod, err := k8sclient.DiscoverK8sAuthServer(ctx, t.k8sConfigFlags, t.authConfigFlags,
 		t.logger.NewLogger("auth-fwd"))
 	if err != nil {
 		return t.sendEventComplete(EventInstallationComplete,
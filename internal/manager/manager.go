@@ -4,6 +4,7 @@ import (
 	// "fmt"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/pion/logging"
 
@@ -25,6 +26,8 @@ type Manager interface {
 	FinishReconciliation(state *ReconciliationState) error
 	// Keys returns the names iof all objects in the store in alphabetical order, suitable for iteration
 	Keys() []string
+	// Meta returns the reconciliation metadata of a named object, or nil if not found
+	Meta(name string) *stnrv1.ObjectMeta
 }
 
 // locks avoid races during reconcile: auth/perm handlers may call into the manager from separate threads
@@ -32,6 +35,7 @@ type managerImpl struct {
 	name    string
 	lock    sync.RWMutex
 	objects map[string]object.Object
+	meta    map[string]stnrv1.ObjectMeta
 	factory object.Factory
 	log     logging.LeveledLogger
 }
@@ -41,6 +45,7 @@ func NewManager(name string, f object.Factory, logger logging.LoggerFactory) Man
 	return &managerImpl{
 		name:    name,
 		objects: make(map[string]object.Object),
+		meta:    make(map[string]stnrv1.ObjectMeta),
 		factory: f,
 		log:     logger.NewLogger(name),
 	}
@@ -80,6 +85,7 @@ func (m *managerImpl) Delete(o object.Object) error {
 	defer m.lock.Unlock()
 
 	delete(m.objects, o.ObjectName())
+	delete(m.meta, o.ObjectName())
 
 	return o.Close()
 }
@@ -88,10 +94,9 @@ func (m *managerImpl) Delete(o object.Object) error {
 func (m *managerImpl) Keys() []string {
 	// m.log.Tracef("object keys")
 
+	m.lock.RLock()
 	names := make([]string, len(m.objects))
 	i := 0
-
-	m.lock.RLock()
 	for k := range m.objects {
 		names[i] = k
 		i += 1
@@ -101,3 +106,31 @@ func (m *managerImpl) Keys() []string {
 	sort.Strings(names)
 	return names
 }
+
+func (m *managerImpl) Meta(name string) *stnrv1.ObjectMeta {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	meta, found := m.meta[name]
+	if !found {
+		return nil
+	}
+	return &meta
+}
+
+// touch updates the reconciliation metadata of an object: created=true marks the object as
+// (re)created.
+func (m *managerImpl) touch(name string, generation int64, created bool) {
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	meta := m.meta[name]
+	meta.Generation = generation
+	meta.Updated = now
+	if created || meta.Created.IsZero() {
+		meta.Created = now
+	}
+	m.meta[name] = meta
+}
@@ -15,6 +15,8 @@ type ReconcileJob struct {
 type ReconciliationState struct {
 	NewJobQueue, ChangedJobQueue, DeletedJobQueue []ReconcileJob
 	ToBeStarted, ToBeRestarted                    []object.Object
+	// Generation is the config generation recorded for the created and updated objects.
+	Generation int64
 }
 
 // PrepareReconciliation prepares the reconciliation of the objects handled by the manager and returns a
@@ -104,6 +106,7 @@ func (m *managerImpl) FinishReconciliation(state *ReconciliationState) error {
 		}
 		// ignore errors
 		_ = m.Upsert(o)
+		m.touch(o.ObjectName(), state.Generation, true)
 	}
 
 	m.log.Trace("running the deletion job queue")
@@ -126,6 +129,7 @@ func (m *managerImpl) FinishReconciliation(state *ReconciliationState) error {
 		if err != nil && err != object.ErrRestartRequired {
 			return err
 		}
+		m.touch(o.ObjectName(), state.Generation, isRestarted(state, o))
 	}
 
 	m.log.Debugf("reconciliation ready: to-be-created: %d, changed: %d, deleted: %d",
@@ -143,3 +147,13 @@ func findConfByName(confs []stnrv1.Config, name string) bool {
 
 	return false
 }
+
+func isRestarted(state *ReconciliationState, o object.Object) bool {
+	for _, r := range state.ToBeRestarted {
+		if r == o {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,7 +2,7 @@ package object
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net"
@@ -11,10 +11,14 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pion/logging"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/l7mp/stunner/internal/geoip"
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	licensecfg "github.com/l7mp/stunner/pkg/config/license"
 )
@@ -26,18 +30,37 @@ type Admin struct {
 	Name, LogLevel                       string
 	DryRun                               bool
 	MetricsEndpoint, HealthCheckEndpoint string
+	AdminEndpoint                        string
 	metricsServer, healthCheckServer     *http.Server
-	health                               *http.ServeMux
+	adminServer                          *http.Server
+	health, api                          http.Handler
+	adminToken                           atomic.Pointer[string]
 	quota                                int
 	offload                              stnrv1.OffloadMode
 	offloadIntfs                         []string
 	LicenseManager                       licensecfg.ConfigManager
 	licenseConfig                        *stnrv1.LicenseConfig
+	geoIPFile                            string
+	geoIP                                *geoip.Reader
+	geoIPLock                            sync.RWMutex
+	requireFingerprint, requireIntegrity atomic.Bool
+	reconcileDebounce                    time.Duration
+	metricsDisabledLabels                []string
+	metricsLabelLimit                    int
+	gcPercent, gcMemoryLimit, gcBallast  int
+	errorReasons                         map[string]string
+	selfCheckInterval                    time.Duration
+	selfCheckListener                    string
+	watchdogTimeout                      time.Duration
+	configId                             atomic.Pointer[string]
+	managedBy, ownershipPolicy           string
 	log                                  logging.LeveledLogger
 }
 
-// NewAdmin creates a new Admin object.
-func NewAdmin(conf stnrv1.Config, dryRun bool, rc ReadinessHandler, status StatusHandler, logger logging.LoggerFactory) (Object, error) {
+// NewAdmin creates a new Admin object. The health-check server serves the health handler and the
+// admin API server serves the api handler, the latter only to clients that present the admin
+// token.
+func NewAdmin(conf stnrv1.Config, dryRun bool, health, api http.Handler, logger logging.LoggerFactory) (Object, error) {
 	req, ok := conf.(*stnrv1.AdminConfig)
 	if !ok {
 		return nil, stnrv1.ErrInvalidConf
@@ -45,48 +68,14 @@ func NewAdmin(conf stnrv1.Config, dryRun bool, rc ReadinessHandler, status Statu
 
 	admin := Admin{
 		DryRun:         dryRun,
-		health:         http.NewServeMux(),
+		health:         health,
+		api:            api,
 		LicenseManager: licensecfg.New(logger.NewLogger("license")),
 		offload:        stnrv1.OffloadEngineNone,
 		log:            logger.NewLogger("admin"),
 	}
 	admin.log.Tracef("NewAdmin: %s", req.String())
 
-	// health checker
-	// liveness probe always succeeds once we got here
-	admin.health.HandleFunc("/live", func(w http.ResponseWriter, req *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("{}\n")) //nolint:errcheck
-	})
-
-	// readniness checker calls the checker from the factory
-	admin.health.HandleFunc("/ready", func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if err := rc(); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, "{\"status\":%d,\"message\":\"%s\"}\n", //nolint:errcheck
-				http.StatusServiceUnavailable, err.Error())
-		} else {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, "{\"status\":%d,\"message\":\"%s\"}\n", //nolint:errcheck
-				http.StatusOK, "READY")
-		}
-	})
-
-	// status handler returns the status
-	admin.health.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if js, err := json.Marshal(status()); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "{\"status\":%d,\"message\":\"%s\"}\n", //nolint:errcheck
-				http.StatusInternalServerError, err.Error())
-		} else {
-			w.WriteHeader(http.StatusOK)
-			w.Write(js) //nolint:errcheck
-		}
-	})
-
 	if err := admin.Reconcile(req); err != nil && !errors.Is(err, ErrRestartRequired) {
 		return nil, err
 	}
@@ -147,7 +136,25 @@ func (a *Admin) Reconcile(conf stnrv1.Config) error {
 		return err
 	}
 
+	// admin API server reconciliation errors are NOT FATAL: the datapath is not affected
+	if err := a.reconcileAdminAPI(req); err != nil {
+		a.log.Warnf("error reconciling admin API server: %s", err.Error())
+	}
+
 	a.quota = req.UserQuota
+	a.requireFingerprint.Store(req.RequireFingerprint)
+	a.requireIntegrity.Store(req.RequireMessageIntegrity)
+	a.reconcileDebounce = time.Duration(req.ReconcileDebounce) * time.Second
+	a.metricsDisabledLabels = req.MetricsDisabledLabels
+	a.metricsLabelLimit = req.MetricsLabelLimit
+	a.gcPercent, a.gcMemoryLimit, a.gcBallast = req.GCPercent, req.GCMemoryLimit, req.GCBallast
+	a.errorReasons = req.ErrorReasons
+	a.selfCheckInterval = time.Duration(req.SelfCheckInterval) * time.Second
+	a.selfCheckListener = req.SelfCheckListener
+	a.watchdogTimeout = time.Duration(req.WatchdogTimeout) * time.Second
+	configId := req.ConfigId
+	a.configId.Store(&configId)
+	a.managedBy, a.ownershipPolicy = req.ManagedBy, req.OwnershipPolicy
 
 	a.offload, _ = stnrv1.NewOffloadEngine(req.OffloadEngine)
 	a.offloadIntfs = req.OffloadInterfaces
@@ -155,6 +162,11 @@ func (a *Admin) Reconcile(conf stnrv1.Config) error {
 	a.LicenseManager.Reconcile(req.LicenseConfig)
 	a.licenseConfig = req.LicenseConfig
 
+	// GeoIP database errors are NOT FATAL: we just run without geolocation
+	if err := a.reconcileGeoIP(req); err != nil {
+		a.log.Warnf("error loading GeoIP database: %s", err.Error())
+	}
+
 	return nil
 }
 
@@ -177,14 +189,32 @@ func (a *Admin) GetConfig() stnrv1.Config {
 	h := a.HealthCheckEndpoint
 
 	return &stnrv1.AdminConfig{
-		Name:                a.Name,
-		LogLevel:            a.LogLevel,
-		MetricsEndpoint:     a.MetricsEndpoint,
-		HealthCheckEndpoint: &h,
-		UserQuota:           a.quota,
-		OffloadEngine:       a.offload.String(),
-		OffloadInterfaces:   a.offloadIntfs,
-		LicenseConfig:       a.licenseConfig,
+		Name:                    a.Name,
+		LogLevel:                a.LogLevel,
+		MetricsEndpoint:         a.MetricsEndpoint,
+		MetricsDisabledLabels:   a.metricsDisabledLabels,
+		MetricsLabelLimit:       a.metricsLabelLimit,
+		HealthCheckEndpoint:     &h,
+		AdminEndpoint:           a.AdminEndpoint,
+		AdminToken:              a.getAdminToken(),
+		UserQuota:               a.quota,
+		OffloadEngine:           a.offload.String(),
+		OffloadInterfaces:       a.offloadIntfs,
+		LicenseConfig:           a.licenseConfig,
+		GeoIPDatabase:           a.geoIPFile,
+		RequireFingerprint:      a.requireFingerprint.Load(),
+		RequireMessageIntegrity: a.requireIntegrity.Load(),
+		ReconcileDebounce:       int(a.reconcileDebounce / time.Second),
+		GCPercent:               a.gcPercent,
+		GCMemoryLimit:           a.gcMemoryLimit,
+		GCBallast:               a.gcBallast,
+		SelfCheckInterval:       int(a.selfCheckInterval / time.Second),
+		SelfCheckListener:       a.selfCheckListener,
+		WatchdogTimeout:         int(a.watchdogTimeout / time.Second),
+		ErrorReasons:            a.errorReasons,
+		ConfigId:                a.GetConfigId(),
+		ManagedBy:               a.managedBy,
+		OwnershipPolicy:         a.ownershipPolicy,
 	}
 }
 
@@ -200,6 +230,13 @@ func (a *Admin) Close() error {
 		}
 	}
 
+	if a.adminServer != nil {
+		if err := a.adminServer.Close(); err != nil {
+			a.log.Debugf("error closing admin API server http://%s: %s",
+				getAdminAddr(a.AdminEndpoint), err.Error())
+		}
+	}
+
 	if a.metricsServer != nil {
 		if err := a.metricsServer.Close(); err != nil {
 			mAddr, mPath := getMetricsAddr(a.MetricsEndpoint)
@@ -208,9 +245,111 @@ func (a *Admin) Close() error {
 		}
 	}
 
+	a.geoIPLock.Lock()
+	if a.geoIP != nil {
+		a.geoIP.Close() //nolint:errcheck
+		a.geoIP = nil
+	}
+	a.geoIPLock.Unlock()
+
 	return nil
 }
 
+// CloseServers closes the metrics, the health-check and the admin API servers, e.g., to let a new
+// process take over their ports in a hitless upgrade. Returns a function that restarts the
+// servers.
+func (a *Admin) CloseServers() func() error {
+	a.log.Tracef("CloseServers")
+
+	conf := a.GetConfig().(*stnrv1.AdminConfig)
+	for _, srv := range []*http.Server{a.metricsServer, a.healthCheckServer, a.adminServer} {
+		if srv != nil {
+			srv.Close() //nolint:errcheck
+		}
+	}
+	a.metricsServer, a.healthCheckServer, a.adminServer = nil, nil, nil
+	a.MetricsEndpoint, a.HealthCheckEndpoint, a.AdminEndpoint = "", "", ""
+
+	return func() error {
+		if err := a.reconcileMetrics(conf); err != nil {
+			a.log.Warnf("error restarting metrics server: %s", err.Error())
+		}
+		if err := a.reconcileAdminAPI(conf); err != nil {
+			a.log.Warnf("error restarting admin API server: %s", err.Error())
+		}
+		return a.reconcileHealthCheck(conf)
+	}
+}
+
+// HasGeoIP returns true if geolocation is enabled.
+func (a *Admin) HasGeoIP() bool {
+	a.geoIPLock.RLock()
+	defer a.geoIPLock.RUnlock()
+	return a.geoIP != nil
+}
+
+// LookupCountry returns the ISO 3166-1 alpha-2 country code for an IP address (empty string if
+// unknown) and a flag that is false if geolocation is disabled.
+func (a *Admin) LookupCountry(ip net.IP) (string, bool) {
+	a.geoIPLock.RLock()
+	defer a.geoIPLock.RUnlock()
+
+	if a.geoIP == nil {
+		return geoip.UnknownCountry, false
+	}
+
+	return a.geoIP.Country(ip), true
+}
+
+// GetStrictMode returns whether STUN requests must carry a FINGERPRINT and a MESSAGE-INTEGRITY
+// attribute, respectively.
+func (a *Admin) GetStrictMode() (bool, bool) {
+	return a.requireFingerprint.Load(), a.requireIntegrity.Load()
+}
+
+// GetReconcileDebounce returns the minimum time between two consecutive reconciliations.
+func (a *Admin) GetReconcileDebounce() time.Duration {
+	return a.reconcileDebounce
+}
+
+// GetMetricsLabelPolicy returns the labels to be removed from the metrics and the maximum number
+// of distinct values exported for each label.
+func (a *Admin) GetMetricsLabelPolicy() ([]string, int) {
+	return a.metricsDisabledLabels, a.metricsLabelLimit
+}
+
+// GetGCSettings returns the garbage collection target percentage, the soft memory limit in MiB
+// and the size of the memory ballast in MiB.
+func (a *Admin) GetGCSettings() (int, int, int) {
+	return a.gcPercent, a.gcMemoryLimit, a.gcBallast
+}
+
+// GetSelfCheck returns the period of the dataplane self-check and the name of the listener to
+// check.
+func (a *Admin) GetSelfCheck() (time.Duration, string) {
+	return a.selfCheckInterval, a.selfCheckListener
+}
+
+// GetWatchdogTimeout returns the time after which a wedged listener is restarted by the watchdog,
+// or zero if the watchdog is disabled.
+func (a *Admin) GetWatchdogTimeout() time.Duration {
+	return a.watchdogTimeout
+}
+
+// GetErrorReasons returns the custom reason phrase templates of the error responses, keyed by
+// error code.
+func (a *Admin) GetErrorReasons() map[string]string {
+	return a.errorReasons
+}
+
+// GetConfigId returns the opaque identifier of the running config.
+func (a *Admin) GetConfigId() string {
+	if id := a.configId.Load(); id != nil {
+		return *id
+	}
+	return ""
+}
+
 // Status returns the status of the object.
 func (a *Admin) Status() stnrv1.Status {
 	adminConf := a.GetConfig().(*stnrv1.AdminConfig)
@@ -226,6 +365,7 @@ func (a *Admin) Status() stnrv1.Status {
 		UserQuota:           fmt.Sprintf("%d", a.quota),
 		OffloadStatus:       fmt.Sprintf("%s[%s]", adminConf.OffloadEngine, intfs),
 		LicensingInfo:       a.LicenseManager.Status(),
+		ConfigId:            a.GetConfigId(),
 	}
 	return &s
 }
@@ -360,17 +500,137 @@ end:
 	return nil
 }
 
+// req MUST be validated!
+func (a *Admin) reconcileAdminAPI(req *stnrv1.AdminConfig) error {
+	a.log.Trace("reconcileAdminAPI")
+
+	// the token can be rotated without restarting the server
+	token := req.AdminToken
+	a.adminToken.Store(&token)
+
+	if a.DryRun {
+		goto end
+	}
+
+	// close if: running and new endpoint is empty or differs from the old one
+	if a.adminServer != nil && req.AdminEndpoint != a.AdminEndpoint {
+		aEndpoint := fmt.Sprintf("http://%s", getAdminAddr(a.AdminEndpoint))
+
+		a.log.Tracef("closing admin API server at %s", aEndpoint)
+
+		if err := a.adminServer.Close(); err != nil {
+			return fmt.Errorf("error stopping admin API server at %s: %w",
+				aEndpoint, err)
+		}
+		a.adminServer = nil
+	}
+
+	// start if: new endpoint differs from the old one
+	if req.AdminEndpoint != a.AdminEndpoint && req.AdminEndpoint != "" {
+		aAddr := getAdminAddr(req.AdminEndpoint)
+		aEndpoint := fmt.Sprintf("http://%s", aAddr)
+
+		a.log.Tracef("starting admin API server at %s", aEndpoint)
+
+		// we separate Listen() and Serve(), so that we can return errors from the listener
+		ln, err := net.Listen("tcp", aAddr)
+		if err != nil {
+			// retry with the new endpoint on the next reconciliation
+			a.AdminEndpoint = ""
+			return fmt.Errorf("cannot start admin API server at %s: %w",
+				aEndpoint, err)
+		}
+
+		srv := &http.Server{
+			Addr:    aAddr,
+			Handler: a.authorize(a.api),
+		}
+		a.adminServer = srv
+
+		go func() {
+			if err := srv.Serve(ln); err != nil {
+				if errors.Is(err, http.ErrServerClosed) {
+					a.log.Tracef("admin API server: normal shutdown")
+				} else {
+					a.log.Warnf("admin API server error at %s: %s",
+						aEndpoint, err.Error())
+				}
+			}
+		}()
+	}
+
+end:
+	a.AdminEndpoint = req.AdminEndpoint
+
+	return nil
+}
+
+func (a *Admin) getAdminToken() string {
+	if t := a.adminToken.Load(); t != nil {
+		return *t
+	}
+	return ""
+}
+
+// authorize wraps the handler of the admin API server with bearer token authentication.
+func (a *Admin) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := a.getAdminToken()
+		got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			a.log.Debugf("unauthorized admin API request from %s: %s %s",
+				req.RemoteAddr, req.Method, req.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="stunner"`)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":401,"message":"unauthorized"}` + "\n")) //nolint:errcheck
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+func (a *Admin) reconcileGeoIP(req *stnrv1.AdminConfig) error {
+	a.log.Trace("reconcileGeoIP")
+
+	if req.GeoIPDatabase == a.geoIPFile {
+		return nil
+	}
+
+	var reader *geoip.Reader
+	var err error
+	if req.GeoIPDatabase != "" {
+		a.log.Tracef("loading GeoIP database from %q", req.GeoIPDatabase)
+		reader, err = geoip.Open(req.GeoIPDatabase)
+	}
+
+	a.geoIPLock.Lock()
+	defer a.geoIPLock.Unlock()
+
+	if a.geoIP != nil {
+		a.geoIP.Close() //nolint:errcheck
+	}
+	a.geoIP = reader
+
+	// a database that failed to load is retried on the next reconciliation
+	a.geoIPFile = ""
+	if err == nil {
+		a.geoIPFile = req.GeoIPDatabase
+	}
+
+	return err
+}
+
 // AdminFactory can create now Admin objects
 type AdminFactory struct {
-	dry    bool
-	rc     ReadinessHandler
-	status StatusHandler
-	logger logging.LoggerFactory
+	dry         bool
+	health, api http.Handler
+	logger      logging.LoggerFactory
 }
 
 // NewAdminFactory creates a new factory for Admin objects
-func NewAdminFactory(dryRun bool, rc ReadinessHandler, status StatusHandler, logger logging.LoggerFactory) Factory {
-	return &AdminFactory{dry: dryRun, rc: rc, status: status, logger: logger}
+func NewAdminFactory(dryRun bool, health, api http.Handler, logger logging.LoggerFactory) Factory {
+	return &AdminFactory{dry: dryRun, health: health, api: api, logger: logger}
 }
 
 // New can produce a new Admin object from the given configuration. A nil config will create an
@@ -380,7 +640,7 @@ func (f *AdminFactory) New(conf stnrv1.Config) (Object, error) {
 		return &Admin{}, nil
 	}
 
-	return NewAdmin(conf, f.dry, f.rc, f.status, f.logger)
+	return NewAdmin(conf, f.dry, f.health, f.api, f.logger)
 }
 
 func getHealthAddr(e string) string {
@@ -409,6 +669,33 @@ func getHealthAddr(e string) string {
 	return addr + ":" + port
 }
 
+func getAdminAddr(e string) string {
+	// admin API disabled
+	if e == "" {
+		return ""
+	}
+
+	u, err := url.Parse(e)
+
+	// this should never happen: endpoint is validated
+	if err != nil {
+		return ""
+	}
+
+	// bind to the loopback address unless told otherwise
+	addr := u.Hostname()
+	if addr == "" {
+		addr = "127.0.0.1"
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = strconv.Itoa(stnrv1.DefaultAdminAPIPort)
+	}
+
+	return net.JoinHostPort(addr, port)
+}
+
 func getMetricsAddr(e string) (string, string) {
 	// metric scraping disabled
 	if e == "" {
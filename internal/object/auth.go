@@ -2,18 +2,134 @@ package object
 
 import (
 	// "fmt"
+	"encoding/base64"
 	"errors"
+	"net"
+	"sync"
+	"time"
 
 	"github.com/pion/logging"
 
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
 )
 
 // Auth is the STUNner authenticator
 type Auth struct {
 	Type                              stnrv1.AuthType
 	Realm, Username, Password, Secret string
+	NonceTTL                          time.Duration
+	NonceRenewal                      string
+	OAuth                             *stnrv1.OAuthConfig
+	OAuthKeys                         map[string][]byte // decoded token keys keyed by key ID
+	LDAP                              *stnrv1.LDAPConfig
+	AllowedSources                    []*net.IPNet // source ranges for anonymous clients
+	ldapClient                        *a12n.LDAPClient
+	credentials                       map[string]credential // runtime credentials, keyed by username
+	lastPurge                         time.Time
 	Log                               logging.LeveledLogger
+	lock                              sync.RWMutex // protects the fields read from the datapath
+}
+
+// credential is a username/password pair added at runtime for static authentication.
+type credential struct {
+	password string
+	expiry   time.Time // zero means no expiry
+}
+
+func (c credential) expired(now time.Time) bool {
+	return !c.expiry.IsZero() && now.After(c.expiry)
+}
+
+// AddCredential adds a runtime credential for static authentication, overwriting the existing
+// credential of the user, if any. A nonzero ttl makes the credential expire after the given time.
+func (auth *Auth) AddCredential(username, password string, ttl time.Duration) {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	now := time.Now()
+	if auth.credentials == nil {
+		auth.credentials = map[string]credential{}
+		auth.lastPurge = now
+	}
+	if now.Sub(auth.lastPurge) > time.Minute {
+		for u, c := range auth.credentials {
+			if c.expired(now) {
+				delete(auth.credentials, u)
+			}
+		}
+		auth.lastPurge = now
+	}
+
+	c := credential{password: password}
+	if ttl > 0 {
+		c.expiry = now.Add(ttl)
+	}
+	auth.credentials[username] = c
+}
+
+// RemoveCredential removes a runtime credential. Returns false if no (unexpired) credential
+// exists for the user.
+func (auth *Auth) RemoveCredential(username string) bool {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	c, ok := auth.credentials[username]
+	delete(auth.credentials, username)
+	return ok && !c.expired(time.Now())
+}
+
+// GetCredential returns the password of a runtime credential, if the credential exists and has
+// not expired.
+func (auth *Auth) GetCredential(username string) (string, bool) {
+	auth.lock.RLock()
+	defer auth.lock.RUnlock()
+
+	c, ok := auth.credentials[username]
+	if !ok || c.expired(time.Now()) {
+		return "", false
+	}
+	return c.password, true
+}
+
+// AllowsSource checks whether an anonymous client may connect from the given source address.
+func (auth *Auth) AllowsSource(ip net.IP) bool {
+	auth.lock.RLock()
+	defer auth.lock.RUnlock()
+	for _, n := range auth.AllowedSources {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetNoncePolicy returns the nonce lifetime and the nonce regeneration policy.
+func (auth *Auth) GetNoncePolicy() (time.Duration, string) {
+	auth.lock.RLock()
+	defer auth.lock.RUnlock()
+	return auth.NonceTTL, auth.NonceRenewal
+}
+
+// GetOAuth returns the OAuth config and the token keys, or nil if third-party authorization is
+// not enabled.
+func (auth *Auth) GetOAuth() (*stnrv1.OAuthConfig, map[string][]byte) {
+	auth.lock.RLock()
+	defer auth.lock.RUnlock()
+	if auth.Type != stnrv1.AuthTypeOAuth {
+		return nil, nil
+	}
+	return auth.OAuth, auth.OAuthKeys
+}
+
+// GetLDAPClient returns the LDAP client, or nil if the LDAP credential backend is not enabled.
+func (auth *Auth) GetLDAPClient() *a12n.LDAPClient {
+	auth.lock.RLock()
+	defer auth.lock.RUnlock()
+	if auth.Type != stnrv1.AuthTypeLDAP {
+		return nil
+	}
+	return auth.ldapClient
 }
 
 // NewAuth creates a new authenticator.
@@ -56,16 +172,43 @@ func (auth *Auth) Reconcile(conf stnrv1.Config) error {
 	auth.Log.Debugf("using authentication: %s", atype.String())
 
 	// no error: update
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
 	auth.Type = atype
 	auth.Realm = req.Realm
+	auth.NonceTTL = time.Duration(req.NonceTTL) * time.Second
+	auth.NonceRenewal = req.NonceRenewal
+	auth.AllowedSources = nil
 	switch atype {
 	case stnrv1.AuthTypeNone:
-		// no auth
+		for _, src := range req.AllowedSources {
+			n, _ := stnrv1.ParseSourceRange(src) // validated
+			auth.AllowedSources = append(auth.AllowedSources, n)
+		}
 	case stnrv1.AuthTypeStatic:
 		auth.Username = req.Credentials["username"]
 		auth.Password = req.Credentials["password"]
 	case stnrv1.AuthTypeEphemeral:
 		auth.Secret = req.Credentials["secret"]
+	case stnrv1.AuthTypeOAuth:
+		keys := make(map[string][]byte, len(req.OAuth.Keys))
+		for _, k := range req.OAuth.Keys {
+			keys[k.KeyID], _ = base64.StdEncoding.DecodeString(k.Key) // validated
+		}
+		auth.OAuth, auth.OAuthKeys = req.OAuth.DeepCopy(), keys
+	case stnrv1.AuthTypeLDAP:
+		// reuse the connection pool and the cache unless the LDAP config has changed
+		if auth.ldapClient == nil || auth.LDAP == nil || *auth.LDAP != *req.LDAP {
+			auth.closeLDAP()
+			ldap := *req.LDAP
+			auth.LDAP = &ldap
+			auth.ldapClient = a12n.NewLDAPClient(ldap, auth.Log)
+		}
+	}
+
+	if atype != stnrv1.AuthTypeLDAP {
+		auth.closeLDAP()
 	}
 
 	return nil
@@ -86,18 +229,29 @@ func (a *Auth) ObjectType() string {
 func (auth *Auth) GetConfig() stnrv1.Config {
 	auth.Log.Tracef("GetConfig")
 	r := stnrv1.AuthConfig{
-		Type:        auth.Type.String(),
-		Realm:       auth.Realm,
-		Credentials: make(map[string]string),
+		Type:         auth.Type.String(),
+		Realm:        auth.Realm,
+		Credentials:  make(map[string]string),
+		NonceTTL:     int(auth.NonceTTL / time.Second),
+		NonceRenewal: auth.NonceRenewal,
 	}
 	switch auth.Type {
 	case stnrv1.AuthTypeNone:
-		// no auth
+		for _, n := range auth.AllowedSources {
+			r.AllowedSources = append(r.AllowedSources, n.String())
+		}
 	case stnrv1.AuthTypeStatic:
 		r.Credentials["username"] = auth.Username
 		r.Credentials["password"] = auth.Password
 	case stnrv1.AuthTypeEphemeral:
 		r.Credentials["secret"] = auth.Secret
+	case stnrv1.AuthTypeOAuth:
+		r.OAuth = auth.OAuth.DeepCopy()
+	case stnrv1.AuthTypeLDAP:
+		if auth.LDAP != nil {
+			ldap := *auth.LDAP
+			r.LDAP = &ldap
+		}
 	}
 
 	return &r
@@ -106,12 +260,23 @@ func (auth *Auth) GetConfig() stnrv1.Config {
 // Close closes the authenticator
 func (auth *Auth) Close() error {
 	auth.Log.Tracef("Close")
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	auth.closeLDAP()
 	return nil
 }
 
+// closeLDAP closes the LDAP client, if any. Must be called with the lock held.
+func (auth *Auth) closeLDAP() {
+	if auth.ldapClient != nil {
+		auth.ldapClient.Close()
+		auth.ldapClient, auth.LDAP = nil, nil
+	}
+}
+
 // Status returns the status of the object.
 func (auth *Auth) Status() stnrv1.Status {
-	return auth.GetConfig()
+	return &stnrv1.AuthStatus{AuthConfig: auth.GetConfig().(*stnrv1.AuthConfig)}
 }
 
 // AuthFactory can create now Auth objects
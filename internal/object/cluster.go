@@ -2,13 +2,18 @@ package object
 
 import (
 	"fmt"
+	"maps"
 	"net"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pion/logging"
 
+	"github.com/l7mp/stunner/internal/endpoint"
 	"github.com/l7mp/stunner/internal/resolver"
+	"github.com/l7mp/stunner/internal/schedule"
 	"github.com/l7mp/stunner/internal/util"
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 )
@@ -18,17 +23,39 @@ type Cluster struct {
 	Name      string
 	Type      stnrv1.ClusterType
 	Protocol  stnrv1.ClusterProtocol
-	Endpoints []*util.Endpoint
+	Endpoints []*endpoint.Endpoint
+	Targets   []ClusterTarget // for federated STATIC clusters
 	Domains   []string
 	Resolver  resolver.DnsResolver // for strict DNS
-
+	Consul    resolver.DnsResolver // for Consul
+	EDS       resolver.DnsResolver // for EDS
+
+	upstream atomic.Pointer[stnrv1.ClusterUpstream] // for TURN
+	metadata atomic.Pointer[stnrv1.ClusterMetadata]
+	labels   atomic.Pointer[map[string]string]
+	owner    atomic.Pointer[string]
+	mirror   atomic.Pointer[ClusterMirror]
+	schedule atomic.Pointer[clusterSchedule]
 	getStats OffloadStatsHandler
 	logger   logging.LoggerFactory
 	log      logging.LeveledLogger
 }
 
+// clusterSchedule is the set of active windows of a cluster.
+type clusterSchedule struct {
+	windows  []*schedule.Window
+	location *time.Location
+	timezone string
+}
+
+// ClusterTarget is a set of endpoints in a remote Kubernetes cluster.
+type ClusterTarget struct {
+	Name      string
+	Endpoints []*endpoint.Endpoint
+}
+
 // NewCluster creates a new cluster.
-func NewCluster(conf stnrv1.Config, resolver resolver.DnsResolver, offloadStatsHandler OffloadStatsHandler, logger logging.LoggerFactory) (Object, error) {
+func NewCluster(conf stnrv1.Config, resolver, consul, eds resolver.DnsResolver, offloadStatsHandler OffloadStatsHandler, logger logging.LoggerFactory) (Object, error) {
 	req, ok := conf.(*stnrv1.ClusterConfig)
 	if !ok {
 		return nil, stnrv1.ErrInvalidConf
@@ -41,9 +68,11 @@ func NewCluster(conf stnrv1.Config, resolver resolver.DnsResolver, offloadStatsH
 
 	c := Cluster{
 		Name:      req.Name,
-		Endpoints: []*util.Endpoint{},
+		Endpoints: []*endpoint.Endpoint{},
 		Domains:   []string{},
 		Resolver:  resolver,
+		Consul:    consul,
+		EDS:       eds,
 		getStats:  offloadStatsHandler,
 		logger:    logger,
 		log:       logger.NewLogger(fmt.Sprintf("cluster-%s", req.Name)),
@@ -76,16 +105,58 @@ func (c *Cluster) Reconcile(conf stnrv1.Config) error {
 	}
 
 	c.log.Tracef("Reconcile: %s", req.String())
-	c.Type, _ = stnrv1.NewClusterType(req.Type)
+	t, _ := stnrv1.NewClusterType(req.Type)
+	if t != c.Type {
+		// the domains are registered with the resolver of the old type
+		if r := c.resolver(); r != nil {
+			for _, d := range c.Domains {
+				r.Unregister(d)
+			}
+		}
+		c.Domains = c.Domains[:0]
+	}
+	c.Type = t
 	c.Protocol, _ = stnrv1.NewClusterProtocol(req.Protocol)
 
+	if err := c.reconcileMirror(req.MirrorTo, req.MirrorRateLimit); err != nil {
+		return err
+	}
+
+	if err := c.reconcileSchedule(req.ActiveWindows, req.Timezone); err != nil {
+		return err
+	}
+
+	if req.Upstream != nil {
+		u := *req.Upstream
+		c.upstream.Store(&u)
+	} else {
+		c.upstream.Store(nil)
+	}
+
+	if req.Metadata != nil {
+		m := *req.Metadata
+		c.metadata.Store(&m)
+	} else {
+		c.metadata.Store(nil)
+	}
+
+	if len(req.Labels) > 0 {
+		labels := maps.Clone(req.Labels)
+		c.labels.Store(&labels)
+	} else {
+		c.labels.Store(nil)
+	}
+
+	owner := req.ManagedBy
+	c.owner.Store(&owner)
+
 	switch c.Type {
-	case stnrv1.ClusterTypeStatic:
+	case stnrv1.ClusterTypeStatic, stnrv1.ClusterTypeBlock, stnrv1.ClusterTypeTURN:
 		// remove existing endpoints and start anew
 		c.Endpoints = c.Endpoints[:0]
 		for _, e := range req.Endpoints {
 			// try to parse as a subnet
-			ep, err := util.ParseEndpoint(e)
+			ep, err := endpoint.Parse(e)
 			if err != nil {
 				c.log.Warnf("cluster %q: could not parse endpoint %q ",
 					"(ignoring): %s", c.Name, e, err.Error())
@@ -93,21 +164,34 @@ func (c *Cluster) Reconcile(conf stnrv1.Config) error {
 
 			c.Endpoints = append(c.Endpoints, ep)
 		}
-	case stnrv1.ClusterTypeStrictDNS:
-		// TODO: port-range support for DNS clusters
-		if c.Resolver == nil {
-			return fmt.Errorf("STRICT_DNS cluster %q initialized with no DNS resolver", c.Name)
+
+		c.Targets = c.Targets[:0]
+		for _, t := range req.Targets {
+			target := ClusterTarget{Name: t.Name, Endpoints: []*endpoint.Endpoint{}}
+			for _, e := range t.Endpoints {
+				if ep, err := endpoint.Parse(e); err == nil {
+					target.Endpoints = append(target.Endpoints, ep)
+				}
+			}
+			c.Targets = append(c.Targets, target)
+		}
+	case stnrv1.ClusterTypeStrictDNS, stnrv1.ClusterTypeConsul, stnrv1.ClusterTypeEDS:
+		// TODO: port-range support for DNS, Consul and EDS clusters
+		r := c.resolver()
+		if r == nil {
+			return fmt.Errorf("%s cluster %q initialized with no resolver", c.Type.String(),
+				c.Name)
 		}
 
 		deleted, added := util.Diff(c.Domains, req.Endpoints)
 
 		for _, h := range deleted {
-			c.Resolver.Unregister(h)
+			r.Unregister(h)
 			c.Domains = util.Remove(c.Domains, h)
 		}
 
 		for _, h := range added {
-			if c.Resolver.Register(h) == nil {
+			if r.Register(h) == nil {
 				c.Domains = append(c.Domains, h)
 			}
 		}
@@ -116,6 +200,112 @@ func (c *Cluster) Reconcile(conf stnrv1.Config) error {
 	return nil
 }
 
+// reconcileMirror sets up, updates or removes the traffic mirror of the cluster.
+func (c *Cluster) reconcileMirror(endpoints []string, rateLimit int) error {
+	old := c.mirror.Load()
+	if old != nil && old.matches(endpoints, rateLimit) {
+		return nil
+	}
+
+	var m *ClusterMirror
+	if len(endpoints) > 0 {
+		var err error
+		if m, err = newClusterMirror(endpoints, rateLimit); err != nil {
+			return fmt.Errorf("cluster %q: could not set up traffic mirror: %w", c.Name, err)
+		}
+		c.log.Infof("Mirroring traffic to [%s] at max %d pps", strings.Join(endpoints, ","),
+			rateLimit)
+	}
+
+	if old = c.mirror.Swap(m); old != nil {
+		old.Close() //nolint:errcheck
+	}
+
+	return nil
+}
+
+// reconcileSchedule sets up, updates or removes the active windows of the cluster.
+func (c *Cluster) reconcileSchedule(windows []string, timezone string) error {
+	if len(windows) == 0 {
+		c.schedule.Store(nil)
+		return nil
+	}
+
+	sched := &clusterSchedule{location: time.UTC, timezone: timezone}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("cluster %q: invalid timezone %q: %w", c.Name, timezone, err)
+		}
+		sched.location = loc
+	}
+	for _, spec := range windows {
+		w, err := schedule.Parse(spec)
+		if err != nil {
+			return fmt.Errorf("cluster %q: %w", c.Name, err)
+		}
+		sched.windows = append(sched.windows, w)
+	}
+	c.schedule.Store(sched)
+
+	return nil
+}
+
+// Active reports whether the cluster is within one of its active windows at the given time. A
+// cluster with no active windows is always active.
+func (c *Cluster) Active(t time.Time) bool {
+	sched := c.schedule.Load()
+	if sched == nil {
+		return true
+	}
+	t = t.In(sched.location)
+	for _, w := range sched.windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mirror returns the traffic mirror of the cluster, or nil if mirroring is disabled.
+func (c *Cluster) Mirror() *ClusterMirror {
+	return c.mirror.Load()
+}
+
+// Metadata returns the identity of the Kubernetes Service the cluster was generated from, or nil
+// if unknown.
+func (c *Cluster) Metadata() *stnrv1.ClusterMetadata {
+	return c.metadata.Load()
+}
+
+// Labels returns the labels of the cluster, or nil if the cluster has no labels. The returned map
+// must not be modified.
+func (c *Cluster) Labels() map[string]string {
+	if l := c.labels.Load(); l != nil {
+		return *l
+	}
+	return nil
+}
+
+// Upstream returns the upstream TURN server of a TURN cluster, or nil for other cluster types.
+func (c *Cluster) Upstream() *stnrv1.ClusterUpstream {
+	return c.upstream.Load()
+}
+
+// resolver returns the resolver for the domains of the cluster, or nil for static clusters.
+func (c *Cluster) resolver() resolver.DnsResolver {
+	switch c.Type {
+	case stnrv1.ClusterTypeStrictDNS:
+		return c.Resolver
+	case stnrv1.ClusterTypeConsul:
+		return c.Consul
+	case stnrv1.ClusterTypeEDS:
+		return c.EDS
+	default:
+		return nil
+	}
+}
+
 // ObjectName returns the name of the object.
 func (c *Cluster) ObjectName() string {
 	// singleton!
@@ -135,31 +325,89 @@ func (c *Cluster) GetConfig() stnrv1.Config {
 		Type:     c.Type.String(),
 	}
 
+	if m := c.mirror.Load(); m != nil {
+		conf.MirrorTo = m.endpoints()
+		conf.MirrorRateLimit = m.rateLimit
+	}
+
+	if sched := c.schedule.Load(); sched != nil {
+		conf.ActiveWindows = make([]string, len(sched.windows))
+		for i, w := range sched.windows {
+			conf.ActiveWindows[i] = w.String()
+		}
+		conf.Timezone = sched.timezone
+	}
+
+	if u := c.upstream.Load(); u != nil {
+		upstream := *u
+		conf.Upstream = &upstream
+	}
+
+	if m := c.metadata.Load(); m != nil {
+		metadata := *m
+		conf.Metadata = &metadata
+	}
+
+	if l := c.labels.Load(); l != nil {
+		conf.Labels = maps.Clone(*l)
+	}
+
+	if o := c.owner.Load(); o != nil {
+		conf.ManagedBy = *o
+	}
+
 	switch c.Type {
-	case stnrv1.ClusterTypeStatic:
+	case stnrv1.ClusterTypeStatic, stnrv1.ClusterTypeBlock, stnrv1.ClusterTypeTURN:
 		conf.Endpoints = make([]string, len(c.Endpoints))
 		for i, e := range c.Endpoints {
 			conf.Endpoints[i] = e.String()
 		}
-	case stnrv1.ClusterTypeStrictDNS:
+		for _, t := range c.Targets {
+			target := stnrv1.ClusterTarget{Name: t.Name, Endpoints: make([]string, len(t.Endpoints))}
+			for i, e := range t.Endpoints {
+				target.Endpoints[i] = e.String()
+			}
+			conf.Targets = append(conf.Targets, target)
+		}
+	case stnrv1.ClusterTypeStrictDNS, stnrv1.ClusterTypeConsul, stnrv1.ClusterTypeEDS:
 		conf.Endpoints = make([]string, len(c.Domains))
 		copy(conf.Endpoints, c.Domains)
-		conf.Endpoints = sort.StringSlice(conf.Endpoints)
 	}
+	sort.Strings(conf.Endpoints)
 
 	return &conf
 }
 
+// IsResolved returns true if the initial resolution has completed for all the domains of a
+// STRICT_DNS cluster, all the services of a CONSUL cluster or all the clusters of an EDS cluster.
+// Static clusters are always resolved.
+func (c *Cluster) IsResolved() bool {
+	r := c.resolver()
+	if r == nil {
+		return true
+	}
+	for _, d := range c.Domains {
+		if !r.Resolved(d) {
+			return false
+		}
+	}
+	return true
+}
+
 // Close closes the cluster.
 func (c *Cluster) Close() error {
 	c.log.Trace("closing cluster")
 
+	if m := c.mirror.Swap(nil); m != nil {
+		m.Close() //nolint:errcheck
+	}
+
 	switch c.Type {
-	case stnrv1.ClusterTypeStatic:
+	case stnrv1.ClusterTypeStatic, stnrv1.ClusterTypeBlock, stnrv1.ClusterTypeTURN:
 		// do nothing
-	case stnrv1.ClusterTypeStrictDNS:
+	case stnrv1.ClusterTypeStrictDNS, stnrv1.ClusterTypeConsul, stnrv1.ClusterTypeEDS:
 		for _, d := range c.Domains {
-			c.Resolver.Unregister(d)
+			c.resolver().Unregister(d)
 		}
 	}
 
@@ -174,11 +422,71 @@ func (c *Cluster) Status() stnrv1.Status {
 	}
 }
 
-// Route decides whether a peer IP appears among the permitted endpoints of a cluster.
+// Blocks decides whether a peer IP and port matches one of the endpoints of a BLOCK cluster. If
+// port is zero then port-matching is disabled.
+func (c *Cluster) Blocks(peer net.IP, port int) bool {
+	if c.Type != stnrv1.ClusterTypeBlock {
+		return false
+	}
+	for _, e := range c.Endpoints {
+		if e.Match(peer, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlocksPeer decides whether a BLOCK cluster denies access to all ports of a peer IP, i.e., the IP
+// matches an endpoint with no port range.
+func (c *Cluster) BlocksPeer(peer net.IP) bool {
+	if c.Type != stnrv1.ClusterTypeBlock {
+		return false
+	}
+	for _, e := range c.Endpoints {
+		if _, _, hasPort := e.PortRange(); !hasPort && e.Contains(peer) {
+			return true
+		}
+	}
+	return false
+}
+
+// Route decides whether a peer IP appears among the permitted endpoints of a cluster. BLOCK
+// clusters never route.
 func (c *Cluster) Route(peer net.IP) bool {
 	return c.Match(peer, 0)
 }
 
+// RoutePrefixLen returns the length of the longest prefix among the permitted endpoints of a
+// cluster that contains a peer IP, or -1 if the cluster does not route the peer. Endpoints
+// obtained from the DNS, Consul or the xDS control plane are host addresses with a full-length
+// prefix.
+func (c *Cluster) RoutePrefixLen(peer net.IP) int {
+	best := -1
+	switch c.Type {
+	case stnrv1.ClusterTypeStatic, stnrv1.ClusterTypeTURN:
+		for _, e := range c.Endpoints {
+			if e.Contains(peer) {
+				best = max(best, e.PrefixLen())
+			}
+		}
+		for _, t := range c.Targets {
+			for _, e := range t.Endpoints {
+				if e.Contains(peer) {
+					best = max(best, e.PrefixLen())
+				}
+			}
+		}
+	case stnrv1.ClusterTypeStrictDNS, stnrv1.ClusterTypeConsul, stnrv1.ClusterTypeEDS:
+		if c.Route(peer) {
+			best = 8 * net.IPv6len
+			if peer.To4() != nil {
+				best = 8 * net.IPv4len
+			}
+		}
+	}
+	return best
+}
+
 // Match decides whether a peer IP and port matches one of the permitted endpoints of a cluster. If
 // port is zero then port-matching is disabled.
 func (c *Cluster) Match(peer net.IP, port int) bool {
@@ -186,9 +494,9 @@ func (c *Cluster) Match(peer net.IP, port int) bool {
 		peer.String())
 
 	switch c.Type {
-	case stnrv1.ClusterTypeStatic:
+	case stnrv1.ClusterTypeStatic, stnrv1.ClusterTypeTURN:
 		// endpoints are IPNets
-		c.log.Tracef("route: STATIC cluster with %d endpoints", len(c.Endpoints))
+		c.log.Tracef("route: %s cluster with %d endpoints", c.Type.String(), len(c.Endpoints))
 
 		for _, e := range c.Endpoints {
 			c.log.Tracef("considering endpoint %q", e)
@@ -197,14 +505,24 @@ func (c *Cluster) Match(peer net.IP, port int) bool {
 			}
 		}
 
-	case stnrv1.ClusterTypeStrictDNS:
-		// endpoints are obtained from the DNS
-		c.log.Tracef("route: STRICT_DNS cluster with domains: [%s]", strings.Join(c.Domains, ", "))
+		for _, t := range c.Targets {
+			for _, e := range t.Endpoints {
+				c.log.Tracef("considering endpoint %q of target %q", e, t.Name)
+				if e.Match(peer, port) {
+					return true
+				}
+			}
+		}
+
+	case stnrv1.ClusterTypeStrictDNS, stnrv1.ClusterTypeConsul, stnrv1.ClusterTypeEDS:
+		// endpoints are obtained from the DNS, Consul or the xDS control plane
+		c.log.Tracef("route: %s cluster with domains: [%s]", c.Type.String(),
+			strings.Join(c.Domains, ", "))
 
 		for _, d := range c.Domains {
 			c.log.Tracef("considering domain %q", d)
 
-			hs, err := c.Resolver.Lookup(d)
+			hs, err := c.resolver().Lookup(d)
 			if err != nil {
 				c.log.Infof("could not resolve domain %q: %s", d, err.Error())
 			}
@@ -221,17 +539,33 @@ func (c *Cluster) Match(peer net.IP, port int) bool {
 	return false
 }
 
+// Target returns the name of the remote cluster target a peer IP belongs to, or an empty string if
+// the peer is not in any of the targets of the cluster.
+func (c *Cluster) Target(peer net.IP) string {
+	for _, t := range c.Targets {
+		for _, e := range t.Endpoints {
+			if e.Contains(peer) {
+				return t.Name
+			}
+		}
+	}
+	return ""
+}
+
 // ClusterFactory can create now Cluster objects
 type ClusterFactory struct {
-	resolver            resolver.DnsResolver
+	resolver, consul    resolver.DnsResolver
+	eds                 resolver.DnsResolver
 	offloadStatsHandler OffloadStatsHandler
 	logger              logging.LoggerFactory
 }
 
 // NewClusterFactory creates a new factory for Cluster objects
-func NewClusterFactory(resolver resolver.DnsResolver, offloadStatsHandler OffloadStatsHandler, logger logging.LoggerFactory) Factory {
+func NewClusterFactory(resolver, consul, eds resolver.DnsResolver, offloadStatsHandler OffloadStatsHandler, logger logging.LoggerFactory) Factory {
 	return &ClusterFactory{
 		resolver:            resolver,
+		consul:              consul,
+		eds:                 eds,
 		offloadStatsHandler: offloadStatsHandler,
 		logger:              logger,
 	}
@@ -244,5 +578,5 @@ func (f *ClusterFactory) New(conf stnrv1.Config) (Object, error) {
 		return &Cluster{}, nil
 	}
 
-	return NewCluster(conf, f.resolver, f.offloadStatsHandler, f.logger)
+	return NewCluster(conf, f.resolver, f.consul, f.eds, f.offloadStatsHandler, f.logger)
 }
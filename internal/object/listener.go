@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"maps"
 	"net"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pion/logging"
 	"github.com/pion/transport/v3"
@@ -19,17 +23,59 @@ import (
 // Listener implements a STUNner listener.
 type Listener struct {
 	Name, Realm            string
-	Proto                  stnrv1.ListenerProtocol
+	Labels                 map[string]string
+	ManagedBy              string
+	Proto                  stnrv1.ListenerProtocol   // the first protocol
+	Protos                 []stnrv1.ListenerProtocol // all protocols served by the listener
 	Addr                   net.IP
 	Port, MinPort, MaxPort int
+	RelayPortRanges        []string
 	PublicAddr             string // for GetConfig()
 	PublicPort             int    // for GetConfig()
 	rawAddr                string // net.IP.String() may rewrite the string representation
 	Cert, Key              []byte
-	Conns                  []any // either a set of turn.ListenerConfigs or turn.PacketConnConfigs
-	Server                 *turn.Server
+	Conns                  []any        // either a set of turn.ListenerConfigs or turn.PacketConnConfigs
+	Server                 *turn.Server // use SetServer, IsRunning and AllocationCount
 	Routes                 []string
+	ClientIPQuota          int
+	AllowedCountries       []string
+	DeniedCountries        []string
+	AllowedOrigins         []string
+	OriginRoutes           map[string][]string
+	TarpitDelay            int
+	BindingRateLimit       int
+	BindingRateLimitSilent bool
+	ForwardAddress         string
+	SinglePort             bool
+	ICEUfrag, ICEPassword  string
+	RTPInspection          bool
+	DualStackRelay         bool
+	NAT64Prefix            *net.IPNet
+	MaxSessionDuration     time.Duration
+	ProxyProtocol          bool
+	TrustedProxies         []string
+	TCPKeepalive           time.Duration // negative disables TCP keepalives
+	IdleTimeout            time.Duration
+	SessionTokenTimeout    time.Duration
+	PortReservation        bool
+	RelayPortPins          map[string]string
+	Mobility               bool
+	EgressQueueLength      int
+	EgressDropPolicy       string
+	PacingRate             int
+	MaxDatagramSize        int // -1 means auto-detect
+	PathMTUDiscovery       bool
+	MaxTCPConnections      int
+	AcceptQueueLength      int
+	ChurnThreshold         int
+	ChurnRateLimit         bool
+	CPUAffinity            []int
+	Enabled                *bool // for GetConfig(), nil means enabled
+	NonceTracking          bool  // for Inspect(), true if the nonce lifetime policy is enforced
 	Net                    transport.Net
+	clientAllocs           map[string]int // number of active allocations per client IP
+	allocLock              sync.Mutex
+	lock                   sync.RWMutex // protects the fields read from the datapath
 	getRealm               RealmHandler
 	getStats               OffloadStatsHandler
 	logger                 logging.LoggerFactory
@@ -49,15 +95,16 @@ func NewListener(conf stnrv1.Config, net transport.Net, realmHandler RealmHandle
 	}
 
 	l := Listener{
-		Name:       req.Name,
-		PublicAddr: req.PublicAddr,
-		PublicPort: req.PublicPort,
-		Net:        net,
-		getRealm:   realmHandler,
-		getStats:   offloadStatsHandler,
-		Conns:      []any{},
-		logger:     logger,
-		log:        logger.NewLogger(fmt.Sprintf("listener-%s", req.Name)),
+		Name:         req.Name,
+		PublicAddr:   req.PublicAddr,
+		PublicPort:   req.PublicPort,
+		Net:          net,
+		getRealm:     realmHandler,
+		getStats:     offloadStatsHandler,
+		Conns:        []any{},
+		clientAllocs: map[string]int{},
+		logger:       logger,
+		log:          logger.NewLogger(fmt.Sprintf("listener-%s", req.Name)),
 	}
 
 	l.log.Tracef("NewListener: %s", req.String())
@@ -84,24 +131,41 @@ func (l *Listener) Inspect(old, new, full stnrv1.Config) (bool, error) {
 
 	changed := !old.DeepEqual(req)
 
-	proto, _ := stnrv1.NewListenerProtocol(req.Protocol)
 	cert, err := base64.StdEncoding.DecodeString(req.Cert)
 	if err != nil {
-		return false, fmt.Errorf("invalid TLS certificate: base64-decode error: %w", err)
+		return false, stnrv1.ErrInvalidListener{Name: req.Name,
+			Reason: fmt.Sprintf("invalid TLS certificate: base64-decode error: %s", err)}
 	}
 	key, err := base64.StdEncoding.DecodeString(req.Key)
 	if err != nil {
-		return false, fmt.Errorf("invalid TLS key: base64-decode error: %w", err)
+		return false, stnrv1.ErrInvalidListener{Name: req.Name,
+			Reason: fmt.Sprintf("invalid TLS key: base64-decode error: %s", err)}
 	}
 
 	// the only chance we don't need a restart if only the Routes and/or PublicIP/PublicPort change
 	restart := ErrRestartRequired
 	if l.Name == req.Name && // name unchanged (should always be true)
-		l.Proto == proto && // protocol unchanged
+		l.Protocol() == req.Protocol && // protocols unchanged
 		l.rawAddr == req.Addr && // address unchanged
 		l.Port == req.Port && // ports unchanged
+		l.MinPort == req.MinRelayPort && l.MaxPort == req.MaxRelayPort && // relay port range unchanged
+		slices.Equal(l.RelayPortRanges, req.RelayPortRanges) && // relay port ranges unchanged
 		bytes.Equal(l.Cert, cert) && // TLS creds unchanged
-		bytes.Equal(l.Key, key) {
+		bytes.Equal(l.Key, key) && // TLS creds unchanged
+		l.ForwardAddress == req.ForwardAddress && // demux forwarder unchanged
+		l.SinglePort == req.SinglePort && // single-port mode unchanged
+		l.ProxyProtocol == req.ProxyProtocol && // PROXY protocol unchanged
+		slices.Equal(l.TrustedProxies, req.ProxyProtocolTrustedProxies) && // trusted proxies unchanged
+		l.TCPKeepalive == time.Duration(req.TCPKeepalive)*time.Second && // keepalive unchanged
+		l.MaxTCPConnections == req.MaxTCPConnections && // connection limit unchanged
+		l.AcceptQueueLength == req.AcceptQueueLength && // accept queue unchanged
+		slices.Equal(l.CPUAffinity, req.CPUAffinity) && // CPU affinity unchanged
+		(l.SessionTokenTimeout > 0) == (req.SessionTokenTimeout > 0) && // session tokens unchanged
+		l.PortReservation == req.PortReservation && // port reservations unchanged
+		maps.Equal(l.RelayPortPins, req.RelayPortPins) && // relay port pins unchanged
+		l.Mobility == req.Mobility && // mobility unchanged
+		l.HasOriginPolicy() == (len(req.AllowedOrigins) > 0 || len(req.OriginRoutes) > 0) && // origin inspection unchanged
+		l.ICEUfrag == req.ICEUfrag && l.ICEPassword == req.ICEPassword { // ICE creds unchanged
 		restart = nil
 	}
 
@@ -112,6 +176,14 @@ func (l *Listener) Inspect(old, new, full stnrv1.Config) (bool, error) {
 		restart = ErrRestartRequired
 	}
 
+	// the nonce lifetime policy is enforced only if set when the listener was started
+	if l.HasProtocol(stnrv1.ListenerProtocolTURNUDP, stnrv1.ListenerProtocolUDP) &&
+		l.NonceTracking != (stunnerConf.Auth.NonceTTL > 0) {
+		l.log.Tracef("listener %s restarts due to changing nonce lifetime policy", l.Name)
+		changed = true
+		restart = ErrRestartRequired
+	}
+
 	return changed, restart
 }
 
@@ -128,28 +200,34 @@ func (l *Listener) Reconcile(conf stnrv1.Config) error {
 		return err
 	}
 
-	proto, _ := stnrv1.NewListenerProtocol(req.Protocol)
+	protos, _ := stnrv1.NewListenerProtocols(req.Protocol)
 	ipAddr := net.ParseIP(req.Addr)
 	// special-case "localhost"
 	if ipAddr == nil && req.Addr == "localhost" {
 		ipAddr = net.ParseIP("127.0.0.1")
 	}
 	if ipAddr == nil {
-		return fmt.Errorf("invalid listener address: %s", req.Addr)
+		return stnrv1.ErrInvalidListener{Name: req.Name,
+			Reason: fmt.Sprintf("invalid listener address: %s", req.Addr)}
 	}
 
-	l.Proto = proto
+	l.Proto, l.Protos = protos[0], protos
 	l.Addr = ipAddr
 	l.rawAddr = req.Addr
 	l.Port = req.Port
-	if proto == stnrv1.ListenerProtocolTURNTLS || proto == stnrv1.ListenerProtocolTURNDTLS {
+	l.MinPort, l.MaxPort = req.MinRelayPort, req.MaxRelayPort
+	l.RelayPortRanges = copyList(req.RelayPortRanges)
+	if l.HasProtocol(stnrv1.ListenerProtocolTURNTLS, stnrv1.ListenerProtocolTURNDTLS,
+		stnrv1.ListenerProtocolTLS, stnrv1.ListenerProtocolDTLS) {
 		cert, err := base64.StdEncoding.DecodeString(req.Cert)
 		if err != nil {
-			return fmt.Errorf("invalid TLS certificate: base64-decode error: %w", err)
+			return stnrv1.ErrInvalidListener{Name: req.Name,
+				Reason: fmt.Sprintf("invalid TLS certificate: base64-decode error: %s", err)}
 		}
 		key, err := base64.StdEncoding.DecodeString(req.Key)
 		if err != nil {
-			return fmt.Errorf("invalid TLS key: base64-decode error: %w", err)
+			return stnrv1.ErrInvalidListener{Name: req.Name,
+				Reason: fmt.Sprintf("invalid TLS key: base64-decode error: %s", err)}
 		}
 		l.Cert = cert
 		l.Key = key
@@ -162,12 +240,99 @@ func (l *Listener) Reconcile(conf stnrv1.Config) error {
 	l.Routes = make([]string, len(req.Routes))
 	copy(l.Routes, req.Routes)
 
+	l.lock.Lock()
+	l.ClientIPQuota = req.ClientIPQuota
+	l.AllowedCountries = copyList(req.AllowedCountries)
+	l.DeniedCountries = copyList(req.DeniedCountries)
+	l.AllowedOrigins = copyList(req.AllowedOrigins)
+	l.OriginRoutes = copyRoutes(req.OriginRoutes)
+	l.TarpitDelay = req.TarpitDelay
+	l.BindingRateLimit = req.BindingRateLimit
+	l.BindingRateLimitSilent = req.BindingRateLimitSilent
+	l.lock.Unlock()
+	l.ForwardAddress = req.ForwardAddress
+	l.SinglePort = req.SinglePort
+	l.ICEUfrag = req.ICEUfrag
+	l.ICEPassword = req.ICEPassword
+	l.RTPInspection = req.RTPInspection
+	l.DualStackRelay = req.DualStackRelay
+	l.MaxSessionDuration = time.Duration(req.MaxSessionDuration) * time.Second
+	l.ProxyProtocol = req.ProxyProtocol
+	l.TrustedProxies = slices.Clone(req.ProxyProtocolTrustedProxies)
+	l.TCPKeepalive = time.Duration(req.TCPKeepalive) * time.Second
+	l.IdleTimeout = time.Duration(req.IdleTimeout) * time.Second
+	l.SessionTokenTimeout = time.Duration(req.SessionTokenTimeout) * time.Second
+	l.PortReservation = req.PortReservation
+	l.RelayPortPins = maps.Clone(req.RelayPortPins)
+	l.Labels = maps.Clone(req.Labels)
+	l.ManagedBy = req.ManagedBy
+	l.Mobility = req.Mobility
+	l.EgressQueueLength = req.EgressQueueLength
+	l.EgressDropPolicy = req.EgressDropPolicy
+	l.PacingRate = req.PacingRate
+	l.MaxDatagramSize = req.MaxDatagramSize
+	l.PathMTUDiscovery = req.PathMTUDiscovery
+	l.MaxTCPConnections = req.MaxTCPConnections
+	l.AcceptQueueLength = req.AcceptQueueLength
+	l.ChurnThreshold = req.ChurnThreshold
+	l.ChurnRateLimit = req.ChurnRateLimit
+	l.CPUAffinity = slices.Clone(req.CPUAffinity)
+	l.Enabled = nil
+	if req.Enabled != nil {
+		enabled := *req.Enabled
+		l.Enabled = &enabled
+	}
+	l.NAT64Prefix = nil
+	if req.NAT64Prefix != "" {
+		_, l.NAT64Prefix, _ = net.ParseCIDR(req.NAT64Prefix) // validated
+	}
+
 	return nil
 }
 
+// Protocol returns the comma-separated list of the protocols served by the listener.
+func (l *Listener) Protocol() string {
+	strs := make([]string, len(l.Protos))
+	for i, p := range l.Protos {
+		strs[i] = p.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// HasProtocol returns true if the listener serves any of the given protocols.
+func (l *Listener) HasProtocol(protos ...stnrv1.ListenerProtocol) bool {
+	for _, proto := range l.Protos {
+		for _, p := range protos {
+			if proto == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetRelayPortRanges returns the relay port ranges of the listener in the order of use.
+func (l *Listener) GetRelayPortRanges() []stnrv1.PortRange {
+	req := stnrv1.ListenerConfig{MinRelayPort: l.MinPort, MaxRelayPort: l.MaxPort,
+		RelayPortRanges: l.RelayPortRanges}
+	return req.GetRelayPortRanges()
+}
+
+// GetTrustedProxies returns the networks of the proxies allowed to send a PROXY protocol header.
+func (l *Listener) GetTrustedProxies() []*net.IPNet {
+	ret := []*net.IPNet{}
+	for _, p := range l.TrustedProxies {
+		// validated already
+		if n, err := stnrv1.ParseSourceRange(p); err == nil {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
 // String returns a short stable string representation of the listener, safe for applying as a key in a map.
 func (l *Listener) String() string {
-	uri := fmt.Sprintf("%s: [%s://%s:%d<%d:%d>]", l.Name, strings.ToLower(l.Proto.String()),
+	uri := fmt.Sprintf("%s: [%s://%s:%d<%d:%d>]", l.Name, strings.ToLower(l.Protocol()),
 		l.Addr, l.Port, l.MinPort, l.MaxPort)
 	return uri
 }
@@ -184,73 +349,264 @@ func (l *Listener) ObjectType() string {
 
 // GetConfig returns the configuration of the running listener.
 func (l *Listener) GetConfig() stnrv1.Config {
-	// must be sorted!
-	sort.Strings(l.Routes)
+	l.lock.RLock()
+	defer l.lock.RUnlock()
 
 	c := &stnrv1.ListenerConfig{
-		Name:       l.Name,
-		Protocol:   l.Proto.String(),
-		Addr:       l.rawAddr,
-		Port:       l.Port,
-		PublicAddr: l.PublicAddr,
-		PublicPort: l.PublicPort,
+		Name:                        l.Name,
+		Protocol:                    l.Protocol(),
+		Addr:                        l.rawAddr,
+		Port:                        l.Port,
+		MinRelayPort:                l.MinPort,
+		MaxRelayPort:                l.MaxPort,
+		RelayPortRanges:             copyList(l.RelayPortRanges),
+		PublicAddr:                  l.PublicAddr,
+		PublicPort:                  l.PublicPort,
+		ClientIPQuota:               l.ClientIPQuota,
+		TarpitDelay:                 l.TarpitDelay,
+		BindingRateLimit:            l.BindingRateLimit,
+		BindingRateLimitSilent:      l.BindingRateLimitSilent,
+		ForwardAddress:              l.ForwardAddress,
+		SinglePort:                  l.SinglePort,
+		ICEUfrag:                    l.ICEUfrag,
+		ICEPassword:                 l.ICEPassword,
+		RTPInspection:               l.RTPInspection,
+		DualStackRelay:              l.DualStackRelay,
+		MaxSessionDuration:          int(l.MaxSessionDuration / time.Second),
+		ProxyProtocol:               l.ProxyProtocol,
+		ProxyProtocolTrustedProxies: slices.Clone(l.TrustedProxies),
+		TCPKeepalive:                int(l.TCPKeepalive / time.Second),
+		IdleTimeout:                 int(l.IdleTimeout / time.Second),
+		SessionTokenTimeout:         int(l.SessionTokenTimeout / time.Second),
+		PortReservation:             l.PortReservation,
+		RelayPortPins:               maps.Clone(l.RelayPortPins),
+		Labels:                      maps.Clone(l.Labels),
+		ManagedBy:                   l.ManagedBy,
+		Mobility:                    l.Mobility,
+		EgressQueueLength:           l.EgressQueueLength,
+		EgressDropPolicy:            l.EgressDropPolicy,
+		PacingRate:                  l.PacingRate,
+		MaxDatagramSize:             l.MaxDatagramSize,
+		PathMTUDiscovery:            l.PathMTUDiscovery,
+		MaxTCPConnections:           l.MaxTCPConnections,
+		AcceptQueueLength:           l.AcceptQueueLength,
+		ChurnThreshold:              l.ChurnThreshold,
+		ChurnRateLimit:              l.ChurnRateLimit,
+		CPUAffinity:                 slices.Clone(l.CPUAffinity),
+	}
+	if l.NAT64Prefix != nil {
+		c.NAT64Prefix = l.NAT64Prefix.String()
+	}
+	if l.Enabled != nil {
+		enabled := *l.Enabled
+		c.Enabled = &enabled
 	}
 
 	c.Cert = string(l.Cert)
 	c.Key = string(l.Key)
 
+	// must be sorted!
 	c.Routes = make([]string, len(l.Routes))
 	copy(c.Routes, l.Routes)
+	sort.Strings(c.Routes)
+
+	c.AllowedCountries = copyList(l.AllowedCountries)
+	c.DeniedCountries = copyList(l.DeniedCountries)
+	c.AllowedOrigins = copyList(l.AllowedOrigins)
+	c.OriginRoutes = copyRoutes(l.OriginRoutes)
 
 	return c
 }
 
 // Close closes the TURN server that belongs to the listener.
 func (l *Listener) Close() error {
-	l.log.Tracef("closing %s listener at %s", l.Proto.String(), l.Addr)
+	l.log.Tracef("closing %s listener at %s", l.Protocol(), l.Addr)
 
 	for _, c := range l.Conns {
-		switch l.Proto {
-		case stnrv1.ListenerProtocolTURNUDP:
-			l.log.Tracef("closing %s packet socket at %s", l.Proto.String(), l.Addr)
-
-			conn, ok := c.(turn.PacketConnConfig)
-			if !ok {
-				return fmt.Errorf("internal error: invalid conversion to " +
-					"turn.PacketConnConfig")
-			}
-
+		switch conn := c.(type) {
+		case turn.PacketConnConfig:
+			l.log.Tracef("closing packet socket at %s", l.Addr)
 			if err := conn.PacketConn.Close(); err != nil && !util.IsClosedErr(err) {
 				return err
 			}
-		case stnrv1.ListenerProtocolTURNTCP, stnrv1.ListenerProtocolTURNTLS, stnrv1.ListenerProtocolTURNDTLS:
-			l.log.Tracef("closing %s listener socket at %s", l.Proto.String(), l.Addr)
-
-			conn, ok := c.(turn.ListenerConfig)
-			if !ok {
-				return fmt.Errorf("internal error: invalid conversion to " +
-					"turn.ListenerConfig")
-			}
-
+		case turn.ListenerConfig:
+			l.log.Tracef("closing listener socket at %s", l.Addr)
 			if err := conn.Listener.Close(); err != nil && !util.IsClosedErr(err) {
 				return err
 			}
 		default:
-			return fmt.Errorf("internal error: unknown listener protocol %q",
-				l.Proto.String())
+			return fmt.Errorf("internal error: invalid listener connection type %T", c)
 		}
 	}
 
 	l.Conns = []any{}
 
-	if l.Server != nil {
-		l.Server.Close() //nolint:errcheck
-	}
+	// the TURN server is closed without the lock: closing waits for the readloops, which may be
+	// blocked on the lock in the datapath
+	l.lock.Lock()
+	server := l.Server
 	l.Server = nil
+	l.lock.Unlock()
+	if server != nil {
+		server.Close() //nolint:errcheck
+	}
+
+	// allocations do not survive a restart
+	l.allocLock.Lock()
+	l.clientAllocs = map[string]int{}
+	l.allocLock.Unlock()
 
 	return nil
 }
 
+// SetServer sets the TURN server that serves the listener.
+func (l *Listener) SetServer(server *turn.Server) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.Server = server
+}
+
+// IsRunning returns true if the listener has a running TURN server.
+func (l *Listener) IsRunning() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.Server != nil
+}
+
+// AllocationCount returns the number of active allocations at the listener.
+func (l *Listener) AllocationCount() int {
+	l.lock.RLock()
+	server := l.Server
+	l.lock.RUnlock()
+	if server == nil {
+		return 0
+	}
+	return server.AllocationCount()
+}
+
+// CheckClientIPQuota returns false if the client at the given address has reached the per-IP
+// allocation quota at the listener.
+func (l *Listener) CheckClientIPQuota(addr net.Addr) bool {
+	quota := l.GetClientIPQuota()
+	if quota <= 0 {
+		return true
+	}
+
+	ip := util.GetIP(addr)
+	if ip == nil {
+		return true
+	}
+
+	l.allocLock.Lock()
+	defer l.allocLock.Unlock()
+
+	return l.clientAllocs[ip.String()] < quota
+}
+
+// GetClientIPQuota returns the per-IP allocation quota of the listener.
+func (l *Listener) GetClientIPQuota() int {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.ClientIPQuota
+}
+
+// GetTarpitDelay returns the tarpit delay of the listener.
+func (l *Listener) GetTarpitDelay() time.Duration {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return time.Duration(l.TarpitDelay) * time.Second
+}
+
+// GetBindingRateLimit returns the Binding request rate limit of the listener and whether requests
+// exceeding the limit should be silently dropped.
+func (l *Listener) GetBindingRateLimit() (int, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.BindingRateLimit, l.BindingRateLimitSilent
+}
+
+// HasCountryFilter returns true if the listener filters clients by country.
+func (l *Listener) HasCountryFilter() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return len(l.AllowedCountries) > 0 || len(l.DeniedCountries) > 0
+}
+
+// CheckCountry returns false if clients from the given country (ISO 3166-1 alpha-2 code, empty if
+// unknown) are not permitted at the listener.
+func (l *Listener) CheckCountry(country string) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if util.Member(l.DeniedCountries, country) {
+		return false
+	}
+
+	if len(l.AllowedCountries) > 0 && !util.Member(l.AllowedCountries, country) {
+		return false
+	}
+
+	return true
+}
+
+// HasOriginPolicy returns true if the listener filters or routes clients by the ORIGIN of their
+// allocations.
+func (l *Listener) HasOriginPolicy() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return len(l.AllowedOrigins) > 0 || len(l.OriginRoutes) > 0
+}
+
+// CheckOrigin returns false if allocations requested with the given normalized origin (empty if
+// none) are not permitted at the listener.
+func (l *Listener) CheckOrigin(origin string) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return len(l.AllowedOrigins) == 0 || util.Member(l.AllowedOrigins, origin)
+}
+
+// OriginRoutesFor returns the routes reachable by the allocations requested with the given
+// normalized origin (empty if none).
+func (l *Listener) OriginRoutesFor(origin string) []string {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if routes, ok := l.OriginRoutes[origin]; ok && origin != "" {
+		return routes
+	}
+	return l.Routes
+}
+
+// AddClientAllocation registers a new allocation from a client address.
+func (l *Listener) AddClientAllocation(addr net.Addr) {
+	ip := util.GetIP(addr)
+	if ip == nil {
+		return
+	}
+
+	l.allocLock.Lock()
+	defer l.allocLock.Unlock()
+
+	l.clientAllocs[ip.String()]++
+}
+
+// DeleteClientAllocation unregisters an allocation from a client address.
+func (l *Listener) DeleteClientAllocation(addr net.Addr) {
+	ip := util.GetIP(addr)
+	if ip == nil {
+		return
+	}
+
+	l.allocLock.Lock()
+	defer l.allocLock.Unlock()
+
+	key := ip.String()
+	if n := l.clientAllocs[key]; n > 1 {
+		l.clientAllocs[key] = n - 1
+	} else {
+		delete(l.clientAllocs, key)
+	}
+}
+
 // Status returns the status of the object.
 func (l *Listener) Status() stnrv1.Status {
 	return &stnrv1.ListenerStatus{
@@ -287,3 +643,24 @@ func (f *ListenerFactory) New(conf stnrv1.Config) (Object, error) {
 
 	return NewListener(conf, f.net, f.realmHandler, f.offloadStatsHandler, f.logger)
 }
+
+// copyList copies a string list, preserving nil.
+func copyList(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	ret := make([]string, len(list))
+	copy(ret, list)
+	return ret
+}
+
+func copyRoutes(routes map[string][]string) map[string][]string {
+	if routes == nil {
+		return nil
+	}
+	ret := make(map[string][]string, len(routes))
+	for k, v := range routes {
+		ret[k] = copyList(v)
+	}
+	return ret
+}
@@ -0,0 +1,83 @@
+package object
+
+import (
+	"hash/fnv"
+	"net"
+	"net/netip"
+	"slices"
+
+	"golang.org/x/time/rate"
+)
+
+// ClusterMirror duplicates the packets relayed to the peers of a cluster toward a set of mirror
+// endpoints, on a best-effort basis and capped at a given packet rate.
+type ClusterMirror struct {
+	addrs     []*net.UDPAddr
+	rateLimit int
+	limiter   *rate.Limiter
+	conn      net.PacketConn
+}
+
+// newClusterMirror creates a mirror to the given UDP endpoints. Mirrored packets are sent from a
+// separate UDP socket bound to an ephemeral port.
+func newClusterMirror(endpoints []string, rateLimit int) (*ClusterMirror, error) {
+	addrs := []*net.UDPAddr{}
+	for _, e := range endpoints {
+		ap, err := netip.ParseAddrPort(e)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, net.UDPAddrFromAddrPort(ap))
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClusterMirror{
+		addrs:     addrs,
+		rateLimit: rateLimit,
+		limiter:   rate.NewLimiter(rate.Limit(rateLimit), rateLimit),
+		conn:      conn,
+	}, nil
+}
+
+// Send sends a copy of a packet relayed to a peer to the mirror endpoint of the peer. Each peer is
+// consistently mirrored to the same endpoint. Returns false if the packet was not mirrored.
+func (m *ClusterMirror) Send(p []byte, peer net.Addr) bool {
+	if !m.limiter.Allow() {
+		return false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(peer.String())) //nolint:errcheck
+	addr := m.addrs[int(h.Sum32()%uint32(len(m.addrs)))]
+
+	_, err := m.conn.WriteTo(p, addr)
+	return err == nil
+}
+
+// matches returns true if the mirror is set up for the given endpoints and rate limit.
+func (m *ClusterMirror) matches(endpoints []string, rateLimit int) bool {
+	if m.rateLimit != rateLimit || len(m.addrs) != len(endpoints) {
+		return false
+	}
+	return slices.EqualFunc(m.addrs, endpoints, func(a *net.UDPAddr, e string) bool {
+		return a.String() == e
+	})
+}
+
+// endpoints returns the mirror endpoints.
+func (m *ClusterMirror) endpoints() []string {
+	ret := make([]string, len(m.addrs))
+	for i, a := range m.addrs {
+		ret[i] = a.String()
+	}
+	return ret
+}
+
+// Close closes the mirror.
+func (m *ClusterMirror) Close() error {
+	return m.conn.Close()
+}
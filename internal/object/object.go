@@ -1,6 +1,11 @@
 package object
 
-import stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+import (
+	"context"
+	"time"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
 
 // Object is the high-level interface for all STUNner objects like listeners, clusters, etc.
 type Object interface {
@@ -29,6 +34,60 @@ type Factory interface {
 // ReadinessHandler is a callback that allows an object to check the readiness of STUNner.
 type ReadinessHandler = func() error
 
+// ListenerReadinessHandler is a callback that allows an object to check the readiness of each
+// listener: the returned map contains a nil error for the listeners that are ready and the reason
+// for the rest.
+type ListenerReadinessHandler = func() map[string]error
+
+// StandbyHandler is a callback that allows an object to promote STUNner from standby mode into
+// active mode (standby=false) or demote it into standby mode (standby=true).
+type StandbyHandler = func(standby bool) error
+
+// TapHandler is a callback that allows an object to enable or disable packet tapping for the
+// sessions selected by a selector ("username" or "client") and a value.
+type TapHandler = func(selector, value string, enable bool) error
+
+// CredentialHandler is a callback that allows an object to add (add=true) or remove (add=false)
+// runtime credentials for static authentication. A nonzero ttl makes the credential expire after
+// the given time.
+type CredentialHandler = func(username, password string, ttl time.Duration, add bool) error
+
+// FaultHandler is a callback that allows an object to set up fault injection: drop the given
+// percentage of the relayed packets, delay relayed packets by the given time and fail every Nth
+// allocation. All zeros disable fault injection.
+type FaultHandler = func(drop int, delay time.Duration, failEvery int) error
+
+// ListenerToggleHandler is a callback that allows an object to administratively disable
+// (disable=true) or enable (disable=false) a listener at runtime. If drain is set then the
+// existing allocations of a disabled listener are closed.
+type ListenerToggleHandler = func(name string, disable, drain bool) error
+
+// ListenerStatsHandler is a callback that allows an object to query the traffic statistics of a
+// listener, or of all listeners selected by the label selector if the name is empty.
+type ListenerStatsHandler = func(name string, selector *stnrv1.LabelSelector) ([]*stnrv1.ListenerStats, error)
+
+// TopTalkersHandler is a callback that allows an object to query the traffic statistics of the n
+// sessions with the highest bandwidth.
+type TopTalkersHandler = func(n int) []*stnrv1.SessionStats
+
+// ClientRTTHandler is a callback that allows an object to query the round-trip time statistics
+// of the client networks.
+type ClientRTTHandler = func() []*stnrv1.ClientRTT
+
+// ScalingMetricsHandler is a callback that allows an object to query the load signals for
+// horizontal autoscaling of a listener, or of all listeners if the name is empty.
+type ScalingMetricsHandler = func(name string) (*stnrv1.ScalingMetrics, error)
+
+// DrainHandler is a callback that allows an object to put STUNner into draining mode
+// (drain=true), blocking until all allocations are gone or the context is done, or to make it
+// leave draining mode (drain=false). Returns the number of the remaining allocations.
+type DrainHandler = func(ctx context.Context, drain bool) int
+
+// DrainEstimateHandler is a callback that allows an object to query the number of the active
+// allocations and the projected drain time of a listener, or of all listeners if the name is
+// empty.
+type DrainEstimateHandler = func(name string) (*stnrv1.DrainEstimate, error)
+
 // RealmHandler is a callback that allows an object to find out the authentication realm.
 type RealmHandler = func() string
 
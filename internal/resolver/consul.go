@@ -0,0 +1,296 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// CONSUL clusters embed a Consul resolver to watch the healthy instances of Consul services in the
+// background. The Consul resolver implements the DnsResolver interface, with service names in
+// place of domain names.
+
+const (
+	// DefaultConsulAddress is the address of the Consul agent used when neither the address
+	// nor the CONSUL_HTTP_ADDR environment variable is set.
+	DefaultConsulAddress = "http://127.0.0.1:8500"
+
+	consulRetryInterval = 5 * time.Second
+	consulWaitTime      = 5 * time.Minute
+)
+
+type consulEntry struct {
+	lock     sync.RWMutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	refCount int
+	service  string
+	index    uint64
+	addrs    []net.IP
+	resolved atomic.Bool
+}
+
+type consulResolverImpl struct {
+	ctx      context.Context
+	addr     string
+	token    string
+	client   *http.Client
+	register map[string]*consulEntry
+	lock     sync.RWMutex
+	log      logging.LeveledLogger
+}
+
+// NewConsulResolver creates a new resolver that watches the healthy instances of Consul services
+// via the HTTP API of the Consul agent at the given address. If the address is empty, the address
+// is taken from the CONSUL_HTTP_ADDR environment variable, falling back to
+// DefaultConsulAddress. The ACL token, if any, is taken from the CONSUL_HTTP_TOKEN environment
+// variable.
+func NewConsulResolver(name, addr string, logger logging.LoggerFactory) DnsResolver {
+	log := logger.NewLogger(name)
+	log.Tracef("NewConsulResolver")
+
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = DefaultConsulAddress
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &consulResolverImpl{
+		ctx:   context.Background(),
+		addr:  strings.TrimSuffix(addr, "/"),
+		token: os.Getenv("CONSUL_HTTP_TOKEN"),
+		// Consul may hold blocking queries for a bit longer than the wait time
+		client:   &http.Client{Timeout: 2 * consulWaitTime},
+		register: make(map[string]*consulEntry),
+		log:      log,
+	}
+}
+
+// Register adds a service name to the resolver for background watching.
+func (r *consulResolverImpl) Register(service string) error {
+	r.log.Tracef("Register: %q", service)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, found := r.register[service]
+	if found {
+		e.refCount += 1
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	e = &consulEntry{
+		ctx:      ctx,
+		cancel:   cancel,
+		refCount: 1,
+		service:  service,
+		addrs:    []net.IP{},
+	}
+	r.register[service] = e
+
+	r.log.Debugf("Starting watcher thread for Consul service %q", service)
+	go r.watch(e)
+
+	return nil
+}
+
+// the watcher goroutine: Consul blocking queries return as soon as the set of healthy service
+// instances changes
+func (r *consulResolverImpl) watch(e *consulEntry) {
+	r.log.Infof("Watcher thread starting for Consul service %q at %s", e.service, r.addr)
+
+	for {
+		err := r.query(e)
+		if err != nil {
+			r.log.Debugf("Resolution failed for Consul service %q: %s", e.service,
+				err.Error())
+		}
+		if !e.resolved.Load() {
+			e.resolved.Store(true)
+			r.log.Tracef("Initial resolution ready for Consul service %q, found %d "+
+				"endpoints", e.service, len(e.addrs))
+		}
+
+		// back off on errors, otherwise the next blocking query waits for changes
+		wait := time.Duration(0)
+		if err != nil {
+			wait = consulRetryInterval
+		}
+		select {
+		case <-e.ctx.Done():
+			r.log.Debugf("Watcher thread exiting for Consul service %q", e.service)
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// consulServiceEntry is the subset of the fields of a Consul health API response we need.
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+	} `json:"Service"`
+}
+
+// do the heavy lifting: query the healthy instances of the service, blocking until the result
+// changes if a previous query has already returned
+func (r *consulResolverImpl) query(e *consulEntry) error {
+	q := url.Values{}
+	q.Set("passing", "true")
+	if e.index > 0 {
+		q.Set("index", strconv.FormatUint(e.index, 10))
+		q.Set("wait", consulWaitTime.String())
+	}
+	u := fmt.Sprintf("%s/v1/health/service/%s?%s", r.addr, url.PathEscape(e.service), q.Encode())
+
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if r.token != "" {
+		req.Header.Set("X-Consul-Token", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query Consul service %q: %w", e.service, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to query Consul service %q: HTTP status %s", e.service,
+			resp.Status)
+	}
+
+	entries := []consulServiceEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("invalid Consul response for service %q: %w", e.service, err)
+	}
+
+	// the index must only grow: reset the watch if it goes backwards
+	index, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil || index < e.index {
+		index = 0
+	}
+
+	addrs := []net.IP{}
+	for _, s := range entries {
+		addr := s.Service.Address
+		if addr == "" {
+			addr = s.Node.Address
+		}
+		if ip := net.ParseIP(addr); ip != nil {
+			addrs = append(addrs, ip)
+		}
+	}
+
+	// for writing
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.index = index
+	e.addrs = addrs
+
+	return nil
+}
+
+// Unregister removes a service name from the resolver.
+func (r *consulResolverImpl) Unregister(service string) {
+	r.log.Tracef("Unregister: %q", service)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, found := r.register[service]
+	if !found {
+		r.log.Tracef("trying to unregister watcher for unknown Consul service: %q", service)
+		return
+	}
+
+	e.refCount -= 1
+	if e.refCount == 0 {
+		e.cancel()
+		delete(r.register, service)
+	}
+
+	r.log.Infof("Consul service %q successfully unregistered", service)
+}
+
+// Lookup returns the addresses of the healthy instances of a service.
+func (r *consulResolverImpl) Lookup(service string) ([]net.IP, error) {
+	r.log.Tracef("Lookup Consul service: %q", service)
+
+	r.lock.RLock()
+	e, found := r.register[service]
+	r.lock.RUnlock()
+	if !found {
+		return []net.IP{}, fmt.Errorf("unknown Consul service: %q", service)
+	}
+
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	ret := make([]net.IP, len(e.addrs))
+	copy(ret, e.addrs)
+
+	r.log.Tracef("Lookup ready: Consul service %q, endpoints: %d", service, len(ret))
+
+	return ret, nil
+}
+
+// Resolved returns true if the initial resolution of a service has completed.
+func (r *consulResolverImpl) Resolved(service string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, found := r.register[service]
+	if !found {
+		return false
+	}
+	return e.resolved.Load()
+}
+
+// Start sets the context for the watcher threads.
+func (r *consulResolverImpl) Start(ctx context.Context) {
+	r.log.Debugf("Starting")
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ctx = ctx
+}
+
+// Close closes the resolver.
+func (r *consulResolverImpl) Close() {
+	r.lock.Lock()
+	services := make([]string, 0, len(r.register))
+	for s := range r.register {
+		services = append(services, s)
+	}
+	r.lock.Unlock()
+
+	r.log.Debugf("Closing: active services: %d", len(services))
+	if len(services) > 0 {
+		r.log.Warnf("trying to close Consul resolver with %d active services", len(services))
+		for _, s := range services {
+			r.Unregister(s)
+		}
+	}
+}
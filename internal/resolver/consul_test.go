@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+// fakeConsul emulates the health API of a Consul agent with blocking queries
+type fakeConsul struct {
+	index   int
+	addrs   [][2]string // service address, node address
+	update  chan [][2]string
+	queries chan string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.queries <- r.URL.RequestURI()
+	if r.URL.Path != "/v1/health/service/media" || r.Header.Get("X-Consul-Token") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Query().Get("index") == fmt.Sprintf("%d", f.index) {
+		select {
+		case f.addrs = <-f.update:
+			f.index++
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	entries := []map[string]any{}
+	for _, a := range f.addrs {
+		entries = append(entries, map[string]any{
+			"Node":    map[string]any{"Address": a[1]},
+			"Service": map[string]any{"Address": a[0], "Port": 8000},
+		})
+	}
+	w.Header().Set("X-Consul-Index", fmt.Sprintf("%d", f.index))
+	json.NewEncoder(w).Encode(entries) //nolint:errcheck
+}
+
+func TestConsulResolver(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory(resolverTestLoglevel)
+
+	consul := &fakeConsul{
+		index:   1,
+		addrs:   [][2]string{{"1.2.3.4", "10.0.0.1"}},
+		update:  make(chan [][2]string),
+		queries: make(chan string, 10),
+	}
+	srv := httptest.NewServer(consul)
+	defer srv.Close()
+
+	t.Setenv("CONSUL_HTTP_TOKEN", "secret")
+	r := NewConsulResolver("consul-resolver", srv.URL, loggerFactory)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+	defer r.Close()
+
+	_, err := r.Lookup("media")
+	assert.Error(t, err, "lookup unknown service")
+	assert.False(t, r.Resolved("media"), "unknown service not resolved")
+
+	assert.NoError(t, r.Register("media"), "register")
+	assert.Equal(t, "/v1/health/service/media?passing=true", <-consul.queries, "initial query")
+	assert.Eventually(t, func() bool { return r.Resolved("media") }, time.Second,
+		10*time.Millisecond, "initial resolution")
+	ips, err := r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "instances")
+	assert.Equal(t, "1.2.3.4", ips[0].String(), "service address")
+
+	// watch: the blocking query returns on changes, instances without a service address
+	// fall back to the node address
+	assert.Equal(t, "/v1/health/service/media?index=1&passing=true&wait=5m0s", <-consul.queries,
+		"blocking query")
+	consul.update <- [][2]string{{"1.2.3.4", "10.0.0.1"}, {"", "10.0.0.2"}}
+	assert.Eventually(t, func() bool {
+		ips, err := r.Lookup("media")
+		return err == nil && len(ips) == 2 && ips[1].String() == "10.0.0.2"
+	}, time.Second, 10*time.Millisecond, "watch update")
+
+	r.Unregister("media")
+	assert.False(t, r.Resolved("media"), "unregistered")
+
+	// failed queries still complete the initial resolution
+	assert.NoError(t, r.Register("dummy"), "register")
+	assert.Eventually(t, func() bool { return r.Resolved("dummy") }, time.Second,
+		10*time.Millisecond, "initial resolution of unknown service")
+	ips, err = r.Lookup("dummy")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 0, "no instances")
+	r.Unregister("dummy")
+}
@@ -0,0 +1,398 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"golang.org/x/net/http2"
+)
+
+// EDS clusters embed an EDS resolver to receive the endpoints of the cluster from an xDS control
+// plane over the Envoy Endpoint Discovery Service (EDS) protocol. The EDS resolver implements the
+// DnsResolver interface, with EDS cluster names in place of domain names.
+
+// edsRetryInterval is the time to wait before reconnecting to the management server.
+var edsRetryInterval = 5 * time.Second
+
+type edsEntry struct {
+	refCount int
+	addrs    []net.IP
+	resolved bool
+}
+
+type edsResolverImpl struct {
+	ctx      context.Context
+	addr     string
+	nodeID   string
+	client   *http.Client
+	register map[string]*edsEntry
+	update   chan struct{} // signals a change in the set of registered clusters
+	cancel   context.CancelFunc
+	lock     sync.RWMutex
+	log      logging.LeveledLogger
+}
+
+// NewEDSResolver creates a new resolver that subscribes to the endpoints of EDS clusters at the
+// xDS management server at the given address, using the given node id to identify itself to the
+// management server. The address is an URL with an explicit scheme: use "https://host:port" for
+// gRPC over TLS and "http://host:port" for plaintext gRPC. The TLS config, if not nil, sets the
+// CA certificates used to verify the management server and the client certificate presented to
+// the management server for mutual TLS; it can be used with the "https" scheme only.
+func NewEDSResolver(name, addr, nodeID string, tlsConfig *tls.Config, logger logging.LoggerFactory) (DnsResolver, error) {
+	log := logger.NewLogger(name)
+	log.Tracef("NewEDSResolver")
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xDS management server address %q: %w", addr, err)
+	}
+
+	transport := &http2.Transport{}
+	switch u.Scheme {
+	case "https":
+		transport.TLSClientConfig = tlsConfig
+	case "http":
+		if tlsConfig != nil {
+			return nil, fmt.Errorf("invalid xDS management server address %q: TLS requires "+
+				"the https scheme", addr)
+		}
+		// h2c
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	default:
+		return nil, fmt.Errorf("invalid xDS management server address %q: scheme must be "+
+			"http or https", addr)
+	}
+
+	return &edsResolverImpl{
+		ctx:      context.Background(),
+		addr:     strings.TrimSuffix(addr, "/"),
+		nodeID:   nodeID,
+		client:   &http.Client{Transport: transport},
+		register: make(map[string]*edsEntry),
+		update:   make(chan struct{}, 1),
+		log:      log,
+	}, nil
+}
+
+// Register subscribes to the endpoints of an EDS cluster.
+func (r *edsResolverImpl) Register(cluster string) error {
+	r.log.Tracef("Register: %q", cluster)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if e, found := r.register[cluster]; found {
+		e.refCount += 1
+		return nil
+	}
+
+	r.register[cluster] = &edsEntry{refCount: 1, addrs: []net.IP{}}
+
+	if r.cancel == nil {
+		ctx, cancel := context.WithCancel(r.ctx)
+		r.cancel = cancel
+		r.log.Debugf("Starting EDS stream thread")
+		go r.run(ctx)
+	} else {
+		r.notify()
+	}
+
+	return nil
+}
+
+// notify signals the stream thread to update the subscription. Must be called with the lock held.
+func (r *edsResolverImpl) notify() {
+	select {
+	case r.update <- struct{}{}:
+	default:
+	}
+}
+
+// the stream goroutine: reconnects to the management server on errors
+func (r *edsResolverImpl) run(ctx context.Context) {
+	r.log.Infof("EDS stream thread starting for management server %s", r.addr)
+
+	for {
+		err := r.stream(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.log.Debugf("EDS stream thread exiting")
+			return
+		default:
+		}
+
+		r.log.Debugf("EDS stream to %s failed: %s", r.addr, err.Error())
+
+		// do not block readiness while the management server is unreachable
+		r.lock.Lock()
+		for _, e := range r.register {
+			e.resolved = true
+		}
+		r.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			r.log.Debugf("EDS stream thread exiting")
+			return
+		case <-time.After(edsRetryInterval):
+		}
+	}
+}
+
+// names returns the names of the registered clusters.
+func (r *edsResolverImpl) names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.register))
+	for n := range r.register {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// do the heavy lifting: open an EDS stream, subscribe to the registered clusters and process the
+// responses until the stream fails or the context is canceled
+func (r *edsResolverImpl) stream(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the transport does not watch the context while it waits for the request body, so the
+	// pipe is closed on cancellation to make sure the stream is torn down
+	pr, pw := io.Pipe()
+	context.AfterFunc(ctx, func() { pw.Close() }) //nolint:errcheck
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.addr+edsStreamPath, pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	// requests are written by both the ACK logic and the subscription updates
+	var wlock sync.Mutex
+	var version, nonce string
+	send := func(errorDetail string) error {
+		wlock.Lock()
+		defer wlock.Unlock()
+		dr := discoveryRequest{
+			versionInfo:   version,
+			nodeID:        r.nodeID,
+			resourceNames: r.names(),
+			typeURL:       edsTypeURL,
+			responseNonce: nonce,
+			errorDetail:   errorDetail,
+		}
+		return writeGRPCMessage(pw, dr.marshal())
+	}
+
+	// the initial request must be written concurrently with Do, which does not return until
+	// the response headers arrive
+	errCh := make(chan error, 1)
+	go func() {
+		if err := send(""); err != nil {
+			errCh <- err
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.update:
+				if err := send(""); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}
+	}()
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	if s := resp.Header.Get("Grpc-Status"); s != "" && s != "0" {
+		return fmt.Errorf("gRPC status %s: %s", s, resp.Header.Get("Grpc-Message"))
+	}
+
+	r.log.Debugf("EDS stream to %s established", r.addr)
+
+	for {
+		msg, err := readGRPCMessage(resp.Body)
+		if err != nil {
+			select {
+			case err := <-errCh:
+				return err
+			default:
+			}
+			if errors.Is(err, io.EOF) {
+				if s := resp.Trailer.Get("Grpc-Status"); s != "" && s != "0" {
+					return fmt.Errorf("gRPC status %s: %s", s,
+						resp.Trailer.Get("Grpc-Message"))
+				}
+				return errors.New("stream closed by the management server")
+			}
+			return err
+		}
+
+		var dr discoveryResponse
+		errorDetail := ""
+		if err := dr.unmarshal(msg); err != nil {
+			errorDetail = fmt.Sprintf("invalid DiscoveryResponse: %s", err.Error())
+		} else if err := r.apply(&dr); err != nil {
+			errorDetail = err.Error()
+		}
+
+		// ACK, or NACK with the previous version
+		wlock.Lock()
+		if errorDetail == "" {
+			version = dr.versionInfo
+		} else {
+			r.log.Warnf("Rejecting EDS update version %q: %s", dr.versionInfo, errorDetail)
+		}
+		nonce = dr.nonce
+		wlock.Unlock()
+		if err := send(errorDetail); err != nil {
+			return err
+		}
+	}
+}
+
+// apply updates the endpoints of the clusters in a discovery response.
+func (r *edsResolverImpl) apply(dr *discoveryResponse) error {
+	if dr.typeURL != edsTypeURL {
+		return fmt.Errorf("unexpected resource type %q", dr.typeURL)
+	}
+
+	clas := []clusterLoadAssignment{}
+	for _, res := range dr.resources {
+		if res.typeURL != edsTypeURL {
+			return fmt.Errorf("unexpected resource type %q", res.typeURL)
+		}
+		var cla clusterLoadAssignment
+		if err := cla.unmarshal(res.value); err != nil {
+			return fmt.Errorf("invalid ClusterLoadAssignment: %w", err)
+		}
+		clas = append(clas, cla)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, cla := range clas {
+		e, found := r.register[cla.clusterName]
+		if !found {
+			continue
+		}
+		e.addrs = cla.addrs
+		e.resolved = true
+		r.log.Debugf("EDS update for cluster %q: %d endpoints", cla.clusterName, len(cla.addrs))
+	}
+
+	return nil
+}
+
+// Unregister unsubscribes from the endpoints of an EDS cluster.
+func (r *edsResolverImpl) Unregister(cluster string) {
+	r.log.Tracef("Unregister: %q", cluster)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, found := r.register[cluster]
+	if !found {
+		r.log.Tracef("trying to unregister unknown EDS cluster: %q", cluster)
+		return
+	}
+
+	e.refCount -= 1
+	if e.refCount == 0 {
+		delete(r.register, cluster)
+		if len(r.register) == 0 && r.cancel != nil {
+			r.cancel()
+			r.cancel = nil
+		} else {
+			r.notify()
+		}
+	}
+
+	r.log.Infof("EDS cluster %q successfully unregistered", cluster)
+}
+
+// Lookup returns the addresses of the endpoints of an EDS cluster.
+func (r *edsResolverImpl) Lookup(cluster string) ([]net.IP, error) {
+	r.log.Tracef("Lookup EDS cluster: %q", cluster)
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, found := r.register[cluster]
+	if !found {
+		return []net.IP{}, fmt.Errorf("unknown EDS cluster: %q", cluster)
+	}
+
+	ret := make([]net.IP, len(e.addrs))
+	copy(ret, e.addrs)
+
+	r.log.Tracef("Lookup ready: EDS cluster %q, endpoints: %d", cluster, len(ret))
+
+	return ret, nil
+}
+
+// Resolved returns true if the endpoints of an EDS cluster have been received, or the management
+// server could not be reached.
+func (r *edsResolverImpl) Resolved(cluster string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, found := r.register[cluster]
+	if !found {
+		return false
+	}
+	return e.resolved
+}
+
+// Start sets the context for the stream thread.
+func (r *edsResolverImpl) Start(ctx context.Context) {
+	r.log.Debugf("Starting")
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ctx = ctx
+}
+
+// Close closes the resolver.
+func (r *edsResolverImpl) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.log.Debugf("Closing: active clusters: %d", len(r.register))
+	if len(r.register) > 0 {
+		r.log.Warnf("trying to close EDS resolver with %d active clusters", len(r.register))
+		r.register = make(map[string]*edsEntry)
+	}
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
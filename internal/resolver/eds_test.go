@@ -0,0 +1,379 @@
+package resolver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+// fakeXDS emulates an EDS management server: the requests received on the stream are delivered
+// on reqs, the responses to be sent are taken from resps and the stream is closed on drop
+type fakeXDS struct {
+	reqs  chan discoveryRequest
+	resps chan []byte
+	drop  chan struct{}
+}
+
+func newFakeXDS() *fakeXDS {
+	return &fakeXDS{
+		reqs:  make(chan discoveryRequest, 10),
+		resps: make(chan []byte, 10),
+		drop:  make(chan struct{}),
+	}
+}
+
+func (f *fakeXDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != edsStreamPath || r.Header.Get("Content-Type") != "application/grpc" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	go func() {
+		for {
+			msg, err := readGRPCMessage(r.Body)
+			if err != nil {
+				return
+			}
+			f.reqs <- parseDiscoveryRequest(msg)
+		}
+	}()
+
+	for {
+		select {
+		case resp := <-f.resps:
+			writeGRPCMessage(w, resp) //nolint:errcheck
+			w.(http.Flusher).Flush()
+		case <-f.drop:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func parseDiscoveryRequest(b []byte) discoveryRequest {
+	var req discoveryRequest
+	walkMessage(b, func(num protowire.Number, v []byte) error { //nolint:errcheck
+		switch num {
+		case 1:
+			req.versionInfo = string(v)
+		case 2:
+			walkMessage(v, func(num protowire.Number, v []byte) error { //nolint:errcheck
+				if num == 1 {
+					req.nodeID = string(v)
+				}
+				return nil
+			})
+		case 3:
+			req.resourceNames = append(req.resourceNames, string(v))
+		case 4:
+			req.typeURL = string(v)
+		case 5:
+			req.responseNonce = string(v)
+		case 6:
+			req.errorDetail = string(v)
+		}
+		return nil
+	})
+	return req
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// newDiscoveryResponse encodes a DiscoveryResponse with a single ClusterLoadAssignment for the
+// given endpoints and health statuses
+func newDiscoveryResponse(version, nonce, typeURL, cluster string, eps map[string]uint64) []byte {
+	lbEndpoints := []byte{}
+	for addr, health := range eps {
+		sockAddr := appendMessage(nil, 2, []byte(addr))
+		sockAddr = protowire.AppendTag(sockAddr, 3, protowire.VarintType)
+		sockAddr = protowire.AppendVarint(sockAddr, 8000)
+		ep := appendMessage(nil, 1, appendMessage(nil, 1, sockAddr))
+		lbEp := appendMessage(nil, 1, ep)
+		lbEp = protowire.AppendTag(lbEp, 2, protowire.VarintType)
+		lbEp = protowire.AppendVarint(lbEp, health)
+		lbEndpoints = appendMessage(lbEndpoints, 2, lbEp)
+	}
+	cla := appendMessage(nil, 1, []byte(cluster))
+	cla = appendMessage(cla, 2, lbEndpoints)
+
+	res := appendMessage(nil, 1, []byte(typeURL))
+	res = appendMessage(res, 2, cla)
+
+	resp := appendMessage(nil, 1, []byte(version))
+	resp = appendMessage(resp, 2, res)
+	resp = appendMessage(resp, 4, []byte(typeURL))
+	resp = appendMessage(resp, 5, []byte(nonce))
+	return resp
+}
+
+func TestEDSResolver(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory(resolverTestLoglevel)
+
+	xds := newFakeXDS()
+	srv := httptest.NewServer(h2c.NewHandler(xds, &http2.Server{}))
+	defer srv.Close()
+
+	r, err := NewEDSResolver("eds-resolver", srv.URL, "stunnerd-1", nil, loggerFactory)
+	assert.NoError(t, err, "resolver")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+	defer r.Close()
+
+	_, err = r.Lookup("media")
+	assert.Error(t, err, "lookup unknown cluster")
+
+	// subscribe
+	assert.NoError(t, r.Register("media"), "register")
+	req := <-xds.reqs
+	assert.Equal(t, "stunnerd-1", req.nodeID, "node id")
+	assert.Equal(t, []string{"media"}, req.resourceNames, "resource names")
+	assert.Equal(t, edsTypeURL, req.typeURL, "type url")
+	assert.Empty(t, req.responseNonce, "initial request")
+	assert.False(t, r.Resolved("media"), "not resolved")
+
+	// unhealthy endpoints are skipped
+	xds.resps <- newDiscoveryResponse("1", "n1", edsTypeURL, "media", map[string]uint64{
+		"1.2.3.4": healthStatusHealthy, "1.2.3.5": healthStatusUnhealthy,
+	})
+	req = <-xds.reqs
+	assert.Equal(t, "1", req.versionInfo, "ACK version")
+	assert.Equal(t, "n1", req.responseNonce, "ACK nonce")
+	assert.Empty(t, req.errorDetail, "ACK")
+	assert.True(t, r.Resolved("media"), "resolved")
+	ips, err := r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints")
+	assert.Equal(t, "1.2.3.4", ips[0].String(), "endpoint")
+
+	// adding a cluster updates the subscription
+	assert.NoError(t, r.Register("video"), "register")
+	req = <-xds.reqs
+	assert.Equal(t, []string{"media", "video"}, req.resourceNames, "resource names")
+
+	// updates for a subset of the clusters
+	xds.resps <- newDiscoveryResponse("2", "n2", edsTypeURL, "video", map[string]uint64{
+		"1.2.3.6": healthStatusUnknown,
+	})
+	req = <-xds.reqs
+	assert.Equal(t, "2", req.versionInfo, "ACK version")
+	ips, err = r.Lookup("video")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints")
+	ips, err = r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints unchanged")
+
+	// invalid updates are NACKed with the previous version
+	xds.resps <- newDiscoveryResponse("3", "n3", "dummy-type", "media", map[string]uint64{})
+	req = <-xds.reqs
+	assert.Equal(t, "2", req.versionInfo, "NACK version")
+	assert.Equal(t, "n3", req.responseNonce, "NACK nonce")
+	assert.Contains(t, req.errorDetail, "unexpected resource type", "NACK")
+	ips, err = r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints unchanged")
+
+	// malformed updates are NACKed too
+	xds.resps <- []byte{0x0a, 0xff}
+	req = <-xds.reqs
+	assert.Equal(t, "2", req.versionInfo, "NACK version")
+	assert.Empty(t, req.responseNonce, "no nonce")
+	assert.Contains(t, req.errorDetail, "invalid DiscoveryResponse", "NACK")
+
+	// the stream goes on after a NACK
+	xds.resps <- newDiscoveryResponse("4", "n4", edsTypeURL, "media", map[string]uint64{
+		"1.2.3.7": healthStatusHealthy, "1.2.3.8": healthStatusDraining,
+	})
+	req = <-xds.reqs
+	assert.Equal(t, "4", req.versionInfo, "ACK version")
+	assert.Empty(t, req.errorDetail, "ACK")
+	ips, err = r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints")
+	assert.Equal(t, "1.2.3.7", ips[0].String(), "endpoint")
+
+	r.Unregister("video")
+	req = <-xds.reqs
+	assert.Equal(t, []string{"media"}, req.resourceNames, "resource names")
+	r.Unregister("media")
+	assert.False(t, r.Resolved("media"), "unregistered")
+
+	select {
+	case req := <-xds.reqs:
+		t.Errorf("unexpected request after unsubscribe: %v", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEDSResolverAddress(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory(resolverTestLoglevel)
+
+	for _, addr := range []string{"http://xds:18000", "https://xds:18000", "https://xds"} {
+		_, err := NewEDSResolver("eds-resolver", addr, "stunnerd-1", nil, loggerFactory)
+		assert.NoError(t, err, "valid address %q", addr)
+	}
+
+	// the scheme is mandatory
+	for _, addr := range []string{"xds:18000", "127.0.0.1:18000", "grpc://xds:18000", ""} {
+		_, err := NewEDSResolver("eds-resolver", addr, "stunnerd-1", nil, loggerFactory)
+		assert.Error(t, err, "invalid address %q", addr)
+	}
+
+	// TLS requires https
+	_, err := NewEDSResolver("eds-resolver", "http://xds:18000", "stunnerd-1", &tls.Config{},
+		loggerFactory)
+	assert.Error(t, err, "TLS over http")
+}
+
+func TestEDSResolverReconnect(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory(resolverTestLoglevel)
+	edsRetryInterval = 10 * time.Millisecond
+
+	xds := newFakeXDS()
+	srv := httptest.NewServer(h2c.NewHandler(xds, &http2.Server{}))
+	defer srv.Close()
+
+	r, err := NewEDSResolver("eds-resolver", srv.URL, "stunnerd-1", nil, loggerFactory)
+	assert.NoError(t, err, "resolver")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+	defer r.Close()
+
+	assert.NoError(t, r.Register("media"), "register")
+	<-xds.reqs
+	xds.resps <- newDiscoveryResponse("1", "n1", edsTypeURL, "media", map[string]uint64{
+		"1.2.3.4": healthStatusHealthy,
+	})
+	req := <-xds.reqs
+	assert.Equal(t, "1", req.versionInfo, "ACK version")
+
+	// the management server closes the stream: the client resubscribes on a new stream and
+	// keeps the last known endpoints in the meantime
+	xds.drop <- struct{}{}
+	req = <-xds.reqs
+	assert.Equal(t, []string{"media"}, req.resourceNames, "resource names")
+	assert.Empty(t, req.responseNonce, "initial request")
+	ips, err := r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints kept")
+
+	xds.resps <- newDiscoveryResponse("2", "n2", edsTypeURL, "media", map[string]uint64{
+		"1.2.3.5": healthStatusHealthy,
+	})
+	req = <-xds.reqs
+	assert.Equal(t, "2", req.versionInfo, "ACK version")
+	assert.Equal(t, "n2", req.responseNonce, "ACK nonce")
+	ips, err = r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints")
+	assert.Equal(t, "1.2.3.5", ips[0].String(), "endpoint")
+
+	r.Unregister("media")
+}
+
+// newClientCert creates a self-signed client certificate.
+func newClientCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "key")
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "stunnerd-1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err, "certificate")
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err, "parse certificate")
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestEDSResolverMutualTLS(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory(resolverTestLoglevel)
+	edsRetryInterval = 10 * time.Millisecond
+
+	clientCert, clientCA := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+
+	xds := newFakeXDS()
+	srv := httptest.NewUnstartedServer(xds)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(srv.Certificate())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the management server rejects clients without a certificate
+	r, err := NewEDSResolver("eds-resolver", srv.URL, "stunnerd-1",
+		&tls.Config{RootCAs: serverCAs}, loggerFactory)
+	assert.NoError(t, err, "resolver")
+	r.Start(ctx)
+	assert.NoError(t, r.Register("media"), "register")
+	assert.Eventually(t, func() bool { return r.Resolved("media") }, time.Second,
+		10*time.Millisecond, "resolved after the failure")
+	select {
+	case req := <-xds.reqs:
+		t.Errorf("unexpected request without a client certificate: %v", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+	r.Unregister("media")
+	r.Close()
+
+	// mutual TLS
+	r, err = NewEDSResolver("eds-resolver", srv.URL, "stunnerd-1",
+		&tls.Config{RootCAs: serverCAs, Certificates: []tls.Certificate{clientCert}},
+		loggerFactory)
+	assert.NoError(t, err, "resolver")
+	r.Start(ctx)
+	defer r.Close()
+
+	assert.NoError(t, r.Register("media"), "register")
+	req := <-xds.reqs
+	assert.Equal(t, []string{"media"}, req.resourceNames, "resource names")
+	xds.resps <- newDiscoveryResponse("1", "n1", edsTypeURL, "media", map[string]uint64{
+		"1.2.3.4": healthStatusHealthy,
+	})
+	req = <-xds.reqs
+	assert.Equal(t, "1", req.versionInfo, "ACK version")
+	ips, err := r.Lookup("media")
+	assert.NoError(t, err, "lookup")
+	assert.Len(t, ips, 1, "endpoints")
+
+	r.Unregister("media")
+}
@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
@@ -23,7 +24,7 @@ func NewMockResolver(zone map[string]([]string), logger logging.LoggerFactory) D
 }
 
 // Starts spawns the mock DNS resolver
-func (m *MockResolver) Start() {
+func (m *MockResolver) Start(_ context.Context) {
 	ds := []string{}
 	for d, ips := range m.Zone {
 		ds = append(ds, fmt.Sprintf("%s:[%s]", d, strings.Join(ips, ",")))
@@ -65,3 +66,8 @@ func (m *MockResolver) Lookup(domain string) ([]net.IP, error) {
 
 	return []net.IP{}, fmt.Errorf("host %q not found: 3(NXDOMAIN)", domain)
 }
+
+// Resolved mocks the Resolved method: the mock zone is always resolved.
+func (m *MockResolver) Resolved(domain string) bool {
+	return true
+}
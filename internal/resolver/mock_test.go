@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"context"
 	// "fmt"
 	"testing"
 
@@ -24,7 +25,7 @@ func TestMockResolver(t *testing.T) {
 	}, loggerFactory)
 
 	// should never err
-	mockDns.Start()
+	mockDns.Start(context.Background())
 	assert.NoError(t, nil, "start mock DNS")
 
 	// should never err
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/util"
 )
 
 // STRICT_DNS clusters embed a DnsResolver to resolve domain names in the background
@@ -20,7 +23,12 @@ type DnsResolver interface {
 	Register(domain string) error
 	Unregister(domain string)
 	Lookup(domain string) ([]net.IP, error)
-	Start()
+	// Resolved returns true once the initial resolution of a registered domain has completed
+	// (successfully or not).
+	Resolved(domain string) bool
+	// Start starts the resolver. Background resolution of all domains stops when the context
+	// is canceled.
+	Start(ctx context.Context)
 	Close()
 }
 
@@ -34,22 +42,32 @@ type serviceEntry struct {
 	hostNames    []net.IP
 	cname        string
 	lastResolved time.Time
+	resolved     atomic.Bool
+	clock        util.Clock
 }
 
 type dnsResolverImpl struct {
 	ctx      context.Context
 	register map[string]*serviceEntry
+	clock    util.Clock
 	log      logging.LeveledLogger
 }
 
 // NewDnsResolver creates a new DNS resolver
 func NewDnsResolver(name string, logger logging.LoggerFactory) DnsResolver {
+	return NewDnsResolverWithClock(name, util.NewRealClock(), logger)
+}
+
+// NewDnsResolverWithClock creates a new DNS resolver that refreshes the domains at the ticks of
+// the given clock.
+func NewDnsResolverWithClock(name string, clock util.Clock, logger logging.LoggerFactory) DnsResolver {
 	log := logger.NewLogger(name)
 	log.Tracef("NewDnsResolver")
 
 	return &dnsResolverImpl{
 		ctx:      context.Background(),
 		register: make(map[string]*serviceEntry),
+		clock:    clock,
 		log:      log,
 	}
 }
@@ -74,6 +92,7 @@ func (r *dnsResolverImpl) Register(domain string) error {
 		domain:       domain,
 		cname:        "",
 		lastResolved: time.Time{},
+		clock:        r.clock,
 	}
 	r.register[domain] = e
 
@@ -91,10 +110,11 @@ func startResolver(e *serviceEntry, log logging.LeveledLogger) {
 	if err := doResolve(e); err != nil {
 		log.Debugf("Initial resolution failed for domain %q: %s", e.domain, err.Error())
 	}
+	e.resolved.Store(true)
 	log.Tracef("Initial resolution ready for domain %q, found %d endpoints", e.domain,
 		len(e.hostNames))
 
-	ticker := time.NewTicker(dnsUpdateInterval)
+	ticker := e.clock.NewTicker(dnsUpdateInterval)
 	defer ticker.Stop()
 
 	for {
@@ -102,7 +122,7 @@ func startResolver(e *serviceEntry, log logging.LeveledLogger) {
 		case <-e.ctx.Done():
 			log.Debugf("Resolver thread exiting for domain %q", e.domain)
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			log.Tracef("Resolving for domain %q", e.domain)
 			if err := doResolve(e); err != nil {
 				log.Debugf("Resolution failed for domain %q: %s",
@@ -131,12 +151,12 @@ func doResolve(e *serviceEntry) error {
 			e.domain, err.Error())
 	}
 
-	e.lastResolved = time.Now()
-
 	// for writing
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
+	e.lastResolved = e.clock.Now()
+
 	e.hostNames = make([]net.IP, len(hosts))
 	for i, h := range hosts {
 		n := net.ParseIP(h)
@@ -189,10 +209,20 @@ func (r *dnsResolverImpl) Lookup(domain string) ([]net.IP, error) {
 	return ret, nil
 }
 
+// Resolved returns true if the initial resolution of a domain has completed.
+func (r *dnsResolverImpl) Resolved(domain string) bool {
+	e, found := r.register[domain]
+	if !found {
+		return false
+	}
+	return e.resolved.Load()
+}
+
 // Starts spawns the background resolver thread
-func (r *dnsResolverImpl) Start() {
+func (r *dnsResolverImpl) Start(ctx context.Context) {
 	r.log.Debugf("Starting")
-	// Register already started the resolver threads
+	// resolver threads started by Register derive their context from the resolver context
+	r.ctx = ctx
 }
 
 // Close closes the background resolver
@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/l7mp/stunner/internal/util"
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+func TestDnsResolverClock(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory(resolverTestLoglevel)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := util.NewFakeClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewDnsResolverWithClock("dns-test", clock, loggerFactory)
+	r.Start(ctx)
+	assert.NoError(t, r.Register("localhost"), "register")
+	defer r.Unregister("localhost")
+
+	lastResolved := func() time.Time {
+		e := r.(*dnsResolverImpl).register["localhost"]
+		e.lock.RLock()
+		defer e.lock.RUnlock()
+		return e.lastResolved
+	}
+
+	// the refresh ticker is started after the initial resolution
+	assert.Eventually(t, func() bool { return r.Resolved("localhost") && clock.Waiters() == 1 },
+		5*time.Second, 10*time.Millisecond, "initial resolution")
+	assert.Equal(t, start, lastResolved(), "initial resolution time")
+	ips, err := r.Lookup("localhost")
+	assert.NoError(t, err, "lookup")
+	assert.NotEmpty(t, ips, "localhost resolved")
+
+	// no refresh until the update interval elapses
+	clock.Advance(dnsUpdateInterval - time.Second)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, start, lastResolved(), "no refresh")
+
+	// fast-forward to the next refresh
+	clock.Advance(time.Second)
+	assert.Eventually(t, func() bool { return lastResolved().Equal(start.Add(dnsUpdateInterval)) },
+		5*time.Second, 10*time.Millisecond, "periodic refresh")
+}
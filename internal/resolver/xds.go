@@ -0,0 +1,253 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// A minimal wire-level implementation of the subset of the Envoy xDS v3 API needed for EDS, to
+// avoid pulling in the full Envoy API and gRPC dependency tree.
+
+const (
+	edsTypeURL    = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+	edsStreamPath = "/envoy.service.endpoint.v3.EndpointDiscoveryService/StreamEndpoints"
+
+	maxGRPCMessageSize = 16 * 1024 * 1024
+)
+
+// Envoy core.v3.HealthStatus values
+const (
+	healthStatusUnknown   = 0
+	healthStatusHealthy   = 1
+	healthStatusUnhealthy = 2
+	healthStatusDraining  = 3
+	healthStatusTimeout   = 4
+	healthStatusDegraded  = 5
+)
+
+// discoveryRequest is an envoy.service.discovery.v3.DiscoveryRequest.
+type discoveryRequest struct {
+	versionInfo   string
+	nodeID        string
+	resourceNames []string
+	typeURL       string
+	responseNonce string
+	errorDetail   string
+}
+
+func (r *discoveryRequest) marshal() []byte {
+	b := []byte{}
+	if r.versionInfo != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, r.versionInfo)
+	}
+	node := protowire.AppendTag(nil, 1, protowire.BytesType)
+	node = protowire.AppendString(node, r.nodeID)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, node)
+	for _, n := range r.resourceNames {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, n)
+	}
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendString(b, r.typeURL)
+	if r.responseNonce != "" {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, r.responseNonce)
+	}
+	if r.errorDetail != "" {
+		// google.rpc.Status: code=2 (UNKNOWN), message
+		status := protowire.AppendTag(nil, 1, protowire.VarintType)
+		status = protowire.AppendVarint(status, 2)
+		status = protowire.AppendTag(status, 2, protowire.BytesType)
+		status = protowire.AppendString(status, r.errorDetail)
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, status)
+	}
+	return b
+}
+
+// discoveryResponse is an envoy.service.discovery.v3.DiscoveryResponse.
+type discoveryResponse struct {
+	versionInfo string
+	resources   []anyMessage
+	typeURL     string
+	nonce       string
+}
+
+// anyMessage is a google.protobuf.Any.
+type anyMessage struct {
+	typeURL string
+	value   []byte
+}
+
+func (r *discoveryResponse) unmarshal(b []byte) error {
+	return walkMessage(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			r.versionInfo = string(v)
+		case 2:
+			var a anyMessage
+			if err := walkMessage(v, func(num protowire.Number, v []byte) error {
+				switch num {
+				case 1:
+					a.typeURL = string(v)
+				case 2:
+					a.value = v
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			r.resources = append(r.resources, a)
+		case 4:
+			r.typeURL = string(v)
+		case 5:
+			r.nonce = string(v)
+		}
+		return nil
+	})
+}
+
+// clusterLoadAssignment is an envoy.config.endpoint.v3.ClusterLoadAssignment, reduced to the
+// cluster name and the addresses of the endpoints that can receive traffic.
+type clusterLoadAssignment struct {
+	clusterName string
+	addrs       []net.IP
+}
+
+func (c *clusterLoadAssignment) unmarshal(b []byte) error {
+	c.addrs = []net.IP{}
+	return walkMessage(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1: // cluster_name
+			c.clusterName = string(v)
+		case 2: // endpoints: LocalityLbEndpoints
+			return walkMessage(v, func(num protowire.Number, v []byte) error {
+				if num != 2 { // lb_endpoints: LbEndpoint
+					return nil
+				}
+				ip, health, err := parseLbEndpoint(v)
+				if err != nil {
+					return err
+				}
+				switch health {
+				case healthStatusUnhealthy, healthStatusDraining, healthStatusTimeout:
+					return nil
+				}
+				if ip != nil {
+					c.addrs = append(c.addrs, ip)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// parseLbEndpoint returns the IP address and the health status of an LbEndpoint. The address is
+// nil for non-IP (e.g., pipe) addresses.
+func parseLbEndpoint(b []byte) (net.IP, uint64, error) {
+	var ip net.IP
+	health := uint64(healthStatusUnknown)
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType: // endpoint: Endpoint
+			return walkMessage(v, func(num protowire.Number, v []byte) error {
+				if num != 1 { // address: Address
+					return nil
+				}
+				return walkMessage(v, func(num protowire.Number, v []byte) error {
+					if num != 1 { // socket_address: SocketAddress
+						return nil
+					}
+					return walkMessage(v, func(num protowire.Number, v []byte) error {
+						if num == 2 { // address
+							ip = net.ParseIP(string(v))
+						}
+						return nil
+					})
+				})
+			})
+		case num == 2 && typ == protowire.VarintType: // health_status
+			health = n
+		}
+		return nil
+	})
+	return ip, health, err
+}
+
+// walkMessage calls fn for each length-delimited field of a protobuf message.
+func walkMessage(b []byte, fn func(protowire.Number, []byte) error) error {
+	return walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		return fn(num, v)
+	})
+}
+
+// walkFields calls fn for each field of a protobuf message, with the value of length-delimited
+// fields in v and the value of varint fields in n.
+func walkFields(b []byte, fn func(protowire.Number, protowire.Type, []byte, uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGRPCMessage writes a length-prefixed gRPC message.
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	hdr := make([]byte, 5)
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	_, err := w.Write(append(hdr, msg...))
+	return err
+}
+
+// readGRPCMessage reads a length-prefixed gRPC message. Compressed messages are not supported.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	l := binary.BigEndian.Uint32(hdr[1:])
+	if l > maxGRPCMessageSize {
+		return nil, fmt.Errorf("gRPC message too large: %d bytes", l)
+	}
+	msg := make([]byte, l)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
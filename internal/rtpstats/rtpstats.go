@@ -0,0 +1,216 @@
+// Package rtpstats implements a passive RTP classifier that estimates packet loss and jitter of
+// RTP streams from the RTP sequence numbers and timestamps, without decrypting the payload.
+package rtpstats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	rtpHeaderLen   = 12
+	maxDropout     = 3000
+	maxMisorder    = 100
+	seqMod         = 1 << 16
+	clockProbeTime = time.Second
+	// MaxStreams is the maximum number of RTP streams tracked per tracker. Once the limit is
+	// reached, the idle streams are forgotten to make room for new streams; packets of new
+	// streams are not tracked if there are no idle streams.
+	MaxStreams = 64
+	// StreamIdleTimeout is the time after which a stream without packets is considered idle.
+	StreamIdleTimeout = 30 * time.Second
+)
+
+// Common RTP clock rates: the clock rate of a stream is guessed from the observed timestamp
+// increments and snapped to the closest common rate.
+var clockRates = []float64{8000, 16000, 48000, 90000}
+
+// IsRTP returns true if the packet looks like an RTP packet. RTCP packets (RFC 5761 payload type
+// range 64-95) are excluded.
+func IsRTP(p []byte) bool {
+	if len(p) < rtpHeaderLen || p[0]>>6 != 2 {
+		return false
+	}
+	pt := p[1] & 0x7f
+	return pt < 64 || pt > 95
+}
+
+// StreamStats are the statistics of a single RTP stream.
+type StreamStats struct {
+	// SSRC is the synchronization source identifier of the stream.
+	SSRC uint32
+	// Received is the number of packets received.
+	Received uint64
+	// Lost is the estimated number of lost packets.
+	Lost uint64
+	// Jitter is the interarrival jitter estimate (RFC 3550, Section 6.4.1).
+	Jitter time.Duration
+	// ClockRate is the RTP clock rate guessed for the stream, zero if yet unknown.
+	ClockRate int
+}
+
+// String stringifies the stream statistics.
+func (s StreamStats) String() string {
+	loss := 0.0
+	if s.Received+s.Lost > 0 {
+		loss = 100 * float64(s.Lost) / float64(s.Received+s.Lost)
+	}
+	return fmt.Sprintf("ssrc=%d,received=%d,lost=%d(%.2f%%),jitter=%s", s.SSRC, s.Received,
+		s.Lost, loss, s.Jitter)
+}
+
+type stream struct {
+	ssrc            uint32
+	baseSeq, maxSeq uint16
+	cycles          uint32
+	received        uint64
+	clockRate       float64
+	firstTs         uint32
+	firstArrival    time.Time
+	lastArrival     time.Time
+	lastTransit     float64
+	haveTransit     bool
+	jitter          float64 // in timestamp units
+}
+
+// Tracker tracks the RTP streams seen in a packet flow.
+type Tracker struct {
+	streams map[uint32]*stream
+	lock    sync.Mutex
+	now     func() time.Time
+}
+
+// NewTracker creates a new RTP stream tracker.
+func NewTracker() *Tracker {
+	return &Tracker{streams: map[uint32]*stream{}, now: time.Now}
+}
+
+// Process updates the statistics with a packet. Returns the number of newly detected lost packets,
+// and false if the packet is not an RTP packet.
+func (t *Tracker) Process(p []byte) (uint64, bool) {
+	if !IsRTP(p) {
+		return 0, false
+	}
+
+	seq := binary.BigEndian.Uint16(p[2:4])
+	ts := binary.BigEndian.Uint32(p[4:8])
+	ssrc := binary.BigEndian.Uint32(p[8:12])
+	now := t.now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s, ok := t.streams[ssrc]
+	if !ok {
+		if len(t.streams) >= MaxStreams {
+			t.evictIdle(now)
+			if len(t.streams) >= MaxStreams {
+				return 0, true
+			}
+		}
+		s = &stream{ssrc: ssrc, baseSeq: seq, maxSeq: seq, firstTs: ts, firstArrival: now,
+			lastArrival: now}
+		t.streams[ssrc] = s
+		s.received++
+		return 0, true
+	}
+	s.lastArrival = now
+
+	lostBefore := s.lost()
+
+	// sequence number tracking, after RFC 3550, Appendix A.1
+	delta := uint16(seq - s.maxSeq)
+	switch {
+	case delta == 0:
+		// duplicate
+	case delta < maxDropout:
+		if seq < s.maxSeq {
+			s.cycles += seqMod
+		}
+		s.maxSeq = seq
+	case delta <= seqMod-maxMisorder:
+		// large jump: restart the stream
+		s.baseSeq, s.maxSeq, s.cycles, s.received = seq, seq, 0, 0
+	default:
+		// misordered packet
+	}
+	s.received++
+
+	s.updateJitter(ts, now)
+
+	lostAfter := s.lost()
+	if lostAfter > lostBefore {
+		return lostAfter - lostBefore, true
+	}
+	return 0, true
+}
+
+// evictIdle forgets the streams that have been idle for StreamIdleTimeout.
+func (t *Tracker) evictIdle(now time.Time) {
+	for ssrc, s := range t.streams {
+		if now.Sub(s.lastArrival) >= StreamIdleTimeout {
+			delete(t.streams, ssrc)
+		}
+	}
+}
+
+func (s *stream) lost() uint64 {
+	expected := uint64(s.cycles) + uint64(s.maxSeq) - uint64(s.baseSeq) + 1
+	if expected <= s.received {
+		return 0
+	}
+	return expected - s.received
+}
+
+func (s *stream) updateJitter(ts uint32, now time.Time) {
+	if s.clockRate == 0 {
+		elapsed := now.Sub(s.firstArrival)
+		if elapsed < clockProbeTime {
+			return
+		}
+		rate := float64(ts-s.firstTs) / elapsed.Seconds()
+		s.clockRate = closestClockRate(rate)
+		return
+	}
+
+	// transit time in timestamp units
+	arrival := now.Sub(s.firstArrival).Seconds() * s.clockRate
+	transit := arrival - float64(ts-s.firstTs)
+	if s.haveTransit {
+		d := math.Abs(transit - s.lastTransit)
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.lastTransit = transit
+	s.haveTransit = true
+}
+
+func closestClockRate(rate float64) float64 {
+	best := clockRates[0]
+	for _, r := range clockRates[1:] {
+		if math.Abs(r-rate) < math.Abs(best-rate) {
+			best = r
+		}
+	}
+	return best
+}
+
+// Stats returns the statistics of all the RTP streams seen so far.
+func (t *Tracker) Stats() []StreamStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ret := make([]StreamStats, 0, len(t.streams))
+	for _, s := range t.streams {
+		st := StreamStats{SSRC: s.ssrc, Received: s.received, Lost: s.lost(),
+			ClockRate: int(s.clockRate)}
+		if s.clockRate > 0 {
+			st.Jitter = time.Duration(s.jitter / s.clockRate * float64(time.Second))
+		}
+		ret = append(ret, st)
+	}
+
+	return ret
+}
@@ -0,0 +1,102 @@
+package rtpstats
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rtpPacket(seq uint16, ts, ssrc uint32) []byte {
+	p := make([]byte, 20)
+	p[0] = 0x80
+	p[1] = 111
+	binary.BigEndian.PutUint16(p[2:4], seq)
+	binary.BigEndian.PutUint32(p[4:8], ts)
+	binary.BigEndian.PutUint32(p[8:12], ssrc)
+	return p
+}
+
+func TestRTPClassifier(t *testing.T) {
+	assert.True(t, IsRTP(rtpPacket(1, 1, 1)), "RTP")
+	assert.False(t, IsRTP([]byte{0x80, 200, 0, 6, 0, 0, 0, 1, 0, 0, 0, 0}), "RTCP SR")
+	assert.False(t, IsRTP([]byte{0x00, 0x01, 0x00, 0x00, 0x21, 0x12, 0xa4, 0x42, 0, 0, 0, 0}), "STUN")
+	assert.False(t, IsRTP([]byte{0x80, 111}), "short")
+}
+
+func TestRTPTracker(t *testing.T) {
+	now := time.Unix(0, 0)
+	tr := NewTracker()
+	tr.now = func() time.Time { return now }
+
+	// 20 ms opus frames: seq 0..99 with seq 10 and 11 lost, sequence number wraps around
+	var lost uint64
+	for i := 0; i < 100; i++ {
+		now = now.Add(20 * time.Millisecond)
+		if i == 10 || i == 11 {
+			continue
+		}
+		// add some jitter to every other packet
+		if i%2 == 1 {
+			now = now.Add(2 * time.Millisecond)
+		}
+		n, ok := tr.Process(rtpPacket(uint16(65500+i), uint32(960*i), 42))
+		assert.True(t, ok, "RTP")
+		lost += n
+		if i%2 == 1 {
+			now = now.Add(-2 * time.Millisecond)
+		}
+	}
+
+	// non-RTP
+	_, ok := tr.Process([]byte("garbage"))
+	assert.False(t, ok, "not RTP")
+
+	stats := tr.Stats()
+	assert.Len(t, stats, 1, "one stream")
+	s := stats[0]
+	assert.Equal(t, uint32(42), s.SSRC, "ssrc")
+	assert.Equal(t, uint64(98), s.Received, "received")
+	assert.Equal(t, uint64(2), s.Lost, "lost")
+	assert.Equal(t, uint64(2), lost, "lost reported")
+	assert.Equal(t, 48000, s.ClockRate, "clock rate")
+	assert.InDelta(t, float64(2*time.Millisecond), float64(s.Jitter),
+		float64(time.Millisecond), "jitter")
+
+	// duplicates and reordering are not loss
+	tr = NewTracker()
+	for _, seq := range []uint16{1, 2, 4, 3, 3, 5} {
+		tr.Process(rtpPacket(seq, 0, 7))
+	}
+	assert.Equal(t, uint64(0), tr.Stats()[0].Lost, "no loss")
+}
+
+func TestRTPTrackerLimits(t *testing.T) {
+	now := time.Unix(0, 0)
+	tr := NewTracker()
+	tr.now = func() time.Time { return now }
+
+	// new streams are not tracked above the limit
+	for i := 0; i < MaxStreams+10; i++ {
+		_, ok := tr.Process(rtpPacket(1, 0, uint32(i)))
+		assert.True(t, ok, "RTP")
+	}
+	assert.Len(t, tr.Stats(), MaxStreams, "capped")
+	_, ok := tr.Process(rtpPacket(2, 0, uint32(MaxStreams)))
+	assert.True(t, ok, "RTP")
+	assert.Len(t, tr.Stats(), MaxStreams, "still capped")
+
+	// idle streams are evicted to make room for new streams
+	now = now.Add(StreamIdleTimeout / 2)
+	tr.Process(rtpPacket(2, 0, 0))
+	now = now.Add(StreamIdleTimeout / 2)
+	tr.Process(rtpPacket(1, 0, 1000))
+	stats := tr.Stats()
+	assert.Len(t, stats, 2, "idle streams evicted")
+	ssrcs := []uint32{}
+	for _, s := range stats {
+		ssrcs = append(ssrcs, s.SSRC)
+	}
+	assert.ElementsMatch(t, []uint32{0, 1000}, ssrcs, "active streams")
+}
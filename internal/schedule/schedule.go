@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a weekly recurring time window: a time-of-day range on a set of days of the week.
+type Window struct {
+	days       [7]bool
+	start, end int // minutes since midnight, end may be 24*60
+	spec       string
+}
+
+// Parse parses a window from the format "[DAYS ]HH:MM-HH:MM", where DAYS is a comma-separated
+// list of day names (Mon, Tue, ...) or day ranges (e.g., Mon-Fri or Sat-Sun). If DAYS is omitted
+// the window is active every day. If the end of the time range is not later than the start then
+// the window extends past midnight into the next day, e.g., "Sat 22:00-02:00" is active from
+// Saturday 22:00 to Sunday 02:00.
+func Parse(spec string) (*Window, error) {
+	fields := strings.Fields(spec)
+	w := &Window{spec: spec}
+
+	var times string
+	switch len(fields) {
+	case 1:
+		times = fields[0]
+		for d := range w.days {
+			w.days[d] = true
+		}
+	case 2:
+		times = fields[1]
+		for _, r := range strings.Split(fields[0], ",") {
+			from, to, isRange := strings.Cut(r, "-")
+			first, ok := dayNames[strings.ToLower(from)]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q in window %q", from, spec)
+			}
+			last := first
+			if isRange {
+				if last, ok = dayNames[strings.ToLower(to)]; !ok {
+					return nil, fmt.Errorf("invalid day %q in window %q", to, spec)
+				}
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid window %q: must be \"[DAYS ]HH:MM-HH:MM\"", spec)
+	}
+
+	from, to, ok := strings.Cut(times, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid time range %q in window %q", times, spec)
+	}
+	var err error
+	if w.start, err = parseTime(from); err != nil || w.start == 24*60 {
+		return nil, fmt.Errorf("invalid start time %q in window %q", from, spec)
+	}
+	if w.end, err = parseTime(to); err != nil {
+		return nil, fmt.Errorf("invalid end time %q in window %q", to, spec)
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("empty time range in window %q", spec)
+	}
+
+	return w, nil
+}
+
+// parseTime parses a time of day in the format HH:MM into minutes since midnight, allowing 24:00.
+func parseTime(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok || len(h) != 2 || len(m) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hh, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, err
+	}
+	mm, err := strconv.Atoi(m)
+	if err != nil {
+		return 0, err
+	}
+	if hh < 0 || mm < 0 || mm > 59 || hh > 24 || (hh == 24 && mm != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// Contains reports whether the window is active at the given time, taken in the location of t.
+func (w *Window) Contains(t time.Time) bool {
+	tod := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.start < w.end {
+		return w.days[day] && tod >= w.start && tod < w.end
+	}
+	// past midnight
+	return (w.days[day] && tod >= w.start) || (w.days[(day+6)%7] && tod < w.end)
+}
+
+func (w *Window) String() string {
+	return w.spec
+}
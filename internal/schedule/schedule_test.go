@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowParse(t *testing.T) {
+	for _, spec := range []string{"09:00-17:00", "Mon-Fri 09:00-17:00", "sat,sun 22:00-02:00",
+		"Fri-Mon 00:00-24:00", "Wed 23:30-00:00"} {
+		w, err := Parse(spec)
+		assert.NoError(t, err, "parse %q", spec)
+		assert.Equal(t, spec, w.String(), "string")
+	}
+
+	for _, spec := range []string{"", "09:00", "09:00-09:00", "9:00-17:00", "09:00-25:00",
+		"24:00-02:00", "09:60-10:00", "Dummy 09:00-17:00", "Mon-Dummy 09:00-17:00",
+		"Mon Tue 09:00-17:00"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, "parse %q", spec)
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2024-01-06 is a Saturday
+	at := func(day int, hhmm string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", fmt.Sprintf("2024-01-%02d %s", day, hhmm))
+		return tm
+	}
+
+	for _, c := range []struct {
+		spec     string
+		t        time.Time
+		contains bool
+	}{
+		{"09:00-17:00", at(6, "09:00"), true},
+		{"09:00-17:00", at(6, "16:59"), true},
+		{"09:00-17:00", at(6, "17:00"), false},
+		{"Mon-Fri 09:00-17:00", at(6, "12:00"), false},
+		{"Mon-Fri 09:00-17:00", at(8, "12:00"), true},
+		{"Fri-Mon 00:00-24:00", at(7, "23:59"), true},
+		{"Fri-Mon 00:00-24:00", at(9, "12:00"), false},
+		// past midnight
+		{"Sat 22:00-02:00", at(6, "23:00"), true},
+		{"Sat 22:00-02:00", at(7, "01:59"), true},
+		{"Sat 22:00-02:00", at(7, "02:00"), false},
+		{"Sat 22:00-02:00", at(7, "23:00"), false},
+		{"Sat 22:00-02:00", at(6, "01:00"), false},
+	} {
+		w, err := Parse(c.spec)
+		assert.NoError(t, err, "parse")
+		assert.Equal(t, c.contains, w.Contains(c.t), "%q contains %s", c.spec, c.t)
+	}
+}
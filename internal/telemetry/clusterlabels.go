@@ -0,0 +1,32 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// SetClusterMetadata sets the namespace and the name of the Kubernetes Service a cluster was
+// generated from, which are then added as the "namespace" and "service" labels to the metrics of
+// the cluster. An empty service name removes the labels.
+func (t *Telemetry) SetClusterMetadata(n, namespace, service string) {
+	if service == "" {
+		t.clusters.Delete(n)
+		return
+	}
+	t.clusters.Store(n, []attribute.KeyValue{
+		attribute.String("namespace", namespace),
+		attribute.String("service", service),
+	})
+}
+
+// clusterAttrs returns the attributes of a cluster metric: the name of the cluster, the given
+// attributes, the labels of the Kubernetes Service of the cluster, if set, and the user-defined
+// labels of the cluster, if any.
+func (t *Telemetry) clusterAttrs(n string, attrs ...attribute.KeyValue) metric.MeasurementOption {
+	attrs = append([]attribute.KeyValue{attribute.String("name", n)}, attrs...)
+	if labels, ok := t.clusters.Load(n); ok {
+		attrs = append(attrs, labels.([]attribute.KeyValue)...)
+	}
+	attrs = append(attrs, objectLabels(&t.clusterLabels, n)...)
+	return t.attrs(attrs...)
+}
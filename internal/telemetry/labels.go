@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OverflowLabelValue is the value reported for a label once the number of distinct values of the
+// label reached the limit.
+const OverflowLabelValue = "other"
+
+// labelPolicy controls the cardinality of the exported metrics.
+type labelPolicy struct {
+	disabled map[string]bool
+	limit    int
+	seen     map[attribute.Key]map[string]bool
+	lock     sync.Mutex
+}
+
+// SetLabelPolicy sets the labels to be removed from the metrics and the maximum number of distinct
+// values exported for each label. The "name" label is never removed or capped. Calling with no
+// disabled labels and a zero limit removes all restrictions.
+func (t *Telemetry) SetLabelPolicy(disabled []string, limit int) {
+	if len(disabled) == 0 && limit <= 0 {
+		t.labels.Store(nil)
+		return
+	}
+
+	p := &labelPolicy{
+		disabled: map[string]bool{},
+		limit:    limit,
+		seen:     map[attribute.Key]map[string]bool{},
+	}
+	for _, l := range disabled {
+		p.disabled[l] = true
+	}
+
+	// keep the values already exported so that existing series are not folded into "other"
+	if old := t.labels.Load(); old != nil && old.limit == limit {
+		old.lock.Lock()
+		for k, vs := range old.seen {
+			p.seen[k] = map[string]bool{}
+			for v := range vs {
+				p.seen[k][v] = true
+			}
+		}
+		old.lock.Unlock()
+	}
+
+	t.labels.Store(p)
+}
+
+// attrs applies the label policy to the attributes of a measurement.
+func (t *Telemetry) attrs(attrs ...attribute.KeyValue) metric.MeasurementOption {
+	p := t.labels.Load()
+	if p == nil {
+		return metric.WithAttributes(attrs...)
+	}
+
+	ret := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if kv.Key == "name" {
+			ret = append(ret, kv)
+			continue
+		}
+		if p.disabled[string(kv.Key)] {
+			continue
+		}
+		if p.limit > 0 && !p.admit(kv) {
+			kv = kv.Key.String(OverflowLabelValue)
+		}
+		ret = append(ret, kv)
+	}
+	return metric.WithAttributes(ret...)
+}
+
+// admit returns true if the value of a label is below the limit.
+func (p *labelPolicy) admit(kv attribute.KeyValue) bool {
+	v := kv.Value.Emit()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	vs, ok := p.seen[kv.Key]
+	if !ok {
+		vs = map[string]bool{}
+		p.seen[kv.Key] = vs
+	}
+	if vs[v] {
+		return true
+	}
+	if len(vs) >= p.limit {
+		return false
+	}
+	vs[v] = true
+	return true
+}
@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"sync/atomic"
+)
+
+// ListenerCounters is a snapshot of the in-process traffic counters of a listener. Unlike the
+// exported metrics, these counters can be read directly by the caller, e.g., to compute rates.
+type ListenerCounters struct {
+	RxPackets, TxPackets uint64
+	RxBytes, TxBytes     uint64
+	// Errors counts the packets dropped or rejected and the panics recovered at the listener.
+	Errors uint64
+}
+
+type listenerCounters struct {
+	rxPackets, txPackets atomic.Uint64
+	rxBytes, txBytes     atomic.Uint64
+	errors               atomic.Uint64
+}
+
+func (t *Telemetry) listenerCounters(n string) *listenerCounters {
+	if c, ok := t.listeners.Load(n); ok {
+		return c.(*listenerCounters)
+	}
+	c, _ := t.listeners.LoadOrStore(n, &listenerCounters{})
+	return c.(*listenerCounters)
+}
+
+func (t *Telemetry) countListenerError(n string, count uint64) {
+	t.listenerCounters(n).errors.Add(count)
+}
+
+// GetListenerCounters returns the in-process traffic counters of a listener.
+func (t *Telemetry) GetListenerCounters(n string) ListenerCounters {
+	c := t.listenerCounters(n)
+	return ListenerCounters{
+		RxPackets: c.rxPackets.Load(),
+		TxPackets: c.txPackets.Load(),
+		RxBytes:   c.rxBytes.Load(),
+		TxBytes:   c.txBytes.Load(),
+		Errors:    c.errors.Load(),
+	}
+}
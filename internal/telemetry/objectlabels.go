@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ObjectLabelPrefix is prepended to the keys of the user-defined labels of the listeners and the
+// clusters to obtain the labels of their metrics.
+const ObjectLabelPrefix = "label_"
+
+// SetListenerLabels sets the user-defined labels of a listener, which are then added to the
+// metrics of the listener as "label_<key>" labels. Empty labels remove the labels.
+func (t *Telemetry) SetListenerLabels(n string, labels map[string]string) {
+	setObjectLabels(&t.listenerLabels, n, labels)
+}
+
+// SetClusterLabels sets the user-defined labels of a cluster, which are then added to the
+// metrics of the cluster as "label_<key>" labels. Empty labels remove the labels.
+func (t *Telemetry) SetClusterLabels(n string, labels map[string]string) {
+	setObjectLabels(&t.clusterLabels, n, labels)
+}
+
+func setObjectLabels(m *sync.Map, n string, labels map[string]string) {
+	if len(labels) == 0 {
+		m.Delete(n)
+		return
+	}
+	attrs := []attribute.KeyValue{}
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		attrs = append(attrs, attribute.String(ObjectLabelPrefix+sanitizeLabelKey(k), labels[k]))
+	}
+	m.Store(n, attrs)
+}
+
+// sanitizeLabelKey replaces the characters that are not allowed in Prometheus label names with
+// underscores.
+func sanitizeLabelKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, k)
+}
+
+// objectLabels returns the metric labels of an object, if any.
+func objectLabels(m *sync.Map, n string) []attribute.KeyValue {
+	if labels, ok := m.Load(n); ok {
+		return labels.([]attribute.KeyValue)
+	}
+	return nil
+}
+
+// listenerAttrs returns the attributes of a listener metric: the name of the listener, the given
+// attributes and the user-defined labels of the listener, if any.
+func (t *Telemetry) listenerAttrs(n string, attrs ...attribute.KeyValue) metric.MeasurementOption {
+	attrs = append([]attribute.KeyValue{attribute.String("name", n)}, attrs...)
+	attrs = append(attrs, objectLabels(&t.listenerLabels, n)...)
+	return t.attrs(attrs...)
+}
@@ -3,7 +3,9 @@ package telemetry
 // code adopted from github.com/livekit/pkg/telemetry
 
 import (
+	"errors"
 	"net"
+	"syscall"
 )
 
 // Listener is a net.Listener that knows how to report to Prometheus.
@@ -103,6 +105,15 @@ func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
 	return
 }
 
+// SyscallConn returns a raw network connection for the socket underlying the PacketConn.
+func (c *PacketConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.PacketConn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("raw socket access not supported")
+	}
+	return sc.SyscallConn()
+}
+
 // ReadFrom reads from the PacketConn.
 // WriteTo writes to the PacketConn.
 // Close closes the PacketConn.
@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+func TestPacketConnSyscallConn(t *testing.T) {
+	loggerFactory := logger.NewLoggerFactory("all:ERROR")
+	tm, err := New(Callbacks{GetAllocationCount: func() int64 { return 0 }}, false, nil,
+		loggerFactory.NewLogger("metric"))
+	assert.NoError(t, err, "telemetry")
+	defer tm.Close() //nolint:errcheck
+
+	base, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err, "listen")
+	defer base.Close() //nolint:errcheck
+
+	// the raw socket of the underlying PacketConn is passed through
+	var c net.PacketConn = NewPacketConn(base, "udp", ListenerType, tm)
+	sc, ok := c.(syscall.Conn)
+	assert.True(t, ok, "raw socket access")
+	raw, err := sc.SyscallConn()
+	assert.NoError(t, err, "raw socket")
+	var fd uintptr
+	assert.NoError(t, raw.Control(func(s uintptr) { fd = s }), "control")
+	want, err := base.(*net.UDPConn).SyscallConn()
+	assert.NoError(t, err, "raw socket")
+	assert.NoError(t, want.Control(func(s uintptr) { assert.Equal(t, s, fd, "same socket") }),
+		"control")
+
+	// PacketConns without raw socket access are reported as such
+	c = NewPacketConn(struct{ net.PacketConn }{base}, "udp", ListenerType, tm)
+	_, err = c.(syscall.Conn).SyscallConn()
+	assert.Error(t, err, "no raw socket access")
+}
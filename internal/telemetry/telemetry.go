@@ -3,6 +3,8 @@ package telemetry
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
@@ -25,6 +27,14 @@ const (
 type Callbacks struct {
 	// GetAllocationCount should map to the total allocation counter of the server.
 	GetAllocationCount func() int64
+	// GetFDUsage should return the number of open file descriptors and the limit on the
+	// number of open file descriptors of the process (zero if there is no limit).
+	GetFDUsage func() (int, int, error)
+	// GetConfigId should return the opaque identifier of the running config (empty if unset).
+	GetConfigId func() string
+	// GetRelayPortUsage should call observe with the number of used and free relay ports in
+	// each relay port range ("min-max") of each listener with relay port ranges.
+	GetRelayPortUsage func(observe func(name, portRange string, used, free int))
 }
 
 type Telemetry struct {
@@ -40,20 +50,66 @@ type Telemetry struct {
 	ListenerBytesCounter   metric.Int64Counter
 	ListenerConnsCounter   metric.Int64Counter
 	ListenerConnsGauge     metric.Int64UpDownCounter
+	ListenerDropsCounter   metric.Int64Counter
+	ListenerTarpitCounter  metric.Int64Counter
+	ListenerForwardCounter metric.Int64Counter
+	ListenerDemuxDrops     metric.Int64Counter
+	ListenerBindingCounter metric.Int64Counter
+	ListenerStrictCounter  metric.Int64Counter
+	ListenerPanicCounter   metric.Int64Counter
+	SessionExpiredCounter  metric.Int64Counter
+	EgressDropsCounter     metric.Int64Counter
+	MTUDropsCounter        metric.Int64Counter
+	TCPRejectedCounter     metric.Int64Counter
+	ClientRTTHistogram     metric.Float64Histogram
+	ChurnCounter           metric.Int64Counter
+	WatchdogCounter        metric.Int64Counter
+	StaleNonceCounter      metric.Int64Counter
+	StaleNonceRetryCounter metric.Int64Counter
+	AuthSuccessCounter     metric.Int64Counter
+	AuthFailureCounter     metric.Int64Counter
+	RTPPacketsCounter      metric.Int64Counter
+	RTPLostCounter         metric.Int64Counter
 	ClusterPacketsCounter  metric.Int64Counter
 	ClusterBytesCounter    metric.Int64Counter
+	TargetPacketsCounter   metric.Int64Counter
+	TargetBytesCounter     metric.Int64Counter
+	MirroredCounter        metric.Int64Counter
+	UpstreamAllocsCounter  metric.Int64Counter
 	AllocationsGauge       metric.Int64ObservableGauge
+	AllocationsCounter     metric.Int64Counter
+	FDUsageGauge           metric.Float64ObservableGauge
+	ConfigInfoGauge        metric.Int64ObservableGauge
+	RelayPortsUsedGauge    metric.Int64ObservableGauge
+	RelayPortsFreeGauge    metric.Int64ObservableGauge
+	RelayPortsExhausted    metric.Int64Counter
 
 	callbacks Callbacks
 
+	// in-process listener counters, keyed by listener name
+	listeners sync.Map
+	// Kubernetes Service labels of the clusters, keyed by cluster name
+	clusters sync.Map
+	// user-defined labels of the listeners and the clusters, keyed by object name
+	listenerLabels, clusterLabels sync.Map
+	// the label policy, nil if the metrics are not restricted
+	labels atomic.Pointer[labelPolicy]
+
 	log logging.LeveledLogger
 }
 
-func New(callbacks Callbacks, dryRun bool, log logging.LeveledLogger) (*Telemetry, error) {
+// New creates the metric instruments. Labels, if given, are added as constant labels to all the
+// exported metrics, which allows to tell apart the metrics of several STUNner instances sharing
+// the same process.
+func New(callbacks Callbacks, dryRun bool, labels map[string]string, log logging.LeveledLogger) (*Telemetry, error) {
 	var reader sdkmetric.Reader
 
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String("stunner")}
+	for k, v := range labels {
+		attrs = append(attrs, attribute.String(k, v))
+	}
 	resource, err := resource.Merge(resource.Default(),
-		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("stunner")))
+		resource.NewWithAttributes(semconv.SchemaURL, attrs...))
 	if err != nil {
 		return nil, fmt.Errorf("could not create OTEL resource: %w", err)
 	}
@@ -62,8 +118,18 @@ func New(callbacks Callbacks, dryRun bool, log logging.LeveledLogger) (*Telemetr
 		// Use manual collection mode
 		reader = sdkmetric.NewManualReader()
 	} else {
+		opts := []prometheus.Option{}
+		if len(labels) > 0 {
+			// the scope info would be exported by each instance with the same labels
+			opts = append(opts, prometheus.WithoutScopeInfo(),
+				prometheus.WithResourceAsConstantLabels(func(kv attribute.KeyValue) bool {
+					_, ok := labels[string(kv.Key)]
+					return ok
+				}))
+		}
+
 		// Create a new Prometheus exporter (starts background collection)
-		exporter, err := prometheus.New()
+		exporter, err := prometheus.New(opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -143,6 +209,170 @@ func (t *Telemetry) init() error {
 		return err
 	}
 
+	t.ListenerDropsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_rcvbuf_drops_total",
+		metric.WithDescription("Number of datagrams dropped due to receive buffer overflow at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ListenerTarpitCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_tarpit_packets_total",
+		metric.WithDescription("Number of packets from denied clients captured in tarpit mode at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ListenerForwardCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_forwarded_packets_total",
+		metric.WithDescription("Number of non-STUN packets forwarded from or to a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ListenerDemuxDrops, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_forward_dropped_packets_total",
+		metric.WithDescription("Number of non-STUN packets dropped at a listener for reaching the forwarding session limit"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ListenerBindingCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_binding_ratelimited_total",
+		metric.WithDescription("Number of STUN Binding requests exceeding the Binding rate limit at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ListenerStrictCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_strict_rejected_total",
+		metric.WithDescription("Number of STUN requests rejected at a listener for missing a mandatory FINGERPRINT or MESSAGE-INTEGRITY attribute"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ListenerPanicCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_panics_total",
+		metric.WithDescription("Number of panics recovered in the packet processing goroutines of a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.SessionExpiredCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_sessions_expired_total",
+		metric.WithDescription("Number of allocations closed at a listener for exceeding the maximum session duration or for being idle"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.EgressDropsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_egress_dropped_packets_total",
+		metric.WithDescription("Number of packets dropped at the egress queue of the relay connections of a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.MTUDropsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_mtu_dropped_packets_total",
+		metric.WithDescription("Number of packets dropped at the relay connections of a listener for exceeding the maximum datagram size or the path MTU"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.TCPRejectedCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_tcp_rejected_connections_total",
+		metric.WithDescription("Number of TCP connections rejected by the connection limit, the accept queue or the file descriptor guard of a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ClientRTTHistogram, err = t.meter.Float64Histogram(
+		stunnerInstrumentName+"_listener_client_rtt_seconds",
+		metric.WithDescription("Round-trip time between the clients and a listener"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5,
+			1, 2.5, 5),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ChurnCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_allocation_churn_total",
+		metric.WithDescription("Number of clients detected and allocations refused for allocation churn at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.WatchdogCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_watchdog_restarts_total",
+		metric.WithDescription("Number of times a listener was restarted by the watchdog"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.StaleNonceCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_stale_nonces_total",
+		metric.WithDescription("Number of requests rejected with a Stale Nonce error at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.StaleNonceRetryCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_stale_nonce_retries_total",
+		metric.WithDescription("Number of requests retried by clients after a Stale Nonce error at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Initialize auth metrics
+	t.AuthSuccessCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_auth_success_total",
+		metric.WithDescription("Number of successfully authenticated requests"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.AuthFailureCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_auth_failures_total",
+		metric.WithDescription("Number of requests that failed authentication"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.RTPPacketsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_rtp_packets_total",
+		metric.WithDescription("Number of RTP packets relayed via a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.RTPLostCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_rtp_packets_lost_total",
+		metric.WithDescription("Estimated number of RTP packets lost before reaching STUNner, per listener"),
+	)
+	if err != nil {
+		return err
+	}
+
 	// Initialize cluster metrics
 	t.ClusterPacketsCounter, err = t.meter.Int64Counter(
 		stunnerInstrumentName+"_cluster_packets_total",
@@ -160,6 +390,38 @@ func (t *Telemetry) init() error {
 		return err
 	}
 
+	t.TargetPacketsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_cluster_target_packets_total",
+		metric.WithDescription("Number of datagrams sent to or received from backends in remote cluster targets"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.TargetBytesCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_cluster_target_bytes_total",
+		metric.WithDescription("Number of bytes sent to or received from backends in remote cluster targets"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.MirroredCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_cluster_mirrored_packets_total",
+		metric.WithDescription("Number of packets mirrored to the mirror endpoints of a cluster"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.UpstreamAllocsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_cluster_upstream_allocations_total",
+		metric.WithDescription("Number of allocations created at the upstream TURN server of a cluster"),
+	)
+	if err != nil {
+		return err
+	}
+
 	t.AllocationsGauge, err = t.meter.Int64ObservableGauge(
 		stunnerInstrumentName+"_allocations_active",
 		metric.WithDescription("Number of active allocations"),
@@ -168,6 +430,14 @@ func (t *Telemetry) init() error {
 		return err
 	}
 
+	t.AllocationsCounter, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_allocations_total",
+		metric.WithDescription("Number of allocations created at a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
 	_, err = t.meter.RegisterCallback(
 		func(_ context.Context, o metric.Observer) error {
 			o.ObserveInt64(t.AllocationsGauge, t.callbacks.GetAllocationCount())
@@ -179,39 +449,341 @@ func (t *Telemetry) init() error {
 		return err
 	}
 
+	t.FDUsageGauge, err = t.meter.Float64ObservableGauge(
+		stunnerInstrumentName+"_fd_usage_ratio",
+		metric.WithDescription("Ratio of the open file descriptors to the file descriptor limit of the process"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.meter.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			if t.callbacks.GetFDUsage == nil {
+				return nil
+			}
+			// not supported or no limit
+			if used, limit, err := t.callbacks.GetFDUsage(); err == nil && limit > 0 {
+				o.ObserveFloat64(t.FDUsageGauge, float64(used)/float64(limit))
+			}
+			return nil
+		},
+		t.FDUsageGauge,
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ConfigInfoGauge, err = t.meter.Int64ObservableGauge(
+		stunnerInstrumentName+"_config_info",
+		metric.WithDescription("Identifier of the running config, set to 1"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.meter.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			if t.callbacks.GetConfigId == nil {
+				return nil
+			}
+			if id := t.callbacks.GetConfigId(); id != "" {
+				o.ObserveInt64(t.ConfigInfoGauge, 1,
+					t.attrs(attribute.String("config_id", id)))
+			}
+			return nil
+		},
+		t.ConfigInfoGauge,
+	)
+	if err != nil {
+		return err
+	}
+
+	t.RelayPortsUsedGauge, err = t.meter.Int64ObservableGauge(
+		stunnerInstrumentName+"_listener_relay_ports_used",
+		metric.WithDescription("Number of relay ports leased to allocations from a relay port range of a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	t.RelayPortsFreeGauge, err = t.meter.Int64ObservableGauge(
+		stunnerInstrumentName+"_listener_relay_ports_free",
+		metric.WithDescription("Number of relay ports not leased to allocations in a relay port range of a listener"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.meter.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			if t.callbacks.GetRelayPortUsage == nil {
+				return nil
+			}
+			t.callbacks.GetRelayPortUsage(func(n, r string, used, free int) {
+				attrs := t.listenerAttrs(n, attribute.String("range", r))
+				o.ObserveInt64(t.RelayPortsUsedGauge, int64(used), attrs)
+				o.ObserveInt64(t.RelayPortsFreeGauge, int64(free), attrs)
+			})
+			return nil
+		},
+		t.RelayPortsUsedGauge, t.RelayPortsFreeGauge,
+	)
+	if err != nil {
+		return err
+	}
+
+	t.RelayPortsExhausted, err = t.meter.Int64Counter(
+		stunnerInstrumentName+"_listener_relay_ports_exhausted_total",
+		metric.WithDescription("Number of allocations refused at a listener for the exhaustion of the relay port ranges"),
+	)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (t *Telemetry) IncrementPackets(n string, c ConnType, d Direction, count uint64) {
-	attrs := metric.WithAttributes(
-		attribute.String("name", n),
-		attribute.String("direction", d.String()),
-	)
-
 	switch c {
 	case ListenerType:
+		attrs := t.listenerAttrs(n,
+			attribute.String("direction", d.String()),
+		)
 		t.ListenerPacketsCounter.Add(t.ctx, int64(count), attrs)
+		if d == Incoming {
+			t.listenerCounters(n).rxPackets.Add(count)
+		} else {
+			t.listenerCounters(n).txPackets.Add(count)
+		}
 	case ClusterType:
-		t.ClusterPacketsCounter.Add(t.ctx, int64(count), attrs)
+		t.ClusterPacketsCounter.Add(t.ctx, int64(count),
+			t.clusterAttrs(n, attribute.String("direction", d.String())))
 	}
 }
 
 func (t *Telemetry) IncrementBytes(n string, c ConnType, d Direction, count uint64) {
-	attrs := metric.WithAttributes(
-		attribute.String("name", n),
-		attribute.String("direction", d.String()),
-	)
-
 	switch c {
 	case ListenerType:
+		attrs := t.listenerAttrs(n,
+			attribute.String("direction", d.String()),
+		)
 		t.ListenerBytesCounter.Add(t.ctx, int64(count), attrs)
+		if d == Incoming {
+			t.listenerCounters(n).rxBytes.Add(count)
+		} else {
+			t.listenerCounters(n).txBytes.Add(count)
+		}
 	case ClusterType:
-		t.ClusterBytesCounter.Add(t.ctx, int64(count), attrs)
+		t.ClusterBytesCounter.Add(t.ctx, int64(count),
+			t.clusterAttrs(n, attribute.String("direction", d.String())))
+	}
+}
+
+// IncrementTarget counts a packet relayed to or from a backend in a remote cluster target of a
+// cluster.
+func (t *Telemetry) IncrementTarget(n, target string, d Direction, bytes uint64) {
+	attrs := t.clusterAttrs(n,
+		attribute.String("target", target),
+		attribute.String("direction", d.String()),
+	)
+	t.TargetPacketsCounter.Add(t.ctx, 1, attrs)
+	t.TargetBytesCounter.Add(t.ctx, int64(bytes), attrs)
+}
+
+// IncrementMirrored counts a packet mirrored, or dropped instead of mirroring, by a cluster.
+func (t *Telemetry) IncrementMirrored(n, status string) {
+	attrs := t.clusterAttrs(n, attribute.String("status", status))
+	t.MirroredCounter.Add(t.ctx, 1, attrs)
+}
+
+// IncrementUpstreamAllocations counts an allocation attempt at the upstream TURN server of a
+// cluster.
+func (t *Telemetry) IncrementUpstreamAllocations(n, status string) {
+	attrs := t.clusterAttrs(n, attribute.String("status", status))
+	t.UpstreamAllocsCounter.Add(t.ctx, 1, attrs)
+}
+
+func (t *Telemetry) IncrementDrops(n string, count uint64) {
+	attrs := t.listenerAttrs(n)
+	t.ListenerDropsCounter.Add(t.ctx, int64(count), attrs)
+	t.countListenerError(n, count)
+}
+
+func (t *Telemetry) IncrementTarpit(n string) {
+	attrs := t.listenerAttrs(n)
+	t.ListenerTarpitCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+func (t *Telemetry) IncrementForwarded(n string, d Direction) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("direction", d.String()),
+	)
+	t.ListenerForwardCounter.Add(t.ctx, 1, attrs)
+}
+
+// IncrementDemuxDrops counts a non-STUN packet dropped by a listener for reaching the maximum
+// number of forwarding sessions.
+func (t *Telemetry) IncrementDemuxDrops(n string) {
+	t.ListenerDemuxDrops.Add(t.ctx, 1, t.listenerAttrs(n))
+	t.countListenerError(n, 1)
+}
+
+// IncrementBindingRateLimited counts a STUN Binding request dropped or rejected by the Binding
+// rate limiter of a listener.
+func (t *Telemetry) IncrementBindingRateLimited(n string) {
+	attrs := t.listenerAttrs(n)
+	t.ListenerBindingCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// IncrementStrictRejected counts a STUN request rejected by a listener for missing a mandatory
+// attribute (reason is either "fingerprint" or "integrity").
+func (t *Telemetry) IncrementStrictRejected(n, reason string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("reason", reason),
+	)
+	t.ListenerStrictCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// IncrementPanic counts a panic recovered in a component of a listener.
+func (t *Telemetry) IncrementPanic(n, component string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("component", component),
+	)
+	t.ListenerPanicCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// IncrementSessionExpired counts an allocation closed by a listener before it expires (reason is
+// either "max-duration" or "idle").
+func (t *Telemetry) IncrementSessionExpired(n, reason string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("reason", reason),
+	)
+	t.SessionExpiredCounter.Add(t.ctx, 1, attrs)
+}
+
+// IncrementRelayPortsExhausted counts an allocation refused at a listener for the exhaustion of
+// the relay port ranges.
+func (t *Telemetry) IncrementRelayPortsExhausted(n string) {
+	t.RelayPortsExhausted.Add(t.ctx, 1, t.listenerAttrs(n))
+}
+
+// IncrementEgressDrops counts a packet dropped at the egress queue of a relay connection of a
+// listener (policy is either "tail" or "head").
+func (t *Telemetry) IncrementEgressDrops(n, policy string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("policy", policy),
+	)
+	t.EgressDropsCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// IncrementMTUDrops counts a packet dropped at a relay connection of a listener for being too
+// large (reason is either "max_datagram_size" or "path_mtu").
+func (t *Telemetry) IncrementMTUDrops(n, reason string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("reason", reason),
+	)
+	t.MTUDropsCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// IncrementTCPRejected counts a TCP connection closed by a listener for exceeding the connection
+// limit, overflowing the accept queue or near file descriptor exhaustion (reason is either
+// "limit", "accept-queue" or "fd-exhausted").
+func (t *Telemetry) IncrementTCPRejected(n, reason string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("reason", reason),
+	)
+	t.TCPRejectedCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// ObserveClientRTT records a round-trip time measured between a client and a listener (method is
+// either "stun" or "tcp"). The country is the country code of the client, if known.
+func (t *Telemetry) ObserveClientRTT(n, method, country string, rtt time.Duration) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("method", method),
+		attribute.String("country", country),
+	)
+	t.ClientRTTHistogram.Record(t.ctx, rtt.Seconds(), attrs)
+}
+
+// IncrementChurn counts a client detected for allocation churn or an allocation refused for
+// allocation churn at a listener (action is either "detected" or "limited").
+func (t *Telemetry) IncrementChurn(n, action string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("action", action),
+	)
+	t.ChurnCounter.Add(t.ctx, 1, attrs)
+	if action == "limited" {
+		t.countListenerError(n, 1)
+	}
+}
+
+// IncrementWatchdogRestart counts a listener restarted by the watchdog for a wedged dataplane
+// (reason is either "readloop-stuck" or "rx-stalled").
+func (t *Telemetry) IncrementWatchdogRestart(n, reason string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("reason", reason),
+	)
+	t.WatchdogCounter.Add(t.ctx, 1, attrs)
+	t.countListenerError(n, 1)
+}
+
+// IncrementStaleNonce counts a Stale Nonce error response sent by a listener.
+func (t *Telemetry) IncrementStaleNonce(n string) {
+	attrs := t.listenerAttrs(n)
+	t.StaleNonceCounter.Add(t.ctx, 1, attrs)
+}
+
+// IncrementStaleNonceRetry counts a request retried with a fresh nonce after a Stale Nonce error.
+func (t *Telemetry) IncrementStaleNonceRetry(n string) {
+	attrs := t.listenerAttrs(n)
+	t.StaleNonceRetryCounter.Add(t.ctx, 1, attrs)
+}
+
+// IncrementAuthSuccess counts a successfully authenticated request for an authentication type.
+func (t *Telemetry) IncrementAuthSuccess(authType string) {
+	attrs := t.attrs(attribute.String("type", authType))
+	t.AuthSuccessCounter.Add(t.ctx, 1, attrs)
+}
+
+// IncrementAuthFailure counts a failed authentication request for an authentication type, with
+// the reason of the failure.
+func (t *Telemetry) IncrementAuthFailure(authType, reason string) {
+	attrs := t.attrs(
+		attribute.String("type", authType),
+		attribute.String("reason", reason),
+	)
+	t.AuthFailureCounter.Add(t.ctx, 1, attrs)
+}
+
+func (t *Telemetry) IncrementRTP(n string, d Direction, lost uint64) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("direction", d.String()),
+	)
+	t.RTPPacketsCounter.Add(t.ctx, 1, attrs)
+	if lost > 0 {
+		t.RTPLostCounter.Add(t.ctx, int64(lost), attrs)
 	}
 }
 
+// IncrementAllocations counts a new allocation at a listener, with the client's country code
+// (empty if unknown).
+func (t *Telemetry) IncrementAllocations(n, country string) {
+	attrs := t.listenerAttrs(n,
+		attribute.String("country", country),
+	)
+	t.AllocationsCounter.Add(t.ctx, 1, attrs)
+}
+
 func (t *Telemetry) AddConnection(n string, c ConnType) {
-	attrs := metric.WithAttributes(attribute.String("name", n))
+	attrs := t.listenerAttrs(n)
 
 	switch c {
 	case ListenerType:
@@ -223,7 +795,7 @@ func (t *Telemetry) AddConnection(n string, c ConnType) {
 }
 
 func (t *Telemetry) SubConnection(n string, c ConnType) {
-	attrs := metric.WithAttributes(attribute.String("name", n))
+	attrs := t.listenerAttrs(n)
 
 	switch c {
 	case ListenerType:
@@ -0,0 +1,162 @@
+package util
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a source of time and timers. Components that depend on the passage of time take a
+// Clock so that tests can substitute a FakeClock and fast-forward time deterministically instead
+// of sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a ticker that delivers the time on its channel after each period.
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f after the duration elapses.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker is a periodic timer created by a Clock.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// Timer is a one-shot timer created by a Clock.
+type Timer interface {
+	// Stop prevents the timer from firing. Returns false if the timer has already fired or
+	// has been stopped.
+	Stop() bool
+}
+
+// RealClock is a Clock backed by the time package.
+type RealClock struct{}
+
+// NewRealClock returns a Clock backed by the time package.
+func NewRealClock() Clock { return RealClock{} }
+
+// Now returns the current time.
+func (RealClock) Now() time.Time { return time.Now() }
+
+// NewTicker returns a ticker backed by a time.Ticker.
+func (RealClock) NewTicker(d time.Duration) Ticker { return &realTicker{time.NewTicker(d)} }
+
+// AfterFunc returns a timer backed by a time.Timer.
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+type realTicker struct{ *time.Ticker }
+
+func (t *realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock is a Clock for testing: time stands still until it is moved forward with Advance,
+// which fires the tickers and the timers that fall due in the order of their deadline.
+type FakeClock struct {
+	now     time.Time
+	waiters []*fakeWaiter
+	lock    sync.Mutex
+}
+
+// NewFakeClock creates a FakeClock set to the given time.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration  // zero for timers
+	ch       chan time.Time // tickers
+	fn       func()         // timers
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker that ticks each time the fake time passes a period. Like a
+// time.Ticker, the ticker drops ticks for slow receivers.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &fakeWaiter{clock: c, deadline: c.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return &fakeTicker{w}
+}
+
+// AfterFunc returns a timer that calls f once the fake time passes the duration. The function is
+// called synchronously from Advance.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &fakeWaiter{clock: c, deadline: c.now.Add(d), fn: f}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+// Advance moves the fake time forward, firing the tickers and the timers that fall due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+		})
+		if len(c.waiters) == 0 || c.waiters[0].deadline.After(end) {
+			break
+		}
+
+		w := c.waiters[0]
+		c.now = w.deadline
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+			select {
+			case w.ch <- c.now:
+			default:
+			}
+			continue
+		}
+
+		// timers may use the clock, so the lock is released while firing
+		c.waiters = c.waiters[1:]
+		c.lock.Unlock()
+		w.fn()
+		c.lock.Lock()
+	}
+	c.now = end
+	c.lock.Unlock()
+}
+
+// Waiters returns the number of active tickers and timers, so that tests can wait until a
+// component has set up its timers before advancing the time.
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+func (t *fakeTicker) Stop()               { t.w.Stop() }
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.lock.Lock()
+	defer w.clock.lock.Unlock()
+	for i, x := range w.clock.waiters {
+		if x == w {
+			w.clock.waiters = append(w.clock.waiters[:i], w.clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+package util
+
+import "errors"
+
+var errFDUsageUnsupported = errors.New("file descriptor usage monitoring is not supported on this platform")
+
+// FDUsage returns the number of file descriptors open in the process and the limit on the number
+// of open file descriptors (the soft RLIMIT_NOFILE), or zero if there is no limit.
+func FDUsage() (int, int, error) {
+	return fdUsage()
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package util
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func fdUsage() (int, int, error) {
+	var rlimit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, 0, err
+	}
+
+	// the directory itself takes up a file descriptor while being read
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	limit := 0
+	if rlimit.Cur != unix.RLIM_INFINITY {
+		limit = int(rlimit.Cur)
+	}
+
+	return len(fds) - 1, limit, nil
+}
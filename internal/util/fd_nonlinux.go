@@ -0,0 +1,5 @@
+//go:build !linux
+
+package util
+
+func fdUsage() (int, int, error) { return 0, 0, errFDUsageUnsupported }
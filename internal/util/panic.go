@@ -0,0 +1,17 @@
+package util
+
+import (
+	"runtime/debug"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+)
+
+// ReportPanic logs a panic recovered in a component of a listener along with the stack trace and
+// counts it in the metrics. Must be called from the deferred function that recovered the panic.
+func ReportPanic(log logging.LeveledLogger, t *telemetry.Telemetry, name, component string, r any) {
+	log.Errorf("recovered from panic in %s of listener %s: %v\n%s", component, name, r,
+		debug.Stack())
+	t.IncrementPanic(name, component)
+}
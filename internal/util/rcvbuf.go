@@ -0,0 +1,155 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+)
+
+// RcvBufAutotuneInterval is the period at which the kernel drop counter of autotuned UDP sockets
+// is checked.
+var RcvBufAutotuneInterval = 5 * time.Second
+
+var errRcvBufUnsupported = errors.New("receive buffer autotuning is not supported on this platform")
+
+// rcvBufPacketConn is a PacketConn that periodically checks the kernel drop counter of the
+// underlying UDP socket and doubles the socket receive buffer (SO_RCVBUF), up to a configured cap,
+// whenever new drops are observed.
+type rcvBufPacketConn struct {
+	net.PacketConn
+	raw          syscall.RawConn
+	name         string
+	max, current int
+	drops        uint32
+	telemetry    *telemetry.Telemetry
+	done         chan struct{}
+	closeOnce    sync.Once
+	log          logging.LeveledLogger
+}
+
+// NewRcvBufAutotunePacketConn decorates a PacketConn with receive buffer autotuning. The receive
+// buffer is never grown above max bytes. If the PacketConn does not allow access to the raw socket
+// or the platform cannot report socket drops then the PacketConn is returned unchanged.
+func NewRcvBufAutotunePacketConn(c net.PacketConn, name string, max int, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		log.Debugf("listener %s: receive buffer autotuning disabled: no raw socket access", name)
+		return c
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		log.Debugf("listener %s: receive buffer autotuning disabled: %s", name, err.Error())
+		return c
+	}
+
+	drops, err := getSocketDrops(raw)
+	if err != nil {
+		log.Debugf("listener %s: receive buffer autotuning disabled: %s", name, err.Error())
+		return c
+	}
+
+	current, err := getRcvBuf(raw)
+	if err != nil {
+		log.Debugf("listener %s: receive buffer autotuning disabled: %s", name, err.Error())
+		return c
+	}
+
+	r := &rcvBufPacketConn{
+		PacketConn: c,
+		raw:        raw,
+		name:       name,
+		max:        max,
+		current:    current,
+		drops:      drops,
+		telemetry:  t,
+		done:       make(chan struct{}),
+		log:        log,
+	}
+
+	go r.autotune()
+
+	return r
+}
+
+func (r *rcvBufPacketConn) autotune() {
+	ticker := time.NewTicker(RcvBufAutotuneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.check(); err != nil {
+				// socket closed behind our back
+				return
+			}
+		}
+	}
+}
+
+// check counts the packets dropped at the socket since the last check and grows the receive
+// buffer if there were any.
+func (r *rcvBufPacketConn) check() error {
+	drops, err := getSocketDrops(r.raw)
+	if err != nil {
+		return err
+	}
+
+	if drops <= r.drops {
+		return nil
+	}
+
+	diff := drops - r.drops
+	r.drops = drops
+	r.telemetry.IncrementDrops(r.name, uint64(diff))
+
+	if r.current >= r.max {
+		r.log.Warnf("listener %s: %d packet(s) dropped at the UDP socket, receive "+
+			"buffer already at the configured maximum (%d bytes)", r.name, diff,
+			r.current)
+		return nil
+	}
+
+	size := 2 * r.current
+	if size > r.max {
+		size = r.max
+	}
+
+	if err := setRcvBuf(r.raw, size); err != nil {
+		r.log.Warnf("listener %s: could not set UDP receive buffer size to %d "+
+			"bytes: %s", r.name, size, err.Error())
+		return nil
+	}
+
+	// the kernel may silently cap (and double) the value we set
+	current, err := getRcvBuf(r.raw)
+	if err != nil {
+		current = size
+	}
+	if current <= r.current {
+		r.log.Warnf("listener %s: %d packet(s) dropped at the UDP socket, could not "+
+			"grow receive buffer above %d bytes (check net.core.rmem_max)",
+			r.name, diff, r.current)
+		return nil
+	}
+	r.current = current
+
+	r.log.Infof("listener %s: %d packet(s) dropped at the UDP socket, receive buffer "+
+		"grown to %d bytes", r.name, diff, r.current)
+
+	return nil
+}
+
+// Close closes the PacketConn and stops the autotuner.
+func (r *rcvBufPacketConn) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return r.PacketConn.Close()
+}
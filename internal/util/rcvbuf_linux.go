@@ -0,0 +1,53 @@
+//go:build linux
+
+package util
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// getSocketDrops returns the number of packets dropped by the kernel at the socket, as reported
+// by SO_MEMINFO.
+func getSocketDrops(raw syscall.RawConn) (uint32, error) {
+	var meminfo [unix.SK_MEMINFO_VARS]uint32
+	var operr error
+	if err := raw.Control(func(fd uintptr) {
+		l := uint32(unsafe.Sizeof(meminfo))
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, fd, unix.SOL_SOCKET, unix.SO_MEMINFO,
+			uintptr(unsafe.Pointer(&meminfo[0])), uintptr(unsafe.Pointer(&l)), 0)
+		if errno != 0 {
+			operr = errno
+		}
+	}); err != nil {
+		return 0, err
+	}
+	if operr != nil {
+		return 0, operr
+	}
+
+	return meminfo[unix.SK_MEMINFO_DROPS], nil
+}
+
+func getRcvBuf(raw syscall.RawConn) (int, error) {
+	var size int
+	var operr error
+	if err := raw.Control(func(fd uintptr) {
+		size, operr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	}); err != nil {
+		return 0, err
+	}
+	return size, operr
+}
+
+func setRcvBuf(raw syscall.RawConn, size int) error {
+	var operr error
+	if err := raw.Control(func(fd uintptr) {
+		operr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, size)
+	}); err != nil {
+		return err
+	}
+	return operr
+}
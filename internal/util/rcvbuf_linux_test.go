@@ -0,0 +1,116 @@
+package util
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+func TestRcvBufAutotune(t *testing.T) {
+	// the checks are run by hand
+	RcvBufAutotuneInterval = time.Hour
+
+	loggerFactory := logger.NewLoggerFactory("all:ERROR")
+	log := loggerFactory.NewLogger("test")
+	tm, err := telemetry.New(telemetry.Callbacks{GetAllocationCount: func() int64 { return 0 }},
+		false, nil, loggerFactory.NewLogger("metric"))
+	assert.NoError(t, err, "telemetry")
+	defer tm.Close() //nolint:errcheck
+
+	base, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err, "listen")
+	assert.NoError(t, base.(*net.UDPConn).SetReadBuffer(4096), "set receive buffer")
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err, "client")
+	defer client.Close() //nolint:errcheck
+
+	// a PacketConn without raw socket access is not autotuned
+	opaque := telemetry.NewPacketConn(struct{ net.PacketConn }{base}, "udp", telemetry.ListenerType, tm)
+	assert.Equal(t, net.PacketConn(opaque), NewRcvBufAutotunePacketConn(opaque, "udp", 1<<16, tm, log),
+		"no autotuning without raw socket access")
+
+	// the telemetry decorator passes the raw socket through
+	conn := NewRcvBufAutotunePacketConn(telemetry.NewPacketConn(base, "udp", telemetry.ListenerType, tm),
+		"udp", 1<<16, tm, log)
+	r, ok := conn.(*rcvBufPacketConn)
+	assert.True(t, ok, "autotuning enabled")
+	defer conn.Close() //nolint:errcheck
+
+	drops := func() int64 {
+		var rm metricdata.ResourceMetrics
+		assert.NoError(t, tm.Collect(context.Background(), &rm), "collect")
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "stunner_listener_rcvbuf_drops_total" {
+					continue
+				}
+				if sum, ok := m.Data.(metricdata.Sum[int64]); ok && len(sum.DataPoints) > 0 {
+					return sum.DataPoints[0].Value
+				}
+			}
+		}
+		return 0
+	}
+
+	// overflow the receive buffer
+	flood := func() {
+		last, err := getSocketDrops(r.raw)
+		assert.NoError(t, err, "drops")
+		for i := 0; i < 100; i++ {
+			_, err := client.WriteTo(make([]byte, 1200), base.LocalAddr())
+			assert.NoError(t, err, "write")
+		}
+		assert.Eventually(t, func() bool {
+			d, err := getSocketDrops(r.raw)
+			return err == nil && d > last
+		}, time.Second, 10*time.Millisecond, "socket drops")
+	}
+
+	// no drops: the receive buffer is left alone
+	initial := r.current
+	assert.NoError(t, r.check(), "check")
+	assert.Equal(t, initial, r.current, "receive buffer unchanged")
+	assert.Equal(t, int64(0), drops(), "no drops")
+
+	// drops: the receive buffer is doubled (the kernel doubles the value on its own)
+	flood()
+	assert.NoError(t, r.check(), "check")
+	assert.Equal(t, 4*initial, r.current, "receive buffer doubled")
+	size, err := getRcvBuf(r.raw)
+	assert.NoError(t, err, "receive buffer")
+	assert.Equal(t, r.current, size, "socket receive buffer")
+	assert.Equal(t, int64(r.drops), drops(), "drops counted")
+	assert.NotZero(t, r.drops, "drops")
+
+	// drain the socket
+	buf := make([]byte, 1500)
+	for {
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)), "deadline")
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			break
+		}
+	}
+	assert.NoError(t, conn.SetReadDeadline(time.Time{}), "deadline")
+
+	// the receive buffer does not grow above the cap
+	for r.current < r.max {
+		flood()
+		assert.NoError(t, r.check(), "check")
+	}
+	capped := r.current
+	flood()
+	assert.NoError(t, r.check(), "check")
+	assert.Equal(t, capped, r.current, "receive buffer capped")
+	assert.Equal(t, int64(r.drops), drops(), "drops counted")
+
+	// a closed socket stops the autotuner
+	assert.NoError(t, conn.Close(), "close")
+	assert.Error(t, r.check(), "closed socket")
+}
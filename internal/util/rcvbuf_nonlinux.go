@@ -0,0 +1,9 @@
+//go:build !linux
+
+package util
+
+import "syscall"
+
+func getSocketDrops(_ syscall.RawConn) (uint32, error) { return 0, errRcvBufUnsupported }
+func getRcvBuf(_ syscall.RawConn) (int, error)         { return 0, errRcvBufUnsupported }
+func setRcvBuf(_ syscall.RawConn, _ int) error         { return errRcvBufUnsupported }
@@ -1,9 +1,31 @@
 package util
 
 import (
+	"fmt"
+	"os"
+	"regexp"
 	"sort"
 )
 
+var placeholderRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ResolvePlaceholders substitutes "${VAR}" style placeholders in a string with the value of the
+// corresponding environment variable. Returns an error if a variable is not set. Other uses of
+// "$" are left intact.
+func ResolvePlaceholders(s string) (string, error) {
+	var err error
+	ret := placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("unresolved placeholder %s: environment variable %s is not set",
+				m, name)
+		}
+		return v
+	})
+	return ret, err
+}
+
 // check is list contains element a
 func Member(list []string, a string) bool {
 	for _, b := range list {
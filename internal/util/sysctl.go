@@ -0,0 +1,11 @@
+package util
+
+import "errors"
+
+var errSysctlUnsupported = errors.New("reading kernel parameters is not supported on this platform")
+
+// Sysctl returns the value of an integer kernel parameter given in the dotted sysctl notation,
+// e.g., "net.core.somaxconn".
+func Sysctl(name string) (int64, error) {
+	return sysctl(name)
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func sysctl(name string) (int64, error) {
+	path := filepath.Join("/proc/sys", strings.ReplaceAll(name, ".", "/"))
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64)
+}
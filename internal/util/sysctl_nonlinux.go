@@ -0,0 +1,5 @@
+//go:build !linux
+
+package util
+
+func sysctl(_ string) (int64, error) { return 0, errSysctlUnsupported }
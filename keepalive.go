@@ -0,0 +1,191 @@
+package stunner
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+)
+
+// keepaliveListener is a TCP net.Listener that sets the TCP keepalive period of the accepted
+// connections, so that the connections of vanished clients are detected and closed by the kernel.
+type keepaliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+// newKeepaliveListener decorates a TCP listener with a TCP keepalive period. A negative period
+// disables TCP keepalives.
+func newKeepaliveListener(l net.Listener, period time.Duration) net.Listener {
+	return &keepaliveListener{Listener: l, period: period}
+}
+
+func (l *keepaliveListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if l.period < 0 {
+			tcpConn.SetKeepAlive(false) //nolint:errcheck
+		} else {
+			tcpConn.SetKeepAlive(true)           //nolint:errcheck
+			tcpConn.SetKeepAlivePeriod(l.period) //nolint:errcheck
+		}
+	}
+	return conn, nil
+}
+
+// IdlePacketConn is a relay net.PacketConn that closes itself if the allocation has been idle for
+// the idle timeout, i.e., no data has been relayed in either direction and the client has sent no
+// authenticated request (e.g., a refresh). Closing the relay connection makes the TURN server
+// delete the allocation, which reclaims the resources held by vanished clients well before the
+// allocation would expire.
+type IdlePacketConn struct {
+	net.PacketConn
+	name      string
+	timeout   time.Duration
+	last      atomic.Int64 // time of the last activity in UnixNano
+	timer     *time.Timer
+	once      sync.Once
+	onClose   func()
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewIdlePacketConn decorates a relay PacketConn with an idle timeout. Idle sessions are reported
+// per listener name.
+func NewIdlePacketConn(c net.PacketConn, name string, timeout time.Duration, t *telemetry.Telemetry, log logging.LeveledLogger) *IdlePacketConn {
+	i := &IdlePacketConn{
+		PacketConn: c,
+		name:       name,
+		timeout:    timeout,
+		telemetry:  t,
+		log:        log,
+	}
+	i.Touch()
+	i.timer = time.AfterFunc(timeout, i.check)
+	return i
+}
+
+// Touch marks the session as active.
+func (c *IdlePacketConn) Touch() {
+	c.last.Store(time.Now().UnixNano())
+}
+
+func (c *IdlePacketConn) check() {
+	idle := time.Since(time.Unix(0, c.last.Load()))
+	if idle < c.timeout {
+		c.timer.Reset(c.timeout - idle)
+		return
+	}
+
+	c.log.Infof("Relay connection %s idle for %s: closing allocation",
+		c.PacketConn.LocalAddr(), idle.Round(time.Second))
+	c.telemetry.IncrementSessionExpired(c.name, sessionExpiredIdle)
+	c.close() //nolint:errcheck
+}
+
+// ReadFrom reads a packet from a peer.
+func (c *IdlePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.Touch()
+	}
+	return n, addr, err
+}
+
+// WriteTo writes a packet to a peer.
+func (c *IdlePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if err == nil {
+		c.Touch()
+	}
+	return n, err
+}
+
+func (c *IdlePacketConn) close() error {
+	var err error
+	c.once.Do(func() {
+		if c.onClose != nil {
+			c.onClose()
+		}
+		err = c.PacketConn.Close()
+	})
+	return err
+}
+
+// Close stops the idle timer and closes the relay connection.
+func (c *IdlePacketConn) Close() error {
+	c.timer.Stop()
+	return c.close()
+}
+
+// idleRegistry maps the clients of the allocations to the idle relay connections, so that the
+// authenticated requests of a client can mark the session as active.
+type idleRegistry struct {
+	relays  map[string]*IdlePacketConn // keyed by relay address
+	clients map[string]*IdlePacketConn // keyed by client and listener address
+	lock    sync.RWMutex
+}
+
+func newIdleRegistry() *idleRegistry {
+	return &idleRegistry{
+		relays:  map[string]*IdlePacketConn{},
+		clients: map[string]*IdlePacketConn{},
+	}
+}
+
+func idleClientKey(src, dst net.Addr) string {
+	return fmt.Sprintf("%s-%s", src, dst)
+}
+
+func (r *idleRegistry) addRelay(relayAddr net.Addr, conn *IdlePacketConn) {
+	relay := relayAddr.String()
+	conn.onClose = func() { r.deleteRelay(relay, conn) }
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.relays[relay] = conn
+}
+
+// deleteRelay forgets a relay connection, unless the relay address has been reused by a new
+// allocation in the meantime.
+func (r *idleRegistry) deleteRelay(relay string, conn *IdlePacketConn) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.relays[relay] == conn {
+		delete(r.relays, relay)
+	}
+}
+
+// addClient associates the client of a new allocation with the relay connection, if the relay
+// connection has an idle timeout.
+func (r *idleRegistry) addClient(src, dst, relayAddr net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if conn, ok := r.relays[relayAddr.String()]; ok {
+		r.clients[idleClientKey(src, dst)] = conn
+	}
+}
+
+func (r *idleRegistry) deleteClient(src, dst net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.clients, idleClientKey(src, dst))
+}
+
+// touch marks the session of a client as active.
+func (r *idleRegistry) touch(src, dst net.Addr) {
+	r.lock.RLock()
+	conn, ok := r.clients[idleClientKey(src, dst)]
+	r.lock.RUnlock()
+	if ok {
+		conn.Touch()
+	}
+}
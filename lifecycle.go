@@ -0,0 +1,50 @@
+package stunner
+
+import (
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// LifecycleCallbacks is a set of callbacks invoked on the lifecycle events of STUNner objects. Any
+// of the callbacks may be nil. Callbacks are called synchronously from the reconciliation loop, so
+// they should return quickly.
+type LifecycleCallbacks struct {
+	// OnStart is called when an object becomes operational. For listeners this happens when
+	// the listener sockets have been bound and the TURN server is running, for clusters when
+	// the cluster is created.
+	OnStart func(name string)
+	// OnStop is called when an object is stopped, either because it is being restarted or
+	// deleted or because STUNner is shutting down.
+	OnStop func(name string)
+	// OnError is called when an object fails to start, e.g., when a listener cannot bind to
+	// the requested address.
+	OnError func(name string, err error)
+}
+
+// SetLifecycleCallbacks registers the lifecycle callbacks for the objects of the given type
+// ("listener" or "cluster"), overwriting the callbacks registered previously for the same type. In
+// dry-run mode listener callbacks are never called, since listeners are not actually
+// started. Must not be called concurrently with Reconcile.
+func (s *Stunner) SetLifecycleCallbacks(objectType string, cbs LifecycleCallbacks) {
+	if s.lifecycleCallbacks == nil {
+		s.lifecycleCallbacks = map[string]LifecycleCallbacks{}
+	}
+	s.lifecycleCallbacks[objectType] = cbs
+}
+
+func (s *Stunner) onStart(o object.Object) {
+	if cbs, ok := s.lifecycleCallbacks[o.ObjectType()]; ok && cbs.OnStart != nil {
+		cbs.OnStart(o.ObjectName())
+	}
+}
+
+func (s *Stunner) onStop(o object.Object) {
+	if cbs, ok := s.lifecycleCallbacks[o.ObjectType()]; ok && cbs.OnStop != nil {
+		cbs.OnStop(o.ObjectName())
+	}
+}
+
+func (s *Stunner) onError(o object.Object, err error) {
+	if cbs, ok := s.lifecycleCallbacks[o.ObjectType()]; ok && cbs.OnError != nil {
+		cbs.OnError(o.ObjectName(), err)
+	}
+}
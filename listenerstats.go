@@ -0,0 +1,205 @@
+package stunner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+var (
+	// ListenerStatsInterval is the period at which the traffic counters of the listeners are
+	// sampled for computing the instantaneous rates.
+	ListenerStatsInterval = time.Second
+	// ListenerStatsWindow is the length of the rolling window over which the average rates of
+	// the listeners are computed.
+	ListenerStatsWindow = time.Minute
+)
+
+type listenerStatsSample struct {
+	at       time.Time
+	counters telemetry.ListenerCounters
+}
+
+// listenerStatsRegistry keeps the samples of the traffic counters of each listener over the
+// rolling window.
+type listenerStatsRegistry struct {
+	samples map[string][]listenerStatsSample
+	lock    sync.Mutex
+}
+
+func newListenerStatsRegistry() *listenerStatsRegistry {
+	return &listenerStatsRegistry{samples: map[string][]listenerStatsSample{}}
+}
+
+// add adds a new sample for a listener and drops the samples that fell out of the window. The
+// newest sample older than the window is kept so that the window is always covered in full.
+func (r *listenerStatsRegistry) add(name string, sample listenerStatsSample) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	samples := append(r.samples[name], sample)
+	cutoff := sample.at.Add(-ListenerStatsWindow)
+	for len(samples) > 2 && !samples[1].at.After(cutoff) {
+		samples = samples[1:]
+	}
+	r.samples[name] = samples
+}
+
+// prune removes the samples of the listeners that no longer exist.
+func (r *listenerStatsRegistry) prune(exists func(string) bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for name := range r.samples {
+		if !exists(name) {
+			delete(r.samples, name)
+		}
+	}
+}
+
+// rates returns the rates computed over the last sampling interval and over the window.
+func (r *listenerStatsRegistry) rates(name string) (stnrv1.ListenerRates, stnrv1.ListenerRates) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	samples := r.samples[name]
+	if len(samples) < 2 {
+		return stnrv1.ListenerRates{}, stnrv1.ListenerRates{}
+	}
+	last := samples[len(samples)-1]
+	return listenerRates(samples[len(samples)-2], last), listenerRates(samples[0], last)
+}
+
+func listenerRates(from, to listenerStatsSample) stnrv1.ListenerRates {
+	d := to.at.Sub(from.at).Seconds()
+	if d <= 0 {
+		return stnrv1.ListenerRates{}
+	}
+	rate := func(a, b uint64) float64 {
+		if b < a {
+			// the counters were reset
+			return 0
+		}
+		return float64(b-a) / d
+	}
+	return stnrv1.ListenerRates{
+		Interval: d,
+		RxPps:    rate(from.counters.RxPackets, to.counters.RxPackets),
+		TxPps:    rate(from.counters.TxPackets, to.counters.TxPackets),
+		RxBps:    8 * rate(from.counters.RxBytes, to.counters.RxBytes),
+		TxBps:    8 * rate(from.counters.TxBytes, to.counters.TxBytes),
+		Errors:   rate(from.counters.Errors, to.counters.Errors),
+	}
+}
+
+// runListenerStats samples the traffic counters of the listeners and the sessions until the
+// context is canceled.
+func (s *Stunner) runListenerStats(ctx context.Context) {
+	ticker := time.NewTicker(ListenerStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sampleListenerStats(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Stunner) sampleListenerStats(now time.Time) {
+	for _, name := range s.listenerManager.Keys() {
+		s.stats.add(name, listenerStatsSample{
+			at:       now,
+			counters: s.telemetry.GetListenerCounters(name),
+		})
+	}
+	s.stats.prune(func(name string) bool { return s.GetListener(name) != nil })
+	s.talkers.sample(now)
+}
+
+// GetListenerStats returns the traffic statistics of a listener, with the packet, bit and error
+// rates computed over the last sampling interval and over the rolling window, or nil if no
+// listener with the given name exists. The rates are zero until at least two samples have been
+// taken.
+func (s *Stunner) GetListenerStats(name string) *stnrv1.ListenerStats {
+	l := s.GetListener(name)
+	if l == nil {
+		return nil
+	}
+
+	counters := s.telemetry.GetListenerCounters(name)
+	stats := &stnrv1.ListenerStats{
+		Name:      name,
+		Labels:    maps.Clone(l.Labels),
+		RxPackets: counters.RxPackets,
+		RxBytes:   counters.RxBytes,
+		TxPackets: counters.TxPackets,
+		TxBytes:   counters.TxBytes,
+		Errors:    counters.Errors,
+	}
+	stats.Allocations = l.AllocationCount()
+	stats.Current, stats.Window = s.stats.rates(name)
+
+	return stats
+}
+
+// NewListenerStatsHandler creates a helper function for querying the traffic statistics of the
+// listeners.
+func (s *Stunner) NewListenerStatsHandler() object.ListenerStatsHandler {
+	return func(name string, selector *stnrv1.LabelSelector) ([]*stnrv1.ListenerStats, error) {
+		if name != "" {
+			stats := s.GetListenerStats(name)
+			if stats == nil {
+				return nil, fmt.Errorf("listener %q not found", name)
+			}
+			return []*stnrv1.ListenerStats{stats}, nil
+		}
+
+		ret := []*stnrv1.ListenerStats{}
+		for _, name := range s.listenerManager.Keys() {
+			if stats := s.GetListenerStats(name); stats != nil && selector.Matches(stats.Labels) {
+				ret = append(ret, stats)
+			}
+		}
+		return ret, nil
+	}
+}
+
+// GetScalingMetrics returns the load signals for horizontal autoscaling of a listener, or summed
+// over all listeners if the name is empty: the number of active allocations and the relayed
+// bandwidth averaged over the rolling window of the listener statistics.
+func (s *Stunner) GetScalingMetrics(name string) (*stnrv1.ScalingMetrics, error) {
+	names := s.listenerManager.Keys()
+	if name != "" {
+		names = []string{name}
+	}
+
+	ret := &stnrv1.ScalingMetrics{}
+	for _, n := range names {
+		stats := s.GetListenerStats(n)
+		if stats == nil {
+			if name != "" {
+				return nil, fmt.Errorf("listener %q not found", name)
+			}
+			continue
+		}
+		ret.Allocations += stats.Allocations
+		ret.Bandwidth += stats.Window.RxBps + stats.Window.TxBps
+	}
+	return ret, nil
+}
+
+// NewScalingMetricsHandler creates a helper function for querying the load signals for
+// horizontal autoscaling.
+func (s *Stunner) NewScalingMetricsHandler() object.ScalingMetricsHandler {
+	return s.GetScalingMetrics
+}
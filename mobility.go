@@ -0,0 +1,440 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/util"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+// AttrMobilityTicket is the MOBILITY-TICKET attribute of the TURN mobility extension (RFC 8016).
+const AttrMobilityTicket = stun.AttrType(0x8030)
+
+const (
+	// mobilityTicketSize is the size of the random mobility tickets in bytes.
+	mobilityTicketSize = 16
+	// mobilityInboxSize is the number of packets that can be queued for a readloop by the other
+	// readloops of the listener.
+	mobilityInboxSize = 64
+	// mobilityPendingTimeout is the time after which a request carrying a MOBILITY-TICKET is
+	// forgotten if the TURN server has not responded to it.
+	mobilityPendingTimeout = 10 * time.Second
+	// mobilityMaxPending is the maximum number of pending requests carrying a MOBILITY-TICKET.
+	// Further requests are processed without issuing or rotating a ticket.
+	mobilityMaxPending = 4096
+)
+
+// Kinds of the requests carrying a MOBILITY-TICKET.
+const (
+	mobilityAllocate = iota
+	mobilityRefresh
+)
+
+// mobilityRegistry implements the TURN mobility extension (RFC 8016) for the UDP listeners with
+// mobility enabled. An allocation requested with an empty MOBILITY-TICKET attribute is issued a
+// ticket, which the client presents in a Refresh request sent from a new address, e.g., after
+// switching from Wi-Fi to LTE, to move the allocation to the new address.
+//
+// The TURN server keys the allocations by the client address, so the allocations are not moved
+// in the TURN server: instead, the packets received from the new address of the client are
+// rewritten to come from the address the allocation was created from, and the packets sent to the
+// original address are sent to the new address. The allocations of a listener are kept by the
+// readloop the Allocate request was received on, so the packets received on another readloop of
+// the listener are handed over to the readloop owning the allocation.
+type mobilityRegistry struct {
+	sessions map[string]*mobilitySession // keyed by listener and original client address
+	aliases  map[string]*mobilitySession // keyed by listener and current client address, if moved
+	tickets  map[string]*mobilitySession // keyed by the current and the previous ticket
+	pending  map[string]*mobilityPending // keyed by transaction ID
+	clock    Clock
+	lock     sync.Mutex
+}
+
+// mobilitySession is an allocation with mobility.
+type mobilitySession struct {
+	listener        string
+	origin, current net.Addr
+	username        string
+	owner           *mobilityPacketConn
+	// the current and the previous ticket: the response carrying the current ticket may be lost
+	tickets [2]string
+}
+
+// mobilityPending is a request carrying a MOBILITY-TICKET the TURN server has not responded to.
+type mobilityPending struct {
+	kind     int
+	listener string
+	origin   net.Addr // the client address of the allocation
+	client   net.Addr // the address the request was received from
+	username string
+	conn     *mobilityPacketConn
+	session  *mobilitySession // for refresh requests
+	key      []byte           // the message integrity key of the client, for signing the response
+	timer    util.Timer       // forgets the request after mobilityPendingTimeout
+}
+
+func newMobilityRegistry(clock Clock) *mobilityRegistry {
+	return &mobilityRegistry{
+		sessions: map[string]*mobilitySession{},
+		aliases:  map[string]*mobilitySession{},
+		tickets:  map[string]*mobilitySession{},
+		pending:  map[string]*mobilityPending{},
+		clock:    clock,
+	}
+}
+
+func mobilityKey(listener string, addr net.Addr) string { return listener + "/" + addr.String() }
+
+// resetListener forgets the allocations of a listener, called when the listener is (re)started.
+func (r *mobilityRegistry) resetListener(listener string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, sess := range r.sessions {
+		if sess.listener == listener {
+			r.remove(sess)
+		}
+	}
+	for txid, pend := range r.pending {
+		if pend.listener == listener {
+			r.deletePending(txid)
+		}
+	}
+}
+
+// deleteAllocation forgets a deleted allocation.
+func (r *mobilityRegistry) deleteAllocation(listener string, src net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if sess, ok := r.sessions[mobilityKey(listener, src)]; ok {
+		r.remove(sess)
+	}
+}
+
+func (r *mobilityRegistry) remove(sess *mobilitySession) {
+	delete(r.sessions, mobilityKey(sess.listener, sess.origin))
+	if r.aliases[mobilityKey(sess.listener, sess.current)] == sess {
+		delete(r.aliases, mobilityKey(sess.listener, sess.current))
+	}
+	for _, t := range sess.tickets {
+		if r.tickets[t] == sess {
+			delete(r.tickets, t)
+		}
+	}
+}
+
+// rotate issues a new ticket for an allocation, keeping the previous ticket valid.
+func (r *mobilityRegistry) rotate(sess *mobilitySession) string {
+	if old := sess.tickets[1]; old != "" && r.tickets[old] == sess {
+		delete(r.tickets, old)
+	}
+	sess.tickets[1] = sess.tickets[0]
+	sess.tickets[0] = randomHex(mobilityTicketSize)
+	r.tickets[sess.tickets[0]] = sess
+	return sess.tickets[0]
+}
+
+// addPending records a request carrying a MOBILITY-TICKET until the TURN server responds to it.
+// Returns false if there are too many pending requests.
+func (r *mobilityRegistry) addPending(txid [stun.TransactionIDSize]byte, pend *mobilityPending) bool {
+	key := string(txid[:])
+	if old, ok := r.pending[key]; ok {
+		// retransmission
+		old.timer.Stop()
+	} else if len(r.pending) >= mobilityMaxPending {
+		return false
+	}
+
+	pend.timer = r.clock.AfterFunc(mobilityPendingTimeout, func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.pending[key] == pend {
+			delete(r.pending, key)
+		}
+	})
+	r.pending[key] = pend
+	return true
+}
+
+func (r *mobilityRegistry) deletePending(key string) {
+	if pend, ok := r.pending[key]; ok {
+		pend.timer.Stop()
+		delete(r.pending, key)
+	}
+}
+
+// newAuthHandler wraps the auth handler of a listener so that the message integrity key of the
+// clients with a pending request carrying a MOBILITY-TICKET is recorded for signing the response.
+func (r *mobilityRegistry) newAuthHandler(listener string, h a12n.AuthHandler) a12n.AuthHandler {
+	if h == nil {
+		return nil
+	}
+	return func(username, realm string, src net.Addr) ([]byte, bool) {
+		key, ok := h(username, realm, src)
+		if ok && src != nil {
+			r.lock.Lock()
+			for _, pend := range r.pending {
+				if pend.listener == listener && pend.origin.String() == src.String() {
+					pend.key = key
+				}
+			}
+			r.lock.Unlock()
+		}
+		return key, ok
+	}
+}
+
+// inbound processes a packet received by a readloop. Returns the client address of the
+// allocation the packet belongs to, the readloop owning the allocation if the packet comes from
+// a moved client, and whether the packet is to be processed at all.
+func (r *mobilityRegistry) inbound(c *mobilityPacketConn, p []byte, addr net.Addr) (net.Addr, *mobilityPacketConn, bool) {
+	var m *stun.Message
+	if stun.IsMessage(p) && stunClass(p) == 0 {
+		m = &stun.Message{Raw: append([]byte{}, p...)}
+		if err := m.Decode(); err != nil {
+			m = nil
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if m != nil {
+		if v, err := m.Get(AttrMobilityTicket); err == nil {
+			var username stun.Username
+			username.GetFrom(m) //nolint:errcheck
+			switch m.Type.Method {
+			case stun.MethodAllocate:
+				// the unauthenticated first Allocate is challenged by the TURN server
+				if !m.Contains(stun.AttrMessageIntegrity) {
+					break
+				}
+				if !r.addPending(m.TransactionID, &mobilityPending{kind: mobilityAllocate,
+					listener: c.listener, origin: addr, client: addr,
+					username: username.String(), conn: c}) {
+					c.log.Debugf("Too many pending mobility requests: not issuing a "+
+						"mobility ticket to client %s", addr.String())
+				}
+			case stun.MethodRefresh:
+				// only the user of the allocation may move it
+				sess, ok := r.tickets[string(v)]
+				if !ok || sess.listener != c.listener || username.String() != sess.username {
+					c.log.Debugf("Rejecting refresh request from client %s: invalid mobility "+
+						"ticket", addr.String())
+					c.reject(m, addr)
+					return nil, nil, false
+				}
+				if !r.addPending(m.TransactionID, &mobilityPending{kind: mobilityRefresh,
+					listener: c.listener, origin: sess.origin, client: addr, conn: c,
+					session: sess}) {
+					// the allocation cannot be moved without tracking the response
+					c.log.Debugf("Too many pending mobility requests: dropping refresh "+
+						"request from client %s", addr.String())
+					return nil, nil, false
+				}
+				return sess.origin, sess.owner, true
+			}
+		}
+	}
+
+	if sess, ok := r.aliases[mobilityKey(c.listener, addr)]; ok {
+		return sess.origin, sess.owner, true
+	}
+	if sess, ok := r.sessions[mobilityKey(c.listener, addr)]; ok &&
+		sess.current.String() != addr.String() {
+		// the client has moved away from the address
+		return nil, nil, false
+	}
+
+	return addr, nil, true
+}
+
+// outbound processes a packet sent by a readloop. Returns the packet, with a MOBILITY-TICKET
+// added to the successful responses to the requests carrying one, and the current address of
+// the client.
+func (r *mobilityRegistry) outbound(c *mobilityPacketConn, p []byte, addr net.Addr) ([]byte, net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if stun.IsMessage(p) && stunClass(p) != 0 {
+		var txid [stun.TransactionIDSize]byte
+		copy(txid[:], p[8:20])
+		if pend, ok := r.pending[string(txid[:])]; ok && pend.listener == c.listener &&
+			pend.origin.String() == addr.String() {
+			r.deletePending(string(txid[:]))
+			return r.respond(pend, p), pend.client
+		}
+	}
+
+	if sess, ok := r.sessions[mobilityKey(c.listener, addr)]; ok {
+		return p, sess.current
+	}
+
+	return p, addr
+}
+
+// respond processes the response to a request carrying a MOBILITY-TICKET.
+func (r *mobilityRegistry) respond(pend *mobilityPending, p []byte) []byte {
+	if stunClass(p) != 0x0100 {
+		return p
+	}
+
+	var ticket string
+	switch pend.kind {
+	case mobilityAllocate:
+		key := mobilityKey(pend.listener, pend.origin)
+		sess, ok := r.sessions[key]
+		if !ok {
+			sess = &mobilitySession{listener: pend.listener, origin: pend.origin,
+				current: pend.origin, username: pend.username, owner: pend.conn}
+			r.sessions[key] = sess
+			r.rotate(sess)
+		}
+		ticket = sess.tickets[0]
+	case mobilityRefresh:
+		sess := pend.session
+		if r.sessions[mobilityKey(sess.listener, sess.origin)] != sess {
+			// the allocation has been deleted in the meantime
+			return p
+		}
+		if sess.current.String() != pend.client.String() {
+			if r.aliases[mobilityKey(sess.listener, sess.current)] == sess {
+				delete(r.aliases, mobilityKey(sess.listener, sess.current))
+			}
+			sess.current = pend.client
+			if sess.current.String() != sess.origin.String() {
+				r.aliases[mobilityKey(sess.listener, sess.current)] = sess
+			}
+			pend.conn.log.Infof("Allocation of client %s moved to %s", sess.origin.String(),
+				sess.current.String())
+		}
+		ticket = r.rotate(sess)
+	}
+
+	if pend.key == nil {
+		return p
+	}
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil || !m.Contains(stun.AttrMessageIntegrity) {
+		return p
+	}
+	raw, err := resignMessage(m, pend.key, func(t stun.AttrType) bool {
+		return t == AttrMobilityTicket
+	}, []stun.RawAttribute{{Type: AttrMobilityTicket, Value: []byte(ticket)}})
+	if err != nil {
+		return p
+	}
+	return raw
+}
+
+// mobilityPacketConn is a listener net.PacketConn that translates the addresses of the moved
+// clients.
+type mobilityPacketConn struct {
+	net.PacketConn
+	listener string
+	registry *mobilityRegistry
+	inbox    chan mobilityPacket
+	wake     atomic.Bool
+	log      logging.LeveledLogger
+}
+
+// mobilityPacket is a packet handed over from another readloop.
+type mobilityPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+func (r *mobilityRegistry) newPacketConn(c net.PacketConn, listener string, log logging.LeveledLogger) net.PacketConn {
+	return &mobilityPacketConn{
+		PacketConn: c,
+		listener:   listener,
+		registry:   r,
+		inbox:      make(chan mobilityPacket, mobilityInboxSize),
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn. The packets of the moved clients are returned with the
+// client address of the allocation, and the packets of the allocations of another readloop are
+// handed over to that readloop.
+func (c *mobilityPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		select {
+		case pkt := <-c.inbox:
+			return copy(p, pkt.data), pkt.addr, nil
+		default:
+		}
+
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) && c.wake.Swap(false) {
+				// woken up to read the inbox
+				if err := c.PacketConn.SetReadDeadline(time.Time{}); err != nil {
+					return 0, nil, err
+				}
+				continue
+			}
+			return n, addr, err
+		}
+
+		origin, owner, ok := c.registry.inbound(c, p[:n], addr)
+		switch {
+		case !ok:
+			continue
+		case owner != nil && owner != c:
+			owner.deliver(p[:n], origin)
+			continue
+		}
+		return n, origin, nil
+	}
+}
+
+// deliver hands over a packet to the readloop, dropping the packet if the inbox is full.
+func (c *mobilityPacketConn) deliver(p []byte, addr net.Addr) {
+	select {
+	case c.inbox <- mobilityPacket{data: append([]byte{}, p...), addr: addr}:
+	default:
+		c.log.Debugf("Dropping packet from client %s: inbox full", addr.String())
+		return
+	}
+	c.wake.Store(true)
+	c.PacketConn.SetReadDeadline(time.Now()) //nolint:errcheck
+}
+
+// WriteTo writes to the PacketConn, sending the packets of the moved clients to their current
+// address.
+func (c *mobilityPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	out, dst := c.registry.outbound(c, p, addr)
+	if _, err := c.PacketConn.WriteTo(out, dst); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// reject answers a request carrying an invalid MOBILITY-TICKET with a 400 (Bad Request) error.
+func (c *mobilityPacketConn) reject(m *stun.Message, addr net.Addr) {
+	res, err := stun.Build(
+		stun.NewTransactionIDSetter(m.TransactionID),
+		stun.NewType(m.Type.Method, stun.ClassErrorResponse),
+		stun.CodeBadRequest,
+		stun.Fingerprint,
+	)
+	if err != nil {
+		c.log.Debugf("could not build error response: %s", err.Error())
+		return
+	}
+
+	if _, err := c.PacketConn.WriteTo(res.Raw, addr); err != nil {
+		c.log.Debugf("could not send error response to client %s: %s",
+			addr.String(), err.Error())
+	}
+}
@@ -0,0 +1,105 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+const (
+	mtuReasonMaxDatagramSize = "max_datagram_size"
+	mtuReasonPathMTU         = "path_mtu"
+
+	// the size of the IP and UDP headers
+	udp4HeaderSize = 20 + 8
+	udp6HeaderSize = 40 + 8
+)
+
+// detectMaxDatagramSize returns the largest datagram that can be sent without fragmentation over
+// any of the network interfaces that are up, based on the smallest interface MTU. Loopback
+// interfaces are considered only if there is no other interface.
+func detectMaxDatagramSize(ipv6 bool) (int, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 0, err
+	}
+
+	mtu, loopback := 0, 0
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.MTU <= 0 {
+			continue
+		}
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.MTU
+			continue
+		}
+		if mtu == 0 || iface.MTU < mtu {
+			mtu = iface.MTU
+		}
+	}
+	if mtu == 0 {
+		mtu = loopback
+	}
+	if mtu == 0 {
+		return 0, errors.New("no network interface is up")
+	}
+
+	header := udp4HeaderSize
+	if ipv6 {
+		header = udp6HeaderSize
+	}
+
+	return max(mtu-header, stnrv1.MinDatagramSize), nil
+}
+
+// MTUPacketConn is a relay net.PacketConn that drops the datagrams that would be fragmented on the
+// way to the peers, either because they exceed the maximum datagram size or because the kernel
+// rejects them for exceeding the path MTU, and counts the drops. This makes the loss of large
+// datagrams, e.g., video keyframes, visible instead of losing them silently to fragmentation.
+type MTUPacketConn struct {
+	net.PacketConn
+	name      string
+	maxSize   int
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewMTUPacketConn decorates a relay PacketConn with a maximum datagram size. If maxSize is zero
+// then only the datagrams rejected by the kernel for exceeding the path MTU are counted. Drops are
+// reported per listener name.
+func NewMTUPacketConn(c net.PacketConn, name string, maxSize int, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &MTUPacketConn{
+		PacketConn: c,
+		name:       name,
+		maxSize:    maxSize,
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// WriteTo writes to the PacketConn. Dropped datagrams are not reported as an error (as if the
+// datagram was lost on the wire).
+func (c *MTUPacketConn) WriteTo(p []byte, peerAddr net.Addr) (int, error) {
+	if c.maxSize > 0 && len(p) > c.maxSize {
+		c.drop(p, peerAddr, mtuReasonMaxDatagramSize)
+		return len(p), nil
+	}
+
+	n, err := c.PacketConn.WriteTo(p, peerAddr)
+	if err != nil && errors.Is(err, syscall.EMSGSIZE) {
+		c.drop(p, peerAddr, mtuReasonPathMTU)
+		return len(p), nil
+	}
+
+	return n, err
+}
+
+func (c *MTUPacketConn) drop(p []byte, peerAddr net.Addr, reason string) {
+	c.log.Tracef("Dropping %d byte datagram to peer %s (reason: %s)", len(p), peerAddr, reason)
+	c.telemetry.IncrementMTUDrops(c.name, reason)
+}
@@ -0,0 +1,45 @@
+package stunner
+
+import (
+	"net"
+)
+
+// NAT64PacketConn is a relay net.PacketConn that reaches IPv4 peers over IPv6 through a NAT64
+// gateway (RFC 6146). IPv4 peer addresses are translated into IPv4-embedded IPv6 addresses using a
+// /96 NAT64 prefix (RFC 6052) when sending, and packets received from IPv4-embedded IPv6 addresses
+// are reported as coming from the corresponding IPv4 peer, so that clients can keep on using IPv4
+// peer addresses. Requires a relay socket that can send to IPv6 addresses.
+type NAT64PacketConn struct {
+	net.PacketConn
+	prefix net.IP
+}
+
+// NewNAT64PacketConn decorates a relay PacketConn with NAT64 address translation using the given
+// /96 prefix.
+func NewNAT64PacketConn(c net.PacketConn, prefix *net.IPNet) net.PacketConn {
+	return &NAT64PacketConn{PacketConn: c, prefix: prefix.IP.To16()}
+}
+
+// ReadFrom reads a packet from a peer, translating IPv4-embedded IPv6 source addresses to IPv4.
+func (c *NAT64PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if u, ok := addr.(*net.UDPAddr); ok && u.IP.To4() == nil && len(u.IP) == net.IPv6len &&
+		u.IP[:12].Equal(c.prefix[:12]) {
+		addr = &net.UDPAddr{IP: net.IP(u.IP[12:16]).To16(), Port: u.Port}
+	}
+	return n, addr, err
+}
+
+// WriteTo writes a packet to a peer, translating IPv4 peer addresses into IPv4-embedded IPv6
+// addresses.
+func (c *NAT64PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		if ip4 := u.IP.To4(); ip4 != nil {
+			ip6 := make(net.IP, net.IPv6len)
+			copy(ip6, c.prefix[:12])
+			copy(ip6[12:], ip4)
+			addr = &net.UDPAddr{IP: ip6, Port: u.Port}
+		}
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
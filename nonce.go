@@ -0,0 +1,183 @@
+package stunner
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// NonceTrackerSize is the maximum number of nonces tracked per listener. Nonces handed out above
+// this limit are subject only to the built-in nonce lifetime of the TURN server.
+var NonceTrackerSize = 1 << 16
+
+const (
+	maxNonceLifetime = time.Duration(stnrv1.MaxNonceTTL) * time.Second
+	noncePurgePeriod = time.Minute
+)
+
+// NoncePolicy returns the nonce lifetime and the nonce regeneration policy.
+type NoncePolicy = func() (time.Duration, string)
+
+type nonceEntry struct {
+	issued, lastUsed time.Time
+	stale, retried   bool
+}
+
+// nonceTracker keeps track of the nonces handed out to the clients of a listener. Nonces are
+// tracked per client, since the TURN server may hand out the same nonce to different clients.
+type nonceTracker struct {
+	nonces    map[string]*nonceEntry // keyed by client address and nonce
+	lastPurge time.Time
+	lock      sync.Mutex
+	now       func() time.Time
+}
+
+func newNonceTracker(clock util.Clock) *nonceTracker {
+	return &nonceTracker{nonces: map[string]*nonceEntry{}, lastPurge: clock.Now(), now: clock.Now}
+}
+
+// issue records a nonce handed out to a client.
+func (t *nonceTracker) issue(key string, stale bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	if now.Sub(t.lastPurge) > noncePurgePeriod {
+		for k, e := range t.nonces {
+			if now.Sub(e.issued) > maxNonceLifetime {
+				delete(t.nonces, k)
+			}
+		}
+		t.lastPurge = now
+	}
+
+	if _, ok := t.nonces[key]; ok {
+		return
+	}
+	if len(t.nonces) >= NonceTrackerSize {
+		return
+	}
+	t.nonces[key] = &nonceEntry{issued: now, lastUsed: now, stale: stale}
+}
+
+// use checks whether a nonce used by a client is still valid according to the policy and returns
+// true if it should be retired, plus whether this is the first retry after a stale nonce.
+func (t *nonceTracker) use(key string, ttl time.Duration, renewal string) (bool, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	e, ok := t.nonces[key]
+	if !ok {
+		return false, false
+	}
+
+	now := t.now()
+	since := e.issued
+	if renewal == stnrv1.NonceRenewalSliding {
+		since = e.lastUsed
+	}
+	if ttl > 0 && now.Sub(since) > ttl {
+		delete(t.nonces, key)
+		return true, false
+	}
+	e.lastUsed = now
+
+	retry := e.stale && !e.retried
+	e.retried = true
+
+	return false, retry
+}
+
+// NoncePacketConn is a net.PacketConn that enforces the nonce lifetime policy on a UDP listener
+// and counts Stale Nonce errors and the subsequent client retries. Requests carrying a nonce that
+// should be retired are rewritten to carry an invalid nonce, so that the TURN server rejects them
+// with a Stale Nonce error and a fresh nonce.
+type NoncePacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	tracker   *nonceTracker
+	policy    NoncePolicy
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewNoncePacketConn decorates a listener PacketConn with nonce lifetime enforcement.
+func NewNoncePacketConn(c net.PacketConn, l *object.Listener, t *nonceTracker, policy NoncePolicy, tm *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &NoncePacketConn{
+		PacketConn: c,
+		listener:   l,
+		tracker:    t,
+		policy:     policy,
+		telemetry:  tm,
+		log:        log,
+	}
+}
+
+// stunClass returns the class bits of a STUN message type.
+func stunClass(p []byte) uint16 {
+	return binary.BigEndian.Uint16(p[0:2]) & 0x0110
+}
+
+// ReadFrom reads from the PacketConn, retiring expired nonces.
+func (c *NoncePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err != nil || addr == nil || !stun.IsMessage(p[:n]) || stunClass(p) != 0 {
+		return n, addr, err
+	}
+
+	// decode in place: attribute values point into the packet buffer
+	m := &stun.Message{Raw: p[:n]}
+	if derr := m.Decode(); derr != nil {
+		return n, addr, err
+	}
+	nonce, gerr := m.Get(stun.AttrNonce)
+	if gerr != nil {
+		return n, addr, err
+	}
+
+	ttl, renewal := c.policy()
+	retire, retry := c.tracker.use(addr.String()+"/"+string(nonce), ttl, renewal)
+	if retry {
+		c.telemetry.IncrementStaleNonceRetry(c.listener.Name)
+	}
+	if retire {
+		c.log.Debugf("retiring nonce used by client %s", addr.String())
+		// an all-zero nonce encodes a zero timestamp, which the TURN server rejects as stale
+		for i := range nonce {
+			nonce[i] = '0'
+		}
+	}
+
+	return n, addr, err
+}
+
+// WriteTo writes to the PacketConn, tracking the nonces handed out to clients.
+func (c *NoncePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if !stun.IsMessage(p) || stunClass(p) != 0x0110 {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err == nil {
+		var nonce stun.Nonce
+		if err := nonce.GetFrom(m); err == nil {
+			var code stun.ErrorCodeAttribute
+			stale := code.GetFrom(m) == nil && code.Code == stun.CodeStaleNonce
+			if stale {
+				c.telemetry.IncrementStaleNonce(c.listener.Name)
+			}
+			c.tracker.issue(addr.String()+"/"+nonce.String(), stale)
+		}
+	}
+
+	return c.PacketConn.WriteTo(p, addr)
+}
@@ -0,0 +1,235 @@
+package stunner
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+const (
+	oauthPurgePeriod = time.Minute
+	stunMagicCookie  = 0x2112A442
+)
+
+type oauthSession struct {
+	kid    string
+	macKey []byte
+	expiry time.Time
+}
+
+// oauthRegistry keeps track of the session keys obtained from the access tokens presented by
+// clients in third-party authorization (RFC 7635). Access tokens are sent only in the Allocate
+// (and Refresh) requests, so the session key is stored per client transport address for
+// authenticating the subsequent requests.
+type oauthRegistry struct {
+	sessions  map[string]oauthSession // keyed by client address
+	lastPurge time.Time
+	lock      sync.RWMutex
+}
+
+func newOAuthRegistry() *oauthRegistry {
+	return &oauthRegistry{sessions: map[string]oauthSession{}, lastPurge: time.Now()}
+}
+
+func (r *oauthRegistry) add(src net.Addr, sess oauthSession) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPurge) > oauthPurgePeriod {
+		for k, s := range r.sessions {
+			if now.After(s.expiry) {
+				delete(r.sessions, k)
+			}
+		}
+		r.lastPurge = now
+	}
+
+	r.sessions[src.String()] = sess
+}
+
+func (r *oauthRegistry) get(src net.Addr) (oauthSession, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	sess, ok := r.sessions[src.String()]
+	return sess, ok
+}
+
+func (r *oauthRegistry) delete(src net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.sessions, src.String())
+}
+
+// oauthKey returns the session key for a client authenticating with third-party authorization.
+func (s *Stunner) oauthKey(username string, src net.Addr) ([]byte, bool) {
+	sess, ok := s.oauth.get(src)
+	if !ok || sess.kid != username || time.Now().After(sess.expiry) {
+		return nil, false
+	}
+	return sess.macKey, true
+}
+
+// inspectOAuth obtains the session key from the access token carried in a STUN request, if any.
+func (s *Stunner) inspectOAuth(p []byte, src net.Addr) {
+	if src == nil || !stun.IsMessage(p) || stunClass(p) != 0 {
+		return
+	}
+
+	auth := s.GetAuth()
+	oauth, keys := auth.GetOAuth()
+	if oauth == nil {
+		return
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil {
+		return
+	}
+	token, err := m.Get(stun.AttrType(a12n.AttrAccessToken))
+	if err != nil {
+		return
+	}
+	var username stun.Username
+	if err := username.GetFrom(m); err != nil {
+		return
+	}
+
+	kid := username.String()
+	key, ok := keys[kid]
+	if !ok {
+		auth.Log.Infof("oauth auth request: failed: unknown key ID %q", kid)
+		return
+	}
+
+	t, err := a12n.DecryptOAuthToken(key, oauth.ServerName, token)
+	if err != nil {
+		auth.Log.Infof("oauth auth request: failed: %s", err.Error())
+		return
+	}
+
+	auth.Log.Debugf("oauth auth request: valid access token for client %s, expiry: %s",
+		src.String(), t.Expiry().String())
+	s.oauth.add(src, oauthSession{kid: kid, macKey: t.MACKey, expiry: t.Expiry()})
+}
+
+// decorateOAuth adds the THIRD-PARTY-AUTHORIZATION attribute to Unauthorized error responses, if
+// an authorization server is configured.
+func (s *Stunner) decorateOAuth(p []byte) []byte {
+	if !stun.IsMessage(p) || stunClass(p) != 0x0110 {
+		return p
+	}
+
+	oauth, _ := s.GetAuth().GetOAuth()
+	if oauth == nil || oauth.AuthorizationServer == "" {
+		return p
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil {
+		return p
+	}
+	var code stun.ErrorCodeAttribute
+	if err := code.GetFrom(m); err != nil || code.Code != stun.CodeUnauthorized {
+		return p
+	}
+
+	m.Add(stun.AttrType(a12n.AttrThirdPartyAuthorization), []byte(oauth.AuthorizationServer))
+	return m.Raw
+}
+
+// OAuthPacketConn is a net.PacketConn that implements the transport side of third-party
+// authorization (RFC 7635) on a UDP listener: it obtains the session keys from the access tokens
+// presented by the clients and advertises the authorization server to unauthorized clients.
+type OAuthPacketConn struct {
+	net.PacketConn
+	stunner *Stunner
+}
+
+// newOAuthPacketConn decorates a listener PacketConn with third-party authorization.
+func (s *Stunner) newOAuthPacketConn(c net.PacketConn) net.PacketConn {
+	return &OAuthPacketConn{PacketConn: c, stunner: s}
+}
+
+// ReadFrom reads from the PacketConn.
+func (c *OAuthPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.stunner.inspectOAuth(p[:n], addr)
+	}
+	return n, addr, err
+}
+
+// WriteTo writes to the PacketConn.
+func (c *OAuthPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if _, err := c.PacketConn.WriteTo(c.stunner.decorateOAuth(p), addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// oauthListener is a net.Listener that implements third-party authorization for the connections
+// of a TCP, TLS or DTLS listener.
+type oauthListener struct {
+	net.Listener
+	stunner *Stunner
+	stream  bool
+}
+
+// newOAuthListener decorates a listener with third-party authorization. Set stream to true for
+// stream-oriented transports (TCP and TLS), where STUN messages must be reassembled from the byte
+// stream.
+func (s *Stunner) newOAuthListener(l net.Listener, stream bool) net.Listener {
+	return &oauthListener{Listener: l, stunner: s, stream: stream}
+}
+
+func (l *oauthListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	c := &oauthConn{Conn: conn, stunner: l.stunner}
+	if l.stream {
+		c.stream = &stunStreamReader{}
+	}
+	return c, nil
+}
+
+type oauthConn struct {
+	net.Conn
+	stunner *Stunner
+	// the STUN message reassembler for stream-oriented transports, nil for datagram transports
+	stream *stunStreamReader
+}
+
+func (c *oauthConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	if c.stream == nil {
+		c.stunner.inspectOAuth(p[:n], c.RemoteAddr())
+		return n, err
+	}
+
+	if oauth, _ := c.stunner.GetAuth().GetOAuth(); oauth == nil {
+		c.stream.reset()
+		return n, err
+	}
+
+	c.stream.feed(p[:n], func(msg []byte) { c.stunner.inspectOAuth(msg, c.RemoteAddr()) })
+
+	return n, err
+}
+
+func (c *oauthConn) Write(p []byte) (int, error) {
+	if _, err := c.Conn.Write(c.stunner.decorateOAuth(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,174 @@
+package stunner
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// originPurgePeriod is the period of purging the origins of the clients that have not created an
+// allocation.
+const originPurgePeriod = time.Minute
+
+type originEntry struct {
+	origin string
+	bound  bool // the client has created an allocation
+	added  time.Time
+}
+
+// originRegistry keeps track of the ORIGIN attribute (0x802F, see "An Origin Attribute for the
+// STUN Protocol") presented by the clients in their Allocate requests at the listeners with an
+// origin policy. The origin is stored per client transport address, for the quota, permission
+// and event handlers, which only learn the client address.
+type originRegistry struct {
+	origins   map[string]originEntry // keyed by client address
+	lastPurge time.Time
+	lock      sync.RWMutex
+}
+
+func newOriginRegistry() *originRegistry {
+	return &originRegistry{origins: map[string]originEntry{}, lastPurge: time.Now()}
+}
+
+// set records the origin of the Allocate request of a client, an empty origin if the request
+// carries none. The origin of a client with an allocation is not changed.
+func (r *originRegistry) set(src net.Addr, origin string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPurge) > originPurgePeriod {
+		for k, e := range r.origins {
+			if !e.bound && now.Sub(e.added) > originPurgePeriod {
+				delete(r.origins, k)
+			}
+		}
+		r.lastPurge = now
+	}
+
+	key := src.String()
+	if e, ok := r.origins[key]; ok && e.bound {
+		return
+	}
+	if origin == "" {
+		delete(r.origins, key)
+		return
+	}
+	r.origins[key] = originEntry{origin: origin, added: now}
+}
+
+// get returns the origin of a client, or an empty string if unknown.
+func (r *originRegistry) get(src net.Addr) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.origins[src.String()].origin
+}
+
+// bind keeps the origin of a client for the lifetime of its allocation.
+func (r *originRegistry) bind(src net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if e, ok := r.origins[src.String()]; ok {
+		e.bound = true
+		r.origins[src.String()] = e
+	}
+}
+
+func (r *originRegistry) delete(src net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.origins, src.String())
+}
+
+// inspectOrigin records the origin of an Allocate request, if any.
+func (s *Stunner) inspectOrigin(p []byte, src net.Addr) {
+	if src == nil || !stun.IsMessage(p) || binary.BigEndian.Uint16(p[0:2]) != stunAllocateRequest {
+		return
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil {
+		return
+	}
+
+	origin := ""
+	if v, err := m.Get(stun.AttrOrigin); err == nil {
+		origin = stnrv1.NormalizeOrigin(string(v))
+	}
+	s.origins.set(src, origin)
+}
+
+// originPacketConn is a listener net.PacketConn that records the origin of the Allocate requests.
+type originPacketConn struct {
+	net.PacketConn
+	stunner *Stunner
+}
+
+// newOriginPacketConn decorates a listener PacketConn with origin inspection.
+func (s *Stunner) newOriginPacketConn(c net.PacketConn) net.PacketConn {
+	return &originPacketConn{PacketConn: c, stunner: s}
+}
+
+// ReadFrom reads from the PacketConn.
+func (c *originPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.stunner.inspectOrigin(p[:n], addr)
+	}
+	return n, addr, err
+}
+
+// originListener is a net.Listener that records the origin of the Allocate requests received on
+// the connections of a TCP, TLS or DTLS listener.
+type originListener struct {
+	net.Listener
+	stunner *Stunner
+	stream  bool
+}
+
+// newOriginListener decorates a listener with origin inspection. Set stream to true for
+// stream-oriented transports (TCP and TLS), where STUN messages must be reassembled from the byte
+// stream.
+func (s *Stunner) newOriginListener(l net.Listener, stream bool) net.Listener {
+	return &originListener{Listener: l, stunner: s, stream: stream}
+}
+
+func (l *originListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	c := &originConn{Conn: conn, stunner: l.stunner}
+	if l.stream {
+		c.stream = &stunStreamReader{}
+	}
+	return c, nil
+}
+
+type originConn struct {
+	net.Conn
+	stunner *Stunner
+	// the STUN message reassembler for stream-oriented transports, nil for datagram transports
+	stream *stunStreamReader
+}
+
+func (c *originConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	if c.stream == nil {
+		c.stunner.inspectOrigin(p[:n], c.RemoteAddr())
+		return n, err
+	}
+
+	c.stream.feed(p[:n], func(msg []byte) { c.stunner.inspectOrigin(msg, c.RemoteAddr()) })
+
+	return n, err
+}
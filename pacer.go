@@ -0,0 +1,57 @@
+package stunner
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/time/rate"
+)
+
+// pacerBurstInterval is the amount of traffic, measured in time at the pacing rate, that the pacer
+// lets through in a single burst.
+const pacerBurstInterval = 0.01 // 10 ms
+
+// pacerMinBurst is the minimum burst size of the pacer in bytes, so that a full-sized packet can
+// always be sent at once.
+const pacerMinBurst = 1500
+
+// PacedPacketConn is a relay net.PacketConn that smooths bursts toward the peers using a token
+// bucket at a configured bitrate. This protects downstream media servers from the microbursts
+// caused by TCP and TLS listeners flushing many messages at once. Writes block until the packet
+// can be sent at the pacing rate.
+type PacedPacketConn struct {
+	net.PacketConn
+	limiter *rate.Limiter
+	burst   int
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewPacedPacketConn decorates a relay PacketConn with a pacer at the given bitrate (in kbps).
+func NewPacedPacketConn(c net.PacketConn, kbps int) net.PacketConn {
+	bytesPerSec := float64(kbps) * 1000 / 8
+	burst := max(int(bytesPerSec*pacerBurstInterval), pacerMinBurst)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PacedPacketConn{
+		PacketConn: c,
+		limiter:    rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+		burst:      burst,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// WriteTo waits until the packet fits into the pacing rate and then writes it to the peer.
+func (c *PacedPacketConn) WriteTo(p []byte, peerAddr net.Addr) (int, error) {
+	// oversized packets are charged as a full burst
+	if err := c.limiter.WaitN(c.ctx, min(len(p), c.burst)); err != nil {
+		return 0, net.ErrClosed
+	}
+	return c.PacketConn.WriteTo(p, peerAddr)
+}
+
+// Close closes the relay connection and unblocks the pending writes.
+func (c *PacedPacketConn) Close() error {
+	c.cancel()
+	return c.PacketConn.Close()
+}
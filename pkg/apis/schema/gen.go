@@ -0,0 +1,150 @@
+//go:build ignore
+
+// gen generates the field descriptions from the doc comments of the API types, and the JSON
+// Schema and the CRD-style OpenAPI schema files for each API version.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/l7mp/stunner/pkg/apis/schema"
+)
+
+var apiDirs = map[string]string{
+	"v1":       "../v1",
+	"v1alpha1": "../v1alpha1",
+}
+
+func main() {
+	descs := flag.String("descriptions", "", "write the descriptions to the given Go file")
+	schemas := flag.String("schemas", "", "write the schema files to the given directory")
+	flag.Parse()
+
+	if *descs != "" {
+		if err := writeDescriptions(*descs); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *schemas != "" {
+		if err := writeSchemas(*schemas); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeDescriptions(file string) error {
+	descs := map[string]string{}
+	for pkg, dir := range apiDirs {
+		fset := token.NewFileSet()
+		pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for _, p := range pkgs {
+			for _, f := range p.Files {
+				collect(pkg, f, descs)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(descs))
+	for k := range descs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by gen.go. DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "package schema")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "// descriptions are the doc comments of the API types and the struct fields.")
+	fmt.Fprintln(&b, "var descriptions = map[string]string{")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\t%q: %q,\n", k, descs[k])
+	}
+	fmt.Fprintln(&b, "}")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, src, 0o644)
+}
+
+// collect extracts the doc comments of the struct types and their fields.
+func collect(pkg string, f *ast.File, descs map[string]string) {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.Assign != 0 {
+				continue
+			}
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			if d := clean(doc); d != "" {
+				descs[pkg+"."+ts.Name.Name] = d
+			}
+			for _, field := range st.Fields.List {
+				d := clean(field.Doc)
+				if d == "" {
+					continue
+				}
+				for _, n := range field.Names {
+					descs[pkg+"."+ts.Name.Name+"."+n.Name] = d
+				}
+			}
+		}
+	}
+}
+
+func clean(c *ast.CommentGroup) string {
+	if c == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(c.Text()), " ")
+}
+
+func writeSchemas(dir string) error {
+	for _, v := range schema.Versions() {
+		js, err := schema.JSONSchema(v)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("stunner_%s.schema.json", v)),
+			append(js, '\n'), 0o644); err != nil {
+			return err
+		}
+
+		crd, err := schema.CRDSchema(v)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("stunner_%s.crd.yaml", v)),
+			crd, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
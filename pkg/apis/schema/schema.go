@@ -0,0 +1,241 @@
+// Package schema generates the JSON Schema and the CRD-style OpenAPI schema of the STUNner
+// configuration from the Go API types, and validates configurations against the schema.
+package schema
+
+//go:generate go run gen.go -descriptions zz_generated_descriptions.go
+//go:generate go run gen.go -schemas .
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"sigs.k8s.io/yaml"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+	stnrv1a1 "github.com/l7mp/stunner/pkg/apis/v1alpha1"
+)
+
+// JSONSchemaDialect is the JSON Schema dialect of the generated JSON Schemas.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	ErrUnknownVersion = errors.New("unknown API version")
+
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// Versions returns the API versions for which a schema is available.
+func Versions() []string {
+	return []string{stnrv1.ApiVersion, stnrv1a1.ApiVersion}
+}
+
+func rootType(version string) (reflect.Type, error) {
+	switch version {
+	case stnrv1.ApiVersion:
+		return reflect.TypeOf(stnrv1.StunnerConfig{}), nil
+	case stnrv1a1.ApiVersion:
+		return reflect.TypeOf(stnrv1a1.StunnerConfig{}), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+	}
+}
+
+// New returns the OpenAPI v3 schema of the STUNner configuration for an API version.
+func New(version string) (*openapi3.Schema, error) {
+	t, err := rootType(version)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSchema(t)
+	s.Description = descriptions[typeKey(t)]
+	// the version field is mandatory and must match the API version
+	s.Required = []string{"version"}
+	if v, ok := s.Properties["version"]; ok {
+		v.Value.Enum = []any{version}
+	}
+
+	return s, nil
+}
+
+// newSchema generates the schema for a Go type from the JSON tags of the struct fields.
+func newSchema(t reflect.Type) *openapi3.Schema {
+	s := &openapi3.Schema{}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		s.Nullable = true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = &openapi3.Types{openapi3.TypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = &openapi3.Types{openapi3.TypeInteger}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = &openapi3.Types{openapi3.TypeInteger}
+		s.Min = openapi3.Float64Ptr(0)
+	case reflect.Float32, reflect.Float64:
+		s.Type = &openapi3.Types{openapi3.TypeNumber}
+	case reflect.String:
+		s.Type = &openapi3.Types{openapi3.TypeString}
+	case reflect.Slice:
+		// nil slices and maps are accepted by the JSON decoder
+		s.Type = &openapi3.Types{openapi3.TypeArray}
+		s.Nullable = true
+		s.Items = openapi3.NewSchemaRef("", newSchema(t.Elem()))
+	case reflect.Map:
+		s.Type = &openapi3.Types{openapi3.TypeObject}
+		s.Nullable = true
+		s.AdditionalProperties = openapi3.AdditionalProperties{
+			Schema: openapi3.NewSchemaRef("", newSchema(t.Elem())),
+		}
+	case reflect.Struct:
+		if t == timeType {
+			s.Type = &openapi3.Types{openapi3.TypeString}
+			s.Format = "date-time"
+			break
+		}
+		s.Type = &openapi3.Types{openapi3.TypeObject}
+		s.Properties = openapi3.Schemas{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := jsonName(f)
+			if name == "" {
+				continue
+			}
+			p := newSchema(f.Type)
+			if d, ok := descriptions[typeKey(t)+"."+f.Name]; ok {
+				p.Description = d
+			} else if d, ok := descriptions[typeKey(indirect(f.Type))]; ok {
+				p.Description = d
+			}
+			s.Properties[name] = openapi3.NewSchemaRef("", p)
+		}
+	}
+
+	return s
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// typeKey returns the key of a type in the descriptions, e.g., "v1.ListenerConfig".
+func typeKey(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func jsonName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	tag, ok := f.Tag.Lookup("json")
+	if !ok {
+		return ""
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+// JSONSchema returns the JSON Schema of the STUNner configuration for an API version.
+func JSONSchema(version string) ([]byte, error) {
+	s, err := New(version)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(js, &doc); err != nil {
+		return nil, err
+	}
+	toJSONSchema(doc)
+	doc["$schema"] = JSONSchemaDialect
+	doc["title"] = fmt.Sprintf("STUNner configuration (%s)", version)
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// toJSONSchema converts an OpenAPI v3.0 schema into JSON Schema: nullable types are rewritten
+// into a type list.
+func toJSONSchema(s map[string]any) {
+	if n, ok := s["nullable"].(bool); ok {
+		delete(s, "nullable")
+		if t, ok := s["type"].(string); ok && n {
+			s["type"] = []any{t, "null"}
+		}
+	}
+	if ps, ok := s["properties"].(map[string]any); ok {
+		for _, p := range ps {
+			if p, ok := p.(map[string]any); ok {
+				toJSONSchema(p)
+			}
+		}
+	}
+	for _, k := range []string{"items", "additionalProperties"} {
+		if p, ok := s[k].(map[string]any); ok {
+			toJSONSchema(p)
+		}
+	}
+}
+
+// CRDSchema returns the schema of the STUNner configuration for an API version in the format
+// used in the "openAPIV3Schema" field of a Kubernetes CustomResourceDefinition.
+func CRDSchema(version string) ([]byte, error) {
+	s, err := New(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(map[string]any{"openAPIV3Schema": s})
+}
+
+// ValidateAgainstSchema validates a STUNner configuration in JSON or YAML format against the
+// schema of the API version specified in the "version" field of the configuration. Note that the
+// schema checks only the structure of the configuration, call Validate on the parsed config to
+// perform the semantic checks.
+func ValidateAgainstSchema(conf []byte) error {
+	js, err := yaml.YAMLToJSON(conf)
+	if err != nil {
+		return fmt.Errorf("could not parse config: %w", err)
+	}
+
+	var doc any
+	if err := json.Unmarshal(js, &doc); err != nil {
+		return fmt.Errorf("could not parse config: %w", err)
+	}
+
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return errors.New("invalid config: expected an object")
+	}
+	version, _ := obj["version"].(string)
+	s, err := New(version)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := s.VisitJSON(doc, openapi3.MultiErrors()); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+func TestValidateAgainstSchema(t *testing.T) {
+	conf, err := yaml.Marshal(stnrv1.StunnerConfig{
+		ApiVersion: stnrv1.ApiVersion,
+		Admin:      stnrv1.AdminConfig{LogLevel: "all:INFO"},
+		Auth: stnrv1.AuthConfig{
+			Type:        "static",
+			Credentials: map[string]string{"username": "user", "password": "pass"},
+		},
+		Listeners: []stnrv1.ListenerConfig{{
+			Name:     "udp",
+			Protocol: "TURN-UDP",
+			Port:     3478,
+			Routes:   []string{"media"},
+		}},
+		Clusters: []stnrv1.ClusterConfig{{
+			Name:      "media",
+			Type:      "STATIC",
+			Endpoints: []string{"10.0.0.0/8"},
+		}},
+	})
+	assert.NoError(t, err, "marshal")
+	assert.NoError(t, ValidateAgainstSchema(conf), "valid config")
+
+	for _, c := range []struct {
+		name, conf string
+	}{
+		{"no version", `{"admin":{}}`},
+		{"unknown version", `{"version":"v2"}`},
+		{"not an object", `["v1"]`},
+		{"string port", `{"version":"v1","listeners":[{"name":"udp","port":"3478"}]}`},
+		{"fractional port", `{"version":"v1","listeners":[{"name":"udp","port":3478.5}]}`},
+		{"numeric credential", `{"version":"v1","auth":{"credentials":{"password":1}}}`},
+		{"routes not a list", "version: v1\nlisteners:\n- name: udp\n  routes: media\n"},
+	} {
+		assert.Error(t, ValidateAgainstSchema([]byte(c.conf)), c.name)
+	}
+
+	// v1alpha1 configs are validated against the v1alpha1 schema
+	assert.NoError(t, ValidateAgainstSchema([]byte(`{"version":"v1alpha1","auth":{"type":"plaintext",`+
+		`"credentials":{"username":"user","password":"pass"}},"listeners":[{"name":"udp","port":3478}]}`)),
+		"v1alpha1")
+}
+
+func TestGeneratedSchemasUpToDate(t *testing.T) {
+	for _, v := range Versions() {
+		js, err := JSONSchema(v)
+		assert.NoError(t, err, "JSON schema")
+		file, err := os.ReadFile(fmt.Sprintf("stunner_%s.schema.json", v))
+		assert.NoError(t, err, "read JSON schema")
+		assert.Equal(t, string(append(js, '\n')), string(file),
+			"JSON schema for %s out of date, run go generate", v)
+
+		crd, err := CRDSchema(v)
+		assert.NoError(t, err, "CRD schema")
+		file, err = os.ReadFile(fmt.Sprintf("stunner_%s.crd.yaml", v))
+		assert.NoError(t, err, "read CRD schema")
+		assert.Equal(t, string(crd), string(file), "CRD schema for %s out of date, run go generate", v)
+	}
+}
@@ -0,0 +1,241 @@
+// Code generated by gen.go. DO NOT EDIT.
+
+package schema
+
+// descriptions are the doc comments of the API types and the struct fields.
+var descriptions = map[string]string{
+	"v1.AdminConfig":                                "AdminConfig holds the administrative configuration.",
+	"v1.AdminConfig.AdminEndpoint":                  "AdminEndpoint is the URI of the form `http://address:port` at which the admin API is served, i.e., the endpoints that change the state of the server (e.g., `/drain`, `/promote`, `/credentials` or `/tap`), the read-only introspection endpoints and the handlers registered by the embedder. The health-check endpoint serves only `/live`, `/ready` and `/status`. The scheme (`http://`) is mandatory. If no address is specified then the admin API binds to the loopback address 127.0.0.1, and if no port is specified then the default port is 8087. Requires AdminToken to be set. Default is to disable the admin API.",
+	"v1.AdminConfig.AdminToken":                     "AdminToken is the bearer token the clients of the admin API must present in the `Authorization: Bearer <token>` request header. Mandatory if AdminEndpoint is set.",
+	"v1.AdminConfig.ConfigId":                       "ConfigId is an opaque identifier of the config, e.g., a checksum of the rendered config set by the operator. STUNner does not interpret the identifier, it only echoes it in the status and the metrics, so that the operator can verify which exact config the dataplane is running.",
+	"v1.AdminConfig.ErrorReasons":                   "ErrorReasons customizes the reason phrases of the STUN/TURN error responses sent to the clients, e.g., to point users to a support page on authentication failures. The keys are the error codes (e.g., \"401\" or \"403\") and the values are Go text templates, which can refer to the error code as {{.Code}}, the original reason phrase as {{.Reason}}, the STUN method as {{.Method}} and the name of the listener as {{.Listener}}. Reason phrases longer than 763 bytes are truncated. Error responses carrying a MESSAGE-INTEGRITY attribute are never modified. Default is empty, which keeps the reason phrases of the TURN server.",
+	"v1.AdminConfig.GCBallast":                      "GCBallast is the size of a memory ballast in MiB: a large allocation that is never used, which increases the heap size the garbage collection target percentage is computed from and therefore makes collections less frequent on instances with a small live heap. The ballast is never touched, so it does not consume physical memory. Default is 0, which disables the ballast.",
+	"v1.AdminConfig.GCMemoryLimit":                  "GCMemoryLimit sets a soft memory limit for the process in MiB, like the GOMEMLIMIT environment variable: the garbage collector runs more often as the memory usage approaches the limit. Default is 0, which keeps the Go runtime default (GOMEMLIMIT, or no limit).",
+	"v1.AdminConfig.GCPercent":                      "GCPercent sets the garbage collection target percentage of the process, like the GOGC environment variable: a collection is triggered when the heap grows by this percentage since the last collection. Set to -1 to disable the garbage collector until the memory limit is reached, which requires GCMemoryLimit to be set. Default is 0, which keeps the Go runtime default (GOGC, or 100).",
+	"v1.AdminConfig.GeoIPDatabase":                  "GeoIPDatabase is the path to a MaxMind GeoIP2 or GeoLite2 country (or city) database in the MMDB format. If set, clients are geolocated by their IP address: the country code of the client is added to the access logs and the allocation metrics and listeners can filter clients by country. Default is to disable geolocation.",
+	"v1.AdminConfig.HealthCheckEndpoint":            "HealthCheckEndpoint is the URI of the form `http://address:port` exposed for external HTTP health-checking. A liveness probe responder will be exposed on path `/live` and readiness probe on path `/ready`. The scheme (`http://`) is mandatory, and if no port is specified then the default port is 8086. If ignored, then the default is to enable health-checking at `http://0.0.0.0:8086`. Set to a pointer to an empty string to disable health-checking.",
+	"v1.AdminConfig.LicenseConfig":                  "LicenseConfig describes the licensing info to be used to check subscription status with the license server.",
+	"v1.AdminConfig.LogLevel":                       "LogLevel is the desired log verbosity, e.g.: \"stunner:TRACE,all:INFO\". Default is \"all:INFO\".",
+	"v1.AdminConfig.ManagedBy":                      "ManagedBy identifies the manager issuing the config, e.g., \"file\" for configs loaded from a config file, \"api\" for configs pushed via the admin API or \"operator\" for configs rendered by the STUNner gateway operator. Listeners and clusters without an explicit manager are owned by this manager. Default is empty, which leaves the objects unowned.",
+	"v1.AdminConfig.MetricsDisabledLabels":          "MetricsDisabledLabels is a list of labels to be removed from all the exported metrics, e.g., \"country\", \"target\", \"namespace\" or \"service\", in order to limit the cardinality of the metrics on large public-facing gateways. The measurements that differ only in the removed labels are aggregated. The \"name\" label cannot be removed. Default is empty.",
+	"v1.AdminConfig.MetricsEndpoint":                "MetricsEndpoint is the URI in the form `http://address:port/path` at which HTTP metric requests are served. The scheme (`http://`\") is mandatory. Default is to expose no metric endpoints.",
+	"v1.AdminConfig.MetricsLabelLimit":              "MetricsLabelLimit caps the number of distinct values exported for each label (except the \"name\" label): once the limit is reached, measurements with new values of the label are reported with the value \"other\". Default is 0, meaning no limit.",
+	"v1.AdminConfig.Name":                           "Name of the server. Default is \"default-stunnerd\".",
+	"v1.AdminConfig.OffloadEngine":                  "OffloadEngine defines the dataplane offload mode, either \"None\", \"XDP\", \"TC\", or \"Auto\". Set to \"Auto\" to let STUNner find the optimal offload mode. Default is \"None\".",
+	"v1.AdminConfig.OffloadInterfaces":              "OffloadInterfaces explicitly specifies the interfaces on which to enable the offload engine. Empty list means to enable offload on all interfaces (this is the default).",
+	"v1.AdminConfig.OwnershipPolicy":                "OwnershipPolicy defines what happens when a config from one manager would modify or delete listeners or clusters owned by another manager: \"ignore\" applies the config silently, \"warn\" applies the config but reports a configuration warning for each conflicting object, and \"reject\" refuses the config and keeps the running config. The policy of the running config is enforced. Default is \"ignore\".",
+	"v1.AdminConfig.ReconcileDebounce":              "ReconcileDebounce is the minimum time between two consecutive reconciliations, in seconds. Config updates arriving faster, e.g., from a fast-churning controller, are coalesced: only the latest update is applied once the debounce interval has elapsed since the last reconciliation. Default is 0, which applies each config update immediately.",
+	"v1.AdminConfig.RequireFingerprint":             "RequireFingerprint makes UDP listeners reject STUN requests that do not carry a valid FINGERPRINT attribute. Default is false.",
+	"v1.AdminConfig.RequireMessageIntegrity":        "RequireMessageIntegrity makes UDP listeners reject STUN requests that do not carry a MESSAGE-INTEGRITY attribute, including STUN Binding requests, whose MESSAGE-INTEGRITY is verified with the long-term credentials of the client. Unauthenticated Allocate requests are exempt, since these are answered by the authentication challenge. Default is false.",
+	"v1.AdminConfig.SelfCheckInterval":              "SelfCheckInterval is the period of the dataplane self-check in seconds: when set, STUNner periodically performs a real TURN allocation against a local listener using throwaway credentials, and the readiness probe fails while the last check failed. Default is 0, which disables the self-check.",
+	"v1.AdminConfig.SelfCheckListener":              "SelfCheckListener is the name of the listener to perform the dataplane self-check against. Default is the first TURN listener in alphabetical order that does not expect a PROXY protocol header.",
+	"v1.AdminConfig.UserQuota":                      "UserQuota defines the number of permitted TURN allocatoins per username. Affects allocation created on any listener. Default is 0, meaning no quota is enforced.",
+	"v1.AdminConfig.WatchdogTimeout":                "WatchdogTimeout is the time in seconds after which the watchdog considers the dataplane of a UDP listener wedged and restarts the listener: a readloop is wedged if it has not returned to reading from the socket for this long, e.g., because it is stuck in a deadlock, or if it has not received a packet for this long despite the socket having packets queued. Restarting a listener drops its allocations. Default is 0, which disables the watchdog.",
+	"v1.AdminStatus":                                "AdminStatus represents the administrative status.",
+	"v1.AuthConfig":                                 "Auth specifies the STUN/TURN authentication mechanism used by STUNner.",
+	"v1.AuthConfig.AllowedSources":                  "AllowedSources is the list of client source ranges, given as IP addresses or CIDR prefixes, that may use TURN anonymously with the \"none\" authentication type: clients from these ranges are accepted with an arbitrary username and an empty password, while other clients can use STUN only. Intended for local development and automated tests. Default is the loopback ranges \"127.0.0.0/8\" and \"::1/128\".",
+	"v1.AuthConfig.Credentials":                     "Credentials specifies the authententication credentials: for \"static\" at least the keys \"username\" and \"password\" must be set, for \"ephemeral\" the key \"secret\" specifying the shared authentication secret must be set.",
+	"v1.AuthConfig.LDAP":                            "LDAP configures the LDAP credential backend for the \"ldap\" authentication type.",
+	"v1.AuthConfig.NonceRenewal":                    "NonceRenewal is the nonce regeneration policy: \"fixed\" retires a nonce after NonceTTL has passed since it was issued, while \"sliding\" retires a nonce only after it has not been used for NonceTTL, which avoids retry storms for active clients. Nonces are always retired after one hour. Default is \"fixed\".",
+	"v1.AuthConfig.NonceTTL":                        "NonceTTL is the lifetime of the nonces handed out to clients, in seconds. Clients using an expired nonce receive a Stale Nonce error with a fresh nonce and must retry the request. Shorter lifetimes provide better replay protection at the cost of more client retries. Cannot exceed one hour, the built-in nonce lifetime of the TURN server. Enforced on UDP listeners only. Default is zero, which means the built-in nonce lifetime.",
+	"v1.AuthConfig.OAuth":                           "OAuth configures third-party authorization (RFC 7635) for the \"oauth\" authentication type.",
+	"v1.AuthConfig.Realm":                           "Realm defines the STUN/TURN authentication realm.",
+	"v1.AuthConfig.Type":                            "Type of the STUN/TURN authentication mechanism (\"static\", \"ephemeral\", \"oauth\", \"ldap\" or \"none\"). The deprecated type name \"plaintext\" is accepted for \"static\" and the deprecated type name \"longterm\" is accepted for \"ephemeral\" for compatibility with older versions.",
+	"v1.AuthStatus":                                 "AuthStatus represents the authentication status.",
+	"v1.Capabilities":                               "Capabilities is a machine-readable report of the features available in a STUNner build and the limits detected on the host at startup, intended to help triaging version and feature mismatches.",
+	"v1.Capabilities.AuthTypes":                     "AuthTypes lists the supported authentication types.",
+	"v1.Capabilities.ClusterTypes":                  "ClusterTypes lists the supported cluster types.",
+	"v1.Capabilities.Features":                      "Features lists the optional features compiled in, e.g., \"hitless-upgrade\", \"faultinject\" or \"offload\".",
+	"v1.Capabilities.GoVersion":                     "GoVersion is the version of the Go toolchain used for the build.",
+	"v1.Capabilities.Limits":                        "Limits lists the host and process limits detected at startup, e.g., the number of CPUs (\"cpus\"), the open file limit (\"RLIMIT_NOFILE\") and the kernel parameters limiting the socket buffers and the accept queues. Limits that cannot be detected on the platform are omitted.",
+	"v1.Capabilities.ListenerProtocols":             "ListenerProtocols lists the supported listener protocols.",
+	"v1.Capabilities.OffloadEngines":                "OffloadEngines lists the available dataplane offload engines.",
+	"v1.Capabilities.Platform":                      "Platform is the operating system and the architecture, e.g., \"linux/amd64\".",
+	"v1.ClientRTT":                                  "ClientRTT holds the round-trip time statistics of a client network.",
+	"v1.ClientRTT.LastRTT":                          "LastRTT is the last round-trip time measured in seconds.",
+	"v1.ClientRTT.Method":                           "Method is the way the round-trip times were measured: \"stun\" for the time between a challenge and the retry of the client at UDP listeners, and \"tcp\" for the smoothed RTT of the TCP connections at TCP and TLS listeners.",
+	"v1.ClientRTT.MinRTT":                           "MinRTT is the smallest round-trip time measured in seconds.",
+	"v1.ClientRTT.Network":                          "Network is the client network: the /24 prefix of IPv4 clients and the /48 prefix of IPv6 clients.",
+	"v1.ClientRTT.Samples":                          "Samples is the number of round-trip times measured.",
+	"v1.ClientRTT.SmoothedRTT":                      "SmoothedRTT is the exponentially weighted moving average of the round-trip times in seconds.",
+	"v1.ClusterConfig":                              "ClusterConfig specifies a set of upstream peers to which STUNner can open transport relay connections. There are two address resolution policies. In STATIC clusters the allowed peer IP addresses are explicitly listed in the endpoint list. In STRICT_DNS clusters the endpoints are assumed to be proper DNS domain names: STUNner will resolve each domain name in the background and admit a new connection only if the peer address matches one of the IP addresses returned by the DNS resolver for one of the endpoints. STRICT_DNS clusters are best used with headless Kubernetes services. In CONSUL clusters the endpoints are Consul service names: STUNner will watch the healthy instances of each service via the Consul agent and admit a new connection only if the peer address matches the address of one of the instances. CONSUL clusters are intended for non-Kubernetes deployments using Consul for service discovery. In EDS clusters the endpoints are cluster names known to an xDS control plane: STUNner will subscribe to the endpoints of each cluster over the Envoy Endpoint Discovery Service (EDS) protocol and admit a new connection only if the peer address matches the address of one of the endpoints. BLOCK clusters explicitly blackhole the endpoints, given in the same format as for STATIC clusters: a listener denies access to any peer that matches a BLOCK cluster the listener routes to, even if another cluster of the listener would admit the peer. TURN clusters relay the traffic to the endpoints, given in the same format as for STATIC clusters, through an upstream TURN server, for cascaded deployments where an edge gateway relays into another TURN server.",
+	"v1.ClusterConfig.ActiveWindows":                "ActiveWindows restricts the times when new permissions can be created to the peers of the cluster to a list of weekly recurring windows, each in the format \"[DAYS ]HH:MM-HH:MM\", e.g., \"Mon-Fri 09:00-17:00\" or \"Sat,Sun 22:00-02:00\". Existing permissions remain in effect until they expire. Default is empty, which means the cluster is always active. Not supported for BLOCK clusters.",
+	"v1.ClusterConfig.Endpoints":                    "Endpoints specifies the peers that can be reached via this cluster.",
+	"v1.ClusterConfig.Labels":                       "Labels are free-form key-value pairs attached to the cluster, e.g., \"env: staging\" or \"tenant: acme\", for selecting clusters in the admin API queries and for filtering the metrics, where each label is exported as a \"label_<key>\" metric label. Keys and values follow the Kubernetes label syntax. Default is empty.",
+	"v1.ClusterConfig.ManagedBy":                    "ManagedBy is the manager owning the cluster, e.g., \"file\", \"api\" or \"operator\" (see the ownership policy in the admin config). Default is the manager issuing the config.",
+	"v1.ClusterConfig.Metadata":                     "Metadata specifies the identity of the Kubernetes Service the cluster was generated from, for tenant-level accounting in multi-tenant clusters: the namespace and the name of the Service are added as labels to the cluster metrics and are included in the access logs. Default is empty.",
+	"v1.ClusterConfig.MirrorRateLimit":              "MirrorRateLimit caps the number of packets mirrored per second, the packets above the cap are not mirrored. Default is 10000 if MirrorTo is set.",
+	"v1.ClusterConfig.MirrorTo":                     "MirrorTo is a list of UDP endpoints (in the format IP:port) to which a copy of each packet relayed to the peers of the cluster is sent, e.g., for shadow-testing a new media server pool with production media. Each peer is mirrored to the same endpoint during its lifetime. Mirroring is best-effort: mirrored packets may be lost and the responses from the mirror endpoints are dropped. Default is empty, which disables mirroring.",
+	"v1.ClusterConfig.Name":                         "Name of the cluster. Name is mandatory.",
+	"v1.ClusterConfig.Protocol":                     "Protocol specifies the protocol to be used with the cluster, either UDP (default) or TCP (not implemented yet).",
+	"v1.ClusterConfig.Targets":                      "Targets specifies additional peers located in peered remote Kubernetes clusters, tagged with the name of the remote cluster, for multi-cluster media topologies. The traffic relayed to the endpoints of each target is reported in separate per-target metrics. Supported only for STATIC clusters.",
+	"v1.ClusterConfig.Timezone":                     "Timezone is the IANA name of the time zone the active windows are interpreted in, e.g., \"Europe/Budapest\". Default is \"UTC\".",
+	"v1.ClusterConfig.Type":                         "Type specifies the cluster address resolution policy, either STATIC, STRICT_DNS, CONSUL or EDS, BLOCK for clusters that deny access to the endpoints, or TURN for clusters reached through an upstream TURN server. Default is \"STATIC\".",
+	"v1.ClusterConfig.Upstream":                     "Upstream specifies the upstream TURN server through which the traffic to the endpoints of a TURN cluster is relayed. Mandatory for TURN clusters and not supported for other cluster types.",
+	"v1.ClusterMetadata":                            "ClusterMetadata is the identity of the Kubernetes Service a cluster was generated from.",
+	"v1.ClusterMetadata.Namespace":                  "Namespace is the namespace of the Service.",
+	"v1.ClusterMetadata.Service":                    "Service is the name of the Service.",
+	"v1.ClusterTarget":                              "ClusterTarget is a set of peers located in a remote Kubernetes cluster.",
+	"v1.ClusterTarget.Endpoints":                    "Endpoints specifies the peers in the remote cluster, in the same format as the endpoints of STATIC clusters.",
+	"v1.ClusterTarget.Name":                         "Name is the name of the remote Kubernetes cluster. Name is mandatory.",
+	"v1.ClusterUpstream":                            "ClusterUpstream is an upstream TURN server.",
+	"v1.ClusterUpstream.Address":                    "Address is the address of the upstream TURN server in the format host:port. Only TURN-UDP is supported. Address is mandatory.",
+	"v1.ClusterUpstream.Password":                   "Password is the password for authenticating with the upstream TURN server.",
+	"v1.ClusterUpstream.Username":                   "Username is the username for authenticating with the upstream TURN server.",
+	"v1.Condition":                                  "Condition is a status condition, modeled after the Kubernetes API conventions so that it can be copied directly into the status of a custom resource.",
+	"v1.Condition.LastTransitionTime":               "LastTransitionTime is the last time the condition transitioned from one status to another.",
+	"v1.Condition.Message":                          "Message is a human readable message with details about the transition.",
+	"v1.Condition.Reason":                           "Reason is a CamelCase reason for the condition's last transition.",
+	"v1.Condition.Status":                           "Status is the status of the condition, one of True, False or Unknown.",
+	"v1.Condition.Type":                             "Type is the type of the condition.",
+	"v1.ConfigWarning":                              "ConfigWarning is a problem in a configuration that does not prevent the configuration from being applied but is probably not intended, e.g., a route to a nonexistent cluster or a cluster that admits any peer.",
+	"v1.ConfigWarning.Kind":                         "Kind is the kind of the config object the warning applies to, either \"admin\", \"auth\", \"listener\" or \"cluster\", or empty if the warning applies to the config as a whole.",
+	"v1.ConfigWarning.Message":                      "Message is a human-readable description of the problem.",
+	"v1.ConfigWarning.Name":                         "Name is the name of the listener or cluster the warning applies to.",
+	"v1.ConfigWarning.Reason":                       "Reason is a machine-readable CamelCase reason for the warning, e.g., \"ShadowedRoute\".",
+	"v1.Deprecation":                                "Deprecation is the machine-readable description of a deprecated field or field value of the STUNner API.",
+	"v1.Deprecation.ApiVersion":                     "ApiVersion is the API version the deprecation applies to.",
+	"v1.Deprecation.Field":                          "Field is the path of the field in the JSON representation of the config, with the segments separated by dots, e.g., \"auth.type\" or \"listeners.public_address\". List fields are matched element-wise.",
+	"v1.Deprecation.RemovedIn":                      "RemovedIn is the API version in which the field or the value is no longer accepted.",
+	"v1.Deprecation.Replacement":                    "Replacement is the field or the value to use instead, if any.",
+	"v1.Deprecation.Value":                          "Value is the deprecated value of the field. If empty, setting the field to any value is deprecated.",
+	"v1.DrainEstimate":                              "DrainEstimate holds the number of the active allocations of a STUNner instance and the projected time it takes to drain them, e.g., for choosing the termination grace period.",
+	"v1.DrainEstimate.Allocations":                  "Allocations is the number of active allocations.",
+	"v1.DrainEstimate.DrainCompletion":              "DrainCompletion is the projected time of drain completion in RFC 3339 format.",
+	"v1.DrainEstimate.DrainTime":                    "DrainTime is the projected time until all active allocations are closed in seconds.",
+	"v1.DrainEstimate.OldestSession":                "OldestSession is the age of the oldest active allocation in seconds.",
+	"v1.DrainEstimate.Samples":                      "Samples is the number of the completed sessions the projection is based on.",
+	"v1.DrainEstimate.SessionDuration":              "SessionDuration is the 95th percentile of the duration of the recently completed sessions in seconds, zero if no session has completed yet.",
+	"v1.ErrInvalidCluster":                          "ErrInvalidCluster is returned for an invalid cluster configuration. Matches ErrInvalidConf with errors.Is.",
+	"v1.ErrInvalidListener":                         "ErrInvalidListener is returned for an invalid listener configuration. Matches ErrInvalidConf with errors.Is.",
+	"v1.LDAPConfig":                                 "LDAPConfig specifies an LDAP/Active Directory credential backend. Since TURN long-term credentials never send the password over the wire, the directory must store either the cleartext TURN password or the HA1 hash (the hex-encoded MD5 hash of \"username:realm:password\") of the users.",
+	"v1.LDAPConfig.BaseDN":                          "BaseDN is the search base for user entries.",
+	"v1.LDAPConfig.BindDN":                          "BindDN is the DN of the service account used to search the directory. Default is empty, which means anonymous search.",
+	"v1.LDAPConfig.BindPassword":                    "BindPassword is the password of the service account.",
+	"v1.LDAPConfig.CacheTTL":                        "CacheTTL is the time credentials are cached for, in seconds. Unknown users are cached for at most 10 seconds. Default is 300.",
+	"v1.LDAPConfig.HA1Attribute":                    "HA1Attribute is the name of the attribute holding the HA1 hash of the TURN credentials. Either PasswordAttribute or HA1Attribute must be set.",
+	"v1.LDAPConfig.PasswordAttribute":               "PasswordAttribute is the name of the attribute holding the cleartext TURN password.",
+	"v1.LDAPConfig.PoolSize":                        "PoolSize is the maximum number of pooled connections to the LDAP server. Default is 4.",
+	"v1.LDAPConfig.Timeout":                         "Timeout is the timeout for LDAP operations, in seconds. Default is 2.",
+	"v1.LDAPConfig.URL":                             "URL is the URL of the LDAP server, e.g., \"ldaps://ldap.example.com:636\".",
+	"v1.LDAPConfig.UserFilter":                      "UserFilter is the search filter for user entries, where \"%s\" is replaced with the (escaped) TURN username. Default is \"(uid=%s)\".",
+	"v1.LabelSelector":                              "LabelSelector selects listeners and clusters by their labels. A selector is a comma-separated list of requirements, each either \"key=value\" (or \"key==value\"), \"key!=value\", \"key\" (the label exists) or \"!key\" (the label does not exist), e.g., \"env=staging,tenant!=acme\". An object is selected if it meets all requirements. The empty selector selects all objects.",
+	"v1.LicenseConfig":                              "Licensing info to be used to check subscription status with the license server.",
+	"v1.LicenseConfig.HMAC":                         "HMAC is a hash-based message authentication code for validating the license key.",
+	"v1.LicenseConfig.Key":                          "Key is a comma-separated list of unlocked features plus a time-window during which the key is considered valid.",
+	"v1.LicenseStatus":                              "LicenseStatus holds the licensing status.",
+	"v1.ListenerConfig":                             "ListenerConfig specifies a server socket on which STUN/TURN connections will be served.",
+	"v1.ListenerConfig.AcceptQueueLength":           "AcceptQueueLength enables a bounded accept queue on the TCP and TLS sockets of the listener: connections are accepted eagerly into the queue and closed if the queue is full, instead of piling up in the kernel backlog. Default is 0, which disables the accept queue.",
+	"v1.ListenerConfig.Addr":                        "Addr is the IP address for the listener. Default is localhost.",
+	"v1.ListenerConfig.AllowedCountries":            "AllowedCountries is a list of ISO 3166-1 alpha-2 country codes: if non-empty, only clients geolocated to one of the listed countries can create allocations at the listener. Clients that cannot be geolocated are rejected. Requires a GeoIP database to be set in the admin config.",
+	"v1.ListenerConfig.AllowedOrigins":              "AllowedOrigins is a list of web origins (e.g., \"https://app.example.com\"): if non-empty, only the allocations requested with an ORIGIN attribute matching one of the listed origins are permitted at the listener, which lets a gateway shared by multiple applications admit the clients of selected applications only. Origins are compared case-insensitively, ignoring a trailing slash. The origin of the allocations is logged at the listeners with an origin policy. Default is empty, which permits any origin.",
+	"v1.ListenerConfig.BindingRateLimit":            "BindingRateLimit caps the number of STUN Binding requests per second served by the UDP sockets of the listener, in order to prevent STUN Binding floods from using STUNner for reflection and amplification attacks. The limit applies to the listener as a whole and does not affect other STUN/TURN requests. Default is 0, meaning no limit.",
+	"v1.ListenerConfig.BindingRateLimitSilent":      "BindingRateLimitSilent makes the listener silently drop the Binding requests exceeding the Binding rate limit, and the requests rejected in strict mode (see RequireFingerprint and RequireMessageIntegrity), instead of responding with an error. Default is false.",
+	"v1.ListenerConfig.CPUAffinity":                 "CPUAffinity is a list of CPUs to pin the readloop threads of the UDP sockets of the listener to, for deployments chasing tail latency on dedicated nodes: the i-th readloop is locked to an OS thread that is pinned to the i-th CPU in the list, wrapping around if there are more readloops than CPUs. Supported only on Linux and only for UDP listeners. Default is empty, which lets the Go scheduler run the readloops on any CPU.",
+	"v1.ListenerConfig.Cert":                        "Cert is the base64-encoded TLS cert.",
+	"v1.ListenerConfig.ChurnRateLimit":              "ChurnRateLimit makes the listener refuse the allocations of a client above the churn threshold, until the allocation rate of the client drops below the threshold. Requires ChurnThreshold to be set. Default is false.",
+	"v1.ListenerConfig.ChurnThreshold":              "ChurnThreshold is the number of allocations a single client IP address may create at the listener within a minute before the client is reported for allocation churn, i.e., for rapidly recreating allocations, which commonly indicates broken client retry logic. Default is 0, which disables churn detection.",
+	"v1.ListenerConfig.ClientIPQuota":               "ClientIPQuota defines the number of simultaneous TURN allocations permitted from a single client IP address at the listener, independently of the username used to authenticate the allocation. Default is 0, meaning no quota is enforced.",
+	"v1.ListenerConfig.DeniedCountries":             "DeniedCountries is a list of ISO 3166-1 alpha-2 country codes: clients geolocated to one of the listed countries cannot create allocations at the listener. Requires a GeoIP database to be set in the admin config.",
+	"v1.ListenerConfig.DualStackRelay":              "DualStackRelay makes the relay connections of the listener accept both IPv4 and IPv6 peers, irrespective of the address family of the client, so that, e.g., IPv4 clients can reach IPv6 peers. Changes apply to new allocations only. Default is false.",
+	"v1.ListenerConfig.EgressDropPolicy":            "EgressDropPolicy is the packet drop policy of the egress queue: \"tail\" drops the packet being sent when the queue is full, while \"head\" drops the oldest packet in the queue, which favors fresh media over stale packets. Default is \"tail\".",
+	"v1.ListenerConfig.EgressQueueLength":           "EgressQueueLength enables an explicit per-allocation egress queue on the relay connections of the listener: packets sent to peers are queued and written to the peer-facing socket asynchronously, so that a full socket send buffer does not block the TURN server. When the queue is full, packets are dropped according to the drop policy (see EgressDropPolicy). Changes apply to new allocations only. Default is 0, which disables the egress queue.",
+	"v1.ListenerConfig.Enabled":                     "Enabled can be set to false to run the listener as a warm standby: the sockets of the listener are bound and the listener is fully initialized, but new allocations are refused until the listener is enabled, either by setting Enabled to true (or removing it) or via the admin API. This cuts activation latency when traffic is moved to a new port or protocol. Default is true.",
+	"v1.ListenerConfig.ForwardAddress":              "ForwardAddress enables single-port deployments for UDP listeners: packets received on the listener that are neither STUN/TURN messages nor TURN ChannelData messages (e.g., QUIC or RTP) are forwarded to the given UDP address (in the format host:port), and the responses are sent back to the client from the listener port. Default is empty, which means non-STUN packets are dropped.",
+	"v1.ListenerConfig.ICEPassword":                 "ICEPassword is the local ICE password of the ICE-lite responder of a UDP listener.",
+	"v1.ListenerConfig.ICEUfrag":                    "ICEUfrag is the local ICE username fragment of the ICE-lite responder of a UDP listener. If set together with ICEPassword, ICE connectivity checks addressed to the listener are answered directly by STUNner, which allows to terminate ICE at STUNner in asymmetric media-gateway deployments (see also ForwardAddress). Default is empty, which disables the ICE-lite responder.",
+	"v1.ListenerConfig.IdleTimeout":                 "IdleTimeout enables stale session detection: allocations that have seen neither relayed data in either direction nor an authenticated request from the client (e.g., a refresh) for the given number of seconds are closed, which reclaims the resources held by vanished clients before the allocations would expire. Not supported in single-port mode. Changes apply to new allocations only. Default is 0, which disables stale session detection.",
+	"v1.ListenerConfig.Key":                         "Key is the base64-encoded TLS key.",
+	"v1.ListenerConfig.Labels":                      "Labels are free-form key-value pairs attached to the listener, e.g., \"env: staging\" or \"tenant: acme\", for selecting listeners in the admin API queries and for filtering the metrics, where each label is exported as a \"label_<key>\" metric label. Keys and values follow the Kubernetes label syntax. Default is empty.",
+	"v1.ListenerConfig.ManagedBy":                   "ManagedBy is the manager owning the listener, e.g., \"file\", \"api\" or \"operator\" (see the ownership policy in the admin config). Default is the manager issuing the config.",
+	"v1.ListenerConfig.MaxDatagramSize":             "MaxDatagramSize is the maximum size of the datagrams relayed to the peers, in bytes. Larger datagrams are dropped and counted instead of being fragmented, since the loss of a single IP fragment silently loses the whole datagram, e.g., a large video keyframe. Set to -1 to detect the size from the smallest MTU of the network interfaces, less the IP and UDP headers. Changes apply to new allocations only. Default is 0, which disables clamping.",
+	"v1.ListenerConfig.MaxRelayPort":                "MaxRelayPort is the highest relay port of the allocations created at the listener, see MinRelayPort. If only the lower bound is set the range ends at port 65535. Default is 0.",
+	"v1.ListenerConfig.MaxSessionDuration":          "MaxSessionDuration is the maximum lifetime of the allocations created at the listener, in seconds. Allocations are closed after the given time irrespective of refreshes, which forces clients to create a new allocation and re-authenticate with fresh credentials. Changes apply to new allocations only. Default is 0, meaning no limit.",
+	"v1.ListenerConfig.MaxTCPConnections":           "MaxTCPConnections is the maximum number of concurrent connections of the TCP and TLS sockets of the listener. Connections exceeding the limit are closed right after being accepted, so that connection floods cannot exhaust the file descriptors of the process. Default is 0, meaning no limit.",
+	"v1.ListenerConfig.MinRelayPort":                "MinRelayPort is the lowest relay port of the allocations created at the listener. Setting a relay port range, e.g., to match the ports opened in a firewall, makes the listener lease the ports of the range to the allocations and refuse new allocations with a 508 (Insufficient Capacity) error when the range is exhausted. If only the upper bound is set the range starts at port 1. Not supported in single-port mode. Default is 0, which, if MaxRelayPort is unset as well, lets the operating system choose the relay ports.",
+	"v1.ListenerConfig.Mobility":                    "Mobility enables the TURN mobility extension of RFC 8016: an allocation requested with an empty MOBILITY-TICKET attribute is issued a ticket, which the client presents in a Refresh request sent from a new address, e.g., after switching from Wi-Fi to LTE, to keep the allocation, with its relay address and permissions, at the new address. Supported only for UDP listeners. Default is false.",
+	"v1.ListenerConfig.NAT64Prefix":                 "NAT64Prefix is the /96 NAT64 prefix (RFC 6052, e.g., \"64:ff9b::/96\") used to reach IPv4 peers over IPv6 via a NAT64 gateway, e.g., in IPv6-only clusters. If set, packets to IPv4 peers are sent to the corresponding IPv4-embedded IPv6 address, and packets received from IPv4-embedded IPv6 addresses are relayed to the client as if they came from the IPv4 peer. Implies DualStackRelay. Changes apply to new allocations only. Default is empty, which disables NAT64 translation.",
+	"v1.ListenerConfig.Name":                        "Name of the listener.",
+	"v1.ListenerConfig.OriginRoutes":                "OriginRoutes maps web origins to lists of routes: the allocations requested with an ORIGIN attribute matching one of the origins can reach only the routes listed for the origin, which must be a subset of the routes of the listener, so that the applications sharing a gateway can be confined to their own backends. Allocations with other or no origins can reach all the routes of the listener. Default is empty.",
+	"v1.ListenerConfig.PacingRate":                  "PacingRate enables a per-allocation pacer that smooths bursts toward the peers using a token bucket at the given bitrate, in kbps. This protects downstream media servers from the microbursts caused by TCP and TLS listeners flushing many messages at once. When the egress queue is enabled, packets are paced out of the queue, otherwise the pacer delays the sender. Changes apply to new allocations only. Default is 0, which disables pacing.",
+	"v1.ListenerConfig.PathMTUDiscovery":            "PathMTUDiscovery sets the Don't Fragment bit on the datagrams sent to the peers and lets the kernel track the path MTU toward each peer using the ICMP \"Fragmentation Needed\" (or \"Packet Too Big\") messages. Datagrams exceeding the path MTU are dropped and counted instead of being fragmented. Supported on Linux only and not supported in single-port mode. Changes apply to new allocations only. Default is false.",
+	"v1.ListenerConfig.Port":                        "Port is the port for the listener. Default is the standard TURN port (3478).",
+	"v1.ListenerConfig.PortReservation":             "PortReservation enables the EVEN-PORT and RESERVATION-TOKEN attributes of RFC 5766, for clients that need adjacent relay ports, e.g., for RTP and RTCP: an Allocate request with an EVEN-PORT attribute gets an even relay port, and if the R bit is set, the next port is reserved for 30 seconds with a token that the client presents in the RESERVATION-TOKEN attribute of a subsequent Allocate request to get the reserved port. Supported only for UDP listeners and not supported in single-port mode. Default is false.",
+	"v1.ListenerConfig.Protocol":                    "Protocol is the transport protocol (\"UDP\", \"TCP\", \"TLS\", \"DTLS\") or the complete L4/L7 protocol stack (\"TURN-UDP\", \"TURN-TCP\", \"TURN-TLS\", \"TURN-DTLS\") used by the listener. The application-layer protocol on top of the transport protocol is always TURN, so \"UDP\" and \"TURN-UDP\" are equivalent (and so on for the other protocols). Default is \"TURN-UDP\". Multiple protocols can be listed separated by commas (e.g., \"TURN-UDP,TURN-TCP\") to serve all of them on the same port with identical settings, from the same listener; at most one UDP-based (UDP or DTLS) and one TCP-based (TCP or TLS) protocol can be given.",
+	"v1.ListenerConfig.ProxyProtocol":               "ProxyProtocol makes the TCP and TLS sockets of the listener expect a PROXY protocol (v1 or v2) header at the beginning of each connection, as sent by L4 proxies and cloud load balancers, and use the client address from the header for authentication, quotas, rate limiting and logging. Connections without a valid header are closed, so the listener must be reachable only via the proxy. Requires ProxyProtocolTrustedProxies. Default is false.",
+	"v1.ListenerConfig.ProxyProtocolTrustedProxies": "ProxyProtocolTrustedProxies is the list of the IP addresses or CIDR prefixes of the proxies allowed to send a PROXY protocol header. Connections from other addresses are closed, so that clients cannot spoof their address by sending a header themselves. Mandatory if ProxyProtocol is enabled.",
+	"v1.ListenerConfig.PublicAddr":                  "PublicAddr is the Internet-facing public IP address for the listener (ignored by STUNner).",
+	"v1.ListenerConfig.PublicPort":                  "PublicPort is the Internet-facing public port for the listener (ignored by STUNner).",
+	"v1.ListenerConfig.RTPInspection":               "RTPInspection enables passive RTP inspection on the relay connections of the listener: RTP (and SRTP) streams are recognized in the relayed traffic and packet loss and jitter are estimated from the RTP sequence numbers and timestamps. At most 64 streams are tracked per allocation and direction: streams idle for 30 seconds are forgotten to make room for new streams. Statistics are exported as metrics and logged per session when an allocation is closed. Changes apply to new allocations only. Default is false.",
+	"v1.ListenerConfig.RelayPortPins":               "RelayPortPins maps usernames to fixed relay ports, in the format \"port\" or \"addr:port\", for interop with legacy equipment that whitelists the remote ports. Time-windowed usernames, e.g., \"timestamp:userid\", are also matched by the user id. The allocations of a pinned user are always bound to the pinned port, and to the given local address if any, which is then also returned as the relay address. Pinned ports are reserved: ports of the relay port ranges pinned to a user are never leased to other allocations. A user can hold a single allocation at a time, further allocations are refused. Supported only for UDP listeners and not supported in single-port mode. Default is empty.",
+	"v1.ListenerConfig.RelayPortRanges":             "RelayPortRanges is a list of disjoint relay port ranges in the format \"min-max\" (or a single port), for deployments where a large contiguous range cannot be opened in the firewall. The ranges are used in the given order: relay ports are leased from a range only when all the preceding ranges are exhausted. The range set with MinRelayPort and MaxRelayPort, if any, comes first. Not supported in single-port mode. Default is empty.",
+	"v1.ListenerConfig.Routes":                      "Routes specifies the list of Routes allowed via a listener. When the clusters overlap, BLOCK clusters take precedence, then the cluster with the longest matching endpoint prefix, then the order of the routes.",
+	"v1.ListenerConfig.SessionTokenTimeout":         "SessionTokenTimeout enables session affinity tokens: each allocation is issued an opaque token in the SESSION-TOKEN attribute of the Allocate response, and the relay address of the allocation remains reserved for the given number of seconds after the allocation ends. A client presenting the token in a new Allocate request, e.g., after a network blip changed its address, gets the same relay address if it is still reserved; the allocation still alive at the old client address, if any, is closed. Supported only for UDP listeners and not supported in single-port mode. Default is 0, which disables session affinity tokens.",
+	"v1.ListenerConfig.SinglePort":                  "SinglePort enables single-port media-plane mode for UDP listeners: the relayed peer traffic of all allocations is sent and received on the listener port instead of a per-allocation relay port, so that only a single UDP port needs to be exposed. Peers are tracked by their transport address: a peer can send to an allocation only after the allocation has sent a packet to the peer, and a peer transport address can be used by a single allocation at a time. Default is false.",
+	"v1.ListenerConfig.TCPKeepalive":                "TCPKeepalive is the TCP keepalive period for the connections of the TCP and TLS sockets of the listener, in seconds: the connections of vanished clients are closed after the keepalive probes sent in every period go unanswered. Default is 0, which uses the system default (15 seconds), and a negative value disables TCP keepalives.",
+	"v1.ListenerConfig.TarpitDelay":                 "TarpitDelay enables tarpit mode for clients denied by the country filters of a UDP listener: instead of rejecting the STUN/TURN requests of denied clients immediately, STUNner waits for the given number of seconds and then responds with a bogus error, recording each request in the logs and the metrics. Default is 0, which disables tarpit mode.",
+	"v1.ListenerRates":                              "ListenerRates holds the traffic rates of a listener over a time interval.",
+	"v1.ListenerRates.Errors":                       "Errors is the error rate in errors per second.",
+	"v1.ListenerRates.Interval":                     "Interval is the length of the time interval in seconds, zero if no rates are available yet.",
+	"v1.ListenerRates.RxBps":                        "RxBps and TxBps are the bit rates in bits per second.",
+	"v1.ListenerRates.RxPps":                        "RxPps and TxPps are the packet rates in packets per second.",
+	"v1.ListenerStats":                              "ListenerStats is a snapshot of the traffic statistics of a listener, with the rates computed in-process.",
+	"v1.ListenerStats.Allocations":                  "Allocations is the number of active allocations at the listener.",
+	"v1.ListenerStats.Current":                      "Current holds the instantaneous rates, computed over the last sampling interval.",
+	"v1.ListenerStats.Errors":                       "Errors counts the packets dropped or rejected and the panics recovered at the listener.",
+	"v1.ListenerStats.Labels":                       "Labels are the labels of the listener.",
+	"v1.ListenerStats.Name":                         "Name of the listener.",
+	"v1.ListenerStats.RxPackets":                    "RxPackets and RxBytes count the packets and bytes received from the clients.",
+	"v1.ListenerStats.TxPackets":                    "TxPackets and TxBytes count the packets and bytes sent to the clients.",
+	"v1.ListenerStats.Window":                       "Window holds the rates averaged over the rolling window.",
+	"v1.ListenerStatus.Disabled":                    "Disabled is true if the listener has been administratively disabled at runtime.",
+	"v1.OAuthConfig":                                "OAuthConfig specifies third-party authorization (RFC 7635): clients present self-contained access tokens issued by an authorization server, encrypted with a token key shared between the authorization server and STUNner.",
+	"v1.OAuthConfig.AuthorizationServer":            "AuthorizationServer is the name of the authorization server advertised to the clients in the THIRD-PARTY-AUTHORIZATION attribute. Optional.",
+	"v1.OAuthConfig.Keys":                           "Keys is the list of token keys, identified by the key ID presented by the clients in the USERNAME attribute.",
+	"v1.OAuthConfig.ServerName":                     "ServerName is the name of the STUN server, used as the associated data when encrypting access tokens. Must match the server name used by the authorization server.",
+	"v1.OAuthKey":                                   "OAuthKey is a token key used to decrypt access tokens.",
+	"v1.OAuthKey.Key":                               "Key is the base64-encoded AES-GCM key: 16 bytes for AES-128-GCM or 32 bytes for AES-256-GCM.",
+	"v1.OAuthKey.KeyID":                             "KeyID is the key identifier (kid).",
+	"v1.ObjectMeta":                                 "ObjectMeta records the reconciliation history of a STUNner object (a listener, a cluster, the authenticator or the admin object), which helps spotting objects that are restarted or updated too often.",
+	"v1.ObjectMeta.Created":                         "Created is the time the object was last created or restarted.",
+	"v1.ObjectMeta.Generation":                      "Generation is the config generation that last created or updated the object. The config generation is increased on each reconciliation that applies a new config.",
+	"v1.ObjectMeta.Updated":                         "Updated is the time the object was last created, restarted or updated.",
+	"v1.OffloadDirStat":                             "OffloadStatMap defines the TX/RX offload statistics for a particular listener or cluster.",
+	"v1.OffloadStatInfo":                            "OffloadStatInfo holds the statistics for a listener or cluster in RX or TX direction.",
+	"v1.PortRange":                                  "PortRange is a range of ports, including the bounds.",
+	"v1.ScalingMetrics":                             "ScalingMetrics holds the load signals of a STUNner instance for horizontal autoscaling, e.g., with the Kubernetes HorizontalPodAutoscaler via KEDA, so that the number of replicas tracks the call volume.",
+	"v1.ScalingMetrics.Allocations":                 "Allocations is the number of active allocations.",
+	"v1.ScalingMetrics.Bandwidth":                   "Bandwidth is the relayed bandwidth in both directions in bits per second, averaged over the rolling window of the listener statistics.",
+	"v1.SessionStats":                               "SessionStats is a snapshot of the traffic statistics of a session (allocation), with the bit rates computed in-process.",
+	"v1.SessionStats.Client":                        "Client is the transport address of the client.",
+	"v1.SessionStats.Interval":                      "Interval is the length of the time interval over which the rates were computed in seconds, at most the length of the rolling window.",
+	"v1.SessionStats.Listener":                      "Listener is the name of the listener the session belongs to.",
+	"v1.SessionStats.RelayAddress":                  "RelayAddress is the relay transport address of the allocation.",
+	"v1.SessionStats.ToPeerBps":                     "ToPeerBps and FromPeerBps are the bit rates to and from the peers in bits per second.",
+	"v1.SessionStats.ToPeerBytes":                   "ToPeerBytes and FromPeerBytes count the bytes relayed to and from the peers.",
+	"v1.SessionStats.Username":                      "Username is the username the session was authenticated with.",
+	"v1.StunnerConfig":                              "StunnerConfig specifies the configuration for the STUnner daemon.",
+	"v1.StunnerConfig.Admin":                        "AdminConfig holds administrative configuration.",
+	"v1.StunnerConfig.ApiVersion":                   "ApiVersion is the version of the STUNner API implemented. Must be set to \"v1\".",
+	"v1.StunnerConfig.Auth":                         "Auth defines the STUN/TURN authentication mechanism.",
+	"v1.StunnerConfig.Clusters":                     "Clusters defines the upstream endpoints to which relay transport connections can be made by clients.",
+	"v1.StunnerConfig.Listeners":                    "Listeners defines the server sockets exposed to clients.",
+	"v1.StunnerStatus":                              "StunnerStatus represents the status of the STUnner daemon.",
+	"v1.SystemCheck":                                "SystemCheck is the result of a sanity check of a kernel parameter or a process resource limit against the running configuration.",
+	"v1.SystemCheck.Message":                        "Message is an actionable hint on how to fix a failed check.",
+	"v1.SystemCheck.Name":                           "Name is the name of the kernel parameter or the resource limit, e.g., \"net.core.somaxconn\".",
+	"v1.SystemCheck.Passed":                         "Passed is true if the current value is at least the recommended value.",
+	"v1.SystemCheck.Recommended":                    "Recommended is the minimum value recommended for the running configuration.",
+	"v1.SystemCheck.Value":                          "Value is the current value.",
+	"v1.configError":                                "configError is a sentinel error for a class of invalid configurations. Matches ErrInvalidConf with errors.Is.",
+	"v1alpha1.AuthConfig":                           "Auth defines the specification of the STUN/TURN authentication mechanism used by STUNner.",
+	"v1alpha1.AuthConfig.Credentials":               "Credentials specifies the authententication credentials: for \"plaintext\" at least the keys \"username\" and \"password\" must be set, for \"longterm\" the key \"secret\" will hold the shared authentication secret.",
+	"v1alpha1.AuthConfig.Realm":                     "Realm defines the STUN/TURN authentication realm.",
+	"v1alpha1.AuthConfig.Type":                      "Type is the type of the STUN/TURN authentication mechanism (\"plaintext\" or \"longterm\").",
+	"v1alpha1.StunnerConfig":                        "StunnerConfig specifies the configuration of the the STUnner daemon.",
+	"v1alpha1.StunnerConfig.Admin":                  "AdminConfig holds administrative configuration.",
+	"v1alpha1.StunnerConfig.ApiVersion":             "ApiVersion is the version of the STUNner API implemented.",
+	"v1alpha1.StunnerConfig.Auth":                   "Auth defines the STUN/TURN authentication mechanism.",
+	"v1alpha1.StunnerConfig.Clusters":               "Clusters defines the upstream endpoints to which relay transport connections can be made by clients.",
+	"v1alpha1.StunnerConfig.Listeners":              "Listeners defines the server sockets exposed to clients.",
+}
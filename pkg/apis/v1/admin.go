@@ -2,10 +2,14 @@ package v1
 
 import (
 	"fmt"
+	"maps"
 	"net/url"
 	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 )
 
 // AdminConfig holds the administrative configuration.
@@ -19,6 +23,15 @@ type AdminConfig struct {
 	// requests are served. The scheme (`http://`") is mandatory. Default is to expose no
 	// metric endpoints.
 	MetricsEndpoint string `json:"metrics_endpoint,omitempty"`
+	// MetricsDisabledLabels is a list of labels to be removed from all the exported metrics,
+	// e.g., "country", "target", "namespace" or "service", in order to limit the cardinality of
+	// the metrics on large public-facing gateways. The measurements that differ only in the
+	// removed labels are aggregated. The "name" label cannot be removed. Default is empty.
+	MetricsDisabledLabels []string `json:"metrics_disabled_labels,omitempty"`
+	// MetricsLabelLimit caps the number of distinct values exported for each label (except
+	// the "name" label): once the limit is reached, measurements with new values of the label
+	// are reported with the value "other". Default is 0, meaning no limit.
+	MetricsLabelLimit int `json:"metrics_label_limit,omitempty"`
 	// HealthCheckEndpoint is the URI of the form `http://address:port` exposed for external
 	// HTTP health-checking. A liveness probe responder will be exposed on path `/live` and
 	// readiness probe on path `/ready`. The scheme (`http://`) is mandatory, and if no port is
@@ -26,6 +39,18 @@ type AdminConfig struct {
 	// health-checking at `http://0.0.0.0:8086`. Set to a pointer to an empty string to disable
 	// health-checking.
 	HealthCheckEndpoint *string `json:"healthcheck_endpoint,omitempty"`
+	// AdminEndpoint is the URI of the form `http://address:port` at which the admin API is
+	// served, i.e., the endpoints that change the state of the server (e.g., `/drain`,
+	// `/promote`, `/credentials` or `/tap`), the read-only introspection endpoints and the
+	// handlers registered by the embedder. The health-check endpoint serves only `/live`,
+	// `/ready` and `/status`. The scheme (`http://`) is mandatory. If no address is specified
+	// then the admin API binds to the loopback address 127.0.0.1, and if no port is specified
+	// then the default port is 8087. Requires AdminToken to be set. Default is to disable the
+	// admin API.
+	AdminEndpoint string `json:"admin_endpoint,omitempty"`
+	// AdminToken is the bearer token the clients of the admin API must present in the
+	// `Authorization: Bearer <token>` request header. Mandatory if AdminEndpoint is set.
+	AdminToken string `json:"admin_token,omitempty"`
 	// UserQuota defines the number of permitted TURN allocatoins per username. Affects
 	// allocation created on any listener. Default is 0, meaning no quota is enforced.
 	UserQuota int `json:"user_quota,omitempty"`
@@ -35,11 +60,95 @@ type AdminConfig struct {
 	// OffloadInterfaces explicitly specifies the interfaces on which to enable the offload
 	// engine. Empty list means to enable offload on all interfaces (this is the default).
 	OffloadInterfaces []string `json:"offload_interfaces,omitempty"`
+	// GeoIPDatabase is the path to a MaxMind GeoIP2 or GeoLite2 country (or city) database in
+	// the MMDB format. If set, clients are geolocated by their IP address: the country code of
+	// the client is added to the access logs and the allocation metrics and listeners can
+	// filter clients by country. Default is to disable geolocation.
+	GeoIPDatabase string `json:"geoip_database,omitempty"`
+	// RequireFingerprint makes UDP listeners reject STUN requests that do not carry a valid
+	// FINGERPRINT attribute. Default is false.
+	RequireFingerprint bool `json:"require_fingerprint,omitempty"`
+	// RequireMessageIntegrity makes UDP listeners reject STUN requests that do not carry a
+	// MESSAGE-INTEGRITY attribute, including STUN Binding requests, whose MESSAGE-INTEGRITY
+	// is verified with the long-term credentials of the client. Unauthenticated Allocate
+	// requests are exempt, since these are answered by the authentication challenge. Default
+	// is false.
+	RequireMessageIntegrity bool `json:"require_message_integrity,omitempty"`
+	// ReconcileDebounce is the minimum time between two consecutive reconciliations, in
+	// seconds. Config updates arriving faster, e.g., from a fast-churning controller, are
+	// coalesced: only the latest update is applied once the debounce interval has elapsed since
+	// the last reconciliation. Default is 0, which applies each config update immediately.
+	ReconcileDebounce int `json:"reconcile_debounce,omitempty"`
+	// GCPercent sets the garbage collection target percentage of the process, like the GOGC
+	// environment variable: a collection is triggered when the heap grows by this percentage
+	// since the last collection. Set to -1 to disable the garbage collector until the memory
+	// limit is reached, which requires GCMemoryLimit to be set. Default is 0, which keeps the
+	// Go runtime default (GOGC, or 100).
+	GCPercent int `json:"gc_percent,omitempty"`
+	// GCMemoryLimit sets a soft memory limit for the process in MiB, like the GOMEMLIMIT
+	// environment variable: the garbage collector runs more often as the memory usage
+	// approaches the limit. Default is 0, which keeps the Go runtime default (GOMEMLIMIT, or
+	// no limit).
+	GCMemoryLimit int `json:"gc_memory_limit,omitempty"`
+	// GCBallast is the size of a memory ballast in MiB: a large allocation that is never used,
+	// which increases the heap size the garbage collection target percentage is computed from
+	// and therefore makes collections less frequent on instances with a small live heap. The
+	// ballast is never touched, so it does not consume physical memory. Default is 0, which
+	// disables the ballast.
+	GCBallast int `json:"gc_ballast,omitempty"`
+	// SelfCheckInterval is the period of the dataplane self-check in seconds: when set, STUNner
+	// periodically performs a real TURN allocation against a local listener using throwaway
+	// credentials, and the readiness probe fails while the last check failed. Default is 0,
+	// which disables the self-check.
+	SelfCheckInterval int `json:"self_check_interval,omitempty"`
+	// SelfCheckListener is the name of the listener to perform the dataplane self-check
+	// against. Default is the first TURN listener in alphabetical order that does not expect a
+	// PROXY protocol header.
+	SelfCheckListener string `json:"self_check_listener,omitempty"`
+	// WatchdogTimeout is the time in seconds after which the watchdog considers the dataplane of
+	// a UDP listener wedged and restarts the listener: a readloop is wedged if it has not
+	// returned to reading from the socket for this long, e.g., because it is stuck in a
+	// deadlock, or if it has not received a packet for this long despite the socket having
+	// packets queued. Restarting a listener drops its allocations. Default is 0, which disables
+	// the watchdog.
+	WatchdogTimeout int `json:"watchdog_timeout,omitempty"`
+	// ErrorReasons customizes the reason phrases of the STUN/TURN error responses sent to the
+	// clients, e.g., to point users to a support page on authentication failures. The keys are
+	// the error codes (e.g., "401" or "403") and the values are Go text templates, which can
+	// refer to the error code as {{.Code}}, the original reason phrase as {{.Reason}}, the
+	// STUN method as {{.Method}} and the name of the listener as {{.Listener}}. Reason phrases
+	// longer than 763 bytes are truncated. Error responses carrying a MESSAGE-INTEGRITY
+	// attribute are never modified. Default is empty, which keeps the reason phrases of the
+	// TURN server.
+	ErrorReasons map[string]string `json:"error_reasons,omitempty"`
+	// ConfigId is an opaque identifier of the config, e.g., a checksum of the rendered config
+	// set by the operator. STUNner does not interpret the identifier, it only echoes it in the
+	// status and the metrics, so that the operator can verify which exact config the dataplane
+	// is running.
+	ConfigId string `json:"config_id,omitempty"`
+	// ManagedBy identifies the manager issuing the config, e.g., "file" for configs loaded from
+	// a config file, "api" for configs pushed via the admin API or "operator" for configs
+	// rendered by the STUNner gateway operator. Listeners and clusters without an explicit
+	// manager are owned by this manager. Default is empty, which leaves the objects unowned.
+	ManagedBy string `json:"managed_by,omitempty"`
+	// OwnershipPolicy defines what happens when a config from one manager would modify or
+	// delete listeners or clusters owned by another manager: "ignore" applies the config
+	// silently, "warn" applies the config but reports a configuration warning for each
+	// conflicting object, and "reject" refuses the config and keeps the running config. The
+	// policy of the running config is enforced. Default is "ignore".
+	OwnershipPolicy string `json:"ownership_policy,omitempty"`
 	// LicenseConfig describes the licensing info to be used to check subscription status with
 	// the license server.
 	LicenseConfig *LicenseConfig `json:"license_config,omitempty"`
 }
 
+// Ownership policies.
+const (
+	OwnershipPolicyIgnore = "ignore"
+	OwnershipPolicyWarn   = "warn"
+	OwnershipPolicyReject = "reject"
+)
+
 // Licensing info to be used to check subscription status with the license server.
 type LicenseConfig struct {
 	// Key is a comma-separated list of unlocked features plus a time-window during which the
@@ -51,6 +160,13 @@ type LicenseConfig struct {
 
 // Validate checks a configuration and injects defaults.
 func (req *AdminConfig) Validate() error {
+	if err := req.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrAdminConfig, err)
+	}
+	return nil
+}
+
+func (req *AdminConfig) validate() error {
 	if req.LogLevel == "" {
 		req.LogLevel = DefaultLogLevel
 	}
@@ -67,6 +183,17 @@ func (req *AdminConfig) Validate() error {
 		}
 	}
 
+	for _, l := range req.MetricsDisabledLabels {
+		if l == "" || l == "name" {
+			return fmt.Errorf("invalid disabled metric label %q", l)
+		}
+	}
+	sort.Strings(req.MetricsDisabledLabels)
+
+	if req.MetricsLabelLimit < 0 {
+		req.MetricsLabelLimit = 0
+	}
+
 	if req.HealthCheckEndpoint == nil {
 		// No healtchcheck endpoint given: use default URL
 		e := fmt.Sprintf("http://:%d", DefaultHealthCheckPort)
@@ -79,10 +206,73 @@ func (req *AdminConfig) Validate() error {
 		}
 	}
 
+	if req.AdminEndpoint != "" {
+		u, err := url.Parse(req.AdminEndpoint)
+		if err != nil {
+			return fmt.Errorf("invalid admin API endpoint URL %s: %s",
+				req.AdminEndpoint, err.Error())
+		}
+		if u.Scheme != "http" {
+			return fmt.Errorf("invalid admin API endpoint URL %s: scheme must be \"http\"",
+				req.AdminEndpoint)
+		}
+		if req.AdminToken == "" {
+			return fmt.Errorf("admin API endpoint %s requires an admin token",
+				req.AdminEndpoint)
+		}
+	}
+
 	if req.UserQuota < 0 {
 		req.UserQuota = 0
 	}
 
+	if req.ReconcileDebounce < 0 {
+		req.ReconcileDebounce = 0
+	}
+
+	if req.GCPercent < -1 {
+		return fmt.Errorf("invalid GC percent %d", req.GCPercent)
+	}
+	if req.GCMemoryLimit < 0 {
+		return fmt.Errorf("invalid GC memory limit %d", req.GCMemoryLimit)
+	}
+	if req.GCPercent == -1 && req.GCMemoryLimit == 0 {
+		return fmt.Errorf("disabling the garbage collector requires a GC memory limit")
+	}
+	if req.GCBallast < 0 {
+		return fmt.Errorf("invalid GC ballast size %d", req.GCBallast)
+	}
+
+	if req.SelfCheckInterval < 0 {
+		req.SelfCheckInterval = 0
+	}
+
+	if req.WatchdogTimeout < 0 {
+		req.WatchdogTimeout = 0
+	}
+
+	if len(req.ErrorReasons) == 0 {
+		req.ErrorReasons = nil
+	}
+	for code, reason := range req.ErrorReasons {
+		if c, err := strconv.Atoi(code); err != nil || c < 300 || c > 699 {
+			return fmt.Errorf("invalid error code %q for custom error reason", code)
+		}
+		if _, err := template.New(code).Parse(reason); err != nil {
+			return fmt.Errorf("invalid custom error reason for error code %s: %w", code, err)
+		}
+	}
+
+	req.OwnershipPolicy = strings.ToLower(req.OwnershipPolicy)
+	switch req.OwnershipPolicy {
+	case "":
+		req.OwnershipPolicy = OwnershipPolicyIgnore
+	case OwnershipPolicyIgnore, OwnershipPolicyWarn, OwnershipPolicyReject:
+	default:
+		return fmt.Errorf("invalid ownership policy %q, must be either %q, %q or %q",
+			req.OwnershipPolicy, OwnershipPolicyIgnore, OwnershipPolicyWarn, OwnershipPolicyReject)
+	}
+
 	// Normalize
 	if req.OffloadEngine == "" {
 		req.OffloadEngine = OffloadEngineNone.String()
@@ -118,6 +308,14 @@ func (req *AdminConfig) DeepCopyInto(dst Config) {
 	*ret = *req
 	ret.OffloadInterfaces = make([]string, len(req.OffloadInterfaces))
 	copy(ret.OffloadInterfaces, req.OffloadInterfaces)
+	if req.MetricsDisabledLabels != nil {
+		ret.MetricsDisabledLabels = make([]string, len(req.MetricsDisabledLabels))
+		copy(ret.MetricsDisabledLabels, req.MetricsDisabledLabels)
+	}
+	if req.ErrorReasons != nil {
+		ret.ErrorReasons = make(map[string]string, len(req.ErrorReasons))
+		maps.Copy(ret.ErrorReasons, req.ErrorReasons)
+	}
 }
 
 // String stringifies the configuration.
@@ -132,9 +330,20 @@ func (req *AdminConfig) String() string {
 	if req.MetricsEndpoint != "" {
 		status = append(status, fmt.Sprintf("metrics=%q", req.MetricsEndpoint))
 	}
+	if len(req.MetricsDisabledLabels) > 0 {
+		status = append(status, fmt.Sprintf("metrics-disabled-labels=<%s>",
+			strings.Join(req.MetricsDisabledLabels, ",")))
+	}
+	if req.MetricsLabelLimit > 0 {
+		status = append(status, fmt.Sprintf("metrics-label-limit=%d", req.MetricsLabelLimit))
+	}
 	if req.HealthCheckEndpoint != nil {
 		status = append(status, fmt.Sprintf("health-check=%q", *req.HealthCheckEndpoint))
 	}
+	if req.AdminEndpoint != "" {
+		// never log the token
+		status = append(status, fmt.Sprintf("admin-api=%q", req.AdminEndpoint))
+	}
 	if req.UserQuota > 0 {
 		status = append(status, fmt.Sprintf("quota=%d", req.UserQuota))
 	}
@@ -145,6 +354,60 @@ func (req *AdminConfig) String() string {
 		}
 		status = append(status, fmt.Sprintf("offload=%s[%s]", req.OffloadEngine, intfs))
 	}
+	if req.GeoIPDatabase != "" {
+		status = append(status, fmt.Sprintf("geoip=%q", req.GeoIPDatabase))
+	}
+	if req.RequireFingerprint || req.RequireMessageIntegrity {
+		strict := []string{}
+		if req.RequireFingerprint {
+			strict = append(strict, "fingerprint")
+		}
+		if req.RequireMessageIntegrity {
+			strict = append(strict, "integrity")
+		}
+		status = append(status, fmt.Sprintf("strict=<%s>", strings.Join(strict, ",")))
+	}
+	if req.ReconcileDebounce > 0 {
+		status = append(status, fmt.Sprintf("reconcile-debounce=%ds", req.ReconcileDebounce))
+	}
+	if req.GCPercent != 0 || req.GCMemoryLimit > 0 || req.GCBallast > 0 {
+		gc := []string{}
+		if req.GCPercent == -1 {
+			gc = append(gc, "gogc=off")
+		} else if req.GCPercent > 0 {
+			gc = append(gc, fmt.Sprintf("gogc=%d", req.GCPercent))
+		}
+		if req.GCMemoryLimit > 0 {
+			gc = append(gc, fmt.Sprintf("memlimit=%dMiB", req.GCMemoryLimit))
+		}
+		if req.GCBallast > 0 {
+			gc = append(gc, fmt.Sprintf("ballast=%dMiB", req.GCBallast))
+		}
+		status = append(status, fmt.Sprintf("gc=<%s>", strings.Join(gc, ",")))
+	}
+	if req.SelfCheckInterval > 0 {
+		sc := fmt.Sprintf("self-check=%ds", req.SelfCheckInterval)
+		if req.SelfCheckListener != "" {
+			sc += fmt.Sprintf("@%s", req.SelfCheckListener)
+		}
+		status = append(status, sc)
+	}
+	if req.WatchdogTimeout > 0 {
+		status = append(status, fmt.Sprintf("watchdog=%ds", req.WatchdogTimeout))
+	}
+	if len(req.ErrorReasons) > 0 {
+		status = append(status, fmt.Sprintf("error-reasons=<%s>",
+			strings.Join(slices.Sorted(maps.Keys(req.ErrorReasons)), ",")))
+	}
+	if req.ConfigId != "" {
+		status = append(status, fmt.Sprintf("config-id=%q", req.ConfigId))
+	}
+	if req.ManagedBy != "" {
+		status = append(status, fmt.Sprintf("managed-by=%q", req.ManagedBy))
+	}
+	if req.OwnershipPolicy != "" && req.OwnershipPolicy != OwnershipPolicyIgnore {
+		status = append(status, fmt.Sprintf("ownership-policy=%s", req.OwnershipPolicy))
+	}
 	status = append(status, fmt.Sprintf("license_info=%s", LicensingStatus(req.LicenseConfig)))
 
 	return fmt.Sprintf("admin:{%s}", strings.Join(status, ","))
@@ -168,13 +431,15 @@ func LicensingStatus(req *LicenseConfig) string {
 
 // AdminStatus represents the administrative status.
 type AdminStatus struct {
-	Name                string `json:"name,omitempty"`
-	LogLevel            string `json:"loglevel,omitempty"`
-	MetricsEndpoint     string `json:"metrics_endpoint,omitempty"`
-	HealthCheckEndpoint string `json:"healthcheck_endpoint,omitempty"`
-	UserQuota           string `json:"quota,omitempty"`
-	OffloadStatus       string `json:"offload,omitempty"`
-	LicensingInfo       string `json:"licensing_info,omitempty"`
+	Name                string      `json:"name,omitempty"`
+	LogLevel            string      `json:"loglevel,omitempty"`
+	MetricsEndpoint     string      `json:"metrics_endpoint,omitempty"`
+	HealthCheckEndpoint string      `json:"healthcheck_endpoint,omitempty"`
+	UserQuota           string      `json:"quota,omitempty"`
+	OffloadStatus       string      `json:"offload,omitempty"`
+	LicensingInfo       string      `json:"licensing_info,omitempty"`
+	ConfigId            string      `json:"config_id,omitempty"`
+	Meta                *ObjectMeta `json:"meta,omitempty"`
 }
 
 // String returns a string reprsentation of the administrative status.
@@ -196,6 +461,12 @@ func (a *AdminStatus) String() string {
 	if a.OffloadStatus != "" {
 		status = append(status, fmt.Sprintf("offload=%s", a.OffloadStatus))
 	}
+	if a.ConfigId != "" {
+		status = append(status, fmt.Sprintf("config-id=%q", a.ConfigId))
+	}
+	if a.Meta != nil {
+		status = append(status, a.Meta.String())
+	}
 
 	return fmt.Sprintf("admin:{%s}", strings.Join(status, ","))
 }
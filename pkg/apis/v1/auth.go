@@ -1,14 +1,18 @@
 package v1
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
 	"reflect"
+	"sort"
 	"strings"
 )
 
 // Auth specifies the STUN/TURN authentication mechanism used by STUNner.
 type AuthConfig struct {
-	// Type of the STUN/TURN authentication mechanism ("static" or "ephemeral"). The deprecated
+	// Type of the STUN/TURN authentication mechanism ("static", "ephemeral", "oauth", "ldap"
+	// or "none"). The deprecated
 	// type name "plaintext" is accepted for "static" and the deprecated type name "longterm"
 	// is accepted for "ephemeral" for compatibility with older versions.
 	Type string `json:"type,omitempty"`
@@ -18,10 +22,100 @@ type AuthConfig struct {
 	// "username" and "password" must be set, for "ephemeral" the key "secret" specifying the
 	// shared authentication secret must be set.
 	Credentials map[string]string `json:"credentials"`
+	// NonceTTL is the lifetime of the nonces handed out to clients, in seconds. Clients using
+	// an expired nonce receive a Stale Nonce error with a fresh nonce and must retry the
+	// request. Shorter lifetimes provide better replay protection at the cost of more client
+	// retries. Cannot exceed one hour, the built-in nonce lifetime of the TURN server. Enforced
+	// on UDP listeners only. Default is zero, which means the built-in nonce lifetime.
+	NonceTTL int `json:"nonce_ttl,omitempty"`
+	// NonceRenewal is the nonce regeneration policy: "fixed" retires a nonce after NonceTTL
+	// has passed since it was issued, while "sliding" retires a nonce only after it has not
+	// been used for NonceTTL, which avoids retry storms for active clients. Nonces are always
+	// retired after one hour. Default is "fixed".
+	NonceRenewal string `json:"nonce_renewal,omitempty"`
+	// OAuth configures third-party authorization (RFC 7635) for the "oauth" authentication
+	// type.
+	OAuth *OAuthConfig `json:"oauth,omitempty"`
+	// LDAP configures the LDAP credential backend for the "ldap" authentication type.
+	LDAP *LDAPConfig `json:"ldap,omitempty"`
+	// AllowedSources is the list of client source ranges, given as IP addresses or CIDR
+	// prefixes, that may use TURN anonymously with the "none" authentication type: clients
+	// from these ranges are accepted with an arbitrary username and an empty password, while
+	// other clients can use STUN only. Intended for local development and automated tests.
+	// Default is the loopback ranges "127.0.0.0/8" and "::1/128".
+	AllowedSources []string `json:"allowed_sources,omitempty"`
 }
 
+// OAuthConfig specifies third-party authorization (RFC 7635): clients present self-contained
+// access tokens issued by an authorization server, encrypted with a token key shared between the
+// authorization server and STUNner.
+type OAuthConfig struct {
+	// ServerName is the name of the STUN server, used as the associated data when encrypting
+	// access tokens. Must match the server name used by the authorization server.
+	ServerName string `json:"server_name"`
+	// AuthorizationServer is the name of the authorization server advertised to the clients in
+	// the THIRD-PARTY-AUTHORIZATION attribute. Optional.
+	AuthorizationServer string `json:"authorization_server,omitempty"`
+	// Keys is the list of token keys, identified by the key ID presented by the clients in
+	// the USERNAME attribute.
+	Keys []OAuthKey `json:"keys"`
+}
+
+// LDAPConfig specifies an LDAP/Active Directory credential backend. Since TURN long-term
+// credentials never send the password over the wire, the directory must store either the
+// cleartext TURN password or the HA1 hash (the hex-encoded MD5 hash of
+// "username:realm:password") of the users.
+type LDAPConfig struct {
+	// URL is the URL of the LDAP server, e.g., "ldaps://ldap.example.com:636".
+	URL string `json:"url"`
+	// BindDN is the DN of the service account used to search the directory. Default is
+	// empty, which means anonymous search.
+	BindDN string `json:"bind_dn,omitempty"`
+	// BindPassword is the password of the service account.
+	BindPassword string `json:"bind_password,omitempty"`
+	// BaseDN is the search base for user entries.
+	BaseDN string `json:"base_dn"`
+	// UserFilter is the search filter for user entries, where "%s" is replaced with the
+	// (escaped) TURN username. Default is "(uid=%s)".
+	UserFilter string `json:"user_filter,omitempty"`
+	// PasswordAttribute is the name of the attribute holding the cleartext TURN password.
+	PasswordAttribute string `json:"password_attribute,omitempty"`
+	// HA1Attribute is the name of the attribute holding the HA1 hash of the TURN
+	// credentials. Either PasswordAttribute or HA1Attribute must be set.
+	HA1Attribute string `json:"ha1_attribute,omitempty"`
+	// PoolSize is the maximum number of pooled connections to the LDAP server. Default is 4.
+	PoolSize int `json:"pool_size,omitempty"`
+	// CacheTTL is the time credentials are cached for, in seconds. Unknown users are cached
+	// for at most 10 seconds. Default is 300.
+	CacheTTL int `json:"cache_ttl,omitempty"`
+	// Timeout is the timeout for LDAP operations, in seconds. Default is 2.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// OAuthKey is a token key used to decrypt access tokens.
+type OAuthKey struct {
+	// KeyID is the key identifier (kid).
+	KeyID string `json:"kid"`
+	// Key is the base64-encoded AES-GCM key: 16 bytes for AES-128-GCM or 32 bytes for
+	// AES-256-GCM.
+	Key string `json:"key"`
+}
+
+// Nonce regeneration policies.
+const (
+	NonceRenewalFixed   = "fixed"
+	NonceRenewalSliding = "sliding"
+)
+
 // Validate checks a configuration and injects defaults.
 func (req *AuthConfig) Validate() error {
+	if err := req.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrAuthConfig, err)
+	}
+	return nil
+}
+
+func (req *AuthConfig) validate() error {
 	if req.Type == "" {
 		req.Type = DefaultAuthType
 	}
@@ -35,7 +129,17 @@ func (req *AuthConfig) Validate() error {
 
 	switch atype {
 	case AuthTypeNone:
-		// no auth
+		if len(req.AllowedSources) == 0 {
+			req.AllowedSources = []string{DefaultAllowedSourceIPv4, DefaultAllowedSourceIPv6}
+		}
+		for i, src := range req.AllowedSources {
+			n, err := ParseSourceRange(src)
+			if err != nil {
+				return fmt.Errorf("%s: %w", atype.String(), err)
+			}
+			// normalize
+			req.AllowedSources[i] = n.String()
+		}
 
 	case AuthTypeStatic:
 		_, userFound := req.Credentials["username"]
@@ -49,6 +153,16 @@ func (req *AuthConfig) Validate() error {
 		if !secretFound {
 			return fmt.Errorf("no secret found in %s auth config", atype.String())
 		}
+
+	case AuthTypeOAuth:
+		if err := req.OAuth.validate(); err != nil {
+			return fmt.Errorf("%s: %w", atype.String(), err)
+		}
+
+	case AuthTypeLDAP:
+		if err := req.LDAP.validate(); err != nil {
+			return fmt.Errorf("%s: %w", atype.String(), err)
+		}
 	default:
 		return fmt.Errorf("invalid authentication type %q", req.Type)
 	}
@@ -61,6 +175,93 @@ func (req *AuthConfig) Validate() error {
 		req.Credentials = map[string]string{}
 	}
 
+	if req.NonceTTL < 0 {
+		req.NonceTTL = 0
+	}
+	if req.NonceTTL > MaxNonceTTL {
+		return fmt.Errorf("nonce TTL %ds exceeds the maximum of %ds", req.NonceTTL, MaxNonceTTL)
+	}
+
+	req.NonceRenewal = strings.ToLower(req.NonceRenewal)
+	switch req.NonceRenewal {
+	case "":
+		req.NonceRenewal = NonceRenewalFixed
+	case NonceRenewalFixed, NonceRenewalSliding:
+	default:
+		return fmt.Errorf("invalid nonce renewal policy %q, must be either %q or %q",
+			req.NonceRenewal, NonceRenewalFixed, NonceRenewalSliding)
+	}
+
+	return nil
+}
+
+func (o *OAuthConfig) validate() error {
+	if o == nil {
+		return fmt.Errorf("missing OAuth config")
+	}
+	if o.ServerName == "" {
+		return fmt.Errorf("empty server name")
+	}
+	if len(o.Keys) == 0 {
+		return fmt.Errorf("no token keys")
+	}
+
+	kids := map[string]bool{}
+	for _, k := range o.Keys {
+		if k.KeyID == "" {
+			return fmt.Errorf("empty key ID")
+		}
+		if kids[k.KeyID] {
+			return fmt.Errorf("duplicate key ID %q", k.KeyID)
+		}
+		kids[k.KeyID] = true
+
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return fmt.Errorf("invalid token key for key ID %q: %w", k.KeyID, err)
+		}
+		if len(key) != 16 && len(key) != 32 {
+			return fmt.Errorf("invalid token key length for key ID %q: must be 16 or 32 "+
+				"bytes, got %d", k.KeyID, len(key))
+		}
+	}
+
+	sort.Slice(o.Keys, func(i, j int) bool { return o.Keys[i].KeyID < o.Keys[j].KeyID })
+
+	return nil
+}
+
+func (l *LDAPConfig) validate() error {
+	if l == nil {
+		return fmt.Errorf("missing LDAP config")
+	}
+	if !strings.HasPrefix(l.URL, "ldap://") && !strings.HasPrefix(l.URL, "ldaps://") {
+		return fmt.Errorf("invalid LDAP URL %q", l.URL)
+	}
+	if l.BaseDN == "" {
+		return fmt.Errorf("empty base DN")
+	}
+	if (l.PasswordAttribute == "") == (l.HA1Attribute == "") {
+		return fmt.Errorf("exactly one of the password attribute and the HA1 attribute " +
+			"must be set")
+	}
+
+	if l.UserFilter == "" {
+		l.UserFilter = DefaultLDAPUserFilter
+	}
+	if !strings.Contains(l.UserFilter, "%s") {
+		return fmt.Errorf("user filter %q must contain %%s", l.UserFilter)
+	}
+	if l.PoolSize <= 0 {
+		l.PoolSize = DefaultLDAPPoolSize
+	}
+	if l.CacheTTL <= 0 {
+		l.CacheTTL = DefaultLDAPCacheTTL
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = DefaultLDAPTimeout
+	}
+
 	return nil
 }
 
@@ -83,6 +284,41 @@ func (req *AuthConfig) DeepCopyInto(dst Config) {
 	for k, v := range req.Credentials {
 		ret.Credentials[k] = v
 	}
+	ret.OAuth = req.OAuth.DeepCopy()
+	if req.LDAP != nil {
+		ldap := *req.LDAP
+		ret.LDAP = &ldap
+	}
+	if req.AllowedSources != nil {
+		ret.AllowedSources = make([]string, len(req.AllowedSources))
+		copy(ret.AllowedSources, req.AllowedSources)
+	}
+}
+
+// ParseSourceRange parses a client source range given as an IP address or a CIDR prefix.
+func ParseSourceRange(src string) (*net.IPNet, error) {
+	if _, n, err := net.ParseCIDR(src); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(src)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source range %q", src)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// DeepCopy copies an OAuth configuration.
+func (o *OAuthConfig) DeepCopy() *OAuthConfig {
+	if o == nil {
+		return nil
+	}
+	ret := *o
+	ret.Keys = make([]OAuthKey, len(o.Keys))
+	copy(ret.Keys, o.Keys)
+	return &ret
 }
 
 // String stringifies the configuration.
@@ -95,7 +331,10 @@ func (req *AuthConfig) String() string {
 	if atype, err := NewAuthType(req.Type); err == nil {
 		switch atype {
 		case AuthTypeNone:
-			// no auth
+			if len(req.AllowedSources) > 0 {
+				status = append(status, fmt.Sprintf("allowed-sources=[%s]",
+					strings.Join(req.AllowedSources, ",")))
+			}
 		case AuthTypeStatic:
 			u, userFound := req.Credentials["username"]
 			if userFound {
@@ -132,11 +371,46 @@ func (req *AuthConfig) String() string {
 			}
 
 			status = append(status, fmt.Sprintf("secret=%q", s))
+
+		case AuthTypeLDAP:
+			if req.LDAP != nil {
+				status = append(status, fmt.Sprintf("url=%q,base-dn=%q", req.LDAP.URL,
+					req.LDAP.BaseDN))
+			}
+
+		case AuthTypeOAuth:
+			if req.OAuth != nil {
+				kids := make([]string, len(req.OAuth.Keys))
+				for i, k := range req.OAuth.Keys {
+					kids[i] = k.KeyID
+				}
+				status = append(status, fmt.Sprintf("server-name=%q,kids=[%s]",
+					req.OAuth.ServerName, strings.Join(kids, ",")))
+			}
 		}
 	}
 
+	if req.NonceTTL > 0 {
+		status = append(status, fmt.Sprintf("nonce-ttl=%ds", req.NonceTTL))
+	}
+	if req.NonceRenewal != "" && req.NonceRenewal != NonceRenewalFixed {
+		status = append(status, fmt.Sprintf("nonce-renewal=%s", req.NonceRenewal))
+	}
+
 	return fmt.Sprintf("%s-auth:{%s}", req.Type, strings.Join(status, ","))
 }
 
 // AuthStatus represents the authentication status.
-type AuthStatus = AuthConfig
+type AuthStatus struct {
+	*AuthConfig
+	Meta *ObjectMeta `json:"meta,omitempty"`
+}
+
+// String stringifies the authentication status.
+func (a *AuthStatus) String() string {
+	status := a.AuthConfig.String()
+	if a.Meta != nil {
+		status = strings.TrimSuffix(status, "}") + "," + a.Meta.String() + "}"
+	}
+	return status
+}
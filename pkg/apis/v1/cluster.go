@@ -2,11 +2,17 @@ package v1
 
 import (
 	"fmt"
+	"maps"
+	"net"
+	"net/netip"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/l7mp/stunner/internal/util"
+	"github.com/l7mp/stunner/internal/endpoint"
+	"github.com/l7mp/stunner/internal/schedule"
 )
 
 // ClusterConfig specifies a set of upstream peers to which STUNner can open transport relay
@@ -15,25 +21,120 @@ import (
 // assumed to be proper DNS domain names: STUNner will resolve each domain name in the background
 // and admit a new connection only if the peer address matches one of the IP addresses returned by
 // the DNS resolver for one of the endpoints. STRICT_DNS clusters are best used with headless
-// Kubernetes services.
+// Kubernetes services. In CONSUL clusters the endpoints are Consul service names: STUNner will
+// watch the healthy instances of each service via the Consul agent and admit a new connection only
+// if the peer address matches the address of one of the instances. CONSUL clusters are intended
+// for non-Kubernetes deployments using Consul for service discovery. In EDS clusters the endpoints
+// are cluster names known to an xDS control plane: STUNner will subscribe to the endpoints of each
+// cluster over the Envoy Endpoint Discovery Service (EDS) protocol and admit a new connection only
+// if the peer address matches the address of one of the endpoints. BLOCK clusters explicitly
+// blackhole the endpoints, given in the same format as for STATIC clusters: a listener denies
+// access to any peer that matches a BLOCK cluster the listener routes to, even if another cluster
+// of the listener would admit the peer. TURN clusters relay the traffic to the endpoints, given in
+// the same format as for STATIC clusters, through an upstream TURN server, for cascaded
+// deployments where an edge gateway relays into another TURN server.
 type ClusterConfig struct {
 	// Name of the cluster. Name is mandatory.
 	Name string `json:"name"`
-	// Type specifies the cluster address resolution policy, either STATIC or
-	// STRICT_DNS. Default is "STATIC".
+	// Labels are free-form key-value pairs attached to the cluster, e.g., "env: staging" or
+	// "tenant: acme", for selecting clusters in the admin API queries and for filtering the
+	// metrics, where each label is exported as a "label_<key>" metric label. Keys and values
+	// follow the Kubernetes label syntax. Default is empty.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ManagedBy is the manager owning the cluster, e.g., "file", "api" or "operator" (see
+	// the ownership policy in the admin config). Default is the manager issuing the config.
+	ManagedBy string `json:"managed_by,omitempty"`
+	// Type specifies the cluster address resolution policy, either STATIC, STRICT_DNS, CONSUL
+	// or EDS, BLOCK for clusters that deny access to the endpoints, or TURN for clusters
+	// reached through an upstream TURN server. Default is "STATIC".
 	Type string `json:"type,omitempty"`
 	// Protocol specifies the protocol to be used with the cluster, either UDP (default) or TCP
 	// (not implemented yet).
 	Protocol string `json:"protocol,omitempty"`
 	// Endpoints specifies the peers that can be reached via this cluster.
 	Endpoints []string `json:"endpoints,omitempty"`
+	// Targets specifies additional peers located in peered remote Kubernetes clusters, tagged
+	// with the name of the remote cluster, for multi-cluster media topologies. The traffic
+	// relayed to the endpoints of each target is reported in separate per-target metrics.
+	// Supported only for STATIC clusters.
+	Targets []ClusterTarget `json:"targets,omitempty"`
+	// MirrorTo is a list of UDP endpoints (in the format IP:port) to which a copy of each packet
+	// relayed to the peers of the cluster is sent, e.g., for shadow-testing a new media server
+	// pool with production media. Each peer is mirrored to the same endpoint during its
+	// lifetime. Mirroring is best-effort: mirrored packets may be lost and the responses from
+	// the mirror endpoints are dropped. Default is empty, which disables mirroring.
+	MirrorTo []string `json:"mirror_to,omitempty"`
+	// MirrorRateLimit caps the number of packets mirrored per second, the packets above the
+	// cap are not mirrored. Default is 10000 if MirrorTo is set.
+	MirrorRateLimit int `json:"mirror_rate_limit,omitempty"`
+	// ActiveWindows restricts the times when new permissions can be created to the peers of the
+	// cluster to a list of weekly recurring windows, each in the format "[DAYS ]HH:MM-HH:MM",
+	// e.g., "Mon-Fri 09:00-17:00" or "Sat,Sun 22:00-02:00". Existing permissions remain in
+	// effect until they expire. Default is empty, which means the cluster is always active. Not
+	// supported for BLOCK clusters.
+	ActiveWindows []string `json:"active_windows,omitempty"`
+	// Timezone is the IANA name of the time zone the active windows are interpreted in, e.g.,
+	// "Europe/Budapest". Default is "UTC".
+	Timezone string `json:"timezone,omitempty"`
+	// Upstream specifies the upstream TURN server through which the traffic to the endpoints
+	// of a TURN cluster is relayed. Mandatory for TURN clusters and not supported for other
+	// cluster types.
+	Upstream *ClusterUpstream `json:"upstream,omitempty"`
+	// Metadata specifies the identity of the Kubernetes Service the cluster was generated
+	// from, for tenant-level accounting in multi-tenant clusters: the namespace and the name
+	// of the Service are added as labels to the cluster metrics and are included in the
+	// access logs. Default is empty.
+	Metadata *ClusterMetadata `json:"metadata,omitempty"`
+}
+
+// ClusterMetadata is the identity of the Kubernetes Service a cluster was generated from.
+type ClusterMetadata struct {
+	// Namespace is the namespace of the Service.
+	Namespace string `json:"namespace,omitempty"`
+	// Service is the name of the Service.
+	Service string `json:"service,omitempty"`
+}
+
+// String stringifies the cluster metadata as "<namespace>/<service>".
+func (m *ClusterMetadata) String() string {
+	return m.Namespace + "/" + m.Service
+}
+
+// ClusterUpstream is an upstream TURN server.
+type ClusterUpstream struct {
+	// Address is the address of the upstream TURN server in the format host:port. Only
+	// TURN-UDP is supported. Address is mandatory.
+	Address string `json:"address"`
+	// Username is the username for authenticating with the upstream TURN server.
+	Username string `json:"username,omitempty"`
+	// Password is the password for authenticating with the upstream TURN server.
+	Password string `json:"password,omitempty"`
+}
+
+// ClusterTarget is a set of peers located in a remote Kubernetes cluster.
+type ClusterTarget struct {
+	// Name is the name of the remote Kubernetes cluster. Name is mandatory.
+	Name string `json:"name"`
+	// Endpoints specifies the peers in the remote cluster, in the same format as the endpoints
+	// of STATIC clusters.
+	Endpoints []string `json:"endpoints,omitempty"`
 }
 
 // Validate checks a configuration and injects defaults.
 func (req *ClusterConfig) Validate() error {
+	if err := req.validate(); err != nil {
+		return ErrInvalidCluster{Name: req.Name, Reason: err.Error()}
+	}
+	return nil
+}
+
+func (req *ClusterConfig) validate() error {
 	if req.Name == "" {
 		return fmt.Errorf("missing name in cluster configuration: %s", req.String())
 	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return err
+	}
 
 	// Normalize
 	if req.Type == "" {
@@ -56,20 +157,114 @@ func (req *ClusterConfig) Validate() error {
 	req.Protocol = p.String()
 
 	// Do endpoints parse?
-	if t == ClusterTypeStatic {
+	switch t {
+	case ClusterTypeStatic, ClusterTypeBlock, ClusterTypeTURN:
 		for _, ep := range req.Endpoints {
-			if _, err := util.ParseEndpoint(ep); err != nil {
+			if _, err := endpoint.Parse(ep); err != nil {
 				return err
 			}
 		}
+	case ClusterTypeConsul:
+		for _, ep := range req.Endpoints {
+			if ep == "" || strings.ContainsAny(ep, "/?# \t") {
+				return fmt.Errorf("invalid Consul service name %q", ep)
+			}
+		}
+	case ClusterTypeEDS:
+		for _, ep := range req.Endpoints {
+			if ep == "" {
+				return fmt.Errorf("empty EDS cluster name")
+			}
+		}
 	}
 
 	if req.Endpoints == nil {
 		req.Endpoints = []string{}
 	}
 
+	if t == ClusterTypeTURN {
+		if req.Upstream == nil || req.Upstream.Address == "" {
+			return fmt.Errorf("missing upstream TURN server address for %s cluster",
+				ClusterTypeTURN.String())
+		}
+		if _, port, err := net.SplitHostPort(req.Upstream.Address); err != nil {
+			return fmt.Errorf("invalid upstream TURN server address %q: %w",
+				req.Upstream.Address, err)
+		} else if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("invalid port in upstream TURN server address %q",
+				req.Upstream.Address)
+		}
+	} else if req.Upstream != nil {
+		return fmt.Errorf("upstream TURN server is supported only for %s clusters",
+			ClusterTypeTURN.String())
+	}
+
 	sort.Strings(req.Endpoints)
 
+	if req.Metadata != nil && req.Metadata.Namespace == "" && req.Metadata.Service == "" {
+		req.Metadata = nil
+	}
+	if req.Metadata != nil && req.Metadata.Service == "" {
+		return fmt.Errorf("missing service name in cluster metadata")
+	}
+
+	if len(req.Targets) > 0 && t != ClusterTypeStatic {
+		return fmt.Errorf("targets are supported only for %s clusters", ClusterTypeStatic.String())
+	}
+	names := map[string]bool{}
+	for i := range req.Targets {
+		target := &req.Targets[i]
+		if target.Name == "" {
+			return fmt.Errorf("missing name in cluster target: %s", req.String())
+		}
+		if names[target.Name] {
+			return fmt.Errorf("duplicate cluster target %q", target.Name)
+		}
+		names[target.Name] = true
+		for _, ep := range target.Endpoints {
+			if _, err := endpoint.Parse(ep); err != nil {
+				return fmt.Errorf("cluster target %q: %w", target.Name, err)
+			}
+		}
+		if target.Endpoints == nil {
+			target.Endpoints = []string{}
+		}
+		sort.Strings(target.Endpoints)
+	}
+	sort.Slice(req.Targets, func(i, j int) bool { return req.Targets[i].Name < req.Targets[j].Name })
+
+	if len(req.MirrorTo) > 0 && t == ClusterTypeBlock {
+		return fmt.Errorf("traffic mirroring is not supported for %s clusters",
+			ClusterTypeBlock.String())
+	}
+	for _, m := range req.MirrorTo {
+		if _, err := netip.ParseAddrPort(m); err != nil {
+			return fmt.Errorf("invalid mirror endpoint %q: must be IP:port", m)
+		}
+	}
+	if req.MirrorRateLimit < 0 {
+		return fmt.Errorf("invalid mirror rate limit %d", req.MirrorRateLimit)
+	}
+	if len(req.MirrorTo) > 0 && req.MirrorRateLimit == 0 {
+		req.MirrorRateLimit = DefaultMirrorRateLimit
+	}
+	sort.Strings(req.MirrorTo)
+
+	if len(req.ActiveWindows) > 0 && t == ClusterTypeBlock {
+		return fmt.Errorf("active windows are not supported for %s clusters",
+			ClusterTypeBlock.String())
+	}
+	for _, w := range req.ActiveWindows {
+		if _, err := schedule.Parse(w); err != nil {
+			return err
+		}
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", req.Timezone, err)
+		}
+	}
+
 	return nil
 }
 
@@ -89,6 +284,32 @@ func (req *ClusterConfig) DeepCopyInto(dst Config) {
 	*ret = *req
 	ret.Endpoints = make([]string, len(req.Endpoints))
 	copy(ret.Endpoints, req.Endpoints)
+	if req.MirrorTo != nil {
+		ret.MirrorTo = make([]string, len(req.MirrorTo))
+		copy(ret.MirrorTo, req.MirrorTo)
+	}
+	if req.ActiveWindows != nil {
+		ret.ActiveWindows = make([]string, len(req.ActiveWindows))
+		copy(ret.ActiveWindows, req.ActiveWindows)
+	}
+	if req.Upstream != nil {
+		u := *req.Upstream
+		ret.Upstream = &u
+	}
+	if req.Metadata != nil {
+		m := *req.Metadata
+		ret.Metadata = &m
+	}
+	if req.Labels != nil {
+		ret.Labels = maps.Clone(req.Labels)
+	}
+	if req.Targets != nil {
+		ret.Targets = make([]ClusterTarget, len(req.Targets))
+		for i, t := range req.Targets {
+			ret.Targets[i] = ClusterTarget{Name: t.Name, Endpoints: make([]string, len(t.Endpoints))}
+			copy(ret.Targets[i].Endpoints, t.Endpoints)
+		}
+	}
 }
 
 // String stringifies the configuration.
@@ -111,12 +332,50 @@ func (req *ClusterConfig) String() string {
 	status = append(status, fmt.Sprintf("endpoints=[%s]",
 		strings.Join(req.Endpoints, ",")))
 
+	if len(req.Targets) > 0 {
+		ts := []string{}
+		for _, t := range req.Targets {
+			ts = append(ts, fmt.Sprintf("%s:[%s]", t.Name, strings.Join(t.Endpoints, ",")))
+		}
+		status = append(status, fmt.Sprintf("targets=[%s]", strings.Join(ts, ",")))
+	}
+
+	if req.Upstream != nil {
+		status = append(status, fmt.Sprintf("upstream=%q", req.Upstream.Address))
+	}
+
+	if req.Metadata != nil {
+		status = append(status, fmt.Sprintf("service=%q", req.Metadata.String()))
+	}
+
+	if len(req.MirrorTo) > 0 {
+		status = append(status, fmt.Sprintf("mirror-to=[%s],mirror-rate-limit=%dpps",
+			strings.Join(req.MirrorTo, ","), req.MirrorRateLimit))
+	}
+
+	if len(req.ActiveWindows) > 0 {
+		tz := "UTC"
+		if req.Timezone != "" {
+			tz = req.Timezone
+		}
+		status = append(status, fmt.Sprintf("active-windows=[%s],timezone=%s",
+			strings.Join(req.ActiveWindows, ","), tz))
+	}
+
+	if len(req.Labels) > 0 {
+		status = append(status, fmt.Sprintf("labels=[%s]", LabelsString(req.Labels)))
+	}
+	if req.ManagedBy != "" {
+		status = append(status, fmt.Sprintf("managed-by=%q", req.ManagedBy))
+	}
+
 	return fmt.Sprintf("%q:{%s}", n, strings.Join(status, ","))
 }
 
 type ClusterStatus struct {
 	*ClusterConfig
 	Stats OffloadDirStat `json:"stats"`
+	Meta  *ObjectMeta    `json:"meta,omitempty"`
 }
 
 // String stringifies the configuration.
@@ -124,5 +383,8 @@ func (req *ClusterStatus) String() string {
 	status := req.ClusterConfig.String()
 	status += fmt.Sprintf(",offload(rx/tx): %d/%d pkts %d/%d bytes",
 		req.Stats.Rx.Pkts, req.Stats.Tx.Pkts, req.Stats.Rx.Bytes, req.Stats.Tx.Bytes)
+	if req.Meta != nil {
+		status += "," + req.Meta.String()
+	}
 	return status
 }
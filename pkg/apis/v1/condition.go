@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConditionType is the type of a status condition.
+type ConditionType string
+
+const (
+	// ConditionTypeReady indicates whether the dataplane is ready to serve allocation requests.
+	ConditionTypeReady ConditionType = "Ready"
+	// ConditionTypeConfigAccepted indicates whether the last configuration was accepted.
+	ConditionTypeConfigAccepted ConditionType = "ConfigAccepted"
+	// ConditionTypeListenersProgrammed indicates whether all listeners are up and running.
+	ConditionTypeListenersProgrammed ConditionType = "ListenersProgrammed"
+)
+
+// ConditionStatus is the status of a condition.
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// Condition reasons.
+const (
+	ConditionReasonReady           = "Ready"
+	ConditionReasonNotReconciled   = "NotReconciled"
+	ConditionReasonStandby         = "Standby"
+	ConditionReasonTerminating     = "Terminating"
+	ConditionReasonDraining        = "Draining"
+	ConditionReasonAccepted        = "Accepted"
+	ConditionReasonInvalid         = "Invalid"
+	ConditionReasonRolledBack      = "RolledBack"
+	ConditionReasonReconcileFailed = "ReconcileFailed"
+	ConditionReasonPending         = "Pending"
+	ConditionReasonProgrammed      = "Programmed"
+	ConditionReasonNotProgrammed   = "NotProgrammed"
+	ConditionReasonDryRun          = "DryRun"
+	ConditionReasonNoConfiguration = "NoConfiguration"
+)
+
+// Condition is a status condition, modeled after the Kubernetes API conventions so that it can be
+// copied directly into the status of a custom resource.
+type Condition struct {
+	// Type is the type of the condition.
+	Type ConditionType `json:"type"`
+	// Status is the status of the condition, one of True, False or Unknown.
+	Status ConditionStatus `json:"status"`
+	// Reason is a CamelCase reason for the condition's last transition.
+	Reason string `json:"reason"`
+	// Message is a human readable message with details about the transition.
+	Message string `json:"message"`
+	// LastTransitionTime is the last time the condition transitioned from one status to
+	// another.
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// String stringifies a condition.
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s=%s(%s)", c.Type, c.Status, c.Reason)
+}
+
+// GetCondition finds a condition by type in a list of conditions, or returns nil if not found.
+func GetCondition(conds []Condition, t ConditionType) *Condition {
+	for i := range conds {
+		if conds[i].Type == t {
+			return &conds[i]
+		}
+	}
+	return nil
+}
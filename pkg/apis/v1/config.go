@@ -1,6 +1,11 @@
 // Package v1 is the v1 version of the STUNner API.
 package v1
 
+import (
+	"fmt"
+	"time"
+)
+
 // Config is the main interface for STUNner configuration objects.
 type Config interface {
 	// Validate checks a configuration and injects defaults.
@@ -20,3 +25,49 @@ type Status interface {
 	// String stringifies the status.
 	String() string
 }
+
+// ObjectMeta records the reconciliation history of a STUNner object (a listener, a cluster, the
+// authenticator or the admin object), which helps spotting objects that are restarted or updated
+// too often.
+type ObjectMeta struct {
+	// Generation is the config generation that last created or updated the object. The config
+	// generation is increased on each reconciliation that applies a new config.
+	Generation int64 `json:"generation"`
+	// Created is the time the object was last created or restarted.
+	Created time.Time `json:"created"`
+	// Updated is the time the object was last created, restarted or updated.
+	Updated time.Time `json:"updated"`
+}
+
+// String stringifies the object metadata.
+func (m *ObjectMeta) String() string {
+	return fmt.Sprintf("gen=%d,created=%s,updated=%s", m.Generation,
+		m.Created.Format(time.RFC3339), m.Updated.Format(time.RFC3339))
+}
+
+// ConfigWarning is a problem in a configuration that does not prevent the configuration from
+// being applied but is probably not intended, e.g., a route to a nonexistent cluster or a cluster
+// that admits any peer.
+type ConfigWarning struct {
+	// Kind is the kind of the config object the warning applies to, either "admin", "auth",
+	// "listener" or "cluster", or empty if the warning applies to the config as a whole.
+	Kind string `json:"kind,omitempty"`
+	// Name is the name of the listener or cluster the warning applies to.
+	Name string `json:"name,omitempty"`
+	// Reason is a machine-readable CamelCase reason for the warning, e.g., "ShadowedRoute".
+	Reason string `json:"reason"`
+	// Message is a human-readable description of the problem.
+	Message string `json:"message"`
+}
+
+// String stringifies the warning.
+func (w ConfigWarning) String() string {
+	switch {
+	case w.Kind != "" && w.Name != "":
+		return fmt.Sprintf("%s %q: %s", w.Kind, w.Name, w.Message)
+	case w.Kind != "":
+		return fmt.Sprintf("%s: %s", w.Kind, w.Message)
+	default:
+		return w.Message
+	}
+}
@@ -13,8 +13,16 @@ const (
 	DefaultMinRelayPort           int    = 1
 	DefaultMaxRelayPort           int    = 1<<16 - 1
 	DefaultClusterType                   = "STATIC"
+	DefaultMirrorRateLimit        int    = 10000
 	DefaultAdminName                     = "default-admin-config"
 	DefaultAuthName                      = "default-auth-config"
+	MaxNonceTTL                   int    = 3600
+	DefaultLDAPUserFilter                = "(uid=%s)"
+	DefaultLDAPPoolSize           int    = 4
+	DefaultLDAPCacheTTL           int    = 300
+	DefaultLDAPTimeout            int    = 2
+	DefaultAllowedSourceIPv4             = "127.0.0.0/8"
+	DefaultAllowedSourceIPv6             = "::1/128"
 	DefaultNodeAddressPlaceholder        = "__node_address_placeholder" // guaranteed to not parse as a valid IP
 )
 
@@ -22,6 +30,7 @@ const (
 const (
 	DefaultMetricsPort     int = 8080
 	DefaultHealthCheckPort int = 8086
+	DefaultAdminAPIPort    int = 8087
 	DefaultAuthServicePort int = 8088
 	DefaultICETesterPort   int = 8089
 )
@@ -48,6 +57,7 @@ const (
 	DefaultEnvVarAddr             = "STUNNER_ADDR"
 	DefaultEnvVarNodeName         = "STUNNER_NODENAME"
 	DefaultEnvVarConfigOrigin     = "STUNNER_CONFIG_ORIGIN"
+	DefaultEnvVarAdminToken       = "STUNNER_ADMIN_TOKEN"
 	DefaultCDSServerAddrEnv       = "CDS_SERVER_ADDR"
 	DefaultCDSServerNamespaceEnv  = "CDS_SERVER_NAMESPACE"
 	DefaultCDSServerPortEnv       = "CDS_SERVER_PORT"
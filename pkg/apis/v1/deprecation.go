@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Deprecation is the machine-readable description of a deprecated field or field value of the
+// STUNner API.
+type Deprecation struct {
+	// ApiVersion is the API version the deprecation applies to.
+	ApiVersion string `json:"version"`
+	// Field is the path of the field in the JSON representation of the config, with the
+	// segments separated by dots, e.g., "auth.type" or "listeners.public_address". List
+	// fields are matched element-wise.
+	Field string `json:"field"`
+	// Value is the deprecated value of the field. If empty, setting the field to any value is
+	// deprecated.
+	Value string `json:"value,omitempty"`
+	// Replacement is the field or the value to use instead, if any.
+	Replacement string `json:"replacement,omitempty"`
+	// RemovedIn is the API version in which the field or the value is no longer accepted.
+	RemovedIn string `json:"removedIn,omitempty"`
+}
+
+// Deprecations lists the deprecated fields and field values of the v1 API.
+var Deprecations = []Deprecation{{
+	ApiVersion:  ApiVersion,
+	Field:       "auth.type",
+	Value:       authTypePlainTextStr,
+	Replacement: authTypeStaticStr,
+	RemovedIn:   "v1beta1",
+}, {
+	ApiVersion:  ApiVersion,
+	Field:       "auth.type",
+	Value:       authTypeLongTermStr,
+	Replacement: authTypeEphemeralStr,
+	RemovedIn:   "v1beta1",
+}}
+
+// String stringifies the deprecation.
+func (d Deprecation) String() string {
+	s := fmt.Sprintf("%s: field is deprecated in API version %s", d.Field, d.ApiVersion)
+	if d.Value != "" {
+		s = fmt.Sprintf("%s: value %q is deprecated in API version %s", d.Field, d.Value,
+			d.ApiVersion)
+	}
+	if d.Replacement != "" {
+		s += fmt.Sprintf(", use %q", d.Replacement)
+	}
+	if d.RemovedIn != "" {
+		s += fmt.Sprintf(" (removed in %s)", d.RemovedIn)
+	}
+	return s
+}
+
+// Deprecated returns the deprecated fields and field values set in the configuration. Call
+// before Validate, since validation normalizes some deprecated values.
+func (req *StunnerConfig) Deprecated() []Deprecation {
+	return FindDeprecated(req, Deprecations)
+}
+
+// FindDeprecated returns the deprecations that match a configuration, given in any form that
+// serializes into the JSON representation of the config.
+func FindDeprecated(conf any, deprecations []Deprecation) []Deprecation {
+	b, err := json.Marshal(conf)
+	if err != nil {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil
+	}
+
+	ret := []Deprecation{}
+	for _, d := range deprecations {
+		if matchDeprecated(doc, strings.Split(d.Field, "."), d.Value) {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+func matchDeprecated(doc any, path []string, value string) bool {
+	switch v := doc.(type) {
+	case []any:
+		for _, e := range v {
+			if matchDeprecated(e, path, value) {
+				return true
+			}
+		}
+		return false
+	case map[string]any:
+		if len(path) == 0 {
+			return value == ""
+		}
+		e, ok := v[path[0]]
+		return ok && e != nil && matchDeprecated(e, path[1:], value)
+	default:
+		if len(path) > 0 {
+			return false
+		}
+		return value == "" || fmt.Sprint(v) == value
+	}
+}
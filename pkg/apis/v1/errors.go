@@ -11,8 +11,47 @@ var (
 	ErrNoSuchListener = errors.New("no such listener")
 	ErrNoSuchCluster  = errors.New("no such cluster")
 	// ErrInvalidRoute   = errors.New("invalid route")
+
+	// ErrAdminConfig is wrapped by the errors returned for an invalid admin configuration.
+	ErrAdminConfig error = &configError{"invalid admin configuration"}
+	// ErrAuthConfig is wrapped by the errors returned for an invalid authentication
+	// configuration.
+	ErrAuthConfig error = &configError{"invalid authentication configuration"}
 )
 
+// configError is a sentinel error for a class of invalid configurations. Matches ErrInvalidConf
+// with errors.Is.
+type configError struct {
+	msg string
+}
+
+func (e *configError) Error() string { return e.msg }
+func (e *configError) Unwrap() error { return ErrInvalidConf }
+
+// ErrInvalidListener is returned for an invalid listener configuration. Matches ErrInvalidConf
+// with errors.Is.
+type ErrInvalidListener struct {
+	Name, Reason string
+}
+
+func (e ErrInvalidListener) Error() string {
+	return fmt.Sprintf("invalid listener %q: %s", e.Name, e.Reason)
+}
+
+func (e ErrInvalidListener) Unwrap() error { return ErrInvalidConf }
+
+// ErrInvalidCluster is returned for an invalid cluster configuration. Matches ErrInvalidConf
+// with errors.Is.
+type ErrInvalidCluster struct {
+	Name, Reason string
+}
+
+func (e ErrInvalidCluster) Error() string {
+	return fmt.Sprintf("invalid cluster %q: %s", e.Name, e.Reason)
+}
+
+func (e ErrInvalidCluster) Unwrap() error { return ErrInvalidConf }
+
 type ErrRestarted struct {
 	Objects []string
 }
@@ -0,0 +1,159 @@
+package v1
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// MaxLabelKeyLength is the maximum length of a label key.
+	MaxLabelKeyLength = 253
+	// MaxLabelValueLength is the maximum length of a label value.
+	MaxLabelValueLength = 63
+)
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+// ValidateLabels checks the free-form labels of a listener or a cluster. Label keys and values
+// follow the Kubernetes conventions: keys are non-empty, at most 253 characters long and consist
+// of alphanumerics, '-', '_', '.' and '/', values are at most 63 characters long and consist of
+// alphanumerics, '-', '_' and '.'. Both must begin and end with an alphanumeric character.
+func ValidateLabels(labels map[string]string) error {
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		if len(k) > MaxLabelKeyLength || !labelKeyRegexp.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if v := labels[k]; len(v) > MaxLabelValueLength || !labelValueRegexp.MatchString(v) {
+			return fmt.Errorf("invalid value %q for label %q", v, k)
+		}
+	}
+	return nil
+}
+
+// LabelsString stringifies a set of labels in a stable order.
+func LabelsString(labels map[string]string) string {
+	ls := []string{}
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		ls = append(ls, fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	return strings.Join(ls, ",")
+}
+
+type labelOperator int
+
+const (
+	labelEquals labelOperator = iota
+	labelNotEquals
+	labelExists
+	labelDoesNotExist
+)
+
+type labelRequirement struct {
+	key, value string
+	op         labelOperator
+}
+
+func (r labelRequirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	switch r.op {
+	case labelEquals:
+		return ok && v == r.value
+	case labelNotEquals:
+		return !ok || v != r.value
+	case labelExists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+func (r labelRequirement) String() string {
+	switch r.op {
+	case labelEquals:
+		return r.key + "=" + r.value
+	case labelNotEquals:
+		return r.key + "!=" + r.value
+	case labelExists:
+		return r.key
+	default:
+		return "!" + r.key
+	}
+}
+
+// LabelSelector selects listeners and clusters by their labels. A selector is a comma-separated
+// list of requirements, each either "key=value" (or "key==value"), "key!=value", "key" (the label
+// exists) or "!key" (the label does not exist), e.g., "env=staging,tenant!=acme". An object is
+// selected if it meets all requirements. The empty selector selects all objects.
+type LabelSelector struct {
+	requirements []labelRequirement
+}
+
+// ParseLabelSelector parses a label selector.
+func ParseLabelSelector(selector string) (*LabelSelector, error) {
+	ret := &LabelSelector{}
+	for _, r := range strings.Split(selector, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		var req labelRequirement
+		switch {
+		case strings.HasPrefix(r, "!") && !strings.Contains(r, "="):
+			req = labelRequirement{key: strings.TrimSpace(r[1:]), op: labelDoesNotExist}
+		case strings.Contains(r, "!="):
+			k, v, _ := strings.Cut(r, "!=")
+			req = labelRequirement{key: strings.TrimSpace(k), value: strings.TrimSpace(v),
+				op: labelNotEquals}
+		case strings.Contains(r, "="):
+			k, v, _ := strings.Cut(r, "=")
+			req = labelRequirement{key: strings.TrimSpace(k),
+				value: strings.TrimSpace(strings.TrimPrefix(v, "=")), op: labelEquals}
+		default:
+			req = labelRequirement{key: r, op: labelExists}
+		}
+
+		if err := ValidateLabels(map[string]string{req.key: req.value}); err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+		}
+		ret.requirements = append(ret.requirements, req)
+	}
+	return ret, nil
+}
+
+// Matches returns true if a set of labels meets all requirements of the selector. A nil selector
+// matches all labels.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for _, r := range s.requirements {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true if the selector selects all objects.
+func (s *LabelSelector) Empty() bool {
+	return s == nil || len(s.requirements) == 0
+}
+
+// String stringifies the selector.
+func (s *LabelSelector) String() string {
+	if s == nil {
+		return ""
+	}
+	rs := make([]string, len(s.requirements))
+	for i, r := range s.requirements {
+		rs[i] = r.String()
+	}
+	return strings.Join(rs, ",")
+}
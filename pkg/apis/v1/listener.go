@@ -2,8 +2,12 @@ package v1
 
 import (
 	"fmt"
+	"maps"
+	"net"
 	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -11,11 +15,22 @@ import (
 type ListenerConfig struct {
 	// Name of the listener.
 	Name string `json:"name,omitempty"`
+	// Labels are free-form key-value pairs attached to the listener, e.g., "env: staging" or
+	// "tenant: acme", for selecting listeners in the admin API queries and for filtering the
+	// metrics, where each label is exported as a "label_<key>" metric label. Keys and values
+	// follow the Kubernetes label syntax. Default is empty.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ManagedBy is the manager owning the listener, e.g., "file", "api" or "operator" (see
+	// the ownership policy in the admin config). Default is the manager issuing the config.
+	ManagedBy string `json:"managed_by,omitempty"`
 	// Protocol is the transport protocol ("UDP", "TCP", "TLS", "DTLS") or the complete L4/L7
 	// protocol stack ("TURN-UDP", "TURN-TCP", "TURN-TLS", "TURN-DTLS") used by the listener.
 	// The application-layer protocol on top of the transport protocol is always TURN, so "UDP"
 	// and "TURN-UDP" are equivalent (and so on for the other protocols). Default is
-	// "TURN-UDP".
+	// "TURN-UDP". Multiple protocols can be listed separated by commas (e.g.,
+	// "TURN-UDP,TURN-TCP") to serve all of them on the same port with identical settings,
+	// from the same listener; at most one UDP-based (UDP or DTLS) and one TCP-based (TCP or
+	// TLS) protocol can be given.
 	Protocol string `json:"protocol,omitempty"`
 	// PublicAddr is the Internet-facing public IP address for the listener (ignored by
 	// STUNner).
@@ -26,29 +41,280 @@ type ListenerConfig struct {
 	Addr string `json:"address,omitempty"`
 	// Port is the port for the listener. Default is the standard TURN port (3478).
 	Port int `json:"port,omitempty"`
+	// MinRelayPort is the lowest relay port of the allocations created at the listener. Setting
+	// a relay port range, e.g., to match the ports opened in a firewall, makes the listener
+	// lease the ports of the range to the allocations and refuse new allocations with a 508
+	// (Insufficient Capacity) error when the range is exhausted. If only the upper bound is set
+	// the range starts at port 1. Not supported in single-port mode. Default is 0, which, if
+	// MaxRelayPort is unset as well, lets the operating system choose the relay ports.
+	MinRelayPort int `json:"min_relay_port,omitempty"`
+	// MaxRelayPort is the highest relay port of the allocations created at the listener, see
+	// MinRelayPort. If only the lower bound is set the range ends at port 65535. Default is 0.
+	MaxRelayPort int `json:"max_relay_port,omitempty"`
+	// RelayPortRanges is a list of disjoint relay port ranges in the format "min-max" (or a
+	// single port), for deployments where a large contiguous range cannot be opened in the
+	// firewall. The ranges are used in the given order: relay ports are leased from a range only
+	// when all the preceding ranges are exhausted. The range set with MinRelayPort and
+	// MaxRelayPort, if any, comes first. Not supported in single-port mode. Default is empty.
+	RelayPortRanges []string `json:"relay_port_ranges,omitempty"`
 	// Cert is the base64-encoded TLS cert.
 	Cert string `json:"cert,omitempty"`
 	// Key is the base64-encoded TLS key.
 	Key string `json:"key,omitempty"`
-	// Routes specifies the list of Routes allowed via a listener.
+	// Routes specifies the list of Routes allowed via a listener. When the clusters overlap, BLOCK
+	// clusters take precedence, then the cluster with the longest matching endpoint prefix, then
+	// the order of the routes.
 	Routes []string `json:"routes,omitempty"`
+	// ClientIPQuota defines the number of simultaneous TURN allocations permitted from a
+	// single client IP address at the listener, independently of the username used to
+	// authenticate the allocation. Default is 0, meaning no quota is enforced.
+	ClientIPQuota int `json:"client_ip_quota,omitempty"`
+	// AllowedCountries is a list of ISO 3166-1 alpha-2 country codes: if non-empty, only
+	// clients geolocated to one of the listed countries can create allocations at the
+	// listener. Clients that cannot be geolocated are rejected. Requires a GeoIP database to be
+	// set in the admin config.
+	AllowedCountries []string `json:"allowed_countries,omitempty"`
+	// DeniedCountries is a list of ISO 3166-1 alpha-2 country codes: clients geolocated to one
+	// of the listed countries cannot create allocations at the listener. Requires a GeoIP
+	// database to be set in the admin config.
+	DeniedCountries []string `json:"denied_countries,omitempty"`
+	// AllowedOrigins is a list of web origins (e.g., "https://app.example.com"): if non-empty,
+	// only the allocations requested with an ORIGIN attribute matching one of the listed
+	// origins are permitted at the listener, which lets a gateway shared by multiple
+	// applications admit the clients of selected applications only. Origins are compared
+	// case-insensitively, ignoring a trailing slash. The origin of the allocations is logged at
+	// the listeners with an origin policy. Default is empty, which permits any origin.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// OriginRoutes maps web origins to lists of routes: the allocations requested with an
+	// ORIGIN attribute matching one of the origins can reach only the routes listed for the
+	// origin, which must be a subset of the routes of the listener, so that the applications
+	// sharing a gateway can be confined to their own backends. Allocations with other or no
+	// origins can reach all the routes of the listener. Default is empty.
+	OriginRoutes map[string][]string `json:"origin_routes,omitempty"`
+	// TarpitDelay enables tarpit mode for clients denied by the country filters of a UDP
+	// listener: instead of rejecting the STUN/TURN requests of denied clients immediately,
+	// STUNner waits for the given number of seconds and then responds with a bogus error,
+	// recording each request in the logs and the metrics. Default is 0, which disables tarpit
+	// mode.
+	TarpitDelay int `json:"tarpit_delay,omitempty"`
+	// BindingRateLimit caps the number of STUN Binding requests per second served by the UDP
+	// sockets of the listener, in order to prevent STUN Binding floods from using STUNner for
+	// reflection and amplification attacks. The limit applies to the listener as a whole and
+	// does not affect other STUN/TURN requests. Default is 0, meaning no limit.
+	BindingRateLimit int `json:"binding_rate_limit,omitempty"`
+	// BindingRateLimitSilent makes the listener silently drop the Binding requests exceeding
+	// the Binding rate limit, and the requests rejected in strict mode (see
+	// RequireFingerprint and RequireMessageIntegrity), instead of responding with an
+	// error. Default is false.
+	BindingRateLimitSilent bool `json:"binding_rate_limit_silent,omitempty"`
+	// ForwardAddress enables single-port deployments for UDP listeners: packets received on
+	// the listener that are neither STUN/TURN messages nor TURN ChannelData messages (e.g.,
+	// QUIC or RTP) are forwarded to the given UDP address (in the format host:port), and
+	// the responses are sent back to the client from the listener port. Default is empty,
+	// which means non-STUN packets are dropped.
+	ForwardAddress string `json:"forward_address,omitempty"`
+	// SinglePort enables single-port media-plane mode for UDP listeners: the relayed peer
+	// traffic of all allocations is sent and received on the listener port instead of a
+	// per-allocation relay port, so that only a single UDP port needs to be exposed. Peers
+	// are tracked by their transport address: a peer can send to an allocation only after
+	// the allocation has sent a packet to the peer, and a peer transport address can be used
+	// by a single allocation at a time. Default is false.
+	SinglePort bool `json:"single_port,omitempty"`
+	// ICEUfrag is the local ICE username fragment of the ICE-lite responder of a UDP
+	// listener. If set together with ICEPassword, ICE connectivity checks addressed to the
+	// listener are answered directly by STUNner, which allows to terminate ICE at STUNner in
+	// asymmetric media-gateway deployments (see also ForwardAddress). Default is empty,
+	// which disables the ICE-lite responder.
+	ICEUfrag string `json:"ice_ufrag,omitempty"`
+	// ICEPassword is the local ICE password of the ICE-lite responder of a UDP listener.
+	ICEPassword string `json:"ice_password,omitempty"`
+	// RTPInspection enables passive RTP inspection on the relay connections of the
+	// listener: RTP (and SRTP) streams are recognized in the relayed traffic and packet loss
+	// and jitter are estimated from the RTP sequence numbers and timestamps. At most 64
+	// streams are tracked per allocation and direction: streams idle for 30 seconds are
+	// forgotten to make room for new streams. Statistics are exported as metrics and logged
+	// per session when an allocation is closed. Changes apply to new allocations
+	// only. Default is false.
+	RTPInspection bool `json:"rtp_inspection,omitempty"`
+	// DualStackRelay makes the relay connections of the listener accept both IPv4 and IPv6
+	// peers, irrespective of the address family of the client, so that, e.g., IPv4 clients
+	// can reach IPv6 peers. Changes apply to new allocations only. Default is false.
+	DualStackRelay bool `json:"dual_stack_relay,omitempty"`
+	// NAT64Prefix is the /96 NAT64 prefix (RFC 6052, e.g., "64:ff9b::/96") used to reach
+	// IPv4 peers over IPv6 via a NAT64 gateway, e.g., in IPv6-only clusters. If set, packets
+	// to IPv4 peers are sent to the corresponding IPv4-embedded IPv6 address, and packets
+	// received from IPv4-embedded IPv6 addresses are relayed to the client as if they came
+	// from the IPv4 peer. Implies DualStackRelay. Changes apply to new allocations
+	// only. Default is empty, which disables NAT64 translation.
+	NAT64Prefix string `json:"nat64_prefix,omitempty"`
+	// MaxSessionDuration is the maximum lifetime of the allocations created at the listener,
+	// in seconds. Allocations are closed after the given time irrespective of refreshes, which
+	// forces clients to create a new allocation and re-authenticate with fresh credentials.
+	// Changes apply to new allocations only. Default is 0, meaning no limit.
+	MaxSessionDuration int `json:"max_session_duration,omitempty"`
+	// ProxyProtocol makes the TCP and TLS sockets of the listener expect a PROXY protocol (v1
+	// or v2) header at the beginning of each connection, as sent by L4 proxies and cloud load
+	// balancers, and use the client address from the header for authentication, quotas, rate
+	// limiting and logging. Connections without a valid header are closed, so the listener
+	// must be reachable only via the proxy. Requires ProxyProtocolTrustedProxies. Default is
+	// false.
+	ProxyProtocol bool `json:"proxy_protocol,omitempty"`
+	// ProxyProtocolTrustedProxies is the list of the IP addresses or CIDR prefixes of the
+	// proxies allowed to send a PROXY protocol header. Connections from other addresses are
+	// closed, so that clients cannot spoof their address by sending a header themselves.
+	// Mandatory if ProxyProtocol is enabled.
+	ProxyProtocolTrustedProxies []string `json:"proxy_protocol_trusted_proxies,omitempty"`
+	// TCPKeepalive is the TCP keepalive period for the connections of the TCP and TLS sockets
+	// of the listener, in seconds: the connections of vanished clients are closed after the
+	// keepalive probes sent in every period go unanswered. Default is 0, which uses the
+	// system default (15 seconds), and a negative value disables TCP keepalives.
+	TCPKeepalive int `json:"tcp_keepalive,omitempty"`
+	// IdleTimeout enables stale session detection: allocations that have seen neither relayed
+	// data in either direction nor an authenticated request from the client (e.g., a refresh)
+	// for the given number of seconds are closed, which reclaims the resources held by vanished
+	// clients before the allocations would expire. Not supported in single-port mode. Changes
+	// apply to new allocations only. Default is 0, which disables stale session detection.
+	IdleTimeout int `json:"idle_timeout,omitempty"`
+	// SessionTokenTimeout enables session affinity tokens: each allocation is issued an opaque
+	// token in the SESSION-TOKEN attribute of the Allocate response, and the relay address of
+	// the allocation remains reserved for the given number of seconds after the allocation
+	// ends. A client presenting the token in a new Allocate request, e.g., after a network
+	// blip changed its address, gets the same relay address if it is still reserved; the
+	// allocation still alive at the old client address, if any, is closed. Supported only for
+	// UDP listeners and not supported in single-port mode. Default is 0, which disables
+	// session affinity tokens.
+	SessionTokenTimeout int `json:"session_token_timeout,omitempty"`
+	// PortReservation enables the EVEN-PORT and RESERVATION-TOKEN attributes of RFC 5766, for
+	// clients that need adjacent relay ports, e.g., for RTP and RTCP: an Allocate request with
+	// an EVEN-PORT attribute gets an even relay port, and if the R bit is set, the next port is
+	// reserved for 30 seconds with a token that the client presents in the RESERVATION-TOKEN
+	// attribute of a subsequent Allocate request to get the reserved port. Supported only for
+	// UDP listeners and not supported in single-port mode. Default is false.
+	PortReservation bool `json:"port_reservation,omitempty"`
+	// RelayPortPins maps usernames to fixed relay ports, in the format "port" or "addr:port",
+	// for interop with legacy equipment that whitelists the remote ports. Time-windowed
+	// usernames, e.g., "timestamp:userid", are also matched by the user id. The allocations of a
+	// pinned user are always bound to the pinned port, and to the given local address if any,
+	// which is then also returned as the relay address. Pinned ports are reserved: ports of the
+	// relay port ranges pinned to a user are never leased to other allocations. A user can hold
+	// a single allocation at a time, further allocations are refused. Supported only for UDP
+	// listeners and not supported in single-port mode. Default is empty.
+	RelayPortPins map[string]string `json:"relay_port_pins,omitempty"`
+	// Mobility enables the TURN mobility extension of RFC 8016: an allocation requested with an
+	// empty MOBILITY-TICKET attribute is issued a ticket, which the client presents in a Refresh
+	// request sent from a new address, e.g., after switching from Wi-Fi to LTE, to keep the
+	// allocation, with its relay address and permissions, at the new address. Supported only for
+	// UDP listeners. Default is false.
+	Mobility bool `json:"mobility,omitempty"`
+	// EgressQueueLength enables an explicit per-allocation egress queue on the relay
+	// connections of the listener: packets sent to peers are queued and written to the
+	// peer-facing socket asynchronously, so that a full socket send buffer does not block the
+	// TURN server. When the queue is full, packets are dropped according to the drop policy
+	// (see EgressDropPolicy). Changes apply to new allocations only. Default is 0, which
+	// disables the egress queue.
+	EgressQueueLength int `json:"egress_queue_length,omitempty"`
+	// EgressDropPolicy is the packet drop policy of the egress queue: "tail" drops the packet
+	// being sent when the queue is full, while "head" drops the oldest packet in the queue,
+	// which favors fresh media over stale packets. Default is "tail".
+	EgressDropPolicy string `json:"egress_drop_policy,omitempty"`
+	// PacingRate enables a per-allocation pacer that smooths bursts toward the peers using a
+	// token bucket at the given bitrate, in kbps. This protects downstream media servers from
+	// the microbursts caused by TCP and TLS listeners flushing many messages at once. When the
+	// egress queue is enabled, packets are paced out of the queue, otherwise the pacer delays
+	// the sender. Changes apply to new allocations only. Default is 0, which disables pacing.
+	PacingRate int `json:"pacing_rate,omitempty"`
+	// MaxDatagramSize is the maximum size of the datagrams relayed to the peers, in bytes.
+	// Larger datagrams are dropped and counted instead of being fragmented, since the loss of
+	// a single IP fragment silently loses the whole datagram, e.g., a large video keyframe.
+	// Set to -1 to detect the size from the smallest MTU of the network interfaces, less the
+	// IP and UDP headers. Changes apply to new allocations only. Default is 0, which disables
+	// clamping.
+	MaxDatagramSize int `json:"max_datagram_size,omitempty"`
+	// PathMTUDiscovery sets the Don't Fragment bit on the datagrams sent to the peers and lets
+	// the kernel track the path MTU toward each peer using the ICMP "Fragmentation Needed" (or
+	// "Packet Too Big") messages. Datagrams exceeding the path MTU are dropped and counted
+	// instead of being fragmented. Supported on Linux only and not supported in single-port
+	// mode. Changes apply to new allocations only. Default is false.
+	PathMTUDiscovery bool `json:"path_mtu_discovery,omitempty"`
+	// MaxTCPConnections is the maximum number of concurrent connections of the TCP and TLS
+	// sockets of the listener. Connections exceeding the limit are closed right after being
+	// accepted, so that connection floods cannot exhaust the file descriptors of the
+	// process. Default is 0, meaning no limit.
+	MaxTCPConnections int `json:"max_tcp_connections,omitempty"`
+	// AcceptQueueLength enables a bounded accept queue on the TCP and TLS sockets of the
+	// listener: connections are accepted eagerly into the queue and closed if the queue is
+	// full, instead of piling up in the kernel backlog. Default is 0, which disables the
+	// accept queue.
+	AcceptQueueLength int `json:"accept_queue_length,omitempty"`
+	// ChurnThreshold is the number of allocations a single client IP address may create at
+	// the listener within a minute before the client is reported for allocation churn, i.e.,
+	// for rapidly recreating allocations, which commonly indicates broken client retry
+	// logic. Default is 0, which disables churn detection.
+	ChurnThreshold int `json:"churn_threshold,omitempty"`
+	// ChurnRateLimit makes the listener refuse the allocations of a client above the churn
+	// threshold, until the allocation rate of the client drops below the threshold. Requires
+	// ChurnThreshold to be set. Default is false.
+	ChurnRateLimit bool `json:"churn_rate_limit,omitempty"`
+	// CPUAffinity is a list of CPUs to pin the readloop threads of the UDP sockets of the
+	// listener to, for deployments chasing tail latency on dedicated nodes: the i-th readloop
+	// is locked to an OS thread that is pinned to the i-th CPU in the list, wrapping around if
+	// there are more readloops than CPUs. Supported only on Linux and only for UDP listeners.
+	// Default is empty, which lets the Go scheduler run the readloops on any CPU.
+	CPUAffinity []int `json:"cpu_affinity,omitempty"`
+	// Enabled can be set to false to run the listener as a warm standby: the sockets of the
+	// listener are bound and the listener is fully initialized, but new allocations are refused
+	// until the listener is enabled, either by setting Enabled to true (or removing it) or via
+	// the admin API. This cuts activation latency when traffic is moved to a new port or
+	// protocol. Default is true.
+	Enabled *bool `json:"enabled,omitempty"`
 }
 
+// Egress queue drop policies.
+const (
+	EgressDropPolicyTail = "tail"
+	EgressDropPolicyHead = "head"
+)
+
+const (
+	// MaxDatagramSizeAuto makes the maximum relayed datagram size detected from the MTU of the
+	// network interfaces.
+	MaxDatagramSizeAuto = -1
+	// MinDatagramSize is the smallest maximum datagram size that can be set: the minimum IPv4
+	// datagram size every host must be able to reassemble (576 bytes), less the IP and UDP
+	// headers.
+	MinDatagramSize = 548
+)
+
 // Validate checks a configuration and injects defaults.
 func (req *ListenerConfig) Validate() error {
+	if err := req.validate(); err != nil {
+		return ErrInvalidListener{Name: req.Name, Reason: err.Error()}
+	}
+	return nil
+}
+
+func (req *ListenerConfig) validate() error {
 	if req.Name == "" {
 		return fmt.Errorf("missing name in listener configuration: %s", req.String())
 	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return err
+	}
 
 	// Normalize
 	if req.Protocol == "" {
 		req.Protocol = DefaultProtocol
 	}
-	proto, err := NewListenerProtocol(req.Protocol)
+	protos, err := NewListenerProtocols(req.Protocol)
 	if err != nil {
 		return err
 	}
-	req.Protocol = proto.String()
+	strs := make([]string, len(protos))
+	for i, p := range protos {
+		strs[i] = p.String()
+	}
+	req.Protocol = strings.Join(strs, ",")
+	hasUDP := hasListenerProtocol(protos, ListenerProtocolTURNUDP, ListenerProtocolUDP)
 
 	if req.Addr == "" {
 		req.Addr = "0.0.0.0"
@@ -61,13 +327,13 @@ func (req *ListenerConfig) Validate() error {
 		return fmt.Errorf("invalid port: %d", req.Port)
 	}
 
-	if proto == ListenerProtocolTURNTLS || proto == ListenerProtocolTURNDTLS ||
-		proto == ListenerProtocolTLS || proto == ListenerProtocolDTLS {
+	if hasListenerProtocol(protos, ListenerProtocolTURNTLS, ListenerProtocolTURNDTLS,
+		ListenerProtocolTLS, ListenerProtocolDTLS) {
 		if req.Cert == "" {
-			return fmt.Errorf("empty TLS cert for %s listener", proto.String())
+			return fmt.Errorf("empty TLS cert for %s listener", req.Protocol)
 		}
 		if req.Key == "" {
-			return fmt.Errorf("empty TLS key for %s listener", proto.String())
+			return fmt.Errorf("empty TLS key for %s listener", req.Protocol)
 		}
 	}
 
@@ -75,10 +341,310 @@ func (req *ListenerConfig) Validate() error {
 		req.Routes = []string{}
 	}
 
+	if req.ClientIPQuota < 0 {
+		req.ClientIPQuota = 0
+	}
+
+	if req.TarpitDelay < 0 {
+		req.TarpitDelay = 0
+	}
+
+	if req.BindingRateLimit < 0 {
+		req.BindingRateLimit = 0
+	}
+
+	if req.MaxSessionDuration < 0 {
+		req.MaxSessionDuration = 0
+	}
+
+	if req.IdleTimeout < 0 {
+		req.IdleTimeout = 0
+	}
+	if req.IdleTimeout > 0 && req.SinglePort {
+		return fmt.Errorf("stale session detection is not supported in single-port mode")
+	}
+
+	if req.SessionTokenTimeout < 0 {
+		req.SessionTokenTimeout = 0
+	}
+	if req.SessionTokenTimeout > 0 && req.SinglePort {
+		return fmt.Errorf("session affinity tokens are not supported in single-port mode")
+	}
+
+	if req.MinRelayPort != 0 || req.MaxRelayPort != 0 {
+		if req.MinRelayPort == 0 {
+			req.MinRelayPort = DefaultMinRelayPort
+		}
+		if req.MaxRelayPort == 0 {
+			req.MaxRelayPort = DefaultMaxRelayPort
+		}
+		if req.MinRelayPort < DefaultMinRelayPort || req.MaxRelayPort > DefaultMaxRelayPort ||
+			req.MinRelayPort > req.MaxRelayPort {
+			return fmt.Errorf("invalid relay port range %d-%d", req.MinRelayPort,
+				req.MaxRelayPort)
+		}
+	}
+	ranges := []PortRange{}
+	if req.MaxRelayPort > 0 {
+		ranges = append(ranges, PortRange{Min: req.MinRelayPort, Max: req.MaxRelayPort})
+	}
+	for i, r := range req.RelayPortRanges {
+		pr, err := ParsePortRange(r)
+		if err != nil {
+			return err
+		}
+		req.RelayPortRanges[i] = pr.String()
+		ranges = append(ranges, pr)
+	}
+	for i := range ranges {
+		for j := 0; j < i; j++ {
+			if ranges[i].Min <= ranges[j].Max && ranges[j].Min <= ranges[i].Max {
+				return fmt.Errorf("overlapping relay port ranges %s and %s", ranges[j],
+					ranges[i])
+			}
+		}
+	}
+	if len(ranges) > 0 && req.SinglePort {
+		return fmt.Errorf("relay port ranges are not supported in single-port mode")
+	}
+
+	if req.PortReservation && req.SinglePort {
+		return fmt.Errorf("port reservations are not supported in single-port mode")
+	}
+
+	if len(req.RelayPortPins) > 0 {
+		if req.SinglePort {
+			return fmt.Errorf("relay port pins are not supported in single-port mode")
+		}
+		pins := make(map[string]string, len(req.RelayPortPins))
+		users := map[int]string{}
+		for _, u := range slices.Sorted(maps.Keys(req.RelayPortPins)) {
+			if u == "" {
+				return fmt.Errorf("empty username in relay port pins")
+			}
+			addr, err := ParseRelayPortPin(req.RelayPortPins[u])
+			if err != nil {
+				return err
+			}
+			if other, ok := users[addr.Port]; ok {
+				return fmt.Errorf("relay port %d pinned to both users %q and %q", addr.Port,
+					other, u)
+			}
+			users[addr.Port] = u
+			if addr.IP == nil {
+				pins[u] = strconv.Itoa(addr.Port)
+			} else {
+				pins[u] = net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port))
+			}
+		}
+		req.RelayPortPins = pins
+	}
+
+	if req.EgressQueueLength < 0 {
+		req.EgressQueueLength = 0
+	}
+	req.EgressDropPolicy = strings.ToLower(req.EgressDropPolicy)
+	switch req.EgressDropPolicy {
+	case "":
+		if req.EgressQueueLength > 0 {
+			req.EgressDropPolicy = EgressDropPolicyTail
+		}
+	case EgressDropPolicyTail, EgressDropPolicyHead:
+	default:
+		return fmt.Errorf("invalid egress drop policy %q, must be either %q or %q",
+			req.EgressDropPolicy, EgressDropPolicyTail, EgressDropPolicyHead)
+	}
+
+	if req.PacingRate < 0 {
+		req.PacingRate = 0
+	}
+
+	if req.MaxDatagramSize < MaxDatagramSizeAuto ||
+		(req.MaxDatagramSize > 0 && req.MaxDatagramSize < MinDatagramSize) {
+		return fmt.Errorf("invalid maximum datagram size %d, must be -1 (auto) or at least %d",
+			req.MaxDatagramSize, MinDatagramSize)
+	}
+	if req.PathMTUDiscovery && req.SinglePort {
+		return fmt.Errorf("path MTU discovery is not supported in single-port mode")
+	}
+
+	if req.ChurnThreshold < 0 {
+		req.ChurnThreshold = 0
+	}
+	if req.ChurnRateLimit && req.ChurnThreshold == 0 {
+		return fmt.Errorf("churn rate limiting requires a churn threshold")
+	}
+
+	for _, cpu := range req.CPUAffinity {
+		if cpu < 0 {
+			return fmt.Errorf("invalid CPU %d in CPU affinity", cpu)
+		}
+	}
+	if len(req.CPUAffinity) > 0 && !hasUDP {
+		return fmt.Errorf("CPU affinity is supported only for UDP listeners, got %s",
+			req.Protocol)
+	}
+
+	hasTCP := hasListenerProtocol(protos, ListenerProtocolTURNTCP, ListenerProtocolTURNTLS,
+		ListenerProtocolTCP, ListenerProtocolTLS)
+	if req.TCPKeepalive != 0 && !hasTCP {
+		return fmt.Errorf("TCP keepalive is supported only for TCP and TLS listeners, got %s",
+			req.Protocol)
+	}
+
+	if req.MaxTCPConnections < 0 {
+		req.MaxTCPConnections = 0
+	}
+	if req.AcceptQueueLength < 0 {
+		req.AcceptQueueLength = 0
+	}
+	if (req.MaxTCPConnections > 0 || req.AcceptQueueLength > 0) && !hasTCP {
+		return fmt.Errorf("TCP connection limits are supported only for TCP and TLS listeners, "+
+			"got %s", req.Protocol)
+	}
+
+	if req.SessionTokenTimeout > 0 && (!hasUDP || hasTCP) {
+		return fmt.Errorf("session affinity tokens are supported only for UDP listeners, "+
+			"got %s", req.Protocol)
+	}
+
+	if req.PortReservation && (!hasUDP || hasTCP) {
+		return fmt.Errorf("port reservations are supported only for UDP listeners, got %s",
+			req.Protocol)
+	}
+
+	if len(req.RelayPortPins) > 0 && (!hasUDP || hasTCP) {
+		return fmt.Errorf("relay port pins are supported only for UDP listeners, got %s",
+			req.Protocol)
+	}
+
+	if req.Mobility && (!hasUDP || hasTCP) {
+		return fmt.Errorf("mobility is supported only for UDP listeners, got %s", req.Protocol)
+	}
+
+	if req.ProxyProtocol && !hasTCP {
+		return fmt.Errorf("PROXY protocol is supported only for TCP and TLS listeners, got %s",
+			req.Protocol)
+	}
+	if req.ProxyProtocol && len(req.ProxyProtocolTrustedProxies) == 0 {
+		return fmt.Errorf("PROXY protocol requires a list of trusted proxies")
+	}
+	for _, p := range req.ProxyProtocolTrustedProxies {
+		if _, err := ParseSourceRange(p); err != nil {
+			return fmt.Errorf("invalid PROXY protocol trusted proxy: %w", err)
+		}
+	}
+	if len(req.ProxyProtocolTrustedProxies) == 0 {
+		req.ProxyProtocolTrustedProxies = nil
+	}
+
+	if req.SinglePort && !hasUDP {
+		return fmt.Errorf("single-port mode is supported only for UDP listeners, got %s",
+			req.Protocol)
+	}
+
+	if (req.ICEUfrag == "") != (req.ICEPassword == "") {
+		return fmt.Errorf("both the ICE username fragment and the ICE password must be set " +
+			"for the ICE-lite responder")
+	}
+	if req.ICEUfrag != "" && !hasUDP {
+		return fmt.Errorf("ICE-lite is supported only for UDP listeners, got %s",
+			req.Protocol)
+	}
+
+	if req.NAT64Prefix != "" {
+		ip, n, err := net.ParseCIDR(req.NAT64Prefix)
+		if err != nil {
+			return fmt.Errorf("invalid NAT64 prefix %q: %w", req.NAT64Prefix, err)
+		}
+		if ones, bits := n.Mask.Size(); ip.To4() != nil || bits != 128 || ones != 96 {
+			return fmt.Errorf("invalid NAT64 prefix %q: only IPv6 /96 prefixes are supported",
+				req.NAT64Prefix)
+		}
+		req.NAT64Prefix = n.String()
+	}
+	if (req.DualStackRelay || req.NAT64Prefix != "") && req.SinglePort {
+		return fmt.Errorf("dual-stack relaying and NAT64 are not supported in single-port mode")
+	}
+
+	if req.ForwardAddress != "" {
+		if !hasUDP {
+			return fmt.Errorf("forward address is supported only for UDP listeners, "+
+				"got %s", req.Protocol)
+		}
+		_, port, err := net.SplitHostPort(req.ForwardAddress)
+		if err != nil {
+			return fmt.Errorf("invalid forward address %q: %w", req.ForwardAddress, err)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("invalid port in forward address %q", req.ForwardAddress)
+		}
+	}
+
+	for i, c := range req.AllowedCountries {
+		req.AllowedCountries[i] = strings.ToUpper(c)
+	}
+	sort.Strings(req.AllowedCountries)
+	for i, c := range req.DeniedCountries {
+		req.DeniedCountries[i] = strings.ToUpper(c)
+	}
+	sort.Strings(req.DeniedCountries)
+
 	sort.Strings(req.Routes)
+
+	for i, o := range req.AllowedOrigins {
+		if req.AllowedOrigins[i] = NormalizeOrigin(o); req.AllowedOrigins[i] == "" {
+			return fmt.Errorf("empty origin in allowed origins")
+		}
+	}
+	sort.Strings(req.AllowedOrigins)
+	if len(req.OriginRoutes) > 0 {
+		routes := make(map[string][]string, len(req.OriginRoutes))
+		for o, rs := range req.OriginRoutes {
+			origin := NormalizeOrigin(o)
+			if origin == "" {
+				return fmt.Errorf("empty origin in origin routes")
+			}
+			if _, ok := routes[origin]; ok {
+				return fmt.Errorf("duplicate origin %q in origin routes", origin)
+			}
+			for _, r := range rs {
+				if !slices.Contains(req.Routes, r) {
+					return fmt.Errorf("route %q of origin %q is not a route of the listener",
+						r, origin)
+				}
+			}
+			routes[origin] = slices.Clone(rs)
+			sort.Strings(routes[origin])
+		}
+		req.OriginRoutes = routes
+	}
+
 	return nil
 }
 
+// NormalizeOrigin returns the canonical form of a web origin, as compared to the ORIGIN attribute
+// of the allocations: lowercase and without a trailing slash.
+func NormalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+func hasListenerProtocol(protos []ListenerProtocol, ps ...ListenerProtocol) bool {
+	for _, proto := range protos {
+		for _, p := range ps {
+			if proto == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsEnabled returns false if the listener is configured as a warm standby.
+func (req *ListenerConfig) IsEnabled() bool {
+	return req.Enabled == nil || *req.Enabled
+}
+
 // Name returns the name of the object to be configured.
 func (req *ListenerConfig) ConfigName() string {
 	return req.Name
@@ -95,6 +661,47 @@ func (req *ListenerConfig) DeepCopyInto(dst Config) {
 	*ret = *req
 	ret.Routes = make([]string, len(req.Routes))
 	copy(ret.Routes, req.Routes)
+	if req.AllowedCountries != nil {
+		ret.AllowedCountries = make([]string, len(req.AllowedCountries))
+		copy(ret.AllowedCountries, req.AllowedCountries)
+	}
+	if req.DeniedCountries != nil {
+		ret.DeniedCountries = make([]string, len(req.DeniedCountries))
+		copy(ret.DeniedCountries, req.DeniedCountries)
+	}
+	if req.AllowedOrigins != nil {
+		ret.AllowedOrigins = make([]string, len(req.AllowedOrigins))
+		copy(ret.AllowedOrigins, req.AllowedOrigins)
+	}
+	if req.OriginRoutes != nil {
+		ret.OriginRoutes = make(map[string][]string, len(req.OriginRoutes))
+		for o, rs := range req.OriginRoutes {
+			ret.OriginRoutes[o] = make([]string, len(rs))
+			copy(ret.OriginRoutes[o], rs)
+		}
+	}
+	if req.Labels != nil {
+		ret.Labels = maps.Clone(req.Labels)
+	}
+	if req.RelayPortPins != nil {
+		ret.RelayPortPins = maps.Clone(req.RelayPortPins)
+	}
+	if req.ProxyProtocolTrustedProxies != nil {
+		ret.ProxyProtocolTrustedProxies = make([]string, len(req.ProxyProtocolTrustedProxies))
+		copy(ret.ProxyProtocolTrustedProxies, req.ProxyProtocolTrustedProxies)
+	}
+	if req.RelayPortRanges != nil {
+		ret.RelayPortRanges = make([]string, len(req.RelayPortRanges))
+		copy(ret.RelayPortRanges, req.RelayPortRanges)
+	}
+	if req.CPUAffinity != nil {
+		ret.CPUAffinity = make([]int, len(req.CPUAffinity))
+		copy(ret.CPUAffinity, req.CPUAffinity)
+	}
+	if req.Enabled != nil {
+		enabled := *req.Enabled
+		ret.Enabled = &enabled
+	}
 }
 
 // String stringifies the configuration.
@@ -131,30 +738,255 @@ func (req *ListenerConfig) String() string {
 	}
 	status = append(status, fmt.Sprintf("cert/key=%s/%s", c, k))
 	status = append(status, fmt.Sprintf("routes=[%s]", strings.Join(req.Routes, ",")))
+	if ranges := req.GetRelayPortRanges(); len(ranges) > 0 {
+		rs := make([]string, len(ranges))
+		for i, r := range ranges {
+			rs[i] = r.String()
+		}
+		status = append(status, fmt.Sprintf("relay-ports=[%s]", strings.Join(rs, ",")))
+	}
+	if req.ClientIPQuota > 0 {
+		status = append(status, fmt.Sprintf("client-ip-quota=%d", req.ClientIPQuota))
+	}
+	if len(req.AllowedCountries) > 0 {
+		status = append(status, fmt.Sprintf("allowed-countries=[%s]",
+			strings.Join(req.AllowedCountries, ",")))
+	}
+	if len(req.DeniedCountries) > 0 {
+		status = append(status, fmt.Sprintf("denied-countries=[%s]",
+			strings.Join(req.DeniedCountries, ",")))
+	}
+	if len(req.AllowedOrigins) > 0 {
+		status = append(status, fmt.Sprintf("allowed-origins=[%s]",
+			strings.Join(req.AllowedOrigins, ",")))
+	}
+	if len(req.OriginRoutes) > 0 {
+		origins := slices.Sorted(maps.Keys(req.OriginRoutes))
+		for i, o := range origins {
+			origins[i] = fmt.Sprintf("%s:[%s]", o, strings.Join(req.OriginRoutes[o], ","))
+		}
+		status = append(status, fmt.Sprintf("origin-routes={%s}", strings.Join(origins, ",")))
+	}
+	if req.TarpitDelay > 0 {
+		status = append(status, fmt.Sprintf("tarpit-delay=%ds", req.TarpitDelay))
+	}
+	if req.BindingRateLimit > 0 {
+		mode := "reject"
+		if req.BindingRateLimitSilent {
+			mode = "drop"
+		}
+		status = append(status, fmt.Sprintf("binding-rate-limit=%d/s(%s)",
+			req.BindingRateLimit, mode))
+	}
+	if req.ForwardAddress != "" {
+		status = append(status, fmt.Sprintf("forward=%s", req.ForwardAddress))
+	}
+	if req.SinglePort {
+		status = append(status, "single-port")
+	}
+	if req.ICEUfrag != "" {
+		status = append(status, fmt.Sprintf("ice-lite=%s:<SECRET>", req.ICEUfrag))
+	}
+	if req.RTPInspection {
+		status = append(status, "rtp-inspection")
+	}
+	if req.DualStackRelay {
+		status = append(status, "dual-stack-relay")
+	}
+	if req.NAT64Prefix != "" {
+		status = append(status, fmt.Sprintf("nat64-prefix=%s", req.NAT64Prefix))
+	}
+	if req.MaxSessionDuration > 0 {
+		status = append(status, fmt.Sprintf("max-session-duration=%ds", req.MaxSessionDuration))
+	}
+	if req.ProxyProtocol {
+		status = append(status, fmt.Sprintf("proxy-protocol=<%s>",
+			strings.Join(req.ProxyProtocolTrustedProxies, ",")))
+	}
+	if req.TCPKeepalive != 0 {
+		status = append(status, fmt.Sprintf("tcp-keepalive=%ds", req.TCPKeepalive))
+	}
+	if req.MaxTCPConnections > 0 {
+		status = append(status, fmt.Sprintf("max-tcp-connections=%d", req.MaxTCPConnections))
+	}
+	if req.AcceptQueueLength > 0 {
+		status = append(status, fmt.Sprintf("accept-queue=%d", req.AcceptQueueLength))
+	}
+	if req.IdleTimeout > 0 {
+		status = append(status, fmt.Sprintf("idle-timeout=%ds", req.IdleTimeout))
+	}
+	if req.SessionTokenTimeout > 0 {
+		status = append(status, fmt.Sprintf("session-token=%ds", req.SessionTokenTimeout))
+	}
+	if req.PortReservation {
+		status = append(status, "port-reservation")
+	}
+	if len(req.RelayPortPins) > 0 {
+		users := slices.Sorted(maps.Keys(req.RelayPortPins))
+		for i, u := range users {
+			users[i] = fmt.Sprintf("%s:%s", u, req.RelayPortPins[u])
+		}
+		status = append(status, fmt.Sprintf("relay-port-pins=[%s]", strings.Join(users, ",")))
+	}
+	if req.Mobility {
+		status = append(status, "mobility")
+	}
+	if req.EgressQueueLength > 0 {
+		status = append(status, fmt.Sprintf("egress-queue=%d(%s-drop)", req.EgressQueueLength,
+			req.EgressDropPolicy))
+	}
+	if req.PacingRate > 0 {
+		status = append(status, fmt.Sprintf("pacing-rate=%dkbps", req.PacingRate))
+	}
+	if req.MaxDatagramSize == MaxDatagramSizeAuto {
+		status = append(status, "max-datagram-size=auto")
+	} else if req.MaxDatagramSize > 0 {
+		status = append(status, fmt.Sprintf("max-datagram-size=%d", req.MaxDatagramSize))
+	}
+	if req.PathMTUDiscovery {
+		status = append(status, "pmtud")
+	}
+	if req.ChurnThreshold > 0 {
+		mode := "alarm"
+		if req.ChurnRateLimit {
+			mode = "limit"
+		}
+		status = append(status, fmt.Sprintf("churn-threshold=%d/min(%s)", req.ChurnThreshold,
+			mode))
+	}
+	if len(req.CPUAffinity) > 0 {
+		cpus := make([]string, len(req.CPUAffinity))
+		for i, cpu := range req.CPUAffinity {
+			cpus[i] = strconv.Itoa(cpu)
+		}
+		status = append(status, fmt.Sprintf("cpu-affinity=<%s>", strings.Join(cpus, ",")))
+	}
+	if !req.IsEnabled() {
+		status = append(status, "standby")
+	}
+
+	if len(req.Labels) > 0 {
+		status = append(status, fmt.Sprintf("labels=[%s]", LabelsString(req.Labels)))
+	}
+	if req.ManagedBy != "" {
+		status = append(status, fmt.Sprintf("managed-by=%q", req.ManagedBy))
+	}
 
 	return fmt.Sprintf("%q:{%s}", n, strings.Join(status, ","))
 }
 
+// GetRelayPortRanges returns the relay port ranges of the listener in the order of use: the range
+// set with MinRelayPort and MaxRelayPort, if any, followed by RelayPortRanges. Invalid ranges are
+// skipped, call Validate first.
+func (req *ListenerConfig) GetRelayPortRanges() []PortRange {
+	ranges := []PortRange{}
+	if req.MinRelayPort > 0 && req.MaxRelayPort >= req.MinRelayPort {
+		ranges = append(ranges, PortRange{Min: req.MinRelayPort, Max: req.MaxRelayPort})
+	}
+	for _, r := range req.RelayPortRanges {
+		if pr, err := ParsePortRange(r); err == nil {
+			ranges = append(ranges, pr)
+		}
+	}
+	return ranges
+}
+
+// ParseRelayPortPin parses a relay port pin in the format "port" or "addr:port". The IP of the
+// returned address is nil if no address is given.
+func ParseRelayPortPin(pin string) (*net.UDPAddr, error) {
+	pin = strings.TrimSpace(pin)
+	host, port := "", pin
+	if strings.Contains(pin, ":") {
+		var err error
+		if host, port, err = net.SplitHostPort(pin); err != nil {
+			return nil, fmt.Errorf("invalid relay port pin %q: %w", pin, err)
+		}
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < DefaultMinRelayPort || p > DefaultMaxRelayPort {
+		return nil, fmt.Errorf("invalid port in relay port pin %q", pin)
+	}
+	ret := &net.UDPAddr{Port: p}
+	if host != "" {
+		if ret.IP = net.ParseIP(host); ret.IP == nil {
+			return nil, fmt.Errorf("invalid address in relay port pin %q", pin)
+		}
+	}
+	return ret, nil
+}
+
+// PortRange is a range of ports, including the bounds.
+type PortRange struct {
+	Min, Max int
+}
+
+// ParsePortRange parses a port range in the format "min-max", or a single port.
+func ParsePortRange(r string) (PortRange, error) {
+	lo, hi, found := strings.Cut(strings.TrimSpace(r), "-")
+	if !found {
+		hi = lo
+	}
+	minPort, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	maxPort, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || minPort < DefaultMinRelayPort ||
+		maxPort > DefaultMaxRelayPort || minPort > maxPort {
+		return PortRange{}, fmt.Errorf("invalid relay port range %q", r)
+	}
+	return PortRange{Min: minPort, Max: maxPort}, nil
+}
+
+// Size returns the number of ports in the range.
+func (r PortRange) Size() int {
+	return r.Max - r.Min + 1
+}
+
+// Contains returns true if the port falls into the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Min && port <= r.Max
+}
+
+// String stringifies the port range.
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
 // GetListenerURI is a helper that can output two types of Listener URIs: one with "://" after the
-// scheme or one with only ":" (as per RFC7065).
+// scheme or one with only ":" (as per RFC7065). For multi-protocol listeners the URI of the first
+// protocol is returned, use GetListenerURIs to obtain all URIs.
 func (req *ListenerConfig) GetListenerURI(rfc7065 bool) (string, error) {
-	proto, err := NewListenerProtocol(req.Protocol)
+	protos, err := NewListenerProtocols(req.Protocol)
 	if err != nil {
 		return "", err
 	}
+	return req.getListenerURI(protos[0], rfc7065), nil
+}
+
+// GetListenerURIs returns the URIs for each protocol of a listener.
+func (req *ListenerConfig) GetListenerURIs(rfc7065 bool) ([]string, error) {
+	protos, err := NewListenerProtocols(req.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	uris := make([]string, len(protos))
+	for i, proto := range protos {
+		uris[i] = req.getListenerURI(proto, rfc7065)
+	}
+	return uris, nil
+}
 
+func (req *ListenerConfig) getListenerURI(proto ListenerProtocol, rfc7065 bool) string {
 	service, protocol := "", ""
 	switch proto {
-	case ListenerProtocolTURNUDP:
+	case ListenerProtocolTURNUDP, ListenerProtocolUDP:
 		service = "turn"
 		protocol = "udp"
-	case ListenerProtocolTURNTCP:
+	case ListenerProtocolTURNTCP, ListenerProtocolTCP:
 		service = "turn"
 		protocol = "tcp"
-	case ListenerProtocolTURNDTLS:
+	case ListenerProtocolTURNDTLS, ListenerProtocolDTLS:
 		service = "turns"
 		protocol = "udp"
-	case ListenerProtocolTURNTLS:
+	case ListenerProtocolTURNTLS, ListenerProtocolTLS:
 		service = "turns"
 		protocol = "tcp"
 	}
@@ -175,18 +1007,18 @@ func (req *ListenerConfig) GetListenerURI(rfc7065 bool) (string, error) {
 		port = req.Port
 	}
 
-	var uri string
 	if rfc7065 {
-		uri = fmt.Sprintf("%s:%s:%d?transport=%s", service, addr, port, protocol)
-	} else {
-		uri = fmt.Sprintf("%s://%s:%d?transport=%s", service, addr, port, protocol)
+		return fmt.Sprintf("%s:%s:%d?transport=%s", service, addr, port, protocol)
 	}
-	return uri, nil
+	return fmt.Sprintf("%s://%s:%d?transport=%s", service, addr, port, protocol)
 }
 
 type ListenerStatus struct {
 	*ListenerConfig
 	Stats OffloadDirStat `json:"stats"`
+	Meta  *ObjectMeta    `json:"meta,omitempty"`
+	// Disabled is true if the listener has been administratively disabled at runtime.
+	Disabled bool `json:"disabled,omitempty"`
 }
 
 // String stringifies the configuration.
@@ -194,5 +1026,155 @@ func (req *ListenerStatus) String() string {
 	status := req.ListenerConfig.String()
 	status += fmt.Sprintf(",offload(rx/tx): %d/%d pkts %d/%d bytes",
 		req.Stats.Rx.Pkts, req.Stats.Tx.Pkts, req.Stats.Rx.Bytes, req.Stats.Tx.Bytes)
+	if req.Meta != nil {
+		status += "," + req.Meta.String()
+	}
 	return status
 }
+
+// ListenerStats is a snapshot of the traffic statistics of a listener, with the rates computed
+// in-process.
+type ListenerStats struct {
+	// Name of the listener.
+	Name string `json:"name"`
+	// Labels are the labels of the listener.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Allocations is the number of active allocations at the listener.
+	Allocations int `json:"allocations"`
+	// RxPackets and RxBytes count the packets and bytes received from the clients.
+	RxPackets uint64 `json:"rxPackets"`
+	RxBytes   uint64 `json:"rxBytes"`
+	// TxPackets and TxBytes count the packets and bytes sent to the clients.
+	TxPackets uint64 `json:"txPackets"`
+	TxBytes   uint64 `json:"txBytes"`
+	// Errors counts the packets dropped or rejected and the panics recovered at the listener.
+	Errors uint64 `json:"errors"`
+	// Current holds the instantaneous rates, computed over the last sampling interval.
+	Current ListenerRates `json:"current"`
+	// Window holds the rates averaged over the rolling window.
+	Window ListenerRates `json:"window"`
+}
+
+// String stringifies the listener statistics.
+func (s *ListenerStats) String() string {
+	return fmt.Sprintf("%s: allocations=%d,rx=%d pkts/%d bytes,tx=%d pkts/%d bytes,errors=%d,"+
+		"current=<%s>,window=<%s>", s.Name, s.Allocations, s.RxPackets, s.RxBytes, s.TxPackets,
+		s.TxBytes, s.Errors, s.Current.String(), s.Window.String())
+}
+
+// ListenerRates holds the traffic rates of a listener over a time interval.
+type ListenerRates struct {
+	// Interval is the length of the time interval in seconds, zero if no rates are available
+	// yet.
+	Interval float64 `json:"interval"`
+	// RxPps and TxPps are the packet rates in packets per second.
+	RxPps float64 `json:"rxPps"`
+	TxPps float64 `json:"txPps"`
+	// RxBps and TxBps are the bit rates in bits per second.
+	RxBps float64 `json:"rxBps"`
+	TxBps float64 `json:"txBps"`
+	// Errors is the error rate in errors per second.
+	Errors float64 `json:"errors"`
+}
+
+// String stringifies the listener rates.
+func (r *ListenerRates) String() string {
+	return fmt.Sprintf("interval=%.1fs,rx=%.1f pps/%.0f bps,tx=%.1f pps/%.0f bps,errors=%.1f/s",
+		r.Interval, r.RxPps, r.RxBps, r.TxPps, r.TxBps, r.Errors)
+}
+
+// SessionStats is a snapshot of the traffic statistics of a session (allocation), with the bit
+// rates computed in-process.
+type SessionStats struct {
+	// Listener is the name of the listener the session belongs to.
+	Listener string `json:"listener"`
+	// Username is the username the session was authenticated with.
+	Username string `json:"username"`
+	// Client is the transport address of the client.
+	Client string `json:"client"`
+	// RelayAddress is the relay transport address of the allocation.
+	RelayAddress string `json:"relayAddress"`
+	// ToPeerBytes and FromPeerBytes count the bytes relayed to and from the peers.
+	ToPeerBytes   uint64 `json:"toPeerBytes"`
+	FromPeerBytes uint64 `json:"fromPeerBytes"`
+	// Interval is the length of the time interval over which the rates were computed in
+	// seconds, at most the length of the rolling window.
+	Interval float64 `json:"interval"`
+	// ToPeerBps and FromPeerBps are the bit rates to and from the peers in bits per second.
+	ToPeerBps   float64 `json:"toPeerBps"`
+	FromPeerBps float64 `json:"fromPeerBps"`
+}
+
+// String stringifies the session statistics.
+func (s *SessionStats) String() string {
+	return fmt.Sprintf("%s/%s@%s: relay=%s,to-peer=%d bytes/%.0f bps,from-peer=%d bytes/%.0f bps,"+
+		"interval=%.1fs", s.Listener, s.Username, s.Client, s.RelayAddress, s.ToPeerBytes,
+		s.ToPeerBps, s.FromPeerBytes, s.FromPeerBps, s.Interval)
+}
+
+// ClientRTT holds the round-trip time statistics of a client network.
+type ClientRTT struct {
+	// Network is the client network: the /24 prefix of IPv4 clients and the /48 prefix of
+	// IPv6 clients.
+	Network string `json:"network"`
+	// Method is the way the round-trip times were measured: "stun" for the time between a
+	// challenge and the retry of the client at UDP listeners, and "tcp" for the smoothed RTT of
+	// the TCP connections at TCP and TLS listeners.
+	Method string `json:"method"`
+	// Samples is the number of round-trip times measured.
+	Samples uint64 `json:"samples"`
+	// SmoothedRTT is the exponentially weighted moving average of the round-trip times in
+	// seconds.
+	SmoothedRTT float64 `json:"srtt"`
+	// MinRTT is the smallest round-trip time measured in seconds.
+	MinRTT float64 `json:"minRtt"`
+	// LastRTT is the last round-trip time measured in seconds.
+	LastRTT float64 `json:"lastRtt"`
+}
+
+// String stringifies the round-trip time statistics.
+func (r *ClientRTT) String() string {
+	return fmt.Sprintf("%s/%s: samples=%d,srtt=%.1fms,min=%.1fms,last=%.1fms", r.Network,
+		r.Method, r.Samples, 1000*r.SmoothedRTT, 1000*r.MinRTT, 1000*r.LastRTT)
+}
+
+// ScalingMetrics holds the load signals of a STUNner instance for horizontal autoscaling, e.g.,
+// with the Kubernetes HorizontalPodAutoscaler via KEDA, so that the number of replicas tracks the
+// call volume.
+type ScalingMetrics struct {
+	// Allocations is the number of active allocations.
+	Allocations int `json:"allocations"`
+	// Bandwidth is the relayed bandwidth in both directions in bits per second, averaged over
+	// the rolling window of the listener statistics.
+	Bandwidth float64 `json:"bandwidth"`
+}
+
+// String stringifies the scaling metrics.
+func (m *ScalingMetrics) String() string {
+	return fmt.Sprintf("allocations=%d,bandwidth=%.0f bps", m.Allocations, m.Bandwidth)
+}
+
+// DrainEstimate holds the number of the active allocations of a STUNner instance and the
+// projected time it takes to drain them, e.g., for choosing the termination grace period.
+type DrainEstimate struct {
+	// Allocations is the number of active allocations.
+	Allocations int `json:"allocations"`
+	// OldestSession is the age of the oldest active allocation in seconds.
+	OldestSession float64 `json:"oldestSession"`
+	// SessionDuration is the 95th percentile of the duration of the recently completed
+	// sessions in seconds, zero if no session has completed yet.
+	SessionDuration float64 `json:"sessionDuration"`
+	// Samples is the number of the completed sessions the projection is based on.
+	Samples int `json:"samples"`
+	// DrainTime is the projected time until all active allocations are closed in seconds.
+	DrainTime float64 `json:"drainTime"`
+	// DrainCompletion is the projected time of drain completion in RFC 3339 format.
+	DrainCompletion string `json:"drainCompletion"`
+}
+
+// String stringifies the drain estimate.
+func (e *DrainEstimate) String() string {
+	return fmt.Sprintf("allocations=%d,oldest-session=%.0fs,session-duration=%.0fs,samples=%d,"+
+		"drain-time=%.0fs,drain-completion=%s", e.Allocations, e.OldestSession,
+		e.SessionDuration, e.Samples, e.DrainTime, e.DrainCompletion)
+}
@@ -2,7 +2,7 @@ package v1
 
 import (
 	"fmt"
-	// "sort"
+	"sort"
 	"strings"
 )
 
@@ -25,7 +25,7 @@ type StunnerConfig struct {
 func (req *StunnerConfig) Validate() error {
 	// ApiVersion
 	if req.ApiVersion != ApiVersion {
-		return fmt.Errorf("unsupported API version: %q", req.ApiVersion)
+		return fmt.Errorf("%w: unsupported API version: %q", ErrInvalidConf, req.ApiVersion)
 	}
 
 	if err := req.Admin.Validate(); err != nil {
@@ -40,6 +40,9 @@ func (req *StunnerConfig) Validate() error {
 		req.Listeners = []ListenerConfig{}
 	} else {
 		for i, l := range req.Listeners {
+			if l.ManagedBy == "" {
+				l.ManagedBy = req.Admin.ManagedBy
+			}
 			if err := l.Validate(); err != nil {
 				return err
 			}
@@ -51,6 +54,9 @@ func (req *StunnerConfig) Validate() error {
 		req.Clusters = []ClusterConfig{}
 	} else {
 		for i, c := range req.Clusters {
+			if c.ManagedBy == "" {
+				c.ManagedBy = req.Admin.ManagedBy
+			}
 			if err := c.Validate(); err != nil {
 				return err
 			}
@@ -197,6 +203,21 @@ func (req *StunnerConfig) Summary() string {
 		if t == AuthTypeStatic {
 			status += fmt.Sprintf("Authentication type: static, username/password: %s/%s\n",
 				req.Auth.Credentials["username"], req.Auth.Credentials["password"])
+		} else if t == AuthTypeOAuth {
+			serverName := ""
+			if req.Auth.OAuth != nil {
+				serverName = req.Auth.OAuth.ServerName
+			}
+			status += fmt.Sprintf("Authentication type: oauth, server-name: %s\n", serverName)
+		} else if t == AuthTypeNone {
+			status += fmt.Sprintf("Authentication type: none, allowed sources: %s\n",
+				strings.Join(req.Auth.AllowedSources, ", "))
+		} else if t == AuthTypeLDAP {
+			url := ""
+			if req.Auth.LDAP != nil {
+				url = req.Auth.LDAP.URL
+			}
+			status += fmt.Sprintf("Authentication type: ldap, url: %s\n", url)
 		} else {
 			status += fmt.Sprintf("Authentication type: ephemeral, shared-secret: %s\n",
 				req.Auth.Credentials["secret"])
@@ -226,6 +247,11 @@ func (req *StunnerConfig) Summary() string {
 		for _, r := range l.Routes {
 			if c, err := req.GetClusterConfig(r); err == nil {
 				ep = append(ep, c.Endpoints...)
+				for _, t := range c.Targets {
+					for _, e := range t.Endpoints {
+						ep = append(ep, e+"@"+t.Name)
+					}
+				}
 			}
 		}
 		status += fmt.Sprintf("    Endpoints: [%s]\n", strings.Join(ep, ", "))
@@ -242,7 +268,12 @@ type StunnerStatus struct {
 	Listeners       []*ListenerStatus `json:"listeners"`
 	Clusters        []*ClusterStatus  `json:"clusters"`
 	AllocationCount int               `json:"allocationCount"`
+	Generation      int64             `json:"generation"`
 	Status          string            `json:"status"`
+	Conditions      []Condition       `json:"conditions,omitempty"`
+	SystemChecks    []SystemCheck     `json:"systemChecks,omitempty"`
+	Capabilities    *Capabilities     `json:"capabilities,omitempty"`
+	Warnings        []ConfigWarning   `json:"warnings,omitempty"`
 }
 
 // String stringifies the status.
@@ -256,8 +287,8 @@ func (s *StunnerStatus) String() string {
 		cs = append(cs, c.String())
 	}
 
-	return fmt.Sprintf("%s/%s/%s/%s/allocs:%d/status=%s", s.Admin.String(), s.Auth.String(),
-		ls, cs, s.AllocationCount, s.Status)
+	return fmt.Sprintf("%s/%s/%s/%s/allocs:%d/gen=%d/status=%s", s.Admin.String(),
+		s.Auth.String(), ls, cs, s.AllocationCount, s.Generation, s.Status)
 }
 
 // String summarizes the status.
@@ -270,7 +301,93 @@ func (s *StunnerStatus) Summary() string {
 	for _, c := range s.Clusters {
 		cs = append(cs, c.String())
 	}
-	return fmt.Sprintf("%s\n\t%s\n\tlisteners:%s\n\tclusters:%s\n\tallocs:%d/status=%s",
+	conds := []string{}
+	for _, c := range s.Conditions {
+		conds = append(conds, c.String())
+	}
+	summary := fmt.Sprintf("%s\n\t%s\n\tlisteners:%s\n\tclusters:%s\n\tallocs:%d/gen=%d/status=%s\n\tconditions:%s",
 		s.Admin.String(), s.Auth.String(), strings.Join(ls, ","), strings.Join(cs, ","),
-		s.AllocationCount, s.Status)
+		s.AllocationCount, s.Generation, s.Status, strings.Join(conds, ","))
+	if len(s.SystemChecks) > 0 {
+		checks := []string{}
+		for _, c := range s.SystemChecks {
+			checks = append(checks, c.String())
+		}
+		summary += fmt.Sprintf("\n\tsystem-checks:%s", strings.Join(checks, ","))
+	}
+	if s.Capabilities != nil {
+		summary += fmt.Sprintf("\n\tcapabilities:%s", s.Capabilities.String())
+	}
+	if len(s.Warnings) > 0 {
+		ws := []string{}
+		for _, w := range s.Warnings {
+			ws = append(ws, w.String())
+		}
+		summary += fmt.Sprintf("\n\twarnings:%s", strings.Join(ws, ","))
+	}
+	return summary
+}
+
+// Capabilities is a machine-readable report of the features available in a STUNner build and the
+// limits detected on the host at startup, intended to help triaging version and feature
+// mismatches.
+type Capabilities struct {
+	// Platform is the operating system and the architecture, e.g., "linux/amd64".
+	Platform string `json:"platform"`
+	// GoVersion is the version of the Go toolchain used for the build.
+	GoVersion string `json:"goVersion"`
+	// Features lists the optional features compiled in, e.g., "hitless-upgrade",
+	// "faultinject" or "offload".
+	Features []string `json:"features"`
+	// ListenerProtocols lists the supported listener protocols.
+	ListenerProtocols []string `json:"listenerProtocols"`
+	// AuthTypes lists the supported authentication types.
+	AuthTypes []string `json:"authTypes"`
+	// ClusterTypes lists the supported cluster types.
+	ClusterTypes []string `json:"clusterTypes"`
+	// OffloadEngines lists the available dataplane offload engines.
+	OffloadEngines []string `json:"offloadEngines"`
+	// Limits lists the host and process limits detected at startup, e.g., the number of CPUs
+	// ("cpus"), the open file limit ("RLIMIT_NOFILE") and the kernel parameters limiting the
+	// socket buffers and the accept queues. Limits that cannot be detected on the platform
+	// are omitted.
+	Limits map[string]int64 `json:"limits,omitempty"`
+}
+
+// String stringifies the capability report.
+func (c *Capabilities) String() string {
+	limits := []string{}
+	for k, v := range c.Limits {
+		limits = append(limits, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(limits)
+	return fmt.Sprintf("platform=%s,go=%s,features=[%s],listener-protocols=[%s],auth-types=[%s],"+
+		"cluster-types=[%s],offload=[%s],limits=[%s]", c.Platform, c.GoVersion,
+		strings.Join(c.Features, ","), strings.Join(c.ListenerProtocols, ","),
+		strings.Join(c.AuthTypes, ","), strings.Join(c.ClusterTypes, ","),
+		strings.Join(c.OffloadEngines, ","), strings.Join(limits, ","))
+}
+
+// SystemCheck is the result of a sanity check of a kernel parameter or a process resource limit
+// against the running configuration.
+type SystemCheck struct {
+	// Name is the name of the kernel parameter or the resource limit, e.g.,
+	// "net.core.somaxconn".
+	Name string `json:"name"`
+	// Value is the current value.
+	Value int64 `json:"value"`
+	// Recommended is the minimum value recommended for the running configuration.
+	Recommended int64 `json:"recommended"`
+	// Passed is true if the current value is at least the recommended value.
+	Passed bool `json:"passed"`
+	// Message is an actionable hint on how to fix a failed check.
+	Message string `json:"message,omitempty"`
+}
+
+// String stringifies a system check.
+func (c *SystemCheck) String() string {
+	if c.Passed {
+		return fmt.Sprintf("%s=%d(ok)", c.Name, c.Value)
+	}
+	return fmt.Sprintf("%s=%d(want>=%d)", c.Name, c.Value, c.Recommended)
 }
@@ -12,12 +12,16 @@ const (
 	AuthTypeNone AuthType = iota
 	AuthTypeStatic
 	AuthTypeEphemeral
+	AuthTypeOAuth
+	AuthTypeLDAP
 )
 
 const (
 	authTypeNoneStr      = "none"
 	authTypeStaticStr    = "static"
 	authTypeEphemeralStr = "ephemeral"
+	authTypeOAuthStr     = "oauth"
+	authTypeLDAPStr      = "ldap"
 	AuthTypePlainText    = AuthTypeStatic
 	AuthTypeLongTerm     = AuthTypeEphemeral
 	authTypePlainTextStr = "plaintext"
@@ -31,6 +35,10 @@ func NewAuthType(raw string) (AuthType, error) {
 		return AuthTypeStatic, nil
 	case authTypeEphemeralStr, authTypeLongTermStr:
 		return AuthTypeEphemeral, nil
+	case authTypeOAuthStr:
+		return AuthTypeOAuth, nil
+	case authTypeLDAPStr:
+		return AuthTypeLDAP, nil
 	case authTypeNoneStr:
 		return AuthTypeNone, nil
 	default:
@@ -47,6 +55,10 @@ func (a AuthType) String() string {
 		return authTypeStaticStr
 	case AuthTypeEphemeral:
 		return authTypeEphemeralStr
+	case AuthTypeOAuth:
+		return authTypeOAuthStr
+	case AuthTypeLDAP:
+		return authTypeLDAPStr
 	default:
 		return "<unknown>"
 	}
@@ -103,6 +115,45 @@ func NewListenerProtocol(raw string) (ListenerProtocol, error) {
 	}
 }
 
+// NewListenerProtocols parses a protocol specification that may list multiple protocols separated
+// by commas, e.g., "TURN-UDP,TURN-TCP". Since all protocols share the same listener port, at most
+// one datagram-based protocol (UDP or DTLS) and one stream-based protocol (TCP or TLS) can be
+// listed.
+func NewListenerProtocols(raw string) ([]ListenerProtocol, error) {
+	protos := []ListenerProtocol{}
+	dgram, stream := "", ""
+	for _, p := range strings.Split(raw, ",") {
+		proto, err := NewListenerProtocol(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+
+		taken := &stream
+		if proto.IsDatagram() {
+			taken = &dgram
+		}
+		if *taken != "" {
+			return nil, fmt.Errorf("conflicting listener protocols %s and %s: "+
+				"both would bind the same port", *taken, proto.String())
+		}
+		*taken = proto.String()
+
+		protos = append(protos, proto)
+	}
+	return protos, nil
+}
+
+// IsDatagram returns true for the protocols running on top of UDP.
+func (l ListenerProtocol) IsDatagram() bool {
+	switch l {
+	case ListenerProtocolUDP, ListenerProtocolDTLS, ListenerProtocolTURNUDP,
+		ListenerProtocolTURNDTLS:
+		return true
+	default:
+		return false
+	}
+}
+
 // String returns a string representation of a listener protocol.
 func (l ListenerProtocol) String() string {
 	switch l {
@@ -133,12 +184,20 @@ type ClusterType int
 const (
 	ClusterTypeStatic ClusterType = iota + 1
 	ClusterTypeStrictDNS
+	ClusterTypeConsul
+	ClusterTypeEDS
+	ClusterTypeBlock
+	ClusterTypeTURN
 	ClusterTypeUnknown
 )
 
 const (
 	clusterTypeStaticStr    = "STATIC"
 	clusterTypeStrictDNSStr = "STRICT_DNS"
+	clusterTypeConsulStr    = "CONSUL"
+	clusterTypeEDSStr       = "EDS"
+	clusterTypeBlockStr     = "BLOCK"
+	clusterTypeTURNStr      = "TURN"
 )
 
 func NewClusterType(raw string) (ClusterType, error) {
@@ -147,6 +206,14 @@ func NewClusterType(raw string) (ClusterType, error) {
 		return ClusterTypeStatic, nil
 	case clusterTypeStrictDNSStr:
 		return ClusterTypeStrictDNS, nil
+	case clusterTypeConsulStr:
+		return ClusterTypeConsul, nil
+	case clusterTypeEDSStr:
+		return ClusterTypeEDS, nil
+	case clusterTypeBlockStr:
+		return ClusterTypeBlock, nil
+	case clusterTypeTURNStr:
+		return ClusterTypeTURN, nil
 	default:
 		return ClusterType(ClusterTypeUnknown),
 			fmt.Errorf("unknown cluster type: \"%s\"", raw)
@@ -159,6 +226,14 @@ func (l ClusterType) String() string {
 		return clusterTypeStaticStr
 	case ClusterTypeStrictDNS:
 		return clusterTypeStrictDNSStr
+	case ClusterTypeConsul:
+		return clusterTypeConsulStr
+	case ClusterTypeEDS:
+		return clusterTypeEDSStr
+	case ClusterTypeBlock:
+		return clusterTypeBlockStr
+	case ClusterTypeTURN:
+		return clusterTypeTURNStr
 	default:
 		return "<unknown>"
 	}
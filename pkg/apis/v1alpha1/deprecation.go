@@ -0,0 +1,32 @@
+package v1alpha1
+
+import (
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// Deprecations lists the deprecated fields and field values of the v1alpha1 API. The whole API
+// version is deprecated in favor of v1, into which v1alpha1 configs are converted on load.
+var Deprecations = []stnrv1.Deprecation{{
+	ApiVersion:  ApiVersion,
+	Field:       "version",
+	Value:       ApiVersion,
+	Replacement: stnrv1.ApiVersion,
+	RemovedIn:   "v1beta1",
+}, {
+	ApiVersion:  ApiVersion,
+	Field:       "auth.type",
+	Value:       authTypePlainTextStr,
+	Replacement: stnrv1.AuthTypeStatic.String(),
+	RemovedIn:   "v1beta1",
+}, {
+	ApiVersion:  ApiVersion,
+	Field:       "auth.type",
+	Value:       authTypeLongTermStr,
+	Replacement: stnrv1.AuthTypeEphemeral.String(),
+	RemovedIn:   "v1beta1",
+}}
+
+// Deprecated returns the deprecated fields and field values set in the configuration.
+func (req *StunnerConfig) Deprecated() []stnrv1.Deprecation {
+	return stnrv1.FindDeprecated(req, Deprecations)
+}
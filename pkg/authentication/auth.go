@@ -5,6 +5,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha1" //nolint:gosec,gci
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -18,6 +19,33 @@ import (
 // (https://datatracker.ietf.org/doc/html/draft-uberti-behave-turn-rest-00).
 const UsernameSeparator = ":"
 
+// Authentication failure reasons, reported in the metrics and the access logs.
+const (
+	// ReasonUnknownUser means that no credentials exist for the username.
+	ReasonUnknownUser = "unknown_user"
+	// ReasonBadIntegrity means that the MESSAGE-INTEGRITY of the request did not match the
+	// credentials of the user, e.g., because of a wrong password.
+	ReasonBadIntegrity = "bad_integrity"
+	// ReasonExpiredTimestamp means that the time-windowed username has expired.
+	ReasonExpiredTimestamp = "expired_timestamp"
+	// ReasonInvalidUsername means that the username is not a valid time-windowed username.
+	ReasonInvalidUsername = "invalid_username"
+	// ReasonRealmMismatch means that the client used a realm different from the realm of
+	// the server.
+	ReasonRealmMismatch = "realm_mismatch"
+	// ReasonBackendError means that the credentials could not be obtained from the
+	// credential backend, e.g., because the LDAP server is not available.
+	ReasonBackendError = "backend_error"
+	// ReasonSourceNotAllowed means that an anonymous client connected from a source address
+	// outside the allowed source ranges.
+	ReasonSourceNotAllowed = "source_not_allowed"
+)
+
+var (
+	ErrInvalidTimeWindowedUsername = errors.New("invalid time-windowed username")
+	ErrExpiredTimeWindowedUsername = errors.New("expired time-windowed username")
+)
+
 // AuthHandler specifies type of the TURN authentication handler used in Stunner. Re-exported from pion/turn for completeness.
 type AuthHandler = turn.AuthHandler
 
@@ -50,11 +78,11 @@ func CheckTimeWindowedUsername(username string) error {
 	}
 
 	if timestamp == 0 {
-		return fmt.Errorf("invalid time-windowed username %q", username)
+		return fmt.Errorf("%w %q", ErrInvalidTimeWindowedUsername, username)
 	}
 
 	if int64(timestamp) < time.Now().Unix() {
-		return fmt.Errorf("expired time-windowed username %q", username)
+		return fmt.Errorf("%w %q", ErrExpiredTimeWindowedUsername, username)
 	}
 
 	return nil
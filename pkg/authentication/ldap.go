@@ -0,0 +1,260 @@
+package authentication
+
+import (
+	"container/list"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pion/logging"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+var ErrLDAPUserNotFound = errors.New("user not found in LDAP directory")
+
+const (
+	// ldapCacheSize is the maximum number of users cached by an LDAP client. The least recently
+	// used entries are evicted above the limit.
+	ldapCacheSize = 10000
+	// ldapNegativeCacheTTL is the maximum time an unknown user is cached for.
+	ldapNegativeCacheTTL = 10 * time.Second
+	// ldapBindTimeout is the maximum time for binding to the LDAP server. Lookups run on the
+	// readloops of the listeners, so a slow server must not block them for long.
+	ldapBindTimeout = time.Second
+)
+
+type ldapCacheEntry struct {
+	username string
+	value    string // password or HA1 hash, empty if the user was not found
+	expiry   time.Time
+}
+
+// ldapCache is an LRU cache of lookup results with a TTL. Expired entries are swept at most once
+// per TTL.
+type ldapCache struct {
+	size      int
+	ttl       time.Duration
+	entries   map[string]*list.Element
+	lru       *list.List // most recently used first
+	lastSweep time.Time
+}
+
+func newLDAPCache(size int, ttl time.Duration, now time.Time) *ldapCache {
+	return &ldapCache{
+		size:      size,
+		ttl:       ttl,
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		lastSweep: now,
+	}
+}
+
+func (c *ldapCache) get(username string, now time.Time) (string, bool) {
+	elem, ok := c.entries[username]
+	if !ok {
+		return "", false
+	}
+	e := elem.Value.(*ldapCacheEntry)
+	if !now.Before(e.expiry) {
+		c.remove(elem)
+		return "", false
+	}
+	c.lru.MoveToFront(elem)
+	return e.value, true
+}
+
+func (c *ldapCache) add(username, value string, now time.Time) {
+	if now.Sub(c.lastSweep) > c.ttl {
+		for elem := c.lru.Front(); elem != nil; {
+			next := elem.Next()
+			if !now.Before(elem.Value.(*ldapCacheEntry).expiry) {
+				c.remove(elem)
+			}
+			elem = next
+		}
+		c.lastSweep = now
+	}
+
+	ttl := c.ttl
+	if value == "" {
+		ttl = min(ttl, ldapNegativeCacheTTL)
+	}
+	if elem, ok := c.entries[username]; ok {
+		c.remove(elem)
+	}
+	c.entries[username] = c.lru.PushFront(&ldapCacheEntry{username: username, value: value,
+		expiry: now.Add(ttl)})
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *ldapCache) remove(elem *list.Element) {
+	delete(c.entries, elem.Value.(*ldapCacheEntry).username)
+	c.lru.Remove(elem)
+}
+
+// LDAPClient looks up TURN credentials in an LDAP/Active Directory server. Connections to the
+// server are pooled and the results of the lookups, including failed lookups, are cached.
+type LDAPClient struct {
+	config  stnrv1.LDAPConfig
+	timeout time.Duration
+	pool    chan *ldap.Conn
+	cache   *ldapCache
+	lock    sync.Mutex
+	log     logging.LeveledLogger
+}
+
+// NewLDAPClient creates a new LDAP client from a validated LDAP configuration. Connections are
+// opened lazily.
+func NewLDAPClient(config stnrv1.LDAPConfig, log logging.LeveledLogger) *LDAPClient {
+	return &LDAPClient{
+		config:  config,
+		timeout: time.Duration(config.Timeout) * time.Second,
+		pool:    make(chan *ldap.Conn, config.PoolSize),
+		cache: newLDAPCache(ldapCacheSize, time.Duration(config.CacheTTL)*time.Second,
+			time.Now()),
+		log: log,
+	}
+}
+
+func (c *LDAPClient) dial() (*ldap.Conn, error) {
+	bindTimeout := min(c.timeout, ldapBindTimeout)
+	conn, err := ldap.DialURL(c.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: bindTimeout}))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to LDAP server %s: %w", c.config.URL, err)
+	}
+
+	if c.config.BindDN != "" {
+		conn.SetTimeout(bindTimeout)
+		if err := conn.Bind(c.config.BindDN, c.config.BindPassword); err != nil {
+			conn.Close() //nolint:errcheck
+			return nil, fmt.Errorf("cannot bind to LDAP server %s as %q: %w", c.config.URL,
+				c.config.BindDN, err)
+		}
+	}
+	conn.SetTimeout(c.timeout)
+
+	return conn, nil
+}
+
+// get obtains a connection from the pool or opens a new one.
+func (c *LDAPClient) get() (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-c.pool:
+			if conn.IsClosing() {
+				continue
+			}
+			return conn, nil
+		default:
+			return c.dial()
+		}
+	}
+}
+
+// put returns a connection to the pool, or closes it if the pool is full.
+func (c *LDAPClient) put(conn *ldap.Conn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close() //nolint:errcheck
+	}
+}
+
+// search looks up the credential attribute of a user.
+func (c *LDAPClient) search(username string) (string, error) {
+	attr := c.config.HA1Attribute
+	if attr == "" {
+		attr = c.config.PasswordAttribute
+	}
+	req := ldap.NewSearchRequest(c.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(c.timeout/time.Second), false,
+		fmt.Sprintf(c.config.UserFilter, ldap.EscapeFilter(username)), []string{attr}, nil)
+
+	// retry once with a fresh connection if a pooled connection went stale
+	var res *ldap.SearchResult
+	for i := 0; i < 2; i++ {
+		conn, err := c.get()
+		if err != nil {
+			return "", err
+		}
+		res, err = conn.Search(req)
+		if err == nil {
+			c.put(conn)
+			break
+		}
+		conn.Close() //nolint:errcheck
+		if i == 1 || !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+			return "", fmt.Errorf("LDAP search failed: %w", err)
+		}
+	}
+
+	if len(res.Entries) != 1 {
+		return "", nil
+	}
+
+	return res.Entries[0].GetAttributeValue(attr), nil
+}
+
+// lookup returns the credential of a user from the cache or from the LDAP server.
+func (c *LDAPClient) lookup(username string) (string, error) {
+	c.lock.Lock()
+	value, ok := c.cache.get(username, time.Now())
+	c.lock.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	c.log.Debugf("looking up credentials for user %q in LDAP directory", username)
+	value, err := c.search(username)
+	if err != nil {
+		// do not cache transient errors
+		return "", err
+	}
+
+	c.lock.Lock()
+	c.cache.add(username, value, time.Now())
+	c.lock.Unlock()
+
+	return value, nil
+}
+
+// GetAuthKey returns the TURN authentication key of a user, as returned by an AuthHandler.
+func (c *LDAPClient) GetAuthKey(username, realm string) ([]byte, error) {
+	value, err := c.lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, ErrLDAPUserNotFound
+	}
+
+	if c.config.HA1Attribute != "" {
+		key, err := hex.DecodeString(value)
+		if err != nil || len(key) != 16 {
+			return nil, fmt.Errorf("invalid HA1 hash for user %q", username)
+		}
+		return key, nil
+	}
+
+	return GenerateAuthKey(username, realm, value), nil
+}
+
+// Close closes the pooled connections.
+func (c *LDAPClient) Close() {
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.Close() //nolint:errcheck
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package authentication
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+func TestLDAPCache(t *testing.T) {
+	now := time.Now()
+	c := newLDAPCache(3, time.Minute, now)
+
+	// positive results are cached for the TTL
+	c.add("alice", "alice-pass", now)
+	v, ok := c.get("alice", now.Add(59*time.Second))
+	assert.True(t, ok, "cached")
+	assert.Equal(t, "alice-pass", v, "value")
+	_, ok = c.get("alice", now.Add(time.Minute))
+	assert.False(t, ok, "expired")
+	assert.Len(t, c.entries, 0, "expired entry removed")
+
+	// negative results are cached briefly
+	c.add("bob", "", now)
+	v, ok = c.get("bob", now.Add(ldapNegativeCacheTTL-time.Second))
+	assert.True(t, ok, "negative cached")
+	assert.Equal(t, "", v, "negative value")
+	_, ok = c.get("bob", now.Add(ldapNegativeCacheTTL))
+	assert.False(t, ok, "negative expired")
+
+	// the least recently used entry is evicted
+	for _, u := range []string{"u1", "u2", "u3"} {
+		c.add(u, u, now)
+	}
+	_, ok = c.get("u1", now)
+	assert.True(t, ok, "u1 used")
+	c.add("u4", "u4", now)
+	assert.Equal(t, 3, c.lru.Len(), "size")
+	_, ok = c.get("u2", now)
+	assert.False(t, ok, "u2 evicted")
+	for _, u := range []string{"u1", "u3", "u4"} {
+		_, ok = c.get(u, now)
+		assert.True(t, ok, fmt.Sprintf("%s cached", u))
+	}
+
+	// expired entries are swept on insert
+	c.add("u5", "", now)
+	c.add("u6", "u6", now.Add(2*time.Minute))
+	assert.Equal(t, 1, c.lru.Len(), "swept")
+	assert.Len(t, c.entries, 1, "swept")
+}
+
+func TestLDAPBindTimeout(t *testing.T) {
+	// a server that accepts connections but never responds
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "listen")
+	defer l.Close() //nolint:errcheck
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close() //nolint:errcheck
+		}
+	}()
+
+	config := stnrv1.LDAPConfig{
+		URL:               "ldap://" + l.Addr().String(),
+		BindDN:            "cn=stunner,dc=example,dc=com",
+		BindPassword:      "secret",
+		BaseDN:            "dc=example,dc=com",
+		UserFilter:        stnrv1.DefaultLDAPUserFilter,
+		PasswordAttribute: "userPassword",
+		PoolSize:          1,
+		CacheTTL:          stnrv1.DefaultLDAPCacheTTL,
+		Timeout:           10,
+	}
+	c := NewLDAPClient(config, logging.NewDefaultLoggerFactory().NewLogger("ldap"))
+	defer c.Close()
+
+	start := time.Now()
+	_, err = c.GetAuthKey("alice", "realm")
+	assert.Error(t, err, "bind timeout")
+	assert.Less(t, time.Since(start), 3*ldapBindTimeout, "short bind timeout")
+}
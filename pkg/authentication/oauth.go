@@ -0,0 +1,135 @@
+package authentication
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// STUN attributes used in third-party authorization (RFC 7635).
+const (
+	// AttrAccessToken is the ACCESS-TOKEN attribute carrying the self-contained token.
+	AttrAccessToken uint16 = 0x001B
+	// AttrThirdPartyAuthorization is the THIRD-PARTY-AUTHORIZATION attribute carrying the
+	// name of the authorization server.
+	AttrThirdPartyAuthorization uint16 = 0x802E
+)
+
+// OAuthTokenNonceLength is the length of the AEAD nonce in access tokens.
+const OAuthTokenNonceLength = 12
+
+var (
+	ErrInvalidOAuthToken = errors.New("invalid access token")
+	ErrExpiredOAuthToken = errors.New("expired access token")
+)
+
+// OAuthToken is the content of a self-contained access token (RFC 7635, Section 6.2).
+type OAuthToken struct {
+	// MACKey is the session key used to compute the MESSAGE-INTEGRITY of the requests.
+	MACKey []byte
+	// Timestamp is the time the token was issued.
+	Timestamp time.Time
+	// Lifetime is the validity period of the token, counted from Timestamp.
+	Lifetime time.Duration
+}
+
+// Expiry returns the time when the token expires.
+func (t *OAuthToken) Expiry() time.Time {
+	return t.Timestamp.Add(t.Lifetime)
+}
+
+func newOAuthAEAD(key []byte) (cipher.AEAD, error) {
+	// AES-128-GCM or AES-256-GCM, depending on the key length
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("invalid access token key length %d, must be 16 or 32 bytes",
+			len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// toNTPTimestamp converts a time into the 64-bit token timestamp format: 48 bits of seconds and
+// 16 bits of fractional seconds.
+func toNTPTimestamp(t time.Time) uint64 {
+	return uint64(t.Unix())<<16 | uint64(t.Nanosecond())*(1<<16)/uint64(time.Second) //nolint:gosec
+}
+
+func fromNTPTimestamp(ts uint64) time.Time {
+	frac := time.Duration((ts & 0xffff) * uint64(time.Second) >> 16) //nolint:gosec
+	return time.Unix(int64(ts>>16), 0).Add(frac)                     //nolint:gosec
+}
+
+// EncryptOAuthToken creates a self-contained access token encrypted with the given token key
+// using AES-GCM, with the STUN server name as the associated data (RFC 7635, Section 6.2).
+// Useful for implementing authorization servers.
+func EncryptOAuthToken(key []byte, serverName string, token OAuthToken) ([]byte, error) {
+	aead, err := newOAuthAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, 0, 2+len(token.MACKey)+8+4)
+	plain = binary.BigEndian.AppendUint16(plain, uint16(len(token.MACKey))) //nolint:gosec
+	plain = append(plain, token.MACKey...)
+	plain = binary.BigEndian.AppendUint64(plain, toNTPTimestamp(token.Timestamp))
+	plain = binary.BigEndian.AppendUint32(plain, uint32(token.Lifetime/time.Second))
+
+	nonce := make([]byte, OAuthTokenNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ret := binary.BigEndian.AppendUint16(nil, uint16(len(nonce)))
+	ret = append(ret, nonce...)
+	return aead.Seal(ret, nonce, plain, []byte(serverName)), nil
+}
+
+// DecryptOAuthToken decrypts and checks a self-contained access token using the given token key
+// and STUN server name. Returns ErrExpiredOAuthToken if the token has expired.
+func DecryptOAuthToken(key []byte, serverName string, raw []byte) (*OAuthToken, error) {
+	aead, err := newOAuthAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < 2 {
+		return nil, ErrInvalidOAuthToken
+	}
+	nonceLen := int(binary.BigEndian.Uint16(raw[0:2]))
+	if nonceLen != aead.NonceSize() || len(raw) < 2+nonceLen {
+		return nil, ErrInvalidOAuthToken
+	}
+	nonce := raw[2 : 2+nonceLen]
+
+	plain, err := aead.Open(nil, nonce, raw[2+nonceLen:], []byte(serverName))
+	if err != nil {
+		return nil, ErrInvalidOAuthToken
+	}
+
+	if len(plain) < 2 {
+		return nil, ErrInvalidOAuthToken
+	}
+	keyLen := int(binary.BigEndian.Uint16(plain[0:2]))
+	if keyLen == 0 || len(plain) != 2+keyLen+8+4 {
+		return nil, ErrInvalidOAuthToken
+	}
+
+	token := &OAuthToken{
+		MACKey:    plain[2 : 2+keyLen],
+		Timestamp: fromNTPTimestamp(binary.BigEndian.Uint64(plain[2+keyLen : 2+keyLen+8])),
+		Lifetime:  time.Duration(binary.BigEndian.Uint32(plain[2+keyLen+8:])) * time.Second,
+	}
+
+	if time.Now().After(token.Expiry()) {
+		return token, ErrExpiredOAuthToken
+	}
+
+	return token, nil
+}
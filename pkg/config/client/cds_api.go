@@ -350,12 +350,15 @@ func poll(ctx context.Context, a CdsApi, ch chan<- *stnrv1.StunnerConfig, suppre
 				continue
 			}
 
-			c, err := ParseConfig(msg)
+			c, deprecated, err := ParseConfigDeprecations(msg, DetectConfigFormat("", msg))
 			if err != nil {
 				// assume it is a YAML/JSON syntax error: report and ignore
 				a.Warnf("could not parse config: %s", err.Error())
 				continue
 			}
+			for _, d := range deprecated {
+				a.Warnf("deprecated setting in config: %s", d.String())
+			}
 
 			if err := c.Validate(); err != nil {
 				a.Warnf("invalid config: %s", err.Error())
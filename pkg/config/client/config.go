@@ -2,17 +2,42 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
+	"github.com/l7mp/stunner/internal/configfmt"
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	stnrv1a1 "github.com/l7mp/stunner/pkg/apis/v1alpha1"
 	"sigs.k8s.io/yaml"
 )
 
+// Config serialization formats. JSON configs are parsed as YAML, since JSON is a subset of YAML.
+const (
+	ConfigFormatYAML = "yaml"
+	ConfigFormatTOML = "toml"
+	ConfigFormatHCL  = "hcl"
+)
+
+// StrictDeprecation makes the config parser reject the configs that use deprecated API fields or
+// field values, see stnrv1.Deprecations. By default the config clients only log a warning.
+var StrictDeprecation = false
+
+// ErrDeprecated is returned when a config uses a deprecated API field or field value in strict
+// mode.
+var ErrDeprecated = errors.New("deprecated API usage")
+
+var (
+	tomlTableRe    = regexp.MustCompile(`^\[\[?[^\[\]]+\]\]?$`)
+	hclBlockRe     = regexp.MustCompile(`^[A-Za-z_][\w-]*(\s+("[^"]*"|[A-Za-z_][\w-]*))*\s*\{`)
+	tomlKeyValueRe = regexp.MustCompile(`^("[^"]*"|'[^']*'|[\w.-]+)\s*=`)
+)
+
 type ConfigSkeleton struct {
 	ApiVersion string `json:"version"`
 }
@@ -55,9 +80,74 @@ func IsZeroConfig(req *stnrv1.StunnerConfig) bool {
 	return req.DeepEqual(c)
 }
 
+// DetectConfigFormat returns the serialization format of a configuration, either from the
+// extension of the file name (".yaml", ".yml", ".json", ".toml" or ".hcl"), or, if the file name is
+// empty or has a different extension, from the content: a config whose first line is a TOML table
+// header or an HCL block, or which consists of "key = value" lines, is taken to be TOML or HCL,
+// everything else is YAML (or JSON).
+func DetectConfigFormat(file string, c []byte) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return ConfigFormatYAML
+	case ".toml":
+		return ConfigFormatTOML
+	case ".hcl":
+		return ConfigFormatHCL
+	}
+
+	lines := []string{}
+	for _, l := range strings.Split(string(c), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "#") && !strings.HasPrefix(l, "//") {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 0 {
+		return ConfigFormatYAML
+	}
+
+	switch {
+	case tomlTableRe.MatchString(lines[0]):
+		return ConfigFormatTOML
+	case hclBlockRe.MatchString(lines[0]), strings.HasPrefix(lines[0], "/*"):
+		return ConfigFormatHCL
+	case tomlKeyValueRe.MatchString(lines[0]):
+		// both TOML and HCL: decide by the way nested objects are given
+		for _, l := range lines[1:] {
+			if tomlTableRe.MatchString(l) {
+				return ConfigFormatTOML
+			}
+			if hclBlockRe.MatchString(l) {
+				return ConfigFormatHCL
+			}
+		}
+		return ConfigFormatTOML
+	}
+
+	return ConfigFormatYAML
+}
+
 // ParseConfig parses a raw buffer holding a configuration, substituting environment variables for
-// placeholders in the configuration. Returns the new configuration or error if parsing fails.
+// placeholders in the configuration. The serialization format is detected from the content, see
+// DetectConfigFormat. Returns the new configuration or error if parsing fails.
 func ParseConfig(c []byte) (*stnrv1.StunnerConfig, error) {
+	return ParseConfigFormat(c, DetectConfigFormat("", c))
+}
+
+// ParseConfigFormat parses a raw buffer holding a configuration in the given serialization format
+// (ConfigFormatYAML, ConfigFormatTOML or ConfigFormatHCL), substituting environment variables for
+// placeholders in the configuration. TOML and HCL configs are converted into the same canonical
+// representation as YAML and JSON configs. Returns the new configuration or error if parsing
+// fails.
+func ParseConfigFormat(c []byte, format string) (*stnrv1.StunnerConfig, error) {
+	conf, _, err := ParseConfigDeprecations(c, format)
+	return conf, err
+}
+
+// ParseConfigDeprecations is the same as ParseConfigFormat but it also returns the deprecated API
+// fields and field values used in the configuration. If StrictDeprecation is set, a config with
+// deprecated settings is rejected with an error wrapping ErrDeprecated.
+func ParseConfigDeprecations(c []byte, format string) (*stnrv1.StunnerConfig, []stnrv1.Deprecation, error) {
 	// substitute environtment variables
 	// default port: STUNNER_PUBLIC_PORT -> STUNNER_PORT
 	re := regexp.MustCompile(`^[0-9]+$`)
@@ -76,9 +166,9 @@ func ParseConfig(c []byte) (*stnrv1.StunnerConfig, error) {
 	// make sure credentials are not affected by environment substitution
 
 	// parse up before env substitution is applied
-	confRaw, err := parseRaw(c)
+	confRaw, _, err := parseRaw(c, format)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// save credentials
@@ -87,58 +177,83 @@ func ParseConfig(c []byte) (*stnrv1.StunnerConfig, error) {
 
 	// apply env substitution and parse again
 	e := os.ExpandEnv(string(c))
-	confExp, err := parseRaw([]byte(e))
+	confExp, deprecated, err := parseRaw([]byte(e), format)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// restore credentials
 	maps.Copy(confExp.Auth.Credentials, credRaw)
 
-	return confExp, nil
+	if StrictDeprecation && len(deprecated) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDeprecated, deprecated[0].String())
+	}
+
+	return confExp, deprecated, nil
 }
 
-func parseRaw(c []byte) (*stnrv1.StunnerConfig, error) {
+func parseRaw(c []byte, format string) (*stnrv1.StunnerConfig, []stnrv1.Deprecation, error) {
+	switch format {
+	case ConfigFormatYAML:
+	case ConfigFormatTOML:
+		js, err := configfmt.TOMLToJSON(c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not parse TOML config: %w", err)
+		}
+		c = js
+	case ConfigFormatHCL:
+		js, err := configfmt.HCLToJSON(c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not parse HCL config: %w", err)
+		}
+		c = js
+	default:
+		return nil, nil, fmt.Errorf("unknown config format %q", format)
+	}
+
 	// try to parse only the config version first
 	k := ConfigSkeleton{}
 	if err := yaml.Unmarshal([]byte(c), &k); err != nil {
 		if errJ := json.Unmarshal([]byte(c), &k); err != nil {
-			return nil, fmt.Errorf("could not parse config file API version: "+
+			return nil, nil, fmt.Errorf("could not parse config file API version: "+
 				"YAML parse error: %s, JSON parse error: %s",
 				err.Error(), errJ.Error())
 		}
 	}
 
 	s := stnrv1.StunnerConfig{}
+	var deprecated []stnrv1.Deprecation
 
 	switch k.ApiVersion {
 	case stnrv1.ApiVersion:
 		if err := yaml.Unmarshal([]byte(c), &s); err != nil {
 			if errJ := json.Unmarshal([]byte(c), &s); errJ != nil {
-				return nil, fmt.Errorf("could not parse config file: "+
+				return nil, nil, fmt.Errorf("could not parse config file: "+
 					"YAML parse error: %s, JSON parse error: %s",
 					err.Error(), errJ.Error())
 			}
 		}
+		deprecated = s.Deprecated()
 	case stnrv1a1.ApiVersion:
 		a := stnrv1a1.StunnerConfig{}
 		if err := yaml.Unmarshal([]byte(c), &a); err != nil {
 			if errJ := json.Unmarshal([]byte(c), &a); errJ != nil {
-				return nil, fmt.Errorf("could not parse config file: "+
+				return nil, nil, fmt.Errorf("could not parse config file: "+
 					"YAML parse error: %s, JSON parse error: %s",
 					err.Error(), errJ.Error())
 			}
 		}
 
+		deprecated = a.Deprecated()
 		sv1, err := stnrv1a1.ConvertToV1(&a)
 		if err != nil {
-			return nil, fmt.Errorf("could not convert config to API V1: %s", err)
+			return nil, nil, fmt.Errorf("could not convert config to API V1: %s", err)
 		}
 
 		sv1.DeepCopyInto(&s)
 	}
 
-	return &s, nil
+	return &s, deprecated, nil
 }
 
 // IsConfigDeleted is a helper that allows to decide whether a config is being deleted. When a
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlConfig = `
+version: v1
+admin:
+  name: stunnerd
+  loglevel: all:INFO
+auth:
+  type: static
+  credentials:
+    username: user1
+    password: pass1
+listeners:
+  - name: udp-listener
+    protocol: TURN-UDP
+    port: 3478
+    routes: ["media-plane"]
+clusters:
+  - name: media-plane
+    type: STATIC
+    endpoints: ["10.0.0.0/8"]
+`
+
+const tomlConfig = `
+# STUNner config
+version = "v1"
+
+[admin]
+name = "stunnerd"
+loglevel = "all:INFO"
+
+[auth]
+type = "static"
+credentials = { username = "user1", password = "pass1" }
+
+[[listeners]]
+name = "udp-listener"
+protocol = "TURN-UDP"
+port = 3478
+routes = ["media-plane"]
+
+[[clusters]]
+name = "media-plane"
+type = "STATIC"
+endpoints = ["10.0.0.0/8"]
+`
+
+const hclConfig = `
+# STUNner config
+version = "v1"
+
+admin {
+  name     = "stunnerd"
+  loglevel = "all:INFO"
+}
+
+auth {
+  type = "static"
+  credentials = {
+    username = "user1"
+    password = "pass1"
+  }
+}
+
+listeners "udp-listener" {
+  protocol = "TURN-UDP"
+  port     = 3478
+  routes   = ["media-plane"]
+}
+
+clusters "media-plane" {
+  type      = "STATIC"
+  endpoints = ["10.0.0.0/8"]
+}
+`
+
+func TestDetectConfigFormat(t *testing.T) {
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat("", []byte(yamlConfig)), "yaml")
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat("", []byte(`{"version":"v1"}`)), "json")
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat("", []byte{}), "empty")
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("", []byte(tomlConfig)), "toml")
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("", []byte("[admin]\nname = \"x\"")),
+		"toml table")
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("", []byte("version = \"v1\"")),
+		"toml key/value")
+	assert.Equal(t, ConfigFormatHCL, DetectConfigFormat("", []byte(hclConfig)), "hcl")
+	assert.Equal(t, ConfigFormatHCL, DetectConfigFormat("", []byte("admin {\n}")), "hcl block")
+
+	// the extension takes precedence
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("stunnerd.toml", []byte(yamlConfig)),
+		"toml file")
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("/etc/stunnerd.TOML", []byte(yamlConfig)),
+		"toml file upper case")
+	assert.Equal(t, ConfigFormatHCL, DetectConfigFormat("/etc/stunnerd.HCL", []byte(tomlConfig)),
+		"hcl file")
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat("stunnerd.json", []byte(tomlConfig)),
+		"json file")
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("stunnerd.conf", []byte(tomlConfig)),
+		"unknown extension")
+}
+
+func TestParseConfigFormat(t *testing.T) {
+	ref, err := ParseConfig([]byte(yamlConfig))
+	assert.NoError(t, err, "parse YAML")
+	assert.NoError(t, ref.Validate(), "validate YAML")
+
+	for _, c := range []struct {
+		name, format, conf string
+	}{
+		{"toml", ConfigFormatTOML, tomlConfig},
+		{"hcl", ConfigFormatHCL, hclConfig},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			conf, err := ParseConfigFormat([]byte(c.conf), c.format)
+			assert.NoError(t, err, "parse")
+			assert.NoError(t, conf.Validate(), "validate")
+			assert.True(t, ref.DeepEqual(conf), "same config: %s", conf.String())
+
+			// detected
+			conf, err = ParseConfig([]byte(c.conf))
+			assert.NoError(t, err, "parse")
+			assert.NoError(t, conf.Validate(), "validate")
+			assert.True(t, ref.DeepEqual(conf), "same config: %s", conf.String())
+
+			// from file
+			file := filepath.Join(t.TempDir(), "stunnerd."+c.format)
+			assert.NoError(t, os.WriteFile(file, []byte(c.conf), 0o600), "write")
+			log := logging.NewDefaultLoggerFactory().NewLogger("test")
+			client, err := NewConfigFileClient(file, "stunnerd", log)
+			assert.NoError(t, err, "client")
+			conf, err = client.Load()
+			assert.NoError(t, err, "load")
+			assert.True(t, ref.DeepEqual(conf), "same config: %s", conf.String())
+		})
+	}
+
+	_, err = ParseConfigFormat([]byte("[admin"), ConfigFormatTOML)
+	assert.Error(t, err, "invalid TOML")
+	_, err = ParseConfigFormat([]byte(tomlConfig), ConfigFormatHCL)
+	assert.Error(t, err, "TOML as HCL")
+	_, err = ParseConfigFormat([]byte(yamlConfig), "dummy")
+	assert.Error(t, err, "unknown format")
+}
+
+func TestParseConfigDeprecations(t *testing.T) {
+	defer func() { StrictDeprecation = false }()
+
+	conf, deprecated, err := ParseConfigDeprecations([]byte(yamlConfig), ConfigFormatYAML)
+	assert.NoError(t, err, "parse")
+	assert.NotNil(t, conf, "config")
+	assert.Empty(t, deprecated, "no deprecations")
+
+	v1alpha1Config := `{"version":"v1alpha1","auth":{"type":"longterm","credentials":{"secret":"s"}},` +
+		`"listeners":[{"name":"udp","protocol":"turn-udp","port":3478}]}`
+	conf, deprecated, err = ParseConfigDeprecations([]byte(v1alpha1Config), ConfigFormatYAML)
+	assert.NoError(t, err, "parse")
+	assert.Equal(t, "ephemeral", conf.Auth.Type, "converted")
+	assert.Len(t, deprecated, 2, "deprecations")
+	assert.Equal(t, "version", deprecated[0].Field, "deprecated version")
+	assert.Equal(t, "v1", deprecated[0].Replacement, "deprecated version")
+	assert.Equal(t, "auth.type", deprecated[1].Field, "deprecated auth type")
+	assert.Equal(t, "ephemeral", deprecated[1].Replacement, "deprecated auth type")
+	assert.Equal(t, `auth.type: value "longterm" is deprecated in API version v1alpha1, `+
+		`use "ephemeral" (removed in v1beta1)`, deprecated[1].String())
+
+	// deprecated values in the v1 API, possibly set from the environment
+	t.Setenv("STUNNER_TEST_AUTH_TYPE", "plaintext")
+	v1Config := `{"version":"v1","auth":{"type":"$STUNNER_TEST_AUTH_TYPE",` +
+		`"credentials":{"username":"u","password":"p"}}}`
+	_, deprecated, err = ParseConfigDeprecations([]byte(v1Config), ConfigFormatYAML)
+	assert.NoError(t, err, "parse")
+	assert.Len(t, deprecated, 1, "deprecations")
+	assert.Equal(t, "plaintext", deprecated[0].Value, "deprecated auth type")
+
+	// strict mode
+	StrictDeprecation = true
+	_, err = ParseConfig([]byte(v1Config))
+	assert.ErrorIs(t, err, ErrDeprecated, "strict")
+	_, err = ParseConfig([]byte(yamlConfig))
+	assert.NoError(t, err, "strict")
+
+	file := filepath.Join(t.TempDir(), "stunnerd.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(v1alpha1Config), 0o600), "write")
+	log := logging.NewDefaultLoggerFactory().NewLogger("test")
+	client, err := NewConfigFileClient(file, "stunnerd", log)
+	assert.NoError(t, err, "client")
+	_, err = client.Load()
+	assert.ErrorIs(t, err, ErrDeprecated, "strict load")
+}
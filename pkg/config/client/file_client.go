@@ -52,10 +52,13 @@ func (w *ConfigFileClient) Load() (*stnrv1.StunnerConfig, error) {
 		return nil, errFileTruncated
 	}
 
-	c, err := ParseConfig(b)
+	c, deprecated, err := ParseConfigDeprecations(b, DetectConfigFormat(w.configFile, b))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	for _, d := range deprecated {
+		w.log.Warnf("Deprecated setting in config file %q: %s", w.configFile, d.String())
+	}
 
 	if err := c.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
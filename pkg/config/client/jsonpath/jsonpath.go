@@ -1,11 +1,12 @@
-package client
+// Package jsonpath implements kubectl-style JSONPath output formatting for the STUNner CLI tools.
+package jsonpath
 
 import (
 	"fmt"
 	"regexp"
 	"strings"
 
-	"k8s.io/client-go/util/jsonpath"
+	k8sjsonpath "k8s.io/client-go/util/jsonpath"
 )
 
 // ////////////////////////
@@ -36,7 +37,7 @@ type Segment struct {
 	// String is the actual text of the segment (if any).
 	String string
 	// JSONQuery is the actual query in the segment.
-	JSONQuery *jsonpath.JSONPath
+	JSONQuery *k8sjsonpath.JSONPath
 	// Type indicates whether this is a regular string or an expression.
 	Type SegmentType
 }
@@ -69,7 +70,7 @@ func (jp *jsonPath) Parse(arg string) (bool, error) {
 
 		// Check if this is an expression (starts with '{' and ends with '}')
 		if len(match) >= 2 && match[0] == '{' && match[len(match)-1] == '}' {
-			jsonQuery := jsonpath.New("arg")
+			jsonQuery := k8sjsonpath.New("arg")
 
 			// Parse and print jsonpath
 			fields, err := relaxedJSONPathExpression(match)
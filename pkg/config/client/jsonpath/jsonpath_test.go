@@ -1,4 +1,4 @@
-package client
+package jsonpath
 
 import (
 	"encoding/json"
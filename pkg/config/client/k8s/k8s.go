@@ -1,4 +1,7 @@
-package client
+// Package k8s implements the discovery of the STUNner config discovery service, the dataplane
+// pods and the authentication service in Kubernetes. It is kept separate from the config client so
+// that embedding the config client does not pull in the Kubernetes client libraries.
+package k8s
 
 import (
 	"bytes"
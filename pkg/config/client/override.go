@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ApplyOverride overrides a single setting in a config. The override is given in the format
+// <path>=<value>, where the path is a dot-separated list of the JSON field names leading to the
+// setting, e.g., "admin.loglevel=all:DEBUG" or "auth.credentials.password=pass". Listeners and
+// clusters are selected by name, e.g., "listeners.udp-listener.port=3479" sets the port of the
+// listener named "udp-listener". The "username", "password" and "secret" fields of the auth
+// section are shorthands for the respective credentials. The value is parsed as YAML, so that,
+// e.g., "clusters.media-plane.endpoints=[10.0.0.0/8]" sets a list, and it is taken as a plain
+// string if the parsed value does not fit the type of the setting.
+func ApplyOverride(c *stnrv1.StunnerConfig, override string) error {
+	path, value, ok := strings.Cut(override, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("invalid override %q: expected format <path>=<value>", override)
+	}
+
+	js, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	root := map[string]any{}
+	if err := json.Unmarshal(js, &root); err != nil {
+		return err
+	}
+
+	obj, keys, err := lookupOverride(root, strings.Split(path, "."))
+	if err != nil {
+		return fmt.Errorf("invalid override %q: %w", override, err)
+	}
+
+	var v any = value
+	if value != "" {
+		if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+			v = value
+		}
+	}
+
+	conf, err := setOverride(root, obj, keys, v)
+	if err != nil {
+		if _, ok := v.(string); ok {
+			return fmt.Errorf("invalid override %q: %w", override, err)
+		}
+		// retry with the value taken as a string
+		if conf, err = setOverride(root, obj, keys, value); err != nil {
+			return fmt.Errorf("invalid override %q: %w", override, err)
+		}
+	}
+
+	*c = *conf
+	return nil
+}
+
+// lookupOverride finds the object holding the setting selected by an override path and returns
+// the object with the path of the setting within the object.
+func lookupOverride(root map[string]any, keys []string) (map[string]any, []string, error) {
+	if len(keys) < 2 {
+		return nil, nil, fmt.Errorf("path must contain a section and a field")
+	}
+
+	switch keys[0] {
+	case "admin", "auth":
+		obj, ok := root[keys[0]].(map[string]any)
+		if !ok {
+			obj = map[string]any{}
+			root[keys[0]] = obj
+		}
+		if keys[0] == "auth" && len(keys) == 2 {
+			switch keys[1] {
+			case "username", "password", "secret":
+				return obj, []string{"credentials", keys[1]}, nil
+			}
+		}
+		return obj, keys[1:], nil
+
+	case "listener", "listeners", "cluster", "clusters":
+		section := strings.TrimSuffix(keys[0], "s") + "s"
+		list, _ := root[section].([]any)
+		// names may contain dots: try the longest matching name first
+		for i := len(keys) - 1; i > 1; i-- {
+			name := strings.Join(keys[1:i], ".")
+			for _, e := range list {
+				if obj, ok := e.(map[string]any); ok && obj["name"] == name {
+					return obj, keys[i:], nil
+				}
+			}
+		}
+		return nil, nil, fmt.Errorf("no %s found for path %q", strings.TrimSuffix(section, "s"),
+			strings.Join(keys[1:], "."))
+
+	default:
+		return nil, nil, fmt.Errorf("unknown section %q", keys[0])
+	}
+}
+
+// setOverride sets a value in the JSON representation of a config and converts the result back
+// into a config.
+func setOverride(root, obj map[string]any, keys []string, v any) (*stnrv1.StunnerConfig, error) {
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := obj[k].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			obj[k] = next
+		}
+		obj = next
+	}
+	obj[keys[len(keys)-1]] = v
+
+	js, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &stnrv1.StunnerConfig{}
+	d := json.NewDecoder(bytes.NewReader(js))
+	d.DisallowUnknownFields()
+	if err := d.Decode(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyOverride(t *testing.T) {
+	c, err := ParseConfigFormat([]byte(yamlConfig), ConfigFormatYAML)
+	assert.NoError(t, err, "parse")
+
+	for _, o := range []string{
+		"admin.loglevel=all:DEBUG",
+		"auth.password=1234",
+		"auth.credentials.username=user2",
+		"listeners.udp-listener.port=3479",
+		"listener.udp-listener.routes=[media-plane, other]",
+		"clusters.media-plane.endpoints=[192.168.0.0/16]",
+	} {
+		assert.NoError(t, ApplyOverride(c, o), o)
+	}
+
+	assert.Equal(t, "all:DEBUG", c.Admin.LogLevel, "loglevel")
+	assert.Equal(t, "1234", c.Auth.Credentials["password"], "password")
+	assert.Equal(t, "user2", c.Auth.Credentials["username"], "username")
+	assert.Len(t, c.Listeners, 1, "listeners")
+	assert.Equal(t, 3479, c.Listeners[0].Port, "port")
+	assert.Equal(t, []string{"media-plane", "other"}, c.Listeners[0].Routes, "routes")
+	assert.Equal(t, []string{"192.168.0.0/16"}, c.Clusters[0].Endpoints, "endpoints")
+	assert.Equal(t, "TURN-UDP", c.Listeners[0].Protocol, "untouched field")
+
+	for _, o := range []string{
+		"admin.loglevel",
+		"=all:DEBUG",
+		"admin",
+		"foo.bar=baz",
+		"listeners.dummy.port=3479",
+		"listeners.udp-listener.prot=3479",
+		"listeners.udp-listener.port=dummy",
+	} {
+		assert.Error(t, ApplyOverride(c, o), o)
+	}
+	assert.Equal(t, 3479, c.Listeners[0].Port, "port unchanged on error")
+}
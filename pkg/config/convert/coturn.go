@@ -0,0 +1,374 @@
+// Package convert implements converters from the configuration formats of other TURN servers into
+// STUNner configurations, to ease the migration to STUNner.
+package convert
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+const (
+	coturnDefaultPort           = 3478
+	coturnDefaultTLSPort        = 5349
+	coturnDefaultPrometheusPort = 9641
+)
+
+// coturn options that have no STUNner counterpart and do not affect the semantics of the
+// configuration (mostly logging and process management): ignored silently.
+var coturnIgnoredOptions = map[string]bool{
+	"fingerprint": true, "lt-cred-mech": true, "log-file": true, "syslog": true,
+	"simple-log": true, "new-log-timestamp": true, "new-log-timestamp-format": true,
+	"no-stdout-log": true, "verbose": true, "Verbose": true, "pidfile": true, "proc-user": true,
+	"proc-group": true, "no-cli": true, "cli-ip": true, "cli-port": true, "cli-password": true,
+	"no-software-attribute": true, "mobility": true,
+}
+
+// coturnOption is a single option in a coturn config file.
+type coturnOption struct {
+	key, value string
+	line       int
+}
+
+// FromCoturn converts a coturn config file (turnserver.conf) into a STUNner configuration. The
+// following options are converted:
+//
+//   - listening-port, tls-listening-port, listening-ip, external-ip, no-udp, no-tcp, no-tls,
+//     no-dtls, cert and pkey are converted into listeners: a TURN-UDP and a TURN-TCP listener at
+//     the listening port and, if a certificate and a private key are given, a TURN-TLS and a
+//     TURN-DTLS listener at the TLS listening port,
+//   - realm, user, use-auth-secret, static-auth-secret and no-auth are converted into the auth
+//     config: static auth with the first user or ephemeral auth with the first shared secret,
+//   - allowed-peer-ip ranges are converted into the endpoints of a cluster routed from all
+//     listeners (an "allow-any" cluster is created if no allowed peer range is given),
+//   - server-name, user-quota, stale-nonce and prometheus/prometheus-port are converted into
+//     the corresponding admin and auth settings.
+//
+// The certificate and the private key files referred to in the coturn config are read from the
+// local file system. Options that have no STUNner counterpart (e.g., denied-peer-ip, min-port or
+// max-port) are reported in the returned list of warnings. Returns an error if the coturn config
+// cannot be converted, e.g., if the credentials are stored in a database.
+func FromCoturn(r io.Reader) (*stnrv1.StunnerConfig, []string, error) {
+	opts, err := parseCoturn(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &stnrv1.StunnerConfig{
+		ApiVersion: stnrv1.ApiVersion,
+		Admin:      stnrv1.AdminConfig{LogLevel: stnrv1.DefaultLogLevel},
+		Auth:       stnrv1.AuthConfig{Realm: stnrv1.DefaultRealm, Credentials: map[string]string{}},
+	}
+	warnings := []string{}
+	warn := func(o coturnOption, format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf("line %d: %s: %s", o.line, o.key,
+			fmt.Sprintf(format, args...)))
+	}
+
+	port, tlsPort := coturnDefaultPort, coturnDefaultTLSPort
+	addr, publicAddr, cert, key := "", "", "", ""
+	noUDP, noTCP, noTLS, noDTLS := false, false, false, false
+	useAuthSecret, noAuth := false, false
+	users, secrets, peers := []coturnOption{}, []coturnOption{}, []string{}
+	prometheus, prometheusPort := false, coturnDefaultPrometheusPort
+
+	for _, o := range opts {
+		switch o.key {
+		case "listening-port":
+			if port, err = coturnPort(o); err != nil {
+				return nil, nil, err
+			}
+		case "tls-listening-port":
+			if tlsPort, err = coturnPort(o); err != nil {
+				return nil, nil, err
+			}
+		case "listening-ip":
+			if addr != "" {
+				warn(o, "multiple listening addresses are not supported, using %s", addr)
+				continue
+			}
+			addr = o.value
+		case "external-ip":
+			if publicAddr != "" {
+				warn(o, "multiple external addresses are not supported, using %s", publicAddr)
+				continue
+			}
+			// the format is "public[/private]"
+			publicAddr, _, _ = strings.Cut(o.value, "/")
+		case "no-udp":
+			noUDP = true
+		case "no-tcp":
+			noTCP = true
+		case "no-tls":
+			noTLS = true
+		case "no-dtls":
+			noDTLS = true
+		case "cert":
+			if cert, err = readCoturnFile(o); err != nil {
+				return nil, nil, err
+			}
+		case "pkey":
+			if key, err = readCoturnFile(o); err != nil {
+				return nil, nil, err
+			}
+		case "realm":
+			c.Auth.Realm = o.value
+		case "user":
+			users = append(users, o)
+		case "use-auth-secret":
+			useAuthSecret = true
+		case "static-auth-secret":
+			secrets = append(secrets, o)
+		case "no-auth":
+			noAuth = true
+		case "allowed-peer-ip":
+			ps, err := coturnPeerRange(o)
+			if err != nil {
+				return nil, nil, err
+			}
+			peers = append(peers, ps...)
+		case "denied-peer-ip":
+			warn(o, "denied peer ranges are not supported: STUNner relays only to the peers in "+
+				"the allowed peer ranges")
+		case "server-name":
+			c.Admin.Name = o.value
+		case "user-quota":
+			q, err := strconv.Atoi(o.value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid user quota %q", o.line, o.value)
+			}
+			c.Admin.UserQuota = q
+		case "stale-nonce":
+			if o.value == "" {
+				continue // coturn default
+			}
+			ttl, err := strconv.Atoi(o.value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid nonce lifetime %q", o.line, o.value)
+			}
+			c.Auth.NonceTTL = ttl
+		case "prometheus":
+			prometheus = true
+		case "prometheus-port":
+			if prometheusPort, err = coturnPort(o); err != nil {
+				return nil, nil, err
+			}
+		default:
+			if !coturnIgnoredOptions[o.key] {
+				warn(o, "unsupported option ignored")
+			}
+		}
+	}
+
+	if prometheus {
+		c.Admin.MetricsEndpoint = fmt.Sprintf("http://:%d/metrics", prometheusPort)
+	}
+
+	// auth
+	switch {
+	case noAuth:
+		c.Auth.Type = "none"
+	case useAuthSecret:
+		if len(secrets) == 0 {
+			return nil, nil, errors.New("use-auth-secret without static-auth-secret: shared " +
+				"secrets stored in a database are not supported")
+		}
+		for _, o := range secrets[1:] {
+			warn(o, "multiple shared secrets are not supported, using the first one")
+		}
+		c.Auth.Type = "ephemeral"
+		c.Auth.Credentials["secret"] = secrets[0].value
+	case len(users) > 0:
+		for _, o := range users[1:] {
+			warn(o, "multiple users are not supported, using the first one")
+		}
+		o := users[0]
+		user, passwd, ok := strings.Cut(o.value, ":")
+		if !ok || user == "" || passwd == "" {
+			return nil, nil, fmt.Errorf("line %d: invalid user %q", o.line, o.value)
+		}
+		if strings.HasPrefix(passwd, "0x") {
+			return nil, nil, fmt.Errorf("line %d: hashed passwords are not supported", o.line)
+		}
+		c.Auth.Type = "static"
+		c.Auth.Credentials["username"] = user
+		c.Auth.Credentials["password"] = passwd
+	default:
+		return nil, nil, errors.New("no credentials found: users or shared secrets stored in " +
+			"a database are not supported")
+	}
+
+	// clusters
+	cluster := stnrv1.ClusterConfig{Name: "allowed-peers", Type: "STATIC", Endpoints: peers}
+	if len(peers) == 0 {
+		warnings = append(warnings, "no allowed-peer-ip: relaying is permitted to any peer")
+		cluster.Name = "allow-any"
+		cluster.Endpoints = []string{"0.0.0.0/0"}
+	}
+	c.Clusters = []stnrv1.ClusterConfig{cluster}
+
+	// listeners
+	newListener := func(proto string, port int) stnrv1.ListenerConfig {
+		l := stnrv1.ListenerConfig{
+			Name:       strings.ToLower(strings.TrimPrefix(proto, "TURN-")) + "-listener",
+			Protocol:   proto,
+			Addr:       addr,
+			Port:       port,
+			PublicAddr: publicAddr,
+			Routes:     []string{cluster.Name},
+		}
+		if publicAddr != "" {
+			// coturn does not remap ports
+			l.PublicPort = port
+		}
+		return l
+	}
+	c.Listeners = []stnrv1.ListenerConfig{}
+	if !noUDP {
+		c.Listeners = append(c.Listeners, newListener("TURN-UDP", port))
+	}
+	if !noTCP {
+		c.Listeners = append(c.Listeners, newListener("TURN-TCP", port))
+	}
+	if (!noTLS || !noDTLS) && (cert == "") != (key == "") {
+		warnings = append(warnings, "both cert and pkey must be set for TLS/DTLS listeners")
+	}
+	if cert != "" && key != "" {
+		if !noTLS {
+			l := newListener("TURN-TLS", tlsPort)
+			l.Cert, l.Key = cert, key
+			c.Listeners = append(c.Listeners, l)
+		}
+		if !noDTLS {
+			l := newListener("TURN-DTLS", tlsPort)
+			l.Cert, l.Key = cert, key
+			c.Listeners = append(c.Listeners, l)
+		}
+	}
+	if len(c.Listeners) == 0 {
+		return nil, nil, errors.New("all listeners are disabled")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return c, warnings, nil
+}
+
+// parseCoturn parses the options from a coturn config file. Options are either flags ("no-udp")
+// or key-value pairs ("listening-port=3478" or "listening-port 3478"), optionally prefixed with
+// "--" as on the command line.
+func parseCoturn(r io.Reader) ([]coturnOption, error) {
+	opts := []coturnOption{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "--")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			key, value, _ = strings.Cut(line, " ")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		value = strings.Trim(value, `"`)
+
+		opts = append(opts, coturnOption{key: key, value: value, line: n})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read coturn config: %w", err)
+	}
+
+	return opts, nil
+}
+
+func coturnPort(o coturnOption) (int, error) {
+	p, err := strconv.Atoi(o.value)
+	if err != nil || p <= 0 || p > 65535 {
+		return 0, fmt.Errorf("line %d: invalid port for %s: %q", o.line, o.key, o.value)
+	}
+	return p, nil
+}
+
+// readCoturnFile reads a PEM file and returns it in the base64-encoded form used in STUNner
+// listener configs.
+func readCoturnFile(o coturnOption) (string, error) {
+	b, err := os.ReadFile(o.value)
+	if err != nil {
+		return "", fmt.Errorf("line %d: could not read %s file: %w", o.line, o.key, err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// coturnPeerRange converts a coturn peer range (a single IP address or a range in the form
+// "<start>-<end>") into a list of endpoint prefixes.
+func coturnPeerRange(o coturnOption) ([]string, error) {
+	from, to, isRange := strings.Cut(o.value, "-")
+	start, err := netip.ParseAddr(strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("line %d: invalid peer address %q", o.line, o.value)
+	}
+	if !isRange {
+		return []string{start.String()}, nil
+	}
+
+	end, err := netip.ParseAddr(strings.TrimSpace(to))
+	if err != nil || start.Is4() != end.Is4() || end.Less(start) {
+		return nil, fmt.Errorf("line %d: invalid peer range %q", o.line, o.value)
+	}
+
+	ret := []string{}
+	for _, p := range rangeToPrefixes(start, end) {
+		if p.IsSingleIP() {
+			ret = append(ret, p.Addr().String())
+		} else {
+			ret = append(ret, p.String())
+		}
+	}
+	return ret, nil
+}
+
+// rangeToPrefixes returns the minimal list of prefixes that cover an address range.
+func rangeToPrefixes(start, end netip.Addr) []netip.Prefix {
+	ret := []netip.Prefix{}
+	for {
+		// find the largest prefix starting at start and not extending beyond end
+		var p netip.Prefix
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			q := netip.PrefixFrom(start, bits)
+			if q.Masked().Addr() == start && !end.Less(lastAddr(q)) {
+				p = q
+				break
+			}
+		}
+		ret = append(ret, p)
+
+		last := lastAddr(p)
+		if last == end {
+			return ret
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr returns the last address in a prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	a := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(a)*8; i++ {
+		a[i/8] |= 1 << (7 - i%8)
+	}
+	ret, _ := netip.AddrFromSlice(a)
+	return ret
+}
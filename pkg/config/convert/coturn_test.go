@@ -0,0 +1,133 @@
+package convert
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+func TestCoturnConvert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, []byte("test-cert"), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, []byte("test-key"), 0o600))
+	cert := base64.StdEncoding.EncodeToString([]byte("test-cert"))
+	key := base64.StdEncoding.EncodeToString([]byte("test-key"))
+
+	t.Run("static auth", func(t *testing.T) {
+		conf := `# coturn config
+listening-port=3479
+listening-ip=10.0.0.1
+external-ip=1.2.3.4/10.0.0.1
+realm=example.com
+server-name=my-turn
+fingerprint
+lt-cred-mech
+user=user1:pass1
+user=user2:pass2
+allowed-peer-ip=10.1.0.0-10.1.255.255
+allowed-peer-ip=10.2.0.1
+user-quota=10
+stale-nonce=300
+prometheus
+min-port=49152
+`
+		c, warnings, err := FromCoturn(strings.NewReader(conf))
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 2, "warnings: user2, min-port")
+
+		assert.Equal(t, "my-turn", c.Admin.Name)
+		assert.Equal(t, 10, c.Admin.UserQuota)
+		assert.Equal(t, "http://:9641/metrics", c.Admin.MetricsEndpoint)
+
+		assert.Equal(t, "static", c.Auth.Type)
+		assert.Equal(t, "example.com", c.Auth.Realm)
+		assert.Equal(t, 300, c.Auth.NonceTTL)
+		assert.Equal(t, "user1", c.Auth.Credentials["username"])
+		assert.Equal(t, "pass1", c.Auth.Credentials["password"])
+
+		assert.Len(t, c.Clusters, 1)
+		assert.Equal(t, "allowed-peers", c.Clusters[0].Name)
+		assert.Equal(t, []string{"10.1.0.0/16", "10.2.0.1"}, c.Clusters[0].Endpoints)
+
+		assert.Len(t, c.Listeners, 2)
+		for i, proto := range []string{"TURN-UDP", "TURN-TCP"} {
+			l := c.Listeners[i]
+			assert.Equal(t, proto, l.Protocol)
+			assert.Equal(t, "10.0.0.1", l.Addr)
+			assert.Equal(t, 3479, l.Port)
+			assert.Equal(t, "1.2.3.4", l.PublicAddr)
+			assert.Equal(t, 3479, l.PublicPort)
+			assert.Equal(t, []string{"allowed-peers"}, l.Routes)
+		}
+	})
+
+	t.Run("ephemeral auth with TLS", func(t *testing.T) {
+		conf := `--use-auth-secret
+--static-auth-secret="my-secret"
+no-udp
+no-tcp
+no-dtls
+tls-listening-port 5350
+cert=` + certFile + `
+pkey=` + keyFile + `
+`
+		c, warnings, err := FromCoturn(strings.NewReader(conf))
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1, "warnings: no allowed peers")
+
+		assert.Equal(t, "ephemeral", c.Auth.Type)
+		assert.Equal(t, stnrv1.DefaultRealm, c.Auth.Realm)
+		assert.Equal(t, "my-secret", c.Auth.Credentials["secret"])
+
+		assert.Len(t, c.Clusters, 1)
+		assert.Equal(t, "allow-any", c.Clusters[0].Name)
+		assert.Equal(t, []string{"0.0.0.0/0"}, c.Clusters[0].Endpoints)
+
+		assert.Len(t, c.Listeners, 1)
+		assert.Equal(t, "TURN-TLS", c.Listeners[0].Protocol)
+		assert.Equal(t, 5350, c.Listeners[0].Port)
+		assert.Equal(t, cert, c.Listeners[0].Cert)
+		assert.Equal(t, key, c.Listeners[0].Key)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for name, conf := range map[string]string{
+			"no credentials":     "listening-port=3478\n",
+			"secret in db":       "use-auth-secret\n",
+			"hashed password":    "user=user1:0x1234\n",
+			"invalid port":       "listening-port=dummy\nno-auth\n",
+			"invalid peer":       "allowed-peer-ip=dummy\nno-auth\n",
+			"invalid range":      "allowed-peer-ip=10.0.0.2-10.0.0.1\nno-auth\n",
+			"missing cert":       "cert=/nonexistent.pem\nno-auth\n",
+			"no listeners":       "no-udp\nno-tcp\nno-auth\n",
+			"invalid user quota": "user-quota=x\nno-auth\n",
+		} {
+			_, _, err := FromCoturn(strings.NewReader(conf))
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestCoturnPeerRange(t *testing.T) {
+	for _, tc := range []struct {
+		peer     string
+		prefixes []string
+	}{
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"10.0.0.0-10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.1-10.0.0.6", []string{"10.0.0.1", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6"}},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+		{"2001:db8::-2001:db8::ffff", []string{"2001:db8::/112"}},
+	} {
+		ps, err := coturnPeerRange(coturnOption{key: "allowed-peer-ip", value: tc.peer})
+		assert.NoError(t, err, tc.peer)
+		assert.Equal(t, tc.prefixes, ps, tc.peer)
+	}
+}
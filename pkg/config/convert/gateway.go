@@ -0,0 +1,374 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/stunner/internal/endpoint"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+const (
+	gatewayAPIVersion    = "gateway.networking.k8s.io/v1"
+	stunnerAPIVersion    = "stunner.l7mp.io/v1"
+	stunnerAPIGroup      = "stunner.l7mp.io"
+	stunnerControllerStr = "stunner.l7mp.io/gateway-operator"
+
+	// GatewayClassName is the name of the GatewayClass generated by ToGatewayAPI.
+	GatewayClassName = "stunner-gatewayclass"
+	// GatewayConfigName is the name of the GatewayConfig generated by ToGatewayAPI.
+	GatewayConfigName = "stunner-gatewayconfig"
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// Manifest is a Kubernetes resource in an unstructured form.
+type Manifest map[string]any
+
+// ToGatewayAPI converts a STUNner configuration into the Kubernetes manifests that make the STUNner
+// gateway operator render the same configuration, in order to help users graduate from the
+// standalone mode to the managed mode. The following resources are generated, in this order:
+//
+//   - a GatewayClass and a GatewayConfig, with the realm, the log level and the static or
+//     ephemeral auth credentials inlined from the STUNner config,
+//   - a Gateway named after the STUNner instance with a listener for each protocol of each STUNner
+//     listener (the first public address of the listeners is set as the address of the Gateway)
+//     and a TLS Secret for each TURN-TLS and TURN-DTLS listener,
+//   - a StaticService for each group of endpoints with the same port range of each STATIC
+//     cluster,
+//   - an UDPRoute for each cluster, attached to the listeners that route to the cluster, with a
+//     backend for each StaticService or, for STRICT_DNS clusters, for each Kubernetes Service
+//     (given as "<name>.<namespace>.svc[.<cluster-domain>]").
+//
+// All namespaced resources are created in the given namespace. Settings that have no Gateway API
+// counterpart are reported in the returned list of warnings.
+func ToGatewayAPI(conf *stnrv1.StunnerConfig, namespace string) ([]Manifest, []string, error) {
+	c := conf.DeepCopy()
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	warnings := []string{}
+	warn := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	gwName := resourceName(c.Admin.Name)
+	meta := func(name string) map[string]any {
+		return map[string]any{"name": name, "namespace": namespace}
+	}
+
+	// GatewayClass
+	ms := []Manifest{{
+		"apiVersion": gatewayAPIVersion,
+		"kind":       "GatewayClass",
+		"metadata":   map[string]any{"name": GatewayClassName},
+		"spec": map[string]any{
+			"controllerName": stunnerControllerStr,
+			"parametersRef": map[string]any{
+				"group":     stunnerAPIGroup,
+				"kind":      "GatewayConfig",
+				"name":      GatewayConfigName,
+				"namespace": namespace,
+			},
+		},
+	}}
+
+	// GatewayConfig
+	gwConfSpec := map[string]any{
+		"realm":    c.Auth.Realm,
+		"logLevel": c.Admin.LogLevel,
+	}
+	switch c.Auth.Type {
+	case stnrv1.AuthTypeStatic.String():
+		gwConfSpec["authType"] = c.Auth.Type
+		gwConfSpec["userName"] = c.Auth.Credentials["username"]
+		gwConfSpec["password"] = c.Auth.Credentials["password"]
+	case stnrv1.AuthTypeEphemeral.String():
+		gwConfSpec["authType"] = c.Auth.Type
+		gwConfSpec["sharedSecret"] = c.Auth.Credentials["secret"]
+	default:
+		warn("auth: %s authentication cannot be set in a GatewayConfig, configure the "+
+			"credentials manually", c.Auth.Type)
+	}
+	if c.Admin.UserQuota > 0 {
+		gwConfSpec["userQuota"] = c.Admin.UserQuota
+	}
+	if c.Admin.MetricsEndpoint != "" {
+		warn("admin: the metrics endpoint must be set in the Dataplane resource")
+	}
+	if c.Admin.OffloadEngine != "" && c.Admin.OffloadEngine != stnrv1.OffloadEngineNone.String() {
+		warn("admin: the offload engine must be set in the Dataplane resource")
+	}
+	ms = append(ms, Manifest{
+		"apiVersion": stunnerAPIVersion,
+		"kind":       "GatewayConfig",
+		"metadata":   meta(GatewayConfigName),
+		"spec":       gwConfSpec,
+	})
+
+	// Gateway and TLS secrets
+	listeners, secrets, transports := []any{}, []Manifest{}, map[string]bool{}
+	listenerNames := map[string][]string{} // STUNner listener name -> Gateway listener names
+	publicAddr := ""
+	for _, l := range c.Listeners {
+		// Gateway listeners have a single protocol: split multi-protocol listeners
+		protos, _ := stnrv1.NewListenerProtocols(l.Protocol)
+		for _, proto := range protos {
+			name := resourceName(l.Name)
+			if len(protos) > 1 {
+				name = resourceName(fmt.Sprintf("%s-%s", name, proto.String()))
+			}
+			listenerNames[l.Name] = append(listenerNames[l.Name], name)
+			gl := map[string]any{"name": name, "port": l.Port, "protocol": proto.String()}
+
+			if isTLS(proto) {
+				secretName := fmt.Sprintf("%s-%s-tls", gwName, name)
+				gl["tls"] = map[string]any{
+					"mode": "Terminate",
+					"certificateRefs": []any{map[string]any{
+						"kind": "Secret", "name": secretName, "namespace": namespace,
+					}},
+				}
+				// cert and key are already base64-encoded in the STUNner config
+				secrets = append(secrets, Manifest{
+					"apiVersion": "v1",
+					"kind":       "Secret",
+					"metadata":   meta(secretName),
+					"type":       "kubernetes.io/tls",
+					"data":       map[string]any{"tls.crt": l.Cert, "tls.key": l.Key},
+				})
+			}
+			if proto.IsDatagram() {
+				transports["udp"] = true
+			} else {
+				transports["tcp"] = true
+			}
+
+			listeners = append(listeners, gl)
+		}
+
+		if l.PublicAddr != "" {
+			if publicAddr == "" {
+				publicAddr = l.PublicAddr
+			} else if publicAddr != l.PublicAddr {
+				warn("listener %q: multiple public addresses are not supported in a Gateway, "+
+					"using %s", l.Name, publicAddr)
+			}
+		}
+		if l.PublicPort != 0 && l.PublicPort != l.Port {
+			warn("listener %q: public port %d differs from the listener port, set the "+
+				"\"stunner.l7mp.io/nodeport\" annotation on the Gateway manually", l.Name,
+				l.PublicPort)
+		}
+	}
+
+	gwMeta := meta(gwName)
+	if len(transports) > 1 {
+		gwMeta["annotations"] = map[string]any{"stunner.l7mp.io/enable-mixed-protocol-lb": "true"}
+	}
+	gwSpec := map[string]any{"gatewayClassName": GatewayClassName, "listeners": listeners}
+	if publicAddr != "" {
+		gwSpec["addresses"] = []any{map[string]any{"type": "IPAddress", "value": publicAddr}}
+	}
+	ms = append(ms, Manifest{
+		"apiVersion": gatewayAPIVersion,
+		"kind":       "Gateway",
+		"metadata":   gwMeta,
+		"spec":       gwSpec,
+	})
+	ms = append(ms, secrets...)
+
+	// StaticServices and UDPRoutes
+	for _, cl := range c.Clusters {
+		routeName := resourceName(cl.Name)
+		backends := []any{}
+		if len(cl.MirrorTo) > 0 {
+			warn("cluster %q: traffic mirroring has no Gateway API equivalent, ignoring",
+				cl.Name)
+		}
+		if len(cl.ActiveWindows) > 0 {
+			warn("cluster %q: active windows have no Gateway API equivalent, ignoring",
+				cl.Name)
+		}
+
+		switch cl.Type {
+		case stnrv1.ClusterTypeBlock.String():
+			// a route without backends would not block anything
+			warn("cluster %q: %s clusters have no Gateway API equivalent, ignoring",
+				cl.Name, cl.Type)
+			continue
+		case stnrv1.ClusterTypeStatic.String():
+			for _, t := range cl.Targets {
+				warn("cluster %q: remote cluster target %q has no Gateway API equivalent, "+
+					"ignoring", cl.Name, t.Name)
+			}
+			svcs, refs, err := staticServices(routeName, namespace, cl)
+			if err != nil {
+				return nil, nil, err
+			}
+			ms = append(ms, svcs...)
+			backends = append(backends, refs...)
+		case stnrv1.ClusterTypeStrictDNS.String():
+			for _, ep := range cl.Endpoints {
+				name, ns, ok := serviceFromDomain(ep)
+				if !ok {
+					warn("cluster %q: endpoint %q is not a Kubernetes service domain name, "+
+						"ignoring", cl.Name, ep)
+					continue
+				}
+				backends = append(backends, map[string]any{"name": name, "namespace": ns})
+			}
+		case stnrv1.ClusterTypeTURN.String():
+			warn("cluster %q: %s clusters have no Gateway API equivalent, ignoring",
+				cl.Name, cl.Type)
+			continue
+		case stnrv1.ClusterTypeConsul.String(), stnrv1.ClusterTypeEDS.String():
+			warn("cluster %q: %s clusters have no Gateway API equivalent, ignoring "+
+				"endpoints", cl.Name, cl.Type)
+		}
+
+		// attach the route to the listeners that route to the cluster, or to the whole
+		// Gateway if all listeners route to the cluster
+		parents, attached := []any{}, 0
+		for _, l := range c.Listeners {
+			if !contains(l.Routes, cl.Name) {
+				continue
+			}
+			attached++
+			for _, name := range listenerNames[l.Name] {
+				parents = append(parents, map[string]any{"name": gwName, "sectionName": name})
+			}
+		}
+		if attached == 0 {
+			warn("cluster %q: no listener routes to the cluster, ignoring", cl.Name)
+			continue
+		}
+		if attached == len(c.Listeners) {
+			parents = []any{map[string]any{"name": gwName}}
+		}
+
+		ms = append(ms, Manifest{
+			"apiVersion": stunnerAPIVersion,
+			"kind":       "UDPRoute",
+			"metadata":   meta(routeName),
+			"spec": map[string]any{
+				"parentRefs": parents,
+				"rules":      []any{map[string]any{"backendRefs": backends}},
+			},
+		})
+	}
+
+	return ms, warnings, nil
+}
+
+// MarshalManifests renders a list of manifests into a multi-document YAML.
+func MarshalManifests(ms []Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, m := range ms {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		out, err := yaml.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// staticServices generates a StaticService for each group of endpoints with the same port range
+// of a STATIC cluster, along with the backend refs pointing to the StaticServices.
+func staticServices(name, namespace string, cl stnrv1.ClusterConfig) ([]Manifest, []any, error) {
+	type portRange struct{ port, endPort int }
+	prefixes := map[portRange][]string{}
+	ranges := []portRange{}
+	for _, e := range cl.Endpoints {
+		ep, err := endpoint.Parse(e)
+		if err != nil {
+			return nil, nil, stnrv1.ErrInvalidCluster{Name: cl.Name, Reason: err.Error()}
+		}
+		pr := portRange{}
+		if port, endPort, ok := ep.PortRange(); ok {
+			pr = portRange{port, endPort}
+		}
+		if _, ok := prefixes[pr]; !ok {
+			ranges = append(ranges, pr)
+		}
+		prefixes[pr] = append(prefixes[pr], ep.Prefix())
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].port < ranges[j].port })
+
+	svcs, refs := []Manifest{}, []any{}
+	for i, pr := range ranges {
+		svcName := name
+		if len(ranges) > 1 {
+			svcName = fmt.Sprintf("%s-%d", name, i)
+		}
+		svcs = append(svcs, Manifest{
+			"apiVersion": stunnerAPIVersion,
+			"kind":       "StaticService",
+			"metadata":   map[string]any{"name": svcName, "namespace": namespace},
+			"spec":       map[string]any{"prefixes": prefixes[pr]},
+		})
+
+		ref := map[string]any{"group": stunnerAPIGroup, "kind": "StaticService", "name": svcName}
+		if pr.port != 0 {
+			ref["port"] = pr.port
+			ref["endPort"] = pr.endPort
+		}
+		refs = append(refs, ref)
+	}
+
+	return svcs, refs, nil
+}
+
+// serviceFromDomain returns the name and the namespace of a Kubernetes service from the domain
+// name of the service.
+func serviceFromDomain(domain string) (string, string, bool) {
+	parts := strings.Split(domain, ".")
+	if len(parts) < 3 || parts[2] != "svc" || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// resourceName converts a STUNner object name into a valid Kubernetes resource name. Names
+// generated by the gateway operator (e.g., "<namespace>/<gateway>/<listener>") are stripped down to
+// the last component.
+func resourceName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "stunner"
+	}
+	return name
+}
+
+func isTLS(proto stnrv1.ListenerProtocol) bool {
+	switch proto {
+	case stnrv1.ListenerProtocolTLS, stnrv1.ListenerProtocolDTLS, stnrv1.ListenerProtocolTURNTLS,
+		stnrv1.ListenerProtocolTURNDTLS:
+		return true
+	default:
+		return false
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+func TestGatewayAPIConvert(t *testing.T) {
+	c := &stnrv1.StunnerConfig{
+		ApiVersion: stnrv1.ApiVersion,
+		Admin:      stnrv1.AdminConfig{Name: "stunner/my-gateway", UserQuota: 5},
+		Auth: stnrv1.AuthConfig{
+			Type:        "ephemeral",
+			Realm:       "example.com",
+			Credentials: map[string]string{"secret": "my-secret"},
+		},
+		Listeners: []stnrv1.ListenerConfig{{
+			Name:       "stunner/my-gateway/udp-listener",
+			Protocol:   "TURN-UDP,TURN-TCP",
+			Port:       3478,
+			PublicAddr: "1.2.3.4",
+			Routes:     []string{"media", "external"},
+		}, {
+			Name:     "stunner/my-gateway/tls-listener",
+			Protocol: "TURN-TLS",
+			Port:     443,
+			Cert:     "Y2VydA==",
+			Key:      "a2V5",
+			Routes:   []string{"external"},
+		}},
+		Clusters: []stnrv1.ClusterConfig{{
+			Name:      "media",
+			Type:      "STRICT_DNS",
+			Endpoints: []string{"media-server.media.svc.cluster.local", "example.com"},
+		}, {
+			Name:      "external",
+			Type:      "STATIC",
+			Endpoints: []string{"10.0.0.0/8", "192.168.0.1:<1000-2000>", "192.168.1.0/24"},
+		}},
+	}
+
+	ms, warnings, err := ToGatewayAPI(c, "media-ns")
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1, "warnings: example.com")
+
+	kinds := []string{}
+	for _, m := range ms {
+		kinds = append(kinds, m["kind"].(string))
+	}
+	assert.Equal(t, []string{"GatewayClass", "GatewayConfig", "Gateway", "Secret", "UDPRoute",
+		"StaticService", "StaticService", "UDPRoute"}, kinds)
+
+	// GatewayConfig
+	spec := ms[1]["spec"].(map[string]any)
+	assert.Equal(t, "ephemeral", spec["authType"])
+	assert.Equal(t, "my-secret", spec["sharedSecret"])
+	assert.Equal(t, "example.com", spec["realm"])
+	assert.Equal(t, 5, spec["userQuota"])
+
+	// Gateway
+	gw := ms[2]
+	assert.Equal(t, "my-gateway", gw["metadata"].(map[string]any)["name"])
+	assert.Equal(t, "media-ns", gw["metadata"].(map[string]any)["namespace"])
+	spec = gw["spec"].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"type": "IPAddress", "value": "1.2.3.4"}}, spec["addresses"])
+	listeners := spec["listeners"].([]any)
+	assert.Len(t, listeners, 3)
+	assert.Equal(t, "udp-listener-turn-udp", listeners[0].(map[string]any)["name"])
+	assert.Equal(t, "TURN-TCP", listeners[1].(map[string]any)["protocol"])
+	assert.Contains(t, listeners[2].(map[string]any), "tls")
+
+	// TLS secret
+	assert.Equal(t, map[string]any{"tls.crt": "Y2VydA==", "tls.key": "a2V5"}, ms[3]["data"])
+
+	// STRICT_DNS cluster: attached to the UDP/TCP listeners
+	spec = ms[4]["spec"].(map[string]any)
+	assert.Len(t, spec["parentRefs"], 2)
+	assert.Equal(t, []any{map[string]any{"backendRefs": []any{
+		map[string]any{"name": "media-server", "namespace": "media"}}}}, spec["rules"])
+
+	// STATIC cluster: attached to all listeners
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.0/24"},
+		ms[5]["spec"].(map[string]any)["prefixes"])
+	assert.Equal(t, []string{"192.168.0.1/32"}, ms[6]["spec"].(map[string]any)["prefixes"])
+	spec = ms[7]["spec"].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"name": "my-gateway"}}, spec["parentRefs"])
+	backends := spec["rules"].([]any)[0].(map[string]any)["backendRefs"].([]any)
+	assert.Len(t, backends, 2)
+	assert.Equal(t, 1000, backends[1].(map[string]any)["port"])
+	assert.Equal(t, 2000, backends[1].(map[string]any)["endPort"])
+
+	out, err := MarshalManifests(ms)
+	assert.NoError(t, err)
+	assert.Equal(t, len(ms)-1, strings.Count(string(out), "---\n"))
+
+	// invalid config
+	c.Auth.Credentials = map[string]string{}
+	_, _, err = ToGatewayAPI(c, "media-ns")
+	assert.Error(t, err)
+}
@@ -0,0 +1,324 @@
+// Package validate implements the semantic checks STUNner performs on a configuration before
+// applying it, as pure functions that do not need a running daemon. This allows admission
+// webhooks and controllers to reject a bad configuration before it reaches the dataplane.
+package validate
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/l7mp/stunner/internal/endpoint"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// placeholders are resolved from the environment of the dataplane at reconciliation time
+var placeholderRe = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// Config performs all the checks a STUNner daemon would perform when reconciling a configuration
+// and returns an error that joins all the problems found, or nil if the configuration is accepted.
+// The configuration is not modified.
+func Config(conf *stnrv1.StunnerConfig) error {
+	c := conf.DeepCopy()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	errs := []error{}
+	listeners := map[string]bool{}
+	ports := map[string]string{}
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		if listeners[l.Name] {
+			errs = append(errs, fmt.Errorf("duplicate listener name %q", l.Name))
+		}
+		listeners[l.Name] = true
+
+		if err := listener(l); err != nil {
+			errs = append(errs, fmt.Errorf("listener %q: %w", l.Name, err))
+		}
+
+		// listeners always bind to the wildcard address
+		protos, _ := stnrv1.NewListenerProtocols(l.Protocol)
+		for _, p := range protos {
+			transport := "tcp"
+			if p.IsDatagram() {
+				transport = "udp"
+			}
+			k := fmt.Sprintf("%s/%d", transport, l.Port)
+			if other, ok := ports[k]; ok && other != l.Name {
+				errs = append(errs, fmt.Errorf("listener %q: port %s already in use by "+
+					"listener %q", l.Name, k, other))
+			}
+			ports[k] = l.Name
+		}
+	}
+
+	clusters := map[string]bool{}
+	for _, cl := range c.Clusters {
+		if clusters[cl.Name] {
+			errs = append(errs, fmt.Errorf("duplicate cluster name %q", cl.Name))
+		}
+		clusters[cl.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// Admin checks an admin configuration.
+func Admin(conf *stnrv1.AdminConfig) error {
+	c := stnrv1.AdminConfig{}
+	conf.DeepCopyInto(&c)
+	return c.Validate()
+}
+
+// Auth checks an authentication configuration.
+func Auth(conf *stnrv1.AuthConfig) error {
+	c := stnrv1.AuthConfig{}
+	conf.DeepCopyInto(&c)
+	return c.Validate()
+}
+
+// Listener checks a listener configuration.
+func Listener(conf *stnrv1.ListenerConfig) error {
+	c := stnrv1.ListenerConfig{}
+	conf.DeepCopyInto(&c)
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return listener(&c)
+}
+
+// Cluster checks a cluster configuration.
+func Cluster(conf *stnrv1.ClusterConfig) error {
+	c := stnrv1.ClusterConfig{}
+	conf.DeepCopyInto(&c)
+	return c.Validate()
+}
+
+// Reasons of the configuration warnings.
+const (
+	ReasonNoListeners        = "NoListeners"
+	ReasonNoClusters         = "NoClusters"
+	ReasonNoRoutes           = "NoRoutes"
+	ReasonNonexistentCluster = "NonexistentCluster"
+	ReasonDuplicateRoute     = "DuplicateRoute"
+	ReasonShadowedRoute      = "ShadowedRoute"
+	ReasonOpenRelay          = "OpenRelay"
+	ReasonDeprecated         = "Deprecated"
+	ReasonOwnershipConflict  = "OwnershipConflict"
+)
+
+// Warnings returns the problems in a configuration that do not prevent it from being applied but
+// are probably not intended, like deprecated settings, listeners without routes, routes to
+// nonexistent clusters, shadowed routes, or clusters that admit any peer. The configuration is not
+// modified.
+func Warnings(conf *stnrv1.StunnerConfig) []stnrv1.ConfigWarning {
+	ret := []stnrv1.ConfigWarning{}
+	if len(conf.Listeners) == 0 {
+		ret = append(ret, stnrv1.ConfigWarning{Reason: ReasonNoListeners,
+			Message: "no listeners: gateway unreachable"})
+	}
+	if len(conf.Clusters) == 0 {
+		ret = append(ret, stnrv1.ConfigWarning{Reason: ReasonNoClusters,
+			Message: "no clusters: TURN forwarding to peers not permitted"})
+	}
+
+	ret = append(ret, DeprecationWarnings(conf.Deprecated())...)
+
+	clusters := map[string]bool{}
+	for _, c := range conf.Clusters {
+		clusters[c.Name] = true
+	}
+	for _, l := range conf.Listeners {
+		if len(l.Routes) == 0 {
+			ret = append(ret, stnrv1.ConfigWarning{Kind: "listener", Name: l.Name,
+				Reason: ReasonNoRoutes, Message: "no routes: no peer can be reached via the listener"})
+		}
+		for _, r := range l.Routes {
+			if !clusters[r] {
+				ret = append(ret, stnrv1.ConfigWarning{Kind: "listener", Name: l.Name,
+					Reason:  ReasonNonexistentCluster,
+					Message: fmt.Sprintf("route to nonexistent cluster %q", r)})
+			}
+		}
+	}
+
+	ret = append(ret, ShadowedRoutes(conf)...)
+
+	for _, c := range conf.Clusters {
+		t := stnrv1.ClusterTypeStatic
+		if c.Type != "" {
+			t, _ = stnrv1.NewClusterType(c.Type)
+		}
+		if t != stnrv1.ClusterTypeStatic && t != stnrv1.ClusterTypeTURN {
+			continue
+		}
+		for _, e := range c.Endpoints {
+			ep, err := endpoint.Parse(e)
+			if err != nil {
+				continue
+			}
+			if _, _, ok := ep.PortRange(); ok {
+				continue
+			}
+			if p := ep.Prefix(); p == "0.0.0.0/0" || p == "::/0" {
+				ret = append(ret, stnrv1.ConfigWarning{Kind: "cluster", Name: c.Name,
+					Reason: ReasonOpenRelay,
+					Message: fmt.Sprintf("endpoint %q admits any peer: the gateway may be "+
+						"used as an open relay", e)})
+			}
+		}
+	}
+
+	return ret
+}
+
+// DeprecationWarnings converts deprecations into configuration warnings.
+func DeprecationWarnings(ds []stnrv1.Deprecation) []stnrv1.ConfigWarning {
+	ret := []stnrv1.ConfigWarning{}
+	for _, d := range ds {
+		ret = append(ret, stnrv1.ConfigWarning{Reason: ReasonDeprecated, Message: d.String()})
+	}
+	return ret
+}
+
+// ShadowedRoutes returns a warning for each route rule that can never take effect. When the
+// clusters a listener routes to overlap, BLOCK clusters beat the clusters that admit a peer, the
+// longest matching endpoint prefix wins otherwise, and ties are broken by the order of the routes.
+// Accordingly, an endpoint of a STATIC cluster is shadowed if a BLOCK cluster of the listener
+// covers all its addresses and ports, or if a cluster earlier in the routes has an endpoint with
+// the same prefix. Duplicate routes are reported as well.
+func ShadowedRoutes(conf *stnrv1.StunnerConfig) []stnrv1.ConfigWarning {
+	type rule struct {
+		cluster string
+		block   bool
+		ep      *endpoint.Endpoint
+		raw     string
+	}
+
+	ret := []stnrv1.ConfigWarning{}
+	for _, l := range conf.Listeners {
+		rules, seen := []rule{}, map[string]bool{}
+		for _, r := range l.Routes {
+			if seen[r] {
+				ret = append(ret, stnrv1.ConfigWarning{Kind: "listener", Name: l.Name,
+					Reason:  ReasonDuplicateRoute,
+					Message: fmt.Sprintf("duplicate route to cluster %q", r)})
+				continue
+			}
+			seen[r] = true
+
+			c, err := conf.GetClusterConfig(r)
+			if err != nil {
+				continue
+			}
+			t := stnrv1.ClusterTypeStatic
+			if c.Type != "" {
+				t, _ = stnrv1.NewClusterType(c.Type)
+			}
+			if t != stnrv1.ClusterTypeStatic && t != stnrv1.ClusterTypeBlock &&
+				t != stnrv1.ClusterTypeTURN {
+				continue
+			}
+			eps := append([]string{}, c.Endpoints...)
+			for _, target := range c.Targets {
+				eps = append(eps, target.Endpoints...)
+			}
+			for _, e := range eps {
+				if ep, err := endpoint.Parse(e); err == nil {
+					rules = append(rules, rule{cluster: r,
+						block: t == stnrv1.ClusterTypeBlock, ep: ep, raw: e})
+				}
+			}
+		}
+
+		for i, r := range rules {
+			if r.block {
+				continue
+			}
+			for j, other := range rules {
+				if other.cluster == r.cluster {
+					continue
+				}
+				if (other.block && other.ep.Covers(r.ep)) ||
+					(!other.block && j < i && other.ep.Prefix() == r.ep.Prefix()) {
+					ret = append(ret, stnrv1.ConfigWarning{Kind: "listener", Name: l.Name,
+						Reason: ReasonShadowedRoute,
+						Message: fmt.Sprintf("endpoint %q of cluster %q is shadowed by "+
+							"cluster %q", r.raw, r.cluster, other.cluster)})
+					break
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+// OwnershipConflicts returns a warning for each listener and cluster owned by a manager in the
+// running configuration that the new configuration would take over (the object has a different
+// manager in the new configuration) or delete (the new configuration is issued by a different
+// manager and omits the object). Unowned objects never conflict. Both configurations must be
+// validated.
+func OwnershipConflicts(running, conf *stnrv1.StunnerConfig) []stnrv1.ConfigWarning {
+	ret := []stnrv1.ConfigWarning{}
+	check := func(kind, name, owner, newOwner string, found bool) {
+		switch {
+		case owner == "":
+		case found && newOwner != owner:
+			ret = append(ret, stnrv1.ConfigWarning{Kind: kind, Name: name,
+				Reason: ReasonOwnershipConflict,
+				Message: fmt.Sprintf("%s owned by %q would be taken over by %q", kind, owner,
+					newOwner)})
+		case !found && conf.Admin.ManagedBy != owner:
+			ret = append(ret, stnrv1.ConfigWarning{Kind: kind, Name: name,
+				Reason: ReasonOwnershipConflict,
+				Message: fmt.Sprintf("%s owned by %q would be deleted by %q", kind, owner,
+					conf.Admin.ManagedBy)})
+		}
+	}
+
+	for _, l := range running.Listeners {
+		n, err := conf.GetListenerConfig(l.Name)
+		check("listener", l.Name, l.ManagedBy, n.ManagedBy, err == nil)
+	}
+	for _, c := range running.Clusters {
+		n, err := conf.GetClusterConfig(c.Name)
+		check("cluster", c.Name, c.ManagedBy, n.ManagedBy, err == nil)
+	}
+
+	return ret
+}
+
+// listener checks a validated listener configuration.
+func listener(l *stnrv1.ListenerConfig) error {
+	if !placeholderRe.MatchString(l.Addr) && l.Addr != "localhost" && net.ParseIP(l.Addr) == nil {
+		return fmt.Errorf("invalid listener address: %s", l.Addr)
+	}
+
+	protos, _ := stnrv1.NewListenerProtocols(l.Protocol)
+	for _, p := range protos {
+		switch p {
+		case stnrv1.ListenerProtocolTURNTLS, stnrv1.ListenerProtocolTURNDTLS,
+			stnrv1.ListenerProtocolTLS, stnrv1.ListenerProtocolDTLS:
+			cert, err := base64.StdEncoding.DecodeString(l.Cert)
+			if err != nil {
+				return fmt.Errorf("invalid TLS certificate: base64-decode error: %w", err)
+			}
+			key, err := base64.StdEncoding.DecodeString(l.Key)
+			if err != nil {
+				return fmt.Errorf("invalid TLS key: base64-decode error: %w", err)
+			}
+			if _, err := tls.X509KeyPair(cert, key); err != nil {
+				return fmt.Errorf("invalid TLS cert/key pair: %w", err)
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
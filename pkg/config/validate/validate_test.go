@@ -0,0 +1,247 @@
+package validate
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+func testConfig() *stnrv1.StunnerConfig {
+	return &stnrv1.StunnerConfig{
+		ApiVersion: stnrv1.ApiVersion,
+		Admin:      stnrv1.AdminConfig{Name: "testdataplane"},
+		Auth: stnrv1.AuthConfig{
+			Type:        "static",
+			Credentials: map[string]string{"username": "user", "password": "pass"},
+		},
+		Listeners: []stnrv1.ListenerConfig{{
+			Name:     "udp",
+			Protocol: "turn-udp",
+			Addr:     "127.0.0.1",
+			Port:     3478,
+			Routes:   []string{"allow-any"},
+		}, {
+			Name:     "tcp",
+			Protocol: "turn-tcp",
+			Addr:     "${POD_IP}",
+			Port:     3478,
+			Routes:   []string{"allow-any"},
+		}},
+		Clusters: []stnrv1.ClusterConfig{{
+			Name:      "allow-any",
+			Type:      "STATIC",
+			Endpoints: []string{"0.0.0.0/0"},
+		}},
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mod     func(c *stnrv1.StunnerConfig)
+		wantErr string
+	}{
+		{
+			name: "valid",
+			mod:  func(c *stnrv1.StunnerConfig) {},
+		},
+		{
+			name:    "wrong api version",
+			mod:     func(c *stnrv1.StunnerConfig) { c.ApiVersion = "dummy" },
+			wantErr: "unsupported API version",
+		},
+		{
+			name:    "duplicate listener name",
+			mod:     func(c *stnrv1.StunnerConfig) { c.Listeners[1].Name = "udp" },
+			wantErr: `duplicate listener name "udp"`,
+		},
+		{
+			name:    "port conflict",
+			mod:     func(c *stnrv1.StunnerConfig) { c.Listeners[1].Protocol = "turn-udp" },
+			wantErr: `port udp/3478 already in use by listener "udp"`,
+		},
+		{
+			name:    "invalid address",
+			mod:     func(c *stnrv1.StunnerConfig) { c.Listeners[0].Addr = "dummy" },
+			wantErr: "invalid listener address: dummy",
+		},
+		{
+			name: "invalid TLS cert",
+			mod: func(c *stnrv1.StunnerConfig) {
+				c.Listeners[1].Protocol = "turn-tls"
+				c.Listeners[1].Cert = base64.StdEncoding.EncodeToString([]byte("dummy-cert"))
+				c.Listeners[1].Key = base64.StdEncoding.EncodeToString([]byte("dummy-key"))
+			},
+			wantErr: "invalid TLS cert/key pair",
+		},
+		{
+			name: "TLS cert not base64-encoded",
+			mod: func(c *stnrv1.StunnerConfig) {
+				c.Listeners[1].Protocol = "turn-tls"
+				c.Listeners[1].Cert = "%"
+				c.Listeners[1].Key = "%"
+			},
+			wantErr: "invalid TLS certificate",
+		},
+		{
+			name:    "duplicate cluster name",
+			mod:     func(c *stnrv1.StunnerConfig) { c.Clusters = append(c.Clusters, c.Clusters[0]) },
+			wantErr: `duplicate cluster name "allow-any"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testConfig()
+			tc.mod(c)
+			orig := testConfig()
+			tc.mod(orig)
+
+			err := Config(c)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+			assert.Equal(t, orig, c, "input config unchanged")
+		})
+	}
+}
+
+func TestValidateObjects(t *testing.T) {
+	c := testConfig()
+	assert.NoError(t, Admin(&c.Admin))
+	assert.NoError(t, Auth(&c.Auth))
+	assert.NoError(t, Listener(&c.Listeners[0]))
+	assert.NoError(t, Cluster(&c.Clusters[0]))
+	assert.Equal(t, testConfig(), c, "input config unchanged")
+
+	assert.Error(t, Auth(&stnrv1.AuthConfig{Type: "dummy"}))
+	assert.ErrorContains(t, Listener(&stnrv1.ListenerConfig{Name: "l", Addr: "dummy"}),
+		"invalid listener address")
+	assert.Error(t, Cluster(&stnrv1.ClusterConfig{Name: "c", Type: "dummy"}))
+	assert.NoError(t, Cluster(&stnrv1.ClusterConfig{Name: "c",
+		ActiveWindows: []string{"Mon-Fri 09:00-17:00"}, Timezone: "UTC"}))
+	assert.ErrorContains(t, Cluster(&stnrv1.ClusterConfig{Name: "c",
+		ActiveWindows: []string{"Mon-Fri 9-17"}}), "invalid")
+	assert.ErrorContains(t, Cluster(&stnrv1.ClusterConfig{Name: "c",
+		ActiveWindows: []string{"09:00-17:00"}, Timezone: "Dummy/Dummy"}), "invalid timezone")
+	assert.Error(t, Cluster(&stnrv1.ClusterConfig{Name: "c", Type: "BLOCK",
+		ActiveWindows: []string{"09:00-17:00"}}))
+}
+
+func warnings(ws []stnrv1.ConfigWarning) []string {
+	ret := []string{}
+	for _, w := range ws {
+		ret = append(ret, w.String())
+	}
+	return ret
+}
+
+func TestValidateWarnings(t *testing.T) {
+	openRelay := `cluster "allow-any": endpoint "0.0.0.0/0" admits any peer: the gateway may be used as an open relay`
+
+	c := testConfig()
+	ws := Warnings(c)
+	assert.Equal(t, []string{openRelay}, warnings(ws))
+	assert.Equal(t, ReasonOpenRelay, ws[0].Reason)
+	assert.Equal(t, "cluster", ws[0].Kind)
+	assert.Equal(t, "allow-any", ws[0].Name)
+
+	c.Listeners[0].Routes = []string{"dummy"}
+	assert.Equal(t, []string{`listener "udp": route to nonexistent cluster "dummy"`, openRelay},
+		warnings(Warnings(c)))
+
+	// port ranges are not reported
+	c.Clusters[0].Endpoints = []string{"0.0.0.0/0:<10000-20000>", "::/0"}
+	assert.Equal(t, []string{
+		`listener "udp": route to nonexistent cluster "dummy"`,
+		`cluster "allow-any": endpoint "::/0" admits any peer: the gateway may be used as an open relay`,
+	}, warnings(Warnings(c)))
+
+	c = testConfig()
+	c.Clusters[0].Endpoints = []string{"10.0.0.0/8"}
+	c.Auth.Type = "plaintext"
+	c.Listeners[1].Routes = nil
+	ws = Warnings(c)
+	assert.Equal(t, []string{
+		`auth.type: value "plaintext" is deprecated in API version v1, use "static" (removed in v1beta1)`,
+		`listener "tcp": no routes: no peer can be reached via the listener`,
+	}, warnings(ws))
+	assert.Equal(t, ReasonDeprecated, ws[0].Reason)
+	assert.Equal(t, ReasonNoRoutes, ws[1].Reason)
+
+	// warnings are no errors
+	assert.NoError(t, Config(c))
+
+	c = &stnrv1.StunnerConfig{ApiVersion: stnrv1.ApiVersion}
+	ws = Warnings(c)
+	assert.Len(t, ws, 2)
+	assert.Equal(t, ReasonNoListeners, ws[0].Reason)
+	assert.Equal(t, ReasonNoClusters, ws[1].Reason)
+}
+
+func TestValidateShadowedRoutes(t *testing.T) {
+	c := testConfig()
+	c.Listeners[0].Routes = []string{"allow-any", "media", "blocklist", "media"}
+	c.Clusters = append(c.Clusters, stnrv1.ClusterConfig{
+		Name:      "media",
+		Type:      "STATIC",
+		Endpoints: []string{"0.0.0.0/0", "10.0.0.0/8", "1.2.3.4:<1-1024>"},
+	}, stnrv1.ClusterConfig{
+		Name:      "blocklist",
+		Type:      "BLOCK",
+		Endpoints: []string{"1.2.3.0/24"},
+	})
+	ws := ShadowedRoutes(c)
+	assert.Equal(t, []string{
+		`listener "udp": duplicate route to cluster "media"`,
+		`listener "udp": endpoint "0.0.0.0/0" of cluster "media" is shadowed by cluster "allow-any"`,
+		`listener "udp": endpoint "1.2.3.4:<1-1024>" of cluster "media" is shadowed by cluster "blocklist"`,
+	}, warnings(ws))
+	assert.Equal(t, ReasonDuplicateRoute, ws[0].Reason)
+	assert.Equal(t, ReasonShadowedRoute, ws[1].Reason)
+	// plus the open relay warnings for the allow-any and media clusters
+	assert.Len(t, Warnings(c), 5)
+
+	// longer prefixes and BLOCK clusters covering only some ports do not shadow
+	c.Clusters[2].Endpoints = []string{"1.2.3.0/24:<1-100>"}
+	c.Listeners[0].Routes = []string{"media", "allow-any", "blocklist"}
+	assert.Equal(t, []string{
+		`listener "udp": endpoint "0.0.0.0/0" of cluster "allow-any" is shadowed by cluster "media"`,
+	}, warnings(ShadowedRoutes(c)))
+}
+
+func TestValidateOwnershipConflicts(t *testing.T) {
+	running := testConfig()
+	running.Admin.ManagedBy = "operator"
+	assert.NoError(t, running.Validate())
+	assert.Equal(t, "operator", running.Listeners[0].ManagedBy)
+	assert.Equal(t, "operator", running.Clusters[0].ManagedBy)
+
+	// same manager: no conflict
+	c := testConfig()
+	c.Admin.ManagedBy = "operator"
+	c.Listeners = c.Listeners[:1]
+	assert.NoError(t, c.Validate())
+	assert.Empty(t, OwnershipConflicts(running, c))
+
+	// another manager takes over and deletes objects, objects keeping their owner are fine
+	c = testConfig()
+	c.Admin.ManagedBy = "api"
+	c.Listeners = c.Listeners[:1]
+	c.Clusters[0].ManagedBy = "operator"
+	assert.NoError(t, c.Validate())
+	ws := OwnershipConflicts(running, c)
+	assert.Equal(t, []string{
+		`listener "udp": listener owned by "operator" would be taken over by "api"`,
+		`listener "tcp": listener owned by "operator" would be deleted by "api"`,
+	}, warnings(ws))
+	assert.Equal(t, ReasonOwnershipConflict, ws[0].Reason)
+
+	// unowned objects never conflict
+	running = testConfig()
+	assert.NoError(t, running.Validate())
+	assert.Empty(t, OwnershipConflicts(running, c))
+}
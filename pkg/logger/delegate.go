@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/pion/logging"
+)
+
+// DelegatingLoggerFactory wraps the logger factory of a host application that embeds STUNner, so
+// that log routing and levels are controlled by the host: loggers are created by the host
+// factory, while setting the loglevel or the writer is a no-op.
+type DelegatingLoggerFactory struct {
+	logging.LoggerFactory
+}
+
+// NewDelegatingLoggerFactory creates a LoggerFactory that delegates to the logger factory of the
+// host application.
+func NewDelegatingLoggerFactory(f logging.LoggerFactory) *DelegatingLoggerFactory {
+	return &DelegatingLoggerFactory{LoggerFactory: f}
+}
+
+// SetLevel is a no-op: loglevels are controlled by the host application.
+func (f *DelegatingLoggerFactory) SetLevel(levelSpec string) {}
+
+// GetLevel returns an empty string since loglevels are controlled by the host application.
+func (f *DelegatingLoggerFactory) GetLevel(scope string) string { return "" }
+
+// SetWriter is a no-op: log routing is controlled by the host application.
+func (f *DelegatingLoggerFactory) SetWriter(w io.Writer) {}
+
+// LogrLoggerFactory is a logger factory that emits pion loggers writing to a logr.Logger, for
+// host applications using logr-based logging (e.g., controller-runtime). Each scope is logged as
+// a named logger. ERROR logs are emitted with Error, WARN and INFO logs at verbosity level 0,
+// DEBUG logs at level 1 and TRACE logs at level 2, so the loglevels are controlled by the logr
+// sink of the host application.
+type LogrLoggerFactory struct {
+	logr.Logger
+}
+
+// NewLogrLoggerFactory creates a logger factory writing to a logr.Logger.
+func NewLogrLoggerFactory(l logr.Logger) *LogrLoggerFactory {
+	return &LogrLoggerFactory{Logger: l}
+}
+
+// NewLogger creates a logger for the given scope.
+func (f *LogrLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return &logrLogger{log: f.Logger.WithName(scope)}
+}
+
+// logrLogger adapts a logr.Logger to the pion LeveledLogger interface.
+type logrLogger struct {
+	log logr.Logger
+}
+
+func (l *logrLogger) Trace(msg string) { l.log.V(2).Info(msg) }
+func (l *logrLogger) Tracef(format string, args ...any) {
+	l.log.V(2).Info(fmt.Sprintf(format, args...))
+}
+func (l *logrLogger) Debug(msg string) { l.log.V(1).Info(msg) }
+func (l *logrLogger) Debugf(format string, args ...any) {
+	l.log.V(1).Info(fmt.Sprintf(format, args...))
+}
+func (l *logrLogger) Info(msg string) { l.log.Info(msg) }
+func (l *logrLogger) Infof(format string, args ...any) {
+	l.log.Info(fmt.Sprintf(format, args...))
+}
+func (l *logrLogger) Warn(msg string) { l.log.Info(msg, "level", "warning") }
+func (l *logrLogger) Warnf(format string, args ...any) {
+	l.log.Info(fmt.Sprintf(format, args...), "level", "warning")
+}
+func (l *logrLogger) Error(msg string) { l.log.Error(nil, msg) }
+func (l *logrLogger) Errorf(format string, args ...any) {
+	l.log.Error(nil, fmt.Sprintf(format, args...))
+}
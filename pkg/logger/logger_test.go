@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
 	"github.com/pion/transport/v3/test"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/time/rate"
@@ -573,6 +574,40 @@ func TestRateLimitedLogger(t *testing.T) {
 	}
 }
 
+func TestLogrLoggerFactory(t *testing.T) {
+	lines := []string{}
+	l := funcr.New(func(prefix, args string) {
+		lines = append(lines, prefix+" "+args)
+	}, funcr.Options{Verbosity: 1})
+
+	lf := NewLogrLoggerFactory(l)
+	log := lf.NewLogger(testScope)
+	log.Tracef("trace %d", 1)
+	log.Debugf("debug %d", 1)
+	log.Infof("info %d", 1)
+	log.Warnf("warn %d", 1)
+	log.Errorf("error %d", 1)
+
+	// the verbosity of the sink controls the loglevel
+	assert.Len(t, lines, 4, "trace suppressed")
+	assert.Contains(t, lines[0], `"msg"="debug 1"`, "debug")
+	assert.Contains(t, lines[0], testScope, "scope")
+	assert.Contains(t, lines[1], `"msg"="info 1"`, "info")
+	assert.Contains(t, lines[2], `"msg"="warn 1" "level"="warning"`, "warn")
+	assert.Contains(t, lines[3], `"msg"="error 1"`, "error")
+	assert.Contains(t, lines[3], `"error"=null`, "error")
+
+	// the delegating factory ignores loglevels and writers
+	df := NewDelegatingLoggerFactory(lf)
+	df.SetLevel("all:ERROR")
+	df.SetWriter(logBuffer)
+	assert.Equal(t, "", df.GetLevel(testScope), "level")
+	lines = []string{}
+	df.NewLogger(testScope).Info("info")
+	assert.Len(t, lines, 1, "not suppressed")
+	assert.Zero(t, loglenr(), "not written")
+}
+
 //nolint:unused
 func loglen() int {
 	return logBuffer.Len()
@@ -0,0 +1,28 @@
+//go:build linux
+
+package stunner
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setPathMTUDiscovery sets the Don't Fragment bit on the datagrams sent from a socket and makes the
+// kernel reject datagrams larger than the known path MTU with EMSGSIZE.
+func setPathMTUDiscovery(conn syscall.RawConn) error {
+	var serr error
+	if err := conn.Control(func(fd uintptr) {
+		// the socket may be IPv4, IPv6 or dual-stack: one of the two is enough
+		err4 := unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER,
+			unix.IP_PMTUDISC_DO)
+		err6 := unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER,
+			unix.IPV6_PMTUDISC_DO)
+		if err4 != nil && err6 != nil {
+			serr = err4
+		}
+	}); err != nil {
+		return err
+	}
+	return serr
+}
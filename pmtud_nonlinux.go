@@ -0,0 +1,12 @@
+//go:build !linux
+
+package stunner
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setPathMTUDiscovery(_ syscall.RawConn) error {
+	return errors.New("path MTU discovery is supported only on Linux")
+}
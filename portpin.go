@@ -0,0 +1,115 @@
+package stunner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/object"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+var errPinnedPortInUse = errors.New("pinned relay port in use")
+
+// relayPortPins keeps the relay addresses pinned to the usernames at a listener.
+type relayPortPins struct {
+	pins map[string]*net.UDPAddr
+	log  logging.LeveledLogger
+}
+
+// newRelayPortPins creates the relay port pins of a listener, or returns nil if the listener has
+// no pins. The pinned ports falling into the relay port ranges of the listener are reserved in the
+// relay port pool.
+func newRelayPortPins(l *object.Listener, pool *relayPortPool, log logging.LeveledLogger) *relayPortPins {
+	if len(l.RelayPortPins) == 0 {
+		return nil
+	}
+
+	p := &relayPortPins{pins: map[string]*net.UDPAddr{}, log: log}
+	for u, pin := range l.RelayPortPins {
+		addr, err := stnrv1.ParseRelayPortPin(pin)
+		if err != nil {
+			// should never happen, the config has been validated
+			log.Warnf("Ignoring relay port pin of user %q: %s", u, err.Error())
+			continue
+		}
+		p.pins[u] = addr
+		if pool != nil && pool.contains(addr.Port) {
+			pool.pin(addr.Port)
+		}
+	}
+	return p
+}
+
+// lookup returns the relay address pinned to a user, if any. Time-windowed usernames are also
+// looked up by the user id, i.e., the username with the timestamp removed.
+func (p *relayPortPins) lookup(username string) (*net.UDPAddr, bool) {
+	if p == nil || username == "" {
+		return nil, false
+	}
+	if addr, ok := p.pins[username]; ok {
+		return addr, true
+	}
+	// the first component that looks like a timestamp is the timestamp, like in
+	// a12n.CheckTimeWindowedUsername
+	parts := strings.Split(username, a12n.UsernameSeparator)
+	for i, ts := range parts {
+		if _, err := strconv.Atoi(ts); err == nil && len(parts) > 1 {
+			userid := strings.Join(slices.Delete(parts, i, i+1), a12n.UsernameSeparator)
+			addr, ok := p.pins[userid]
+			return addr, ok
+		}
+	}
+	return nil, false
+}
+
+// pinned returns the relay address pinned to the user of the Allocate request being handled, if
+// any.
+func (r *RelayGen) pinned() *net.UDPAddr {
+	if r.pins == nil || r.claims == nil {
+		return nil
+	}
+	claim := r.claims.get()
+	addr, ok := r.pins.lookup(claim.username)
+	if !ok {
+		return nil
+	}
+	return addr
+}
+
+// listenPinned binds the relay socket of a pinned user to the pinned port, and to the pinned
+// address if any.
+func (r *RelayGen) listenPinned(network, address string, pin *net.UDPAddr) (net.PacketConn, error) {
+	if pin.IP != nil {
+		address = pin.IP.String()
+	}
+	bind := func(port int) (net.PacketConn, error) {
+		return r.Net.ListenPacket(network, net.JoinHostPort(address, fmt.Sprintf("%d", port)))
+	}
+
+	var conn net.PacketConn
+	var err error
+	if r.ports != nil && r.ports.contains(pin.Port) {
+		conn, err = r.ports.leasePinned(pin.Port, bind)
+	} else {
+		conn, err = bind(pin.Port)
+	}
+	if err != nil {
+		claim := r.claims.get()
+		r.pins.log.Infof("Refusing allocation of user %q from client %s: cannot bind pinned "+
+			"relay address %s:%d: %s", claim.username, claim.client, address, pin.Port,
+			err.Error())
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return nil, errPinnedPortInUse
+		}
+		return nil, err
+	}
+	return conn, nil
+}
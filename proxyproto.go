@@ -0,0 +1,227 @@
+package stunner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// ProxyProtoHeaderTimeout is the time allowed for a client to send the PROXY protocol header
+// after connecting.
+var ProxyProtoHeaderTimeout = 5 * time.Second
+
+const (
+	// the longest PROXY protocol v1 header, including the CRLF
+	proxyProtoV1MaxLen = 107
+)
+
+var (
+	proxyProtoV1Prefix   = []byte("PROXY ")
+	proxyProtoV2Sig      = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	errInvalidProxyProto = errors.New("invalid PROXY protocol header")
+)
+
+// proxyProtoListener is a net.Listener that obtains the address of the clients from the PROXY
+// protocol (v1 or v2) header prepended to each connection by an L4 proxy or load balancer. The
+// header is mandatory: connections without a valid header are closed. The header is accepted only
+// from the trusted proxies: connections from other addresses are closed.
+type proxyProtoListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	log     logging.LeveledLogger
+}
+
+// NewProxyProtoListener decorates a TCP listener with PROXY protocol support, accepting
+// connections only from the given trusted proxies. Must be applied before the TLS listener, if
+// any, since the header precedes the TLS handshake.
+func NewProxyProtoListener(l net.Listener, trusted []*net.IPNet, log logging.LeveledLogger) net.Listener {
+	return &proxyProtoListener{Listener: l, trusted: trusted, log: log}
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return conn, err
+		}
+		if !l.isTrusted(conn.RemoteAddr()) {
+			l.log.Debugf("Closing connection from untrusted proxy %s", conn.RemoteAddr())
+			conn.Close() //nolint:errcheck
+			continue
+		}
+		return &proxyProtoConn{Conn: conn, r: bufio.NewReader(conn), log: l.log}, nil
+	}
+}
+
+func (l *proxyProtoListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.trusted {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtoConn parses the PROXY protocol header lazily on the first Read or RemoteAddr call, so
+// that slow clients do not block the accept loop.
+type proxyProtoConn struct {
+	net.Conn
+	r      *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+	log    logging.LeveledLogger
+}
+
+func (c *proxyProtoConn) readHeader() {
+	c.remote = c.Conn.RemoteAddr()
+	c.Conn.SetReadDeadline(time.Now().Add(ProxyProtoHeaderTimeout)) //nolint:errcheck
+	defer c.Conn.SetReadDeadline(time.Time{})                       //nolint:errcheck
+
+	addr, err := parseProxyProtoHeader(c.r)
+	if err != nil {
+		c.log.Warnf("Closing connection from %s: %s", c.remote, err.Error())
+		c.err = err
+		c.Conn.Close() //nolint:errcheck
+		return
+	}
+
+	// nil means the proxy sent the header for its own connection (e.g., a health-check)
+	if addr != nil {
+		c.log.Tracef("Connection from %s: client address %s", c.remote, addr)
+		c.remote = addr
+	}
+}
+
+func (c *proxyProtoConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the address of the client from the PROXY protocol header.
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	return c.remote
+}
+
+// parseProxyProtoHeader reads a PROXY protocol v1 or v2 header and returns the source address of
+// the proxied connection, or nil if the header does not carry an address (the "UNKNOWN" protocol
+// in v1, and the LOCAL command or an unsupported address family in v2).
+func parseProxyProtoHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyProtoV2Sig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidProxyProto, err.Error())
+	}
+
+	switch {
+	case bytes.Equal(sig, proxyProtoV2Sig):
+		return parseProxyProtoV2(r)
+	case bytes.HasPrefix(sig, proxyProtoV1Prefix):
+		return parseProxyProtoV1(r)
+	default:
+		return nil, fmt.Errorf("%w: missing signature", errInvalidProxyProto)
+	}
+}
+
+// parseProxyProtoV1 parses a human-readable header, e.g.,
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func parseProxyProtoV1(r *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, proxyProtoV1MaxLen)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidProxyProto, err.Error())
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyProtoV1MaxLen {
+			return nil, fmt.Errorf("%w: v1 header too long", errInvalidProxyProto)
+		}
+	}
+
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, fmt.Errorf("%w: v1 header not terminated by CRLF", errInvalidProxyProto)
+	}
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: malformed v1 header %q", errInvalidProxyProto, s)
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: invalid source address in v1 header %q",
+			errInvalidProxyProto, s)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseProxyProtoV2 parses a binary header.
+func parseProxyProtoV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, len(proxyProtoV2Sig)+4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidProxyProto, err.Error())
+	}
+
+	verCmd, fam := hdr[12], hdr[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", errInvalidProxyProto, verCmd>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidProxyProto, err.Error())
+	}
+
+	switch verCmd & 0xf {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", errInvalidProxyProto, verCmd&0xf)
+	}
+
+	// the address block is followed by optional TLVs, which are ignored
+	var ipLen int
+	switch fam >> 4 {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default: // AF_UNSPEC or AF_UNIX
+		return nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: v2 address block too short", errInvalidProxyProto)
+	}
+
+	ip := make(net.IP, ipLen)
+	copy(ip, payload[:ipLen])
+	port := binary.BigEndian.Uint16(payload[2*ipLen : 2*ipLen+2])
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,113 @@
+package stunner
+
+import (
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"golang.org/x/time/rate"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+)
+
+// stunBindingRequest is the message type of STUN Binding requests.
+const stunBindingRequest = 0x0001
+
+// BindingLimiter caps the rate of the STUN Binding requests served by a listener. The limiter is
+// shared by all the sockets of a listener.
+type BindingLimiter struct {
+	limiter atomic.Pointer[rate.Limiter]
+}
+
+// NewBindingLimiter creates a new Binding request rate limiter.
+func NewBindingLimiter() *BindingLimiter {
+	return &BindingLimiter{}
+}
+
+// allow returns true if a Binding request may be served under the given limit (in requests per
+// second, zero means no limit).
+func (b *BindingLimiter) allow(limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	// the limit may be changed at runtime: start with a full bucket on each change
+	l := b.limiter.Load()
+	if l == nil || l.Limit() != rate.Limit(limit) {
+		l = rate.NewLimiter(rate.Limit(limit), limit)
+		b.limiter.Store(l)
+	}
+	return l.Allow()
+}
+
+// BindingLimitPacketConn is a net.PacketConn that rate-limits the STUN Binding requests received on
+// a UDP listener before they would reach the TURN server, in order to prevent STUN Binding floods
+// from using STUNner for reflection and amplification attacks. Since amplification attacks use
+// spoofed source addresses, the limit applies to the listener as a whole, not per client.
+// Requests exceeding the limit are either silently dropped or rejected with a minimal error
+// response. Other STUN/TURN messages are not affected.
+type BindingLimitPacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	limiter   *BindingLimiter
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewBindingLimitPacketConn decorates a listener PacketConn with Binding request rate limiting.
+// Rate limiting is active only if the Binding rate limit of the listener is positive.
+func NewBindingLimitPacketConn(c net.PacketConn, l *object.Listener, limiter *BindingLimiter, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &BindingLimitPacketConn{
+		PacketConn: c,
+		listener:   l,
+		limiter:    limiter,
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn. Binding requests exceeding the rate limit are consumed and
+// never returned to the caller.
+func (c *BindingLimitPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		// cheap check first: this runs for every packet
+		if n < 20 || binary.BigEndian.Uint16(p[0:2]) != stunBindingRequest ||
+			!stun.IsMessage(p[:n]) {
+			return n, addr, nil
+		}
+		limit, silent := c.listener.GetBindingRateLimit()
+		if c.limiter.allow(limit) {
+			return n, addr, nil
+		}
+
+		c.telemetry.IncrementBindingRateLimited(c.listener.Name)
+		if silent {
+			continue
+		}
+		c.reject(p[:n], addr)
+	}
+}
+
+func (c *BindingLimitPacketConn) reject(p []byte, addr net.Addr) {
+	// keep the response as short as possible: no reason phrase and no fingerprint
+	res := make([]byte, 20, 28)
+	binary.BigEndian.PutUint16(res[0:2], 0x0111) // Binding error response
+	binary.BigEndian.PutUint16(res[2:4], 8)
+	copy(res[4:20], p[4:20]) // magic cookie and transaction id
+	res = binary.BigEndian.AppendUint16(res, uint16(stun.AttrErrorCode))
+	res = binary.BigEndian.AppendUint16(res, 4)
+	res = append(res, 0, 0, byte(stun.CodeServerError/100), byte(stun.CodeServerError%100))
+
+	if _, err := c.PacketConn.WriteTo(res, addr); err != nil {
+		c.log.Debugf("could not send Binding error response to client %s: %s",
+			addr.String(), err.Error())
+	}
+}
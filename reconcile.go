@@ -1,14 +1,85 @@
 package stunner
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/util"
 	cdsclient "github.com/l7mp/stunner/pkg/config/client"
+	"github.com/l7mp/stunner/pkg/config/validate"
 
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 )
 
+// ReconcileHook is a callback invoked during reconciliation with the running configuration (old)
+// and the configuration being applied (new). The context is the one passed to Reconcile, hooks
+// that call out to external services should honor its cancellation and deadline.
+type ReconcileHook = func(ctx context.Context, old, new *stnrv1.StunnerConfig) error
+
+// AddPreReconcileHook registers a hook that is called before a new configuration is applied. Hooks
+// are called in the order of registration and they may modify the new configuration, which is
+// re-validated after all hooks have been run. If a hook returns an error then the reconciliation
+// is vetoed: Reconcile returns the error and the running configuration remains unchanged. Hooks
+// are not called when rolling back to the last working configuration. Must not be called
+// concurrently with Reconcile.
+func (s *Stunner) AddPreReconcileHook(h ReconcileHook) {
+	s.preReconcileHooks = append(s.preReconcileHooks, h)
+}
+
+// AddPostReconcileHook registers a hook that is called after a new configuration has been
+// successfully applied. Hooks are called in the order of registration. If a hook returns an error
+// then the reconciliation is considered failed and the last working configuration is rolled back
+// (unless SuppressRollback is on). Hooks are also called after a rollback, in which case errors are
+// logged but otherwise ignored. Must not be called concurrently with Reconcile.
+func (s *Stunner) AddPostReconcileHook(h ReconcileHook) {
+	s.postReconcileHooks = append(s.postReconcileHooks, h)
+}
+
+// resolvePlaceholders substitutes "${VAR}" style placeholders in the auth and listener configs
+// with the value of the corresponding environment variable (e.g., "${POD_NAME}" or "${NODE_NAME}"
+// set via the Kubernetes downward API). Resolution happens at reconciliation time, so templated
+// values are substituted regardless of whether the config was loaded from a file, received from
+// the config discovery service or passed in via the API. The placeholders are resolved in a copy of
+// the config, leaving the config of the caller untouched, and the running config holds the
+// resolved values.
+func resolvePlaceholders(req *stnrv1.StunnerConfig) (*stnrv1.StunnerConfig, error) {
+	req = req.DeepCopy()
+	resolve := func(field string, v *string) error {
+		r, err := util.ResolvePlaceholders(*v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", field, err)
+		}
+		*v = r
+		return nil
+	}
+
+	if err := resolve("auth realm", &req.Auth.Realm); err != nil {
+		return nil, err
+	}
+	if u, ok := req.Auth.Credentials["username"]; ok {
+		if err := resolve("auth username", &u); err != nil {
+			return nil, err
+		}
+		req.Auth.Credentials["username"] = u
+	}
+
+	for i := range req.Listeners {
+		l := &req.Listeners[i]
+		if err := resolve(fmt.Sprintf("listener %q address", l.Name), &l.Addr); err != nil {
+			return nil, err
+		}
+		if err := resolve(fmt.Sprintf("listener %q public address", l.Name),
+			&l.PublicAddr); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
 // Reconcile handles updates to the STUNner configuration. Some updates are destructive: in this
 // case the returned error contains the names of the objects (usually, listeners) that were
 // restarted during reconciliation (see the documentation of the corresponding STUNner objects for
@@ -16,29 +87,134 @@ import (
 // restarted, v1.ErrRestarted to indicate that a shutdown-restart cycle was performed for at
 // least one internal object (usually, a listener) for the new config (unless DryRun is enabled),
 // and an error if an error has occurred during reconciliation, in which case it will rollback the
-// last working configuration (unless SuppressRollback is on).
-func (s *Stunner) Reconcile(req *stnrv1.StunnerConfig) error {
-	return s.reconcileWithRollback(req, false)
+// last working configuration (unless SuppressRollback is on). In standby mode the configuration is
+// reconciled but listeners are not started. Changes that affect only the auth config and leave the
+// realm unchanged (e.g., credential rotation) take a fast path that updates the authenticator
+// without touching the listeners and the clusters. The config passed in is not modified.
+//
+// The context can be used to abort a reconciliation: if the context is canceled or its deadline
+// expires before the new configuration is committed then Reconcile returns the context error and
+// the running configuration remains unchanged. Once committed, the reconciliation runs to
+// completion, except that a post-reconcile hook failing due to the cancellation makes STUNner roll
+// back to the last working configuration. Rollbacks are never canceled. Reconciling a closed
+// STUNner returns ErrInvalidState, including calls still waiting for their turn when STUNner is
+// closed.
+//
+// Reconcile is safe to call concurrently: the calls are serialized in the order of arrival and
+// each waits for the previous ones to finish. If reconcile coalescing is enabled (see Options)
+// then a call waiting for its turn is superseded by a newer call and returns
+// ErrReconcileSuperseded. A call canceled while waiting returns the context error.
+func (s *Stunner) Reconcile(ctx context.Context, req *stnrv1.StunnerConfig) error {
+	if err := s.checkState("reconcile"); err != nil {
+		return err
+	}
+
+	if err := s.reconciles.acquire(ctx); err != nil {
+		// Close supersedes the waiting reconciliations
+		if err := s.checkState("reconcile"); err != nil {
+			return err
+		}
+		s.log.Debugf("Reconciliation skipped: %s", err.Error())
+		return err
+	}
+	defer s.reconciles.release()
+
+	s.standbyLock.Lock()
+	defer s.standbyLock.Unlock()
+
+	// STUNner may have been closed while waiting for our turn
+	if err := s.checkState("reconcile"); err != nil {
+		return err
+	}
+
+	s.rollbackErr = nil
+	err := s.reconcileWithRollback(ctx, req, false)
+	s.setConfigAccepted(err)
+	if s.ready {
+		s.state.CompareAndSwap(int32(StateNew), int32(StateRunning))
+	}
+
+	return err
 }
 
-func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bool) error {
+func (s *Stunner) reconcileWithRollback(ctx context.Context, req *stnrv1.StunnerConfig, inRollback bool) error {
 	var errFinal error
+	var events []ReconcileEvent
 	new, deleted, changed := 0, 0, 0
 
+	if err := reconcileCanceled(ctx); err != nil {
+		return err
+	}
+
+	req, err := resolvePlaceholders(req)
+	if err != nil {
+		return err
+	}
+	// deprecated settings are normalized by the validator
+	warnings := validate.Warnings(req)
 	if err := req.Validate(); err != nil {
 		return err
 	}
+	s.warnings.Store(&warnings)
 
 	s.log.Debugf("Reconciling STUNner for config: %s ", req.String())
 
+	if !inRollback {
+		for _, w := range warnings {
+			s.log.Warnf("Configuration warning: %s", w.String())
+		}
+	}
+
 	rollback := s.GetConfig()
+
+	if !inRollback && len(s.preReconcileHooks) > 0 {
+		for _, h := range s.preReconcileHooks {
+			if err := h(ctx, rollback, req); err != nil {
+				return fmt.Errorf("reconciliation vetoed by pre-reconcile hook: %w", err)
+			}
+		}
+
+		// hooks may have modified the config
+		if req, err = resolvePlaceholders(req); err != nil {
+			return err
+		}
+		if err := req.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// enforce the ownership policy of the running config
+	if !inRollback {
+		if conflicts := validate.OwnershipConflicts(rollback, req); len(conflicts) > 0 {
+			switch rollback.Admin.OwnershipPolicy {
+			case stnrv1.OwnershipPolicyReject:
+				msgs := make([]string, len(conflicts))
+				for i, w := range conflicts {
+					msgs[i] = w.String()
+				}
+				return fmt.Errorf("configuration rejected by the ownership policy: %s",
+					strings.Join(msgs, "; "))
+			case stnrv1.OwnershipPolicyWarn:
+				for _, w := range conflicts {
+					s.log.Warnf("Configuration warning: %s", w.String())
+				}
+				ws := append(slices.Clone(warnings), conflicts...)
+				s.warnings.Store(&ws)
+			}
+		}
+	}
+
+	// fast path for credential rotation: update the authenticator only
+	if !inRollback && isAuthOnlyChange(rollback, req) {
+		return s.reconcileAuth(ctx, rollback, req)
+	}
+
 	toBeStarted, toBeRestarted := []object.Object{}, []object.Object{}
 
 	// admin
 	adminState, err := s.adminManager.PrepareReconciliation([]stnrv1.Config{&req.Admin}, req)
 	if err != nil {
-		return fmt.Errorf("error preparing reconciliation for admin config: %s",
-			err.Error())
+		return fmt.Errorf("error preparing reconciliation for admin config: %w", err)
 	}
 	toBeRestarted = append(toBeRestarted, adminState.ToBeRestarted...)
 	new += len(adminState.NewJobQueue)
@@ -48,8 +224,7 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 	// auth
 	authState, err := s.authManager.PrepareReconciliation([]stnrv1.Config{&req.Auth}, req)
 	if err != nil {
-		return fmt.Errorf("error preparing reconciliation for auth config: %s",
-			err.Error())
+		return fmt.Errorf("error preparing reconciliation for auth config: %w", err)
 	}
 	toBeRestarted = append(toBeRestarted, authState.ToBeRestarted...)
 	new += len(authState.NewJobQueue)
@@ -63,7 +238,7 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 	}
 	listenerState, err := s.listenerManager.PrepareReconciliation(lconf, req)
 	if err != nil {
-		return fmt.Errorf("error preparing reconciliation for listener config: %s", err.Error())
+		return fmt.Errorf("error preparing reconciliation for listener config: %w", err)
 	}
 	toBeRestarted = append(toBeRestarted, listenerState.ToBeRestarted...)
 	new += len(listenerState.NewJobQueue)
@@ -77,13 +252,32 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 	}
 	clusterState, err := s.clusterManager.PrepareReconciliation(cconf, req)
 	if err != nil {
-		return fmt.Errorf("error preparing reconciliation for cluster config: %s", err.Error())
+		return fmt.Errorf("error preparing reconciliation for cluster config: %w", err)
 	}
 	toBeRestarted = append(toBeRestarted, clusterState.ToBeRestarted...)
 	new += len(clusterState.NewJobQueue)
 	changed += len(clusterState.ChangedJobQueue)
 	deleted += len(clusterState.DeletedJobQueue)
 
+	// last chance to abort: the preparation phase has no side effects
+	if err := reconcileCanceled(ctx); err != nil {
+		return err
+	}
+
+	// commit: the new config (or the rollback config) becomes a new config generation
+	generation := s.generation.Add(1)
+	adminState.Generation = generation
+	authState.Generation = generation
+	listenerState.Generation = generation
+	clusterState.Generation = generation
+
+	// report the changes once the outcome is known
+	events = slices.Concat(reconcileEvents("admin", adminState, toBeRestarted),
+		reconcileEvents("auth", authState, toBeRestarted),
+		reconcileEvents("listener", listenerState, toBeRestarted),
+		reconcileEvents("cluster", clusterState, toBeRestarted))
+	defer func() { s.publishReconcileEvents(events, inRollback, errFinal) }()
+
 	// find all objects (listeners) to be restarted and stop each
 	if !s.dryRun {
 		if err := s.stop(toBeRestarted); err != nil {
@@ -111,8 +305,18 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 	}
 	toBeStarted = append(toBeStarted, adminState.ToBeStarted...)
 
-	s.log.Infof("Setting loglevel to %q", s.GetAdmin().LogLevel)
-	s.logger.SetLevel(s.GetAdmin().LogLevel)
+	if !s.delegatedLogging {
+		s.log.Infof("Setting loglevel to %q", s.GetAdmin().LogLevel)
+		s.logger.SetLevel(s.GetAdmin().LogLevel)
+	}
+	s.telemetry.SetLabelPolicy(s.GetAdmin().GetMetricsLabelPolicy())
+	s.setErrorReasons(s.GetAdmin().GetErrorReasons())
+	s.selfCheck.set(s.GetAdmin().GetSelfCheck())
+	s.watchdog.setTimeout(s.GetAdmin().GetWatchdogTimeout())
+	if !s.dryRun {
+		percent, memoryLimit, ballast := s.GetAdmin().GetGCSettings()
+		s.gc.apply(gcSettings{percent: percent, memoryLimit: memoryLimit, ballast: ballast})
+	}
 
 	// auth
 	err = s.authManager.FinishReconciliation(authState)
@@ -137,9 +341,26 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 		return errFinal
 	}
 	toBeStarted = append(toBeStarted, listenerState.ToBeStarted...)
-
-	if len(s.listenerManager.Keys()) == 0 {
-		s.log.Warn("Running with no listeners: gateway unreachable")
+	for _, j := range listenerState.DeletedJobQueue {
+		s.toggles.forget(j.Object.ObjectName())
+		s.lifetimes.resetListener(j.Object.ObjectName())
+		s.relayPorts.set(j.Object.ObjectName(), nil)
+		s.telemetry.SetListenerLabels(j.Object.ObjectName(), nil)
+	}
+	for _, name := range s.listenerManager.Keys() {
+		if l := s.GetListener(name); l != nil {
+			s.telemetry.SetListenerLabels(name, l.Labels)
+			if l.HasCountryFilter() && !s.GetAdmin().HasGeoIP() {
+				s.log.Warnf("Listener %q: country filter set but GeoIP database is not "+
+					"available, ignoring filter", name)
+			}
+		}
+	}
+	s.reconcileStandby(listenerState)
+	if !s.dryRun {
+		for _, j := range listenerState.DeletedJobQueue {
+			s.onStop(j.Object)
+		}
 	}
 
 	// cluster
@@ -153,9 +374,24 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 		return errFinal
 	}
 	toBeStarted = append(toBeStarted, clusterState.ToBeStarted...)
-
-	if len(s.clusterManager.Keys()) == 0 {
-		s.log.Warn("Running with no clusters: TURN forwarding to peers not permitted")
+	for _, j := range clusterState.DeletedJobQueue {
+		s.onStop(j.Object)
+		s.telemetry.SetClusterMetadata(j.Object.ObjectName(), "", "")
+		s.telemetry.SetClusterLabels(j.Object.ObjectName(), nil)
+	}
+	for _, j := range clusterState.NewJobQueue {
+		if c, found := s.clusterManager.Get(j.NewConfig.ConfigName()); found {
+			s.onStart(c)
+		}
+	}
+	for _, name := range s.clusterManager.Keys() {
+		c := s.GetCluster(name)
+		if m := c.Metadata(); m != nil {
+			s.telemetry.SetClusterMetadata(name, m.Namespace, m.Service)
+		} else {
+			s.telemetry.SetClusterMetadata(name, "", "")
+		}
+		s.telemetry.SetClusterLabels(name, c.Labels())
 	}
 
 	// find all objects (listeners) to be started or restarted and start each
@@ -168,6 +404,7 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 			}
 			return errFinal
 		}
+		s.checkSystem()
 	}
 
 	// we are "ready" unless we are being shut down, we are not in a rollback nor bootstrapping
@@ -182,6 +419,16 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 
 	s.log.Infof("New dataplane status: %s", s.Status().String())
 
+	for _, h := range s.postReconcileHooks {
+		if err := h(ctx, rollback, req); err != nil {
+			s.log.Errorf("Post-reconcile hook failed: %s", err.Error())
+			if !inRollback {
+				errFinal = err
+				goto rollback
+			}
+		}
+	}
+
 	if len(toBeRestarted) > 0 {
 		names := make([]string, len(toBeRestarted))
 		for i, n := range toBeRestarted {
@@ -194,14 +441,91 @@ func (s *Stunner) reconcileWithRollback(req *stnrv1.StunnerConfig, inRollback bo
 	return nil
 
 rollback:
+	s.rollbackErr = errFinal
+	// the failed changes are reported before the changes made by the rollback
+	s.publishReconcileEvents(events, false, errFinal)
+	events = nil
 	if !s.suppressRollback {
 		s.log.Infof("Rolling back to previous configuration: %s", rollback.String())
-		return s.reconcileWithRollback(rollback, true)
+		return s.reconcileWithRollback(context.WithoutCancel(ctx), rollback, true)
 	}
 
 	return errFinal
 }
 
+// reconcileCanceled returns an error if the context of a reconciliation is done.
+func reconcileCanceled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("reconciliation aborted: %w", err)
+	}
+	return nil
+}
+
+// isAuthOnlyChange returns true if the new config differs from the running config only in the
+// auth config, and the change does not require restarting the listeners (i.e., the realm is
+// unchanged and the nonce lifetime policy is not enabled or disabled).
+func isAuthOnlyChange(old, new *stnrv1.StunnerConfig) bool {
+	if old.Auth.DeepEqual(&new.Auth) || old.Auth.Realm != new.Auth.Realm {
+		return false
+	}
+
+	// enabling or disabling the nonce lifetime policy restarts the UDP listeners
+	if (old.Auth.NonceTTL > 0) != (new.Auth.NonceTTL > 0) {
+		return false
+	}
+
+	// the running config has a normalized auth config: compare the rest
+	c := new.DeepCopy()
+	old.Auth.DeepCopyInto(&c.Auth)
+	return old.DeepEqual(c)
+}
+
+// reconcileAuth updates the authenticator for a config that differs from the running config only
+// in the auth config, without touching the admin, the listener and the cluster managers. The
+// authenticator is updated atomically, so running allocations are not affected and new requests
+// are authenticated with the new credentials.
+func (s *Stunner) reconcileAuth(ctx context.Context, rollback, req *stnrv1.StunnerConfig) error {
+	s.log.Debugf("Reconciling STUNner for an auth-only config change: %s", req.Auth.String())
+
+	authState, err := s.authManager.PrepareReconciliation([]stnrv1.Config{&req.Auth}, req)
+	if err != nil {
+		return fmt.Errorf("error preparing reconciliation for auth config: %w", err)
+	}
+	authState.Generation = s.generation.Add(1)
+	events := reconcileEvents("auth", authState, nil)
+
+	if err = s.authManager.FinishReconciliation(authState); err != nil {
+		s.log.Errorf("Could not reconcile auth config: %s", err.Error())
+		goto rollback
+	}
+
+	if !s.shutdown && !s.ready && !cdsclient.IsZeroConfig(req) {
+		s.ready = true
+	}
+
+	s.log.Infof("Reconciliation ready: auth config updated")
+
+	for _, h := range s.postReconcileHooks {
+		if err = h(ctx, rollback, req); err != nil {
+			s.log.Errorf("Post-reconcile hook failed: %s", err.Error())
+			goto rollback
+		}
+	}
+
+	s.publishReconcileEvents(events, false, nil)
+	return nil
+
+rollback:
+	s.rollbackErr = err
+	s.publishReconcileEvents(events, false, err)
+	if !s.suppressRollback {
+		s.log.Infof("Rolling back to previous configuration: %s", rollback.String())
+		return s.reconcileWithRollback(context.WithoutCancel(ctx), rollback, true)
+	}
+
+	return err
+}
+
 func (s *Stunner) stop(restarted []object.Object) error {
 	for _, o := range restarted {
 		switch l := o.(type) {
@@ -210,6 +534,7 @@ func (s *Stunner) stop(restarted []object.Object) error {
 			if err := l.Close(); err != nil {
 				return err
 			}
+			s.onStop(l)
 		// The admin object needs to be restarted of the offload changes.
 		case *object.Admin:
 			if err := s.offloadHandler.Close(); err != nil {
@@ -229,9 +554,15 @@ func (s *Stunner) start(started, restarted []object.Object) error {
 		switch l := o.(type) {
 		// The TURN server underlying a listener may need to be restarted.
 		case *object.Listener:
+			if s.standby.Load() {
+				s.log.Debugf("Standby mode: not starting listener %q", l.ObjectName())
+				continue
+			}
 			if err := s.StartServer(l); err != nil {
+				s.onError(l, err)
 				return err
 			}
+			s.onStart(l)
 		// The admin object needs to be restarted of the offload changes.
 		case *object.Admin:
 			if err := s.offloadHandler.Start(); err != nil {
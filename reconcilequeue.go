@@ -0,0 +1,95 @@
+package stunner
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrReconcileSuperseded is returned by Reconcile when reconcile coalescing is enabled and the
+// configuration was not applied because a newer configuration was submitted while the call was
+// waiting for its turn.
+var ErrReconcileSuperseded = errors.New("reconciliation superseded by a newer configuration")
+
+// reconcileTurn is a reconciliation waiting in the reconcile queue.
+type reconcileTurn struct {
+	ready chan error // closed when it is the turn of the reconciliation, or receives an error
+}
+
+// reconcileQueue serializes concurrent reconciliations in the order of arrival. With coalescing,
+// a new reconciliation supersedes all the reconciliations still waiting in the queue, so that
+// only the latest configuration is applied after the running reconciliation finishes.
+type reconcileQueue struct {
+	coalesce bool
+	busy     bool
+	waiting  []*reconcileTurn
+	lock     sync.Mutex
+}
+
+func newReconcileQueue(coalesce bool) *reconcileQueue {
+	return &reconcileQueue{coalesce: coalesce}
+}
+
+// acquire waits until it is the turn of the caller. Returns ErrReconcileSuperseded if a newer
+// reconciliation superseded the caller or the context error if the context is canceled while
+// waiting. On success, the caller must call release once the reconciliation is finished.
+func (q *reconcileQueue) acquire(ctx context.Context) error {
+	q.lock.Lock()
+	if !q.busy {
+		q.busy = true
+		q.lock.Unlock()
+		return nil
+	}
+
+	if q.coalesce {
+		for _, t := range q.waiting {
+			t.ready <- ErrReconcileSuperseded
+		}
+		q.waiting = q.waiting[:0]
+	}
+	turn := &reconcileTurn{ready: make(chan error, 1)}
+	q.waiting = append(q.waiting, turn)
+	q.lock.Unlock()
+
+	select {
+	case err, ok := <-turn.ready:
+		if !ok {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, t := range q.waiting {
+		if t == turn {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return ctx.Err()
+		}
+	}
+
+	// the turn has been given to us (or we have been superseded) in the meantime
+	if _, ok := <-turn.ready; !ok {
+		q.next()
+	}
+	return ctx.Err()
+}
+
+// release passes the turn to the next waiting reconciliation, if any.
+func (q *reconcileQueue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.next()
+}
+
+// next must be called with the lock held.
+func (q *reconcileQueue) next() {
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	turn := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	close(turn.ready)
+}
@@ -0,0 +1,270 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"slices"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+// Components reported in the panic metrics.
+const (
+	panicComponentListener   = "listener"
+	panicComponentRelay      = "relay"
+	panicComponentConnection = "connection"
+	panicComponentAuth       = "auth-handler"
+	panicComponentQuota      = "quota-handler"
+	panicComponentPermission = "permission-handler"
+	panicComponentEvent      = "event-handler"
+	panicComponentDemux      = "demux"
+	panicComponentTarpit     = "tarpit"
+)
+
+var errRecoveredPanic = errors.New("recovered from panic")
+
+// recoverPanic recovers from a panic in a component of a listener, logs the panic and counts it
+// in the metrics. Must be called via defer.
+func (s *Stunner) recoverPanic(l *object.Listener, component string) {
+	if r := recover(); r != nil {
+		util.ReportPanic(s.log, s.telemetry, l.Name, component, r)
+	}
+}
+
+// recoverReadLoop handles a panic recovered in a read loop of the TURN server of a listener, see
+// the PanicHandler of the TURN server config. The read loop exits after the panic: a connection of
+// a TCP, TLS or DTLS listener is closed by the TURN server, while a UDP listener is restarted,
+// like a listener with a wedged readloop. Allocations do not survive the restart.
+func (s *Stunner) recoverReadLoop(l *object.Listener, conn net.PacketConn, r any) {
+	util.ReportPanic(s.log, s.telemetry, l.Name, panicComponentListener, r)
+	if _, ok := conn.(*turn.STUNConn); ok {
+		return
+	}
+	// the read loop is on the stack of the panicking goroutine
+	go s.restartPanickedListener(l.Name, conn)
+}
+
+// restartPanickedListener restarts a listener whose read loop on the given connection exited on a
+// panic, unless the listener has been restarted in the meantime.
+func (s *Stunner) restartPanickedListener(name string, conn net.PacketConn) {
+	s.standbyLock.Lock()
+	defer s.standbyLock.Unlock()
+
+	l := s.GetListener(name)
+	if s.checkState("restart listener") != nil || l == nil || !l.IsRunning() || s.shutdown ||
+		s.IsStandby() {
+		return
+	}
+	if !slices.ContainsFunc(l.Conns, func(c any) bool {
+		pc, ok := c.(turn.PacketConnConfig)
+		return ok && pc.PacketConn == conn
+	}) {
+		return
+	}
+
+	s.log.Errorf("Read loop of listener %q exited on a panic, restarting listener", name)
+	if err := s.restartListener(l); err != nil {
+		s.log.Errorf("Could not restart listener %q: %s", name, err.Error())
+		return
+	}
+	s.log.Infof("Listener %q restarted", name)
+}
+
+// RecoverPacketConn is a net.PacketConn that recovers from panics in the PacketConn decorators
+// stacked below it, i.e., the packet processing done inside ReadFrom and WriteTo, so that a
+// malformed packet triggering a bug there cannot take down the entire gateway. A panic is logged
+// with the stack trace, and the packet is dropped on read or the write fails. Panics in the read
+// loop of the TURN server processing the packet after ReadFrom has returned are handled by the
+// TURN server, see recoverReadLoop.
+type RecoverPacketConn struct {
+	net.PacketConn
+	name, component string
+	telemetry       *telemetry.Telemetry
+	log             logging.LeveledLogger
+}
+
+// NewRecoverPacketConn decorates a PacketConn with panic recovery.
+func NewRecoverPacketConn(c net.PacketConn, name, component string, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &RecoverPacketConn{
+		PacketConn: c,
+		name:       name,
+		component:  component,
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn, dropping the packets that trigger a panic and reading the
+// next packet.
+func (c *RecoverPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err, panicked := c.readFrom(p)
+		if !panicked {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *RecoverPacketConn) readFrom(p []byte) (n int, addr net.Addr, err error, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			util.ReportPanic(c.log, c.telemetry, c.name, c.component, r)
+			panicked = true
+		}
+	}()
+	n, addr, err = c.PacketConn.ReadFrom(p)
+	return
+}
+
+// WriteTo writes to the PacketConn, returning an error if the write triggers a panic.
+func (c *RecoverPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			util.ReportPanic(c.log, c.telemetry, c.name, c.component, r)
+			n, err = 0, errRecoveredPanic
+		}
+	}()
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// recoverListener is a net.Listener that recovers from panics in the processing of the
+// connections of a TCP, TLS or DTLS listener. A connection that triggers a panic is closed.
+type recoverListener struct {
+	net.Listener
+	name      string
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// newRecoverListener decorates a listener with panic recovery.
+func newRecoverListener(l net.Listener, name string, t *telemetry.Telemetry, log logging.LeveledLogger) net.Listener {
+	return &recoverListener{Listener: l, name: name, telemetry: t, log: log}
+}
+
+func (l *recoverListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	return &recoverConn{Conn: conn, listener: l}, nil
+}
+
+type recoverConn struct {
+	net.Conn
+	listener *recoverListener
+}
+
+func (c *recoverConn) recover(r any) error {
+	util.ReportPanic(c.listener.log, c.listener.telemetry, c.listener.name,
+		panicComponentConnection, r)
+	c.Conn.Close() //nolint:errcheck
+	return errRecoveredPanic
+}
+
+func (c *recoverConn) Read(p []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, c.recover(r)
+		}
+	}()
+	return c.Conn.Read(p)
+}
+
+func (c *recoverConn) Write(p []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, c.recover(r)
+		}
+	}()
+	return c.Conn.Write(p)
+}
+
+// recoverAuthHandler wraps an auth handler with panic recovery: requests triggering a panic are
+// rejected.
+func (s *Stunner) recoverAuthHandler(l *object.Listener, h a12n.AuthHandler) a12n.AuthHandler {
+	if h == nil {
+		return nil
+	}
+	return func(username, realm string, src net.Addr) (key []byte, ok bool) {
+		defer s.recoverPanic(l, panicComponentAuth)
+		return h(username, realm, src)
+	}
+}
+
+// recoverQuotaHandler wraps a quota handler with panic recovery: allocations triggering a panic
+// are rejected.
+func (s *Stunner) recoverQuotaHandler(l *object.Listener, h turn.QuotaHandler) turn.QuotaHandler {
+	return func(username, realm string, src net.Addr) (ok bool) {
+		defer s.recoverPanic(l, panicComponentQuota)
+		return h(username, realm, src)
+	}
+}
+
+// recoverPermissionHandler wraps a permission handler with panic recovery: permissions
+// triggering a panic are rejected.
+func (s *Stunner) recoverPermissionHandler(l *object.Listener, h a12n.PermissionHandler) a12n.PermissionHandler {
+	return func(src net.Addr, peer net.IP) (ok bool) {
+		defer s.recoverPanic(l, panicComponentPermission)
+		return h(src, peer)
+	}
+}
+
+// recoverEventHandlers wraps the TURN event handlers with panic recovery.
+func (s *Stunner) recoverEventHandlers(l *object.Listener, h turn.EventHandlers) turn.EventHandlers {
+	r := h
+	if f := h.OnAuth; f != nil {
+		r.OnAuth = func(src, dst net.Addr, proto, username, realm, method string, verdict bool) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm, method, verdict)
+		}
+	}
+	if f := h.OnAllocationCreated; f != nil {
+		r.OnAllocationCreated = func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, reqPort int) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm, relayAddr, reqPort)
+		}
+	}
+	if f := h.OnAllocationDeleted; f != nil {
+		r.OnAllocationDeleted = func(src, dst net.Addr, proto, username, realm string) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm)
+		}
+	}
+	if f := h.OnAllocationError; f != nil {
+		r.OnAllocationError = func(src, dst net.Addr, proto, message string) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, message)
+		}
+	}
+	if f := h.OnPermissionCreated; f != nil {
+		r.OnPermissionCreated = func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, peer net.IP) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm, relayAddr, peer)
+		}
+	}
+	if f := h.OnPermissionDeleted; f != nil {
+		r.OnPermissionDeleted = func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, peer net.IP) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm, relayAddr, peer)
+		}
+	}
+	if f := h.OnChannelCreated; f != nil {
+		r.OnChannelCreated = func(src, dst net.Addr, proto, username, realm string, relayAddr, peer net.Addr, chanNum uint16) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm, relayAddr, peer, chanNum)
+		}
+	}
+	if f := h.OnChannelDeleted; f != nil {
+		r.OnChannelDeleted = func(src, dst net.Addr, proto, username, realm string, relayAddr, peer net.Addr, chanNum uint16) {
+			defer s.recoverPanic(l, panicComponentEvent)
+			f(src, dst, proto, username, realm, relayAddr, peer, chanNum)
+		}
+	}
+	return r
+}
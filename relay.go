@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pion/logging"
@@ -15,6 +17,8 @@ import (
 
 	"github.com/l7mp/stunner/internal/object"
 	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	"github.com/l7mp/stunner/pkg/logger"
 )
 
@@ -41,7 +45,8 @@ type RelayGen struct {
 	// RelayAddress is the IP returned to the user when the relay is created.
 	RelayAddress net.IP
 
-	// Address is passed to Listen/ListenPacket when creating the Relay.
+	// Address is passed to Listen/ListenPacket when creating the Relay. Dual-stack relays bind
+	// to the IPv4-mapped form of a specific IPv4 address, which restricts them to IPv4 peers.
 	Address string
 
 	// ClusterCache is a cache that is used to couple relayed packets to clusters.
@@ -57,6 +62,38 @@ type RelayGen struct {
 	// Logger is a logger factory we can use to generate per-listener relay loggers.
 	Logger logger.LoggerFactory
 
+	// Mux, if not nil, multiplexes the relayed peer traffic onto the listener port.
+	Mux *SinglePortMux
+
+	// cascading, if not nil, reports whether the listener routes to a TURN cluster.
+	cascading func() bool
+
+	// claims, if not nil, tracks the Allocate request being handled, for the session affinity
+	// tokens and the port reservations.
+	claims *allocClaims
+
+	// sessions, if not nil, keeps the relay sockets reserved for the session affinity tokens.
+	sessions *sessionTokens
+
+	// reservations, if not nil, keeps the relay ports reserved with RESERVATION-TOKEN.
+	reservations *portReservations
+
+	// ports, if not nil, leases the relay ports from the relay port ranges of the listener.
+	ports *relayPortPool
+
+	// pins, if not nil, keeps the relay ports pinned to the users.
+	pins *relayPortPins
+
+	detectOnce       sync.Once
+	detectedDatagram int
+
+	tap       *tapRegistry
+	upgrade   *upgradeRegistry
+	idle      *idleRegistry
+	talkers   *talkerRegistry
+	toggles   *listenerToggles
+	faults    *faultInjector
+	clock     Clock
 	telemetry *telemetry.Telemetry
 }
 
@@ -69,6 +106,7 @@ func NewRelayGen(l *object.Listener, t *telemetry.Telemetry, logger logger.Logge
 		Net:          l.Net,
 		Logger:       logger,
 		telemetry:    t,
+		clock:        util.NewRealClock(),
 	}
 }
 
@@ -84,12 +122,87 @@ func (r *RelayGen) AllocatePacketConn(network string, requestedPort int) (net.Pa
 		requestedPort = 0
 	}
 
-	conn, err := r.Net.ListenPacket(network, fmt.Sprintf("%s:%d", r.Address, requestedPort))
-	if err != nil {
-		return nil, nil, err
+	if r.Mux != nil {
+		conn := NewPortRangePacketConn(r.egress(r.cascade(r.mtu(r.Mux.NewRelayConn()))), r.PortRangeChecker, r.telemetry,
+			r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
+		relayAddr := &net.UDPAddr{IP: r.RelayAddress, Port: r.Listener.Port}
+		return r.decorate(conn, relayAddr), relayAddr, nil
+	}
+
+	// a dual-stack relay socket can reach both IPv4 and IPv6 peers
+	address := r.Address
+	if r.Listener.DualStackRelay || r.Listener.NAT64Prefix != nil {
+		network, address = "udp", dualStackAddress(r.Address)
+	}
+
+	// the relay address pinned to the user, if any, overrides the EVEN-PORT and
+	// RESERVATION-TOKEN attributes and the session tokens
+	pin := r.pinned()
+
+	if r.claims != nil && pin == nil {
+		if claim := r.claims.get(); claim.evenPort && claim.held == nil && requestedPort == 0 {
+			// the TURN server is looking for an even port
+			if r.reservations == nil {
+				conn, err := r.listen(network, address, 0)
+				if err != nil {
+					return nil, nil, err
+				}
+				return conn, conn.LocalAddr(), nil
+			}
+			return r.allocateEvenPort(network, address)
+		}
 	}
 
-	conn = NewPortRangePacketConn(conn, r.PortRangeChecker, r.telemetry,
+	// the even port or the reserved port of the client, if any
+	var conn net.PacketConn
+	var err error
+	if pin == nil {
+		if conn, err = r.claimedRelay(requestedPort); err != nil {
+			return nil, nil, err
+		}
+	}
+	if conn == nil {
+		var reserved net.PacketConn
+		if pin == nil {
+			reserved = r.sessions.reclaim()
+		}
+		if reserved != nil {
+			// the client reclaims its relay address with a session token
+			conn = reserved
+		} else if f := r.inheritedRelay(); f != nil {
+			// restoring an allocation inherited from the old process in a hitless upgrade
+			conn, err = net.FilePacketConn(f)
+			f.Close() //nolint:errcheck
+		} else if pin != nil {
+			// the user is pinned to a fixed relay port
+			conn, err = r.listenPinned(network, address, pin)
+		} else {
+			conn, err = r.listen(network, address, requestedPort)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if r.upgrade != nil {
+		r.upgrade.addRelay(r.Listener.Name, conn)
+	}
+
+	if r.Listener.PathMTUDiscovery {
+		if err := r.setPathMTUDiscovery(conn); err != nil {
+			r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)).Warnf(
+				"Could not enable path MTU discovery: %s", err.Error())
+		}
+	}
+
+	if r.sessions != nil && pin == nil {
+		conn = r.sessions.track(conn)
+	}
+
+	if prefix := r.Listener.NAT64Prefix; prefix != nil {
+		conn = NewNAT64PacketConn(conn, prefix)
+	}
+
+	conn = NewPortRangePacketConn(r.egress(r.cascade(r.mtu(conn))), r.PortRangeChecker, r.telemetry,
 		r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
 
 	relayAddr, ok := conn.LocalAddr().(*net.UDPAddr)
@@ -98,7 +211,156 @@ func (r *RelayGen) AllocatePacketConn(network string, requestedPort int) (net.Pa
 	}
 
 	relayAddr.IP = r.RelayAddress
-	return conn, relayAddr, nil
+	if pin != nil && pin.IP != nil {
+		relayAddr.IP = pin.IP
+	}
+	return r.decorate(conn, relayAddr), relayAddr, nil
+}
+
+// dualStackAddress returns the address to bind dual-stack relay sockets to: the IPv6 wildcard
+// address for an unspecified address, and the IPv4-mapped IPv6 form of a specific IPv4 address, in
+// which case the relay sockets can reach IPv4 peers only.
+func dualStackAddress(address string) string {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil || ip.IsUnspecified():
+		return "::"
+	case ip.To4() != nil:
+		return "::ffff:" + ip.To4().String()
+	default:
+		return ip.String()
+	}
+}
+
+// listen binds a new relay socket, to a port leased from the relay port ranges of the listener if
+// any.
+func (r *RelayGen) listen(network, address string, port int) (net.PacketConn, error) {
+	bind := func(port int) (net.PacketConn, error) {
+		return r.Net.ListenPacket(network, net.JoinHostPort(address, fmt.Sprintf("%d", port)))
+	}
+	if r.ports == nil || (port != 0 && !r.ports.contains(port)) {
+		return bind(port)
+	}
+
+	conn, err := r.ports.lease(port, bind)
+	if errors.Is(err, errRelayPortsExhausted) {
+		r.telemetry.IncrementRelayPortsExhausted(r.Listener.Name)
+	}
+	return conn, err
+}
+
+// inheritedRelay returns the relay socket inherited from the old process, if any.
+func (r *RelayGen) inheritedRelay() *os.File {
+	if r.upgrade == nil {
+		return nil
+	}
+	return r.upgrade.takeRelay(r.Listener.Name)
+}
+
+// mtu drops the datagrams exceeding the maximum datagram size or the path MTU, if enabled.
+func (r *RelayGen) mtu(conn net.PacketConn) net.PacketConn {
+	size := r.Listener.MaxDatagramSize
+	if size == stnrv1.MaxDatagramSizeAuto {
+		size = r.detectMaxDatagramSize()
+	}
+	if size <= 0 && !r.Listener.PathMTUDiscovery {
+		return conn
+	}
+	return NewMTUPacketConn(conn, r.Listener.Name, size, r.telemetry,
+		r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
+}
+
+// detectMaxDatagramSize detects the maximum datagram size from the MTU of the network interfaces
+// on first use.
+func (r *RelayGen) detectMaxDatagramSize() int {
+	r.detectOnce.Do(func() {
+		log := r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name))
+		ipv6 := r.Listener.DualStackRelay || r.Listener.NAT64Prefix != nil
+		size, err := detectMaxDatagramSize(ipv6)
+		if err != nil {
+			log.Warnf("Could not detect the maximum datagram size, clamping disabled: %s",
+				err.Error())
+			return
+		}
+		log.Infof("Detected maximum relayed datagram size: %d bytes", size)
+		r.detectedDatagram = size
+	})
+	return r.detectedDatagram
+}
+
+// setPathMTUDiscovery enables path MTU discovery on a relay socket.
+func (r *RelayGen) setPathMTUDiscovery(conn net.PacketConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.New("not a system socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return setPathMTUDiscovery(raw)
+}
+
+// cascade relays the packets sent to the peers of TURN clusters through the upstream TURN
+// server of the cluster, if the listener routes to a TURN cluster.
+func (r *RelayGen) cascade(conn net.PacketConn) net.PacketConn {
+	if r.cascading == nil || !r.cascading() {
+		return conn
+	}
+	return NewCascadePacketConn(conn, r.PortRangeChecker, r.Net, r.telemetry, r.Logger,
+		r.Logger.NewLogger(fmt.Sprintf("cascade-%s", r.Listener.Name)))
+}
+
+// egress adds a pacer and an egress queue to a peer-facing relay connection, if enabled. The queue
+// sits below the port range filter, so prohibited packets are rejected synchronously and never
+// queued, and above the pacer, so that packets are paced out of the queue without blocking the
+// TURN server.
+func (r *RelayGen) egress(conn net.PacketConn) net.PacketConn {
+	if r.Listener.PacingRate > 0 {
+		conn = NewPacedPacketConn(conn, r.Listener.PacingRate)
+	}
+	if r.Listener.EgressQueueLength <= 0 {
+		return conn
+	}
+	return NewEgressQueuePacketConn(conn, r.Listener.Name, r.Listener.EgressQueueLength,
+		r.Listener.EgressDropPolicy, r.telemetry,
+		r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
+}
+
+// decorate adds fault injection (in debug builds), RTP inspection, packet tapping, session
+// traffic accounting, stale session detection and the session duration limit to a relay
+// connection, if enabled, and protects the relay connection from panics. The
+// relay connection is tracked at the bottom of the stack, so that closing the decorators from
+// above untracks it as well.
+func (r *RelayGen) decorate(conn net.PacketConn, relayAddr net.Addr) net.PacketConn {
+	if r.toggles != nil {
+		conn = r.toggles.track(r.Listener.Name, conn)
+	}
+	conn = r.faults.decorate(conn)
+	if r.Listener.RTPInspection {
+		conn = NewRTPInspectorPacketConn(conn, r.Listener, r.telemetry,
+			r.Logger.NewLogger(fmt.Sprintf("rtp-%s", r.Listener.Name)))
+	}
+	// relay addresses are not unique in single-port mode, so sessions cannot be identified
+	if r.tap != nil && r.tap.getSink() != nil && r.Mux == nil {
+		conn = newTapPacketConn(conn, relayAddr, r.tap)
+	}
+	if r.talkers != nil && r.Mux == nil {
+		conn = r.talkers.track(r.Listener.Name, relayAddr, conn)
+	}
+	// sessions cannot be identified by the relay address in single-port mode
+	if d := r.Listener.IdleTimeout; d > 0 && r.idle != nil && r.Mux == nil {
+		c := NewIdlePacketConn(conn, r.Listener.Name, d, r.telemetry,
+			r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
+		r.idle.addRelay(relayAddr, c)
+		conn = c
+	}
+	if d := r.Listener.MaxSessionDuration; d > 0 {
+		conn = NewSessionLimitPacketConn(conn, r.Listener.Name, d, r.clock, r.telemetry,
+			r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
+	}
+	return NewRecoverPacketConn(conn, r.Listener.Name, panicComponentRelay, r.telemetry,
+		r.Logger.NewLogger(fmt.Sprintf("relay-%s", r.Listener.Name)))
 }
 
 // AllocateConn generates a new Conn to receive traffic on and the IP/Port to populate the
@@ -108,8 +370,8 @@ func (g *RelayGen) AllocateConn(network string, requestedPort int) (net.Conn, ne
 }
 
 // GenPortRangeChecker finds the cluster that is responsible for routing the packet and checks
-// whether the peer address is in the port range specified for the cluster. The RelayGen caches
-// recent hits for simplicity.
+// whether the peer address is in the port range specified for the cluster, see routingCluster for
+// the precedence rules. The RelayGen caches recent hits for simplicity.
 func (s *Stunner) GenPortRangeChecker(g *RelayGen) PortRangeChecker {
 	return func(addr net.Addr) (*object.Cluster, bool) {
 		u, ok := addr.(*net.UDPAddr)
@@ -124,17 +386,27 @@ func (s *Stunner) GenPortRangeChecker(g *RelayGen) PortRangeChecker {
 			// cache hit
 			cluster = c.(*object.Cluster)
 		} else {
+			// block
+			cluster = s.blockingCluster(g.Listener, u.IP)
 			// route
-			for _, r := range g.Listener.Routes {
-				c := s.GetCluster(r)
-				if c != nil && c.Route(u.IP) {
-					cluster = c
-					g.ClusterCache.Add(ip, c)
-					break
-				}
+			if cluster == nil {
+				cluster = s.routingCluster(g.Listener, u.IP, nil)
+			}
+			if cluster != nil {
+				g.ClusterCache.Add(ip, cluster)
 			}
 		}
 
+		if cluster != nil && cluster.Type == stnrv1.ClusterTypeBlock {
+			if cluster.Blocks(u.IP, u.Port) {
+				s.log.Debugf("blocked packet on listener %q to peer %s by cluster %q",
+					g.Listener.Name, u.String(), cluster.Name)
+				return nil, false
+			}
+			// the port is not blocked: fall back to the clusters that admit the peer
+			cluster = s.routingCluster(g.Listener, u.IP, nil)
+		}
+
 		if cluster != nil {
 			return cluster, cluster.Match(u.IP, u.Port)
 		}
@@ -179,6 +451,15 @@ func (c *PortRangePacketConn) WriteTo(p []byte, peerAddr net.Addr) (int, error)
 	if n > 0 {
 		c.telemetry.IncrementBytes(cluster.Name, telemetry.ClusterType, telemetry.Outgoing, uint64(n))
 		c.telemetry.IncrementPackets(cluster.Name, telemetry.ClusterType, telemetry.Outgoing, 1)
+		c.countTarget(cluster, peerAddr, telemetry.Outgoing, n)
+	}
+
+	if m := cluster.Mirror(); m != nil && n > 0 {
+		if m.Send(p[:n], peerAddr) {
+			c.telemetry.IncrementMirrored(cluster.Name, "sent")
+		} else {
+			c.telemetry.IncrementMirrored(cluster.Name, "dropped")
+		}
 	}
 
 	return n, err
@@ -211,12 +492,28 @@ func (c *PortRangePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
 		if n > 0 {
 			c.telemetry.IncrementBytes(cluster.Name, telemetry.ClusterType, telemetry.Incoming, uint64(n))
 			c.telemetry.IncrementPackets(cluster.Name, telemetry.ClusterType, telemetry.Incoming, 1)
+			c.countTarget(cluster, peerAddr, telemetry.Incoming, n)
 		}
 
 		return n, peerAddr, nil
 	}
 }
 
+// countTarget updates the per-target metrics for packets relayed to or from a remote cluster
+// target.
+func (c *PortRangePacketConn) countTarget(cluster *object.Cluster, peerAddr net.Addr, d telemetry.Direction, n int) {
+	if len(cluster.Targets) == 0 {
+		return
+	}
+	u, ok := peerAddr.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	if target := cluster.Target(u.IP); target != "" {
+		c.telemetry.IncrementTarget(cluster.Name, target, d, uint64(n))
+	}
+}
+
 func (c *PortRangePacketConn) SetReadDeadline(t time.Time) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -0,0 +1,297 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+var errRelayPortsExhausted = errors.New("relay port ranges exhausted")
+
+// RelayPortExhaustionEvent describes a listener that has run out of relay ports.
+type RelayPortExhaustionEvent struct {
+	// Time is the time the relay port ranges were found exhausted.
+	Time time.Time
+	// Listener is the name of the listener.
+	Listener string
+	// Ranges are the relay port ranges of the listener in the order of use, in the format
+	// "min-max".
+	Ranges []string
+	// Used is the number of relay ports leased to allocations. If this is less than the total
+	// size of the ranges then the rest of the ports are bound by other sockets.
+	Used int
+}
+
+// RelayPortExhaustionHandler is called when all relay port ranges of a listener become exhausted.
+// The handler is called again only after a relay port has been released. The handler is called
+// from the TURN server, so it must not block.
+type RelayPortExhaustionHandler = func(event RelayPortExhaustionEvent)
+
+// relayPortRange is a relay port range with a round-robin cursor.
+type relayPortRange struct {
+	stnrv1.PortRange
+	next int // the port to try first
+}
+
+// relayPortPool leases the ports of the relay port ranges of a listener to the allocations.
+type relayPortPool struct {
+	listener    string
+	ranges      []*relayPortRange // in the order of use
+	used        map[int]bool
+	pinned      map[int]bool // leased only to the users the ports are pinned to
+	exhausted   bool
+	onExhausted func(used int)
+	lock        sync.Mutex
+}
+
+func newRelayPortPool(listener string, ranges []stnrv1.PortRange, onExhausted func(used int)) *relayPortPool {
+	p := &relayPortPool{listener: listener, used: map[int]bool{}, pinned: map[int]bool{},
+		onExhausted: onExhausted}
+	for _, r := range ranges {
+		p.ranges = append(p.ranges, &relayPortRange{PortRange: r, next: r.Min})
+	}
+	return p
+}
+
+// contains returns true if a port falls into one of the ranges.
+func (p *relayPortPool) contains(port int) bool {
+	for _, r := range p.ranges {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// pin reserves a port for a pinned user: the port is not leased to other allocations.
+func (p *relayPortPool) pin(port int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pinned[port] = true
+}
+
+// usage returns the usage of the ranges. Pinned ports are counted as used only if leased, and
+// never as free.
+func (p *relayPortPool) usage() []RelayPortUsage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	ret := make([]RelayPortUsage, len(p.ranges))
+	for i, r := range p.ranges {
+		ret[i] = RelayPortUsage{Listener: p.listener, MinPort: r.Min, MaxPort: r.Max,
+			Free: r.Size()}
+	}
+	for i, r := range p.ranges {
+		for port := range p.used {
+			if r.Contains(port) {
+				ret[i].Used++
+				ret[i].Free--
+			}
+		}
+		for port := range p.pinned {
+			if r.Contains(port) && !p.used[port] {
+				ret[i].Free--
+			}
+		}
+	}
+	return ret
+}
+
+// lease binds a relay socket to a free port using the given bind function, or to the given port
+// if nonzero. The ranges are tried in order, so a range is used only when all the preceding
+// ranges are exhausted. Ports that cannot be bound, e.g., because they are used by other sockets,
+// and pinned ports are skipped. Returns errRelayPortsExhausted if no port could be bound.
+func (p *relayPortPool) lease(port int, bind func(port int) (net.PacketConn, error)) (net.PacketConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if port != 0 {
+		if p.pinned[port] {
+			return nil, syscall.EADDRINUSE
+		}
+		return p.leasePort(port, bind)
+	}
+
+	for _, r := range p.ranges {
+		// round-robin over the range, so that recently released ports are reused last
+		for i := 0; i < r.Size(); i++ {
+			port := r.next
+			r.next++
+			if r.next > r.Max {
+				r.next = r.Min
+			}
+			if p.used[port] || p.pinned[port] {
+				continue
+			}
+			conn, err := bind(port)
+			if err != nil {
+				if errors.Is(err, syscall.EADDRINUSE) {
+					continue
+				}
+				return nil, err
+			}
+			return p.track(port, conn), nil
+		}
+	}
+
+	if !p.exhausted {
+		p.exhausted = true
+		if p.onExhausted != nil {
+			p.onExhausted(len(p.used))
+		}
+	}
+	return nil, errRelayPortsExhausted
+}
+
+// leasePinned binds a relay socket to a pinned port using the given bind function.
+func (p *relayPortPool) leasePinned(port int, bind func(port int) (net.PacketConn, error)) (net.PacketConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.leasePort(port, bind)
+}
+
+func (p *relayPortPool) leasePort(port int, bind func(port int) (net.PacketConn, error)) (net.PacketConn, error) {
+	if p.used[port] {
+		return nil, syscall.EADDRINUSE
+	}
+	conn, err := bind(port)
+	if err != nil {
+		return nil, err
+	}
+	return p.track(port, conn), nil
+}
+
+func (p *relayPortPool) track(port int, conn net.PacketConn) net.PacketConn {
+	p.used[port] = true
+	return &leasedPacketConn{PacketConn: conn, pool: p, port: port}
+}
+
+func (p *relayPortPool) release(port int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.used, port)
+	p.exhausted = false
+}
+
+// leasedPacketConn is a relay socket bound to a port leased from a relay port pool. Closing the
+// socket returns the port to the pool.
+type leasedPacketConn struct {
+	net.PacketConn
+	pool *relayPortPool
+	port int
+	once sync.Once
+}
+
+// Close closes the relay socket and releases the port.
+func (c *leasedPacketConn) Close() error {
+	err := c.PacketConn.Close()
+	c.once.Do(func() { c.pool.release(c.port) })
+	return err
+}
+
+// SyscallConn returns the raw connection of the relay socket, for hitless upgrades and path MTU
+// discovery.
+func (c *leasedPacketConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.PacketConn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("not a system socket")
+	}
+	return sc.SyscallConn()
+}
+
+// relayPortRegistry keeps the relay port pools of the listeners with relay port ranges, keyed by
+// listener name.
+type relayPortRegistry struct {
+	pools map[string]*relayPortPool
+	lock  sync.Mutex
+}
+
+func newRelayPortRegistry() *relayPortRegistry {
+	return &relayPortRegistry{pools: map[string]*relayPortPool{}}
+}
+
+// set installs the relay port pool of a listener, removing the pool if nil.
+func (r *relayPortRegistry) set(listener string, pool *relayPortPool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if pool == nil {
+		delete(r.pools, listener)
+		return
+	}
+	r.pools[listener] = pool
+}
+
+// RelayPortUsage is the usage of a relay port range of a listener.
+type RelayPortUsage struct {
+	// Listener is the name of the listener.
+	Listener string
+	// MinPort and MaxPort are the bounds of the relay port range.
+	MinPort, MaxPort int
+	// Used is the number of relay ports leased to allocations.
+	Used int
+	// Free is the number of relay ports available to allocations: neither leased nor pinned to
+	// a user.
+	Free int
+}
+
+func (r *relayPortRegistry) usage() []RelayPortUsage {
+	r.lock.Lock()
+	pools := make([]*relayPortPool, 0, len(r.pools))
+	for _, p := range r.pools {
+		pools = append(pools, p)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(pools, func(i, j int) bool { return pools[i].listener < pools[j].listener })
+	ret := []RelayPortUsage{}
+	for _, p := range pools {
+		ret = append(ret, p.usage()...)
+	}
+	return ret
+}
+
+// GetRelayPortUsage returns the number of used and free relay ports of the listeners with relay
+// port ranges, per range in the order of use.
+func (s *Stunner) GetRelayPortUsage() []RelayPortUsage {
+	return s.relayPorts.usage()
+}
+
+// SetRelayPortExhaustionHandler registers a handler that is called when the relay port ranges of a
+// listener become exhausted. Set to nil to remove the handler.
+func (s *Stunner) SetRelayPortExhaustionHandler(h RelayPortExhaustionHandler) {
+	if h == nil {
+		s.relayPortHook.Store(nil)
+		return
+	}
+	s.relayPortHook.Store(&h)
+}
+
+// newRelayPortPool creates the relay port pool of a listener, or returns nil if the listener has
+// no relay port ranges.
+func (s *Stunner) newRelayPortPool(name string, ranges []stnrv1.PortRange) *relayPortPool {
+	if len(ranges) == 0 {
+		s.relayPorts.set(name, nil)
+		return nil
+	}
+
+	rs := make([]string, len(ranges))
+	for i, r := range ranges {
+		rs[i] = r.String()
+	}
+	pool := newRelayPortPool(name, ranges, func(used int) {
+		s.log.Errorf("Relay port ranges [%s] of listener %q exhausted (%d ports leased): "+
+			"refusing new allocations", strings.Join(rs, ","), name, used)
+		e := RelayPortExhaustionEvent{Time: time.Now(), Listener: name,
+			Ranges: append([]string{}, rs...), Used: used}
+		if h := s.relayPortHook.Load(); h != nil {
+			(*h)(e)
+		}
+	})
+	s.relayPorts.set(name, pool)
+	return pool
+}
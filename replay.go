@@ -0,0 +1,184 @@
+package stunner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+
+	"github.com/l7mp/stunner/pkg/logger"
+)
+
+// ReplayTimeout is the time Replay waits for the response to a replayed request.
+var ReplayTimeout = 250 * time.Millisecond
+
+// ReplayResult is the outcome of replaying a captured STUN message.
+type ReplayResult struct {
+	// Request is the type of the replayed message, e.g., "Allocate request".
+	Request string `json:"request"`
+	// Response is the type of the response, or empty if no response was received.
+	Response string `json:"response,omitempty"`
+	// ErrorCode is the error code of an error response, zero otherwise.
+	ErrorCode int `json:"errorCode,omitempty"`
+}
+
+// String stringifies a replay result.
+func (r ReplayResult) String() string {
+	switch {
+	case r.Response == "":
+		return fmt.Sprintf("%s: <none>", r.Request)
+	case r.ErrorCode != 0:
+		return fmt.Sprintf("%s: %s (%d)", r.Request, r.Response, r.ErrorCode)
+	default:
+		return fmt.Sprintf("%s: %s", r.Request, r.Response)
+	}
+}
+
+// Replay feeds the captured messages of a trace (see Capture) into the dispatch path of the given
+// listener, one by one in the order of the trace, and returns the response received to each
+// message. Messages are processed by a separate TURN server running the authentication, quota and
+// permission handlers of the listener, so replaying does not interfere with live traffic, but the
+// allocations created during the replay do count against the quotas. Since the responses do not
+// depend on the timing of the trace, replaying a trace yields deterministic results for a given
+// config, which allows real-world traffic traces to be turned into regression tests.
+func (s *Stunner) Replay(ctx context.Context, listener string, records []CaptureRecord) ([]ReplayResult, error) {
+	l := s.GetListener(listener)
+	if l == nil {
+		return nil, fmt.Errorf("unknown listener %q", listener)
+	}
+
+	relay := NewRelayGen(l, s.telemetry, s.logger)
+	relay.PortRangeChecker = s.GenPortRangeChecker(relay)
+	conn := newReplayConn(&net.UDPAddr{IP: l.Addr, Port: l.Port})
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:         s.GetRealm(),
+		AuthHandler:   s.NewAuthHandler(),
+		EventHandlers: s.NewEventHandler(l),
+		QuotaHandler:  s.NewListenerQuotaHandler(l),
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            conn,
+			RelayAddressGenerator: relay,
+			PermissionHandler:     s.NewPermissionHandler(l),
+		}},
+		LoggerFactory: logger.NewRateLimitedLoggerFactory(s.logger, LogRateLimit, LogBurst),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot set up TURN server for replay: %w", err)
+	}
+	defer server.Close() //nolint:errcheck
+
+	results := []ReplayResult{}
+	for i, rec := range records {
+		m := &stun.Message{Raw: append([]byte{}, rec.Message...)}
+		if err := m.Decode(); err != nil {
+			return nil, fmt.Errorf("invalid message in capture record %d: %w", i+1, err)
+		}
+		client, err := net.ResolveUDPAddr("udp", rec.Client)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client address in capture record %d: %w", i+1, err)
+		}
+
+		select {
+		case conn.in <- replayPacket{buf: m.Raw, addr: client}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		res := ReplayResult{Request: m.Type.String()}
+		// indications have no response
+		if m.Type.Class == stun.ClassRequest {
+			res.Response, res.ErrorCode, err = conn.waitResponse(ctx, m.TransactionID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+type replayPacket struct {
+	buf  []byte
+	addr net.Addr
+}
+
+// replayConn is a net.PacketConn that feeds the replayed messages into the TURN server and
+// collects the responses.
+type replayConn struct {
+	addr      net.Addr
+	in, out   chan replayPacket
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newReplayConn(addr net.Addr) *replayConn {
+	return &replayConn{
+		addr: addr,
+		in:   make(chan replayPacket),
+		out:  make(chan replayPacket, 16),
+		done: make(chan struct{}),
+	}
+}
+
+// waitResponse waits for the response to the request with the given transaction id and returns
+// the type and the error code of the response. Other messages (e.g., Data indications) are
+// ignored.
+func (c *replayConn) waitResponse(ctx context.Context, id [stun.TransactionIDSize]byte) (string, int, error) {
+	timer := time.NewTimer(ReplayTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case pkt := <-c.out:
+			m := &stun.Message{Raw: pkt.buf}
+			if err := m.Decode(); err != nil || m.TransactionID != id {
+				continue
+			}
+			code := 0
+			if m.Type.Class == stun.ClassErrorResponse {
+				var errCode stun.ErrorCodeAttribute
+				if err := errCode.GetFrom(m); err == nil {
+					code = int(errCode.Code)
+				}
+			}
+			return m.Type.String(), code, nil
+		case <-timer.C:
+			return "", 0, nil
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		}
+	}
+}
+
+func (c *replayConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case pkt := <-c.in:
+		return copy(p, pkt.buf), pkt.addr, nil
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *replayConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case c.out <- replayPacket{buf: append([]byte{}, p...), addr: addr}:
+		return len(p), nil
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *replayConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr                { return c.addr }
+func (c *replayConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(_ time.Time) error { return nil }
@@ -0,0 +1,220 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// PortReservationTimeout is the time a relay port reserved with a RESERVATION-TOKEN is kept for
+// the client (RFC 5766, Section 6.2). Changes apply to the listeners started afterwards.
+var PortReservationTimeout = 30 * time.Second
+
+// evenPortAttempts is the number of attempts at binding an even relay port, and the next port if
+// reserved, before the Allocate request is rejected.
+const evenPortAttempts = 128
+
+var (
+	errNoEvenPort              = errors.New("failed to allocate an even relay port")
+	errInvalidReservationToken = errors.New("unknown or expired reservation token")
+)
+
+// portReservations implements the EVEN-PORT and the RESERVATION-TOKEN attributes (RFC 5766,
+// Sections 14.6 and 14.9) for a UDP listener: an Allocate request with an EVEN-PORT attribute
+// gets an even relay port, and if the R bit is set the next port is reserved for the client with
+// a token, which the client presents in a subsequent Allocate request to get the reserved port.
+type portReservations struct {
+	claims  *allocClaims
+	tokens  map[string]*portReservation // keyed by token
+	clients map[string]string           // the token of the port last reserved for each client
+	timeout time.Duration
+	closed  bool // the listener has been closed, no ports are reserved anymore
+	lock    sync.Mutex
+	log     logging.LeveledLogger
+}
+
+// portReservation is a relay socket reserved for a client.
+type portReservation struct {
+	token, client string
+	socket        net.PacketConn
+	timer         *time.Timer
+}
+
+func newPortReservations(claims *allocClaims, log logging.LeveledLogger) *portReservations {
+	r := &portReservations{
+		claims:  claims,
+		tokens:  map[string]*portReservation{},
+		clients: map[string]string{},
+		timeout: PortReservationTimeout,
+		log:     log,
+	}
+	claims.reservations = r
+	return r
+}
+
+// reserve keeps a relay socket for a client, returning the reservation token.
+func (r *portReservations) reserve(client string, socket net.PacketConn) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		socket.Close() //nolint:errcheck
+		return ""
+	}
+
+	res := &portReservation{token: randomHex(4), client: client, socket: socket}
+	res.timer = time.AfterFunc(r.timeout, func() { r.expire(res) })
+	r.tokens[res.token] = res
+	r.clients[client] = res.token
+
+	r.log.Debugf("Reserved relay address %s for client %s", socket.LocalAddr(), client)
+
+	return res.token
+}
+
+// take returns the relay socket reserved with a token and removes the reservation.
+func (r *portReservations) take(token string) (net.PacketConn, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	res, ok := r.tokens[token]
+	if !ok {
+		return nil, false
+	}
+	res.timer.Stop()
+	r.remove(res)
+
+	return res.socket, true
+}
+
+// forget stops reporting the last reservation of a client in the Allocate responses, called when
+// the client makes a new Allocate request with an EVEN-PORT attribute. The reservation itself is
+// kept.
+func (r *portReservations) forget(client string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.clients, client)
+}
+
+// tokenOf returns the token of the port last reserved for a client, if still reserved.
+func (r *portReservations) tokenOf(client string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.clients[client]
+}
+
+func (r *portReservations) remove(res *portReservation) {
+	delete(r.tokens, res.token)
+	if r.clients[res.client] == res.token {
+		delete(r.clients, res.client)
+	}
+}
+
+// expire releases a reserved relay socket that has not been claimed.
+func (r *portReservations) expire(res *portReservation) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.tokens[res.token] != res {
+		return
+	}
+	r.log.Debugf("Reservation of relay address %s for client %s expired",
+		res.socket.LocalAddr(), res.client)
+	r.remove(res)
+	res.socket.Close() //nolint:errcheck
+}
+
+// close releases the reserved relay sockets, called when the listener is closed.
+func (r *portReservations) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	for _, res := range r.tokens {
+		res.timer.Stop()
+		res.socket.Close() //nolint:errcheck
+	}
+	r.tokens = map[string]*portReservation{}
+	r.clients = map[string]string{}
+}
+
+// evenPortProbeConn is the even relay socket returned to the TURN server when it is looking for
+// an even port. The TURN server closes the socket right away and then asks for the port it has
+// found, so the socket is kept open until the allocation is created.
+type evenPortProbeConn struct {
+	net.PacketConn
+}
+
+// Close does not close the relay socket.
+func (c *evenPortProbeConn) Close() error {
+	return nil
+}
+
+// allocateEvenPort binds an even relay port for the Allocate request with an EVEN-PORT attribute
+// being handled, and if the R bit is set, reserves the next port for the client.
+func (r *RelayGen) allocateEvenPort(network, address string) (net.PacketConn, net.Addr, error) {
+	claim := r.claims.get()
+	r.reservations.forget(claim.client)
+
+	for i := 0; i < evenPortAttempts; i++ {
+		conn, err := r.listen(network, address, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		addr, ok := conn.LocalAddr().(*net.UDPAddr)
+		if !ok {
+			conn.Close() //nolint:errcheck
+			return nil, nil, errNilConn
+		}
+		if addr.Port%2 != 0 {
+			conn.Close() //nolint:errcheck
+			continue
+		}
+
+		if claim.reservePair {
+			next, err := r.listen(network, address, addr.Port+1)
+			if err != nil {
+				conn.Close() //nolint:errcheck
+				continue
+			}
+			r.reservations.reserve(claim.client, next)
+		}
+
+		r.claims.update(func(c *allocClaim) { c.held = conn })
+		return &evenPortProbeConn{PacketConn: conn}, addr, nil
+	}
+
+	return nil, nil, errNoEvenPort
+}
+
+// claimedRelay returns the relay socket for the Allocate request being handled if it has already
+// been bound: the even port found for an EVEN-PORT attribute, or the port reserved for the
+// RESERVATION-TOKEN attribute of the request. Returns nil if a new relay socket is to be bound.
+func (r *RelayGen) claimedRelay(requestedPort int) (net.PacketConn, error) {
+	if r.claims == nil {
+		return nil, nil
+	}
+	claim := r.claims.get()
+
+	if claim.held != nil {
+		if addr, ok := claim.held.LocalAddr().(*net.UDPAddr); ok && addr.Port == requestedPort {
+			r.claims.update(func(c *allocClaim) { c.held = nil })
+			return claim.held, nil
+		}
+	}
+
+	if claim.reservationToken != "" {
+		conn, ok := r.reservations.take(claim.reservationToken)
+		if !ok {
+			r.reservations.log.Debugf("Unknown or expired reservation token presented by "+
+				"client %s", claim.client)
+			return nil, errInvalidReservationToken
+		}
+		return conn, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,49 @@
+package stunner
+
+import (
+	"net"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// When the clusters a listener routes to overlap, the cluster responsible for a peer is chosen by
+// the following precedence rules:
+// - BLOCK clusters beat the clusters that admit the peer (deny beats allow),
+// - among the clusters that admit the peer the one with the longest matching endpoint prefix wins,
+// - ties are broken by the order of the routes of the listener.
+
+// blockingCluster returns the first BLOCK cluster of a listener that matches a peer IP on any
+// port, or nil if there is none.
+func (s *Stunner) blockingCluster(l *object.Listener, peer net.IP) *object.Cluster {
+	for _, r := range l.Routes {
+		if c := s.GetCluster(r); c != nil && c.Blocks(peer, 0) {
+			return c
+		}
+	}
+	return nil
+}
+
+// routingCluster returns the cluster of a listener that admits a peer IP with the longest
+// matching endpoint prefix, or nil if there is none. If filter is not nil then only the clusters
+// for which filter returns true are considered.
+func (s *Stunner) routingCluster(l *object.Listener, peer net.IP, filter func(*object.Cluster) bool) *object.Cluster {
+	return s.routeCluster(l.Routes, peer, filter)
+}
+
+// routeCluster is like routingCluster but considers the given routes instead of the routes of a
+// listener.
+func (s *Stunner) routeCluster(routes []string, peer net.IP, filter func(*object.Cluster) bool) *object.Cluster {
+	var cluster *object.Cluster
+	best := -1
+	for _, r := range routes {
+		c := s.GetCluster(r)
+		if c == nil || (filter != nil && !filter(c)) {
+			continue
+		}
+		// strictly longer: the first route wins ties
+		if n := c.RoutePrefixLen(peer); n > best {
+			cluster, best = c, n
+		}
+	}
+	return cluster
+}
@@ -0,0 +1,76 @@
+package stunner
+
+import (
+	"net"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/rtpstats"
+	"github.com/l7mp/stunner/internal/telemetry"
+)
+
+// RTPInspectorPacketConn is a relay net.PacketConn that passively classifies the relayed traffic
+// and tracks the packet loss and jitter of RTP (and SRTP) streams, based on the cleartext RTP
+// headers. Packets are never modified. Stream statistics are logged when the relay connection is
+// closed.
+type RTPInspectorPacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	rx, tx    *rtpstats.Tracker
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewRTPInspectorPacketConn decorates a relay PacketConn with RTP inspection.
+func NewRTPInspectorPacketConn(c net.PacketConn, l *object.Listener, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &RTPInspectorPacketConn{
+		PacketConn: c,
+		listener:   l,
+		rx:         rtpstats.NewTracker(),
+		tx:         rtpstats.NewTracker(),
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// ReadFrom reads a packet received from a peer.
+func (c *RTPInspectorPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if n > 0 {
+		if lost, ok := c.rx.Process(p[:n]); ok {
+			c.telemetry.IncrementRTP(c.listener.Name, telemetry.Incoming, lost)
+		}
+	}
+	return n, addr, err
+}
+
+// WriteTo writes a packet to a peer.
+func (c *RTPInspectorPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if n > 0 {
+		if lost, ok := c.tx.Process(p[:n]); ok {
+			c.telemetry.IncrementRTP(c.listener.Name, telemetry.Outgoing, lost)
+		}
+	}
+	return n, err
+}
+
+// Stats returns the statistics of the RTP streams received from the peers (rx) and sent to the
+// peers (tx).
+func (c *RTPInspectorPacketConn) Stats() (rx, tx []rtpstats.StreamStats) {
+	return c.rx.Stats(), c.tx.Stats()
+}
+
+// Close closes the relay connection and logs the RTP stream statistics.
+func (c *RTPInspectorPacketConn) Close() error {
+	rx, tx := c.Stats()
+	for _, s := range rx {
+		c.log.Infof("relay %s: RTP stream from peer: %s", c.LocalAddr().String(), s.String())
+	}
+	for _, s := range tx {
+		c.log.Infof("relay %s: RTP stream to peer: %s", c.LocalAddr().String(), s.String())
+	}
+
+	return c.PacketConn.Close()
+}
@@ -0,0 +1,297 @@
+package stunner
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/util"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// ClientRTTTableSize is the maximum number of client networks tracked in the round-trip time
+// table. Above this limit the least recently measured network is evicted.
+var ClientRTTTableSize = 4096
+
+// Methods for measuring the round-trip time of a client.
+const (
+	rttMethodSTUN = "stun"
+	rttMethodTCP  = "tcp"
+)
+
+const (
+	// challengeTrackerSize is the maximum number of pending challenges tracked per listener.
+	challengeTrackerSize = 1 << 14
+	// challengeTimeout is the time after which a challenge not retried by the client is
+	// forgotten.
+	challengeTimeout = 5 * time.Second
+	// rttGain is the gain of the exponentially weighted moving average of the round-trip times
+	// (same as the one used by TCP, see RFC 6298).
+	rttGain = 0.125
+)
+
+// RTTRecorder is called with each round-trip time measured between a client and a listener.
+type RTTRecorder = func(client net.Addr, method string, rtt time.Duration)
+
+type clientRTT struct {
+	samples         uint64
+	srtt, min, last time.Duration
+	updated         time.Time
+}
+
+// rttRegistry keeps the round-trip time statistics per client network and measurement method.
+type rttRegistry struct {
+	networks map[string]*clientRTT // keyed by network and method
+	lock     sync.Mutex
+}
+
+func newRTTRegistry() *rttRegistry {
+	return &rttRegistry{networks: map[string]*clientRTT{}}
+}
+
+// clientNetwork returns the network of a client: the /24 prefix of IPv4 and the /48 prefix of IPv6
+// addresses.
+func clientNetwork(addr net.Addr) string {
+	ip := util.GetIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+func (r *rttRegistry) add(network, method string, rtt time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := network + " " + method
+	e, ok := r.networks[key]
+	if !ok {
+		if len(r.networks) >= ClientRTTTableSize {
+			r.evict()
+		}
+		e = &clientRTT{srtt: rtt, min: rtt}
+		r.networks[key] = e
+	}
+
+	e.samples++
+	e.last = rtt
+	e.srtt += time.Duration(rttGain * float64(rtt-e.srtt))
+	e.min = min(e.min, rtt)
+	e.updated = time.Now()
+}
+
+// evict removes the least recently measured network.
+func (r *rttRegistry) evict() {
+	oldest := ""
+	for k, e := range r.networks {
+		if oldest == "" || e.updated.Before(r.networks[oldest].updated) {
+			oldest = k
+		}
+	}
+	delete(r.networks, oldest)
+}
+
+func (r *rttRegistry) list() []*stnrv1.ClientRTT {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ret := make([]*stnrv1.ClientRTT, 0, len(r.networks))
+	for k, e := range r.networks {
+		network, method := k, ""
+		for i := len(k) - 1; i >= 0; i-- {
+			if k[i] == ' ' {
+				network, method = k[:i], k[i+1:]
+				break
+			}
+		}
+		ret = append(ret, &stnrv1.ClientRTT{
+			Network:     network,
+			Method:      method,
+			Samples:     e.samples,
+			SmoothedRTT: e.srtt.Seconds(),
+			MinRTT:      e.min.Seconds(),
+			LastRTT:     e.last.Seconds(),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Network != ret[j].Network {
+			return ret[i].Network < ret[j].Network
+		}
+		return ret[i].Method < ret[j].Method
+	})
+
+	return ret
+}
+
+// newRTTRecorder creates a helper function for recording the round-trip times measured at a
+// listener.
+func (s *Stunner) newRTTRecorder(l *object.Listener) RTTRecorder {
+	return func(client net.Addr, method string, rtt time.Duration) {
+		country, _ := s.LookupCountry(client)
+		s.telemetry.ObserveClientRTT(l.Name, method, country, rtt)
+		s.rtt.add(clientNetwork(client), method, rtt)
+	}
+}
+
+// GetClientRTT returns the round-trip time statistics of the client networks, measured at the
+// listeners in-process.
+func (s *Stunner) GetClientRTT() []*stnrv1.ClientRTT {
+	return s.rtt.list()
+}
+
+// NewClientRTTHandler creates a helper function for querying the round-trip time statistics of
+// the client networks.
+func (s *Stunner) NewClientRTTHandler() object.ClientRTTHandler {
+	return func() []*stnrv1.ClientRTT { return s.GetClientRTT() }
+}
+
+// challengeTracker keeps track of the challenges sent to the clients of a listener, keyed by
+// client address and nonce.
+type challengeTracker struct {
+	pending   map[string]time.Time
+	lastPurge time.Time
+	lock      sync.Mutex
+	now       func() time.Time
+}
+
+func newChallengeTracker() *challengeTracker {
+	return &challengeTracker{pending: map[string]time.Time{}, lastPurge: time.Now(), now: time.Now}
+}
+
+// challenge records a challenge sent to a client.
+func (t *challengeTracker) challenge(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	if now.Sub(t.lastPurge) > challengeTimeout {
+		for k, sent := range t.pending {
+			if now.Sub(sent) > challengeTimeout {
+				delete(t.pending, k)
+			}
+		}
+		t.lastPurge = now
+	}
+
+	if len(t.pending) >= challengeTrackerSize {
+		return
+	}
+	t.pending[key] = now
+}
+
+// answer returns the time elapsed since the challenge answered by a client, if any.
+func (t *challengeTracker) answer(key string) (time.Duration, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sent, ok := t.pending[key]
+	if !ok {
+		return 0, false
+	}
+	delete(t.pending, key)
+
+	rtt := t.now().Sub(sent)
+	return rtt, rtt <= challengeTimeout
+}
+
+// RTTPacketConn is a listener net.PacketConn that measures the round-trip time of the clients as
+// the time between a challenge, i.e., an Unauthorized or a Stale Nonce error response carrying a
+// nonce, and the retry of the client with the nonce. The measurement includes the time the client
+// takes to compute the retry, which is usually negligible.
+type RTTPacketConn struct {
+	net.PacketConn
+	tracker *challengeTracker
+	record  RTTRecorder
+	log     logging.LeveledLogger
+}
+
+// NewRTTPacketConn decorates a listener PacketConn with round-trip time measurement.
+func NewRTTPacketConn(c net.PacketConn, t *challengeTracker, record RTTRecorder, log logging.LeveledLogger) net.PacketConn {
+	return &RTTPacketConn{PacketConn: c, tracker: t, record: record, log: log}
+}
+
+// ReadFrom reads from the PacketConn, measuring the round-trip time of retried requests.
+func (c *RTTPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err != nil || addr == nil || !stun.IsMessage(p[:n]) || stunClass(p) != 0 {
+		return n, addr, err
+	}
+
+	m := &stun.Message{Raw: p[:n]}
+	if derr := m.Decode(); derr != nil {
+		return n, addr, err
+	}
+	nonce, gerr := m.Get(stun.AttrNonce)
+	if gerr != nil {
+		return n, addr, err
+	}
+
+	if rtt, ok := c.tracker.answer(addr.String() + "/" + string(nonce)); ok {
+		c.log.Tracef("measured round-trip time %s to client %s", rtt, addr.String())
+		c.record(addr, rttMethodSTUN, rtt)
+	}
+
+	return n, addr, err
+}
+
+// WriteTo writes to the PacketConn, tracking the challenges sent to the clients.
+func (c *RTTPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if !stun.IsMessage(p) || stunClass(p) != 0x0110 {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err == nil {
+		var code stun.ErrorCodeAttribute
+		var nonce stun.Nonce
+		if code.GetFrom(m) == nil && nonce.GetFrom(m) == nil &&
+			(code.Code == stun.CodeUnauthorized || code.Code == stun.CodeStaleNonce) {
+			c.tracker.challenge(addr.String() + "/" + nonce.String())
+		}
+	}
+
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// rttListener is a TCP net.Listener that reports the smoothed round-trip time of the TCP
+// connections measured by the kernel when the connections are closed.
+type rttListener struct {
+	net.Listener
+	record RTTRecorder
+}
+
+func newRTTListener(l net.Listener, record RTTRecorder) net.Listener {
+	return &rttListener{Listener: l, record: record}
+}
+
+func (l *rttListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &rttConn{Conn: conn, record: l.record}, nil
+}
+
+type rttConn struct {
+	net.Conn
+	record RTTRecorder
+	once   sync.Once
+}
+
+func (c *rttConn) Close() error {
+	c.once.Do(func() {
+		if rtt, ok := tcpRTT(c.Conn); ok && rtt > 0 {
+			c.record(c.RemoteAddr(), rttMethodTCP, rtt)
+		}
+	})
+	return c.Conn.Close()
+}
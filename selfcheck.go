@@ -0,0 +1,315 @@
+package stunner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	"github.com/pion/turn/v4"
+
+	"github.com/l7mp/stunner/internal/object"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+// SelfCheckTimeout is the time after which a dataplane self-check is considered failed.
+var SelfCheckTimeout = 5 * time.Second
+
+// selfCheckIdlePeriod is the period at which the self-checker looks for a new setting while the
+// self-check is disabled.
+const selfCheckIdlePeriod = time.Second
+
+// selfCheckUserPrefix is the prefix of the throwaway usernames used by the self-check.
+const selfCheckUserPrefix = "stunner-self-check-"
+
+// selfChecker periodically performs a real TURN allocation against a local listener, using
+// throwaway credentials that are accepted only from the source address of the check.
+type selfChecker struct {
+	interval atomic.Int64 // in nanoseconds, zero disables the check
+	listener atomic.Pointer[string]
+	update   chan struct{}
+	// serializes the checks, so that a check does not overwrite the credential of another one
+	running sync.Mutex
+	// the credentials of the last two checks: the refresh request that releases the allocation
+	// of a check may be processed only after the next check has started
+	creds   [2]selfCheckCredential
+	lastErr error
+	lock    sync.Mutex
+}
+
+// selfCheckCredential is a throwaway credential bound to the source address of a check.
+type selfCheckCredential struct {
+	username, password, source string
+}
+
+func newSelfChecker() *selfChecker {
+	return &selfChecker{update: make(chan struct{}, 1)}
+}
+
+// set sets the interval of the check and the listener to check.
+func (c *selfChecker) set(interval time.Duration, listener string) {
+	c.interval.Store(int64(interval))
+	c.listener.Store(&listener)
+	if interval == 0 {
+		c.setResult(nil)
+		c.clearCredentials()
+	}
+	select {
+	case c.update <- struct{}{}:
+	default:
+	}
+}
+
+func (c *selfChecker) setResult(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastErr = err
+}
+
+// result returns the error of the last check, or nil if the last check succeeded or the check
+// is disabled.
+func (c *selfChecker) result() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lastErr
+}
+
+// authKey returns the authentication key for the throwaway credential of a recent check, if the
+// username and the source address match.
+func (c *selfChecker) authKey(username, realm string, src net.Addr) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cred := c.match(username, src)
+	if cred == nil {
+		return nil, false
+	}
+	return a12n.GenerateAuthKey(cred.username, realm, cred.password), true
+}
+
+// isCheck returns true if a request comes from a recent check.
+func (c *selfChecker) isCheck(username string, src net.Addr) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.match(username, src) != nil
+}
+
+func (c *selfChecker) match(username string, src net.Addr) *selfCheckCredential {
+	if username == "" || src == nil {
+		return nil
+	}
+	for i := range c.creds {
+		if c.creds[i].username == username && c.creds[i].source == src.String() {
+			return &c.creds[i]
+		}
+	}
+	return nil
+}
+
+// addCredential installs the credential of a new check, retiring the oldest one.
+func (c *selfChecker) addCredential(username, password, source string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.creds[1] = c.creds[0]
+	c.creds[0] = selfCheckCredential{username: username, password: password, source: source}
+}
+
+func (c *selfChecker) clearCredentials() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.creds = [2]selfCheckCredential{}
+}
+
+// runSelfCheck performs the dataplane self-check at the configured interval until the context is
+// canceled. A new setting triggers an immediate check.
+func (s *Stunner) runSelfCheck(ctx context.Context) {
+	for {
+		wait := selfCheckIdlePeriod
+		if interval := time.Duration(s.selfCheck.interval.Load()); interval > 0 {
+			wait = interval
+			err := s.checkDataplane()
+			if err != nil && s.selfCheck.result() == nil {
+				s.log.Warnf("Dataplane self-check failed: %s", err.Error())
+			} else if err == nil && s.selfCheck.result() != nil {
+				s.log.Info("Dataplane self-check succeeded")
+			}
+			// the check may have been disabled in the meantime
+			if s.selfCheck.interval.Load() > 0 {
+				s.selfCheck.setResult(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.selfCheck.update:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// selfCheckListener returns the listener to be checked: the listener set in the admin config, or
+// the first TURN listener in alphabetical order. Returns nil if there is nothing to check.
+func (s *Stunner) selfCheckListener() (*object.Listener, error) {
+	if name := s.selfCheck.listener.Load(); name != nil && *name != "" {
+		l := s.GetListener(*name)
+		if l == nil {
+			return nil, fmt.Errorf("no such listener: %q", *name)
+		}
+		return l, nil
+	}
+
+	for _, name := range s.listenerManager.Keys() {
+		l := s.GetListener(name)
+		if l == nil || l.ProxyProtocol || s.toggles.isDisabled(name) {
+			continue
+		}
+		switch l.Proto {
+		case stnrv1.ListenerProtocolTURNUDP, stnrv1.ListenerProtocolTURNTCP,
+			stnrv1.ListenerProtocolTURNTLS, stnrv1.ListenerProtocolTURNDTLS:
+			return l, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkDataplane performs a TURN allocation against a local listener and releases it.
+func (s *Stunner) checkDataplane() error {
+	if s.dryRun || s.IsStandby() || !s.IsReady() {
+		return nil
+	}
+
+	s.selfCheck.running.Lock()
+	defer s.selfCheck.running.Unlock()
+
+	l, err := s.selfCheckListener()
+	if err != nil || l == nil {
+		return err
+	}
+	if s.toggles.isDisabled(l.Name) {
+		return nil
+	}
+	if !l.IsRunning() {
+		return fmt.Errorf("listener %q not running", l.Name)
+	}
+
+	// connect to the loopback address if the listener listens on all interfaces
+	ip := l.Addr
+	if ip == nil || ip.IsUnspecified() {
+		ip = net.IPv4(127, 0, 0, 1)
+		if l.Addr != nil && l.Addr.To4() == nil {
+			ip = net.IPv6loopback
+		}
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(l.Port))
+
+	conn, source, err := s.dialSelfCheck(l.Proto, ip, addr)
+	if err != nil {
+		return fmt.Errorf("could not connect to listener %q: %w", l.Name, err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// the credential is bound to the source address of the check and it is kept after the
+	// check returns, since the refresh request that releases the allocation is processed
+	// asynchronously
+	username, password := selfCheckUserPrefix+randomHex(8), randomHex(16)
+	s.selfCheck.addCredential(username, password, source)
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Conn:           conn,
+		Username:       username,
+		Password:       password,
+		Realm:          s.GetRealm(),
+		LoggerFactory:  s.logger,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create TURN client: %w", err)
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return fmt.Errorf("could not start TURN client: %w", err)
+	}
+
+	// closing the client aborts a pending allocation
+	timer := time.AfterFunc(SelfCheckTimeout, client.Close)
+	defer timer.Stop()
+
+	relay, err := client.Allocate()
+	if err != nil {
+		return fmt.Errorf("allocation failed on listener %q: %w", l.Name, err)
+	}
+	s.log.Debugf("Dataplane self-check: allocated relay address %s on listener %q",
+		relay.LocalAddr().String(), l.Name)
+
+	return relay.Close()
+}
+
+// dialSelfCheck opens a client connection to a listener, returning the connection and the source
+// address of the connection as seen by the listener.
+func (s *Stunner) dialSelfCheck(proto stnrv1.ListenerProtocol, ip net.IP, addr string) (net.PacketConn, string, error) {
+	switch proto {
+	case stnrv1.ListenerProtocolTURNUDP:
+		c, err := net.ListenPacket("udp", net.JoinHostPort(ip.String(), "0"))
+		if err != nil {
+			return nil, "", err
+		}
+		return c, c.LocalAddr().String(), nil
+	case stnrv1.ListenerProtocolTURNTCP:
+		c, err := net.DialTimeout("tcp", addr, SelfCheckTimeout)
+		if err != nil {
+			return nil, "", err
+		}
+		return turn.NewSTUNConn(c), c.LocalAddr().String(), nil
+	case stnrv1.ListenerProtocolTURNTLS:
+		// the certificate is not checked: the listener is local
+		c, err := tls.DialWithDialer(&net.Dialer{Timeout: SelfCheckTimeout}, "tcp", addr,
+			&tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true}) //nolint:gosec
+		if err != nil {
+			return nil, "", err
+		}
+		return turn.NewSTUNConn(c), c.LocalAddr().String(), nil
+	case stnrv1.ListenerProtocolTURNDTLS:
+		raddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), SelfCheckTimeout)
+		defer cancel()
+		c, err := dtls.Dial("udp", raddr, &dtls.Config{InsecureSkipVerify: true}) //nolint:gosec
+		if err != nil {
+			return nil, "", err
+		}
+		if err := c.HandshakeContext(ctx); err != nil {
+			c.Close() //nolint:errcheck
+			return nil, "", err
+		}
+		return turn.NewSTUNConn(c), c.LocalAddr().String(), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported listener protocol %s", proto.String())
+	}
+}
+
+// checkSelfCheck returns the error of the last dataplane self-check.
+func (s *Stunner) checkSelfCheck() error {
+	if err := s.selfCheck.result(); err != nil {
+		return errors.Join(errors.New("dataplane self-check failed"), err)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b) //nolint:errcheck
+	return hex.EncodeToString(b)
+}
@@ -33,129 +33,330 @@ func (s *Stunner) StartServer(l *object.Listener) error {
 	var lConns []turn.ListenerConfig
 
 	relay := NewRelayGen(l, s.telemetry, s.logger)
+	relay.tap = s.tap
+	relay.upgrade = s.upgrade
+	relay.idle = s.idle
+	relay.talkers = s.talkers
+	relay.toggles = s.toggles
+	relay.faults = s.faults
+	relay.clock = s.clock
+	relay.cascading = func() bool { return s.cascading(l) }
+	relay.ports = s.newRelayPortPool(l.Name, l.GetRelayPortRanges())
+	s.upgrade.resetListener(l.Name)
+	s.watchdog.reset(l.Name)
+	s.mobility.resetListener(l.Name)
+	s.lifetimes.resetListener(l.Name)
 	relay.PortRangeChecker = s.GenPortRangeChecker(relay)
 
-	permissionHandler := s.NewPermissionHandler(l)
+	permissionHandler := s.recoverPermissionHandler(l, s.NewPermissionHandler(l))
 
 	addr := fmt.Sprintf("0.0.0.0:%d", l.Port)
 
-	switch l.Proto {
-	case stnrv1.ListenerProtocolTURNUDP:
-		socketPool := util.NewPacketConnPool(l.Name, l.Net, s.udpThreadNum, s.telemetry)
-
-		s.log.Infof("setting up UDP listener socket pool at %s with %d readloop threads",
-			addr, socketPool.Size())
-		conns, err := socketPool.Make("udp", addr)
-		if err != nil {
-			return err
-		}
+	// the connection limit is shared by the TCP and TLS sockets of the listener
+	connLimiter := NewConnLimiter()
+
+	rttRecorder := s.newRTTRecorder(l)
+
+	// a multi-protocol listener serves all its protocols from the same TURN server
+	for _, proto := range l.Protos {
+		switch proto {
+		case stnrv1.ListenerProtocolTURNUDP, stnrv1.ListenerProtocolUDP:
+			var conns []net.PacketConn
+			if files := s.upgrade.takeSockets(l.Name, proto.String()); len(files) > 0 {
+				s.log.Infof("setting up UDP listener at %s with %d socket(s) inherited "+
+					"from the old process", addr, len(files))
+				inherited, err := inheritPacketConns(files)
+				if err != nil {
+					return fmt.Errorf("failed to inherit UDP listener sockets at %s: %s",
+						addr, err)
+				}
+				for _, c := range inherited {
+					conns = append(conns, telemetry.NewPacketConn(c, l.Name,
+						telemetry.ListenerType, s.telemetry))
+				}
+			} else {
+				socketPool := util.NewPacketConnPool(l.Name, l.Net, s.udpThreadNum, s.telemetry)
+
+				s.log.Infof("setting up UDP listener socket pool at %s with %d readloop threads",
+					addr, socketPool.Size())
+				var err error
+				conns, err = socketPool.Make("udp", addr)
+				if err != nil {
+					return err
+				}
+			}
+			for _, c := range conns {
+				s.upgrade.addSocket(l.Name, proto.String(), c)
+			}
 
-		for _, c := range conns {
-			conn := turn.PacketConnConfig{
-				PacketConn:            c,
-				RelayAddressGenerator: relay,
-				PermissionHandler:     permissionHandler,
+			if l.SinglePort {
+				relay.Mux = NewSinglePortMux(&net.UDPAddr{IP: l.Addr, Port: l.Port},
+					s.logger.NewLogger(fmt.Sprintf("single-port-%s", l.Name)))
+			}
+			if (l.SessionTokenTimeout > 0 || l.PortReservation || len(l.RelayPortPins) > 0) &&
+				relay.Mux == nil {
+				relay.claims = newAllocClaims()
+				if l.SessionTokenTimeout > 0 {
+					relay.sessions = newSessionTokens(l, relay.claims,
+						s.logger.NewLogger(fmt.Sprintf("session-token-%s", l.Name)))
+				}
+				if l.PortReservation {
+					relay.reservations = newPortReservations(relay.claims,
+						s.logger.NewLogger(fmt.Sprintf("port-reservation-%s", l.Name)))
+				}
+				relay.pins = newRelayPortPins(l, relay.ports,
+					s.logger.NewLogger(fmt.Sprintf("relay-port-pin-%s", l.Name)))
 			}
 
-			l.Conns = append(l.Conns, conn)
-			pConns = append(pConns, conn)
-		}
+			// the nonce lifetime policy is enforced only if configured
+			var nonces *nonceTracker
+			ttl, _ := s.getNoncePolicy()
+			l.NonceTracking = ttl > 0
+			if l.NonceTracking {
+				nonces = newNonceTracker(s.clock)
+			}
+			challenges := newChallengeTracker()
+			bindingLimiter := NewBindingLimiter()
+			strictAuth := s.NewAuthHandler()
+			restore := s.upgrade.hasRestore(l.Name)
+			for i, c := range conns {
+				socket := c
+				if s.udpRcvBufMax > 0 {
+					c = util.NewRcvBufAutotunePacketConn(c, l.Name, s.udpRcvBufMax, s.telemetry,
+						s.log)
+				}
+				if l.Mobility {
+					c = s.mobility.newPacketConn(c, l.Name,
+						s.logger.NewLogger(fmt.Sprintf("mobility-%s", l.Name)))
+				}
+				if relay.Mux != nil {
+					c = relay.Mux.NewPacketConn(c)
+				}
+				if s.capture.Load() != nil {
+					c = newCapturePacketConn(c, l.Name, &s.capture)
+				}
+				c = NewBindingLimitPacketConn(c, l, bindingLimiter, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("binding-limit-%s", l.Name)))
+				c = NewTarpitPacketConn(c, l, s.NewTarpitChecker(l), s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("tarpit-%s", l.Name)))
+				c = NewStrictPacketConn(c, l, s.getStrictMode, strictAuth, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("strict-%s", l.Name)))
+				if l.ICEUfrag != "" {
+					c = NewICELitePacketConn(c, l,
+						s.logger.NewLogger(fmt.Sprintf("ice-lite-%s", l.Name)))
+				}
+				if l.ForwardAddress != "" {
+					c = NewDemuxPacketConn(c, l, s.telemetry,
+						s.logger.NewLogger(fmt.Sprintf("demux-%s", l.Name)))
+				}
+				c = NewRTTPacketConn(c, challenges, rttRecorder,
+					s.logger.NewLogger(fmt.Sprintf("rtt-%s", l.Name)))
+				if nonces != nil {
+					c = NewNoncePacketConn(c, l, nonces, s.getNoncePolicy, s.telemetry,
+						s.logger.NewLogger(fmt.Sprintf("nonce-%s", l.Name)))
+				}
+				c = s.newOAuthPacketConn(c)
+				if l.HasOriginPolicy() {
+					c = s.newOriginPacketConn(c)
+				}
+				c = s.newErrorReasonPacketConn(c, l.Name)
+				c = newSTUNAttributePacketConn(c, l.Name, &s.stunAttrHook,
+					s.logger.NewLogger(fmt.Sprintf("stun-attr-%s", l.Name)))
+				if restore && i == 0 {
+					rc := newRestorePacketConn(c)
+					s.upgrade.addRestorer(l.Name, rc)
+					c = rc
+				}
+				if relay.claims != nil {
+					c = relay.claims.newPacketConn(c)
+				}
+				c = NewRecoverPacketConn(c, l.Name, panicComponentListener, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("recover-%s", l.Name)))
+				c = s.watchdog.track(l.Name, c, socket)
+				if len(l.CPUAffinity) > 0 {
+					c = NewAffinityPacketConn(c, l.CPUAffinity[i%len(l.CPUAffinity)],
+						s.logger.NewLogger(fmt.Sprintf("affinity-%s", l.Name)))
+				}
+
+				conn := turn.PacketConnConfig{
+					PacketConn:            c,
+					RelayAddressGenerator: relay,
+					PermissionHandler:     permissionHandler,
+				}
+
+				l.Conns = append(l.Conns, conn)
+				pConns = append(pConns, conn)
+			}
 
-	case stnrv1.ListenerProtocolTURNTCP:
-		s.log.Debugf("setting up TCP listener at %s", addr)
+		case stnrv1.ListenerProtocolTURNTCP, stnrv1.ListenerProtocolTCP:
+			s.log.Debugf("setting up TCP listener at %s", addr)
 
-		tcpListener, err := net.Listen("tcp", addr)
-		if err != nil {
-			return fmt.Errorf("failed to create TCP listener at %s: %s", addr, err)
-		}
+			tcpListener, err := s.listenTCP(l, proto, addr)
+			if err != nil {
+				return fmt.Errorf("failed to create TCP listener at %s: %s", addr, err)
+			}
+			if s.fds != nil && s.fds.refuse > 0 {
+				tcpListener = newFDGuardListener(tcpListener, l.Name, s.fds, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("fd-guard-%s", l.Name)))
+			}
+			if l.MaxTCPConnections > 0 || l.AcceptQueueLength > 0 {
+				tcpListener = NewConnLimitListener(tcpListener, l.Name, l.MaxTCPConnections,
+					l.AcceptQueueLength, connLimiter, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("conn-limit-%s", l.Name)))
+			}
+			if l.TCPKeepalive != 0 {
+				tcpListener = newKeepaliveListener(tcpListener, l.TCPKeepalive)
+			}
+			tcpListener = newRTTListener(tcpListener, rttRecorder)
+			if l.ProxyProtocol {
+				tcpListener = NewProxyProtoListener(tcpListener, l.GetTrustedProxies(),
+					s.logger.NewLogger(fmt.Sprintf("proxy-proto-%s", l.Name)))
+			}
 
-		tcpListener = telemetry.NewListener(tcpListener, l.Name, telemetry.ListenerType, s.telemetry)
+			tcpListener = telemetry.NewListener(tcpListener, l.Name, telemetry.ListenerType, s.telemetry)
+			tcpListener = s.newOAuthListener(tcpListener, true)
+			if l.HasOriginPolicy() {
+				tcpListener = s.newOriginListener(tcpListener, true)
+			}
+			tcpListener = s.newErrorReasonListener(tcpListener, l.Name)
+			tcpListener = newRecoverListener(tcpListener, l.Name, s.telemetry,
+				s.logger.NewLogger(fmt.Sprintf("recover-%s", l.Name)))
 
-		conn := turn.ListenerConfig{
-			Listener:              tcpListener,
-			RelayAddressGenerator: relay,
-			PermissionHandler:     permissionHandler,
-		}
+			conn := turn.ListenerConfig{
+				Listener:              tcpListener,
+				RelayAddressGenerator: relay,
+				PermissionHandler:     permissionHandler,
+			}
 
-		lConns = append(lConns, conn)
-		l.Conns = append(l.Conns, conn)
+			lConns = append(lConns, conn)
+			l.Conns = append(l.Conns, conn)
 
-		// cannot test this on vnet, no TLS in vnet.Net
-	case stnrv1.ListenerProtocolTURNTLS:
-		s.log.Debugf("setting up TLS/TCP listener at %s", addr)
+			// cannot test this on vnet, no TLS in vnet.Net
+		case stnrv1.ListenerProtocolTURNTLS, stnrv1.ListenerProtocolTLS:
+			s.log.Debugf("setting up TLS/TCP listener at %s", addr)
 
-		cer, err := tls.X509KeyPair(l.Cert, l.Key)
-		if err != nil {
-			return fmt.Errorf("cannot load cert/key pair for creating TLS listener at %s: %s",
-				addr, err)
-		}
-		tlsListener, err := tls.Listen("tcp", addr, &tls.Config{
-			MinVersion:   tls.VersionTLS12,
-			Certificates: []tls.Certificate{cer},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create TLS listener at %s: %s", addr, err)
-		}
+			cer, err := tls.X509KeyPair(l.Cert, l.Key)
+			if err != nil {
+				return fmt.Errorf("cannot load cert/key pair for creating TLS listener at %s: %s",
+					addr, err)
+			}
+			tcpListener, err := s.listenTCP(l, proto, addr)
+			if err != nil {
+				return fmt.Errorf("failed to create TLS listener at %s: %s", addr, err)
+			}
+			if s.fds != nil && s.fds.refuse > 0 {
+				tcpListener = newFDGuardListener(tcpListener, l.Name, s.fds, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("fd-guard-%s", l.Name)))
+			}
+			if l.MaxTCPConnections > 0 || l.AcceptQueueLength > 0 {
+				tcpListener = NewConnLimitListener(tcpListener, l.Name, l.MaxTCPConnections,
+					l.AcceptQueueLength, connLimiter, s.telemetry,
+					s.logger.NewLogger(fmt.Sprintf("conn-limit-%s", l.Name)))
+			}
+			if l.TCPKeepalive != 0 {
+				tcpListener = newKeepaliveListener(tcpListener, l.TCPKeepalive)
+			}
+			tcpListener = newRTTListener(tcpListener, rttRecorder)
+			if l.ProxyProtocol {
+				tcpListener = NewProxyProtoListener(tcpListener, l.GetTrustedProxies(),
+					s.logger.NewLogger(fmt.Sprintf("proxy-proto-%s", l.Name)))
+			}
+			tlsListener := tls.NewListener(tcpListener, &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{cer},
+			})
+
+			tlsListener = telemetry.NewListener(tlsListener, l.Name, telemetry.ListenerType, s.telemetry)
+			tlsListener = s.newOAuthListener(tlsListener, true)
+			if l.HasOriginPolicy() {
+				tlsListener = s.newOriginListener(tlsListener, true)
+			}
+			tlsListener = s.newErrorReasonListener(tlsListener, l.Name)
+			tlsListener = newRecoverListener(tlsListener, l.Name, s.telemetry,
+				s.logger.NewLogger(fmt.Sprintf("recover-%s", l.Name)))
 
-		tlsListener = telemetry.NewListener(tlsListener, l.Name, telemetry.ListenerType, s.telemetry)
+			conn := turn.ListenerConfig{
+				Listener:              tlsListener,
+				RelayAddressGenerator: relay,
+				PermissionHandler:     permissionHandler,
+			}
 
-		conn := turn.ListenerConfig{
-			Listener:              tlsListener,
-			RelayAddressGenerator: relay,
-			PermissionHandler:     permissionHandler,
-		}
+			lConns = append(lConns, conn)
+			l.Conns = append(l.Conns, conn)
 
-		lConns = append(lConns, conn)
-		l.Conns = append(l.Conns, conn)
+		case stnrv1.ListenerProtocolTURNDTLS, stnrv1.ListenerProtocolDTLS:
+			s.log.Debugf("setting up DTLS/UDP listener at %s", addr)
 
-	case stnrv1.ListenerProtocolTURNDTLS:
-		s.log.Debugf("setting up DTLS/UDP listener at %s", addr)
+			cer, err := tls.X509KeyPair(l.Cert, l.Key)
+			if err != nil {
+				return fmt.Errorf("cannot load cert/key pair for creating DTLS listener at %s: %s",
+					addr, err)
+			}
 
-		cer, err := tls.X509KeyPair(l.Cert, l.Key)
-		if err != nil {
-			return fmt.Errorf("cannot load cert/key pair for creating DTLS listener at %s: %s",
-				addr, err)
-		}
+			// for some reason dtls.Listen requires a UDPAddr and not an addr string
+			udpAddr, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				return fmt.Errorf("failed to parse DTLS listener address %s: %s", addr, err)
+			}
+			dtlsListener, err := dtls.Listen("udp", udpAddr, &dtls.Config{
+				Certificates: []tls.Certificate{cer},
+				// ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create DTLS listener at %s: %s", addr, err)
+			}
+			// DTLS sessions cannot be handed over: release the port for the new process
+			rawDTLSListener := dtlsListener
+			s.upgrade.addReleaser(l.Name, func() { rawDTLSListener.Close() }) //nolint:errcheck
+
+			dtlsListener = telemetry.NewListener(dtlsListener, l.Name, telemetry.ListenerType, s.telemetry)
+			dtlsListener = s.newOAuthListener(dtlsListener, false)
+			if l.HasOriginPolicy() {
+				dtlsListener = s.newOriginListener(dtlsListener, false)
+			}
+			dtlsListener = s.newErrorReasonListener(dtlsListener, l.Name)
+			dtlsListener = newRecoverListener(dtlsListener, l.Name, s.telemetry,
+				s.logger.NewLogger(fmt.Sprintf("recover-%s", l.Name)))
 
-		// for some reason dtls.Listen requires a UDPAddr and not an addr string
-		udpAddr, err := net.ResolveUDPAddr("udp", addr)
-		if err != nil {
-			return fmt.Errorf("failed to parse DTLS listener address %s: %s", addr, err)
-		}
-		dtlsListener, err := dtls.Listen("udp", udpAddr, &dtls.Config{
-			Certificates: []tls.Certificate{cer},
-			// ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create DTLS listener at %s: %s", addr, err)
-		}
+			conn := turn.ListenerConfig{
+				Listener:              dtlsListener,
+				RelayAddressGenerator: relay,
+				PermissionHandler:     permissionHandler,
+			}
 
-		dtlsListener = telemetry.NewListener(dtlsListener, l.Name, telemetry.ListenerType, s.telemetry)
+			lConns = append(lConns, conn)
+			l.Conns = append(l.Conns, conn)
 
-		conn := turn.ListenerConfig{
-			Listener:              dtlsListener,
-			RelayAddressGenerator: relay,
-			PermissionHandler:     permissionHandler,
+		default:
+			return fmt.Errorf("internal error: unknown listener protocol %q", proto.String())
 		}
-
-		lConns = append(lConns, conn)
-		l.Conns = append(l.Conns, conn)
-
-	default:
-		return fmt.Errorf("internal error: unknown listener protocol %q", l.Proto.String())
 	}
 
 	// start the TURN server if there are actual listeners configured
 	if len(pConns) == 0 && len(lConns) == 0 {
-		l.Server = nil
+		l.SetServer(nil)
 		return nil
 	}
 
+	authHandler := s.upgrade.newRestoreAuthHandler(l.Name, s.recoverAuthHandler(l, s.NewAuthHandler()))
+	if relay.claims != nil {
+		authHandler = relay.claims.newAuthHandler(authHandler)
+	}
+	if l.Mobility {
+		authHandler = s.mobility.newAuthHandler(l.Name, authHandler)
+	}
+
+	eventHandlers := s.NewEventHandler(l)
+	if relay.Mux != nil {
+		eventHandlers = relay.Mux.EventHandlers(eventHandlers)
+	}
+
 	t, err := turn.NewServer(turn.ServerConfig{
 		Realm:             s.GetRealm(),
-		AuthHandler:       s.NewAuthHandler(),
-		EventHandlers:     s.NewEventHandler(l),
-		QuotaHandler:      s.quotaHandler.QuotaHandler(),
+		AuthHandler:       authHandler,
+		EventHandlers:     s.recoverEventHandlers(l, eventHandlers),
+		QuotaHandler:      s.recoverQuotaHandler(l, s.NewListenerQuotaHandler(l)),
+		PanicHandler:      func(conn net.PacketConn, r any) { s.recoverReadLoop(l, conn, r) },
 		PacketConnConfigs: pConns,
 		ListenerConfigs:   lConns,
 		LoggerFactory:     logger.NewRateLimitedLoggerFactory(s.logger, LogRateLimit, LogBurst),
@@ -164,9 +365,27 @@ func (s *Stunner) StartServer(l *object.Listener) error {
 		return fmt.Errorf("cannot set up TURN server for listener %s: %w",
 			l.Name, err)
 	}
-	l.Server = t
+	l.SetServer(t)
 
 	s.log.Infof("listener %s: TURN server running", l.Name)
 
 	return nil
 }
+
+// listenTCP creates a TCP listener socket, or takes over the listener socket inherited from the old
+// process in a hitless upgrade.
+func (s *Stunner) listenTCP(l *object.Listener, proto stnrv1.ListenerProtocol, addr string) (net.Listener, error) {
+	var ln net.Listener
+	var err error
+	if files := s.upgrade.takeSockets(l.Name, proto.String()); len(files) > 0 {
+		s.log.Infof("using TCP listener socket at %s inherited from the old process", addr)
+		ln, err = inheritListener(files)
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.upgrade.addSocket(l.Name, proto.String(), ln)
+	return ln, nil
+}
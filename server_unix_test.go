@@ -3,11 +3,18 @@
 package stunner
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/pion/transport/v3/test"
+	"github.com/pion/turn/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	"github.com/l7mp/stunner/pkg/logger"
 )
@@ -69,7 +76,7 @@ func RunBenchmarkServer(b *testing.B, proto string, udpThreadNum int) {
 	defer stunner.Close()
 
 	log.Debug("Starting stunnerd")
-	err := stunner.Reconcile(&stnrv1.StunnerConfig{
+	err := stunner.Reconcile(context.Background(), &stnrv1.StunnerConfig{
 		ApiVersion: stnrv1.ApiVersion,
 		Admin: stnrv1.AdminConfig{
 			LogLevel: stunnerTestLoglevel,
@@ -226,3 +233,176 @@ func BenchmarkDTLSServer(b *testing.B) {
 		RunBenchmarkServer(b, "turn-dtls", 0)
 	})
 }
+
+func TestStunnerHitlessUpgrade(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	loggerFactory := logger.NewLoggerFactory(stunnerTestLoglevel)
+	log := loggerFactory.NewLogger("test")
+
+	// echo server as the peer
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err, "peer")
+	defer peer.Close() //nolint:errcheck
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := peer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			peer.WriteTo(buf[:n], addr) //nolint:errcheck
+		}
+	}()
+
+	noHealthCheck := ""
+	conf := stnrv1.StunnerConfig{
+		ApiVersion: stnrv1.ApiVersion,
+		Admin: stnrv1.AdminConfig{
+			LogLevel:            stunnerTestLoglevel,
+			HealthCheckEndpoint: &noHealthCheck,
+		},
+		Auth: stnrv1.AuthConfig{
+			Type:        "static",
+			Credentials: map[string]string{"username": "user", "password": "pass"},
+		},
+		Listeners: []stnrv1.ListenerConfig{{
+			Name:     "udp",
+			Protocol: "turn-udp",
+			Addr:     "127.0.0.1",
+			Port:     23501,
+			Routes:   []string{"allow-any"},
+		}},
+		Clusters: []stnrv1.ClusterConfig{{
+			Name:      "allow-any",
+			Endpoints: []string{"0.0.0.0/0"},
+		}},
+	}
+
+	old := NewStunner(Options{LogLevel: stunnerTestLoglevel, SuppressRollback: true,
+		HitlessUpgrade: true})
+	defer old.Close()
+	assert.NoError(t, old.Reconcile(context.Background(), &conf), "reconcile old")
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err, "client socket")
+	defer conn.Close() //nolint:errcheck
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: "127.0.0.1:23501",
+		TURNServerAddr: "127.0.0.1:23501",
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  loggerFactory,
+	})
+	assert.NoError(t, err, "turn client")
+	defer client.Close()
+	assert.NoError(t, client.Listen(), "listen")
+	relay, err := client.Allocate()
+	assert.NoError(t, err, "allocate")
+	defer relay.Close() //nolint:errcheck
+
+	echo := func(msg string) {
+		_, err := relay.WriteTo([]byte(msg), peer.LocalAddr())
+		assert.NoError(t, err, "send")
+		buf := make([]byte, 1500)
+		assert.NoError(t, relay.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := relay.ReadFrom(buf)
+		assert.NoError(t, err, "receive")
+		assert.Equal(t, msg, string(buf[:n]), "echo")
+	}
+	echo("before upgrade")
+
+	// hand over to a new instance over a unix socket pair
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	assert.NoError(t, err, "socketpair")
+	oldConn, err := net.FileConn(os.NewFile(uintptr(fds[0]), "old"))
+	assert.NoError(t, err, "old conn")
+	newConn, err := net.FileConn(os.NewFile(uintptr(fds[1]), "new"))
+	assert.NoError(t, err, "new conn")
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- old.Handoff(oldConn.(*net.UnixConn)) }()
+
+	s := NewStunner(Options{LogLevel: stunnerTestLoglevel, SuppressRollback: true})
+	defer s.Close()
+	assert.NoError(t, s.Inherit(newConn.(*net.UnixConn)), "inherit")
+	assert.NoError(t, s.Reconcile(context.Background(), &conf), "reconcile new")
+	assert.NoError(t, s.FinishInherit(), "finish")
+	assert.NoError(t, <-errCh, "handoff")
+	assert.Equal(t, 1, s.AllocationCount(), "allocation restored")
+
+	log.Debug("relaying through the new instance")
+	echo("after upgrade")
+}
+
+func TestStunnerHitlessUpgradeFailure(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	h := "http://127.0.0.1:8086"
+	conf := stnrv1.StunnerConfig{
+		ApiVersion: stnrv1.ApiVersion,
+		Admin: stnrv1.AdminConfig{
+			LogLevel:            stunnerTestLoglevel,
+			HealthCheckEndpoint: &h,
+		},
+		Auth: stnrv1.AuthConfig{
+			Type:        "static",
+			Credentials: map[string]string{"username": "user", "password": "pass"},
+		},
+		Listeners: []stnrv1.ListenerConfig{{
+			Name:     "udp",
+			Protocol: "turn-udp",
+			Addr:     "127.0.0.1",
+			Port:     23533,
+		}},
+	}
+
+	socketPair := func() (*net.UnixConn, *net.UnixConn) {
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+		assert.NoError(t, err, "socketpair")
+		oldFile, newFile := os.NewFile(uintptr(fds[0]), "old"), os.NewFile(uintptr(fds[1]), "new")
+		defer oldFile.Close() //nolint:errcheck
+		defer newFile.Close() //nolint:errcheck
+		oldConn, err := net.FileConn(oldFile)
+		assert.NoError(t, err, "old conn")
+		newConn, err := net.FileConn(newFile)
+		assert.NoError(t, err, "new conn")
+		return oldConn.(*net.UnixConn), newConn.(*net.UnixConn)
+	}
+
+	// tracking is disabled by default
+	s := NewStunner(Options{LogLevel: stunnerTestLoglevel, SuppressRollback: true})
+	oldConn, newConn := socketPair()
+	assert.ErrorIs(t, s.Handoff(oldConn), ErrUpgradeDisabled, "tracking disabled")
+	oldConn.Close() //nolint:errcheck
+	newConn.Close() //nolint:errcheck
+	s.Close()
+
+	old := NewStunner(Options{LogLevel: stunnerTestLoglevel, SuppressRollback: true,
+		HitlessUpgrade: true})
+	defer old.Close()
+	assert.NoError(t, old.Reconcile(context.Background(), &conf), "reconcile old")
+	status, err := doLivenessCheck(h)
+	assert.NoError(t, err, "liveness check")
+	assert.True(t, status, "live")
+
+	// the new process receives the state and dies before taking over
+	oldConn, newConn = socketPair()
+	defer oldConn.Close() //nolint:errcheck
+	errCh := make(chan error, 1)
+	go func() { errCh <- old.Handoff(oldConn) }()
+
+	s = NewStunner(Options{LogLevel: stunnerTestLoglevel, SuppressRollback: true})
+	assert.NoError(t, s.Inherit(newConn), "inherit")
+	s.Close()
+	newConn.Close() //nolint:errcheck
+	assert.Error(t, <-errCh, "handoff")
+
+	// the old process restored the health-check server
+	status, err = doLivenessCheck(h)
+	assert.NoError(t, err, "liveness check after failed handoff")
+	assert.True(t, status, "live after failed handoff")
+}
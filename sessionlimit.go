@@ -0,0 +1,64 @@
+package stunner
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+)
+
+// Reasons for closing an allocation before it expires.
+const (
+	sessionExpiredMaxDuration = "max-duration"
+	sessionExpiredIdle        = "idle"
+	sessionExpiredDrained     = "drained"
+)
+
+// SessionLimitPacketConn is a relay net.PacketConn that closes itself after a maximum session
+// duration. Closing the relay connection makes the TURN server delete the allocation irrespective
+// of refreshes, so the client has to create a new allocation, authenticating with its current
+// credentials.
+type SessionLimitPacketConn struct {
+	net.PacketConn
+	name      string
+	timer     util.Timer
+	once      sync.Once
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewSessionLimitPacketConn decorates a relay PacketConn with a maximum session duration, measured
+// by the given clock. Expired sessions are reported per listener name.
+func NewSessionLimitPacketConn(c net.PacketConn, name string, d time.Duration, clock Clock, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	s := &SessionLimitPacketConn{
+		PacketConn: c,
+		name:       name,
+		telemetry:  t,
+		log:        log,
+	}
+	s.timer = clock.AfterFunc(d, s.expire)
+	return s
+}
+
+func (c *SessionLimitPacketConn) expire() {
+	c.log.Infof("Relay connection %s exceeded the maximum session duration: closing allocation",
+		c.PacketConn.LocalAddr())
+	c.telemetry.IncrementSessionExpired(c.name, sessionExpiredMaxDuration)
+	c.close() //nolint:errcheck
+}
+
+func (c *SessionLimitPacketConn) close() error {
+	var err error
+	c.once.Do(func() { err = c.PacketConn.Close() })
+	return err
+}
+
+// Close stops the session timer and closes the relay connection.
+func (c *SessionLimitPacketConn) Close() error {
+	c.timer.Stop()
+	return c.close()
+}
@@ -0,0 +1,301 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// AttrSessionToken is the comprehension-optional STUN attribute carrying the session affinity
+// token: STUNner adds it to the Allocate responses of the listeners with session affinity tokens
+// enabled, and a client presents it in a subsequent Allocate request to get the same relay
+// address.
+const AttrSessionToken = stun.AttrType(0xC057)
+
+// sessionTokenSize is the size of the random session affinity tokens in bytes.
+const sessionTokenSize = 16
+
+// sessionTokenHandoverTimeout is the time the readloop of an allocation with a reclaimed relay
+// socket waits for the readloop of the previous allocation to exit.
+const sessionTokenHandoverTimeout = time.Second
+
+// sessionTokens implements session affinity tokens for the relay addresses of a UDP listener.
+// Each allocation is issued a token, and the relay socket of the allocation is kept open for the
+// session token timeout of the listener after the allocation ends, so that a client presenting
+// the token in a new Allocate request can reclaim the relay address.
+type sessionTokens struct {
+	listener *object.Listener
+	claims   *allocClaims
+	tokens   map[string]*sessionTokenEntry // keyed by token
+	clients  map[string]string             // the token of the live allocation of each client
+	closed   bool                          // the listener has been closed, no sockets are reserved anymore
+	lock     sync.Mutex
+	log      logging.LeveledLogger
+}
+
+// sessionTokenEntry is the relay socket issued a token, either serving a live allocation or
+// reserved for the client.
+type sessionTokenEntry struct {
+	token  string
+	socket net.PacketConn
+	conn   *sessionTokenRelayConn // the live allocation, nil if the socket is reserved
+	last   *sessionTokenRelayConn // the last allocation, live or ended
+	timer  *time.Timer            // ends the reservation
+}
+
+func newSessionTokens(l *object.Listener, claims *allocClaims, log logging.LeveledLogger) *sessionTokens {
+	t := &sessionTokens{
+		listener: l,
+		claims:   claims,
+		tokens:   map[string]*sessionTokenEntry{},
+		clients:  map[string]string{},
+		log:      log,
+	}
+	claims.sessions = t
+	return t
+}
+
+// reclaim returns the relay socket of the token presented in the Allocate request being handled,
+// or nil if no valid token was presented or session tokens are disabled. The allocation still
+// using the socket, if any, is closed.
+func (t *sessionTokens) reclaim() net.PacketConn {
+	if t == nil {
+		return nil
+	}
+
+	claim := t.claims.get()
+	if claim.sessionToken == "" {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	e, ok := t.tokens[claim.sessionToken]
+	if !ok {
+		t.log.Debugf("Unknown or expired session token presented by client %s", claim.client)
+		return nil
+	}
+
+	if e.conn != nil {
+		t.log.Debugf("Client %s reclaims relay address %s from client %s", claim.client,
+			e.socket.LocalAddr(), e.conn.client)
+		e.conn.closed.Store(true)
+		t.untrack(e.conn)
+		// unblock the readloop of the old allocation
+		e.socket.SetReadDeadline(time.Now()) //nolint:errcheck
+	} else {
+		t.log.Debugf("Client %s reclaims reserved relay address %s", claim.client,
+			e.socket.LocalAddr())
+		e.timer.Stop()
+	}
+	e.conn, e.timer = nil, nil
+	t.claims.update(func(c *allocClaim) { c.reclaimed = e })
+
+	return e.socket
+}
+
+// track decorates the relay socket created for the Allocate request being handled, issuing a new
+// token unless the socket has been reclaimed with a token.
+func (t *sessionTokens) track(socket net.PacketConn) net.PacketConn {
+	claim := t.claims.get()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	e := claim.reclaimed
+	if e == nil || e.socket != socket {
+		e = &sessionTokenEntry{token: randomHex(sessionTokenSize), socket: socket}
+		t.tokens[e.token] = e
+	}
+
+	c := &sessionTokenRelayConn{PacketConn: socket, entry: e, client: claim.client,
+		prev: e.last, exited: make(chan struct{}), tokens: t}
+	e.conn, e.last = c, c
+	t.clients[c.client] = e.token
+	return c
+}
+
+// tokenOf returns the token of the live allocation of a client, if any.
+func (t *sessionTokens) tokenOf(client string) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.clients[client]
+}
+
+func (t *sessionTokens) untrack(c *sessionTokenRelayConn) {
+	if t.clients[c.client] == c.entry.token {
+		delete(t.clients, c.client)
+	}
+}
+
+// handover waits until the readloop of the previous allocation of a reclaimed relay socket, if
+// any, has exited, and then sets the read deadline of the new allocation on the socket.
+func (t *sessionTokens) handover(c *sessionTokenRelayConn) {
+	if c.prev != nil {
+		select {
+		case <-c.prev.exited:
+		case <-time.After(sessionTokenHandoverTimeout):
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c.handedOver = true
+	t.applyDeadline(c)
+}
+
+// setDeadline sets the read deadline of an allocation, applied on the relay socket once the
+// readloop of the previous allocation has exited.
+func (t *sessionTokens) setDeadline(c *sessionTokenRelayConn, deadline time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c.deadline = deadline
+	if c.handedOver {
+		t.applyDeadline(c)
+	}
+}
+
+// resetDeadline restores the read deadline of an allocation after the relay socket timed out on
+// a deadline set for another allocation. Returns false if the timeout is due to the deadline of
+// the allocation itself.
+func (t *sessionTokens) resetDeadline(c *sessionTokenRelayConn) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+		return false
+	}
+	return t.applyDeadline(c)
+}
+
+func (t *sessionTokens) applyDeadline(c *sessionTokenRelayConn) bool {
+	if c.entry.conn != c {
+		return false
+	}
+	return c.entry.socket.SetReadDeadline(c.deadline) == nil
+}
+
+// reserve keeps the relay socket of an ended allocation open for the session token timeout.
+func (t *sessionTokens) reserve(c *sessionTokenRelayConn) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	e := c.entry
+	if e.conn != c {
+		return nil
+	}
+	t.untrack(c)
+	e.conn = nil
+
+	timeout := t.listener.SessionTokenTimeout
+	if timeout <= 0 || t.closed {
+		delete(t.tokens, e.token)
+		return e.socket.Close()
+	}
+
+	// unblock the readloop of the ended allocation
+	e.socket.SetReadDeadline(time.Now()) //nolint:errcheck
+	e.timer = time.AfterFunc(timeout, func() { t.expire(e) })
+	return nil
+}
+
+// expire closes a reserved relay socket that has not been reclaimed.
+func (t *sessionTokens) expire(e *sessionTokenEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if e.conn != nil || t.tokens[e.token] != e {
+		return
+	}
+	delete(t.tokens, e.token)
+	e.socket.Close() //nolint:errcheck
+}
+
+// close releases the reserved relay sockets, called when the listener is closed.
+func (t *sessionTokens) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.closed = true
+	for token, e := range t.tokens {
+		if e.conn != nil {
+			continue
+		}
+		e.timer.Stop()
+		e.socket.Close() //nolint:errcheck
+		delete(t.tokens, token)
+	}
+}
+
+// sessionTokenRelayConn is the relay socket of an allocation issued a session token. Closing the
+// connection reserves the socket for the client instead of closing it.
+type sessionTokenRelayConn struct {
+	net.PacketConn
+	entry  *sessionTokenEntry
+	client string
+	prev   *sessionTokenRelayConn // the previous allocation of a reclaimed relay socket
+	closed atomic.Bool
+	// closed when the readloop of the allocation has exited
+	exited   chan struct{}
+	exitOnce sync.Once
+	// the read deadline of the allocation, and whether it has been applied on the socket
+	deadline     time.Time
+	handedOver   bool
+	handoverOnce sync.Once
+	tokens       *sessionTokens
+}
+
+// ReadFrom reads from the relay socket, failing once the allocation has ended or the relay
+// address has been reclaimed by the client from a new address. The first read on a reclaimed
+// relay socket waits until the readloop of the previous allocation has exited.
+func (c *sessionTokenRelayConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		if c.closed.Load() {
+			return 0, nil, c.exit()
+		}
+		c.handoverOnce.Do(func() { c.tokens.handover(c) })
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if c.closed.Load() {
+			return 0, nil, c.exit()
+		}
+		if err != nil && errors.Is(err, os.ErrDeadlineExceeded) && c.tokens.resetDeadline(c) {
+			continue
+		}
+		return n, addr, err
+	}
+}
+
+func (c *sessionTokenRelayConn) exit() error {
+	c.exitOnce.Do(func() { close(c.exited) })
+	return net.ErrClosed
+}
+
+// SetReadDeadline sets the read deadline of the allocation.
+func (c *sessionTokenRelayConn) SetReadDeadline(t time.Time) error {
+	c.tokens.setDeadline(c, t)
+	return nil
+}
+
+// WriteTo writes to the relay socket.
+func (c *sessionTokenRelayConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// Close ends the allocation and reserves the relay socket.
+func (c *sessionTokenRelayConn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	return c.tokens.reserve(c)
+}
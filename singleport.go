@@ -0,0 +1,286 @@
+package stunner
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4"
+)
+
+// SinglePortQueueSize is the number of peer packets that can be queued per allocation in
+// single-port mode. Packets received when the queue is full are dropped.
+var SinglePortQueueSize = 128
+
+var errPeerInUse = errors.New("peer address already in use by another allocation")
+var errPeerIsClient = errors.New("peer address has an allocation on the listener")
+
+// SinglePortMux multiplexes the relayed peer traffic of all the allocations of a UDP listener onto
+// the listener port, so that only a single UDP port needs to be exposed. Allocations learn their
+// peers from the outgoing traffic: once an allocation sends a packet to a peer, all subsequent
+// packets received on the listener port from the same peer transport address are delivered to that
+// allocation. Consequently, a peer transport address can be used by only a single allocation at a
+// time, and a peer cannot reach an allocation before the allocation has sent a packet to the peer.
+// The transport addresses of the clients with an allocation on the listener cannot be used as
+// peers, and the TURN messages received from these clients are always passed to the TURN server.
+type SinglePortMux struct {
+	relayAddr *net.UDPAddr
+	conn      net.PacketConn
+	peers     map[string]*singlePortRelayConn
+	clients   map[string]int // number of allocations per client address
+	lock      sync.RWMutex
+	log       logging.LeveledLogger
+}
+
+// NewSinglePortMux creates a new single-port multiplexer that returns relayAddr as the relay
+// transport address to the clients.
+func NewSinglePortMux(relayAddr *net.UDPAddr, log logging.LeveledLogger) *SinglePortMux {
+	return &SinglePortMux{
+		relayAddr: relayAddr,
+		peers:     map[string]*singlePortRelayConn{},
+		clients:   map[string]int{},
+		log:       log,
+	}
+}
+
+// NewPacketConn decorates a listener socket with single-port demultiplexing. Packets received from
+// known peers are delivered to the corresponding allocations, all other packets are returned to
+// the caller (the TURN server). The first socket is also used to send the peer traffic.
+func (m *SinglePortMux) NewPacketConn(c net.PacketConn) net.PacketConn {
+	m.lock.Lock()
+	if m.conn == nil {
+		m.conn = c
+	}
+	m.lock.Unlock()
+
+	return &singlePortPacketConn{PacketConn: c, mux: m}
+}
+
+// NewRelayConn creates a relay connection for a new allocation.
+func (m *SinglePortMux) NewRelayConn() net.PacketConn {
+	return &singlePortRelayConn{
+		mux:   m,
+		peers: map[string]bool{},
+		in:    make(chan singlePortPacket, SinglePortQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// EventHandlers decorates the allocation lifecycle callbacks of the TURN server of the listener
+// to keep track of the clients with an allocation.
+func (m *SinglePortMux) EventHandlers(h turn.EventHandlers) turn.EventHandlers {
+	created, deleted := h.OnAllocationCreated, h.OnAllocationDeleted
+	h.OnAllocationCreated = func(src, dst net.Addr, proto, username, realm string, relayAddr net.Addr, reqPort int) {
+		m.addClient(src)
+		if created != nil {
+			created(src, dst, proto, username, realm, relayAddr, reqPort)
+		}
+	}
+	h.OnAllocationDeleted = func(src, dst net.Addr, proto, username, realm string) {
+		m.deleteClient(src)
+		if deleted != nil {
+			deleted(src, dst, proto, username, realm)
+		}
+	}
+	return h
+}
+
+func (m *SinglePortMux) addClient(client net.Addr) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.clients[client.String()]++
+}
+
+func (m *SinglePortMux) deleteClient(client net.Addr) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := client.String()
+	if m.clients[key] <= 1 {
+		delete(m.clients, key)
+		return
+	}
+	m.clients[key]--
+}
+
+func (m *SinglePortMux) register(peer net.Addr, c *singlePortRelayConn) error {
+	key := peer.String()
+
+	m.lock.RLock()
+	owner, ok := m.peers[key]
+	_, isClient := m.clients[key]
+	m.lock.RUnlock()
+	if isClient {
+		return errPeerIsClient
+	}
+	if ok {
+		if owner != c {
+			return errPeerInUse
+		}
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.clients[key]; ok {
+		return errPeerIsClient
+	}
+	if owner, ok := m.peers[key]; ok && owner != c {
+		return errPeerInUse
+	}
+	m.peers[key] = c
+	c.peers[key] = true
+
+	m.log.Debugf("single-port: registered peer %s", key)
+
+	return nil
+}
+
+func (m *SinglePortMux) unregister(c *singlePortRelayConn) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for key := range c.peers {
+		if m.peers[key] == c {
+			delete(m.peers, key)
+		}
+	}
+	c.peers = map[string]bool{}
+}
+
+// deliver passes a packet received from a peer to the allocation. Returns false if the packet is
+// to be passed to the TURN server instead.
+func (m *SinglePortMux) deliver(p []byte, addr net.Addr) bool {
+	key := addr.String()
+	m.lock.RLock()
+	c, ok := m.peers[key]
+	_, isClient := m.clients[key]
+	m.lock.RUnlock()
+	if !ok {
+		return false
+	}
+
+	// TURN messages from the clients take precedence over the peers
+	if isClient && isTURNPacket(p) {
+		return false
+	}
+
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	select {
+	case c.in <- singlePortPacket{data: buf, addr: addr}:
+	default:
+		m.log.Debugf("single-port: queue full, dropping packet from peer %s", addr.String())
+	}
+
+	return true
+}
+
+// singlePortPacketConn is a listener socket that diverts the packets received from known peers.
+type singlePortPacketConn struct {
+	net.PacketConn
+	mux *SinglePortMux
+}
+
+// ReadFrom reads from the PacketConn. Packets from peers are never returned to the caller.
+func (c *singlePortPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		if !c.mux.deliver(p[:n], addr) {
+			return n, addr, nil
+		}
+	}
+}
+
+type singlePortPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// singlePortRelayConn is the relay connection of an allocation in single-port mode.
+type singlePortRelayConn struct {
+	mux          *SinglePortMux
+	peers        map[string]bool // protected by the mux lock
+	in           chan singlePortPacket
+	done         chan struct{}
+	closeOnce    sync.Once
+	readDeadline time.Time
+	lock         sync.Mutex
+}
+
+func (c *singlePortRelayConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.lock.Lock()
+	deadline := c.readDeadline
+	c.lock.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case pkt := <-c.in:
+		return copy(p, pkt.data), pkt.addr, nil
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *singlePortRelayConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	if err := c.mux.register(addr, c); err != nil {
+		return 0, err
+	}
+
+	c.mux.lock.RLock()
+	conn := c.mux.conn
+	c.mux.lock.RUnlock()
+	if conn == nil {
+		return 0, errNilConn
+	}
+
+	return conn.WriteTo(p, addr)
+}
+
+func (c *singlePortRelayConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mux.unregister(c)
+	})
+	return nil
+}
+
+func (c *singlePortRelayConn) LocalAddr() net.Addr {
+	return c.mux.relayAddr
+}
+
+func (c *singlePortRelayConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *singlePortRelayConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *singlePortRelayConn) SetWriteDeadline(_ time.Time) error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package stunner
+
+import (
+	"errors"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// IsStandby returns true if STUNner is running in standby mode.
+func (s *Stunner) IsStandby() bool {
+	return s.standby.Load()
+}
+
+// Promote switches STUNner from standby mode into active mode: the TURN servers of all listeners
+// are started. Promote is a no-op if STUNner is already active. If some listeners fail to start
+// then STUNner remains in active mode and the error of the first failing listener is returned.
+// Returns ErrInvalidState if STUNner is already closed.
+func (s *Stunner) Promote() error {
+	if err := s.checkState("promote"); err != nil {
+		return err
+	}
+
+	s.standbyLock.Lock()
+	defer s.standbyLock.Unlock()
+
+	// STUNner may have been closed while waiting for the lock
+	if err := s.checkState("promote"); err != nil {
+		return err
+	}
+
+	if !s.standby.Load() {
+		return nil
+	}
+
+	s.log.Info("Promoting STUNner into active mode")
+	s.standby.Store(false)
+
+	if s.dryRun {
+		return nil
+	}
+
+	var errFinal error
+	for _, name := range s.listenerManager.Keys() {
+		l := s.GetListener(name)
+		if err := s.StartServer(l); err != nil {
+			s.log.Errorf("Could not start listener %q: %s", name, err.Error())
+			s.onError(l, err)
+			if errFinal == nil {
+				errFinal = err
+			}
+			continue
+		}
+		s.onStart(l)
+	}
+
+	return errFinal
+}
+
+// Demote switches STUNner from active mode into standby mode: the TURN servers of all listeners
+// are shut down and all allocations are lost. The configuration is still reconciled in standby
+// mode but listeners do not bind to their addresses until STUNner is promoted into active
+// mode. Demote is a no-op if STUNner is already in standby mode. Returns ErrInvalidState if
+// STUNner is already closed.
+func (s *Stunner) Demote() error {
+	if err := s.checkState("demote"); err != nil {
+		return err
+	}
+
+	s.standbyLock.Lock()
+	defer s.standbyLock.Unlock()
+
+	// STUNner may have been closed while waiting for the lock
+	if err := s.checkState("demote"); err != nil {
+		return err
+	}
+
+	if s.standby.Load() {
+		return nil
+	}
+
+	s.log.Info("Demoting STUNner into standby mode")
+	s.standby.Store(true)
+
+	if s.dryRun {
+		return nil
+	}
+
+	var errFinal error
+	for _, name := range s.listenerManager.Keys() {
+		l := s.GetListener(name)
+		if err := l.Close(); err != nil && !errors.Is(err, object.ErrRestartRequired) {
+			s.log.Errorf("Could not stop listener %q: %s", name, err.Error())
+			if errFinal == nil {
+				errFinal = err
+			}
+			continue
+		}
+		s.onStop(l)
+	}
+
+	return errFinal
+}
+
+// NewStandbyHandler creates a helper function for the admin API to promote and demote STUNner.
+func (s *Stunner) NewStandbyHandler() object.StandbyHandler {
+	return func(standby bool) error {
+		if standby {
+			return s.Demote()
+		}
+		return s.Promote()
+	}
+}
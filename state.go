@@ -0,0 +1,71 @@
+package stunner
+
+import (
+	"fmt"
+)
+
+// State is the lifecycle state of a STUNner daemon. A daemon starts in the New state, enters the
+// Running state after the first successful reconciliation, enters the Draining state on Shutdown
+// or Drain (CancelDrain returns to the previous state), and enters the Stopped state on Close.
+// Stopped is final.
+type State int32
+
+const (
+	StateNew State = iota
+	StateRunning
+	StateDraining
+	StateStopped
+)
+
+// String returns a string representation of the state.
+func (st State) String() string {
+	switch st {
+	case StateNew:
+		return "New"
+	case StateRunning:
+		return "Running"
+	case StateDraining:
+		return "Draining"
+	case StateStopped:
+		return "Stopped"
+	default:
+		return fmt.Sprintf("<unknown state: %d>", int32(st))
+	}
+}
+
+// ErrInvalidState is returned when an operation is invoked on STUNner in a lifecycle state that
+// does not admit the operation, e.g., when reconciling a closed daemon.
+type ErrInvalidState struct {
+	Op    string
+	State State
+}
+
+func (e ErrInvalidState) Error() string {
+	return fmt.Sprintf("cannot %s STUNner in state %s", e.Op, e.State)
+}
+
+// GetState returns the lifecycle state of STUNner.
+func (s *Stunner) GetState() State {
+	return State(s.state.Load())
+}
+
+// checkState returns an ErrInvalidState error if STUNner is stopped.
+func (s *Stunner) checkState(op string) error {
+	if st := s.GetState(); st == StateStopped {
+		return ErrInvalidState{Op: op, State: st}
+	}
+	return nil
+}
+
+// setState moves STUNner into a new state unless it is stopped. Returns the previous state.
+func (s *Stunner) setState(st State) State {
+	for {
+		old := s.state.Load()
+		if State(old) == StateStopped {
+			return StateStopped
+		}
+		if s.state.CompareAndSwap(old, int32(st)) {
+			return State(old)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package stunner
+
+import "encoding/binary"
+
+// stunStreamReader reassembles the STUN messages from the byte stream of a TCP or TLS connection,
+// skipping TURN ChannelData messages, and resynchronizes at the next read if the stream cannot be
+// parsed.
+type stunStreamReader struct {
+	buf []byte
+}
+
+// feed adds the bytes read from the stream, calling f on each complete STUN message.
+func (r *stunStreamReader) feed(p []byte, f func(msg []byte)) {
+	r.buf = append(r.buf, p...)
+	for len(r.buf) >= 4 {
+		size := int(binary.BigEndian.Uint16(r.buf[2:4]))
+		switch {
+		case r.buf[0]>>6 == 0: // STUN
+			if len(r.buf) >= 8 && binary.BigEndian.Uint32(r.buf[4:8]) != stunMagicCookie {
+				r.buf = nil
+				return
+			}
+			size += 20
+		case r.buf[0]>>6 == 1: // ChannelData, padded to 4 bytes over TCP
+			size = 4 + (size+3)&^3
+		default:
+			r.buf = nil
+			return
+		}
+		if len(r.buf) < size {
+			break
+		}
+		if r.buf[0]>>6 == 0 {
+			f(r.buf[:size])
+		}
+		r.buf = r.buf[size:]
+	}
+	if len(r.buf) == 0 {
+		r.buf = nil
+	}
+}
+
+// reset drops the partial message, if any.
+func (r *stunStreamReader) reset() {
+	r.buf = nil
+}
@@ -0,0 +1,140 @@
+package stunner
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+const (
+	strictReasonFingerprint = "fingerprint"
+	strictReasonIntegrity   = "integrity"
+)
+
+// StrictPolicy returns whether STUN requests must carry a valid FINGERPRINT and a
+// MESSAGE-INTEGRITY attribute, respectively.
+type StrictPolicy = func() (bool, bool)
+
+// StrictPacketConn is a net.PacketConn that enforces strict RFC 5389 mode on a UDP listener:
+// STUN requests without a valid FINGERPRINT or without a MESSAGE-INTEGRITY attribute are consumed
+// before they would reach the TURN server and rejected with a 400 (Bad Request) error, or silently
+// dropped if the listener drops rate-limited Binding requests silently. The MESSAGE-INTEGRITY of
+// Binding requests is verified with the long-term credentials of the client, since the TURN server
+// does not authenticate Binding requests; for all other requests the MESSAGE-INTEGRITY is checked
+// by the TURN server. Unauthenticated Allocate requests are let through, since the TURN server
+// answers these with the authentication challenge.
+type StrictPacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	policy    StrictPolicy
+	auth      a12n.AuthHandler
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewStrictPacketConn decorates a listener PacketConn with strict FINGERPRINT and
+// MESSAGE-INTEGRITY enforcement, using the auth handler to verify the MESSAGE-INTEGRITY of Binding
+// requests.
+func NewStrictPacketConn(c net.PacketConn, l *object.Listener, policy StrictPolicy, auth a12n.AuthHandler, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &StrictPacketConn{
+		PacketConn: c,
+		listener:   l,
+		policy:     policy,
+		auth:       auth,
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn. Requests violating the strict mode are consumed and never
+// returned to the caller.
+func (c *StrictPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || addr == nil || !stun.IsMessage(p[:n]) || stunClass(p) != 0 {
+			return n, addr, err
+		}
+
+		fingerprint, integrity := c.policy()
+		if !fingerprint && !integrity {
+			return n, addr, err
+		}
+
+		m := &stun.Message{Raw: append([]byte{}, p[:n]...)}
+		if derr := m.Decode(); derr != nil {
+			return n, addr, err
+		}
+
+		reason := ""
+		switch {
+		case fingerprint && stun.Fingerprint.Check(m) != nil:
+			reason = strictReasonFingerprint
+		case integrity && !m.Contains(stun.AttrMessageIntegrity) &&
+			m.Type.Method != stun.MethodAllocate:
+			reason = strictReasonIntegrity
+		case integrity && m.Type.Method == stun.MethodBinding && !c.checkIntegrity(m, addr):
+			reason = strictReasonIntegrity
+		default:
+			return n, addr, err
+		}
+
+		c.log.Debugf("rejecting %s request from client %s: missing or invalid %s",
+			m.Type.Method.String(), addr.String(), reason)
+		c.telemetry.IncrementStrictRejected(c.listener.Name, reason)
+		// an error response to a spoofed source would make the listener a reflector
+		if _, silent := c.listener.GetBindingRateLimit(); silent {
+			continue
+		}
+		c.reject(m, addr)
+	}
+}
+
+// checkIntegrity verifies the MESSAGE-INTEGRITY of a Binding request.
+func (c *StrictPacketConn) checkIntegrity(m *stun.Message, addr net.Addr) bool {
+	var username stun.Username
+	if err := username.GetFrom(m); err != nil {
+		return false
+	}
+
+	var realm stun.Realm
+	if err := realm.GetFrom(m); err != nil {
+		// short-term credentials are accepted only in the connectivity checks addressed to
+		// the ICE-lite responder, which verifies them
+		local, _, ok := strings.Cut(username.String(), ":")
+		return ok && c.listener.ICEUfrag != "" && local == c.listener.ICEUfrag
+	}
+
+	if c.auth == nil {
+		return false
+	}
+	key, ok := c.auth(username.String(), realm.String(), addr)
+	if !ok {
+		return false
+	}
+
+	return stun.MessageIntegrity(key).Check(m) == nil
+}
+
+func (c *StrictPacketConn) reject(m *stun.Message, addr net.Addr) {
+	res, err := stun.Build(
+		stun.NewTransactionIDSetter(m.TransactionID),
+		stun.NewType(m.Type.Method, stun.ClassErrorResponse),
+		stun.CodeBadRequest,
+		stun.Fingerprint,
+	)
+	if err != nil {
+		c.log.Debugf("could not build error response: %s", err.Error())
+		return
+	}
+
+	if _, err := c.PacketConn.WriteTo(res.Raw, addr); err != nil {
+		c.log.Debugf("could not send error response to client %s: %s",
+			addr.String(), err.Error())
+	}
+}
@@ -0,0 +1,145 @@
+package stunner
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+)
+
+// STUNAttributeHandler is a hook for inspecting the STUN requests received at the UDP listeners and
+// for appending custom attributes, e.g., vendor-specific diagnostics, to the STUN responses sent
+// by STUNner. The handler is called synchronously from the listener readloop, so it must not
+// block.
+type STUNAttributeHandler interface {
+	// HandleRequest is called for each STUN request that reaches the TURN server, with a copy
+	// of the decoded request. Requests rejected by STUNner before reaching the TURN server (e.g.,
+	// due to rate limiting or the strict mode) are not reported.
+	HandleRequest(listener string, client net.Addr, req *stun.Message)
+	// HandleResponse is called for each STUN response (success or error) sent by the TURN
+	// server, with a copy of the decoded response, and returns the attributes to append to the
+	// response. Only comprehension-optional attributes (with a type in the range
+	// 0x8000-0xFFFF) can be appended, other attributes are dropped, so that clients not
+	// understanding the attributes can safely ignore them. Since the MESSAGE-INTEGRITY of
+	// authenticated responses cannot be recomputed, no attributes are appended to responses
+	// that carry a MESSAGE-INTEGRITY attribute. The FINGERPRINT, if any, is recomputed.
+	HandleResponse(listener string, client net.Addr, res *stun.Message) []stun.RawAttribute
+}
+
+type stunAttributeHook struct {
+	handler STUNAttributeHandler
+}
+
+// SetSTUNAttributeHandler sets the handler for inspecting STUN requests and appending custom
+// attributes to the STUN responses at the UDP listeners. The handler takes effect immediately,
+// including for running listeners. A nil handler disables the hook.
+func (s *Stunner) SetSTUNAttributeHandler(h STUNAttributeHandler) {
+	if h == nil {
+		s.stunAttrHook.Store(nil)
+		return
+	}
+	s.stunAttrHook.Store(&stunAttributeHook{handler: h})
+}
+
+// stunAttributePacketConn is a listener net.PacketConn that calls the STUN attribute handler on
+// the STUN requests and responses.
+type stunAttributePacketConn struct {
+	net.PacketConn
+	listener string
+	hook     *atomic.Pointer[stunAttributeHook]
+	log      logging.LeveledLogger
+}
+
+func newSTUNAttributePacketConn(c net.PacketConn, listener string, hook *atomic.Pointer[stunAttributeHook], log logging.LeveledLogger) net.PacketConn {
+	return &stunAttributePacketConn{PacketConn: c, listener: listener, hook: hook, log: log}
+}
+
+// ReadFrom reads from the PacketConn, reporting STUN requests to the handler.
+func (c *stunAttributePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err != nil || addr == nil || !stun.IsMessage(p[:n]) || stunClass(p) != 0 {
+		return n, addr, err
+	}
+
+	hook := c.hook.Load()
+	if hook == nil {
+		return n, addr, err
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p[:n]...)}
+	if derr := m.Decode(); derr != nil {
+		return n, addr, err
+	}
+	hook.handler.HandleRequest(c.listener, addr, m)
+
+	return n, addr, err
+}
+
+// WriteTo writes to the PacketConn, appending the custom attributes returned by the handler to
+// STUN responses.
+func (c *stunAttributePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if !stun.IsMessage(p) || stunClass(p)&0x0100 == 0 {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	hook := c.hook.Load()
+	if hook == nil {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	m := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := m.Decode(); err != nil {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	attrs := hook.handler.HandleResponse(c.listener, addr, m)
+	if len(attrs) == 0 {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+	if m.Contains(stun.AttrMessageIntegrity) {
+		c.log.Tracef("not appending custom attributes to authenticated %s response to client %s",
+			m.Type.Method.String(), addr.String())
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	res := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := res.Decode(); err != nil {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+	fingerprint := res.Contains(stun.AttrFingerprint)
+	if fingerprint {
+		// the FINGERPRINT is always the last attribute, strip it so that it can be recomputed
+		res.Attributes = res.Attributes[:len(res.Attributes)-1]
+		res.Raw = res.Raw[:len(res.Raw)-fingerprintAttrSize]
+		res.Length -= fingerprintAttrSize
+		res.WriteLength()
+	}
+
+	for _, a := range attrs {
+		if a.Type < 0x8000 {
+			c.log.Debugf("dropping comprehension-required custom attribute %s in %s "+
+				"response to client %s", a.Type.String(), m.Type.Method.String(),
+				addr.String())
+			continue
+		}
+		res.Add(a.Type, a.Value)
+	}
+
+	if fingerprint {
+		if err := stun.Fingerprint.AddTo(res); err != nil {
+			c.log.Debugf("could not add fingerprint to %s response: %s",
+				m.Type.Method.String(), err.Error())
+			return c.PacketConn.WriteTo(p, addr)
+		}
+	}
+
+	if _, err := c.PacketConn.WriteTo(res.Raw, addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// fingerprintAttrSize is the size of an encoded FINGERPRINT attribute: a 4 byte header plus the
+// 4 byte CRC.
+const fingerprintAttrSize = 8
@@ -2,8 +2,13 @@
 package stunner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/logging"
@@ -14,6 +19,7 @@ import (
 	"github.com/l7mp/stunner/internal/object"
 	"github.com/l7mp/stunner/internal/resolver"
 	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
 	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
 	licensecfg "github.com/l7mp/stunner/pkg/config/license"
 	"github.com/l7mp/stunner/pkg/logger"
@@ -22,6 +28,9 @@ import (
 // DefaultLogLevel indicates the default log level.
 const DefaultLogLevel = "all:WARN"
 
+// drainCheckInterval is the period at which Shutdown and Drain check whether all allocations are drained.
+const drainCheckInterval = time.Second
+
 // DefaultInstanceId is the default instance id for stunnerd processes.
 var DefaultInstanceId = fmt.Sprintf("default/stunnerd-%s", uuid.New().String())
 
@@ -33,9 +42,9 @@ var ErrRestartRequired = object.ErrRestartRequired
 type Stunner struct {
 	name, version                                              string
 	adminManager, authManager, listenerManager, clusterManager manager.Manager
-	suppressRollback, dryRun                                   bool
-	resolver                                                   resolver.DnsResolver
-	udpThreadNum                                               int
+	suppressRollback, dryRun, delegatedLogging                 bool
+	resolver, consul, eds                                      resolver.DnsResolver
+	udpThreadNum, udpRcvBufMax                                 int
 	telemetry                                                  *telemetry.Telemetry
 	logger                                                     logger.LoggerFactory
 	log                                                        logging.LeveledLogger
@@ -44,24 +53,76 @@ type Stunner struct {
 	node                                                       string
 	net                                                        transport.Net
 	ready, shutdown, forceReady                                bool
+	preReconcileHooks, postReconcileHooks                      []ReconcileHook
+	lifecycleCallbacks                                         map[string]LifecycleCallbacks
+	standby, draining                                          atomic.Bool
+	standbyLock                                                sync.Mutex
+	reconciles                                                 *reconcileQueue
+	tap                                                        *tapRegistry
+	capture                                                    atomic.Pointer[Capture]
+	stunAttrHook                                               atomic.Pointer[stunAttributeHook]
+	oauth                                                      *oauthRegistry
+	origins                                                    *originRegistry
+	upgrade                                                    *upgradeRegistry
+	idle                                                       *idleRegistry
+	toggles                                                    *listenerToggles
+	fds                                                        *fdMonitor
+	faults                                                     *faultInjector
+	sysChecks                                                  *sysChecker
+	capabilities                                               *stnrv1.Capabilities
+	conditions                                                 *conditionTracker
+	stats                                                      *listenerStatsRegistry
+	talkers                                                    *talkerRegistry
+	rtt                                                        *rttRegistry
+	churn                                                      *churnTracker
+	gc                                                         *gcTuner
+	selfCheck                                                  *selfChecker
+	watchdog                                                   *watchdog
+	mobility                                                   *mobilityRegistry
+	lifetimes                                                  *lifetimeRegistry
+	relayPorts                                                 *relayPortRegistry
+	extensions                                                 *adminExtensions
+	clock                                                      Clock
+	events                                                     *reconcileEventBroker
+	watchers                                                   *configWatchers
+	churnHook                                                  atomic.Pointer[ChurnHandler]
+	watchdogHook                                               atomic.Pointer[WatchdogHandler]
+	relayPortHook                                              atomic.Pointer[RelayPortExhaustionHandler]
+	warnings                                                   atomic.Pointer[[]stnrv1.ConfigWarning]
+	errorReasons                                               atomic.Pointer[errorReasonTemplates]
+	rollbackErr                                                error
+	cancel                                                     context.CancelFunc
+	generation                                                 atomic.Int64
+	state                                                      atomic.Int32
 }
 
 // NewStunner creates a new STUNner deamon for the specified Options. Call Reconcile to reconcile
 // the daemon for a new configuration. Object lifecycle is as follows: the daemon is "alive"
 // (answers liveness probes if healthchecking is enabled) once the main object is successfully
 // initialized, and "ready" after the first successful reconciliation (answers readiness probes if
-// healthchecking is enabled). Calling program should catch SIGTERM signals and call Shutdown(),
+// healthchecking is enabled). Calling program should catch SIGTERM signals and call Shutdown,
 // which will keep on serving connections but will fail readiness probes.
 func NewStunner(options Options) *Stunner {
-	logger := logger.NewLoggerFactory(DefaultLogLevel)
-	if options.LogLevel != "" {
-		logger.SetLevel(options.LogLevel)
+	var lf logger.LoggerFactory
+	if options.LoggerFactory != nil {
+		lf = logger.NewDelegatingLoggerFactory(options.LoggerFactory)
+	} else {
+		lf = logger.NewLoggerFactory(DefaultLogLevel)
+		if options.LogLevel != "" {
+			lf.SetLevel(options.LogLevel)
+		}
 	}
+	logger := lf
 	log := logger.NewLogger("stunner")
 
+	clock := options.Clock
+	if clock == nil {
+		clock = util.NewRealClock()
+	}
+
 	r := options.Resolver
 	if r == nil {
-		r = resolver.NewDnsResolver("dns-resolver", logger)
+		r = resolver.NewDnsResolverWithClock("dns-resolver", clock, logger)
 	}
 
 	var vnet transport.Net
@@ -82,6 +143,11 @@ func NewStunner(options Options) *Stunner {
 		udpThreadNum = options.UDPListenerThreadNum
 	}
 
+	udpRcvBufMax := 0
+	if options.UDPReceiveBufferMax > 0 {
+		udpRcvBufMax = options.UDPReceiveBufferMax
+	}
+
 	id := options.Name
 	if id == "" {
 		if h, err := os.Hostname(); err != nil {
@@ -91,47 +157,131 @@ func NewStunner(options Options) *Stunner {
 		}
 	}
 
+	var eds resolver.DnsResolver
+	if options.XDSAddress != "" {
+		var err error
+		eds, err = resolver.NewEDSResolver("eds-resolver", options.XDSAddress, id,
+			options.XDSTLSConfig, logger)
+		if err != nil {
+			log.Errorf("Could not create EDS resolver, EDS clusters disabled: %s", err.Error())
+		}
+	}
+
 	s := &Stunner{
 		name:             id,
 		version:          stnrv1.ApiVersion,
 		logger:           logger,
 		log:              log,
 		suppressRollback: options.SuppressRollback,
+		delegatedLogging: options.LoggerFactory != nil,
 		dryRun:           options.DryRun,
 		resolver:         r,
+		consul:           resolver.NewConsulResolver("consul-resolver", options.ConsulAddress, logger),
+		eds:              eds,
 		udpThreadNum:     udpThreadNum,
+		udpRcvBufMax:     udpRcvBufMax,
 		node:             options.NodeName,
 		forceReady:       options.ForceReadyDuringTermination,
 		net:              vnet,
+		tap:              newTapRegistry(),
+		oauth:            newOAuthRegistry(),
+		origins:          newOriginRegistry(),
+		upgrade:          newUpgradeRegistry(options.HitlessUpgrade, logger.NewLogger("upgrade")),
+		idle:             newIdleRegistry(),
+		toggles:          newListenerToggles(),
+		sysChecks:        newSysChecker(logger.NewLogger("syscheck")),
+		faults:           newFaultInjector(logger.NewLogger("fault")),
+		conditions:       newConditionTracker(),
+		stats:            newListenerStatsRegistry(),
+		talkers:          newTalkerRegistry(),
+		rtt:              newRTTRegistry(),
+		churn:            newChurnTracker(),
+		gc:               newGCTuner(logger.NewLogger("gc")),
+		selfCheck:        newSelfChecker(),
+		watchdog:         newWatchdog(),
+		mobility:         newMobilityRegistry(clock),
+		lifetimes:        newLifetimeRegistry(),
+		relayPorts:       newRelayPortRegistry(),
+		extensions:       newAdminExtensions(),
+		reconciles:       newReconcileQueue(options.ReconcileCoalescing),
+		clock:            clock,
+		events:           newReconcileEventBroker(logger.NewLogger("reconcile-events")),
+		watchers:         newConfigWatchers(),
 	}
 
+	s.standby.Store(options.Standby)
+
 	s.offloadHandler = s.NewOffloadHandler()
+	s.capabilities = s.detectCapabilities()
 	statsHandler := func(name string, marker stnrv1.StatType) stnrv1.OffloadDirStat {
 		return s.offloadHandler.Stats(name, marker)
 	}
 
+	s.registerAdminEndpoints()
 	s.adminManager = manager.NewManager("admin-manager",
-		object.NewAdminFactory(options.DryRun, s.NewReadinessHandler(), s.NewStatusHandler(), logger), logger)
+		object.NewAdminFactory(options.DryRun, s.extensions.probeMux(), s.extensions.apiMux(), logger),
+		logger)
 	s.authManager = manager.NewManager("auth-manager",
 		object.NewAuthFactory(logger), logger)
 	s.listenerManager = manager.NewManager("listener-manager",
 		object.NewListenerFactory(vnet, s.NewRealmHandler(), statsHandler, logger), logger)
 	s.clusterManager = manager.NewManager("cluster-manager",
-		object.NewClusterFactory(r, statsHandler, logger), logger)
+		object.NewClusterFactory(r, s.consul, s.eds, statsHandler, logger), logger)
 	s.quotaHandler = s.NewQuotaHandler()
 
 	telemetryCallbacks := telemetry.Callbacks{
 		GetAllocationCount: func() int64 { return s.GetActiveConnections() },
+		GetFDUsage:         util.FDUsage,
+		GetConfigId:        s.GetConfigId,
+		GetRelayPortUsage: func(observe func(name, portRange string, used, free int)) {
+			for _, u := range s.GetRelayPortUsage() {
+				observe(u.Listener, fmt.Sprintf("%d-%d", u.MinPort, u.MaxPort), u.Used, u.Free)
+			}
+		},
 	}
-	t, err := telemetry.New(telemetryCallbacks, s.dryRun, logger.NewLogger("metrics"))
+	t, err := telemetry.New(telemetryCallbacks, s.dryRun, options.MetricsLabels,
+		logger.NewLogger("metrics"))
 	if err != nil {
 		log.Errorf("Could not initialize metric provider: %s", err.Error())
 		return nil
 	}
 	s.telemetry = t
 
+	if options.TapMirrorAddress != "" {
+		if tap, err := NewUDPMirrorTap(options.TapMirrorAddress, logger.NewLogger("tap")); err != nil {
+			log.Errorf("Could not initialize packet tap: %s", err.Error())
+		} else {
+			s.SetPacketTap(tap)
+		}
+	}
+
+	if options.CaptureFile != "" {
+		if f, err := os.Create(options.CaptureFile); err != nil {
+			log.Errorf("Could not create capture file: %s", err.Error())
+		} else {
+			s.SetCapture(NewCapture(f))
+		}
+	}
+
 	if !s.dryRun {
-		s.resolver.Start()
+		// the DNS resolver threads are canceled on Close
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		s.resolver.Start(ctx)
+		s.consul.Start(ctx)
+		if s.eds != nil {
+			s.eds.Start(ctx)
+		}
+
+		if options.FDWarnThreshold > 0 || options.FDRefuseThreshold > 0 {
+			s.fds = newFDMonitor(options.FDWarnThreshold, options.FDRefuseThreshold,
+				logger.NewLogger("fd-monitor"))
+			go s.fds.run(ctx)
+		}
+
+		go s.runListenerStats(ctx)
+		go s.runSelfCheck(ctx)
+		go s.runWatchdog(ctx)
 	}
 
 	return s
@@ -153,10 +303,19 @@ func (s *Stunner) IsReady() bool {
 }
 
 // Shutdown causes STUNner to fail the readiness check. Manwhile, it will keep on serving
-// connections. This function should be called after the main program catches a SIGTERM.
-func (s *Stunner) Shutdown() {
+// connections. Shutdown blocks until all allocations have been drained, or until the context is
+// canceled or its deadline expires, in which case the context error is returned. This function
+// should be called after the main program catches a SIGTERM. Shutdown moves STUNner into the
+// Draining state for good and returns ErrInvalidState if STUNner is already closed.
+func (s *Stunner) Shutdown(ctx context.Context) error {
+	if err := s.checkState("shut down"); err != nil {
+		return err
+	}
+	s.setState(StateDraining)
 	s.shutdown = true
 	s.ready = false
+
+	return s.waitForAllocations(ctx)
 }
 
 // GetAdmin returns the admin object. Panics if no admin object is available.
@@ -168,6 +327,24 @@ func (s *Stunner) GetAdmin() *object.Admin {
 	return a.(*object.Admin)
 }
 
+// GetConfigId returns the opaque identifier of the running config set in the admin config, or an
+// empty string if unset.
+func (s *Stunner) GetConfigId() string {
+	if len(s.adminManager.Keys()) == 0 {
+		return ""
+	}
+	return s.GetAdmin().GetConfigId()
+}
+
+// GetReconcileDebounce returns the minimum time between two consecutive reconciliations, or zero
+// if STUNner has not been configured yet.
+func (s *Stunner) GetReconcileDebounce() time.Duration {
+	if len(s.adminManager.Keys()) == 0 {
+		return 0
+	}
+	return s.GetAdmin().GetReconcileDebounce()
+}
+
 // GetLicenseConfigManager returns the manager handling license status. Panics if no manager is
 // available.
 func (s *Stunner) GetLicenseConfigManager() licensecfg.ConfigManager {
@@ -210,12 +387,59 @@ func (s *Stunner) GetRealm() string {
 	return auth.Realm
 }
 
+// getNoncePolicy returns the nonce lifetime and the nonce regeneration policy.
+func (s *Stunner) getNoncePolicy() (time.Duration, string) {
+	return s.GetAuth().GetNoncePolicy()
+}
+
+// AddCredential adds a username/password pair to the running STUNner instance without a full
+// config reconcile. Only supported with static authentication, where the credential is accepted
+// alongside the configured static credential. A nonzero ttl makes the credential expire after the
+// given time. Runtime credentials are not part of the config: they survive reconciliation but are
+// lost on restart.
+func (s *Stunner) AddCredential(username, password string, ttl time.Duration) error {
+	auth, found := s.authManager.Get(stnrv1.DefaultAuthName)
+	if !found || auth.(*object.Auth).Type != stnrv1.AuthTypeStatic {
+		return errors.New("runtime credentials require static authentication")
+	}
+	if username == "" || password == "" {
+		return errors.New("empty username or password")
+	}
+	if ttl < 0 {
+		return fmt.Errorf("invalid credential TTL %s", ttl.String())
+	}
+
+	s.log.Infof("Adding runtime credential for user %q (ttl: %s)", username, ttl.String())
+	auth.(*object.Auth).AddCredential(username, password, ttl)
+
+	return nil
+}
+
+// RemoveCredential removes a credential added with AddCredential. Existing allocations of the
+// user are not affected until the next authenticated request.
+func (s *Stunner) RemoveCredential(username string) error {
+	auth, found := s.authManager.Get(stnrv1.DefaultAuthName)
+	if !found || !auth.(*object.Auth).RemoveCredential(username) {
+		return fmt.Errorf("no runtime credential for user %q", username)
+	}
+
+	s.log.Infof("Removed runtime credential for user %q", username)
+
+	return nil
+}
+
+// getStrictMode returns whether STUN requests must carry a FINGERPRINT and a MESSAGE-INTEGRITY
+// attribute, respectively.
+func (s *Stunner) getStrictMode() (bool, bool) {
+	return s.GetAdmin().GetStrictMode()
+}
+
 // GetLogger returns the logger factory of the running daemon. Useful for creating a sub-logger.
 func (s *Stunner) GetLogger() logging.LoggerFactory {
 	return s.logger
 }
 
-// SetLogLevel sets the loglevel.
+// SetLogLevel sets the loglevel. No-op if logging is delegated to the host application.
 func (s *Stunner) SetLogLevel(levelSpec string) {
 	s.logger.SetLevel(levelSpec)
 }
@@ -227,9 +451,7 @@ func (s *Stunner) AllocationCount() int {
 	listeners := s.listenerManager.Keys()
 	for _, name := range listeners {
 		l := s.GetListener(name)
-		if l.Server != nil {
-			n += l.Server.AllocationCount()
-		}
+		n += l.AllocationCount()
 	}
 	return n
 }
@@ -239,9 +461,11 @@ func (s *Stunner) Status() stnrv1.Status {
 	status := stnrv1.StunnerStatus{ApiVersion: s.version}
 	if admin := s.GetAdmin(); admin != nil {
 		status.Admin = admin.Status().(*stnrv1.AdminStatus)
+		status.Admin.Meta = s.adminManager.Meta(admin.ObjectName())
 	}
 	if auth := s.GetAuth(); auth != nil {
 		status.Auth = auth.Status().(*stnrv1.AuthStatus)
+		status.Auth.Meta = s.authManager.Meta(auth.ObjectName())
 	}
 
 	ls := s.listenerManager.Keys()
@@ -249,6 +473,8 @@ func (s *Stunner) Status() stnrv1.Status {
 	for i, lName := range ls {
 		if l := s.GetListener(lName); l != nil {
 			status.Listeners[i] = l.Status().(*stnrv1.ListenerStatus)
+			status.Listeners[i].Meta = s.listenerManager.Meta(lName)
+			status.Listeners[i].Disabled = s.toggles.isDisabled(lName)
 		}
 	}
 
@@ -257,27 +483,65 @@ func (s *Stunner) Status() stnrv1.Status {
 	for i, cName := range cs {
 		if c := s.GetCluster(cName); c != nil {
 			status.Clusters[i] = c.Status().(*stnrv1.ClusterStatus)
+			status.Clusters[i].Meta = s.clusterManager.Meta(cName)
 		}
 	}
 
 	status.AllocationCount = s.AllocationCount()
+	status.Generation = s.generation.Load()
 	stat := "READY"
 	if !s.ready {
 		stat = "NOT-READY"
 	}
+	if s.IsStandby() {
+		stat = "STANDBY"
+	}
+	if s.IsDraining() {
+		stat = "DRAINING"
+	}
 	if s.shutdown {
 		stat = "TERMINATING"
 	}
 	status.Status = stat
 
+	s.updateConditions()
+	status.Conditions = s.conditions.list()
+	status.SystemChecks = s.sysChecks.list()
+	status.Capabilities = s.capabilities
+	status.Warnings = s.GetWarnings()
+
 	return &status
 }
 
+// GetWarnings returns the warnings reported for the last reconciled configuration.
+func (s *Stunner) GetWarnings() []stnrv1.ConfigWarning {
+	if ws := s.warnings.Load(); ws != nil {
+		return *ws
+	}
+	return nil
+}
+
 // Close stops the STUNner daemon, cleans up any internal state, and closes all connections
-// including the health-check and the metrics server listeners.
+// including the health-check and the metrics server listeners. Close moves STUNner into the
+// Stopped state, after which all lifecycle operations fail with ErrInvalidState. Close waits for
+// the running reconciliation, if any, to finish, so it must not be called from a reconcile hook.
+// Close is idempotent: closing a stopped STUNner is a no-op.
 func (s *Stunner) Close() {
+	if s.setState(StateStopped) == StateStopped {
+		s.log.Debug("STUNner already closed")
+		return
+	}
 	s.log.Info("closing STUNner")
 
+	s.watchers.close()
+
+	// wait for the running reconciliation, if any, and keep out the waiting ones, promotions
+	// and demotions and listener restarts while the objects are torn down
+	_ = s.reconciles.acquire(context.Background())
+	defer s.reconciles.release()
+	s.standbyLock.Lock()
+	defer s.standbyLock.Unlock()
+
 	// ignore restart-required errors
 	if len(s.adminManager.Keys()) > 0 {
 		_ = s.GetAdmin().Close()
@@ -292,7 +556,10 @@ func (s *Stunner) Close() {
 		l := s.GetListener(name)
 		if err := l.Close(); err != nil && err != object.ErrRestartRequired {
 			s.log.Errorf("Error closing listener %q at adddress %s: %s",
-				l.Proto.String(), l.Addr, err.Error())
+				l.Protocol(), l.Addr, err.Error())
+		}
+		if !s.dryRun {
+			s.onStop(l)
 		}
 	}
 
@@ -303,17 +570,31 @@ func (s *Stunner) Close() {
 			s.log.Errorf("Error closing cluster %q: %s", c.ObjectName(),
 				err.Error())
 		}
+		s.onStop(c)
 	}
 
 	if err := s.offloadHandler.Close(); err != nil {
 		s.log.Errorf("Could not shutdown offload handler cleanly: %s", err.Error())
 	}
 
+	s.SetPacketTap(nil)
+	s.SetCapture(nil)
+	s.gc.reset()
+
 	if err := s.telemetry.Close(); err != nil { // blocks until finished
 		s.log.Errorf("Could not shutdown metric provider cleanly: %s", err.Error())
 	}
 
 	s.resolver.Close()
+	s.consul.Close()
+	if s.eds != nil {
+		s.eds.Close()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	s.events.close()
 }
 
 // GetActiveConnections returns the number of active downstream (listener-side) TURN allocations.
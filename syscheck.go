@@ -0,0 +1,131 @@
+package stunner
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/pion/logging"
+
+	"github.com/l7mp/stunner/internal/util"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// Minimum values of the kernel parameters and the process resource limits recommended for running
+// STUNner. The file descriptor limit is scaled with the number of listeners, and the receive
+// buffer limit with the receive buffer autotuning cap (see Options.UDPReceiveBufferMax).
+const (
+	sysCheckMinFDs         = 65536
+	sysCheckFDsPerListener = 16384
+	sysCheckMinSocketBuf   = 4 * 1024 * 1024
+	sysCheckMinSomaxconn   = 4096
+)
+
+// sysChecker checks the kernel parameters and the process resource limits that limit the load a
+// STUNner instance can take against the running configuration, logs actionable warnings for the
+// failed checks and keeps the results for the status.
+type sysChecker struct {
+	sysctl  func(string) (int64, error)
+	fdUsage func() (int, int, error)
+	checks  []stnrv1.SystemCheck
+	lock    sync.RWMutex
+	log     logging.LeveledLogger
+}
+
+func newSysChecker(log logging.LeveledLogger) *sysChecker {
+	return &sysChecker{sysctl: util.Sysctl, fdUsage: util.FDUsage, log: log}
+}
+
+// check runs the checks for the given number of listeners. Warnings are logged only when the
+// result of a check changes, so that the checks can be rerun after each reconciliation.
+func (c *sysChecker) check(listeners int, hasTCP bool, rcvBufMax int) {
+	checks := []stnrv1.SystemCheck{}
+
+	// unsupported platform or no limit
+	if _, limit, err := c.fdUsage(); err == nil && limit > 0 {
+		rec := int64(max(sysCheckMinFDs, listeners*sysCheckFDsPerListener))
+		checks = append(checks, stnrv1.SystemCheck{
+			Name:        "RLIMIT_NOFILE",
+			Value:       int64(limit),
+			Recommended: rec,
+			Message: fmt.Sprintf("raise the open file limit, e.g., with \"ulimit -n %d\" or "+
+				"\"LimitNOFILE=%d\" in the systemd unit", rec, rec),
+		})
+	}
+
+	sysctls := []struct {
+		name string
+		rec  int64
+	}{
+		{"net.core.rmem_max", int64(max(sysCheckMinSocketBuf, rcvBufMax))},
+		{"net.core.wmem_max", sysCheckMinSocketBuf},
+	}
+	if hasTCP {
+		sysctls = append(sysctls, struct {
+			name string
+			rec  int64
+		}{"net.core.somaxconn", sysCheckMinSomaxconn})
+	}
+	for _, s := range sysctls {
+		v, err := c.sysctl(s.name)
+		if err != nil {
+			c.log.Debugf("Skipping system check %s: %s", s.name, err.Error())
+			continue
+		}
+		checks = append(checks, stnrv1.SystemCheck{
+			Name:        s.name,
+			Value:       v,
+			Recommended: s.rec,
+			Message:     fmt.Sprintf("raise with \"sysctl -w %s=%d\"", s.name, s.rec),
+		})
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i := range checks {
+		check := &checks[i]
+		check.Passed = check.Value >= check.Recommended
+		if check.Passed {
+			check.Message = ""
+		}
+
+		old := slices.IndexFunc(c.checks, func(o stnrv1.SystemCheck) bool {
+			return o.Name == check.Name
+		})
+		if old >= 0 && c.checks[old].Passed == check.Passed {
+			continue
+		}
+		if check.Passed {
+			if old >= 0 {
+				c.log.Infof("System check %s passed: %d", check.Name, check.Value)
+			}
+			continue
+		}
+		c.log.Warnf("System check %s failed: current value %d is below the recommended "+
+			"%d for %d listener(s): %s", check.Name, check.Value, check.Recommended,
+			listeners, check.Message)
+	}
+	c.checks = checks
+}
+
+// list returns the results of the last checks.
+func (c *sysChecker) list() []stnrv1.SystemCheck {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return slices.Clone(c.checks)
+}
+
+// checkSystem runs the system checks for the running configuration.
+func (s *Stunner) checkSystem() {
+	names := s.listenerManager.Keys()
+	hasTCP := false
+	for _, name := range names {
+		if l := s.GetListener(name); l != nil && l.HasProtocol(stnrv1.ListenerProtocolTURNTCP,
+			stnrv1.ListenerProtocolTURNTLS, stnrv1.ListenerProtocolTCP,
+			stnrv1.ListenerProtocolTLS) {
+			hasTCP = true
+		}
+	}
+	s.sysChecks.check(len(names), hasTCP, s.udpRcvBufMax)
+}
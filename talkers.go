@@ -0,0 +1,178 @@
+package stunner
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+type talkerSample struct {
+	at               time.Time
+	toPeer, fromPeer uint64
+}
+
+// talkerSession is an entry in the session table.
+type talkerSession struct {
+	listener, relay  string
+	username         string
+	client           net.Addr
+	toPeer, fromPeer atomic.Uint64
+	samples          []talkerSample
+}
+
+// talkerRegistry is the session table: it counts the traffic relayed by each session, keyed by
+// relay address, and keeps the samples of the counters over the rolling window.
+type talkerRegistry struct {
+	sessions map[string]*talkerSession
+	lock     sync.Mutex
+}
+
+func newTalkerRegistry() *talkerRegistry {
+	return &talkerRegistry{sessions: map[string]*talkerSession{}}
+}
+
+// track adds the relay connection of a new session to the session table.
+func (r *talkerRegistry) track(listener string, relayAddr net.Addr, conn net.PacketConn) net.PacketConn {
+	sess := &talkerSession{
+		listener: listener,
+		relay:    relayAddr.String(),
+		samples:  []talkerSample{{at: time.Now()}},
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sessions[sess.relay] = sess
+
+	return &talkerPacketConn{PacketConn: conn, session: sess, registry: r}
+}
+
+func (r *talkerRegistry) untrack(sess *talkerSession) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// the relay address may have been reused by a new session
+	if r.sessions[sess.relay] == sess {
+		delete(r.sessions, sess.relay)
+	}
+}
+
+// setClient sets the username and the client address for the session of a relay address.
+func (r *talkerRegistry) setClient(relayAddr net.Addr, username string, client net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if sess, ok := r.sessions[relayAddr.String()]; ok {
+		sess.username, sess.client = username, client
+	}
+}
+
+// sample samples the counters of each session and drops the samples that fell out of the window,
+// keeping the newest sample older than the window.
+func (r *talkerRegistry) sample(now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cutoff := now.Add(-ListenerStatsWindow)
+	for _, sess := range r.sessions {
+		samples := append(sess.samples, talkerSample{
+			at:       now,
+			toPeer:   sess.toPeer.Load(),
+			fromPeer: sess.fromPeer.Load(),
+		})
+		for len(samples) > 2 && !samples[1].at.After(cutoff) {
+			samples = samples[1:]
+		}
+		sess.samples = samples
+	}
+}
+
+// top returns the statistics of the n sessions with the highest bandwidth over the window.
+func (r *talkerRegistry) top(n int) []*stnrv1.SessionStats {
+	r.lock.Lock()
+	stats := make([]*stnrv1.SessionStats, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		stats = append(stats, sess.stats())
+	}
+	r.lock.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		bi, bj := stats[i].ToPeerBps+stats[i].FromPeerBps, stats[j].ToPeerBps+stats[j].FromPeerBps
+		if bi != bj {
+			return bi > bj
+		}
+		return stats[i].RelayAddress < stats[j].RelayAddress
+	})
+
+	if len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+func (sess *talkerSession) stats() *stnrv1.SessionStats {
+	stats := &stnrv1.SessionStats{
+		Listener:      sess.listener,
+		Username:      sess.username,
+		RelayAddress:  sess.relay,
+		ToPeerBytes:   sess.toPeer.Load(),
+		FromPeerBytes: sess.fromPeer.Load(),
+	}
+	if sess.client != nil {
+		stats.Client = sess.client.String()
+	}
+
+	first, last := sess.samples[0], sess.samples[len(sess.samples)-1]
+	if d := last.at.Sub(first.at).Seconds(); d > 0 {
+		stats.Interval = d
+		stats.ToPeerBps = 8 * float64(last.toPeer-first.toPeer) / d
+		stats.FromPeerBps = 8 * float64(last.fromPeer-first.fromPeer) / d
+	}
+
+	return stats
+}
+
+// talkerPacketConn is a relay net.PacketConn that counts the traffic of a session.
+type talkerPacketConn struct {
+	net.PacketConn
+	session  *talkerSession
+	registry *talkerRegistry
+}
+
+// ReadFrom reads a packet received from a peer.
+func (c *talkerPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if n > 0 {
+		c.session.fromPeer.Add(uint64(n))
+	}
+	return n, addr, err
+}
+
+// WriteTo writes a packet to a peer.
+func (c *talkerPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if n > 0 {
+		c.session.toPeer.Add(uint64(n))
+	}
+	return n, err
+}
+
+// Close closes the relay connection and removes the session from the session table.
+func (c *talkerPacketConn) Close() error {
+	c.registry.untrack(c.session)
+	return c.PacketConn.Close()
+}
+
+// GetTopTalkers returns the statistics of the n sessions with the highest bandwidth (in both
+// directions) over the rolling window of the listener statistics, for identifying abusive or
+// broken clients. Sessions at listeners running in single-port mode are not reported.
+func (s *Stunner) GetTopTalkers(n int) []*stnrv1.SessionStats {
+	return s.talkers.top(n)
+}
+
+// NewTopTalkersHandler creates a helper function for querying the top-talkers report.
+func (s *Stunner) NewTopTalkersHandler() object.TopTalkersHandler {
+	return func(n int) []*stnrv1.SessionStats { return s.GetTopTalkers(n) }
+}
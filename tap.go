@@ -0,0 +1,259 @@
+package stunner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pion/logging"
+)
+
+// TapDirection specifies the direction of a tapped packet.
+type TapDirection uint8
+
+const (
+	// TapToPeer marks packets relayed from the client to the peer.
+	TapToPeer TapDirection = iota
+	// TapFromPeer marks packets relayed from the peer to the client.
+	TapFromPeer
+)
+
+// Selectors for choosing the sessions to tap.
+const (
+	TapByUsername = "username"
+	TapByClient   = "client"
+)
+
+var errUnknownTapSelector = errors.New("unknown tap selector, must be either \"username\" or \"client\"")
+
+// PacketTap is a sink for the relayed packets of tapped sessions, e.g., for lawful intercept or
+// compliance recording. Tap is called synchronously from the relay path, so it must not block.
+type PacketTap interface {
+	// Tap records a packet relayed in the given direction between the client of a session and
+	// a peer. The session is identified by the username and the transport address of the client.
+	Tap(username string, client net.Addr, dir TapDirection, peer net.Addr, p []byte)
+	// Close closes the sink.
+	Close() error
+}
+
+type tapSession struct {
+	username string
+	client   net.Addr
+}
+
+// tapRegistry keeps track of the sessions to be tapped.
+type tapRegistry struct {
+	sink     PacketTap
+	sessions map[string]tapSession // keyed by relay address
+	relays   map[string]string     // relay address keyed by client address
+	enabled  map[string]bool       // keyed by selector
+	lock     sync.RWMutex
+}
+
+func newTapRegistry() *tapRegistry {
+	return &tapRegistry{
+		sessions: map[string]tapSession{},
+		relays:   map[string]string{},
+		enabled:  map[string]bool{},
+	}
+}
+
+func (r *tapRegistry) getSink() PacketTap {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.sink
+}
+
+// addSession registers a session on allocation, the session is removed by deleteClient when the
+// allocation is deleted.
+func (r *tapRegistry) addSession(relayAddr net.Addr, username string, client net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	relay := relayAddr.String()
+	r.sessions[relay] = tapSession{username: username, client: client}
+	r.relays[client.String()] = relay
+}
+
+func (r *tapRegistry) deleteSession(relay string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if sess, ok := r.sessions[relay]; ok && sess.client != nil {
+		delete(r.relays, sess.client.String())
+	}
+	delete(r.sessions, relay)
+}
+
+// deleteClient removes the session of a client.
+func (r *tapRegistry) deleteClient(client net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	c := client.String()
+	if relay, ok := r.relays[c]; ok {
+		delete(r.sessions, relay)
+		delete(r.relays, c)
+	}
+}
+
+// lookup returns the sink and the session for a relay address if the session is to be tapped.
+func (r *tapRegistry) lookup(relay string) (PacketTap, tapSession, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.sink == nil || len(r.enabled) == 0 {
+		return nil, tapSession{}, false
+	}
+
+	sess, ok := r.sessions[relay]
+	if !ok {
+		return nil, tapSession{}, false
+	}
+
+	if r.enabled[TapByUsername+"="+sess.username] ||
+		(sess.client != nil && r.enabled[TapByClient+"="+sess.client.String()]) {
+		return r.sink, sess, true
+	}
+
+	return nil, tapSession{}, false
+}
+
+// SetPacketTap sets the sink for the relayed packets of tapped sessions, closing the previous
+// sink, if any. Only allocations created after the sink has been set can be tapped, and
+// allocations at listeners running in single-port mode cannot be tapped. A nil sink disables
+// tapping.
+func (s *Stunner) SetPacketTap(t PacketTap) {
+	s.tap.lock.Lock()
+	old := s.tap.sink
+	s.tap.sink = t
+	s.tap.lock.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			s.log.Warnf("Could not close packet tap: %s", err.Error())
+		}
+	}
+}
+
+// SetSessionTap enables or disables tapping for the sessions selected by the given selector:
+// "username" selects the sessions authenticated with the given username and "client" selects the
+// sessions of the client with the given transport address (in the format IP:port). Tapping takes
+// effect immediately, including for already established sessions.
+func (s *Stunner) SetSessionTap(selector, value string, enable bool) error {
+	switch selector {
+	case TapByUsername:
+	case TapByClient:
+		addr, err := net.ResolveUDPAddr("udp", value)
+		if err != nil {
+			return fmt.Errorf("invalid client address %q: %w", value, err)
+		}
+		value = addr.String()
+	default:
+		return errUnknownTapSelector
+	}
+
+	key := selector + "=" + value
+
+	s.tap.lock.Lock()
+	defer s.tap.lock.Unlock()
+
+	if enable {
+		s.log.Infof("Enabling packet tap for sessions with %s", key)
+		s.tap.enabled[key] = true
+	} else {
+		s.log.Infof("Disabling packet tap for sessions with %s", key)
+		delete(s.tap.enabled, key)
+	}
+
+	return nil
+}
+
+// TapPacketConn is a relay net.PacketConn that mirrors the packets of tapped sessions into a
+// packet tap.
+type TapPacketConn struct {
+	net.PacketConn
+	relay    string
+	registry *tapRegistry
+}
+
+func newTapPacketConn(c net.PacketConn, relayAddr net.Addr, r *tapRegistry) net.PacketConn {
+	return &TapPacketConn{PacketConn: c, relay: relayAddr.String(), registry: r}
+}
+
+// ReadFrom reads a packet received from a peer.
+func (c *TapPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if n > 0 {
+		if sink, sess, ok := c.registry.lookup(c.relay); ok {
+			sink.Tap(sess.username, sess.client, TapFromPeer, addr, p[:n])
+		}
+	}
+	return n, addr, err
+}
+
+// WriteTo writes a packet to a peer.
+func (c *TapPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if n > 0 {
+		if sink, sess, ok := c.registry.lookup(c.relay); ok {
+			sink.Tap(sess.username, sess.client, TapToPeer, addr, p[:n])
+		}
+	}
+	return n, err
+}
+
+// Close closes the relay connection.
+func (c *TapPacketConn) Close() error {
+	c.registry.deleteSession(c.relay)
+	return c.PacketConn.Close()
+}
+
+// UDPMirrorTap is a packet tap that mirrors tapped packets to a UDP target. Each packet is
+// encapsulated into a single datagram with the following header (integers in network byte
+// order):
+//
+//	version (1 byte, currently 1) | direction (1 byte, 0: to peer, 1: from peer) |
+//	session length (2 bytes) | session: "<username>@<client-address>" |
+//	peer length (2 bytes) | peer address | relayed packet
+type UDPMirrorTap struct {
+	conn net.Conn
+	log  logging.LeveledLogger
+}
+
+// NewUDPMirrorTap creates a packet tap that mirrors tapped packets to the given UDP address.
+func NewUDPMirrorTap(addr string, log logging.LeveledLogger) (*UDPMirrorTap, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create UDP mirror to %s: %w", addr, err)
+	}
+	return &UDPMirrorTap{conn: conn, log: log}, nil
+}
+
+// Tap mirrors a packet to the UDP target.
+func (t *UDPMirrorTap) Tap(username string, client net.Addr, dir TapDirection, peer net.Addr, p []byte) {
+	session := username + "@"
+	if client != nil {
+		session += client.String()
+	}
+	peerStr := ""
+	if peer != nil {
+		peerStr = peer.String()
+	}
+
+	buf := make([]byte, 0, 6+len(session)+len(peerStr)+len(p))
+	buf = append(buf, 1, byte(dir))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(session)))
+	buf = append(buf, session...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(peerStr)))
+	buf = append(buf, peerStr...)
+	buf = append(buf, p...)
+
+	if _, err := t.conn.Write(buf); err != nil {
+		t.log.Debugf("Could not mirror tapped packet: %s", err.Error())
+	}
+}
+
+// Close closes the UDP mirror.
+func (t *UDPMirrorTap) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,143 @@
+package stunner
+
+import (
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/object"
+	"github.com/l7mp/stunner/internal/telemetry"
+	"github.com/l7mp/stunner/internal/util"
+)
+
+// MaxTarpitPending is the maximum number of delayed responses that can be outstanding per listener
+// socket in tarpit mode. STUN requests from denied clients exceeding this limit are silently
+// dropped.
+var MaxTarpitPending int64 = 1024
+
+// tarpitErrorCodes is the set of bogus error codes returned to denied clients in tarpit mode.
+var tarpitErrorCodes = []stun.ErrorCode{
+	stun.CodeServerError,
+	stun.CodeStaleNonce,
+	stun.CodeAllocMismatch,
+	stun.CodeInsufficientCapacity,
+}
+
+// TarpitChecker is a callback that decides whether packets from a client should be tarpitted.
+type TarpitChecker = func(addr net.Addr) bool
+
+// TarpitPacketConn is a net.PacketConn that intercepts STUN/TURN requests from denied clients
+// before they would reach the TURN server and, instead of rejecting them immediately, responds
+// with a bogus error after a delay.
+type TarpitPacketConn struct {
+	net.PacketConn
+	listener  *object.Listener
+	checker   TarpitChecker
+	pending   atomic.Int64
+	telemetry *telemetry.Telemetry
+	log       logging.LeveledLogger
+}
+
+// NewTarpitPacketConn decorates a listener PacketConn with tarpit mode. Tarpitting is active only
+// if the tarpit delay of the listener is positive.
+func NewTarpitPacketConn(c net.PacketConn, l *object.Listener, checker TarpitChecker, t *telemetry.Telemetry, log logging.LeveledLogger) net.PacketConn {
+	return &TarpitPacketConn{
+		PacketConn: c,
+		listener:   l,
+		checker:    checker,
+		telemetry:  t,
+		log:        log,
+	}
+}
+
+// ReadFrom reads from the PacketConn. Packets from tarpitted clients are consumed and never
+// returned to the caller.
+func (c *TarpitPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		delay := c.listener.GetTarpitDelay()
+		if delay <= 0 || !c.checker(addr) {
+			return n, addr, nil
+		}
+
+		c.tarpit(p[:n], addr, delay)
+	}
+}
+
+func (c *TarpitPacketConn) tarpit(p []byte, addr net.Addr, delay time.Duration) {
+	c.telemetry.IncrementTarpit(c.listener.Name)
+
+	if !stun.IsMessage(p) {
+		c.log.Debugf("tarpit: dropping non-STUN packet from denied client %s", addr.String())
+		return
+	}
+
+	req := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := req.Decode(); err != nil {
+		c.log.Debugf("tarpit: dropping malformed STUN packet from denied client %s: %s",
+			addr.String(), err.Error())
+		return
+	}
+
+	if req.Type.Class != stun.ClassRequest {
+		c.log.Debugf("tarpit: dropping STUN %s from denied client %s", req.Type.String(),
+			addr.String())
+		return
+	}
+
+	if c.pending.Load() >= MaxTarpitPending {
+		c.log.Debugf("tarpit: too many pending responses, dropping STUN %s from denied "+
+			"client %s", req.Type.String(), addr.String())
+		return
+	}
+
+	code := tarpitErrorCodes[rand.Intn(len(tarpitErrorCodes))] //nolint:gosec
+	res, err := stun.Build(stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+		stun.NewTransactionIDSetter(req.TransactionID), code, stun.Fingerprint)
+	if err != nil {
+		c.log.Debugf("tarpit: could not build error response: %s", err.Error())
+		return
+	}
+
+	c.log.Debugf("tarpit: denied client %s on listener %q sent STUN %s, responding with "+
+		"error %d in %s", addr.String(), c.listener.Name, req.Type.String(), code, delay)
+
+	c.pending.Add(1)
+	time.AfterFunc(delay, func() {
+		defer c.pending.Add(-1)
+		defer func() {
+			if r := recover(); r != nil {
+				util.ReportPanic(c.log, c.telemetry, c.listener.Name, panicComponentTarpit, r)
+			}
+		}()
+		if _, err := c.PacketConn.WriteTo(res.Raw, addr); err != nil {
+			c.log.Debugf("tarpit: could not send error response to client %s: %s",
+				addr.String(), err.Error())
+		}
+	})
+}
+
+// NewTarpitChecker returns a callback that reports whether a client of a listener is denied by
+// the listener's country filters.
+func (s *Stunner) NewTarpitChecker(l *object.Listener) TarpitChecker {
+	return func(addr net.Addr) bool {
+		if !l.HasCountryFilter() {
+			return false
+		}
+
+		country, ok := s.LookupCountry(addr)
+		if !ok {
+			return false
+		}
+
+		return !l.CheckCountry(country)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package stunner
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpRTT returns the smoothed round-trip time of a TCP connection measured by the kernel.
+// Decorated connections are unwrapped until the socket is found.
+func tcpRTT(conn net.Conn) (time.Duration, bool) {
+	sc, ok := conn.(syscall.Conn)
+	for !ok {
+		u, wrapped := conn.(interface{ NetConn() net.Conn })
+		if !wrapped {
+			return 0, false
+		}
+		conn = u.NetConn()
+		sc, ok = conn.(syscall.Conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var info *unix.TCPInfo
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		info, serr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil || serr != nil {
+		return 0, false
+	}
+
+	return time.Duration(info.Rtt) * time.Microsecond, true
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package stunner
+
+import (
+	"net"
+	"time"
+)
+
+func tcpRTT(_ net.Conn) (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,248 @@
+package stunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// MetricsInstanceLabel is the metric label that identifies the STUNner instances managed by a
+// StunnerManager.
+const MetricsInstanceLabel = "stunner_instance"
+
+var (
+	ErrInstanceExists   = errors.New("STUNner instance already exists")
+	ErrInstanceNotFound = errors.New("STUNner instance not found")
+)
+
+// StunnerManager hosts several isolated STUNner instances in the same process, e.g., to serve
+// multiple Gateways from a single sidecar. Each instance is identified by a unique name and has
+// its own configuration, listeners, clusters and authentication, and the metrics of the instance
+// are labeled with the name of the instance (see MetricsInstanceLabel). The manager makes sure
+// that the listeners and the health-check and metrics endpoints of different instances do not
+// conflict.
+type StunnerManager struct {
+	options   Options
+	instances map[string]*Stunner
+	lock      sync.RWMutex // serializes the reconciliation of the instances
+}
+
+// NewStunnerManager creates a new manager. The options are used as a template for creating the
+// instances: the name is overridden with the name of the instance and the name is added to the
+// metrics labels. Note that a custom Resolver, if given, is shared by all instances.
+func NewStunnerManager(options Options) *StunnerManager {
+	return &StunnerManager{
+		options:   options,
+		instances: map[string]*Stunner{},
+	}
+}
+
+// Add creates a new STUNner instance and reconciles it with the given configuration. Returns
+// ErrInstanceExists if an instance with the same name already exists. If the configuration is
+// rejected then the instance is closed and the error is returned.
+func (m *StunnerManager) Add(ctx context.Context, name string, conf *stnrv1.StunnerConfig) (*Stunner, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.instances[name]; ok {
+		return nil, fmt.Errorf("%w: %q", ErrInstanceExists, name)
+	}
+
+	if err := m.checkConflicts(name, conf); err != nil {
+		return nil, err
+	}
+
+	options := m.options
+	options.Name = name
+	options.MetricsLabels = map[string]string{MetricsInstanceLabel: name}
+	for k, v := range m.options.MetricsLabels {
+		options.MetricsLabels[k] = v
+	}
+
+	s := NewStunner(options)
+	if s == nil {
+		return nil, fmt.Errorf("could not create STUNner instance %q", name)
+	}
+
+	if err := s.Reconcile(ctx, conf); err != nil && !errors.As(err, &stnrv1.ErrRestarted{}) {
+		s.Close()
+		return nil, err
+	}
+
+	m.instances[name] = s
+	return s, nil
+}
+
+// Reconcile reconciles an instance with a new configuration, see Stunner.Reconcile.
+func (m *StunnerManager) Reconcile(ctx context.Context, name string, conf *stnrv1.StunnerConfig) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s, ok := m.instances[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInstanceNotFound, name)
+	}
+
+	if err := m.checkConflicts(name, conf); err != nil {
+		return err
+	}
+
+	return s.Reconcile(ctx, conf)
+}
+
+// Delete closes an instance and removes it from the manager.
+func (m *StunnerManager) Delete(name string) error {
+	m.lock.Lock()
+	s, ok := m.instances[name]
+	delete(m.instances, name)
+	m.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInstanceNotFound, name)
+	}
+
+	s.Close()
+	return nil
+}
+
+// Get returns an instance, or nil if no instance exists with the given name.
+func (m *StunnerManager) Get(name string) *Stunner {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.instances[name]
+}
+
+// Keys returns the sorted list of the names of the instances.
+func (m *StunnerManager) Keys() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return sortedKeys(m.instances)
+}
+
+// Status returns the status of each instance, keyed by the name of the instance.
+func (m *StunnerManager) Status() map[string]stnrv1.Status {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ret := make(map[string]stnrv1.Status, len(m.instances))
+	for name, s := range m.instances {
+		ret[name] = s.Status()
+	}
+	return ret
+}
+
+// Shutdown makes all instances fail the readiness check and waits until the allocations of all
+// instances are drained or the context is done, see Stunner.Shutdown.
+func (m *StunnerManager) Shutdown(ctx context.Context) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.instances))
+	i := 0
+	for _, s := range m.instances {
+		wg.Add(1)
+		go func(i int, s *Stunner) {
+			defer wg.Done()
+			errs[i] = s.Shutdown(ctx)
+		}(i, s)
+		i++
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Close closes all instances and removes them from the manager.
+func (m *StunnerManager) Close() {
+	m.lock.Lock()
+	instances := m.instances
+	m.instances = map[string]*Stunner{}
+	m.lock.Unlock()
+
+	for _, s := range instances {
+		s.Close()
+	}
+}
+
+// checkConflicts checks whether the listeners and the health-check and metrics endpoints of a
+// configuration would conflict with those of the other instances.
+func (m *StunnerManager) checkConflicts(name string, conf *stnrv1.StunnerConfig) error {
+	c := conf.DeepCopy()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	ports, endpoints := usedPorts(c), usedEndpoints(c)
+	for _, other := range sortedKeys(m.instances) {
+		if other == name {
+			continue
+		}
+		oc := m.instances[other].GetConfig()
+		for p, l := range usedPorts(oc) {
+			if mine, ok := ports[p]; ok {
+				return stnrv1.ErrInvalidListener{Name: mine, Reason: fmt.Sprintf(
+					"port %s already in use by listener %q of STUNner instance %q",
+					p, l, other)}
+			}
+		}
+		for e := range usedEndpoints(oc) {
+			if endpoints[e] {
+				return fmt.Errorf("%w: admin endpoint %s already in use by STUNner "+
+					"instance %q", stnrv1.ErrAdminConfig, e, other)
+			}
+		}
+	}
+
+	return nil
+}
+
+// usedPorts returns the ports used by the listeners of a validated config, keyed by
+// "<transport>/<port>" (listeners always bind to the wildcard address).
+func usedPorts(conf *stnrv1.StunnerConfig) map[string]string {
+	ret := map[string]string{}
+	for _, l := range conf.Listeners {
+		protos, _ := stnrv1.NewListenerProtocols(l.Protocol)
+		for _, p := range protos {
+			transport := "tcp"
+			if p.IsDatagram() {
+				transport = "udp"
+			}
+			ret[fmt.Sprintf("%s/%d", transport, l.Port)] = l.Name
+		}
+	}
+	return ret
+}
+
+// usedEndpoints returns the host:port of the health-check and metrics servers of a validated
+// config.
+func usedEndpoints(conf *stnrv1.StunnerConfig) map[string]bool {
+	ret := map[string]bool{}
+	endpoints := []string{conf.Admin.MetricsEndpoint}
+	if conf.Admin.HealthCheckEndpoint != nil {
+		endpoints = append(endpoints, *conf.Admin.HealthCheckEndpoint)
+	}
+	for _, e := range endpoints {
+		if e == "" {
+			continue
+		}
+		if u, err := url.Parse(e); err == nil && u.Host != "" {
+			ret[u.Host] = true
+		}
+	}
+	return ret
+}
+
+func sortedKeys(instances map[string]*Stunner) []string {
+	ret := make([]string, 0, len(instances))
+	for name := range instances {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
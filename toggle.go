@@ -0,0 +1,191 @@
+package stunner
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/l7mp/stunner/internal/manager"
+	"github.com/l7mp/stunner/internal/object"
+	stnrv1 "github.com/l7mp/stunner/pkg/apis/v1"
+)
+
+// listenerToggles keeps track of the listeners that have been administratively disabled at runtime
+// and of the relay connections of each listener, so that the allocations of a listener can be
+// drained. The state is kept by listener name, so that it survives the restarts of the listener.
+type listenerToggles struct {
+	disabled map[string]bool
+	relays   map[string]map[*toggledPacketConn]bool // keyed by listener name
+	lock     sync.Mutex
+}
+
+func newListenerToggles() *listenerToggles {
+	return &listenerToggles{
+		disabled: map[string]bool{},
+		relays:   map[string]map[*toggledPacketConn]bool{},
+	}
+}
+
+// isDisabled returns true if the listener has been administratively disabled.
+func (t *listenerToggles) isDisabled(name string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.disabled[name]
+}
+
+func (t *listenerToggles) set(name string, disabled bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if disabled {
+		t.disabled[name] = true
+	} else {
+		delete(t.disabled, name)
+	}
+}
+
+// forget removes the state of a listener that has been removed from the configuration.
+func (t *listenerToggles) forget(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.disabled, name)
+	delete(t.relays, name)
+}
+
+// track registers a relay connection of a listener for draining.
+func (t *listenerToggles) track(name string, conn net.PacketConn) net.PacketConn {
+	c := &toggledPacketConn{PacketConn: conn, name: name, toggles: t}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.relays[name]; !ok {
+		t.relays[name] = map[*toggledPacketConn]bool{}
+	}
+	t.relays[name][c] = true
+
+	return c
+}
+
+func (t *listenerToggles) untrack(c *toggledPacketConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.relays[c.name], c)
+}
+
+// drain closes the relay connections of a listener, which makes the TURN server delete the
+// corresponding allocations, and returns the number of the allocations closed.
+func (t *listenerToggles) drain(name string) int {
+	t.lock.Lock()
+	conns := make([]*toggledPacketConn, 0, len(t.relays[name]))
+	for c := range t.relays[name] {
+		conns = append(conns, c)
+	}
+	t.lock.Unlock()
+
+	for _, c := range conns {
+		c.Close() //nolint:errcheck
+	}
+	return len(conns)
+}
+
+// toggledPacketConn is a relay net.PacketConn that can be closed when the listener is drained.
+type toggledPacketConn struct {
+	net.PacketConn
+	name    string
+	toggles *listenerToggles
+	once    sync.Once
+}
+
+// Close deregisters and closes the relay connection.
+func (c *toggledPacketConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.toggles.untrack(c)
+		err = c.PacketConn.Close()
+	})
+	return err
+}
+
+// reconcileStandby disables the new listeners configured as a warm standby and updates the state
+// of the listeners whose Enabled setting has changed. Listeners whose Enabled setting is unchanged
+// keep their runtime state, so that a standby listener enabled via the admin API remains enabled
+// across reconciliations.
+func (s *Stunner) reconcileStandby(state *manager.ReconciliationState) {
+	for _, j := range state.NewJobQueue {
+		if c, ok := j.NewConfig.(*stnrv1.ListenerConfig); ok && !c.IsEnabled() {
+			s.log.Infof("Listener %q started in standby", c.Name)
+			s.toggles.set(c.Name, true)
+		}
+	}
+	for _, j := range state.ChangedJobQueue {
+		c, ok := j.NewConfig.(*stnrv1.ListenerConfig)
+		if !ok {
+			continue
+		}
+		old, ok := j.OldConfig.(*stnrv1.ListenerConfig)
+		if !ok || old.IsEnabled() == c.IsEnabled() {
+			continue
+		}
+		if c.IsEnabled() {
+			s.log.Infof("Enabling standby listener %q", c.Name)
+		} else {
+			s.log.Infof("Listener %q put in standby", c.Name)
+		}
+		s.toggles.set(c.Name, !c.IsEnabled())
+	}
+}
+
+// DisableListener administratively disables a listener at runtime without removing it from the
+// configuration, e.g., for staged rollouts or incident response: the listener stays bound but
+// refuses new allocations. The existing allocations of the listener remain in effect until they
+// expire, unless drain is set, in which case they are closed immediately. The listener remains
+// disabled, even across reconciliations, until it is enabled with EnableListener or removed from
+// the configuration.
+func (s *Stunner) DisableListener(name string, drain bool) error {
+	if s.GetListener(name) == nil {
+		return fmt.Errorf("unknown listener %q", name)
+	}
+
+	s.log.Infof("Disabling listener %q", name)
+	s.toggles.set(name, true)
+
+	if drain {
+		n := s.toggles.drain(name)
+		for i := 0; i < n; i++ {
+			s.telemetry.IncrementSessionExpired(name, sessionExpiredDrained)
+		}
+		s.log.Infof("Listener %q drained: %d allocation(s) closed", name, n)
+	}
+
+	return nil
+}
+
+// EnableListener enables a listener that has been administratively disabled with
+// DisableListener. EnableListener is a no-op if the listener is not disabled.
+func (s *Stunner) EnableListener(name string) error {
+	if s.GetListener(name) == nil {
+		return fmt.Errorf("unknown listener %q", name)
+	}
+
+	if s.toggles.isDisabled(name) {
+		s.log.Infof("Enabling listener %q", name)
+		s.toggles.set(name, false)
+	}
+
+	return nil
+}
+
+// IsListenerDisabled returns true if a listener has been administratively disabled.
+func (s *Stunner) IsListenerDisabled(name string) bool {
+	return s.toggles.isDisabled(name)
+}
+
+// NewListenerToggleHandler creates a helper function for the admin API to disable and enable
+// listeners.
+func (s *Stunner) NewListenerToggleHandler() object.ListenerToggleHandler {
+	return func(name string, disable, drain bool) error {
+		if disable {
+			return s.DisableListener(name, drain)
+		}
+		return s.EnableListener(name)
+	}
+}
@@ -1,6 +1,7 @@
 package stunner
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
@@ -111,7 +112,7 @@ func TestTurncatPlaintext(t *testing.T) {
 		SuppressRollback: true,
 	})
 
-	err := stunner.Reconcile(&stnrv1.StunnerConfig{
+	err := stunner.Reconcile(context.Background(), &stnrv1.StunnerConfig{
 		ApiVersion: stnrv1.ApiVersion,
 		Admin: stnrv1.AdminConfig{
 			LogLevel:        turncatTestLoglevel,
@@ -227,7 +228,7 @@ func TestTurncatLongterm(t *testing.T) {
 		LogLevel:         turncatTestLoglevel,
 		SuppressRollback: true,
 	})
-	err := stunner.Reconcile(&stnrv1.StunnerConfig{
+	err := stunner.Reconcile(context.Background(), &stnrv1.StunnerConfig{
 		ApiVersion: stnrv1.ApiVersion,
 		Admin: stnrv1.AdminConfig{
 			LogLevel: turncatTestLoglevel,
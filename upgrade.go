@@ -0,0 +1,723 @@
+package stunner
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+
+	"github.com/l7mp/stunner/internal/util"
+	a12n "github.com/l7mp/stunner/pkg/authentication"
+)
+
+// UpgradeFDEnvVar is the environment variable that tells a new stunnerd process the file
+// descriptor of the unix socket over which it inherits the state of the old process.
+const UpgradeFDEnvVar = "STUNNERD_UPGRADE_FD"
+
+const (
+	upgradeProtoRelay  = "RELAY"
+	upgradeAckReceived = 'R'
+	upgradeAckReady    = 'D'
+	upgradeTimeout     = 2 * time.Second
+)
+
+var (
+	// ErrUpgradeNotSupported is returned when hitless upgrades are not supported on the platform.
+	ErrUpgradeNotSupported = errors.New("hitless upgrade not supported on this platform")
+	// ErrUpgradeProtocol is returned when the old and the new process disagree on the handoff.
+	ErrUpgradeProtocol = errors.New("hitless upgrade protocol error")
+	// ErrUpgradeDisabled is returned when the state needed for a hitless upgrade is not tracked,
+	// see Options.HitlessUpgrade.
+	ErrUpgradeDisabled = errors.New("hitless upgrade not enabled")
+)
+
+// upgradeSocket describes a socket handed over to the new process. The file descriptors are sent
+// in the same order as the socket descriptors.
+type upgradeSocket struct {
+	Listener string `json:"listener"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port,omitempty"`
+}
+
+type upgradeChannel struct {
+	Number uint16 `json:"number"`
+	Peer   string `json:"peer"`
+}
+
+// upgradeAllocation is the serialized state of a UDP allocation.
+type upgradeAllocation struct {
+	Listener  string           `json:"listener"`
+	Client    string           `json:"client"`
+	Username  string           `json:"username"`
+	RelayPort int              `json:"relay_port"`
+	Peers     []string         `json:"peers,omitempty"`
+	Channels  []upgradeChannel `json:"channels,omitempty"`
+}
+
+// upgradeState is the state handed over from the old process to the new one.
+type upgradeState struct {
+	Sockets     []upgradeSocket     `json:"sockets"`
+	Allocations []upgradeAllocation `json:"allocations"`
+}
+
+// handoffConn is a socket that can be handed over to a new process.
+type handoffConn interface {
+	syscall.Conn
+	Close() error
+}
+
+type upgradeAuth struct {
+	username string
+	key      []byte
+}
+
+// upgradeRegistry keeps track of the sockets and the UDP allocations to be handed over in a
+// hitless upgrade, and of the state inherited from the old process. The sockets and the
+// allocations are tracked only if tracking is enabled, since this takes a global lock on each
+// allocation, permission and channel event.
+type upgradeRegistry struct {
+	tracking  bool
+	sockets   map[string][]handoffConn      // listener sockets, keyed by listener and protocol
+	relays    map[string]handoffConn        // relay sockets, keyed by listener and port
+	allocs    map[string]*upgradeAllocation // keyed by listener and client address
+	releasers map[string][]func()           // closed when the new process takes over the ports
+
+	// inherited state
+	conn         *net.UnixConn
+	files        map[string][]*os.File // inherited listener sockets
+	relayFiles   map[string]*os.File   // inherited relay sockets
+	restore      []upgradeAllocation
+	restorers    map[string]*restorePacketConn // keyed by listener
+	pendingRelay map[string]*os.File           // relay socket for the allocation being restored
+	pendingAuth  map[string]upgradeAuth        // keyed by listener and client address
+	restoreLock  sync.Mutex
+
+	lock sync.Mutex
+	log  logging.LeveledLogger
+}
+
+func newUpgradeRegistry(tracking bool, log logging.LeveledLogger) *upgradeRegistry {
+	return &upgradeRegistry{
+		tracking:     tracking,
+		sockets:      map[string][]handoffConn{},
+		relays:       map[string]handoffConn{},
+		allocs:       map[string]*upgradeAllocation{},
+		releasers:    map[string][]func(){},
+		files:        map[string][]*os.File{},
+		relayFiles:   map[string]*os.File{},
+		restorers:    map[string]*restorePacketConn{},
+		pendingRelay: map[string]*os.File{},
+		pendingAuth:  map[string]upgradeAuth{},
+		log:          log,
+	}
+}
+
+func upgradeKey(listener, id string) string { return listener + "/" + id }
+
+// resetListener forgets the sockets and the allocations of a listener, called when the listener
+// is (re)started.
+func (r *upgradeRegistry) resetListener(listener string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for k, a := range r.allocs {
+		if a.Listener == listener {
+			delete(r.relays, upgradeKey(listener, strconv.Itoa(a.RelayPort)))
+			delete(r.allocs, k)
+		}
+	}
+	for k := range r.sockets {
+		if len(k) > len(listener) && k[:len(listener)+1] == listener+"/" {
+			delete(r.sockets, k)
+		}
+	}
+	delete(r.releasers, listener)
+	delete(r.restorers, listener)
+}
+
+// addSocket records a listener socket that can be handed over to a new process.
+func (r *upgradeRegistry) addSocket(listener, proto string, c any) {
+	if !r.tracking {
+		return
+	}
+	sc, ok := c.(handoffConn)
+	if !ok {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	k := upgradeKey(listener, proto)
+	r.sockets[k] = append(r.sockets[k], sc)
+}
+
+// addReleaser registers a callback that releases a listener resource that cannot be handed over
+// to the new process.
+func (r *upgradeRegistry) addReleaser(listener string, f func()) {
+	if !r.tracking {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.releasers[listener] = append(r.releasers[listener], f)
+}
+
+// addRelay records a relay socket that can be handed over to a new process.
+func (r *upgradeRegistry) addRelay(listener string, c net.PacketConn) {
+	if !r.tracking {
+		return
+	}
+	sc, ok := c.(handoffConn)
+	if !ok {
+		return
+	}
+	addr, ok := c.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.relays[upgradeKey(listener, strconv.Itoa(addr.Port))] = sc
+}
+
+func (r *upgradeRegistry) addAllocation(listener string, src net.Addr, proto, username string, relayAddr net.Addr) {
+	if !r.tracking {
+		return
+	}
+	relay, ok := relayAddr.(*net.UDPAddr)
+	if !ok || proto != "UDP" {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.allocs[upgradeKey(listener, src.String())] = &upgradeAllocation{
+		Listener:  listener,
+		Client:    src.String(),
+		Username:  username,
+		RelayPort: relay.Port,
+	}
+}
+
+func (r *upgradeRegistry) deleteAllocation(listener string, src net.Addr) {
+	if !r.tracking {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	k := upgradeKey(listener, src.String())
+	a, ok := r.allocs[k]
+	if !ok {
+		return
+	}
+	delete(r.allocs, k)
+	// the relay socket may have been reclaimed by a new allocation with a session token
+	for _, other := range r.allocs {
+		if other.Listener == listener && other.RelayPort == a.RelayPort {
+			return
+		}
+	}
+	delete(r.relays, upgradeKey(listener, strconv.Itoa(a.RelayPort)))
+}
+
+func (r *upgradeRegistry) addPeer(listener string, src net.Addr, peer net.IP) {
+	if !r.tracking {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	a, ok := r.allocs[upgradeKey(listener, src.String())]
+	if !ok || util.Member(a.Peers, peer.String()) {
+		return
+	}
+	a.Peers = append(a.Peers, peer.String())
+}
+
+func (r *upgradeRegistry) deletePeer(listener string, src net.Addr, peer net.IP) {
+	if !r.tracking {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	a, ok := r.allocs[upgradeKey(listener, src.String())]
+	if !ok {
+		return
+	}
+	for i, p := range a.Peers {
+		if p == peer.String() {
+			a.Peers = append(a.Peers[:i], a.Peers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *upgradeRegistry) addChannel(listener string, src, peer net.Addr, num uint16) {
+	if !r.tracking {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	a, ok := r.allocs[upgradeKey(listener, src.String())]
+	if !ok {
+		return
+	}
+	a.Channels = append(a.Channels, upgradeChannel{Number: num, Peer: peer.String()})
+}
+
+func (r *upgradeRegistry) deleteChannel(listener string, src net.Addr, num uint16) {
+	if !r.tracking {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	a, ok := r.allocs[upgradeKey(listener, src.String())]
+	if !ok {
+		return
+	}
+	for i, c := range a.Channels {
+		if c.Number == num {
+			a.Channels = append(a.Channels[:i], a.Channels[i+1:]...)
+			return
+		}
+	}
+}
+
+// takeSockets returns the listener sockets inherited from the old process, if any.
+func (r *upgradeRegistry) takeSockets(listener, proto string) []*os.File {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	k := upgradeKey(listener, proto)
+	files := r.files[k]
+	delete(r.files, k)
+	return files
+}
+
+// takeRelay returns the inherited relay socket for the allocation being restored, if any.
+func (r *upgradeRegistry) takeRelay(listener string) *os.File {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	f := r.pendingRelay[listener]
+	delete(r.pendingRelay, listener)
+	return f
+}
+
+// hasRestore returns true if there are allocations to be restored on a listener.
+func (r *upgradeRegistry) hasRestore(listener string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, a := range r.restore {
+		if a.Listener == listener {
+			return true
+		}
+	}
+	return false
+}
+
+// addRestorer registers the PacketConn used to restore the allocations of a listener.
+func (r *upgradeRegistry) addRestorer(listener string, c *restorePacketConn) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.restorers[listener] = c
+}
+
+// release releases the listener resources that cannot be handed over to the new process. Returns
+// the names of the listeners whose resources were released.
+func (r *upgradeRegistry) release() []string {
+	r.lock.Lock()
+	releasers := r.releasers
+	r.releasers = map[string][]func(){}
+	r.lock.Unlock()
+
+	listeners := []string{}
+	for name, fs := range releasers {
+		for _, f := range fs {
+			f()
+		}
+		listeners = append(listeners, name)
+	}
+	return listeners
+}
+
+// closeHandedOff closes the sockets handed over to the new process: the sockets remain open in
+// the new process.
+func (r *upgradeRegistry) closeHandedOff() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, socks := range r.sockets {
+		for _, c := range socks {
+			c.Close() //nolint:errcheck
+		}
+	}
+	for _, c := range r.relays {
+		c.Close() //nolint:errcheck
+	}
+	r.sockets = map[string][]handoffConn{}
+	r.relays = map[string]handoffConn{}
+	r.allocs = map[string]*upgradeAllocation{}
+}
+
+// closeInherited closes the inherited sockets not claimed by any listener.
+func (r *upgradeRegistry) closeInherited() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, files := range r.files {
+		for _, f := range files {
+			f.Close() //nolint:errcheck
+		}
+	}
+	for _, f := range r.relayFiles {
+		f.Close() //nolint:errcheck
+	}
+	r.files = map[string][]*os.File{}
+	r.relayFiles = map[string]*os.File{}
+	r.restore = nil
+}
+
+// FinishInherit completes a hitless upgrade in the new process: it restores the allocations
+// inherited from the old process and tells the old process to stop serving. Call after the first
+// successful reconciliation, once the listeners are running.
+func (s *Stunner) FinishInherit() error {
+	r := s.upgrade
+	r.lock.Lock()
+	conn := r.conn
+	r.conn = nil
+	r.lock.Unlock()
+	if conn == nil {
+		return nil
+	}
+	defer conn.Close() //nolint:errcheck
+
+	r.restoreAllocations(s.GetRealm())
+	r.closeInherited()
+
+	if _, err := conn.Write([]byte{upgradeAckReady}); err != nil {
+		return fmt.Errorf("could not notify old process: %w", err)
+	}
+	return nil
+}
+
+// inheritPacketConns creates PacketConns from inherited listener sockets.
+func inheritPacketConns(files []*os.File) ([]net.PacketConn, error) {
+	conns := []net.PacketConn{}
+	for _, f := range files {
+		c, err := net.FilePacketConn(f)
+		f.Close() //nolint:errcheck
+		if err != nil {
+			for _, c := range conns {
+				c.Close() //nolint:errcheck
+			}
+			return nil, err
+		}
+		conns = append(conns, c)
+	}
+	return conns, nil
+}
+
+// inheritListener creates a net.Listener from an inherited listener socket.
+func inheritListener(files []*os.File) (net.Listener, error) {
+	// a listener socket is never pooled
+	for _, f := range files[1:] {
+		f.Close() //nolint:errcheck
+	}
+	l, err := net.FileListener(files[0])
+	files[0].Close() //nolint:errcheck
+	return l, err
+}
+
+// newRestoreAuthHandler wraps an auth handler so that the requests injected while restoring an
+// allocation inherited from the old process are authenticated with a one-time key.
+func (r *upgradeRegistry) newRestoreAuthHandler(listener string, h a12n.AuthHandler) a12n.AuthHandler {
+	if h == nil {
+		return nil
+	}
+	return func(username, realm string, src net.Addr) ([]byte, bool) {
+		r.lock.Lock()
+		auth, ok := r.pendingAuth[upgradeKey(listener, src.String())]
+		r.lock.Unlock()
+		if ok && auth.username == username {
+			return auth.key, true
+		}
+		return h(username, realm, src)
+	}
+}
+
+// restoreAllocations restores the UDP allocations inherited from the old process by injecting
+// the requests that would recreate them into the TURN servers of the listeners.
+func (r *upgradeRegistry) restoreAllocations(realm string) {
+	r.restoreLock.Lock()
+	defer r.restoreLock.Unlock()
+
+	r.lock.Lock()
+	restore := r.restore
+	r.restore = nil
+	r.lock.Unlock()
+
+	num := 0
+	for _, a := range restore {
+		if err := r.restoreAllocation(a, realm); err != nil {
+			r.log.Infof("could not restore allocation of client %s on listener %s: %s",
+				a.Client, a.Listener, err.Error())
+			continue
+		}
+		num++
+	}
+	if len(restore) > 0 {
+		r.log.Infof("restored %d of %d allocation(s) inherited from the old process", num,
+			len(restore))
+	}
+}
+
+func (r *upgradeRegistry) restoreAllocation(a upgradeAllocation, realm string) error {
+	k := upgradeKey(a.Listener, strconv.Itoa(a.RelayPort))
+	r.lock.Lock()
+	rc := r.restorers[a.Listener]
+	relay := r.relayFiles[k]
+	delete(r.relayFiles, k)
+	r.lock.Unlock()
+
+	if relay == nil {
+		return errors.New("relay socket not inherited")
+	}
+	defer func() {
+		// the relay socket is not needed if not consumed by the TURN server
+		if f := r.takeRelay(a.Listener); f != nil {
+			f.Close() //nolint:errcheck
+		}
+	}()
+
+	if rc == nil {
+		relay.Close() //nolint:errcheck
+		return errors.New("listener not running")
+	}
+
+	client, err := net.ResolveUDPAddr("udp", a.Client)
+	if err != nil {
+		relay.Close() //nolint:errcheck
+		return err
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		relay.Close() //nolint:errcheck
+		return err
+	}
+	authKey := upgradeKey(a.Listener, client.String())
+	r.lock.Lock()
+	r.pendingAuth[authKey] = upgradeAuth{username: a.Username, key: key}
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		delete(r.pendingAuth, authKey)
+		r.lock.Unlock()
+	}()
+
+	// obtain a nonce
+	res, err := rc.transact(client, stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		turnRequestedTransportUDP)
+	if err != nil {
+		relay.Close() //nolint:errcheck
+		return err
+	}
+	var nonce stun.Nonce
+	if err := nonce.GetFrom(res); err != nil {
+		relay.Close() //nolint:errcheck
+		return fmt.Errorf("no nonce in response: %w", err)
+	}
+
+	auth := []stun.Setter{stun.NewUsername(a.Username), stun.NewRealm(realm), nonce}
+	integrity := stun.MessageIntegrity(key)
+
+	r.lock.Lock()
+	r.pendingRelay[a.Listener] = relay
+	r.lock.Unlock()
+	if _, err := rc.transactOK(client, stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		append([]stun.Setter{turnRequestedTransportUDP}, append(auth, integrity)...)...); err != nil {
+		return fmt.Errorf("allocate: %w", err)
+	}
+
+	for _, p := range a.Peers {
+		ip := net.ParseIP(p)
+		if ip == nil {
+			continue
+		}
+		if _, err := rc.transactOK(client, stun.NewType(stun.MethodCreatePermission,
+			stun.ClassRequest), append([]stun.Setter{peerAddr{ip: ip}},
+			append(auth, integrity)...)...); err != nil {
+			return fmt.Errorf("create permission: %w", err)
+		}
+	}
+
+	for _, c := range a.Channels {
+		peer, err := net.ResolveUDPAddr("udp", c.Peer)
+		if err != nil {
+			continue
+		}
+		if _, err := rc.transactOK(client, stun.NewType(stun.MethodChannelBind,
+			stun.ClassRequest), append([]stun.Setter{
+			turnChannelNumber(c.Number),
+			turnPeerAddress(peer),
+		}, append(auth, integrity)...)...); err != nil {
+			return fmt.Errorf("channel bind: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type restorePacket struct {
+	p    []byte
+	addr net.Addr
+}
+
+// restorePacketConn is a net.PacketConn that lets the upgrade registry inject requests into the
+// TURN server of a listener on behalf of a client and catches the responses.
+type restorePacketConn struct {
+	net.PacketConn
+	inject      chan restorePacket
+	interrupted atomic.Bool
+	waiters     map[[stun.TransactionIDSize]byte]chan *stun.Message
+	lock        sync.Mutex
+}
+
+func newRestorePacketConn(c net.PacketConn) *restorePacketConn {
+	return &restorePacketConn{
+		PacketConn: c,
+		inject:     make(chan restorePacket, 1),
+		waiters:    map[[stun.TransactionIDSize]byte]chan *stun.Message{},
+	}
+}
+
+// ReadFrom reads from the PacketConn, returning the injected requests first.
+func (c *restorePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		select {
+		case pkt := <-c.inject:
+			return copy(p, pkt.p), pkt.addr, nil
+		default:
+		}
+
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil && c.interrupted.Swap(false) {
+			// the read deadline was set to wake us up for an injected request
+			if derr := c.PacketConn.SetReadDeadline(time.Time{}); derr == nil {
+				continue
+			}
+		}
+		return n, addr, err
+	}
+}
+
+// WriteTo writes to the PacketConn, catching the responses to the injected requests.
+func (c *restorePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if stun.IsMessage(p) {
+		var id [stun.TransactionIDSize]byte
+		copy(id[:], p[8:20])
+		c.lock.Lock()
+		ch, ok := c.waiters[id]
+		delete(c.waiters, id)
+		c.lock.Unlock()
+		if ok {
+			m := &stun.Message{Raw: append([]byte{}, p...)}
+			if err := m.Decode(); err == nil {
+				ch <- m
+			}
+			return len(p), nil
+		}
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// transact injects a request and waits for the response.
+func (c *restorePacketConn) transact(src net.Addr, t stun.MessageType, setters ...stun.Setter) (*stun.Message, error) {
+	req, err := stun.Build(append([]stun.Setter{stun.TransactionID, t}, append(setters,
+		stun.Fingerprint)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *stun.Message, 1)
+	c.lock.Lock()
+	c.waiters[req.TransactionID] = ch
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		delete(c.waiters, req.TransactionID)
+		c.lock.Unlock()
+	}()
+
+	c.inject <- restorePacket{p: req.Raw, addr: src}
+	c.interrupted.Store(true)
+	if err := c.PacketConn.SetReadDeadline(time.Now()); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-time.After(upgradeTimeout):
+		return nil, errors.New("timeout")
+	}
+}
+
+// transactOK injects a request and checks that it succeeded.
+func (c *restorePacketConn) transactOK(src net.Addr, t stun.MessageType, setters ...stun.Setter) (*stun.Message, error) {
+	res, err := c.transact(src, t, setters...)
+	if err != nil {
+		return nil, err
+	}
+	if res.Type.Class != stun.ClassSuccessResponse {
+		var code stun.ErrorCodeAttribute
+		if err := code.GetFrom(res); err == nil {
+			return nil, fmt.Errorf("error response: %s", code.String())
+		}
+		return nil, errors.New("error response")
+	}
+	return res, nil
+}
+
+// TURN attributes used in restoring allocations.
+const (
+	attrChannelNumber      = stun.AttrType(0x000C)
+	attrXORPeerAddress     = stun.AttrType(0x0012)
+	attrRequestedTransport = stun.AttrType(0x0019)
+	protoUDP               = 17
+)
+
+type rawAttr struct {
+	t stun.AttrType
+	v []byte
+}
+
+func (a rawAttr) AddTo(m *stun.Message) error {
+	m.Add(a.t, a.v)
+	return nil
+}
+
+type peerAddr struct {
+	ip   net.IP
+	port int
+}
+
+func (a peerAddr) AddTo(m *stun.Message) error {
+	addr := stun.XORMappedAddress{IP: a.ip, Port: a.port}
+	return addr.AddToAs(m, attrXORPeerAddress)
+}
+
+var turnRequestedTransportUDP = rawAttr{t: attrRequestedTransport, v: []byte{protoUDP, 0, 0, 0}}
+
+func turnChannelNumber(n uint16) stun.Setter {
+	return rawAttr{t: attrChannelNumber, v: []byte{byte(n >> 8), byte(n), 0, 0}}
+}
+
+func turnPeerAddress(addr *net.UDPAddr) stun.Setter {
+	return peerAddr{ip: addr.IP, port: addr.Port}
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package stunner
+
+import (
+	"net"
+	"os"
+)
+
+// hitless upgrades are supported on unix platforms only
+const upgradeSupported = false
+
+// Upgrade is not supported on non-unix platforms.
+func (s *Stunner) Upgrade(path string, args []string) (*os.Process, error) {
+	return nil, ErrUpgradeNotSupported
+}
+
+// Handoff is not supported on non-unix platforms.
+func (s *Stunner) Handoff(conn *net.UnixConn) error {
+	return ErrUpgradeNotSupported
+}
+
+// Inherit is not supported on non-unix platforms.
+func (s *Stunner) Inherit(conn *net.UnixConn) error {
+	return ErrUpgradeNotSupported
+}
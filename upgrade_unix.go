@@ -0,0 +1,329 @@
+//go:build unix
+
+package stunner
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// UpgradeTimeout is the time the old process waits for the new process to take over in a
+// hitless upgrade.
+var UpgradeTimeout = time.Minute
+
+// number of file descriptors sent in a single message
+const upgradeFDBatch = 64
+
+// hitless upgrades are supported on unix platforms only
+const upgradeSupported = true
+
+// export collects the state to be handed over, duplicating the file descriptors of the sockets.
+func (r *upgradeRegistry) export() (upgradeState, []*os.File) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	state := upgradeState{Sockets: []upgradeSocket{}, Allocations: []upgradeAllocation{}}
+	files := []*os.File{}
+	add := func(c handoffConn, sock upgradeSocket) bool {
+		f, err := dupSocket(c, upgradeKey(sock.Listener, sock.Protocol))
+		if err != nil {
+			r.log.Debugf("could not duplicate socket of listener %s: %s", sock.Listener,
+				err.Error())
+			return false
+		}
+		files = append(files, f)
+		state.Sockets = append(state.Sockets, sock)
+		return true
+	}
+
+	for k, socks := range r.sockets {
+		for _, c := range socks {
+			listener, proto := splitUpgradeKey(k)
+			add(c, upgradeSocket{Listener: listener, Protocol: proto})
+		}
+	}
+
+	for _, a := range r.allocs {
+		c, ok := r.relays[upgradeKey(a.Listener, strconv.Itoa(a.RelayPort))]
+		if !ok {
+			continue
+		}
+		if add(c, upgradeSocket{Listener: a.Listener, Protocol: upgradeProtoRelay, Port: a.RelayPort}) {
+			state.Allocations = append(state.Allocations, *a)
+		}
+	}
+
+	return state, files
+}
+
+func splitUpgradeKey(k string) (string, string) {
+	for i := len(k) - 1; i >= 0; i-- {
+		if k[i] == '/' {
+			return k[:i], k[i+1:]
+		}
+	}
+	return k, ""
+}
+
+func dupSocket(c handoffConn, name string) (*os.File, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd int
+	var derr error
+	if err := raw.Control(func(s uintptr) {
+		fd, derr = unix.Dup(int(s))
+	}); err != nil {
+		return nil, err
+	}
+	if derr != nil {
+		return nil, derr
+	}
+	unix.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// Upgrade performs a hitless binary upgrade: it starts a new stunnerd process from the given
+// executable and arguments, hands over the listener sockets, the relay sockets and the state of
+// the UDP allocations to the new process over a unix socket, and stops serving once the new
+// process has taken over. The caller should then drain the remaining connections and exit.
+func (s *Stunner) Upgrade(path string, args []string) (*os.Process, error) {
+	if !s.upgrade.tracking {
+		return nil, ErrUpgradeDisabled
+	}
+
+	// SOCK_CLOEXEC is not portable: set close-on-exec with the fork lock held so that the sockets
+	// do not leak into processes started concurrently
+	syscall.ForkLock.RLock()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err == nil {
+		unix.CloseOnExec(fds[0])
+		unix.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("could not create unix socket pair: %w", err)
+	}
+	parent := os.NewFile(uintptr(fds[0]), "upgrade-parent")
+	child := os.NewFile(uintptr(fds[1]), "upgrade-child")
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{child} // becomes fd 3
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", UpgradeFDEnvVar, 3))
+	err = cmd.Start()
+	child.Close() //nolint:errcheck
+	if err != nil {
+		parent.Close() //nolint:errcheck
+		return nil, fmt.Errorf("could not start new process: %w", err)
+	}
+
+	c, err := net.FileConn(parent)
+	parent.Close() //nolint:errcheck
+	if err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		return nil, err
+	}
+	defer c.Close() //nolint:errcheck
+
+	if err := s.Handoff(c.(*net.UnixConn)); err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
+
+// Handoff hands over the listener sockets, the relay sockets and the state of the UDP allocations
+// to a new process over a unix socket, and stops serving the handed-over sockets once the new
+// process has taken over. The resources that cannot be handed over (DTLS listeners and the
+// HTTP servers) are released for the new process once it has received the state, and restored
+// if the new process fails to take over. Requires Options.HitlessUpgrade.
+func (s *Stunner) Handoff(conn *net.UnixConn) error {
+	if !s.upgrade.tracking {
+		return ErrUpgradeDisabled
+	}
+
+	state, files := s.upgrade.export()
+	defer func() {
+		for _, f := range files {
+			f.Close() //nolint:errcheck
+		}
+	}()
+
+	s.log.Infof("handing over %d socket(s) and %d allocation(s) to the new process",
+		len(state.Sockets), len(state.Allocations))
+
+	js, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	msg := binary.BigEndian.AppendUint32(nil, uint32(len(js)))
+	if _, err := conn.Write(append(msg, js...)); err != nil {
+		return fmt.Errorf("could not send state: %w", err)
+	}
+
+	for i := 0; i < len(files); i += upgradeFDBatch {
+		batch := files[i:min(i+upgradeFDBatch, len(files))]
+		fds := make([]int, len(batch))
+		for j, f := range batch {
+			fds[j] = int(f.Fd())
+		}
+		if _, _, err := conn.WriteMsgUnix([]byte{'F'}, unix.UnixRights(fds...), nil); err != nil {
+			return fmt.Errorf("could not send sockets: %w", err)
+		}
+	}
+
+	// the new process needs the ports we cannot hand over
+	if err := readUpgradeAck(conn, upgradeAckReceived); err != nil {
+		return err
+	}
+	released := s.upgrade.release()
+	restartAdmin := func() error { return nil }
+	if len(s.adminManager.Keys()) > 0 {
+		restartAdmin = s.GetAdmin().CloseServers()
+	}
+
+	if err := readUpgradeAck(conn, upgradeAckReady); err != nil {
+		// the new process failed: take back the ports
+		s.log.Warnf("new process failed to take over, restoring the released resources")
+		if err := restartAdmin(); err != nil {
+			s.log.Errorf("could not restart the admin servers: %s", err.Error())
+		}
+		s.restartListeners(released)
+		return err
+	}
+	s.upgrade.closeHandedOff()
+	s.log.Info("new process has taken over")
+
+	return nil
+}
+
+// restartListeners restarts the listeners whose resources were released during a failed handoff.
+func (s *Stunner) restartListeners(names []string) {
+	for _, name := range names {
+		l := s.GetListener(name)
+		if l == nil {
+			continue
+		}
+		err := l.Close()
+		if err == nil || errors.Is(err, object.ErrRestartRequired) {
+			s.onStop(l)
+			err = s.StartServer(l)
+		}
+		if err != nil {
+			s.log.Errorf("could not restart listener %q: %s", name, err.Error())
+			s.onError(l, err)
+			continue
+		}
+		s.onStart(l)
+	}
+}
+
+// Inherit receives the listener sockets, the relay sockets and the state of the UDP allocations
+// from the old process over a unix socket. Listeners use the inherited sockets when started. Call
+// FinishInherit after the first successful reconciliation to complete the upgrade.
+func (s *Stunner) Inherit(conn *net.UnixConn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(UpgradeTimeout)); err != nil {
+		return err
+	}
+
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return fmt.Errorf("could not read state: %w", err)
+	}
+	js := make([]byte, binary.BigEndian.Uint32(hdr))
+	if _, err := io.ReadFull(conn, js); err != nil {
+		return fmt.Errorf("could not read state: %w", err)
+	}
+	state := upgradeState{}
+	if err := json.Unmarshal(js, &state); err != nil {
+		return fmt.Errorf("could not parse state: %w", err)
+	}
+
+	files := []*os.File{}
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(upgradeFDBatch*4))
+	for len(files) < len(state.Sockets) {
+		_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return fmt.Errorf("could not read sockets: %w", err)
+		}
+		cmsgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return fmt.Errorf("could not read sockets: %w", err)
+		}
+		for _, cmsg := range cmsgs {
+			fds, err := unix.ParseUnixRights(&cmsg)
+			if err != nil {
+				return fmt.Errorf("could not read sockets: %w", err)
+			}
+			for _, fd := range fds {
+				files = append(files, os.NewFile(uintptr(fd), "inherited"))
+			}
+		}
+		if oobn == 0 {
+			return ErrUpgradeProtocol
+		}
+	}
+	if len(files) != len(state.Sockets) {
+		for _, f := range files {
+			f.Close() //nolint:errcheck
+		}
+		return ErrUpgradeProtocol
+	}
+
+	r := s.upgrade
+	r.lock.Lock()
+	for i, sock := range state.Sockets {
+		if sock.Protocol == upgradeProtoRelay {
+			r.relayFiles[upgradeKey(sock.Listener, strconv.Itoa(sock.Port))] = files[i]
+			continue
+		}
+		k := upgradeKey(sock.Listener, sock.Protocol)
+		r.files[k] = append(r.files[k], files[i])
+	}
+	r.restore = state.Allocations
+	r.conn = conn
+	r.lock.Unlock()
+
+	s.log.Infof("inherited %d socket(s) and %d allocation(s) from the old process",
+		len(state.Sockets), len(state.Allocations))
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte{upgradeAckReceived}); err != nil {
+		return fmt.Errorf("could not notify old process: %w", err)
+	}
+
+	return nil
+}
+
+func readUpgradeAck(conn *net.UnixConn, ack byte) error {
+	if err := conn.SetReadDeadline(time.Now().Add(UpgradeTimeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return fmt.Errorf("new process did not respond: %w", err)
+	}
+	if buf[0] != ack {
+		return ErrUpgradeProtocol
+	}
+	return nil
+}
@@ -118,15 +118,16 @@ func GetStandardURLFromListener(req *stnrv1.ListenerConfig) (string, error) {
 	return req.GetListenerURI(false)
 }
 
-// GetUriFromListener returns a standard TURN URI from a listener config
+// GetUriFromListener returns a standard TURN URI from a listener config. Multi-protocol listeners
+// yield a URI per protocol.
 func GetTurnUris(req *stnrv1.StunnerConfig) ([]string, error) {
 	ret := []string{}
 	for i := range req.Listeners {
-		uri, err := GetUriFromListener(&req.Listeners[i])
+		uris, err := req.Listeners[i].GetListenerURIs(true)
 		if err != nil {
 			return []string{}, err
 		}
-		ret = append(ret, uri)
+		ret = append(ret, uris...)
 	}
 
 	return ret, nil
@@ -0,0 +1,300 @@
+package stunner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/l7mp/stunner/internal/object"
+)
+
+// WatchdogCheckInterval is the period at which the watchdog checks the readloops of the UDP
+// listeners.
+var WatchdogCheckInterval = time.Second
+
+// watchdogHistorySize is the number of the most recent watchdog events kept.
+const watchdogHistorySize = 32
+
+// Reasons for restarting a listener reported in the watchdog events and the metrics.
+const (
+	watchdogReadloopStuck = "readloop-stuck"
+	watchdogRxStalled     = "rx-stalled"
+)
+
+// WatchdogEvent describes a listener restarted by the watchdog for a wedged dataplane.
+type WatchdogEvent struct {
+	// Time is the time of the restart.
+	Time time.Time
+	// Listener is the name of the restarted listener.
+	Listener string
+	// Reason is either "readloop-stuck", if a readloop has not returned to reading from the
+	// socket, or "rx-stalled", if a readloop has not received any packet despite the socket
+	// having packets queued.
+	Reason string
+	// Stalled is the time the readloop has been stalled for.
+	Stalled time.Duration
+	// Error is the error of restarting the listener, or nil if the restart succeeded.
+	Error error
+}
+
+// WatchdogHandler is called after the watchdog has restarted a listener. The handler is called
+// from the watchdog, so it must not block.
+type WatchdogHandler = func(event WatchdogEvent)
+
+// watchdogStall is a wedged readloop found by the watchdog.
+type watchdogStall struct {
+	reason  string
+	stalled time.Duration
+}
+
+// watchdog keeps track of the readloops of the UDP listeners, keyed by listener name, and finds
+// the ones that are wedged.
+type watchdog struct {
+	timeout atomic.Int64 // in nanoseconds, zero disables the watchdog
+	conns   map[string][]*watchdogPacketConn
+	history []WatchdogEvent
+	lock    sync.Mutex
+}
+
+func newWatchdog() *watchdog {
+	return &watchdog{conns: map[string][]*watchdogPacketConn{}}
+}
+
+// setTimeout sets the time after which a stalled readloop is considered wedged.
+func (w *watchdog) setTimeout(timeout time.Duration) {
+	w.timeout.Store(int64(timeout))
+}
+
+// track decorates the PacketConn served by a readloop of a listener so that the readloop can be
+// watched. The raw socket, if given, is used to check whether the socket has packets queued.
+func (w *watchdog) track(name string, c net.PacketConn, socket net.PacketConn) net.PacketConn {
+	wc := &watchdogPacketConn{PacketConn: c}
+	if sc, ok := socket.(syscall.Conn); ok {
+		if raw, err := sc.SyscallConn(); err == nil {
+			wc.raw = raw
+		}
+	}
+	now := time.Now().UnixNano()
+	wc.lastReturn.Store(now)
+	wc.lastPacket.Store(now)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.conns[name] = append(w.conns[name], wc)
+	return wc
+}
+
+// reset forgets the readloops of a listener, called when the listener is (re)started.
+func (w *watchdog) reset(name string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.conns, name)
+}
+
+// prune forgets the readloops of the listeners that no longer exist.
+func (w *watchdog) prune(exists func(string) bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for name := range w.conns {
+		if !exists(name) {
+			delete(w.conns, name)
+		}
+	}
+}
+
+// listeners returns the names of the watched listeners.
+func (w *watchdog) listeners() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	ret := make([]string, 0, len(w.conns))
+	for name := range w.conns {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// check returns the first wedged readloop of a listener, if any.
+func (w *watchdog) check(name string, now time.Time) (watchdogStall, bool) {
+	timeout := time.Duration(w.timeout.Load())
+	if timeout <= 0 {
+		return watchdogStall{}, false
+	}
+
+	w.lock.Lock()
+	conns := append([]*watchdogPacketConn{}, w.conns[name]...)
+	w.lock.Unlock()
+
+	for _, c := range conns {
+		if st, ok := c.stalled(now, timeout); ok {
+			return st, true
+		}
+	}
+	return watchdogStall{}, false
+}
+
+// record adds an event to the history, dropping the oldest event if the history is full.
+func (w *watchdog) record(e WatchdogEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.history = append(w.history, e)
+	if len(w.history) > watchdogHistorySize {
+		w.history = w.history[len(w.history)-watchdogHistorySize:]
+	}
+}
+
+// events returns a copy of the history.
+func (w *watchdog) events() []WatchdogEvent {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return append([]WatchdogEvent{}, w.history...)
+}
+
+// watchdogPacketConn is a listener net.PacketConn that records the progress of the readloop
+// reading from it.
+type watchdogPacketConn struct {
+	net.PacketConn
+	raw syscall.RawConn
+	// whether the readloop is inside ReadFrom, and whether it has exited on an error
+	reading, exited atomic.Bool
+	// unix time in nanoseconds of the last return from ReadFrom and of the last packet read
+	lastReturn, lastPacket atomic.Int64
+}
+
+// ReadFrom reads from the PacketConn.
+func (c *watchdogPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.reading.Store(true)
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	now := time.Now().UnixNano()
+	if err == nil {
+		c.lastPacket.Store(now)
+	}
+	c.lastReturn.Store(now)
+	c.reading.Store(false)
+	// the TURN server exits the readloop on any error
+	if err != nil {
+		c.exited.Store(true)
+	}
+	return n, addr, err
+}
+
+// stalled checks whether the readloop is wedged: either it has not returned to reading from the
+// socket for longer than the timeout, or it has not read any packet for longer than the timeout
+// although the socket has packets queued.
+func (c *watchdogPacketConn) stalled(now time.Time, timeout time.Duration) (watchdogStall, bool) {
+	if c.exited.Load() {
+		return watchdogStall{}, false
+	}
+
+	if !c.reading.Load() {
+		if d := now.Sub(time.Unix(0, c.lastReturn.Load())); d > timeout {
+			return watchdogStall{reason: watchdogReadloopStuck, stalled: d}, true
+		}
+		return watchdogStall{}, false
+	}
+
+	d := now.Sub(time.Unix(0, c.lastPacket.Load()))
+	if d <= timeout || c.raw == nil {
+		return watchdogStall{}, false
+	}
+	if queued, ok := socketRxQueue(c.raw); ok && queued > 0 {
+		return watchdogStall{reason: watchdogRxStalled, stalled: d}, true
+	}
+	return watchdogStall{}, false
+}
+
+// SetWatchdogHandler sets the handler called after the watchdog has restarted a listener. A nil
+// handler removes the handler.
+func (s *Stunner) SetWatchdogHandler(h WatchdogHandler) {
+	if h == nil {
+		s.watchdogHook.Store(nil)
+		return
+	}
+	s.watchdogHook.Store(&h)
+}
+
+// GetWatchdogEvents returns the most recent listener restarts performed by the watchdog, oldest
+// first.
+func (s *Stunner) GetWatchdogEvents() []WatchdogEvent {
+	return s.watchdog.events()
+}
+
+// runWatchdog checks the readloops of the UDP listeners and restarts the listeners with a wedged
+// readloop until the context is canceled.
+func (s *Stunner) runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(WatchdogCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.watchdog.prune(func(name string) bool { return s.GetListener(name) != nil })
+		for _, name := range s.watchdog.listeners() {
+			if _, ok := s.watchdog.check(name, time.Now()); ok {
+				s.restartWedgedListener(name)
+			}
+		}
+	}
+}
+
+// restartListener closes the TURN server of a listener and starts a new one. Must be called with
+// the standby lock held.
+func (s *Stunner) restartListener(l *object.Listener) error {
+	err := l.Close()
+	if err == nil || errors.Is(err, object.ErrRestartRequired) {
+		s.onStop(l)
+		err = s.StartServer(l)
+	}
+	if err != nil {
+		s.onError(l, err)
+		return err
+	}
+	s.onStart(l)
+	return nil
+}
+
+// restartWedgedListener restarts a listener with a wedged readloop. The readloop is rechecked
+// with the reconciliation lock held, since the listener may have been restarted in the meantime.
+// The goroutine of the wedged readloop cannot be stopped, but the new TURN server serves the
+// listener with fresh readloops. Allocations do not survive the restart.
+func (s *Stunner) restartWedgedListener(name string) {
+	s.standbyLock.Lock()
+	defer s.standbyLock.Unlock()
+
+	l := s.GetListener(name)
+	if l == nil || !l.IsRunning() || s.shutdown || s.IsStandby() {
+		return
+	}
+	st, ok := s.watchdog.check(name, time.Now())
+	if !ok {
+		return
+	}
+
+	s.log.Errorf("Watchdog: dataplane of listener %q wedged (%s for %s), restarting listener",
+		name, st.reason, st.stalled.Round(time.Millisecond))
+	s.telemetry.IncrementWatchdogRestart(name, st.reason)
+
+	err := s.restartListener(l)
+	if err != nil {
+		s.log.Errorf("Watchdog: could not restart listener %q: %s", name, err.Error())
+	} else {
+		s.log.Infof("Watchdog: listener %q restarted", name)
+	}
+
+	e := WatchdogEvent{Time: time.Now(), Listener: name, Reason: st.reason, Stalled: st.stalled,
+		Error: err}
+	s.watchdog.record(e)
+	if h := s.watchdogHook.Load(); h != nil {
+		(*h)(e)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package stunner
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketRxQueue returns the number of bytes queued at the receive buffer of a socket.
+func socketRxQueue(raw syscall.RawConn) (int, bool) {
+	var queued int
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		queued, serr = unix.IoctlGetInt(int(fd), unix.SIOCINQ)
+	}); err != nil || serr != nil {
+		return 0, false
+	}
+	return queued, true
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package stunner
+
+import "syscall"
+
+func socketRxQueue(_ syscall.RawConn) (int, bool) {
+	return 0, false
+}